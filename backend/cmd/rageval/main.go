@@ -0,0 +1,77 @@
+// rageval 用课程的黄金问答集评测当前的分块、检索与生成配置。
+//
+// 用法：
+//
+//	go run ./cmd/rageval -course 1 [-k 5] [-provider dashscope] [-json] [-min-recall 0.8]
+//
+// 数据库路径与模型配置沿用服务端的环境变量（DB_PATH、OPENAI_API_KEY、RAG_PROVIDER 等）。
+// 指定 -min-recall 时，recall@k 低于阈值以非零状态退出，便于在 CI 中拦截检索效果回退。
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/online-education-platform/backend/config"
+	"github.com/online-education-platform/backend/database"
+	"github.com/online-education-platform/backend/handlers"
+	"github.com/online-education-platform/backend/utils"
+)
+
+func main() {
+	courseID := flag.Int64("course", 0, "要评测的课程 ID")
+	k := flag.Int("k", 5, "recall@k 的检索深度")
+	provider := flag.String("provider", "", "模型提供方，留空时读取 RAG_PROVIDER")
+	asJSON := flag.Bool("json", false, "以 JSON 输出完整报告")
+	minRecall := flag.Float64("min-recall", 0, "recall@k 低于该值时以状态码 1 退出")
+	flag.Parse()
+
+	if *courseID <= 0 {
+		fmt.Fprintln(os.Stderr, "请通过 -course 指定课程 ID")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	utils.InitLogger()
+	cfg := config.Load()
+	if err := database.InitDB(cfg.DBPath); err != nil {
+		fmt.Fprintf(os.Stderr, "数据库初始化失败: %v\n", err)
+		os.Exit(1)
+	}
+	defer database.CloseDB()
+	handlers.InitRAGIndex(filepath.Join(filepath.Dir(cfg.DBPath), "rag_index"))
+
+	report, err := handlers.EvaluateRAGCourse(*courseID, *k, *provider)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "评测失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		for _, result := range report.Results {
+			status := "ok"
+			if result.Error != "" {
+				status = "error: " + result.Error
+			}
+			fmt.Printf("#%-4d recall=%.2f rr=%.2f faith=%.2f %5dms  %s  [%s]\n",
+				result.CaseID, result.Recall, result.ReciprocalRank, result.Faithfulness,
+				result.TotalLatencyMs, result.Question, status)
+		}
+		fmt.Printf("\n模型: embedding=%s llm=%s\n", report.EmbeddingModel, report.LLMModel)
+		fmt.Printf("问题数: %d（失败 %d）\n", report.Cases, report.Failed)
+		fmt.Printf("recall@%d: %.3f  MRR: %.3f  依据率: %.3f\n", report.K, report.RecallAtK, report.MRR, report.Faithfulness)
+		fmt.Printf("平均耗时: %.0fms（检索 %.0fms）  P95: %dms\n", report.AvgLatencyMs, report.AvgRetrievalMs, report.P95LatencyMs)
+	}
+
+	if *minRecall > 0 && report.RecallAtK < *minRecall {
+		fmt.Fprintf(os.Stderr, "recall@%d %.3f 低于阈值 %.3f\n", report.K, report.RecallAtK, *minRecall)
+		os.Exit(1)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
 
 	"github.com/XSAM/otelsql"
@@ -41,22 +42,27 @@ func InitDB(dbPath string) error {
 		return fmt.Errorf("鏃犳硶杩炴帴鍒版暟鎹簱: %v", err)
 	}
 
-	// 1. 鍏堟墽琛屽熀纭€寤鸿〃锛堝鏋滄槸绗竴娆￠儴缃诧紝杩欓噷浼氬垱寤烘墍鏈夎〃锛?
-	schemaSQL, err := os.ReadFile("database/schema.sql")
+	if err := Migrate("database/schema.sql"); err != nil {
+		return err
+	}
+
+	utils.GetLogger().Info("鉁?鏁版嵁搴撳垵濮嬪寲鎴愬姛")
+	return nil
+}
+
+// Migrate 在 DB 上先执行 schemaPath 中的基础建表语句，再补齐后续新增的表和列；
+// 启动时与测试建库走同一套流程
+func Migrate(schemaPath string) error {
+	schemaSQL, err := os.ReadFile(schemaPath)
 	if err != nil {
-		return fmt.Errorf("鏃犳硶璇诲彇schema.sql: %v", err)
+		return fmt.Errorf("无法读取schema.sql: %v", err)
 	}
 	if _, err = DB.Exec(string(schemaSQL)); err != nil {
-		return fmt.Errorf("鏃犳硶鍒涘缓鏁版嵁搴撹〃: %v", err)
+		return fmt.Errorf("无法创建数据库表: %v", err)
 	}
-
-	// 2. 鑷姩杩佺Щ閫昏緫锛氭鏌ュ苟琛ュ厖鐜版湁琛ㄤ腑缂哄け鐨勫垪
-	// 杩欓噷鍒楀嚭鎵€鏈変綘鍚庢潵鏂板鐨勫瓧娈碉紝姣忔鍚姩閮戒細妫€鏌?
 	if err := autoMigrate(); err != nil {
-		return fmt.Errorf("鏁版嵁搴撹嚜鍔ㄨ縼绉诲け璐? %v", err)
+		return fmt.Errorf("数据库自动迁移失败: %v", err)
 	}
-
-	utils.GetLogger().Info("鉁?鏁版嵁搴撳垵濮嬪寲鎴愬姛")
 	return nil
 }
 
@@ -159,6 +165,32 @@ func autoMigrate() error {
 		return err
 	}
 
+	// 6a. discussions 表 - AI 助教根据课程知识库生成的回答草稿（ai_status 为空表示未排队）
+	if err := addColumnIfNotExists("discussions", "ai_status", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("discussions", "ai_draft", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("discussions", "ai_confidence", "REAL"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("discussions", "ai_linked_knowledge", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("discussions", "ai_error", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("discussions", "ai_attempts", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("discussions", "ai_next_run_at", "DATETIME"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("discussions", "ai_updated_at", "DATETIME"); err != nil {
+		return err
+	}
+
 	// 6b. reply_favorites 琛?
 	if _, err := DB.Exec(`
 		CREATE TABLE IF NOT EXISTS reply_favorites (
@@ -179,6 +211,54 @@ func autoMigrate() error {
 		return err
 	}
 
+	// 7a. exam_answers 表 - 答错客观题的 AI 讲解（coaching 为 JSON：讲解与复习清单）
+	if err := addColumnIfNotExists("exam_answers", "coaching_status", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_answers", "coaching", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_answers", "coaching_error", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_answers", "coaching_attempts", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_answers", "coaching_next_run_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	// 7b. exam_questions 表 - 主观题评分细则（rubric 为 JSON 数组：评分点与分值）和参考答案
+	if err := addColumnIfNotExists("exam_questions", "rubric", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_questions", "reference_answer", "TEXT"); err != nil {
+		return err
+	}
+
+	// 7c. exam_answers 表 - 主观题的 AI 评分建议（ai_grade 为 JSON），教师确认或改分后记录批改人
+	if err := addColumnIfNotExists("exam_answers", "ai_grade_status", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_answers", "ai_grade", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_answers", "ai_grade_error", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_answers", "ai_grade_attempts", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_answers", "ai_grade_next_run_at", "DATETIME"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_answers", "graded_by", "INTEGER"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_answers", "graded_at", "DATETIME"); err != nil {
+		return err
+	}
+
 	// 7. ai_corrections 琛?- AI 瑙ｆ瀽淇敼璁板綍锛圥LAN-05锛?
 	if _, err := DB.Exec(`
 		CREATE TABLE IF NOT EXISTS ai_corrections (
@@ -196,6 +276,184 @@ func autoMigrate() error {
 	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_ai_corrections_user_id ON ai_corrections(user_id)`)
 	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_ai_corrections_exam_id ON ai_corrections(exam_id)`)
 
+	// 7d. exam_grading_audit 表 - 教师采纳或改动 AI 评分建议的记录
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS exam_grading_audit (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			exam_id        INTEGER NOT NULL REFERENCES exams(id) ON DELETE CASCADE,
+			answer_id      INTEGER NOT NULL REFERENCES exam_answers(id) ON DELETE CASCADE,
+			user_id        INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			action         TEXT NOT NULL,
+			previous_score REAL,
+			ai_score       REAL,
+			final_score    REAL NOT NULL,
+			proposal_json  TEXT,
+			note           TEXT NOT NULL DEFAULT '',
+			created_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 exam_grading_audit 表失败: %v", err)
+	}
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_exam_grading_audit_exam_id ON exam_grading_audit(exam_id)`)
+
+	// 7e. question_bank 表 - 课程题库，题目可被多场考试引用或按规则抽取
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS question_bank (
+			id               INTEGER PRIMARY KEY AUTOINCREMENT,
+			course_id        INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+			type             TEXT NOT NULL,
+			stem             TEXT NOT NULL,
+			options          TEXT,
+			answer           TEXT NOT NULL DEFAULT '',
+			score            REAL NOT NULL,
+			rubric           TEXT,
+			reference_answer TEXT,
+			difficulty       TEXT NOT NULL DEFAULT 'medium',
+			use_count        INTEGER NOT NULL DEFAULT 0,
+			last_used_at     DATETIME,
+			created_by       INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 question_bank 表失败: %v", err)
+	}
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS question_bank_tags (
+			question_id INTEGER NOT NULL REFERENCES question_bank(id) ON DELETE CASCADE,
+			tag         TEXT NOT NULL,
+			PRIMARY KEY (question_id, tag)
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 question_bank_tags 表失败: %v", err)
+	}
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS question_bank_usage (
+			id               INTEGER PRIMARY KEY AUTOINCREMENT,
+			bank_question_id INTEGER NOT NULL REFERENCES question_bank(id) ON DELETE CASCADE,
+			exam_id          INTEGER NOT NULL REFERENCES exams(id) ON DELETE CASCADE,
+			exam_question_id INTEGER NOT NULL,
+			created_at       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 question_bank_usage 表失败: %v", err)
+	}
+
+	// 7f. exam_questions 表 - 来源题库题目与抽题规则（rule_id 非空表示按规则抽取，只出现在抽到它的学生试卷中）
+	if err := addColumnIfNotExists("exam_questions", "bank_question_id", "INTEGER"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_questions", "rule_id", "INTEGER"); err != nil {
+		return err
+	}
+
+	// 7g. exam_question_rules / exam_papers 表 - 按规则从题库随机组卷，每个学生一份试卷
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS exam_question_rules (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			exam_id     INTEGER NOT NULL REFERENCES exams(id) ON DELETE CASCADE,
+			type        TEXT NOT NULL DEFAULT '',
+			tag         TEXT NOT NULL DEFAULT '',
+			difficulty  TEXT NOT NULL DEFAULT '',
+			count       INTEGER NOT NULL,
+			score       REAL NOT NULL DEFAULT 0,
+			order_index INTEGER NOT NULL DEFAULT 0,
+			created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 exam_question_rules 表失败: %v", err)
+	}
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS exam_papers (
+			exam_id     INTEGER NOT NULL REFERENCES exams(id) ON DELETE CASCADE,
+			student_id  INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			question_id INTEGER NOT NULL REFERENCES exam_questions(id) ON DELETE CASCADE,
+			order_index INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (exam_id, student_id, question_id)
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 exam_papers 表失败: %v", err)
+	}
+	// exam_paper_draws 每个学生一行，生成试卷的事务先登记，避免并发的首次访问各抽一份试卷
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS exam_paper_draws (
+			exam_id    INTEGER NOT NULL REFERENCES exams(id) ON DELETE CASCADE,
+			student_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (exam_id, student_id)
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 exam_paper_draws 表失败: %v", err)
+	}
+
+	// 7h. exam_shuffles 表 - 学生个人试卷的题目顺序和选项顺序，交卷时据此还原答案
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS exam_shuffles (
+			exam_id     INTEGER NOT NULL REFERENCES exams(id) ON DELETE CASCADE,
+			student_id  INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			seed        INTEGER NOT NULL,
+			layout_json TEXT NOT NULL,
+			created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (exam_id, student_id)
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 exam_shuffles 表失败: %v", err)
+	}
+
+	// 7i. 客观题评分规则：多选题部分得分和答错倒扣分，题库题目加入考试时一并复制
+	if err := addColumnIfNotExists("exam_questions", "scoring_policy", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_questions", "wrong_penalty", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("question_bank", "scoring_policy", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("question_bank", "wrong_penalty", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// 7j. 编程题自动评测：考试作答和作业提交的评测状态与结果（judge_result 为 JSON：逐个测试用例的结论），
+	// 作业的评测配置（judge_config 为 JSON：语言、资源限制和测试用例）
+	if err := addColumnIfNotExists("exam_answers", "judge_status", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_answers", "judge_result", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_answers", "judge_error", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_answers", "judge_attempts", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("exam_answers", "judge_next_run_at", "DATETIME"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("assignments", "judge_config", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("assignment_submissions", "language", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("assignment_submissions", "judge_status", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("assignment_submissions", "judge_result", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("assignment_submissions", "judge_error", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("assignment_submissions", "judge_attempts", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("assignment_submissions", "judge_next_run_at", "DATETIME"); err != nil {
+		return err
+	}
+
 	// 8. RAG knowledge base tables.
 	if _, err := DB.Exec(`
 		CREATE TABLE IF NOT EXISTS rag_documents (
@@ -249,6 +507,18 @@ func autoMigrate() error {
 	if err := addColumnIfNotExists("rag_documents", "created_at", "DATETIME"); err != nil {
 		return err
 	}
+	if err := addColumnIfNotExists("rag_documents", "chunk_strategy", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("rag_documents", "status", "TEXT NOT NULL DEFAULT 'ready'"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("rag_documents", "error", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("rag_documents", "progress", "INTEGER NOT NULL DEFAULT 100"); err != nil {
+		return err
+	}
 	if err := addColumnIfNotExists("rag_chunks", "course_id", "INTEGER"); err != nil {
 		return err
 	}
@@ -261,6 +531,18 @@ func autoMigrate() error {
 	if err := addColumnIfNotExists("rag_chunks", "created_at", "DATETIME"); err != nil {
 		return err
 	}
+	if err := addColumnIfNotExists("rag_chunks", "metadata", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("rag_chunks", "embedding_model", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("rag_chunks", "embedding_dim", "INTEGER"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("rag_chunks", "content_hash", "TEXT"); err != nil {
+		return err
+	}
 	if err := addColumnIfNotExists("rag_queries", "answer", "TEXT"); err != nil {
 		return err
 	}
@@ -270,6 +552,30 @@ func autoMigrate() error {
 	if err := addColumnIfNotExists("rag_queries", "session_id", "TEXT"); err != nil {
 		return err
 	}
+	if err := addColumnIfNotExists("rag_queries", "attribution", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("rag_queries", "rewritten_query", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("rag_queries", "expanded_queries", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("rag_queries", "no_evidence", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("rag_queries", "review_status", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("rag_queries", "reviewed_by", "INTEGER"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("rag_queries", "reviewed_at", "DATETIME"); err != nil {
+		return err
+	}
+	if err := addColumnIfNotExists("rag_queries", "canonical_chunk_id", "INTEGER"); err != nil {
+		return err
+	}
 	if _, err := DB.Exec(`
 		UPDATE rag_chunks
 		SET course_id = (
@@ -281,11 +587,201 @@ func autoMigrate() error {
 	`); err != nil {
 		return fmt.Errorf("鍥炲～ rag_chunks.course_id 澶辫触: %v", err)
 	}
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS rag_embedding_cache (
+			model        TEXT NOT NULL,
+			content_hash TEXT NOT NULL,
+			embedding    TEXT NOT NULL,
+			dim          INTEGER NOT NULL,
+			created_at   DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (model, content_hash)
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 rag_embedding_cache 表失败: %v", err)
+	}
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS rag_ingest_jobs (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			doc_id         INTEGER NOT NULL REFERENCES rag_documents(id) ON DELETE CASCADE,
+			course_id      INTEGER NOT NULL,
+			filename       TEXT NOT NULL,
+			chunk_strategy TEXT,
+			provider       TEXT,
+			payload        BLOB,
+			status         TEXT NOT NULL DEFAULT 'queued',
+			attempts       INTEGER NOT NULL DEFAULT 0,
+			max_attempts   INTEGER NOT NULL DEFAULT 4,
+			next_run_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_error     TEXT,
+			created_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 rag_ingest_jobs 表失败: %v", err)
+	}
+	// personal_key 标记任务使用上传者的个人 API Key，Key 本身只保存在内存中
+	if err := addColumnIfNotExists("rag_ingest_jobs", "personal_key", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS rag_reembed_jobs (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			course_id   INTEGER,
+			model       TEXT NOT NULL,
+			status      TEXT NOT NULL DEFAULT 'running',
+			total       INTEGER NOT NULL DEFAULT 0,
+			processed   INTEGER NOT NULL DEFAULT 0,
+			cache_hits  INTEGER NOT NULL DEFAULT 0,
+			error       TEXT,
+			created_by  INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			finished_at DATETIME
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 rag_reembed_jobs 表失败: %v", err)
+	}
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS rag_eval_cases (
+			id               INTEGER PRIMARY KEY AUTOINCREMENT,
+			course_id        INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+			question         TEXT NOT NULL,
+			expected_answer  TEXT,
+			expected_doc_ids TEXT NOT NULL DEFAULT '[]',
+			created_by       INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at       DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 rag_eval_cases 表失败: %v", err)
+	}
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS rag_query_feedback (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			query_id   INTEGER NOT NULL REFERENCES rag_queries(id) ON DELETE CASCADE,
+			course_id  INTEGER NOT NULL,
+			user_id    INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			rating     INTEGER NOT NULL,
+			comment    TEXT,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(query_id, user_id)
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 rag_query_feedback 表失败: %v", err)
+	}
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS rag_eval_runs (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			course_id   INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+			status      TEXT NOT NULL DEFAULT 'running',
+			k           INTEGER NOT NULL DEFAULT 5,
+			total       INTEGER NOT NULL DEFAULT 0,
+			processed   INTEGER NOT NULL DEFAULT 0,
+			report      TEXT,
+			error       TEXT,
+			created_by  INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			created_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			finished_at DATETIME
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 rag_eval_runs 表失败: %v", err)
+	}
+	// ai_usage 记录每次大模型对话与向量化调用的用量；request_id 相同的多次调用属于同一次用户请求
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS ai_usage (
+			id                INTEGER PRIMARY KEY AUTOINCREMENT,
+			request_id        TEXT NOT NULL,
+			user_id           INTEGER,
+			role              TEXT,
+			course_id         INTEGER,
+			feature           TEXT NOT NULL,
+			provider          TEXT NOT NULL,
+			operation         TEXT NOT NULL,
+			model             TEXT,
+			prompt_tokens     INTEGER NOT NULL DEFAULT 0,
+			completion_tokens INTEGER NOT NULL DEFAULT 0,
+			estimated         INTEGER NOT NULL DEFAULT 0,
+			latency_ms        INTEGER NOT NULL DEFAULT 0,
+			success           INTEGER NOT NULL DEFAULT 1,
+			error             TEXT,
+			created_at        DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 ai_usage 表失败: %v", err)
+	}
+	// ai_quotas 每日用量配额：scope=role 时按角色限制每个用户，scope=course 时限制整门课程学生的用量；0 表示不限
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS ai_quotas (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			scope          TEXT NOT NULL,
+			scope_key      TEXT NOT NULL,
+			daily_requests INTEGER NOT NULL DEFAULT 0,
+			daily_tokens   INTEGER NOT NULL DEFAULT 0,
+			updated_by     INTEGER REFERENCES users(id) ON DELETE SET NULL,
+			updated_at     DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(scope, scope_key)
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 ai_quotas 表失败: %v", err)
+	}
+	// rag_kb_versions 课程知识库版本号，文档增删或入库完成时递增，语义缓存只命中当前版本
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS rag_kb_versions (
+			course_id  INTEGER PRIMARY KEY REFERENCES courses(id) ON DELETE CASCADE,
+			version    INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 rag_kb_versions 表失败: %v", err)
+	}
+	// rag_answer_cache 语义缓存：按课程、知识库版本与问题向量相似度复用已生成的回答
+	if _, err := DB.Exec(`
+		CREATE TABLE IF NOT EXISTS rag_answer_cache (
+			id              INTEGER PRIMARY KEY AUTOINCREMENT,
+			course_id       INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+			kb_version      INTEGER NOT NULL,
+			embedding_model TEXT NOT NULL,
+			question        TEXT NOT NULL,
+			embedding       TEXT NOT NULL,
+			answer          TEXT NOT NULL,
+			sources         TEXT NOT NULL,
+			attribution     TEXT,
+			hit_count       INTEGER NOT NULL DEFAULT 0,
+			created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_hit_at     DATETIME
+		)
+	`); err != nil {
+		return fmt.Errorf("创建 rag_answer_cache 表失败: %v", err)
+	}
+	// exam_questions 表 - 旧库 type 的 CHECK 约束不含后来新增的题型，按需重建
+	if err := rebuildExamQuestionsTableIfNeeded(); err != nil {
+		return err
+	}
+
 	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_rag_documents_course_id ON rag_documents(course_id)`)
 	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_rag_chunks_doc_id       ON rag_chunks(doc_id)`)
 	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_rag_chunks_course_id    ON rag_chunks(course_id)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_rag_chunks_model        ON rag_chunks(embedding_model)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_rag_ingest_jobs_status  ON rag_ingest_jobs(status, next_run_at)`)
 	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_rag_queries_course_id   ON rag_queries(course_id)`)
 	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_rag_queries_user_id     ON rag_queries(user_id)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_rag_eval_cases_course   ON rag_eval_cases(course_id)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_rag_feedback_course     ON rag_query_feedback(course_id, rating)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_rag_eval_runs_course    ON rag_eval_runs(course_id)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_ai_usage_user_time      ON ai_usage(user_id, created_at)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_ai_usage_course_time    ON ai_usage(course_id, created_at)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_ai_usage_created_at     ON ai_usage(created_at)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_rag_answer_cache_key    ON rag_answer_cache(course_id, kb_version, embedding_model)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_discussions_ai_status  ON discussions(ai_status, ai_next_run_at)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_exam_answers_coaching   ON exam_answers(coaching_status, coaching_next_run_at)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_exam_answers_ai_grade   ON exam_answers(ai_grade_status, ai_grade_next_run_at)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_exam_answers_judge      ON exam_answers(judge_status, judge_next_run_at)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_assignment_sub_judge    ON assignment_submissions(judge_status, judge_next_run_at)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_question_bank_course    ON question_bank(course_id, type, difficulty)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_question_bank_tags_tag  ON question_bank_tags(tag)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_question_bank_usage_q   ON question_bank_usage(bank_question_id)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_exam_questions_bank     ON exam_questions(exam_id, bank_question_id, rule_id)`)
+	DB.Exec(`CREATE INDEX IF NOT EXISTS idx_exam_question_rules_exam ON exam_question_rules(exam_id)`)
 
 	return nil
 }
@@ -385,6 +881,55 @@ func rebuildCourseSectionsTableIfNeeded() error {
 	return tx.Commit()
 }
 
+// ExamQuestionTypes 考试和题库支持的题型，也是 exam_questions.type 约束允许的取值；
+// 新增题型时在此追加，并同步 schema.sql 中的 CHECK 约束
+var ExamQuestionTypes = []string{"SINGLE_CHOICE", "MULTIPLE_CHOICE", "TRUE_FALSE", "SHORT_ANSWER", "FILL_BLANK", "NUMERIC", "CODE"}
+
+var examQuestionTypeCheck = regexp.MustCompile(`CHECK\s*\(\s*type\s+IN\s*\([^)]*\)\s*\)`)
+
+// rebuildExamQuestionsTableIfNeeded 旧库 exam_questions.type 的 CHECK 约束只允许建表时的题型，
+// 约束与 ExamQuestionTypes 不一致时按原表结构重建，保留所有列与数据
+func rebuildExamQuestionsTableIfNeeded() error {
+	var createSQL string
+	if err := DB.QueryRow(`SELECT COALESCE(sql, '') FROM sqlite_master WHERE type = 'table' AND name = 'exam_questions'`).Scan(&createSQL); err != nil {
+		return fmt.Errorf("read exam_questions schema failed: %v", err)
+	}
+	current := examQuestionTypeCheck.FindString(createSQL)
+	quoted := make([]string, len(ExamQuestionTypes))
+	for i, questionType := range ExamQuestionTypes {
+		quoted[i] = "'" + questionType + "'"
+	}
+	wanted := "CHECK(type IN (" + strings.Join(quoted, ", ") + "))"
+	if current == "" || current == wanted {
+		return nil
+	}
+	newSQL := strings.Replace(strings.Replace(createSQL, current, wanted, 1), "exam_questions", "exam_questions_new", 1)
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	if _, err := tx.Exec(newSQL); err != nil {
+		return fmt.Errorf("create exam_questions_new failed: %v", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO exam_questions_new SELECT * FROM exam_questions`); err != nil {
+		return fmt.Errorf("migrate exam_questions data failed: %v", err)
+	}
+	if _, err := tx.Exec(`DROP TABLE exam_questions`); err != nil {
+		return fmt.Errorf("drop old exam_questions failed: %v", err)
+	}
+	if _, err := tx.Exec(`ALTER TABLE exam_questions_new RENAME TO exam_questions`); err != nil {
+		return fmt.Errorf("rename exam_questions_new failed: %v", err)
+	}
+	if _, err := tx.Exec(`CREATE INDEX IF NOT EXISTS idx_questions_exam_id ON exam_questions(exam_id)`); err != nil {
+		return fmt.Errorf("create exam_questions index failed: %v", err)
+	}
+
+	return tx.Commit()
+}
+
 // rebuildDiscussionsTableIfNeeded rebuilds older discussion tables that still
 // contain legacy author/course text columns.
 func rebuildDiscussionsTableIfNeeded() error {
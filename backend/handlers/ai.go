@@ -111,7 +111,12 @@ func ParseQuestionsWithAI(c *gin.Context) {
 		return
 	}
 
-	questions, llmErr := parseQuestionsWithLLM(c, text)
+	courseID, _ := courseIDFromExamID(examID)
+	usageScope := aiUsageScopeFromContext(c, courseID, aiFeatureQuestionParse)
+	if !enforceAIQuota(c, usageScope) {
+		return
+	}
+	questions, llmErr := parseQuestionsWithLLM(c, usageScope, text)
 	if llmErr == nil {
 		questions = normalizeParsedQuestions(questions, 0.8)
 		if len(questions) == 0 {
@@ -142,7 +147,7 @@ func ParseQuestionsWithAI(c *gin.Context) {
 	utils.Success(c, response)
 }
 
-func parseQuestionsWithLLM(c *gin.Context, text string) ([]ParsedQuestion, error) {
+func parseQuestionsWithLLM(c *gin.Context, scope aiUsageScope, text string) ([]ParsedQuestion, error) {
 	systemPrompt := `你是在线教育平台 CourseArk 的考试题目结构化助手。
 请把用户提供的题目文本解析为严格 JSON；如果用户给出的是自然语言出题要求，则直接生成结构化题目 JSON。
 只输出 JSON，不要输出 Markdown、解释或代码块。
@@ -160,7 +165,7 @@ JSON 格式必须为：
     }
   ]
 }
-题型只能是 SINGLE_CHOICE、MULTIPLE_CHOICE、TRUE_FALSE、SHORT_ANSWER。
+题型只能是 SINGLE_CHOICE、MULTIPLE_CHOICE、TRUE_FALSE、SHORT_ANSWER、FILL_BLANK、NUMERIC。
 要求：
 1. questions 至少 1 项。
 2. 选择题 options 为纯选项文本，不带 A. / B. 前缀。
@@ -168,10 +173,13 @@ JSON 格式必须为：
 4. MULTIPLE_CHOICE answer 为逗号分隔字母，如 A,C。
 5. TRUE_FALSE answer 为 true 或 false。
 6. SHORT_ANSWER answer 为参考答案文本。
-7. score 必须大于 0，confidence 范围为 0 到 1，issues 无问题时返回空数组。`
+7. FILL_BLANK 题干中每个空用 ____ 表示，answer 按空的顺序用 ; 分隔，同一空的多个可接受答案用 | 分隔，正则表达式以 re: 开头，如 栈|stack;后进先出。
+8. NUMERIC answer 为数值，可带误差和单位，如 9.8±0.1 m/s^2 或 100 +- 1% cm；需要写出解题过程的计算题按 SHORT_ANSWER 处理。
+9. 填空题和数值题 options 为空数组。
+10. score 必须大于 0，confidence 范围为 0 到 1，issues 无问题时返回空数组。`
 	userPrompt := "请解析或生成以下考试题目内容：\n\n" + text
 
-	raw, err := completeWithConfiguredLLM(c, systemPrompt, userPrompt)
+	raw, err := completeWithConfiguredLLM(c, scope, systemPrompt, userPrompt)
 	if err != nil {
 		return nil, err
 	}
@@ -273,6 +281,11 @@ type ConfirmParseRequest struct {
 	ExamID             int64            `json:"examId" binding:"required"`
 	OriginalQuestions  []ParsedQuestion `json:"originalQuestions" binding:"required"`
 	ConfirmedQuestions []ParsedQuestion `json:"confirmedQuestions" binding:"required"`
+	// Target 导入位置：exam（默认）、bank（只存入课程题库）、both（存入题库并加入考试），
+	// 存入题库时所有题目使用同一难度和标签
+	Target     string   `json:"target"`
+	Difficulty string   `json:"difficulty"`
+	Tags       []string `json:"tags"`
 }
 
 // ConfirmParsedQuestions 确认并批量导入解析题目，同时记录 AI 修改记录（PLAN-05）
@@ -308,6 +321,15 @@ func ConfirmParsedQuestions(c *gin.Context) {
 	if !ensureExamManageable(c, examID, "权限不足") {
 		return
 	}
+	target, ok := normalizeQuestionTarget(req.Target)
+	if !ok {
+		utils.BadRequest(c, "无效的导入位置")
+		return
+	}
+	if _, ok := normalizeQuestionDifficulty(req.Difficulty, false); !ok {
+		utils.BadRequest(c, "无效的难度")
+		return
+	}
 
 	// 验证考试是否存在
 	var examExists int
@@ -336,10 +358,14 @@ func ConfirmParsedQuestions(c *gin.Context) {
 			continue
 		}
 
-		_, err = database.DB.Exec(`
-			INSERT INTO exam_questions (exam_id, type, stem, options, answer, score, order_index)
-			VALUES (?, ?, ?, ?, ?, ?, ?)
-		`, req.ExamID, normalized.Type, normalized.Stem, string(optionsJSONBytes), normalized.Answer, normalized.Score, maxOrder+insertedCount+1)
+		if target == questionTargetExam {
+			_, err = database.DB.Exec(`
+				INSERT INTO exam_questions (exam_id, type, stem, options, answer, score, order_index)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, req.ExamID, normalized.Type, normalized.Stem, string(optionsJSONBytes), normalized.Answer, normalized.Score, maxOrder+insertedCount+1)
+		} else {
+			err = importParsedQuestionToBank(req.ExamID, userID.(int64), normalized, req, target, maxOrder+insertedCount+1)
+		}
 		if err != nil {
 			utils.GetLogger().Warn("批量导入题目失败", zap.String("stem", normalized.Stem), zap.Error(err))
 			continue
@@ -467,7 +493,9 @@ var (
 	reSectionSingle   = regexp.MustCompile(`(?i)单选题`)
 	reSectionMultiple = regexp.MustCompile(`(?i)多选题`)
 	reSectionTF       = regexp.MustCompile(`(?i)判断题`)
-	reSectionShort    = regexp.MustCompile(`(?i)简答题|问答题`)
+	reSectionShort    = regexp.MustCompile(`(?i)简答题|问答题|计算题`)
+	reSectionBlank    = regexp.MustCompile(`(?i)填空题`)
+	reSectionNumeric  = regexp.MustCompile(`(?i)数值题`)
 
 	// 题目编号行：以数字开头，后跟点/顿号/括号
 	reQuestionNum = regexp.MustCompile(`^\s*\d+[\.、．。\)）]\s*`)
@@ -493,6 +521,10 @@ func detectSectionType(line string) string {
 		return "TRUE_FALSE"
 	case reSectionShort.MatchString(line):
 		return "SHORT_ANSWER"
+	case reSectionBlank.MatchString(line):
+		return "FILL_BLANK"
+	case reSectionNumeric.MatchString(line):
+		return "NUMERIC"
 	}
 	return ""
 }
@@ -532,6 +564,12 @@ func normalizeAnswer(raw, qtype string) string {
 				return string(ch)
 			}
 		}
+	case "FILL_BLANK", "NUMERIC":
+		normalized, err := normalizeExamAnswerSpec(qtype, raw)
+		if err != nil {
+			return ""
+		}
+		return normalized
 	}
 	return raw
 }
@@ -593,7 +631,7 @@ func normalizeParsedQuestion(question ParsedQuestion, defaultConfidence float64)
 		if len(normalized.Options) < 2 {
 			return ParsedQuestion{}, false
 		}
-	case "TRUE_FALSE", "SHORT_ANSWER":
+	case "TRUE_FALSE", "SHORT_ANSWER", "FILL_BLANK", "NUMERIC":
 		normalized.Options = []string{}
 	}
 
@@ -642,8 +680,12 @@ func normalizeQuestionType(raw string) (string, bool) {
 		return "MULTIPLE_CHOICE", normalized != "MULTIPLE_CHOICE"
 	case "TRUE_FALSE", "TRUEFALSE", "TRUE FALSE", "判断", "判断题":
 		return "TRUE_FALSE", normalized != "TRUE_FALSE"
-	case "SHORT_ANSWER", "SHORTANSWER", "SHORT ANSWER", "简答", "简答题", "问答题":
+	case "SHORT_ANSWER", "SHORTANSWER", "SHORT ANSWER", "简答", "简答题", "问答题", "计算题":
 		return "SHORT_ANSWER", normalized != "SHORT_ANSWER"
+	case "FILL_BLANK", "FILLBLANK", "FILL BLANK", "填空", "填空题":
+		return "FILL_BLANK", normalized != "FILL_BLANK"
+	case "NUMERIC", "NUMBER", "数值", "数值题":
+		return "NUMERIC", normalized != "NUMERIC"
 	default:
 		return "", false
 	}
@@ -684,6 +726,9 @@ func isValidNormalizedAnswer(answer, qtype string, optionCount int) bool {
 		return answer == "true" || answer == "false"
 	case "SHORT_ANSWER":
 		return strings.TrimSpace(answer) != ""
+	case "FILL_BLANK", "NUMERIC":
+		_, err := normalizeExamAnswerSpec(qtype, answer)
+		return err == nil
 	default:
 		return false
 	}
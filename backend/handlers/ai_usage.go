@@ -0,0 +1,557 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+	ragpkg "github.com/online-education-platform/backend/rag"
+	"github.com/online-education-platform/backend/utils"
+	"go.uber.org/zap"
+)
+
+// 计量用的功能标识，对应 ai_usage.feature
+const (
+	aiFeatureRAGQuery      = "rag_query"
+	aiFeatureRAGIngest     = "rag_ingest"
+	aiFeatureRAGReembed    = "rag_reembed"
+	aiFeatureRAGEval       = "rag_eval"
+	aiFeatureRAGCanonical  = "rag_canonical"
+	aiFeatureQuestionParse = "question_parse"
+	aiFeatureOutlineParse  = "outline_parse"
+	// aiFeatureDiscussionAssist 讨论区 AI 助教草稿，计入发帖学生的用量
+	aiFeatureDiscussionAssist = "discussion_assist"
+	// aiFeatureExamCoaching 交卷后的错题讲解，计入答卷学生的用量
+	aiFeatureExamCoaching = "exam_coaching"
+	// aiFeatureExamGrading 主观题 AI 评分建议，计入课程教师的用量
+	aiFeatureExamGrading = "exam_grading"
+)
+
+// 配额作用范围：role 按角色限制每个用户的当日用量，course 限制整门课程学生的当日用量；
+// 教师与管理员的资料入库、评测等用量只受角色配额约束，不占用学生的课程额度
+const (
+	aiQuotaScopeRole   = "role"
+	aiQuotaScopeCourse = "course"
+)
+
+const aiTimeLayout = "2006-01-02 15:04:05"
+
+// aiUsageScope 一次用户请求的计量归属，同一请求内的多次模型调用共用 RequestID
+type aiUsageScope struct {
+	RequestID string
+	UserID    int64
+	Role      string
+	CourseID  int64
+	Feature   string
+}
+
+func newAIUsageScope(userID int64, role string, courseID int64, feature string) aiUsageScope {
+	return aiUsageScope{
+		RequestID: newAIRequestID(),
+		UserID:    userID,
+		Role:      role,
+		CourseID:  courseID,
+		Feature:   feature,
+	}
+}
+
+// aiUsageScopeFromContext 以当前登录用户构造计量归属
+func aiUsageScopeFromContext(c *gin.Context, courseID int64, feature string) aiUsageScope {
+	role, _ := c.Get("role")
+	roleName, _ := role.(string)
+	return newAIUsageScope(getCurrentUserID(c), roleName, courseID, feature)
+}
+
+// aiUsageScopeForUser 为后台任务构造计量归属，角色从 users 表读取
+func aiUsageScopeForUser(userID, courseID int64, feature string) aiUsageScope {
+	role := ""
+	if userID > 0 && database.DB != nil {
+		database.DB.QueryRow(`SELECT role FROM users WHERE id = ?`, userID).Scan(&role)
+	}
+	return newAIUsageScope(userID, role, courseID, feature)
+}
+
+func newAIRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// meter 返回带计量回调的模型配置，经由它构造的 Provider 每次调用都会写入 ai_usage
+func (s aiUsageScope) meter(cfg ragConfig) ragConfig {
+	cfg.OnUsage = func(usage ragpkg.Usage) {
+		recordAIUsage(s, usage)
+	}
+	return cfg
+}
+
+// recordAIUsage 写入一次模型调用的用量；写入失败只记日志，不影响业务请求
+func recordAIUsage(scope aiUsageScope, usage ragpkg.Usage) {
+	if database.DB == nil {
+		return
+	}
+	errMessage := ""
+	if usage.Err != nil {
+		errMessage = truncateRAGText(usage.Err.Error(), 500)
+	}
+	_, err := database.DB.Exec(
+		`INSERT INTO ai_usage
+		 (request_id, user_id, role, course_id, feature, provider, operation, model,
+		  prompt_tokens, completion_tokens, estimated, latency_ms, success, error, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		scope.RequestID, nullableID(scope.UserID), scope.Role, nullableID(scope.CourseID), scope.Feature,
+		usage.Provider, usage.Operation, usage.Model,
+		usage.PromptTokens, usage.CompletionTokens, boolToInt(usage.Estimated), usage.Latency.Milliseconds(),
+		boolToInt(usage.Err == nil), errMessage, time.Now().UTC().Format(aiTimeLayout),
+	)
+	if err != nil {
+		utils.GetLogger().Warn("record ai usage failed", zap.Error(err))
+	}
+}
+
+func nullableID(id int64) interface{} {
+	if id <= 0 {
+		return nil
+	}
+	return id
+}
+
+func boolToInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func truncateRAGText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit])
+}
+
+type aiQuota struct {
+	ID            int64  `json:"id"`
+	Scope         string `json:"scope"`
+	ScopeKey      string `json:"scope_key"`
+	DailyRequests int64  `json:"daily_requests"`
+	DailyTokens   int64  `json:"daily_tokens"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+// aiQuotaStatus 某项配额的当日使用情况，Remaining* 为 nil 表示该项不限
+type aiQuotaStatus struct {
+	Scope             string `json:"scope"`
+	ScopeKey          string `json:"scope_key"`
+	DailyRequests     int64  `json:"daily_requests"`
+	DailyTokens       int64  `json:"daily_tokens"`
+	UsedRequests      int64  `json:"used_requests"`
+	UsedTokens        int64  `json:"used_tokens"`
+	RemainingRequests *int64 `json:"remaining_requests"`
+	RemainingTokens   *int64 `json:"remaining_tokens"`
+	ResetAt           string `json:"reset_at"`
+}
+
+func (s aiQuotaStatus) exceeded() bool {
+	return (s.RemainingRequests != nil && *s.RemainingRequests <= 0) ||
+		(s.RemainingTokens != nil && *s.RemainingTokens <= 0)
+}
+
+// aiDayBounds 返回本地时区当天的起止时间（UTC 格式），与 ai_usage.created_at 比较
+func aiDayBounds(now time.Time) (string, string, time.Time) {
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	end := start.AddDate(0, 0, 1)
+	return start.UTC().Format(aiTimeLayout), end.UTC().Format(aiTimeLayout), end
+}
+
+// aiQuotaCheck 一项配额检查：按 column = columnID 统计 ai_usage，filter 为追加的固定条件
+type aiQuotaCheck struct {
+	scope    string
+	key      string
+	column   string
+	columnID int64
+	filter   string
+}
+
+// checkAIQuota 依次检查角色配额与课程配额，返回第一个已用尽的配额；
+// 课程配额只约束学生请求，也只统计学生的用量。
+// 未配置配额或计量表不可用时返回 nil，计量故障不阻断正常使用
+func checkAIQuota(scope aiUsageScope) *aiQuotaStatus {
+	if database.DB == nil {
+		return nil
+	}
+	checks := []aiQuotaCheck{{aiQuotaScopeRole, scope.Role, "user_id", scope.UserID, ""}}
+	if scope.Role == "STUDENT" {
+		checks = append(checks, aiQuotaCheck{aiQuotaScopeCourse, strconv.FormatInt(scope.CourseID, 10), "course_id", scope.CourseID, " AND role = 'STUDENT'"})
+	}
+	for _, check := range checks {
+		if check.key == "" || check.columnID <= 0 {
+			continue
+		}
+		status, err := loadAIQuotaStatus(check.scope, check.key, check.column, check.columnID, check.filter)
+		if err != nil {
+			if err != sql.ErrNoRows {
+				utils.GetLogger().Warn("check ai quota failed", zap.Error(err))
+			}
+			continue
+		}
+		if status.exceeded() {
+			return status
+		}
+	}
+	return nil
+}
+
+func loadAIQuotaStatus(scope, key, column string, id int64, filter string) (*aiQuotaStatus, error) {
+	status := &aiQuotaStatus{Scope: scope, ScopeKey: key}
+	err := database.DB.QueryRow(
+		`SELECT daily_requests, daily_tokens FROM ai_quotas WHERE scope = ? AND scope_key = ?`,
+		scope, key,
+	).Scan(&status.DailyRequests, &status.DailyTokens)
+	if err != nil {
+		return nil, err
+	}
+	if status.DailyRequests <= 0 && status.DailyTokens <= 0 {
+		return status, nil
+	}
+
+	start, end, reset := aiDayBounds(time.Now())
+	status.ResetAt = reset.Format(time.RFC3339)
+	// column 与 filter 只取自 checkAIQuota 中的固定 SQL 片段
+	err = database.DB.QueryRow(
+		fmt.Sprintf(`SELECT COUNT(DISTINCT request_id), COALESCE(SUM(prompt_tokens + completion_tokens), 0)
+		 FROM ai_usage WHERE %s = ?%s AND created_at >= ? AND created_at < ?`, column, filter),
+		id, start, end,
+	).Scan(&status.UsedRequests, &status.UsedTokens)
+	if err != nil {
+		return nil, err
+	}
+	if status.DailyRequests > 0 {
+		remaining := maxInt64(status.DailyRequests-status.UsedRequests, 0)
+		status.RemainingRequests = &remaining
+	}
+	if status.DailyTokens > 0 {
+		remaining := maxInt64(status.DailyTokens-status.UsedTokens, 0)
+		status.RemainingTokens = &remaining
+	}
+	return status, nil
+}
+
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// enforceAIQuota 配额用尽时返回 429 及剩余额度并返回 false
+func enforceAIQuota(c *gin.Context, scope aiUsageScope) bool {
+	status := checkAIQuota(scope)
+	if status == nil {
+		return true
+	}
+	if reset, err := time.Parse(time.RFC3339, status.ResetAt); err == nil {
+		c.Header("Retry-After", strconv.Itoa(int(time.Until(reset).Seconds())+1))
+	}
+	message := "今日 AI 使用次数已达上限，请明天再试"
+	if status.Scope == aiQuotaScopeCourse {
+		message = "本课程今日 AI 使用量已达上限，请明天再试"
+	}
+	utils.ErrorWithData(c, http.StatusTooManyRequests, message, status)
+	return false
+}
+
+// ListAIQuotas 管理员查看全部配额
+func ListAIQuotas(c *gin.Context) {
+	if role, _ := c.Get("role"); role != "ADMIN" {
+		utils.Forbidden(c, "仅管理员可以管理 AI 配额")
+		return
+	}
+	rows, err := database.DB.Query(
+		`SELECT id, scope, scope_key, daily_requests, daily_tokens, updated_at
+		 FROM ai_quotas ORDER BY scope, scope_key`,
+	)
+	if err != nil {
+		utils.InternalServerError(c, "查询 AI 配额失败")
+		return
+	}
+	defer rows.Close()
+
+	quotas := make([]aiQuota, 0)
+	for rows.Next() {
+		var quota aiQuota
+		if err := rows.Scan(&quota.ID, &quota.Scope, &quota.ScopeKey, &quota.DailyRequests, &quota.DailyTokens, &quota.UpdatedAt); err != nil {
+			continue
+		}
+		quotas = append(quotas, quota)
+	}
+	utils.Success(c, quotas)
+}
+
+// SaveAIQuota 管理员新增或修改配额，scope 为 role 时 scope_key 为角色名，为 course 时为课程 ID
+func SaveAIQuota(c *gin.Context) {
+	if role, _ := c.Get("role"); role != "ADMIN" {
+		utils.Forbidden(c, "仅管理员可以管理 AI 配额")
+		return
+	}
+	var req struct {
+		Scope         string `json:"scope" binding:"required"`
+		ScopeKey      string `json:"scope_key" binding:"required"`
+		DailyRequests int64  `json:"daily_requests"`
+		DailyTokens   int64  `json:"daily_tokens"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请提供 scope 与 scope_key")
+		return
+	}
+	req.ScopeKey = strings.TrimSpace(req.ScopeKey)
+	switch req.Scope {
+	case aiQuotaScopeRole:
+		req.ScopeKey = strings.ToUpper(req.ScopeKey)
+		if req.ScopeKey != "STUDENT" && req.ScopeKey != "INSTRUCTOR" && req.ScopeKey != "ADMIN" {
+			utils.BadRequest(c, "角色仅支持 STUDENT、INSTRUCTOR 或 ADMIN")
+			return
+		}
+	case aiQuotaScopeCourse:
+		if id, err := strconv.ParseInt(req.ScopeKey, 10, 64); err != nil || id <= 0 {
+			utils.BadRequest(c, "无效的课程 ID")
+			return
+		}
+	default:
+		utils.BadRequest(c, "scope 仅支持 role 或 course")
+		return
+	}
+	if req.DailyRequests < 0 || req.DailyTokens < 0 {
+		utils.BadRequest(c, "配额不能为负数，0 表示不限")
+		return
+	}
+
+	now := time.Now().UTC().Format(aiTimeLayout)
+	_, err := database.DB.Exec(
+		`INSERT INTO ai_quotas (scope, scope_key, daily_requests, daily_tokens, updated_by, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(scope, scope_key) DO UPDATE SET
+		   daily_requests = excluded.daily_requests,
+		   daily_tokens = excluded.daily_tokens,
+		   updated_by = excluded.updated_by,
+		   updated_at = excluded.updated_at`,
+		req.Scope, req.ScopeKey, req.DailyRequests, req.DailyTokens, getCurrentUserID(c), now,
+	)
+	if err != nil {
+		utils.GetLogger().Error("save ai quota failed", zap.Error(err))
+		utils.InternalServerError(c, "保存 AI 配额失败")
+		return
+	}
+	utils.Success(c, aiQuota{
+		Scope:         req.Scope,
+		ScopeKey:      req.ScopeKey,
+		DailyRequests: req.DailyRequests,
+		DailyTokens:   req.DailyTokens,
+		UpdatedAt:     now,
+	})
+}
+
+// DeleteAIQuota 管理员删除配额，删除后该范围不再限制
+func DeleteAIQuota(c *gin.Context) {
+	if role, _ := c.Get("role"); role != "ADMIN" {
+		utils.Forbidden(c, "仅管理员可以管理 AI 配额")
+		return
+	}
+	quotaID, err := strconv.ParseInt(c.Param("quotaId"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "无效的配额 ID")
+		return
+	}
+	if _, err := database.DB.Exec(`DELETE FROM ai_quotas WHERE id = ?`, quotaID); err != nil {
+		utils.InternalServerError(c, "删除 AI 配额失败")
+		return
+	}
+	utils.Success(c, gin.H{"id": quotaID})
+}
+
+// aiModelPrice 每百万 token 的价格，币种由部署方自定
+type aiModelPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// aiModelPrices 读取 AI_MODEL_PRICES，例如 {"qwen-plus":{"prompt":0.8,"completion":2}}
+func aiModelPrices() map[string]aiModelPrice {
+	prices := map[string]aiModelPrice{}
+	raw := strings.TrimSpace(os.Getenv("AI_MODEL_PRICES"))
+	if raw == "" {
+		return prices
+	}
+	if err := json.Unmarshal([]byte(raw), &prices); err != nil {
+		utils.GetLogger().Warn("parse AI_MODEL_PRICES failed", zap.Error(err))
+	}
+	return prices
+}
+
+type aiUsageStats struct {
+	Requests         int64   `json:"requests"`
+	Calls            int64   `json:"calls"`
+	Failed           int64   `json:"failed"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+	Cost             float64 `json:"cost"`
+	latencyTotal     int64
+}
+
+func (s *aiUsageStats) add(calls, failed, prompt, completion, latency int64, price aiModelPrice) {
+	s.Calls += calls
+	s.Failed += failed
+	s.PromptTokens += prompt
+	s.CompletionTokens += completion
+	s.TotalTokens += prompt + completion
+	s.latencyTotal += latency
+	if s.Calls > 0 {
+		s.AvgLatencyMs = float64(s.latencyTotal) / float64(s.Calls)
+	}
+	s.Cost += (float64(prompt)*price.Prompt + float64(completion)*price.Completion) / 1e6
+}
+
+type aiUsageGroup struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+	aiUsageStats
+}
+
+// aiUsageGroupColumns group_by 对应的分组键与显示名表达式
+var aiUsageGroupColumns = map[string][2]string{
+	"user":    {"CAST(COALESCE(a.user_id, 0) AS TEXT)", "COALESCE(MAX(u.username), '')"},
+	"course":  {"CAST(COALESCE(a.course_id, 0) AS TEXT)", "COALESCE(MAX(co.title), '')"},
+	"model":   {"COALESCE(a.model, '')", "COALESCE(a.model, '')"},
+	"feature": {"a.feature", "a.feature"},
+	"day":     {"date(a.created_at, 'localtime')", "date(a.created_at, 'localtime')"},
+}
+
+// GetAIUsageReport 管理员查看 AI 用量与费用汇总。
+// 参数：from/to（YYYY-MM-DD，含当天，默认最近 7 天）、group_by（user/course/model/feature/day）、course_id、user_id
+func GetAIUsageReport(c *gin.Context) {
+	if role, _ := c.Get("role"); role != "ADMIN" {
+		utils.Forbidden(c, "仅管理员可以查看 AI 用量")
+		return
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	from, to := today.AddDate(0, 0, -6), today
+	var err error
+	if raw := c.Query("from"); raw != "" {
+		if from, err = time.ParseInLocation("2006-01-02", raw, now.Location()); err != nil {
+			utils.BadRequest(c, "from 格式应为 YYYY-MM-DD")
+			return
+		}
+	}
+	if raw := c.Query("to"); raw != "" {
+		if to, err = time.ParseInLocation("2006-01-02", raw, now.Location()); err != nil {
+			utils.BadRequest(c, "to 格式应为 YYYY-MM-DD")
+			return
+		}
+	}
+	if to.Before(from) {
+		utils.BadRequest(c, "to 不能早于 from")
+		return
+	}
+	groupBy := c.DefaultQuery("group_by", "user")
+	columns, ok := aiUsageGroupColumns[groupBy]
+	if !ok {
+		utils.BadRequest(c, "group_by 仅支持 user、course、model、feature 或 day")
+		return
+	}
+
+	where := "a.created_at >= ? AND a.created_at < ?"
+	args := []interface{}{from.UTC().Format(aiTimeLayout), to.AddDate(0, 0, 1).UTC().Format(aiTimeLayout)}
+	for _, filter := range []string{"course_id", "user_id"} {
+		raw := c.Query(filter)
+		if raw == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			utils.BadRequest(c, "无效的 "+filter)
+			return
+		}
+		where += " AND a." + filter + " = ?"
+		args = append(args, id)
+	}
+	baseQuery := `FROM ai_usage a
+		LEFT JOIN users u ON u.id = a.user_id
+		LEFT JOIN courses co ON co.id = a.course_id
+		WHERE ` + where
+
+	// 按 (分组, 模型) 聚合 token 与调用数，再在内存中按模型单价折算费用
+	rows, err := database.DB.Query(
+		`SELECT `+columns[0]+`, `+columns[1]+`, COALESCE(a.model, ''), COUNT(*),
+		        SUM(CASE WHEN a.success = 0 THEN 1 ELSE 0 END),
+		        SUM(a.prompt_tokens), SUM(a.completion_tokens), SUM(a.latency_ms)
+		 `+baseQuery+` GROUP BY 1, 3`,
+		args...,
+	)
+	if err != nil {
+		utils.GetLogger().Error("query ai usage failed", zap.Error(err))
+		utils.InternalServerError(c, "查询 AI 用量失败")
+		return
+	}
+	defer rows.Close()
+
+	prices := aiModelPrices()
+	var totals aiUsageStats
+	groups := make([]*aiUsageGroup, 0)
+	byKey := make(map[string]*aiUsageGroup)
+	for rows.Next() {
+		var key, label, model string
+		var calls, failed, prompt, completion, latency int64
+		if err := rows.Scan(&key, &label, &model, &calls, &failed, &prompt, &completion, &latency); err != nil {
+			continue
+		}
+		group, ok := byKey[key]
+		if !ok {
+			group = &aiUsageGroup{Key: key, Label: label}
+			byKey[key] = group
+			groups = append(groups, group)
+		}
+		group.add(calls, failed, prompt, completion, latency, prices[model])
+		totals.add(calls, failed, prompt, completion, latency, prices[model])
+	}
+
+	// 一次用户请求可能调用多个模型，请求数按 request_id 去重单独统计
+	requestRows, err := database.DB.Query(
+		`SELECT `+columns[0]+`, COUNT(DISTINCT a.request_id) `+baseQuery+` GROUP BY 1`,
+		args...,
+	)
+	if err == nil {
+		defer requestRows.Close()
+		for requestRows.Next() {
+			var key string
+			var requests int64
+			if requestRows.Scan(&key, &requests) == nil && byKey[key] != nil {
+				byKey[key].Requests = requests
+			}
+		}
+	}
+	database.DB.QueryRow(`SELECT COUNT(DISTINCT a.request_id) `+baseQuery, args...).Scan(&totals.Requests) //nolint:errcheck
+
+	utils.Success(c, gin.H{
+		"from":     from.Format("2006-01-02"),
+		"to":       to.Format("2006-01-02"),
+		"group_by": groupBy,
+		"totals":   totals,
+		"groups":   groups,
+	})
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+)
+
+func withAIUsageTestDB(t *testing.T) {
+	t.Helper()
+	withTestDB(t)
+	seedTestDB(t,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'x', 'ADMIN'), (2, 'alice', 'x', 'STUDENT')`,
+		`INSERT INTO courses (id, title, description, instructor_id) VALUES (1, '数据结构', '', 1)`,
+	)
+}
+
+func TestCompleteWithConfiguredLLMMetersUsageAndStopsAtQuota(t *testing.T) {
+	withAIUsageTestDB(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": `{"ok":true}`}}},
+			"usage":   map[string]any{"prompt_tokens": 120, "completion_tokens": 30},
+		})
+	}))
+	defer server.Close()
+	t.Setenv("RAG_PROVIDER", "openai")
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+	t.Setenv("LLM_MODEL", "test-model")
+
+	if _, err := database.DB.Exec(`INSERT INTO ai_quotas (scope, scope_key, daily_requests) VALUES ('role', 'STUDENT', 1)`); err != nil {
+		t.Fatalf("insert quota: %v", err)
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	scope := newAIUsageScope(2, "STUDENT", 1, aiFeatureQuestionParse)
+	if _, err := completeWithConfiguredLLM(c, scope, "system", "user"); err != nil {
+		t.Fatalf("first completion should succeed: %v", err)
+	}
+
+	var model string
+	var prompt, completion, estimated int
+	if err := database.DB.QueryRow(
+		`SELECT model, prompt_tokens, completion_tokens, estimated FROM ai_usage WHERE user_id = 2 AND course_id = 1`,
+	).Scan(&model, &prompt, &completion, &estimated); err != nil {
+		t.Fatalf("expected usage row: %v", err)
+	}
+	if model != "test-model" || prompt != 120 || completion != 30 || estimated != 0 {
+		t.Fatalf("unexpected usage row: %s %d %d %d", model, prompt, completion, estimated)
+	}
+
+	next := newAIUsageScope(2, "STUDENT", 1, aiFeatureQuestionParse)
+	if _, err := completeWithConfiguredLLM(c, next, "system", "user"); llmFallbackReason(err) != llmFallbackReasonQuotaExceeded {
+		t.Fatalf("expected quota_exceeded fallback, got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	if enforceAIQuota(c, next) {
+		t.Fatal("expected quota to be enforced")
+	}
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d", w.Code)
+	}
+	data := decodeResponseData(t, w.Body.Bytes())
+	if data["scope"] != aiQuotaScopeRole || data["remaining_requests"] != float64(0) {
+		t.Fatalf("unexpected quota status: %#v", data)
+	}
+
+	// 教师不受学生角色配额限制
+	if !enforceAIQuota(c, newAIUsageScope(1, "INSTRUCTOR", 1, aiFeatureRAGQuery)) {
+		t.Fatal("instructor should not be limited by the student quota")
+	}
+}
+
+func TestCourseQuotaIgnoresInstructorIngestAndEval(t *testing.T) {
+	withAIUsageTestDB(t)
+	now := time.Now().UTC().Format(aiTimeLayout)
+	statements := []string{
+		`INSERT INTO ai_quotas (scope, scope_key, daily_requests, daily_tokens) VALUES ('course', '1', 3, 1000)`,
+		`INSERT INTO ai_usage (request_id, user_id, role, course_id, feature, provider, operation, prompt_tokens, created_at) VALUES
+			('ingest', 1, 'INSTRUCTOR', 1, 'rag_ingest', 'openai', 'embed', 50000, '` + now + `'),
+			('eval', NULL, '', 1, 'rag_eval', 'openai', 'chat', 20000, '` + now + `'),
+			('ask', 2, 'STUDENT', 1, 'rag_query', 'openai', 'chat', 300, '` + now + `')`,
+	}
+	for _, stmt := range statements {
+		if _, err := database.DB.Exec(stmt); err != nil {
+			t.Fatalf("seed usage: %v", err)
+		}
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	if !enforceAIQuota(c, newAIUsageScope(2, "STUDENT", 1, aiFeatureRAGQuery)) {
+		t.Fatal("instructor ingest and eval usage must not use up the student course quota")
+	}
+
+	if _, err := database.DB.Exec(`INSERT INTO ai_usage (request_id, user_id, role, course_id, feature, provider, operation, prompt_tokens, created_at)
+		VALUES ('ask2', 2, 'STUDENT', 1, 'rag_query', 'openai', 'chat', 800, ?)`, now); err != nil {
+		t.Fatalf("seed usage: %v", err)
+	}
+	w := httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	if enforceAIQuota(c, newAIUsageScope(2, "STUDENT", 1, aiFeatureRAGQuery)) {
+		t.Fatal("student usage over the course token quota must be limited")
+	}
+	if data := decodeResponseData(t, w.Body.Bytes()); data["scope"] != aiQuotaScopeCourse {
+		t.Fatalf("expected the course quota to be reported, got %#v", data)
+	}
+
+	// 课程额度用尽后教师仍可入库与评测
+	if !enforceAIQuota(c, newAIUsageScope(1, "INSTRUCTOR", 1, aiFeatureRAGEval)) {
+		t.Fatal("instructors must not be limited by the student course quota")
+	}
+}
+
+func TestMeteredHandlersEnforceRoleQuota(t *testing.T) {
+	withAIUsageTestDB(t)
+	t.Setenv("RAG_PROVIDER", "openai")
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	now := time.Now().UTC().Format(aiTimeLayout)
+	seedTestDB(t,
+		`INSERT INTO ai_quotas (scope, scope_key, daily_requests) VALUES ('role', 'ADMIN', 1)`,
+		`INSERT INTO ai_usage (request_id, user_id, role, course_id, feature, provider, operation, prompt_tokens, created_at)
+			VALUES ('ask', 1, 'ADMIN', 1, 'rag_query', 'openai', 'chat', 100, '`+now+`')`,
+	)
+
+	params := gin.Params{{Key: "id", Value: "1"}}
+	handlers := map[string]gin.HandlerFunc{"eval": StartRAGEvalRun, "reembed": StartRAGReembedJob}
+	for name, handler := range handlers {
+		if w := performRAGRequest(handler, "ADMIN", 1, params, "/", `{}`); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("%s must be rejected once the role quota is used up, got %d %s", name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestGetAIUsageReportGroupsAndPrices(t *testing.T) {
+	withAIUsageTestDB(t)
+	t.Setenv("AI_MODEL_PRICES", `{"qwen-plus":{"prompt":2,"completion":8},"text-embedding-v4":{"prompt":1}}`)
+
+	now := time.Now().UTC().Format(aiTimeLayout)
+	rows := []struct {
+		requestID, operation, model string
+		prompt, completion, success int
+	}{
+		{"r1", "embedding", "text-embedding-v4", 1000000, 0, 1},
+		{"r1", "chat", "qwen-plus", 500000, 250000, 1},
+		{"r2", "chat", "qwen-plus", 500000, 0, 0},
+	}
+	for _, row := range rows {
+		if _, err := database.DB.Exec(
+			`INSERT INTO ai_usage (request_id, user_id, role, course_id, feature, provider, operation, model, prompt_tokens, completion_tokens, latency_ms, success, created_at)
+			 VALUES (?, 2, 'STUDENT', 1, 'rag_query', 'dashscope', ?, ?, ?, ?, 100, ?, ?)`,
+			row.requestID, row.operation, row.model, row.prompt, row.completion, row.success, now,
+		); err != nil {
+			t.Fatalf("insert usage: %v", err)
+		}
+	}
+
+	if w := performRAGRequest(GetAIUsageReport, "STUDENT", 2, nil, "/ai/usage", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for student, got %d", w.Code)
+	}
+
+	w := performRAGRequest(GetAIUsageReport, "ADMIN", 1, nil, "/ai/usage?group_by=user", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	data := decodeResponseData(t, w.Body.Bytes())
+	totals := data["totals"].(map[string]any)
+	if totals["requests"] != float64(2) || totals["calls"] != float64(3) || totals["failed"] != float64(1) {
+		t.Fatalf("unexpected totals: %#v", totals)
+	}
+	// 1M×1 + 0.5M×2 + 0.25M×8 + 0.5M×2 = 5
+	if totals["cost"] != float64(5) || totals["total_tokens"] != float64(2250000) {
+		t.Fatalf("unexpected cost or tokens: %#v", totals)
+	}
+	groups := data["groups"].([]any)
+	if len(groups) != 1 {
+		t.Fatalf("expected one user group, got %#v", groups)
+	}
+	group := groups[0].(map[string]any)
+	if group["key"] != "2" || group["label"] != "alice" || group["requests"] != float64(2) {
+		t.Fatalf("unexpected user group: %#v", group)
+	}
+
+	if w := performRAGRequest(GetAIUsageReport, "ADMIN", 1, nil, "/ai/usage?group_by=team", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown group_by, got %d", w.Code)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -134,6 +135,9 @@ func GetCourseLearningHeatmap(c *gin.Context) {
 	})
 }
 
+// examWarningJobs 跟踪交卷后异步运行的难题检查，测试结束前需等待它们完成
+var examWarningJobs sync.WaitGroup
+
 // checkExamAndWarnTeacher 在 SubmitExam 完成后异步检查难题并推送预警消息（PLAN-03）
 func checkExamAndWarnTeacher(examID int64) {
 	// 查询该考试的教师 ID 和考试标题
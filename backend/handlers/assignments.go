@@ -3,7 +3,9 @@ package handlers
 import (
     "database/sql"
     "encoding/json"
+    "fmt"
     "strconv"
+    "strings"
     "time"
 
     "github.com/gin-gonic/gin"
@@ -19,12 +21,16 @@ type CreateAssignmentRequest struct {
 	Content  *string `json:"content"`
 	Deadline *string `json:"deadline"` // ISO 8601格式
     Attachments *[]string `json:"attachments"`
+	// JudgeConfig 自动评测配置（JSON 字符串，格式同编程题的答案），为空表示不评测
+	JudgeConfig *string `json:"judgeConfig"`
 }
 
 // SubmitAssignmentRequest 提交作业请求
 type SubmitAssignmentRequest struct {
 	Content     *string `json:"content"`
 	Attachments *string `json:"attachments"` // JSON字符串
+	// Language 开启自动评测的作业提交程序时的编程语言，Content 为源代码
+	Language *string `json:"language"`
 }
 
 // GradeAssignmentRequest 批改作业请求
@@ -164,10 +170,16 @@ func CreateAssignment(c *gin.Context) {
         }
     }
 
+	judgeConfig, err := normalizeCodeJudgeConfig(req.JudgeConfig)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
     result, err := database.DB.Exec(`
-        INSERT INTO assignments (course_id, title, content, deadline, attachments)
-        VALUES (?, ?, ?, ?, ?)
-    `, req.CourseID, req.Title, req.Content, deadline, attachmentsJSON)
+        INSERT INTO assignments (course_id, title, content, deadline, attachments, judge_config)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `, req.CourseID, req.Title, req.Content, deadline, attachmentsJSON, judgeConfig)
 
 	if err != nil {
 		utils.InternalServerError(c, "创建作业失败")
@@ -190,12 +202,12 @@ func GetAssignment(c *gin.Context) {
 	var assignment models.Assignment
 	var deadline sql.NullTime
     err := database.DB.QueryRow(`
-        SELECT id, course_id, title, content, deadline, created_at, attachments
+        SELECT id, course_id, title, content, deadline, created_at, attachments, judge_config
         FROM assignments
         WHERE id = ?
     `, assignmentID).Scan(
         &assignment.ID, &assignment.CourseID, &assignment.Title,
-        &assignment.Content, &deadline, &assignment.CreatedAt, &assignment.Attachments,
+        &assignment.Content, &deadline, &assignment.CreatedAt, &assignment.Attachments, &assignment.JudgeConfig,
     )
 
 	if err == sql.ErrNoRows {
@@ -234,6 +246,16 @@ func GetAssignment(c *gin.Context) {
 		}
 	}
 
+	// 自动评测的作业向学生展示语言、限制和样例，隐藏测试用例只返回给教师
+	if assignment.JudgeConfig != nil {
+		if spec, err := parseCodeQuestionSpec(*assignment.JudgeConfig); err == nil {
+			assignment.Code = spec.publicInfo()
+		}
+		if role == "STUDENT" {
+			assignment.JudgeConfig = nil
+		}
+	}
+
 	utils.Success(c, assignment)
 }
 
@@ -265,7 +287,8 @@ func SubmitAssignment(c *gin.Context) {
 	// 检查作业是否存在及截止日期
 	var courseID int64
 	var deadline sql.NullTime
-	err := database.DB.QueryRow("SELECT course_id, deadline FROM assignments WHERE id = ?", assignmentID).Scan(&courseID, &deadline)
+	var judgeConfig sql.NullString
+	err := database.DB.QueryRow("SELECT course_id, deadline, judge_config FROM assignments WHERE id = ?", assignmentID).Scan(&courseID, &deadline, &judgeConfig)
 	if err == sql.ErrNoRows {
 		utils.NotFound(c, "作业不存在")
 		return
@@ -293,6 +316,30 @@ func SubmitAssignment(c *gin.Context) {
 		return
 	}
 
+	// 开启自动评测的作业，指定了语言的提交把内容作为源代码排队评测，评测结果供教师批改参考
+	var language, judgeStatus interface{}
+	if req.Language != nil && strings.TrimSpace(*req.Language) != "" {
+		if !judgeConfig.Valid || judgeConfig.String == "" {
+			utils.BadRequest(c, "该作业未开启自动评测")
+			return
+		}
+		spec, err := parseCodeQuestionSpec(judgeConfig.String)
+		if err != nil {
+			utils.InternalServerError(c, "作业的评测配置无效")
+			return
+		}
+		name := strings.ToLower(strings.TrimSpace(*req.Language))
+		if !spec.allowsLanguage(name) {
+			utils.BadRequest(c, "该作业不支持此编程语言")
+			return
+		}
+		if contentEmpty || len(*req.Content) > maxCodeSourceBytes {
+			utils.BadRequest(c, fmt.Sprintf("源代码不能为空且不能超过 %d KB", maxCodeSourceBytes>>10))
+			return
+		}
+		language, judgeStatus = name, codeJudgePending
+	}
+
 	// 检查是否已提交
 	var submissionID int64
 	err = database.DB.QueryRow(`
@@ -311,21 +358,25 @@ func SubmitAssignment(c *gin.Context) {
 		// 已存在,更新
 		_, err = database.DB.Exec(`
 			UPDATE assignment_submissions 
-			SET content = ?, attachments = ?, submitted_at = CURRENT_TIMESTAMP
+			SET content = ?, attachments = ?, submitted_at = CURRENT_TIMESTAMP,
+			    language = ?, judge_status = ?, judge_result = NULL, judge_error = NULL, judge_attempts = 0, judge_next_run_at = NULL
 			WHERE id = ?
-		`, req.Content, req.Attachments, submissionID)
+		`, req.Content, req.Attachments, language, judgeStatus, submissionID)
 	} else {
 		// 不存在,插入
 		_, err = database.DB.Exec(`
-			INSERT INTO assignment_submissions (assignment_id, student_id, content, attachments)
-			VALUES (?, ?, ?, ?)
-		`, assignmentID, userID, req.Content, req.Attachments)
+			INSERT INTO assignment_submissions (assignment_id, student_id, content, attachments, language, judge_status)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, assignmentID, userID, req.Content, req.Attachments, language, judgeStatus)
 	}
 
 	if err != nil {
 		utils.InternalServerError(c, "提交失败")
 		return
 	}
+	if judgeStatus != nil {
+		wakeCodeJudgeWorker()
+	}
 
 	utils.SuccessWithMessage(c, "提交成功", nil)
 }
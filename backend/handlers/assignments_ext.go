@@ -195,16 +195,21 @@ func GetSubmissionDetail(c *gin.Context) {
 		SubmittedAt  sql.NullTime
 		Grade        sql.NullFloat64
 		Feedback     sql.NullString
+		Language     sql.NullString
+		JudgeStatus  sql.NullString
+		JudgeResult  sql.NullString
 	}
 
 	err := database.DB.QueryRow(`
-		SELECT id, assignment_id, student_id, content, attachments, submitted_at, grade, feedback
+		SELECT id, assignment_id, student_id, content, attachments, submitted_at, grade, feedback,
+		       language, judge_status, judge_result
 		FROM assignment_submissions
 		WHERE id = ?
 	`, submissionID).Scan(
 		&submission.ID, &submission.AssignmentID, &submission.StudentID,
 		&submission.Content, &submission.Attachments, &submission.SubmittedAt,
 		&submission.Grade, &submission.Feedback,
+		&submission.Language, &submission.JudgeStatus, &submission.JudgeResult,
 	)
 
 	if err == sql.ErrNoRows {
@@ -244,12 +249,13 @@ func GetSubmissionDetail(c *gin.Context) {
 	// 获取作业信息
 	var assignmentTitle string
 	var courseTitle string
+	var judgeConfig sql.NullString
 	database.DB.QueryRow(`
-		SELECT a.title, c.title
+		SELECT a.title, c.title, a.judge_config
 		FROM assignments a
 		JOIN courses c ON a.course_id = c.id
 		WHERE a.id = ?
-	`, submission.AssignmentID).Scan(&assignmentTitle, &courseTitle)
+	`, submission.AssignmentID).Scan(&assignmentTitle, &courseTitle, &judgeConfig)
 
 	result := gin.H{
 		"id":              submission.ID,
@@ -276,6 +282,23 @@ func GetSubmissionDetail(c *gin.Context) {
 	if submission.Feedback.Valid {
 		result["feedback"] = submission.Feedback.String
 	}
+	// 自动评测结果：学生只能看到样例用例的报错
+	if submission.Language.Valid {
+		result["language"] = submission.Language.String
+	}
+	if submission.JudgeStatus.Valid {
+		result["judgeStatus"] = submission.JudgeStatus.String
+	}
+	if judgeResult := decodeCodeJudgeResult(submission.JudgeResult); judgeResult != nil {
+		if role == "STUDENT" {
+			var spec *codeQuestionSpec
+			if judgeConfig.Valid {
+				spec, _ = parseCodeQuestionSpec(judgeConfig.String)
+			}
+			judgeResult = publicCodeJudgeResult(judgeResult, spec)
+		}
+		result["judgeResult"] = judgeResult
+	}
 
 	utils.Success(c, result)
 }
@@ -338,11 +361,18 @@ func UpdateAssignment(c *gin.Context) {
         attachmentsJSON = nil
     }
 
+	// 修改评测配置不会自动重评已有提交，需要时调用 /judge/requeue
+	judgeConfig, err := normalizeCodeJudgeConfig(req.JudgeConfig)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
     _, err = database.DB.Exec(`
         UPDATE assignments 
-        SET title = ?, content = ?, deadline = ?, attachments = ?
+        SET title = ?, content = ?, deadline = ?, attachments = ?, judge_config = ?
         WHERE id = ?
-    `, req.Title, req.Content, deadline, attachmentsJSON, assignmentID)
+    `, req.Title, req.Content, deadline, attachmentsJSON, judgeConfig, assignmentID)
 
 	if err != nil {
 		utils.InternalServerError(c, "更新失败")
@@ -0,0 +1,570 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+	"github.com/online-education-platform/backend/judge"
+	"github.com/online-education-platform/backend/models"
+	"github.com/online-education-platform/backend/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	codeJudgePending    = "pending"
+	codeJudgeProcessing = "processing"
+	codeJudgeDone       = "done"
+	codeJudgeFailed     = "failed"
+
+	// 评测队列所在的表：考试中的编程题作答和开启了自动评测的作业提交
+	codeJudgeExamAnswers = "exam_answers"
+	codeJudgeAssignments = "assignment_submissions"
+
+	codeJudgeMaxAttempts  = 3
+	codeJudgePollInterval = 5 * time.Second
+	codeJudgeTimeout      = 5 * time.Minute
+
+	defaultCodeTimeLimitMs   = 1000
+	maxCodeTimeLimitMs       = 10000
+	defaultCodeMemoryLimitMB = 256
+	minCodeMemoryLimitMB     = 16
+	maxCodeMemoryLimitMB     = 1024
+	maxCodeTestCases         = 50
+	maxCodeSourceBytes       = 64 << 10
+)
+
+var (
+	codeJudgeWake = make(chan struct{}, 1)
+	codeJudgeOnce sync.Once
+)
+
+// codeTestCase 测试用例，Sample 为 true 的作为样例展示给学生，其余为隐藏用例
+type codeTestCase struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	Sample bool   `json:"sample,omitempty"`
+}
+
+// codeQuestionSpec 编程题的评测配置，存于题目的 answer 字段（作业存于 judge_config）。
+// Languages 为空表示允许评测机支持的所有语言
+type codeQuestionSpec struct {
+	Languages     []string       `json:"languages,omitempty"`
+	TimeLimitMs   int            `json:"timeLimitMs"`
+	MemoryLimitMB int            `json:"memoryLimitMb"`
+	TestCases     []codeTestCase `json:"testCases"`
+}
+
+// codeSubmission 编程题的作答，以 JSON 保存：{"language":"python","source":"..."}
+type codeSubmission struct {
+	Language string `json:"language"`
+	Source   string `json:"source"`
+}
+
+type codeJudgeJob struct {
+	Table         string
+	ID            int64
+	Spec          string
+	Submission    codeSubmission
+	Score         float64
+	ScoringPolicy string
+	Attempts      int
+}
+
+// codeJudgeEnabled CODE_JUDGE=off 时不启动评测 worker（如部署环境没有编译器），提交保持排队，开启后补评
+func codeJudgeEnabled() bool {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("CODE_JUDGE"))) != "off"
+}
+
+// codeJudgeOptions CODE_JUDGE_ISOLATION 为 required（默认，无法搭建沙箱时拒绝评测）、auto 或 off，
+// CODE_JUDGE_WORKDIR 为评测临时目录，CODE_JUDGE_MOUNTS 为额外只读挂载进沙箱的工具链目录（逗号分隔）
+func codeJudgeOptions() judge.Options {
+	opts := judge.Options{
+		Isolation: strings.ToLower(strings.TrimSpace(os.Getenv("CODE_JUDGE_ISOLATION"))),
+		WorkDir:   strings.TrimSpace(os.Getenv("CODE_JUDGE_WORKDIR")),
+	}
+	for _, path := range strings.Split(os.Getenv("CODE_JUDGE_MOUNTS"), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			opts.ReadOnlyPaths = append(opts.ReadOnlyPaths, path)
+		}
+	}
+	return opts
+}
+
+// parseCodeQuestionSpec 校验评测配置并补上默认的时间和内存限制
+func parseCodeQuestionSpec(raw string) (*codeQuestionSpec, error) {
+	spec := &codeQuestionSpec{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(normalizeStoredExamAnswer(raw))), spec); err != nil {
+		return nil, errors.New("编程题的评测配置格式错误")
+	}
+
+	languages := []string{}
+	seen := map[string]bool{}
+	for _, name := range spec.Languages {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if !judge.Supported(name) {
+			return nil, fmt.Errorf("不支持的编程语言：%s", name)
+		}
+		seen[name] = true
+		languages = append(languages, name)
+	}
+	spec.Languages = languages
+
+	if spec.TimeLimitMs == 0 {
+		spec.TimeLimitMs = defaultCodeTimeLimitMs
+	}
+	if spec.TimeLimitMs < 0 || spec.TimeLimitMs > maxCodeTimeLimitMs {
+		return nil, fmt.Errorf("时间限制须在 1 到 %d 毫秒之间", maxCodeTimeLimitMs)
+	}
+	if spec.MemoryLimitMB == 0 {
+		spec.MemoryLimitMB = defaultCodeMemoryLimitMB
+	}
+	if spec.MemoryLimitMB < minCodeMemoryLimitMB || spec.MemoryLimitMB > maxCodeMemoryLimitMB {
+		return nil, fmt.Errorf("内存限制须在 %d 到 %d MB 之间", minCodeMemoryLimitMB, maxCodeMemoryLimitMB)
+	}
+
+	if len(spec.TestCases) == 0 {
+		return nil, errors.New("编程题至少需要一个测试用例")
+	}
+	if len(spec.TestCases) > maxCodeTestCases {
+		return nil, fmt.Errorf("测试用例不能超过 %d 个", maxCodeTestCases)
+	}
+	for i, tc := range spec.TestCases {
+		if strings.TrimSpace(tc.Output) == "" {
+			return nil, fmt.Errorf("第 %d 个测试用例缺少期望输出", i+1)
+		}
+	}
+	return spec, nil
+}
+
+// allowsLanguage 判断提交的语言是否可用于本题
+func (s *codeQuestionSpec) allowsLanguage(name string) bool {
+	if !judge.Supported(name) {
+		return false
+	}
+	if len(s.Languages) == 0 {
+		return true
+	}
+	for _, allowed := range s.Languages {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// publicInfo 对学生公开的部分：语言、资源限制和样例
+func (s *codeQuestionSpec) publicInfo() *models.CodeQuestionInfo {
+	info := &models.CodeQuestionInfo{
+		Languages:     s.Languages,
+		TimeLimitMs:   s.TimeLimitMs,
+		MemoryLimitMB: s.MemoryLimitMB,
+		Samples:       []models.CodeSample{},
+		TestCount:     len(s.TestCases),
+	}
+	if len(info.Languages) == 0 {
+		info.Languages = judge.Languages()
+	}
+	for _, tc := range s.TestCases {
+		if tc.Sample {
+			info.Samples = append(info.Samples, models.CodeSample{Input: tc.Input, Output: tc.Output})
+		}
+	}
+	return info
+}
+
+func (s *codeQuestionSpec) judgeCases() []judge.TestCase {
+	cases := make([]judge.TestCase, 0, len(s.TestCases))
+	for _, tc := range s.TestCases {
+		cases = append(cases, judge.TestCase{Input: tc.Input, Output: tc.Output})
+	}
+	return cases
+}
+
+// normalizeCodeJudgeConfig 校验作业的自动评测配置，为空时表示不评测
+func normalizeCodeJudgeConfig(raw *string) (*string, error) {
+	if raw == nil || strings.TrimSpace(*raw) == "" {
+		return nil, nil
+	}
+	spec, err := parseCodeQuestionSpec(*raw)
+	if err != nil {
+		return nil, err
+	}
+	encoded, _ := json.Marshal(spec)
+	config := string(encoded)
+	return &config, nil
+}
+
+func parseCodeSubmission(raw string) codeSubmission {
+	var submission codeSubmission
+	if err := json.Unmarshal([]byte(strings.TrimSpace(normalizeStoredExamAnswer(raw))), &submission); err != nil {
+		return codeSubmission{}
+	}
+	submission.Language = strings.ToLower(strings.TrimSpace(submission.Language))
+	return submission
+}
+
+// needsCodeJudging 只评测提交了源代码的编程题作答
+func needsCodeJudging(questionType, studentAnswer string) bool {
+	return questionType == "CODE" && strings.TrimSpace(parseCodeSubmission(studentAnswer).Source) != ""
+}
+
+// codeJudgeScore 全部用例通过得满分；按比例得分时按通过的用例数给分
+func codeJudgeScore(score float64, policy string, result *judge.Result) float64 {
+	if result == nil || result.Total == 0 {
+		return 0
+	}
+	if result.Verdict == judge.Accepted {
+		return score
+	}
+	if policy == examScoringProportional {
+		return math.Round(score*float64(result.Passed)/float64(result.Total)*100) / 100
+	}
+	return 0
+}
+
+func decodeCodeJudgeResult(raw sql.NullString) *judge.Result {
+	if !raw.Valid || raw.String == "" {
+		return nil
+	}
+	var result judge.Result
+	if err := json.Unmarshal([]byte(raw.String), &result); err != nil {
+		return nil
+	}
+	return &result
+}
+
+// publicCodeJudgeResult 学生只能看到样例用例的错误信息，隐藏用例的报错可能带出测试输入
+func publicCodeJudgeResult(result *judge.Result, spec *codeQuestionSpec) *judge.Result {
+	if result == nil {
+		return nil
+	}
+	public := *result
+	public.Cases = make([]judge.CaseResult, len(result.Cases))
+	for i, caseResult := range result.Cases {
+		if spec == nil || i >= len(spec.TestCases) || !spec.TestCases[i].Sample {
+			caseResult.Message = ""
+		}
+		public.Cases[i] = caseResult
+	}
+	return &public
+}
+
+// rejectedCodeSubmission 无法编译运行的提交（语言不可用、源代码过长）按编译错误记录
+func rejectedCodeSubmission(total int, reason string) *judge.Result {
+	result := &judge.Result{Verdict: judge.CompileError, Total: total, CompileOutput: reason, Cases: make([]judge.CaseResult, 0, total)}
+	for i := 0; i < total; i++ {
+		result.Cases = append(result.Cases, judge.CaseResult{Verdict: judge.CompileError})
+	}
+	return result
+}
+
+// wakeCodeJudgeWorker 有新的提交或教师重新评测后唤醒 worker
+func wakeCodeJudgeWorker() {
+	select {
+	case codeJudgeWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartCodeJudgeWorker 启动编程题评测 worker（只启动一次）；启动时把中断在评测中的提交放回队列。
+// 评测逐个进行，避免多个程序争抢 CPU 影响计时
+func StartCodeJudgeWorker() {
+	if !codeJudgeEnabled() {
+		utils.GetLogger().Info("code judge disabled (CODE_JUDGE=off)")
+		return
+	}
+	codeJudgeOnce.Do(func() {
+		for _, table := range []string{codeJudgeExamAnswers, codeJudgeAssignments} {
+			if _, err := database.DB.Exec(
+				`UPDATE `+table+` SET judge_status = ? WHERE judge_status = ?`,
+				codeJudgePending, codeJudgeProcessing,
+			); err != nil {
+				utils.GetLogger().Warn("failed to recover code judge jobs", zap.String("table", table), zap.Error(err))
+			}
+		}
+		go func() {
+			ticker := time.NewTicker(codeJudgePollInterval)
+			defer ticker.Stop()
+			for {
+				for runNextCodeJudgeJob() {
+				}
+				select {
+				case <-ticker.C:
+				case <-codeJudgeWake:
+				}
+			}
+		}()
+	})
+}
+
+// runNextCodeJudgeJob 认领并评测一份到期的提交，考试作答优先；没有可处理的提交时返回 false
+func runNextCodeJudgeJob() bool {
+	now := time.Now()
+	job, err := claimExamCodeJudgeJob(now)
+	if err == sql.ErrNoRows {
+		job, err = claimAssignmentCodeJudgeJob(now)
+	}
+	if err != nil {
+		if err != sql.ErrNoRows {
+			utils.GetLogger().Warn("failed to claim code judge job", zap.Error(err))
+		}
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), codeJudgeTimeout)
+	defer cancel()
+	result, err := processCodeJudgeJob(ctx, job)
+	if err != nil {
+		failCodeJudgeJob(job, err, time.Now())
+		return true
+	}
+	saveCodeJudgeResult(job, result)
+	return true
+}
+
+func claimExamCodeJudgeJob(now time.Time) (*codeJudgeJob, error) {
+	job := &codeJudgeJob{Table: codeJudgeExamAnswers}
+	var studentAnswer string
+	err := database.DB.QueryRow(
+		`SELECT a.id, COALESCE(q.answer, ''), q.score, q.scoring_policy, COALESCE(a.student_answer, ''), a.judge_attempts
+         FROM exam_answers a
+         JOIN exam_questions q ON q.id = a.question_id
+         WHERE a.judge_status = ? AND (a.judge_next_run_at IS NULL OR a.judge_next_run_at <= ?)
+         ORDER BY a.judge_next_run_at ASC, a.id ASC
+         LIMIT 1`,
+		codeJudgePending, now,
+	).Scan(&job.ID, &job.Spec, &job.Score, &job.ScoringPolicy, &studentAnswer, &job.Attempts)
+	if err != nil {
+		return nil, err
+	}
+	job.Submission = parseCodeSubmission(studentAnswer)
+	return job, markCodeJudgeProcessing(job)
+}
+
+func claimAssignmentCodeJudgeJob(now time.Time) (*codeJudgeJob, error) {
+	job := &codeJudgeJob{Table: codeJudgeAssignments}
+	err := database.DB.QueryRow(
+		`SELECT s.id, COALESCE(a.judge_config, ''), COALESCE(s.language, ''), COALESCE(s.content, ''), s.judge_attempts
+         FROM assignment_submissions s
+         JOIN assignments a ON a.id = s.assignment_id
+         WHERE s.judge_status = ? AND (s.judge_next_run_at IS NULL OR s.judge_next_run_at <= ?)
+         ORDER BY s.judge_next_run_at ASC, s.id ASC
+         LIMIT 1`,
+		codeJudgePending, now,
+	).Scan(&job.ID, &job.Spec, &job.Submission.Language, &job.Submission.Source, &job.Attempts)
+	if err != nil {
+		return nil, err
+	}
+	return job, markCodeJudgeProcessing(job)
+}
+
+// markCodeJudgeProcessing 条件更新防止同一提交被重复认领
+func markCodeJudgeProcessing(job *codeJudgeJob) error {
+	res, err := database.DB.Exec(
+		`UPDATE `+job.Table+` SET judge_status = ?, judge_attempts = judge_attempts + 1 WHERE id = ? AND judge_status = ?`,
+		codeJudgeProcessing, job.ID, codeJudgePending,
+	)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	job.Attempts++
+	return nil
+}
+
+// processCodeJudgeJob 编译运行提交的程序。返回 error 表示评测环境的问题，稍后重试
+func processCodeJudgeJob(ctx context.Context, job *codeJudgeJob) (*judge.Result, error) {
+	spec, err := parseCodeQuestionSpec(job.Spec)
+	if err != nil {
+		return nil, &permanentJobError{err: err}
+	}
+	if !spec.allowsLanguage(job.Submission.Language) {
+		return rejectedCodeSubmission(len(spec.TestCases), "不支持的编程语言："+job.Submission.Language), nil
+	}
+	if len(job.Submission.Source) > maxCodeSourceBytes {
+		return rejectedCodeSubmission(len(spec.TestCases), fmt.Sprintf("源代码不能超过 %d KB", maxCodeSourceBytes>>10)), nil
+	}
+
+	result, err := judge.Run(ctx,
+		judge.Submission{Language: job.Submission.Language, Source: job.Submission.Source},
+		spec.judgeCases(),
+		judge.Limits{Time: time.Duration(spec.TimeLimitMs) * time.Millisecond, MemoryMB: spec.MemoryLimitMB},
+		codeJudgeOptions(),
+	)
+	// 保存的结果中 isolated=false 标明这次没有沙箱隔离，教师页面会提示
+	if err == nil && !result.Isolated {
+		utils.GetLogger().Warn("code judge ran without sandbox isolation", zap.String("table", job.Table), zap.Int64("id", job.ID))
+	}
+	return result, err
+}
+
+// saveCodeJudgeResult 保存评测结果。考试作答同时写入得分并重算总分；作业只记录结果，仍由教师批改。
+// 评测期间学生重新提交或教师重新评测时状态已不是 processing，丢弃这次结果
+func saveCodeJudgeResult(job *codeJudgeJob, result *judge.Result) {
+	logger := utils.GetLogger()
+	raw, _ := json.Marshal(result)
+	if job.Table == codeJudgeAssignments {
+		if _, err := database.DB.Exec(
+			`UPDATE assignment_submissions SET judge_status = ?, judge_result = ?, judge_error = NULL WHERE id = ? AND judge_status = ?`,
+			codeJudgeDone, string(raw), job.ID, codeJudgeProcessing,
+		); err != nil {
+			logger.Error("save code judge result failed", zap.String("table", job.Table), zap.Int64("id", job.ID), zap.Error(err))
+		}
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		logger.Error("save code judge result failed", zap.Int64("answerID", job.ID), zap.Error(err))
+		return
+	}
+	res, err := tx.Exec(
+		`UPDATE exam_answers SET judge_status = ?, judge_result = ?, judge_error = NULL, score_awarded = ? WHERE id = ? AND judge_status = ?`,
+		codeJudgeDone, string(raw), codeJudgeScore(job.Score, job.ScoringPolicy, result), job.ID, codeJudgeProcessing,
+	)
+	if err == nil {
+		if affected, _ := res.RowsAffected(); affected > 0 {
+			_, err = tx.Exec(`
+				UPDATE exam_submissions
+				SET total_score = (SELECT MAX(COALESCE(SUM(score_awarded), 0), 0) FROM exam_answers WHERE submission_id = exam_submissions.id)
+				WHERE id = (SELECT submission_id FROM exam_answers WHERE id = ?)
+			`, job.ID)
+		}
+	}
+	if err != nil {
+		tx.Rollback()
+		logger.Error("save code judge result failed", zap.Int64("answerID", job.ID), zap.Error(err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		logger.Error("save code judge result failed", zap.Int64("answerID", job.ID), zap.Error(err))
+	}
+}
+
+// failCodeJudgeJob 评测环境出错时按指数退避重新排队，超过次数或配置错误时标记失败
+func failCodeJudgeJob(job *codeJudgeJob, jobErr error, now time.Time) {
+	logger := utils.GetLogger()
+	retryAt, retry := jobRetryAt(jobErr, job.Attempts, codeJudgeMaxAttempts, now)
+	if !retry {
+		logger.Error("code judge job failed", zap.String("table", job.Table), zap.Int64("id", job.ID), zap.Int("attempts", job.Attempts), zap.Error(jobErr))
+		database.DB.Exec( //nolint:errcheck
+			`UPDATE `+job.Table+` SET judge_status = ?, judge_error = ? WHERE id = ? AND judge_status = ?`,
+			codeJudgeFailed, jobErr.Error(), job.ID, codeJudgeProcessing,
+		)
+		return
+	}
+
+	logger.Warn("code judge job will retry", zap.String("table", job.Table), zap.Int64("id", job.ID), zap.Int("attempts", job.Attempts), zap.Time("retryAt", retryAt), zap.Error(jobErr))
+	database.DB.Exec( //nolint:errcheck
+		`UPDATE `+job.Table+` SET judge_status = ?, judge_error = ?, judge_next_run_at = ? WHERE id = ? AND judge_status = ?`,
+		codeJudgePending, jobErr.Error(), retryAt, job.ID, codeJudgeProcessing,
+	)
+}
+
+// RequeueExamJudging 重新评测考试中的编程题作答，用于修改测试用例之后；可用 questionId 只重评一道题
+func RequeueExamJudging(c *gin.Context) {
+	examID, ok := parseInt64Param(c, c.Param("id"), "考试ID")
+	if !ok || !ensureExamGrader(c, examID) {
+		return
+	}
+
+	query := `
+		UPDATE exam_answers
+		SET judge_status = ?, judge_result = NULL, judge_error = NULL, judge_attempts = 0, judge_next_run_at = NULL
+		WHERE judge_status IN (?, ?)
+		  AND id IN (
+			SELECT a.id FROM exam_answers a
+			JOIN exam_submissions s ON s.id = a.submission_id
+			JOIN exam_questions q ON q.id = a.question_id
+			WHERE s.exam_id = ? AND q.type = 'CODE'`
+	args := []interface{}{codeJudgePending, codeJudgeDone, codeJudgeFailed, examID}
+	if raw := c.Query("questionId"); raw != "" {
+		questionID, ok := parseInt64Param(c, raw, "题目ID")
+		if !ok {
+			return
+		}
+		query += " AND q.id = ?"
+		args = append(args, questionID)
+	}
+	query += ")"
+
+	res, err := database.DB.Exec(query, args...)
+	if err != nil {
+		utils.InternalServerError(c, "重新评测失败")
+		return
+	}
+	queued, _ := res.RowsAffected()
+	if queued > 0 {
+		wakeCodeJudgeWorker()
+	}
+
+	utils.Success(c, gin.H{"queued": queued})
+}
+
+// RequeueAssignmentJudging 重新评测作业的所有提交，用于修改评测配置之后
+func RequeueAssignmentJudging(c *gin.Context) {
+	assignmentID, ok := parseInt64Param(c, c.Param("id"), "作业ID")
+	if !ok {
+		return
+	}
+	role := currentUserRole(c)
+	if role != "INSTRUCTOR" && role != "ADMIN" {
+		utils.Forbidden(c, "权限不足")
+		return
+	}
+	var instructorID int64
+	var judgeConfig sql.NullString
+	err := database.DB.QueryRow(`
+		SELECT c.instructor_id, a.judge_config
+		FROM assignments a
+		JOIN courses c ON a.course_id = c.id
+		WHERE a.id = ?
+	`, assignmentID).Scan(&instructorID, &judgeConfig)
+	if err == sql.ErrNoRows {
+		utils.NotFound(c, "作业不存在")
+		return
+	}
+	if err != nil {
+		utils.InternalServerError(c, "服务器错误")
+		return
+	}
+	if role != "ADMIN" && instructorID != getCurrentUserID(c) {
+		utils.Forbidden(c, "权限不足")
+		return
+	}
+	if !judgeConfig.Valid || judgeConfig.String == "" {
+		utils.BadRequest(c, "该作业未开启自动评测")
+		return
+	}
+
+	res, err := database.DB.Exec(`
+		UPDATE assignment_submissions
+		SET judge_status = ?, judge_result = NULL, judge_error = NULL, judge_attempts = 0, judge_next_run_at = NULL
+		WHERE assignment_id = ? AND judge_status IN (?, ?)
+	`, codeJudgePending, assignmentID, codeJudgeDone, codeJudgeFailed)
+	if err != nil {
+		utils.InternalServerError(c, "重新评测失败")
+		return
+	}
+	queued, _ := res.RowsAffected()
+	if queued > 0 {
+		wakeCodeJudgeWorker()
+	}
+
+	utils.Success(c, gin.H{"queued": queued})
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+	"github.com/online-education-platform/backend/judge"
+)
+
+const testCodeSpec = `{"languages":["python"],"timeLimitMs":2000,"memoryLimitMb":128,"testCases":[` +
+	`{"input":"1 2\n","output":"3\n","sample":true},{"input":"5 7\n","output":"12\n"}]}`
+
+func requirePython(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 not installed")
+	}
+	// 这里测试评分流程，没有沙箱的环境也照常评测
+	t.Setenv("CODE_JUDGE_ISOLATION", judge.IsolationAuto)
+}
+
+func codeAnswer(t *testing.T, language, source string) string {
+	t.Helper()
+	raw, err := json.Marshal(codeSubmission{Language: language, Source: source})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(raw)
+}
+
+func TestParseCodeQuestionSpec(t *testing.T) {
+	spec, err := parseCodeQuestionSpec(`{"languages":[" Python ","python"],"testCases":[{"input":"1","output":"1","sample":true},{"output":"2"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spec.Languages) != 1 || spec.TimeLimitMs != defaultCodeTimeLimitMs || spec.MemoryLimitMB != defaultCodeMemoryLimitMB {
+		t.Fatalf("expected defaults and deduplicated languages, got %+v", spec)
+	}
+	if info := spec.publicInfo(); len(info.Samples) != 1 || info.TestCount != 2 {
+		t.Fatalf("only samples must be public, got %+v", info)
+	}
+	if spec.allowsLanguage("c") || !spec.allowsLanguage("python") {
+		t.Fatal("only the listed languages must be allowed")
+	}
+
+	invalid := []string{
+		`not json`,
+		`{"testCases":[]}`,
+		`{"languages":["cobol"],"testCases":[{"output":"1"}]}`,
+		`{"timeLimitMs":60000,"testCases":[{"output":"1"}]}`,
+		`{"memoryLimitMb":4,"testCases":[{"output":"1"}]}`,
+		`{"testCases":[{"input":"1","output":" "}]}`,
+	}
+	for _, raw := range invalid {
+		if _, err := parseCodeQuestionSpec(raw); err == nil {
+			t.Errorf("expected %s to be rejected", raw)
+		}
+	}
+}
+
+func TestSubmitExamJudgesCodeQuestions(t *testing.T) {
+	requirePython(t)
+	withQuestionBankTestDB(t)
+	params := gin.Params{{Key: "id", Value: "1"}}
+
+	penalty := fmt.Sprintf(`{"type":"CODE","stem":"输出两数之和","answer":%q,"score":10,"wrongPenalty":2}`, testCodeSpec)
+	if w := performRAGRequest(AddQuestion, "INSTRUCTOR", 9, params, "/", penalty); w.Code != http.StatusBadRequest {
+		t.Fatalf("code questions must not take a wrong answer penalty, got %d", w.Code)
+	}
+	body := fmt.Sprintf(`{"type":"CODE","stem":"输出两数之和","answer":%q,"score":10,"orderIndex":5,"scoringPolicy":"proportional"}`, testCodeSpec)
+	w := performRAGRequest(AddQuestion, "INSTRUCTOR", 9, params, "/", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("add question failed: %d %s", w.Code, w.Body.String())
+	}
+	questionID := int64(decodeResponseData(t, w.Body.Bytes())["id"].(float64))
+
+	_, shown := studentExamQuestions(t, 6)
+	for _, raw := range shown {
+		question := raw.(map[string]any)
+		if question["type"] != "CODE" {
+			continue
+		}
+		code, _ := question["code"].(map[string]any)
+		if question["answer"] != nil || code == nil || len(code["samples"].([]any)) != 1 || code["testCount"] != float64(2) {
+			t.Fatalf("students must see the samples but not the hidden cases, got %v", question)
+		}
+	}
+
+	// 只对第一个用例给出正确结果，隐藏用例在 stderr 中报错
+	source := "import sys\na, b = map(int, input().split())\nif a != 1:\n    sys.exit('secret input %d %d' % (a, b))\nprint(a + b)\n"
+	answers, _ := json.Marshal(map[string]any{"answers": []map[string]any{{"questionId": questionID, "answer": codeAnswer(t, "python", source)}}})
+	w = performRAGRequest(SubmitExam, "STUDENT", 6, params, "/", string(answers))
+	if w.Code != http.StatusOK {
+		t.Fatalf("submit exam failed: %d %s", w.Code, w.Body.String())
+	}
+	if total := decodeResponseData(t, w.Body.Bytes())["totalScore"]; total != float64(0) {
+		t.Fatalf("code answers score after judging, got %v", total)
+	}
+
+	if !runNextCodeJudgeJob() {
+		t.Fatal("expected a queued code answer")
+	}
+	if runNextCodeJudgeJob() {
+		t.Fatal("the queue must be empty after judging")
+	}
+
+	var status, result string
+	var score, total float64
+	if err := database.DB.QueryRow(`
+		SELECT a.judge_status, a.judge_result, a.score_awarded, s.total_score
+		FROM exam_answers a JOIN exam_submissions s ON s.id = a.submission_id
+		WHERE a.question_id = ?`, questionID).Scan(&status, &result, &score, &total); err != nil {
+		t.Fatal(err)
+	}
+	if status != codeJudgeDone || score != 5 || total != 5 {
+		t.Fatalf("expected half of the cases to pass, got %s %v %v %s", status, score, total, result)
+	}
+
+	w = performRAGRequest(GetMyExamSubmission, "STUDENT", 6, params, "/", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("get submission failed: %d %s", w.Code, w.Body.String())
+	}
+	for _, raw := range decodeResponseData(t, w.Body.Bytes())["answers"].([]any) {
+		answer := raw.(map[string]any)
+		if answer["type"] != "CODE" {
+			continue
+		}
+		judged := answer["judgeResult"].(map[string]any)
+		cases := judged["cases"].([]any)
+		if answer["correctAnswer"] != "" || judged["passed"] != float64(1) || cases[1].(map[string]any)["message"] != nil {
+			t.Fatalf("hidden test cases must not leak to students, got %v", answer)
+		}
+	}
+
+	if w := performRAGRequest(RequeueExamJudging, "INSTRUCTOR", 9, params, "/", "{}"); w.Code != http.StatusOK || decodeResponseData(t, w.Body.Bytes())["queued"] != float64(1) {
+		t.Fatalf("expected the answer to be queued again, got %d %s", w.Code, w.Body.String())
+	}
+	if w := performRAGRequest(ListExamGrading, "INSTRUCTOR", 9, params, "/", ""); w.Code != http.StatusOK {
+		t.Fatalf("list grading failed: %d", w.Code)
+	} else if items, _ := decodeResponseData(t, w.Body.Bytes())["items"].([]any); len(items) != 0 {
+		t.Fatalf("code answers must not be listed for AI grading, got %v", items)
+	}
+}
+
+func TestSubmitAssignmentReusesCodeJudge(t *testing.T) {
+	requirePython(t)
+	withExamGradingTestDB(t)
+	invalid := `{"courseId":1,"title":"两数之和","judgeConfig":"{\"testCases\":[]}"}`
+	if w := performRAGRequest(CreateAssignment, "INSTRUCTOR", 9, nil, "/", invalid); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid judge config must be rejected, got %d", w.Code)
+	}
+	body, _ := json.Marshal(map[string]any{"courseId": 1, "title": "两数之和", "judgeConfig": testCodeSpec})
+	w := performRAGRequest(CreateAssignment, "INSTRUCTOR", 9, nil, "/", string(body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("create assignment failed: %d %s", w.Code, w.Body.String())
+	}
+	params := gin.Params{{Key: "id", Value: fmt.Sprint(decodeResponseData(t, w.Body.Bytes())["id"])}}
+
+	w = performRAGRequest(GetAssignment, "STUDENT", 6, params, "/", "")
+	if data := decodeResponseData(t, w.Body.Bytes()); data["judgeConfig"] != nil || data["code"] == nil {
+		t.Fatalf("students must only see the public judge info, got %v", data)
+	}
+
+	if w := performRAGRequest(SubmitAssignment, "STUDENT", 6, params, "/", `{"content":"print(1)","language":"c"}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("languages outside the config must be rejected, got %d", w.Code)
+	}
+	submit, _ := json.Marshal(map[string]any{"content": "a, b = map(int, input().split())\nprint(a + b)\n", "language": "python"})
+	if w := performRAGRequest(SubmitAssignment, "STUDENT", 6, params, "/", string(submit)); w.Code != http.StatusOK {
+		t.Fatalf("submit assignment failed: %d %s", w.Code, w.Body.String())
+	}
+	if !runNextCodeJudgeJob() {
+		t.Fatal("expected a queued assignment submission")
+	}
+
+	w = performRAGRequest(GetSubmissionDetail, "STUDENT", 6, gin.Params{{Key: "id", Value: "1"}}, "/", "")
+	data := decodeResponseData(t, w.Body.Bytes())
+	judged, _ := data["judgeResult"].(map[string]any)
+	if data["judgeStatus"] != codeJudgeDone || judged["verdict"] != "AC" || data["grade"] != nil {
+		t.Fatalf("the judge result must be recorded without grading the assignment, got %v", data)
+	}
+}
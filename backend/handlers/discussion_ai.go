@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/online-education-platform/backend/database"
+	ragpkg "github.com/online-education-platform/backend/rag"
+	"github.com/online-education-platform/backend/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	discussionAIPending    = "pending"
+	discussionAIProcessing = "processing"
+	discussionAICompleted  = "completed"
+	// discussionAISkipped 知识库中没有足够依据或额度用尽，不生成草稿
+	discussionAISkipped = "skipped"
+	discussionAIFailed  = "failed"
+
+	discussionAIMaxAttempts  = 3
+	discussionAIPollInterval = 5 * time.Second
+	// discussionAITimeout 单个讨论（检索、重排与生成）的处理时限
+	discussionAITimeout = 2 * time.Minute
+)
+
+var (
+	// discussionAIWake 新讨论排队时唤醒后台 worker
+	discussionAIWake = make(chan struct{}, 1)
+	discussionAIOnce sync.Once
+)
+
+type discussionAIJob struct {
+	DiscussionID int64
+	CourseID     int64
+	AuthorID     int64
+	Title        string
+	Content      string
+	Attempts     int
+}
+
+// discussionAIResult 一次处理的结果，Status 为 completed 或 skipped
+type discussionAIResult struct {
+	Status     string
+	Draft      string
+	Confidence float64
+	Links      []ragKnowledgeLink
+	// Reason 为跳过原因，写入 ai_error 便于排查
+	Reason string
+}
+
+// discussionAIEnabled DISCUSSION_AI=off 时新讨论不再排队生成 AI 草稿
+func discussionAIEnabled() bool {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("DISCUSSION_AI"))) != "off"
+}
+
+// enqueueDiscussionAI 把讨论标记为待生成 AI 草稿并唤醒 worker；失败只记日志，不影响发帖
+func enqueueDiscussionAI(discussionID int64) {
+	if !discussionAIEnabled() {
+		return
+	}
+	if _, err := database.DB.Exec(
+		`UPDATE discussions SET ai_status = ?, ai_attempts = 0, ai_error = NULL, ai_next_run_at = ? WHERE id = ?`,
+		discussionAIPending, time.Now(), discussionID,
+	); err != nil {
+		utils.GetLogger().Warn("enqueue discussion ai failed", zap.Int64("discussionID", discussionID), zap.Error(err))
+		return
+	}
+	select {
+	case discussionAIWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartDiscussionAIWorker 启动讨论 AI 助教 worker（只启动一次）；
+// 启动时把上次进程中断在处理中的讨论放回队列
+func StartDiscussionAIWorker() {
+	discussionAIOnce.Do(func() {
+		if _, err := database.DB.Exec(
+			`UPDATE discussions SET ai_status = ? WHERE ai_status = ?`,
+			discussionAIPending, discussionAIProcessing,
+		); err != nil {
+			utils.GetLogger().Warn("failed to recover discussion ai jobs", zap.Error(err))
+		}
+		go func() {
+			ticker := time.NewTicker(discussionAIPollInterval)
+			defer ticker.Stop()
+			for {
+				for runNextDiscussionAIJob() {
+				}
+				select {
+				case <-ticker.C:
+				case <-discussionAIWake:
+				}
+			}
+		}()
+	})
+}
+
+// runNextDiscussionAIJob 认领并处理一个到期的讨论，没有可处理的讨论时返回 false
+func runNextDiscussionAIJob() bool {
+	job, err := claimDiscussionAIJob(time.Now())
+	if err != nil {
+		if err != sql.ErrNoRows {
+			utils.GetLogger().Warn("failed to claim discussion ai job", zap.Error(err))
+		}
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), discussionAITimeout)
+	defer cancel()
+	result, err := processDiscussionAIJob(ctx, job)
+	if err != nil {
+		failDiscussionAIJob(job, err, time.Now())
+		return true
+	}
+	saveDiscussionAIResult(job.DiscussionID, result)
+	return true
+}
+
+func claimDiscussionAIJob(now time.Time) (*discussionAIJob, error) {
+	job := &discussionAIJob{}
+	err := database.DB.QueryRow(
+		`SELECT id, COALESCE(course_id, 0), COALESCE(author_id, 0), title, COALESCE(content, ''), ai_attempts
+         FROM discussions
+         WHERE ai_status = ? AND (ai_next_run_at IS NULL OR ai_next_run_at <= ?)
+         ORDER BY ai_next_run_at ASC, id ASC
+         LIMIT 1`,
+		discussionAIPending, now,
+	).Scan(&job.DiscussionID, &job.CourseID, &job.AuthorID, &job.Title, &job.Content, &job.Attempts)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := database.DB.Exec(
+		`UPDATE discussions SET ai_status = ?, ai_attempts = ai_attempts + 1 WHERE id = ? AND ai_status = ?`,
+		discussionAIProcessing, job.DiscussionID, discussionAIPending,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return nil, sql.ErrNoRows
+	}
+	job.Attempts++
+	return job, nil
+}
+
+// processDiscussionAIJob 以讨论标题和正文为问题，走与课程问答相同的检索、重排和生成流程。
+// 资料不足或额度用尽时返回 skipped 结果；返回的错误按 failDiscussionAIJob 的规则重试
+func processDiscussionAIJob(ctx context.Context, job *discussionAIJob) (discussionAIResult, error) {
+	if job.CourseID == 0 {
+		return discussionAIResult{Status: discussionAISkipped, Reason: "讨论未关联课程"}, nil
+	}
+	cfg, err := resolveRAGConfig("", "")
+	if err != nil {
+		return discussionAIResult{}, &permanentJobError{err: err}
+	}
+	scope := aiUsageScopeForUser(job.AuthorID, job.CourseID, aiFeatureDiscussionAssist)
+	if status := checkAIQuota(scope); status != nil {
+		return discussionAIResult{Status: discussionAISkipped, Reason: "今日 AI 使用额度已用尽"}, nil
+	}
+	cfg = scope.meter(cfg)
+
+	question := strings.TrimSpace(job.Title + "\n" + job.Content)
+	plan := &ragQueryPlan{
+		CourseID:       job.CourseID,
+		UserID:         job.AuthorID,
+		Question:       question,
+		RewrittenQuery: question,
+		Mode:           ragpkg.RetrievalHybrid,
+		Config:         cfg,
+		Sources:        []ragSource{},
+	}
+	if err := plan.retrieve(ctx, ragRetrieveOptions{
+		Retrieval: ragpkg.RetrievalQuery{Mode: ragpkg.RetrievalHybrid, VectorWeight: 1, KeywordWeight: 1},
+		TopK:      ragTopK,
+		Reranker:  newRAGReranker(cfg),
+	}); err != nil {
+		return discussionAIResult{}, err
+	}
+	// 知识库为空或没有相关资料时不生成草稿，避免在讨论区给出无依据的回答
+	if plan.Answer != "" {
+		return discussionAIResult{Status: discussionAISkipped, Reason: plan.Answer}, nil
+	}
+
+	answer, err := ragpkg.GenerateAnswer(ctx, plan.provider(), question, plan.Contexts, nil)
+	if err != nil {
+		return discussionAIResult{}, fmt.Errorf("生成回答失败: %w", err)
+	}
+	if isRAGNoEvidenceAnswer(answer) {
+		return discussionAIResult{Status: discussionAISkipped, Reason: answer}, nil
+	}
+
+	return discussionAIResult{
+		Status:     discussionAICompleted,
+		Draft:      answer,
+		Confidence: discussionAIConfidence(plan.attribute(answer), plan.Sources),
+		Links:      ragKnowledgeLinks(plan.Sources),
+	}, nil
+}
+
+// discussionAIConfidence 置信度 = 有资料依据的句子占比 × 最相关资料的重排得分（未重排时按 1 计），保留两位小数
+func discussionAIConfidence(attribution ragpkg.Attribution, sources []ragSource) float64 {
+	relevance := 0.0
+	for _, source := range sources {
+		relevance = math.Max(relevance, source.RerankScore)
+	}
+	if relevance == 0 {
+		relevance = 1
+	}
+	return math.Round(ragpkg.Faithfulness(attribution)*relevance*100) / 100
+}
+
+func saveDiscussionAIResult(discussionID int64, result discussionAIResult) {
+	var draft, links, reason interface{}
+	if result.Status == discussionAICompleted {
+		draft = result.Draft
+		linksJSON, _ := json.Marshal(result.Links)
+		links = string(linksJSON)
+	}
+	if result.Reason != "" {
+		reason = result.Reason
+	}
+	if _, err := database.DB.Exec(
+		`UPDATE discussions
+         SET ai_status = ?, ai_draft = ?, ai_confidence = ?, ai_linked_knowledge = ?, ai_error = ?, ai_updated_at = ?
+         WHERE id = ?`,
+		result.Status, draft, result.Confidence, links, reason, time.Now(), discussionID,
+	); err != nil {
+		utils.GetLogger().Error("save discussion ai draft failed", zap.Int64("discussionID", discussionID), zap.Error(err))
+	}
+}
+
+// failDiscussionAIJob 可重试的错误按后台任务统一的指数退避重新排队，超过次数或永久错误时标记失败
+func failDiscussionAIJob(job *discussionAIJob, jobErr error, now time.Time) {
+	logger := utils.GetLogger()
+	retryAt, retry := jobRetryAt(jobErr, job.Attempts, discussionAIMaxAttempts, now)
+	if !retry {
+		logger.Error("discussion ai job failed", zap.Int64("discussionID", job.DiscussionID), zap.Int("attempts", job.Attempts), zap.Error(jobErr))
+		database.DB.Exec( //nolint:errcheck
+			`UPDATE discussions SET ai_status = ?, ai_error = ?, ai_updated_at = ? WHERE id = ?`,
+			discussionAIFailed, jobErr.Error(), now, job.DiscussionID,
+		)
+		return
+	}
+
+	logger.Warn("discussion ai job will retry", zap.Int64("discussionID", job.DiscussionID), zap.Int("attempts", job.Attempts), zap.Time("retryAt", retryAt), zap.Error(jobErr))
+	database.DB.Exec( //nolint:errcheck
+		`UPDATE discussions SET ai_status = ?, ai_error = ?, ai_next_run_at = ? WHERE id = ?`,
+		discussionAIPending, jobErr.Error(), retryAt, job.DiscussionID,
+	)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+)
+
+func withDiscussionAITestDB(t *testing.T) {
+	t.Helper()
+	withTestDB(t)
+	seedTestDB(t,
+		`INSERT INTO courses (id, title, description, instructor_id) VALUES (1, '数据结构', '', 9), (2, '操作系统', '', 9)`,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'admin', 'x', 'ADMIN')`,
+	)
+}
+
+func createTestDiscussion(t *testing.T, courseID int64, title, content string) int64 {
+	t.Helper()
+	body := fmt.Sprintf(`{"courseId":%d,"title":%q,"content":%q}`, courseID, title, content)
+	w := performRAGRequest(CreateDiscussion, "ADMIN", 1, nil, "/", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create discussion failed: %d %s", w.Code, w.Body.String())
+	}
+	data := decodeResponseData(t, w.Body.Bytes())
+	return int64(data["id"].(float64))
+}
+
+func TestDiscussionAIDraftFromCourseKnowledge(t *testing.T) {
+	withDiscussionAITestDB(t)
+	newRAGModelTestServer(t, "栈是一种后进先出的线性表，只允许在栈顶插入和删除[1]。")
+
+	enqueueTestDocument(t, "stack.md", "栈是一种后进先出的线性表，只允许在栈顶插入和删除。")
+	for runNextRAGIngestJob() {
+	}
+
+	// 正文很短也不能出错（旧实现截取 content[:10] 会越界）
+	discussionID := createTestDiscussion(t, 1, "栈", "栈？")
+	var status sql.NullString
+	database.DB.QueryRow(`SELECT ai_status FROM discussions WHERE id = ?`, discussionID).Scan(&status)
+	if status.String != discussionAIPending {
+		t.Fatalf("new discussion must be queued, got %q", status.String)
+	}
+	if !runNextDiscussionAIJob() {
+		t.Fatal("expected a queued discussion")
+	}
+	if runNextDiscussionAIJob() {
+		t.Fatal("discussion must only be processed once")
+	}
+
+	params := gin.Params{{Key: "id", Value: fmt.Sprint(discussionID)}}
+	w := performRAGRequest(GetDiscussionDetail, "ADMIN", 1, params, "/", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("get discussion failed: %d %s", w.Code, w.Body.String())
+	}
+	data := decodeResponseData(t, w.Body.Bytes())
+	if data["aiStatus"] != discussionAICompleted || data["aiDraft"] == nil {
+		t.Fatalf("expected completed ai draft, got %v", data)
+	}
+	if confidence, _ := data["confidenceScore"].(float64); confidence <= 0 || confidence > 1 {
+		t.Fatalf("confidence must be in (0, 1], got %v", data["confidenceScore"])
+	}
+	links, _ := data["linkedKnowledge"].([]any)
+	if len(links) == 0 || links[0].(map[string]any)["filename"] != "stack.md" {
+		t.Fatalf("expected linked knowledge from stack.md, got %v", data["linkedKnowledge"])
+	}
+}
+
+func TestDiscussionAISkipsCourseWithoutKnowledge(t *testing.T) {
+	withDiscussionAITestDB(t)
+	newRAGModelTestServer(t, "不应调用生成模型")
+
+	discussionID := createTestDiscussion(t, 2, "进程调度", "时间片轮转怎么实现？")
+	runNextDiscussionAIJob()
+
+	var status string
+	var draft, reason sql.NullString
+	database.DB.QueryRow(`SELECT ai_status, ai_draft, ai_error FROM discussions WHERE id = ?`, discussionID).Scan(&status, &draft, &reason)
+	if status != discussionAISkipped || draft.Valid || reason.String == "" {
+		t.Fatalf("expected skipped without draft, got status=%q draft=%v reason=%q", status, draft, reason.String)
+	}
+
+	w := performRAGRequest(GetDiscussionDetail, "ADMIN", 1, gin.Params{{Key: "id", Value: fmt.Sprint(discussionID)}}, "/", "")
+	if data := decodeResponseData(t, w.Body.Bytes()); data["aiDraft"] != nil {
+		t.Fatalf("skipped discussion must not expose a draft, got %v", data["aiDraft"])
+	}
+}
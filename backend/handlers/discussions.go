@@ -2,13 +2,13 @@ package handlers
 
 import (
 	"database/sql"
+	"encoding/json"
 	"math"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/online-education-platform/backend/database"
-	"github.com/online-education-platform/backend/middleware"
 	"github.com/online-education-platform/backend/utils"
 	"go.uber.org/zap"
 )
@@ -120,7 +120,8 @@ func CreateDiscussion(c *gin.Context) {
 	}
 
 	discussionID, _ := result.LastInsertId()
-	middleware.AnalyzeDiscussionAsync(req.Title, req.Content, discussionID)
+	// 由后台 worker 根据课程知识库生成回答草稿，详情接口返回 aiDraft 等字段
+	enqueueDiscussionAI(discussionID)
 
 	utils.Success(c, gin.H{
 		"id":      discussionID,
@@ -284,7 +285,8 @@ func GetDiscussionDetail(c *gin.Context) {
 	query := `
 		SELECT d.id, d.title, d.content, d.status, d.replies, d.views, d.likes, d.created_at,
 			   d.course_id, c.title as course_title,
-			   d.author_id, u.username, u.avatar_url
+			   d.author_id, u.username, u.avatar_url,
+			   d.ai_status, d.ai_draft, d.ai_confidence, d.ai_linked_knowledge
 		FROM discussions d
 		LEFT JOIN courses c ON d.course_id = c.id
 		LEFT JOIN users u ON d.author_id = u.id
@@ -305,11 +307,16 @@ func GetDiscussionDetail(c *gin.Context) {
 		UserID      sql.NullInt64
 		Username    sql.NullString
 		AvatarURL   sql.NullString
+		AIStatus    sql.NullString
+		AIDraft     sql.NullString
+		Confidence  sql.NullFloat64
+		AILinks     sql.NullString
 	}
 
 	err := database.DB.QueryRow(query, discussionID).Scan(
 		&d.ID, &d.Title, &d.Content, &d.Status, &d.Replies, &d.Views, &d.Likes, &d.CreatedAt,
-		&d.CourseID, &d.CourseTitle, &d.UserID, &d.Username, &d.AvatarURL)
+		&d.CourseID, &d.CourseTitle, &d.UserID, &d.Username, &d.AvatarURL,
+		&d.AIStatus, &d.AIDraft, &d.Confidence, &d.AILinks)
 
 	if err == sql.ErrNoRows {
 		utils.NotFound(c, "讨论不存在")
@@ -352,6 +359,20 @@ func GetDiscussionDetail(c *gin.Context) {
 		discussionData["author"] = author
 	}
 
+	// AI 助教草稿：aiStatus 为 pending/processing 时前端可提示“生成中”
+	if d.AIStatus.Valid {
+		discussionData["aiStatus"] = d.AIStatus.String
+	}
+	if d.AIDraft.Valid && d.AIDraft.String != "" {
+		links := []ragKnowledgeLink{}
+		if d.AILinks.Valid {
+			json.Unmarshal([]byte(d.AILinks.String), &links)
+		}
+		discussionData["aiDraft"] = d.AIDraft.String
+		discussionData["confidenceScore"] = d.Confidence.Float64
+		discussionData["linkedKnowledge"] = links
+	}
+
 	// 社交增强后的列表加载
 	repliesQuery := `
 		SELECT r.id, r.content, r.created_at, r.like_count, r.fav_count,
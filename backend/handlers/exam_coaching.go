@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/online-education-platform/backend/database"
+	ragpkg "github.com/online-education-platform/backend/rag"
+	"github.com/online-education-platform/backend/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	examCoachingPending    = "pending"
+	examCoachingProcessing = "processing"
+	examCoachingCompleted  = "completed"
+	// examCoachingSkipped 课程知识库中没有相关资料或额度用尽，不生成讲解
+	examCoachingSkipped = "skipped"
+	examCoachingFailed  = "failed"
+
+	examCoachingMaxAttempts  = 3
+	examCoachingPollInterval = 5 * time.Second
+	examCoachingTimeout      = 2 * time.Minute
+	// examCoachingTopK 讲解参考的资料分块数，复习清单从中挑选
+	examCoachingTopK = 3
+)
+
+var (
+	examCoachingWake = make(chan struct{}, 1)
+	examCoachingOnce sync.Once
+)
+
+// examCoaching 附在答错的客观题上的讲解，存于 exam_answers.coaching
+type examCoaching struct {
+	Explanation string             `json:"explanation"`
+	Review      []ragKnowledgeLink `json:"review"`
+}
+
+type examCoachingJob struct {
+	AnswerID      int64
+	ExamID        int64
+	QuestionID    int64
+	CourseID      int64
+	StudentID     int64
+	Stem          string
+	Options       string
+	StudentAnswer string
+	CorrectAnswer string
+	Attempts      int
+}
+
+// examCoachingEnabled EXAM_COACHING=off 时交卷后不再为错题生成讲解
+func examCoachingEnabled() bool {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("EXAM_COACHING"))) != "off"
+}
+
+// needsExamCoaching 只为作答了但答错的客观题生成讲解，未作答的题没有可分析的错误选项
+func needsExamCoaching(questionType, studentAnswer string, scoreAwarded, fullScore float64) bool {
+	if !isObjectiveExamQuestion(questionType) {
+		return false
+	}
+	return examCoachingEnabled() && examAnswerText(studentAnswer) != "" && scoreAwarded < fullScore
+}
+
+// wakeExamCoachingWorker 交卷后唤醒 worker 处理新排队的错题
+func wakeExamCoachingWorker() {
+	select {
+	case examCoachingWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartExamCoachingWorker 启动错题讲解 worker（只启动一次）；启动时把中断在处理中的错题放回队列
+func StartExamCoachingWorker() {
+	examCoachingOnce.Do(func() {
+		if _, err := database.DB.Exec(
+			`UPDATE exam_answers SET coaching_status = ? WHERE coaching_status = ?`,
+			examCoachingPending, examCoachingProcessing,
+		); err != nil {
+			utils.GetLogger().Warn("failed to recover exam coaching jobs", zap.Error(err))
+		}
+		go func() {
+			ticker := time.NewTicker(examCoachingPollInterval)
+			defer ticker.Stop()
+			for {
+				for runNextExamCoachingJob() {
+				}
+				select {
+				case <-ticker.C:
+				case <-examCoachingWake:
+				}
+			}
+		}()
+	})
+}
+
+// runNextExamCoachingJob 认领并处理一道到期的错题，没有可处理的错题时返回 false
+func runNextExamCoachingJob() bool {
+	job, err := claimExamCoachingJob(time.Now())
+	if err != nil {
+		if err != sql.ErrNoRows {
+			utils.GetLogger().Warn("failed to claim exam coaching job", zap.Error(err))
+		}
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), examCoachingTimeout)
+	defer cancel()
+	coaching, reason, err := processExamCoachingJob(ctx, job)
+	if err != nil {
+		failExamCoachingJob(job, err, time.Now())
+		return true
+	}
+	saveExamCoaching(job.AnswerID, coaching, reason)
+	return true
+}
+
+func claimExamCoachingJob(now time.Time) (*examCoachingJob, error) {
+	job := &examCoachingJob{}
+	err := database.DB.QueryRow(
+		`SELECT a.id, e.id, q.id, e.course_id, s.student_id, q.stem, COALESCE(q.options, ''),
+		        COALESCE(a.student_answer, ''), COALESCE(q.answer, ''), a.coaching_attempts
+         FROM exam_answers a
+         JOIN exam_submissions s ON s.id = a.submission_id
+         JOIN exams e ON e.id = s.exam_id
+         JOIN exam_questions q ON q.id = a.question_id
+         WHERE a.coaching_status = ? AND (a.coaching_next_run_at IS NULL OR a.coaching_next_run_at <= ?)
+         ORDER BY a.coaching_next_run_at ASC, a.id ASC
+         LIMIT 1`,
+		examCoachingPending, now,
+	).Scan(&job.AnswerID, &job.ExamID, &job.QuestionID, &job.CourseID, &job.StudentID, &job.Stem, &job.Options,
+		&job.StudentAnswer, &job.CorrectAnswer, &job.Attempts)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := database.DB.Exec(
+		`UPDATE exam_answers SET coaching_status = ?, coaching_attempts = coaching_attempts + 1 WHERE id = ? AND coaching_status = ?`,
+		examCoachingProcessing, job.AnswerID, examCoachingPending,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return nil, sql.ErrNoRows
+	}
+	job.Attempts++
+	return job, nil
+}
+
+// processExamCoachingJob 按题干和学生的错误选项检索课程资料并生成讲解。
+// 知识库没有相关资料或额度用尽时返回 nil 讲解和跳过原因
+func processExamCoachingJob(ctx context.Context, job *examCoachingJob) (*examCoaching, string, error) {
+	cfg, err := resolveRAGConfig("", "")
+	if err != nil {
+		return nil, "", &permanentJobError{err: err}
+	}
+	scope := aiUsageScopeForUser(job.StudentID, job.CourseID, aiFeatureExamCoaching)
+	if status := checkAIQuota(scope); status != nil {
+		return nil, "今日 AI 使用额度已用尽", nil
+	}
+	cfg = scope.meter(cfg)
+
+	// 讲解按学生试卷上的选项顺序和字母生成，与学生看到的答卷一致
+	shuffle, err := loadExamShuffle(job.ExamID, job.StudentID)
+	if err != nil {
+		return nil, "", err
+	}
+	question := ragpkg.CoachingQuestion{
+		Stem:          job.Stem,
+		Options:       decodeExamOptions(shuffle.displayOptions(job.QuestionID, job.Options)),
+		StudentAnswer: examAnswerText(shuffle.displayAnswer(job.QuestionID, job.StudentAnswer)),
+		CorrectAnswer: examAnswerText(shuffle.displayAnswer(job.QuestionID, job.CorrectAnswer)),
+	}
+	query := ragpkg.CoachingQuery(question)
+	plan := &ragQueryPlan{
+		CourseID:       job.CourseID,
+		UserID:         job.StudentID,
+		Question:       query,
+		RewrittenQuery: query,
+		Mode:           ragpkg.RetrievalHybrid,
+		Config:         cfg,
+		Sources:        []ragSource{},
+	}
+	if err := plan.retrieve(ctx, ragRetrieveOptions{
+		Retrieval: ragpkg.RetrievalQuery{Mode: ragpkg.RetrievalHybrid, VectorWeight: 1, KeywordWeight: 1},
+		TopK:      examCoachingTopK,
+		Reranker:  newRAGReranker(cfg),
+	}); err != nil {
+		return nil, "", err
+	}
+	if plan.Answer != "" {
+		return nil, plan.Answer, nil
+	}
+
+	generated, err := ragpkg.GenerateCoaching(ctx, plan.provider(), question, plan.Contexts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	links := ragKnowledgeLinks(plan.Sources)
+	review := make([]ragKnowledgeLink, 0, len(generated.ReviewCitations))
+	for _, citation := range generated.ReviewCitations {
+		review = append(review, links[citation-1])
+	}
+	// 模型没有指明复习内容时，推荐最相关的资料
+	if len(review) == 0 && len(links) > 0 {
+		review = links[:1]
+	}
+	return &examCoaching{Explanation: generated.Explanation, Review: review}, "", nil
+}
+
+func saveExamCoaching(answerID int64, coaching *examCoaching, reason string) {
+	status := examCoachingSkipped
+	var coachingValue, reasonValue interface{}
+	if coaching != nil {
+		status = examCoachingCompleted
+		raw, _ := json.Marshal(coaching)
+		coachingValue = string(raw)
+	}
+	if reason != "" {
+		reasonValue = reason
+	}
+	if _, err := database.DB.Exec(
+		`UPDATE exam_answers SET coaching_status = ?, coaching = ?, coaching_error = ? WHERE id = ?`,
+		status, coachingValue, reasonValue, answerID,
+	); err != nil {
+		utils.GetLogger().Error("save exam coaching failed", zap.Int64("answerID", answerID), zap.Error(err))
+	}
+}
+
+// failExamCoachingJob 可重试的错误按指数退避重新排队，超过次数或永久错误时标记失败
+func failExamCoachingJob(job *examCoachingJob, jobErr error, now time.Time) {
+	logger := utils.GetLogger()
+	retryAt, retry := jobRetryAt(jobErr, job.Attempts, examCoachingMaxAttempts, now)
+	if !retry {
+		logger.Error("exam coaching job failed", zap.Int64("answerID", job.AnswerID), zap.Int("attempts", job.Attempts), zap.Error(jobErr))
+		database.DB.Exec( //nolint:errcheck
+			`UPDATE exam_answers SET coaching_status = ?, coaching_error = ? WHERE id = ?`,
+			examCoachingFailed, jobErr.Error(), job.AnswerID,
+		)
+		return
+	}
+
+	logger.Warn("exam coaching job will retry", zap.Int64("answerID", job.AnswerID), zap.Int("attempts", job.Attempts), zap.Time("retryAt", retryAt), zap.Error(jobErr))
+	database.DB.Exec( //nolint:errcheck
+		`UPDATE exam_answers SET coaching_status = ?, coaching_error = ?, coaching_next_run_at = ? WHERE id = ?`,
+		examCoachingPending, jobErr.Error(), retryAt, job.AnswerID,
+	)
+}
+
+// examAnswerText 把 JSON 存储的答案转为可读文本：字符串原样返回，多选数组用顿号连接
+func examAnswerText(raw string) string {
+	text := strings.TrimSpace(raw)
+	var choices []string
+	if err := json.Unmarshal([]byte(text), &choices); err == nil {
+		return strings.Join(choices, "、")
+	}
+	return strings.TrimSpace(normalizeStoredExamAnswer(text))
+}
+
+func decodeExamOptions(raw string) []string {
+	var options []string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &options); err != nil {
+		return nil
+	}
+	return options
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+)
+
+func withExamCoachingTestDB(t *testing.T) {
+	t.Helper()
+	withTestDB(t)
+	// 交卷后的难题检查在后台读取数据库，须在测试数据库关闭前结束
+	t.Cleanup(examWarningJobs.Wait)
+	seedTestDB(t,
+		`INSERT INTO course_enrollments (course_id, student_id) VALUES (1, 5)`,
+		`INSERT INTO exam_questions (id, exam_id, type, stem, options, answer, score, order_index) VALUES
+			(1, 1, 'SINGLE_CHOICE', '栈的存取规则是？', '["先进先出","后进先出"]', '"后进先出"', 10, 1),
+			(2, 1, 'TRUE_FALSE', '栈只能在栈顶插入', '["正确","错误"]', '"正确"', 5, 2),
+			(3, 1, 'SINGLE_CHOICE', '队列的存取规则是？', '["先进先出","后进先出"]', '"先进先出"', 10, 3),
+			(4, 1, 'SHORT_ANSWER', '简述栈的应用', NULL, '"函数调用"', 10, 4)`,
+	)
+	now := time.Now()
+	if _, err := database.DB.Exec(
+		`INSERT INTO exams (id, course_id, title, start_time, end_time) VALUES (1, 1, '期中', ?, ?)`,
+		now.Add(-time.Hour), now.Add(time.Hour),
+	); err != nil {
+		t.Fatalf("seed exam: %v", err)
+	}
+}
+
+func TestSubmitExamCoachesWrongObjectiveAnswers(t *testing.T) {
+	withExamCoachingTestDB(t)
+	newRAGModelTestServer(t, "栈是后进先出的线性表[1]，先进先出描述的是队列。\n复习：[1]")
+
+	enqueueTestDocument(t, "stack.md", "# 栈\n\n栈是一种后进先出的线性表，只允许在栈顶插入和删除。")
+	for runNextRAGIngestJob() {
+	}
+
+	params := gin.Params{{Key: "id", Value: "1"}}
+	body := `{"answers":[
+		{"questionId":1,"answer":"先进先出"},
+		{"questionId":2,"answer":"正确"},
+		{"questionId":3,"answer":""},
+		{"questionId":4,"answer":"表达式求值"}]}`
+	if w := performRAGRequest(SubmitExam, "STUDENT", 5, params, "/", body); w.Code != http.StatusOK {
+		t.Fatalf("submit exam failed: %d %s", w.Code, w.Body.String())
+	}
+
+	// 只有答错且作答了的客观题排队：第 2 题答对，第 3 题未作答，第 4 题是主观题
+	var queued int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM exam_answers WHERE coaching_status = ?`, examCoachingPending).Scan(&queued)
+	if queued != 1 {
+		t.Fatalf("expected exactly one wrong answer queued for coaching, got %d", queued)
+	}
+	if !runNextExamCoachingJob() || runNextExamCoachingJob() {
+		t.Fatal("expected the queued answer to be processed exactly once")
+	}
+
+	w := performRAGRequest(GetMyExamSubmission, "STUDENT", 5, params, "/", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("get submission failed: %d %s", w.Code, w.Body.String())
+	}
+	answers, _ := decodeResponseData(t, w.Body.Bytes())["answers"].([]any)
+	if len(answers) != 4 {
+		t.Fatalf("expected 4 answers, got %d", len(answers))
+	}
+	wrong := answers[0].(map[string]any)
+	if wrong["coachingStatus"] != examCoachingCompleted {
+		t.Fatalf("expected completed coaching, got %v", wrong["coachingStatus"])
+	}
+	coaching, _ := wrong["coaching"].(map[string]any)
+	if explanation, _ := coaching["explanation"].(string); explanation != "栈是后进先出的线性表[1]，先进先出描述的是队列。" {
+		t.Fatalf("unexpected explanation %v", coaching["explanation"])
+	}
+	review, _ := coaching["review"].([]any)
+	if len(review) != 1 || review[0].(map[string]any)["filename"] != "stack.md" {
+		t.Fatalf("expected stack.md in review list, got %v", coaching["review"])
+	}
+	for _, item := range answers[1:] {
+		if _, ok := item.(map[string]any)["coaching"]; ok {
+			t.Fatalf("only the wrong objective answer should carry coaching, got %v", item)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/online-education-platform/backend/models"
+)
+
+// 填空题答案：JSON 数组，每个元素是一个空的可接受答案列表，如 [["栈","stack"],["后进先出","LIFO"]]。
+// 比较时忽略大小写、全半角和空白；以 re: 开头的答案按正则表达式匹配整个答案（不区分大小写）。
+// 文本写法为每空用分号分隔、同一空的多个答案用 | 分隔：栈|stack；后进先出|LIFO
+const fillBlankRegexPrefix = "re:"
+
+// numericAnswerSpec 数值题答案。Tolerance 为绝对误差，RelativeTolerance 为相对误差（0.01 表示 1%），取两者中较宽的；
+// Unit 为标准单位，Units 为其他可接受单位及换算到标准单位的倍数，如 {"cm": 0.01}。学生不写单位时按标准单位计算
+type numericAnswerSpec struct {
+	Value             float64            `json:"value"`
+	Tolerance         float64            `json:"tolerance,omitempty"`
+	RelativeTolerance float64            `json:"relativeTolerance,omitempty"`
+	Unit              string             `json:"unit,omitempty"`
+	Units             map[string]float64 `json:"units,omitempty"`
+}
+
+var (
+	fillBlankSeparators = regexp.MustCompile(`[;；]`)
+	// 数值加可选单位，如 "9.8"、"-1.5e3 mm"、"9.8m/s^2"
+	reNumericAnswer = regexp.MustCompile(`^([+-]?(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d+)?)\s*(.*)$`)
+	// 数值题文本答案，如 "9.8±0.1 m/s^2"、"9.8 +- 2% m/s^2"
+	reNumericSpecText = regexp.MustCompile(`^([+-]?(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d+)?)\s*(?:(?:±|\+-|\+/-)\s*(\d+\.?\d*|\.\d+)\s*(%)?)?\s*(.*)$`)
+)
+
+// normalizeExamAnswerSpec 校验并规范化填空题和数值题的答案，接受 JSON 或文本写法，统一存为 JSON；
+// 编程题的答案为评测配置（见 codeQuestionSpec）。其他题型原样返回
+func normalizeExamAnswerSpec(questionType, raw string) (string, error) {
+	switch questionType {
+	case "FILL_BLANK":
+		blanks, err := parseFillBlankSpec(raw)
+		if err != nil {
+			return "", err
+		}
+		encoded, _ := json.Marshal(blanks)
+		return string(encoded), nil
+	case "NUMERIC":
+		spec, err := parseNumericSpec(raw)
+		if err != nil {
+			return "", err
+		}
+		encoded, _ := json.Marshal(spec)
+		return string(encoded), nil
+	case "CODE":
+		spec, err := parseCodeQuestionSpec(raw)
+		if err != nil {
+			return "", err
+		}
+		encoded, _ := json.Marshal(spec)
+		return string(encoded), nil
+	}
+	return raw, nil
+}
+
+func parseFillBlankSpec(raw string) ([][]string, error) {
+	text := strings.TrimSpace(normalizeStoredExamAnswer(raw))
+	var blanks [][]string
+	if err := json.Unmarshal([]byte(text), &blanks); err != nil {
+		blanks = nil
+		var flat []string
+		if err := json.Unmarshal([]byte(text), &flat); err == nil {
+			// ["栈","后进先出"] 表示两个空，各只有一个答案
+			for _, answer := range flat {
+				blanks = append(blanks, []string{answer})
+			}
+		} else {
+			for _, blank := range fillBlankSeparators.Split(text, -1) {
+				blanks = append(blanks, strings.Split(blank, "|"))
+			}
+		}
+	}
+
+	result := make([][]string, 0, len(blanks))
+	for i, alternatives := range blanks {
+		accepted := []string{}
+		for _, alternative := range alternatives {
+			alternative = strings.TrimSpace(alternative)
+			if alternative == "" {
+				continue
+			}
+			if pattern, ok := strings.CutPrefix(alternative, fillBlankRegexPrefix); ok {
+				if _, err := compileFillBlankPattern(pattern); err != nil {
+					return nil, fmt.Errorf("第 %d 空的正则表达式无效", i+1)
+				}
+			}
+			accepted = append(accepted, alternative)
+		}
+		if len(accepted) == 0 {
+			return nil, fmt.Errorf("第 %d 空没有可接受的答案", i+1)
+		}
+		result = append(result, accepted)
+	}
+	if len(result) == 0 {
+		return nil, errors.New("填空题至少需要一个空")
+	}
+	return result, nil
+}
+
+func parseNumericSpec(raw string) (*numericAnswerSpec, error) {
+	text := strings.TrimSpace(normalizeStoredExamAnswer(raw))
+	spec := &numericAnswerSpec{}
+	if err := json.Unmarshal([]byte(text), spec); err != nil {
+		m := reNumericSpecText.FindStringSubmatch(foldWidth(text))
+		if m == nil {
+			return nil, errors.New("数值题答案须为数值，可带误差和单位，如 9.8±0.1 m/s^2")
+		}
+		spec = &numericAnswerSpec{Unit: strings.TrimSpace(m[4])}
+		spec.Value, _ = strconv.ParseFloat(m[1], 64)
+		if m[2] != "" {
+			tolerance, _ := strconv.ParseFloat(m[2], 64)
+			if m[3] == "%" {
+				spec.RelativeTolerance = tolerance / 100
+			} else {
+				spec.Tolerance = tolerance
+			}
+		}
+	}
+
+	if spec.Tolerance < 0 || spec.RelativeTolerance < 0 || math.IsNaN(spec.Value) || math.IsInf(spec.Value, 0) {
+		return nil, errors.New("数值题的答案和误差须为有效数值，误差不能为负")
+	}
+	spec.Unit = strings.TrimSpace(spec.Unit)
+	for unit, factor := range spec.Units {
+		if strings.TrimSpace(unit) == "" || factor <= 0 {
+			return nil, errors.New("数值题的换算单位须有名称且倍数为正")
+		}
+	}
+	return spec, nil
+}
+
+// describeExamAnswerSpec 填空题的空数、数值题的单位和编程题的样例，学生作答时需要，不会泄露答案
+func describeExamAnswerSpec(question *models.ExamQuestion) {
+	switch question.Type {
+	case "FILL_BLANK":
+		if blanks, err := parseFillBlankSpec(question.Answer); err == nil {
+			question.BlankCount = len(blanks)
+		}
+	case "NUMERIC":
+		if spec, err := parseNumericSpec(question.Answer); err == nil {
+			question.Unit = spec.Unit
+		}
+	case "CODE":
+		if spec, err := parseCodeQuestionSpec(question.Answer); err == nil {
+			question.Code = spec.publicInfo()
+		}
+	}
+}
+
+// fillBlankCredit 返回填空题答对的空所占比例。学生答案为每空一项的 JSON 数组，只有一个空时也可以是纯文本
+func fillBlankCredit(question models.ExamQuestion, studentAnswer string) float64 {
+	blanks, err := parseFillBlankSpec(question.Answer)
+	if err != nil {
+		return 0
+	}
+	var answers []string
+	text := strings.TrimSpace(normalizeStoredExamAnswer(studentAnswer))
+	if err := json.Unmarshal([]byte(text), &answers); err != nil {
+		answers = []string{text}
+	}
+
+	correct := 0
+	for i, accepted := range blanks {
+		if i < len(answers) && matchesFillBlank(answers[i], accepted) {
+			correct++
+		}
+	}
+	return float64(correct) / float64(len(blanks))
+}
+
+// compileFillBlankPattern 正则须匹配整个答案，re:stack 不接受 "not a stack"
+func compileFillBlankPattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(`(?i)^(?:` + pattern + `)$`)
+}
+
+func matchesFillBlank(answer string, accepted []string) bool {
+	folded := strings.TrimSpace(foldWidth(answer))
+	if folded == "" {
+		return false
+	}
+	for _, alternative := range accepted {
+		if pattern, ok := strings.CutPrefix(alternative, fillBlankRegexPrefix); ok {
+			if re, err := compileFillBlankPattern(pattern); err == nil && re.MatchString(folded) {
+				return true
+			}
+			continue
+		}
+		if normalizeBlankText(folded) == normalizeBlankText(alternative) {
+			return true
+		}
+	}
+	return false
+}
+
+// numericAnswerCorrect 判断数值题答案是否在误差范围内，带单位时先换算为标准单位
+func numericAnswerCorrect(question models.ExamQuestion, studentAnswer string) bool {
+	spec, err := parseNumericSpec(question.Answer)
+	if err != nil {
+		return false
+	}
+	m := reNumericAnswer.FindStringSubmatch(strings.TrimSpace(foldWidth(normalizeStoredExamAnswer(studentAnswer))))
+	if m == nil {
+		return false
+	}
+	value, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return false
+	}
+
+	if unit := normalizeUnit(m[2]); unit != "" && unit != normalizeUnit(spec.Unit) {
+		factor := 0.0
+		for alternative, multiplier := range spec.Units {
+			if normalizeUnit(alternative) == unit {
+				factor = multiplier
+				break
+			}
+		}
+		if factor == 0 {
+			return false
+		}
+		value *= factor
+	}
+
+	allowed := math.Max(spec.Tolerance, math.Abs(spec.Value)*spec.RelativeTolerance)
+	return math.Abs(value-spec.Value) <= allowed+1e-9
+}
+
+// foldWidth 把全角字符转为半角
+func foldWidth(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '　':
+			return ' '
+		case r >= '！' && r <= '～':
+			return r - 0xFEE0
+		}
+		return r
+	}, text)
+}
+
+func normalizeBlankText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, foldWidth(text))
+}
+
+// normalizeUnit 统一单位写法：忽略大小写和空白，上标 ²³ 写作 ^2 ^3，· 写作 *
+func normalizeUnit(unit string) string {
+	unit = strings.NewReplacer("²", "^2", "³", "^3", "·", "*", "×", "*").Replace(unit)
+	return normalizeBlankText(unit)
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/models"
+)
+
+func TestNormalizeExamAnswerSpec(t *testing.T) {
+	cases := []struct {
+		qtype, raw, want string
+	}{
+		{"FILL_BLANK", "栈|stack；后进先出", `[["栈","stack"],["后进先出"]]`},
+		{"FILL_BLANK", `["栈","后进先出"]`, `[["栈"],["后进先出"]]`},
+		{"FILL_BLANK", `[["re:^o\\(n\\)$"]]`, `[["re:^o\\(n\\)$"]]`},
+		{"NUMERIC", "9.8±0.1 m/s^2", `{"value":9.8,"tolerance":0.1,"unit":"m/s^2"}`},
+		{"NUMERIC", "100 +- 1% cm", `{"value":100,"relativeTolerance":0.01,"unit":"cm"}`},
+		{"NUMERIC", `{"value":1,"unit":"m","units":{"cm":0.01}}`, `{"value":1,"unit":"m","units":{"cm":0.01}}`},
+	}
+	for _, tc := range cases {
+		got, err := normalizeExamAnswerSpec(tc.qtype, tc.raw)
+		if err != nil || got != tc.want {
+			t.Errorf("%s %q: expected %s, got %s (%v)", tc.qtype, tc.raw, tc.want, got, err)
+		}
+	}
+
+	for _, invalid := range []struct{ qtype, raw string }{
+		{"FILL_BLANK", ""},
+		{"FILL_BLANK", "栈；"},
+		{"FILL_BLANK", "re:(栈"},
+		{"NUMERIC", "大约十"},
+		{"NUMERIC", `{"value":1,"tolerance":-1}`},
+	} {
+		if _, err := normalizeExamAnswerSpec(invalid.qtype, invalid.raw); err == nil {
+			t.Errorf("%s %q must be rejected", invalid.qtype, invalid.raw)
+		}
+	}
+}
+
+func TestScoreFillBlankAndNumericAnswers(t *testing.T) {
+	blanks := func(policy string) models.ExamQuestion {
+		return models.ExamQuestion{Type: "FILL_BLANK", Answer: `[["栈","stack"],["re:^o\\(1\\)$"]]`, Score: 4, ScoringPolicy: policy}
+	}
+	numeric := models.ExamQuestion{Type: "NUMERIC", Answer: `{"value":9.8,"tolerance":0.1,"unit":"m/s^2","units":{"cm/s^2":0.01}}`, Score: 3, WrongPenalty: 1}
+	cases := []struct {
+		name     string
+		question models.ExamQuestion
+		answer   string
+		want     float64
+	}{
+		{"case width and whitespace are ignored", blanks(""), `[" ＳＴＡＣＫ ","O(1)"]`, 4},
+		{"regex alternative", blanks(""), `["栈","o(1)"]`, 4},
+		{"regex must match the whole answer", models.ExamQuestion{Type: "FILL_BLANK", Answer: `[["re:stack|栈"]]`, Score: 2}, `["not a stack"]`, 0},
+		{"anchored regex alternation", models.ExamQuestion{Type: "FILL_BLANK", Answer: `[["re:stack|栈"]]`, Score: 2}, `["Stack"]`, 2},
+		{"all or nothing needs every blank", blanks(examScoringAllOrNothing), `["栈","O(n)"]`, 0},
+		{"proportional counts correct blanks", blanks(examScoringProportional), `["栈","O(n)"]`, 2},
+		{"missing blanks are wrong", blanks(examScoringProportional), `["栈"]`, 2},
+		{"single blank as plain text", models.ExamQuestion{Type: "FILL_BLANK", Answer: `[["后进先出","LIFO"]]`, Score: 2}, "lifo", 2},
+		{"within tolerance", numeric, "9.75", 3},
+		{"with base unit", numeric, "9.9 m/s²", 3},
+		{"full width digits", numeric, "９.８", 3},
+		{"converted unit", numeric, "981 cm/s^2", 3},
+		{"outside tolerance is penalised", numeric, "10", -1},
+		{"unknown unit is wrong", numeric, "9.8 km/h", -1},
+		{"not a number", numeric, "about ten", -1},
+		{"relative tolerance", models.ExamQuestion{Type: "NUMERIC", Answer: "100 +- 1%", Score: 2}, "99.2", 2},
+	}
+	for _, tc := range cases {
+		if got := scoreObjectiveAnswer(tc.question, tc.answer); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestParseQuestionsRecognisesFillBlankAndNumeric(t *testing.T) {
+	text := `一、填空题
+1. 栈的特点是____，队列的特点是____。
+答案：后进先出|LIFO；先进先出|FIFO
+二、数值题
+2. 自由落体加速度约为多少？
+答案：9.8±0.1 m/s^2
+分值：4
+三、计算题
+3. 求物体从 20 m 高处自由落下的时间，写出过程。
+答案：由 h = gt²/2 得 t = √(2h/g) ≈ 2.02 s`
+	questions := parseQuestions(text)
+	if len(questions) != 3 {
+		t.Fatalf("expected 2 questions, got %+v", questions)
+	}
+	if questions[0].Type != "FILL_BLANK" || questions[0].Answer != `[["后进先出","LIFO"],["先进先出","FIFO"]]` {
+		t.Fatalf("unexpected fill blank question %+v", questions[0])
+	}
+	if questions[1].Type != "NUMERIC" || questions[1].Answer != `{"value":9.8,"tolerance":0.1,"unit":"m/s^2"}` || questions[1].Score != 4 {
+		t.Fatalf("unexpected numeric question %+v", questions[1])
+	}
+	if questions[2].Type != "SHORT_ANSWER" {
+		t.Fatalf("worked calculation problems must stay subjective, got %+v", questions[2])
+	}
+
+	normalized := normalizeParsedQuestions([]ParsedQuestion{
+		{Type: "填空", Stem: "二分查找的时间复杂度是____", Answer: "O(log n)", Score: 2, Confidence: 0.9},
+		{Type: "NUMBER", Stem: "圆周率保留两位小数", Answer: "3.14", Score: 2, Confidence: 0.9},
+		{Type: "NUMERIC", Stem: "没有数值答案", Answer: "不知道", Score: 2, Confidence: 0.9},
+	}, 0)
+	if len(normalized) != 2 || normalized[0].Type != "FILL_BLANK" || normalized[1].Type != "NUMERIC" || len(normalized[1].Options) != 0 {
+		t.Fatalf("unexpected normalized questions %+v", normalized)
+	}
+}
+
+func TestSubmitExamGradesFillBlankAndNumeric(t *testing.T) {
+	withQuestionBankTestDB(t)
+	params := gin.Params{{Key: "id", Value: "1"}}
+
+	invalid := `{"type":"NUMERIC","stem":"重力加速度","answer":"约 9.8","score":3}`
+	if w := performRAGRequest(AddQuestion, "INSTRUCTOR", 9, params, "/", invalid); w.Code != http.StatusBadRequest {
+		t.Fatalf("numeric answer without a value must be rejected, got %d", w.Code)
+	}
+
+	questions := []string{
+		`{"type":"FILL_BLANK","stem":"栈是____，队列是____","answer":"后进先出|LIFO；先进先出|FIFO","score":4,"orderIndex":5,"scoringPolicy":"proportional"}`,
+		`{"type":"NUMERIC","stem":"重力加速度","answer":"9.8±0.1 m/s^2","score":3,"orderIndex":6}`,
+	}
+	ids := []int64{}
+	for _, body := range questions {
+		w := performRAGRequest(AddQuestion, "INSTRUCTOR", 9, params, "/", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("add question failed: %d %s", w.Code, w.Body.String())
+		}
+		ids = append(ids, int64(decodeResponseData(t, w.Body.Bytes())["id"].(float64)))
+	}
+
+	_, shown := studentExamQuestions(t, 6)
+	for _, raw := range shown {
+		question := raw.(map[string]any)
+		if question["answer"] != nil && question["answer"] != "" {
+			t.Fatalf("students must not see answers, got %v", question)
+		}
+		switch question["type"] {
+		case "FILL_BLANK":
+			if question["blankCount"] != float64(2) {
+				t.Fatalf("expected 2 blanks, got %v", question)
+			}
+		case "NUMERIC":
+			if question["unit"] != "m/s^2" {
+				t.Fatalf("expected the unit to be shown, got %v", question)
+			}
+		}
+	}
+
+	body := fmt.Sprintf(`{"answers":[{"questionId":%d,"answer":"[\"lifo\",\"后进后出\"]"},{"questionId":%d,"answer":"9.85 m/s^2"}]}`, ids[0], ids[1])
+	w := performRAGRequest(SubmitExam, "STUDENT", 6, params, "/", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("submit exam failed: %d %s", w.Code, w.Body.String())
+	}
+	if total := decodeResponseData(t, w.Body.Bytes())["totalScore"]; total != float64(5) {
+		t.Fatalf("expected one blank and the numeric answer to score, got %v", total)
+	}
+}
@@ -0,0 +1,752 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+	ragpkg "github.com/online-education-platform/backend/rag"
+	"github.com/online-education-platform/backend/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	examAIGradePending    = "pending"
+	examAIGradeProcessing = "processing"
+	// examAIGradeProposed 已生成评分建议，等待教师确认
+	examAIGradeProposed = "proposed"
+	// examAIGradeAccepted 教师采纳了评分建议；examAIGradeOverridden 教师改分（或直接人工批改）
+	examAIGradeAccepted   = "accepted"
+	examAIGradeOverridden = "overridden"
+	// examAIGradeSkipped 额度用尽等原因未生成建议，由教师人工批改
+	examAIGradeSkipped = "skipped"
+	examAIGradeFailed  = "failed"
+
+	examGradeActionAccept   = "accept"
+	examGradeActionOverride = "override"
+
+	examGradingMaxAttempts  = 3
+	examGradingPollInterval = 5 * time.Second
+	examGradingTimeout      = 2 * time.Minute
+)
+
+var (
+	examGradingWake = make(chan struct{}, 1)
+	examGradingOnce sync.Once
+)
+
+type examGradingJob struct {
+	AnswerID        int64
+	CourseID        int64
+	InstructorID    int64
+	Stem            string
+	Rubric          string
+	ReferenceAnswer string
+	Score           float64
+	StudentAnswer   string
+	Attempts        int
+}
+
+// examGradeDecision 教师对一份主观题作答的处理：accept 采纳 AI 评分，override 给出自己的分数
+type examGradeDecision struct {
+	AnswerID int64    `json:"answerId"`
+	Action   string   `json:"action"`
+	Score    *float64 `json:"score"`
+	Note     string   `json:"note"`
+}
+
+// ReviewExamGradingRequest 批量确认 AI 评分建议
+type ReviewExamGradingRequest struct {
+	Decisions []examGradeDecision `json:"decisions"`
+	// AcceptAll 采纳所有置信度不低于 MinConfidence 的待确认建议，Decisions 中列出的作答除外
+	AcceptAll     bool    `json:"acceptAll"`
+	MinConfidence float64 `json:"minConfidence"`
+}
+
+// examGradeTarget 待处理的作答及其当前评分状态
+type examGradeTarget struct {
+	AnswerID     int64
+	SubmissionID int64
+	Type         string
+	MaxScore     float64
+	ScoreAwarded sql.NullFloat64
+	Status       string
+	Proposal     *ragpkg.GradeProposal
+}
+
+// examAIGradingEnabled EXAM_AI_GRADING=off 时交卷后不再为主观题生成评分建议
+func examAIGradingEnabled() bool {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("EXAM_AI_GRADING"))) != "off"
+}
+
+func isObjectiveExamQuestion(questionType string) bool {
+	switch questionType {
+	case "SINGLE_CHOICE", "MULTIPLE_CHOICE", "TRUE_FALSE", "FILL_BLANK", "NUMERIC":
+		return true
+	}
+	return false
+}
+
+// isAutoGradedExamQuestion 客观题和编程题自动判分，不需要评分细则和 AI 评分
+func isAutoGradedExamQuestion(questionType string) bool {
+	return isObjectiveExamQuestion(questionType) || questionType == "CODE"
+}
+
+// normalizeExamRubric 校验主观题评分细则：每个评分点须有描述且分值为正，分值之和等于题目分值。
+// 自动判分的题目和空细则返回 nil
+func normalizeExamRubric(questionType string, raw *string, score float64) (*string, error) {
+	if isAutoGradedExamQuestion(questionType) || raw == nil || strings.TrimSpace(*raw) == "" {
+		return nil, nil
+	}
+	var criteria []ragpkg.RubricCriterion
+	if err := json.Unmarshal([]byte(*raw), &criteria); err != nil {
+		return nil, fmt.Errorf("评分细则格式错误")
+	}
+	if len(criteria) == 0 {
+		return nil, nil
+	}
+	total := 0.0
+	for i := range criteria {
+		criteria[i].Description = strings.TrimSpace(criteria[i].Description)
+		if criteria[i].Description == "" || criteria[i].Points <= 0 {
+			return nil, fmt.Errorf("评分细则第 %d 项缺少描述或分值", i+1)
+		}
+		total += criteria[i].Points
+	}
+	if math.Abs(total-score) > 1e-6 {
+		return nil, fmt.Errorf("评分细则分值之和（%g）须等于题目分值（%g）", total, score)
+	}
+	normalized, _ := json.Marshal(criteria)
+	rubric := string(normalized)
+	return &rubric, nil
+}
+
+// examReferenceAnswer 主观题参考答案，客观题的标准答案和编程题的评测配置仍存于 answer 字段
+func examReferenceAnswer(questionType string, raw *string) *string {
+	if isAutoGradedExamQuestion(questionType) || raw == nil || strings.TrimSpace(*raw) == "" {
+		return nil
+	}
+	reference := strings.TrimSpace(*raw)
+	return &reference
+}
+
+// examGradingReference 评分依据的参考答案：未单独填写时沿用题目的 answer 字段
+func examGradingReference(reference *string, answer string) string {
+	if reference != nil && strings.TrimSpace(*reference) != "" {
+		return strings.TrimSpace(*reference)
+	}
+	return examAnswerText(answer)
+}
+
+func decodeExamRubric(raw string) []ragpkg.RubricCriterion {
+	var criteria []ragpkg.RubricCriterion
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &criteria); err != nil {
+		return nil
+	}
+	return criteria
+}
+
+// needsExamAIGrading 只为作答了的主观题生成评分建议，且题目须有评分细则或参考答案作为依据
+func needsExamAIGrading(questionType, studentAnswer string, rubric *string, reference string) bool {
+	if isAutoGradedExamQuestion(questionType) || !examAIGradingEnabled() || examAnswerText(studentAnswer) == "" {
+		return false
+	}
+	return (rubric != nil && strings.TrimSpace(*rubric) != "") || reference != ""
+}
+
+// wakeExamGradingWorker 交卷或教师重新发起评分后唤醒 worker
+func wakeExamGradingWorker() {
+	select {
+	case examGradingWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartExamGradingWorker 启动主观题 AI 评分 worker（只启动一次）；启动时把中断在处理中的作答放回队列
+func StartExamGradingWorker() {
+	examGradingOnce.Do(func() {
+		if _, err := database.DB.Exec(
+			`UPDATE exam_answers SET ai_grade_status = ? WHERE ai_grade_status = ?`,
+			examAIGradePending, examAIGradeProcessing,
+		); err != nil {
+			utils.GetLogger().Warn("failed to recover exam grading jobs", zap.Error(err))
+		}
+		go func() {
+			ticker := time.NewTicker(examGradingPollInterval)
+			defer ticker.Stop()
+			for {
+				for runNextExamGradingJob() {
+				}
+				select {
+				case <-ticker.C:
+				case <-examGradingWake:
+				}
+			}
+		}()
+	})
+}
+
+// runNextExamGradingJob 认领并评分一份到期的主观题作答，没有可处理的作答时返回 false
+func runNextExamGradingJob() bool {
+	job, err := claimExamGradingJob(time.Now())
+	if err != nil {
+		if err != sql.ErrNoRows {
+			utils.GetLogger().Warn("failed to claim exam grading job", zap.Error(err))
+		}
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), examGradingTimeout)
+	defer cancel()
+	proposal, reason, err := processExamGradingJob(ctx, job)
+	if err != nil {
+		failExamGradingJob(job, err, time.Now())
+		return true
+	}
+	saveExamGradeProposal(job.AnswerID, proposal, reason)
+	return true
+}
+
+func claimExamGradingJob(now time.Time) (*examGradingJob, error) {
+	job := &examGradingJob{}
+	var reference sql.NullString
+	var answer string
+	err := database.DB.QueryRow(
+		`SELECT a.id, e.course_id, COALESCE(c.instructor_id, 0), q.stem, COALESCE(q.rubric, ''),
+		        q.reference_answer, COALESCE(q.answer, ''), q.score, COALESCE(a.student_answer, ''), a.ai_grade_attempts
+         FROM exam_answers a
+         JOIN exam_submissions s ON s.id = a.submission_id
+         JOIN exams e ON e.id = s.exam_id
+         JOIN courses c ON c.id = e.course_id
+         JOIN exam_questions q ON q.id = a.question_id
+         WHERE a.ai_grade_status = ? AND (a.ai_grade_next_run_at IS NULL OR a.ai_grade_next_run_at <= ?)
+         ORDER BY a.ai_grade_next_run_at ASC, a.id ASC
+         LIMIT 1`,
+		examAIGradePending, now,
+	).Scan(&job.AnswerID, &job.CourseID, &job.InstructorID, &job.Stem, &job.Rubric,
+		&reference, &answer, &job.Score, &job.StudentAnswer, &job.Attempts)
+	if err != nil {
+		return nil, err
+	}
+	var referencePtr *string
+	if reference.Valid {
+		referencePtr = &reference.String
+	}
+	job.ReferenceAnswer = examGradingReference(referencePtr, answer)
+
+	res, err := database.DB.Exec(
+		`UPDATE exam_answers SET ai_grade_status = ?, ai_grade_attempts = ai_grade_attempts + 1 WHERE id = ? AND ai_grade_status = ?`,
+		examAIGradeProcessing, job.AnswerID, examAIGradePending,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return nil, sql.ErrNoRows
+	}
+	job.Attempts++
+	return job, nil
+}
+
+// processExamGradingJob 按评分细则和参考答案生成评分建议，额度用尽时返回 nil 建议和跳过原因。
+// 评分是教师的批改工具，用量计入课程教师
+func processExamGradingJob(ctx context.Context, job *examGradingJob) (*ragpkg.GradeProposal, string, error) {
+	cfg, err := resolveRAGConfig("", "")
+	if err != nil {
+		return nil, "", &permanentJobError{err: err}
+	}
+	scope := aiUsageScopeForUser(job.InstructorID, job.CourseID, aiFeatureExamGrading)
+	if status := checkAIQuota(scope); status != nil {
+		return nil, "今日 AI 使用额度已用尽", nil
+	}
+	cfg = scope.meter(cfg)
+
+	proposal, err := ragpkg.GradeAnswer(ctx, newRAGProvider(cfg), ragpkg.GradingQuestion{
+		Stem:            job.Stem,
+		ReferenceAnswer: job.ReferenceAnswer,
+		Rubric:          decodeExamRubric(job.Rubric),
+		MaxScore:        job.Score,
+		StudentAnswer:   examAnswerText(job.StudentAnswer),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &proposal, "", nil
+}
+
+// saveExamGradeProposal 保存评分建议，score_awarded 保持不变直到教师确认；
+// 评分期间教师已改判或重新发起评分时作答不再处于处理中，建议直接丢弃
+func saveExamGradeProposal(answerID int64, proposal *ragpkg.GradeProposal, reason string) {
+	status := examAIGradeSkipped
+	var proposalValue, reasonValue interface{}
+	if proposal != nil {
+		status = examAIGradeProposed
+		raw, _ := json.Marshal(proposal)
+		proposalValue = string(raw)
+	}
+	if reason != "" {
+		reasonValue = reason
+	}
+	if _, err := database.DB.Exec(
+		`UPDATE exam_answers SET ai_grade_status = ?, ai_grade = ?, ai_grade_error = ? WHERE id = ? AND ai_grade_status = ?`,
+		status, proposalValue, reasonValue, answerID, examAIGradeProcessing,
+	); err != nil {
+		utils.GetLogger().Error("save exam grade proposal failed", zap.Int64("answerID", answerID), zap.Error(err))
+	}
+}
+
+// failExamGradingJob 可重试的错误按指数退避重新排队，超过次数或永久错误时标记失败
+func failExamGradingJob(job *examGradingJob, jobErr error, now time.Time) {
+	logger := utils.GetLogger()
+	retryAt, retry := jobRetryAt(jobErr, job.Attempts, examGradingMaxAttempts, now)
+	if !retry {
+		logger.Error("exam grading job failed", zap.Int64("answerID", job.AnswerID), zap.Int("attempts", job.Attempts), zap.Error(jobErr))
+		database.DB.Exec( //nolint:errcheck
+			`UPDATE exam_answers SET ai_grade_status = ?, ai_grade_error = ? WHERE id = ? AND ai_grade_status = ?`,
+			examAIGradeFailed, jobErr.Error(), job.AnswerID, examAIGradeProcessing,
+		)
+		return
+	}
+
+	logger.Warn("exam grading job will retry", zap.Int64("answerID", job.AnswerID), zap.Int("attempts", job.Attempts), zap.Time("retryAt", retryAt), zap.Error(jobErr))
+	database.DB.Exec( //nolint:errcheck
+		`UPDATE exam_answers SET ai_grade_status = ?, ai_grade_error = ?, ai_grade_next_run_at = ? WHERE id = ? AND ai_grade_status = ?`,
+		examAIGradePending, jobErr.Error(), retryAt, job.AnswerID, examAIGradeProcessing,
+	)
+}
+
+func decodeExamGradeProposal(raw sql.NullString) *ragpkg.GradeProposal {
+	if !raw.Valid || raw.String == "" {
+		return nil
+	}
+	var proposal ragpkg.GradeProposal
+	if err := json.Unmarshal([]byte(raw.String), &proposal); err != nil {
+		return nil
+	}
+	return &proposal
+}
+
+// ensureExamGrader 只有课程教师和管理员可以批改考试
+func ensureExamGrader(c *gin.Context, examID int64) bool {
+	role := currentUserRole(c)
+	if role != "INSTRUCTOR" && role != "ADMIN" {
+		utils.Forbidden(c, "权限不足")
+		return false
+	}
+	var instructorID int64
+	err := database.DB.QueryRow(`
+		SELECT c.instructor_id
+		FROM exams e
+		JOIN courses c ON e.course_id = c.id
+		WHERE e.id = ?
+	`, examID).Scan(&instructorID)
+	if err == sql.ErrNoRows {
+		utils.NotFound(c, "考试不存在")
+		return false
+	}
+	if err != nil {
+		utils.InternalServerError(c, "服务器错误")
+		return false
+	}
+	if role != "ADMIN" && instructorID != getCurrentUserID(c) {
+		utils.Forbidden(c, "权限不足")
+		return false
+	}
+	return true
+}
+
+// ListExamGrading 列出考试中的主观题作答及其 AI 评分建议，可按 status 过滤（如 proposed 为待确认）
+func ListExamGrading(c *gin.Context) {
+	examID, ok := parseInt64Param(c, c.Param("id"), "考试ID")
+	if !ok || !ensureExamGrader(c, examID) {
+		return
+	}
+
+	query := `
+		SELECT a.id, a.submission_id, s.student_id, COALESCE(u.username, ''), q.id, q.stem, q.score,
+		       COALESCE(a.student_answer, ''), a.score_awarded, COALESCE(a.ai_grade_status, ''), a.ai_grade,
+		       COALESCE(a.ai_grade_error, ''), a.graded_by, a.graded_at
+		FROM exam_answers a
+		JOIN exam_submissions s ON s.id = a.submission_id
+		JOIN exam_questions q ON q.id = a.question_id
+		LEFT JOIN users u ON u.id = s.student_id
+		WHERE s.exam_id = ? AND q.type NOT IN ('SINGLE_CHOICE', 'MULTIPLE_CHOICE', 'TRUE_FALSE', 'FILL_BLANK', 'NUMERIC', 'CODE')`
+	args := []interface{}{examID}
+	if status := strings.TrimSpace(c.Query("status")); status != "" {
+		query += ` AND COALESCE(a.ai_grade_status, '') = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY q.order_index, a.id`
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		utils.InternalServerError(c, "查询批改列表失败")
+		return
+	}
+	defer rows.Close()
+
+	items := []gin.H{}
+	for rows.Next() {
+		var answerID, submissionID, studentID, questionID int64
+		var studentName, stem, studentAnswer, status, reason string
+		var maxScore float64
+		var scoreAwarded sql.NullFloat64
+		var proposal sql.NullString
+		var gradedBy sql.NullInt64
+		var gradedAt sql.NullTime
+		if err := rows.Scan(&answerID, &submissionID, &studentID, &studentName, &questionID, &stem, &maxScore,
+			&studentAnswer, &scoreAwarded, &status, &proposal, &reason, &gradedBy, &gradedAt); err != nil {
+			continue
+		}
+		item := gin.H{
+			"answerId":      answerID,
+			"submissionId":  submissionID,
+			"studentId":     studentID,
+			"studentName":   studentName,
+			"questionId":    questionID,
+			"stem":          stem,
+			"score":         maxScore,
+			"studentAnswer": studentAnswer,
+			"aiGradeStatus": status,
+		}
+		if scoreAwarded.Valid {
+			item["scoreAwarded"] = scoreAwarded.Float64
+		}
+		if decoded := decodeExamGradeProposal(proposal); decoded != nil {
+			item["aiGrade"] = decoded
+		}
+		if reason != "" {
+			item["aiGradeError"] = reason
+		}
+		if gradedBy.Valid {
+			item["gradedBy"] = gradedBy.Int64
+		}
+		if gradedAt.Valid {
+			item["gradedAt"] = gradedAt.Time
+		}
+		items = append(items, item)
+	}
+
+	utils.Success(c, gin.H{"items": items})
+}
+
+// ReviewExamGrading 教师批量采纳或改动 AI 评分建议，更新答卷总分并记录到 exam_grading_audit。
+// 任何一项不合法时整批不生效
+func ReviewExamGrading(c *gin.Context) {
+	examID, ok := parseInt64Param(c, c.Param("id"), "考试ID")
+	if !ok || !ensureExamGrader(c, examID) {
+		return
+	}
+
+	var req ReviewExamGradingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数错误")
+		return
+	}
+	if len(req.Decisions) == 0 && !req.AcceptAll {
+		utils.BadRequest(c, "没有需要处理的评分")
+		return
+	}
+
+	decisions := make([]examGradeDecision, 0, len(req.Decisions))
+	targets := map[int64]*examGradeTarget{}
+	for _, decision := range req.Decisions {
+		if _, ok := targets[decision.AnswerID]; ok {
+			utils.BadRequest(c, fmt.Sprintf("作答 %d 重复出现", decision.AnswerID))
+			return
+		}
+		target, err := loadExamGradeTarget(examID, decision.AnswerID)
+		if err == sql.ErrNoRows {
+			utils.BadRequest(c, fmt.Sprintf("作答 %d 不属于该考试", decision.AnswerID))
+			return
+		}
+		if err != nil {
+			utils.InternalServerError(c, "查询作答失败")
+			return
+		}
+		if msg := validateExamGradeDecision(target, decision); msg != "" {
+			utils.BadRequest(c, msg)
+			return
+		}
+		targets[decision.AnswerID] = target
+		decisions = append(decisions, decision)
+	}
+
+	if req.AcceptAll {
+		proposed, err := listProposedExamGrades(examID)
+		if err != nil {
+			utils.InternalServerError(c, "查询评分建议失败")
+			return
+		}
+		for _, target := range proposed {
+			if _, ok := targets[target.AnswerID]; ok || target.Proposal.Confidence < req.MinConfidence {
+				continue
+			}
+			targets[target.AnswerID] = target
+			decisions = append(decisions, examGradeDecision{AnswerID: target.AnswerID, Action: examGradeActionAccept})
+		}
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		utils.InternalServerError(c, "开启事务失败")
+		return
+	}
+
+	userID := getCurrentUserID(c)
+	now := time.Now()
+	accepted, overridden := 0, 0
+	submissions := map[int64]bool{}
+	for _, decision := range decisions {
+		target := targets[decision.AnswerID]
+		status := examAIGradeAccepted
+		var finalScore float64
+		if decision.Action == examGradeActionAccept {
+			finalScore = target.Proposal.Score
+			accepted++
+		} else {
+			status = examAIGradeOverridden
+			finalScore = *decision.Score
+			overridden++
+		}
+
+		if _, err := tx.Exec(`
+			UPDATE exam_answers SET score_awarded = ?, ai_grade_status = ?, graded_by = ?, graded_at = ? WHERE id = ?
+		`, finalScore, status, userID, now, target.AnswerID); err != nil {
+			tx.Rollback()
+			utils.InternalServerError(c, "保存评分失败")
+			return
+		}
+
+		var previousScore, aiScore, proposalJSON interface{}
+		if target.ScoreAwarded.Valid {
+			previousScore = target.ScoreAwarded.Float64
+		}
+		if target.Proposal != nil {
+			aiScore = target.Proposal.Score
+			raw, _ := json.Marshal(target.Proposal)
+			proposalJSON = string(raw)
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO exam_grading_audit (exam_id, answer_id, user_id, action, previous_score, ai_score, final_score, proposal_json, note)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, examID, target.AnswerID, userID, decision.Action, previousScore, aiScore, finalScore, proposalJSON, strings.TrimSpace(decision.Note)); err != nil {
+			tx.Rollback()
+			utils.InternalServerError(c, "保存批改记录失败")
+			return
+		}
+		submissions[target.SubmissionID] = true
+	}
+
+	for submissionID := range submissions {
+		if _, err := tx.Exec(`
+			UPDATE exam_submissions
+			SET total_score = (SELECT MAX(COALESCE(SUM(score_awarded), 0), 0) FROM exam_answers WHERE submission_id = ?)
+			WHERE id = ?
+		`, submissionID, submissionID); err != nil {
+			tx.Rollback()
+			utils.InternalServerError(c, "更新总分失败")
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		utils.InternalServerError(c, "提交事务失败")
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"accepted":   accepted,
+		"overridden": overridden,
+	})
+}
+
+func loadExamGradeTarget(examID, answerID int64) (*examGradeTarget, error) {
+	target := &examGradeTarget{}
+	var proposal sql.NullString
+	err := database.DB.QueryRow(`
+		SELECT a.id, a.submission_id, q.type, q.score, a.score_awarded, COALESCE(a.ai_grade_status, ''), a.ai_grade
+		FROM exam_answers a
+		JOIN exam_submissions s ON s.id = a.submission_id
+		JOIN exam_questions q ON q.id = a.question_id
+		WHERE a.id = ? AND s.exam_id = ?
+	`, answerID, examID).Scan(&target.AnswerID, &target.SubmissionID, &target.Type, &target.MaxScore,
+		&target.ScoreAwarded, &target.Status, &proposal)
+	if err != nil {
+		return nil, err
+	}
+	target.Proposal = decodeExamGradeProposal(proposal)
+	return target, nil
+}
+
+func listProposedExamGrades(examID int64) ([]*examGradeTarget, error) {
+	rows, err := database.DB.Query(`
+		SELECT a.id, a.submission_id, q.type, q.score, a.score_awarded, a.ai_grade
+		FROM exam_answers a
+		JOIN exam_submissions s ON s.id = a.submission_id
+		JOIN exam_questions q ON q.id = a.question_id
+		WHERE s.exam_id = ? AND a.ai_grade_status = ?
+		ORDER BY a.id
+	`, examID, examAIGradeProposed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	targets := []*examGradeTarget{}
+	for rows.Next() {
+		target := &examGradeTarget{Status: examAIGradeProposed}
+		var proposal sql.NullString
+		if err := rows.Scan(&target.AnswerID, &target.SubmissionID, &target.Type, &target.MaxScore,
+			&target.ScoreAwarded, &proposal); err != nil {
+			return nil, err
+		}
+		if target.Proposal = decodeExamGradeProposal(proposal); target.Proposal != nil {
+			targets = append(targets, target)
+		}
+	}
+	return targets, rows.Err()
+}
+
+// validateExamGradeDecision 返回不合法的原因，合法时返回空字符串
+func validateExamGradeDecision(target *examGradeTarget, decision examGradeDecision) string {
+	if isObjectiveExamQuestion(target.Type) {
+		return fmt.Sprintf("作答 %d 是客观题，已自动判分", target.AnswerID)
+	}
+	if target.Type == "CODE" {
+		return fmt.Sprintf("作答 %d 是编程题，由评测结果判分", target.AnswerID)
+	}
+	switch decision.Action {
+	case examGradeActionAccept:
+		if target.Status != examAIGradeProposed || target.Proposal == nil {
+			return fmt.Sprintf("作答 %d 没有待确认的评分建议", target.AnswerID)
+		}
+	case examGradeActionOverride:
+		if decision.Score == nil || *decision.Score < 0 || *decision.Score > target.MaxScore {
+			return fmt.Sprintf("作答 %d 的分数须在 0 到 %g 之间", target.AnswerID, target.MaxScore)
+		}
+	default:
+		return fmt.Sprintf("作答 %d 的处理方式无效", target.AnswerID)
+	}
+	return ""
+}
+
+// RequeueExamGrading 重新为尚未确认的主观题作答生成评分建议，用于修改评分细则之后
+func RequeueExamGrading(c *gin.Context) {
+	examID, ok := parseInt64Param(c, c.Param("id"), "考试ID")
+	if !ok || !ensureExamGrader(c, examID) {
+		return
+	}
+	if !examAIGradingEnabled() {
+		utils.BadRequest(c, "AI 评分未启用")
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT a.id, q.type, COALESCE(a.student_answer, ''), q.rubric, q.reference_answer, COALESCE(q.answer, '')
+		FROM exam_answers a
+		JOIN exam_submissions s ON s.id = a.submission_id
+		JOIN exam_questions q ON q.id = a.question_id
+		WHERE s.exam_id = ? AND (a.ai_grade_status IS NULL OR a.ai_grade_status IN (?, ?, ?))
+	`, examID, examAIGradeProposed, examAIGradeSkipped, examAIGradeFailed)
+	if err != nil {
+		utils.InternalServerError(c, "查询作答失败")
+		return
+	}
+	answerIDs := []int64{}
+	for rows.Next() {
+		var answerID int64
+		var questionType, studentAnswer, answer string
+		var rubric, reference *string
+		if err := rows.Scan(&answerID, &questionType, &studentAnswer, &rubric, &reference, &answer); err != nil {
+			continue
+		}
+		if needsExamAIGrading(questionType, studentAnswer, rubric, examGradingReference(reference, answer)) {
+			answerIDs = append(answerIDs, answerID)
+		}
+	}
+	rows.Close()
+
+	queued := 0
+	for _, answerID := range answerIDs {
+		res, err := database.DB.Exec(`
+			UPDATE exam_answers
+			SET ai_grade_status = ?, ai_grade = NULL, ai_grade_error = NULL, ai_grade_attempts = 0, ai_grade_next_run_at = NULL
+			WHERE id = ? AND (ai_grade_status IS NULL OR ai_grade_status IN (?, ?, ?))
+		`, examAIGradePending, answerID, examAIGradeProposed, examAIGradeSkipped, examAIGradeFailed)
+		if err != nil {
+			utils.InternalServerError(c, "重新评分失败")
+			return
+		}
+		if affected, _ := res.RowsAffected(); affected > 0 {
+			queued++
+		}
+	}
+	if queued > 0 {
+		wakeExamGradingWorker()
+	}
+
+	utils.Success(c, gin.H{"queued": queued})
+}
+
+// ListExamGradingAudit 查看考试的批改记录
+func ListExamGradingAudit(c *gin.Context) {
+	examID, ok := parseInt64Param(c, c.Param("id"), "考试ID")
+	if !ok || !ensureExamGrader(c, examID) {
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT g.id, g.answer_id, g.user_id, COALESCE(u.username, ''), g.action,
+		       g.previous_score, g.ai_score, g.final_score, g.note, g.created_at
+		FROM exam_grading_audit g
+		LEFT JOIN users u ON u.id = g.user_id
+		WHERE g.exam_id = ?
+		ORDER BY g.created_at DESC, g.id DESC
+	`, examID)
+	if err != nil {
+		utils.InternalServerError(c, "查询批改记录失败")
+		return
+	}
+	defer rows.Close()
+
+	items := []gin.H{}
+	for rows.Next() {
+		var id, answerID, userID int64
+		var username, action, note string
+		var previousScore, aiScore sql.NullFloat64
+		var finalScore float64
+		var createdAt time.Time
+		if err := rows.Scan(&id, &answerID, &userID, &username, &action,
+			&previousScore, &aiScore, &finalScore, &note, &createdAt); err != nil {
+			continue
+		}
+		item := gin.H{
+			"id":         id,
+			"answerId":   answerID,
+			"userId":     userID,
+			"username":   username,
+			"action":     action,
+			"finalScore": finalScore,
+			"note":       note,
+			"createdAt":  createdAt,
+		}
+		if previousScore.Valid {
+			item["previousScore"] = previousScore.Float64
+		}
+		if aiScore.Valid {
+			item["aiScore"] = aiScore.Float64
+		}
+		items = append(items, item)
+	}
+
+	utils.Success(c, gin.H{"items": items})
+}
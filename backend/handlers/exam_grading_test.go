@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+)
+
+func withExamGradingTestDB(t *testing.T) {
+	t.Helper()
+	withExamCoachingTestDB(t)
+	seedTestDB(t,
+		`INSERT INTO courses (id, title, description, instructor_id) VALUES (1, '数据结构', '', 9)`,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (5, 'alice', 'x', 'STUDENT'), (6, 'bob', 'x', 'STUDENT'), (9, 'teacher', 'x', 'INSTRUCTOR')`,
+		`INSERT INTO course_enrollments (course_id, student_id) VALUES (1, 6)`,
+	)
+}
+
+func TestAddQuestionValidatesRubricPoints(t *testing.T) {
+	withExamGradingTestDB(t)
+	params := gin.Params{{Key: "id", Value: "1"}}
+
+	body := `{"type":"SHORT_ANSWER","stem":"简述栈的特点和应用","score":10,"orderIndex":5,
+		"rubric":"[{\"description\":\"说明后进先出\",\"points\":4},{\"description\":\"列举两个应用\",\"points\":4}]"}`
+	if w := performRAGRequest(AddQuestion, "INSTRUCTOR", 9, params, "/", body); w.Code != http.StatusBadRequest {
+		t.Fatalf("rubric points must add up to the question score, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestExamAIGradingProposalsReviewedInBulk(t *testing.T) {
+	withExamGradingTestDB(t)
+	newRAGModelTestServer(t, `{"criteria":[{"index":1,"score":4,"comment":"说明了后进先出"},{"index":2,"score":2}],"score":9,"rationale":"只举了一个应用","confidence":0.9}`)
+	params := gin.Params{{Key: "id", Value: "1"}}
+
+	body := `{"type":"SHORT_ANSWER","stem":"简述栈的特点和应用","score":10,"orderIndex":5,
+		"rubric":"[{\"description\":\"说明后进先出\",\"points\":4},{\"description\":\"列举两个应用\",\"points\":6}]",
+		"referenceAnswer":"后进先出；函数调用、表达式求值"}`
+	w := performRAGRequest(AddQuestion, "INSTRUCTOR", 9, params, "/", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("add question failed: %d %s", w.Code, w.Body.String())
+	}
+	questionID := int64(decodeResponseData(t, w.Body.Bytes())["id"].(float64))
+
+	submissions := map[int64]string{
+		5: fmt.Sprintf(`{"answers":[{"questionId":%d,"answer":"后进先出，用于函数调用"}]}`, questionID),
+		6: fmt.Sprintf(`{"answers":[{"questionId":4,"answer":""},{"questionId":%d,"answer":"后进先出，用于括号匹配"}]}`, questionID),
+	}
+	for studentID, body := range submissions {
+		if w := performRAGRequest(SubmitExam, "STUDENT", studentID, params, "/", body); w.Code != http.StatusOK {
+			t.Fatalf("submit exam failed: %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	// 未作答的简答题不排队，由教师直接批改
+	processed := 0
+	for runNextExamGradingJob() {
+		processed++
+	}
+	if processed != 2 {
+		t.Fatalf("expected two answers graded, got %d", processed)
+	}
+
+	if w := performRAGRequest(ListExamGrading, "STUDENT", 5, params, "/", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("students must not see grading proposals, got %d", w.Code)
+	}
+	w = performRAGRequest(ListExamGrading, "INSTRUCTOR", 9, params, "/?status=proposed", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list grading failed: %d %s", w.Code, w.Body.String())
+	}
+	items, _ := decodeResponseData(t, w.Body.Bytes())["items"].([]any)
+	if len(items) != 2 {
+		t.Fatalf("expected two proposals, got %v", items)
+	}
+	answerIDs := map[string]int64{}
+	for _, raw := range items {
+		item := raw.(map[string]any)
+		proposal := item["aiGrade"].(map[string]any)
+		// 总分取评分点之和，而不是模型给出的 9 分
+		if proposal["score"] != float64(6) || item["scoreAwarded"] != float64(0) {
+			t.Fatalf("proposal must not change the awarded score before review, got %v", item)
+		}
+		answerIDs[item["studentName"].(string)] = int64(item["answerId"].(float64))
+	}
+
+	review := fmt.Sprintf(`{"decisions":[{"answerId":%d,"action":"override","score":11}]}`, answerIDs["alice"])
+	if w := performRAGRequest(ReviewExamGrading, "INSTRUCTOR", 9, params, "/", review); w.Code != http.StatusBadRequest {
+		t.Fatalf("override above the question score must be rejected, got %d", w.Code)
+	}
+	review = fmt.Sprintf(`{"decisions":[{"answerId":%d,"action":"override","score":8,"note":"应用举例恰当"}],"acceptAll":true,"minConfidence":0.8}`, answerIDs["alice"])
+	w = performRAGRequest(ReviewExamGrading, "INSTRUCTOR", 9, params, "/", review)
+	if w.Code != http.StatusOK {
+		t.Fatalf("review grading failed: %d %s", w.Code, w.Body.String())
+	}
+	if data := decodeResponseData(t, w.Body.Bytes()); data["accepted"] != float64(1) || data["overridden"] != float64(1) {
+		t.Fatalf("expected one accepted and one overridden, got %v", data)
+	}
+
+	totals := map[int64]float64{}
+	rows, _ := database.DB.Query(`SELECT student_id, total_score FROM exam_submissions`)
+	for rows.Next() {
+		var studentID int64
+		var total float64
+		rows.Scan(&studentID, &total)
+		totals[studentID] = total
+	}
+	rows.Close()
+	if totals[5] != 8 || totals[6] != 6 {
+		t.Fatalf("submission totals must include reviewed scores, got %v", totals)
+	}
+
+	review = fmt.Sprintf(`{"decisions":[{"answerId":%d,"action":"accept"}]}`, answerIDs["bob"])
+	if w := performRAGRequest(ReviewExamGrading, "INSTRUCTOR", 9, params, "/", review); w.Code != http.StatusBadRequest {
+		t.Fatalf("an accepted proposal cannot be accepted twice, got %d", w.Code)
+	}
+
+	w = performRAGRequest(ListExamGradingAudit, "INSTRUCTOR", 9, params, "/", "")
+	audit, _ := decodeResponseData(t, w.Body.Bytes())["items"].([]any)
+	if len(audit) != 2 {
+		t.Fatalf("expected two audit records, got %v", audit)
+	}
+	for _, raw := range audit {
+		entry := raw.(map[string]any)
+		if entry["aiScore"] != float64(6) || entry["previousScore"] != float64(0) {
+			t.Fatalf("audit must keep the ai and previous scores, got %v", entry)
+		}
+		if entry["action"] == examGradeActionOverride && (entry["finalScore"] != float64(8) || entry["note"] != "应用举例恰当") {
+			t.Fatalf("unexpected override audit %v", entry)
+		}
+	}
+}
+
+func TestExamGradeProposalDroppedAfterTeacherOverride(t *testing.T) {
+	withExamGradingTestDB(t)
+	newRAGModelTestServer(t, `{"criteria":[],"score":3,"rationale":"未说明应用","confidence":0.9}`)
+	params := gin.Params{{Key: "id", Value: "1"}}
+
+	body := `{"type":"SHORT_ANSWER","stem":"简述队列的特点","score":10,"orderIndex":5,"referenceAnswer":"先进先出"}`
+	w := performRAGRequest(AddQuestion, "INSTRUCTOR", 9, params, "/", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("add question failed: %d %s", w.Code, w.Body.String())
+	}
+	questionID := int64(decodeResponseData(t, w.Body.Bytes())["id"].(float64))
+	submit := fmt.Sprintf(`{"answers":[{"questionId":%d,"answer":"先进先出"}]}`, questionID)
+	if w := performRAGRequest(SubmitExam, "STUDENT", 5, params, "/", submit); w.Code != http.StatusOK {
+		t.Fatalf("submit exam failed: %d %s", w.Code, w.Body.String())
+	}
+
+	job, err := claimExamGradingJob(time.Now())
+	if err != nil {
+		t.Fatalf("claim grading job: %v", err)
+	}
+	// 模型评分期间教师已直接改判
+	review := fmt.Sprintf(`{"decisions":[{"answerId":%d,"action":"override","score":10}]}`, job.AnswerID)
+	if w := performRAGRequest(ReviewExamGrading, "INSTRUCTOR", 9, params, "/", review); w.Code != http.StatusOK {
+		t.Fatalf("review grading failed: %d %s", w.Code, w.Body.String())
+	}
+	proposal, reason, err := processExamGradingJob(context.Background(), job)
+	if err != nil {
+		t.Fatalf("process grading job: %v", err)
+	}
+	saveExamGradeProposal(job.AnswerID, proposal, reason)
+	failExamGradingJob(job, errors.New("model unavailable"), time.Now())
+
+	var status string
+	var score float64
+	if err := database.DB.QueryRow(
+		`SELECT ai_grade_status, score_awarded FROM exam_answers WHERE id = ?`, job.AnswerID,
+	).Scan(&status, &score); err != nil {
+		t.Fatalf("load answer: %v", err)
+	}
+	if status != examAIGradeOverridden || score != 10 {
+		t.Fatalf("late grading result must not replace the teacher's decision, got %s %v", status, score)
+	}
+
+	// 已确认的作答不会被重新发起的评分拉回队列
+	if w := performRAGRequest(RequeueExamGrading, "INSTRUCTOR", 9, params, "/", ""); w.Code != http.StatusOK {
+		t.Fatalf("requeue grading failed: %d %s", w.Code, w.Body.String())
+	} else if data := decodeResponseData(t, w.Body.Bytes()); data["queued"] != float64(0) {
+		t.Fatalf("expected nothing requeued, got %v", data)
+	}
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+	"github.com/online-education-platform/backend/utils"
+	"go.uber.org/zap"
+)
+
+// ExamQuestionRuleRequest 抽题规则：从课程题库中按题型、知识点标签和难度随机抽取 Count 道题，
+// 条件为空表示不限；Score 为 0 时沿用题库分值
+type ExamQuestionRuleRequest struct {
+	Type       string  `json:"type"`
+	Tag        string  `json:"tag"`
+	Difficulty string  `json:"difficulty"`
+	Count      int     `json:"count" binding:"required"`
+	Score      float64 `json:"score"`
+	OrderIndex int     `json:"orderIndex"`
+}
+
+type examQuestionRule struct {
+	ID         int64     `json:"id"`
+	ExamID     int64     `json:"examId"`
+	Type       string    `json:"type"`
+	Tag        string    `json:"tag"`
+	Difficulty string    `json:"difficulty"`
+	Count      int       `json:"count"`
+	Score      float64   `json:"score"`
+	OrderIndex int       `json:"orderIndex"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// examQuestionTypes 考试和题库支持的题型，由 database.ExamQuestionTypes 生成
+var examQuestionTypes = func() map[string]bool {
+	types := make(map[string]bool, len(database.ExamQuestionTypes))
+	for _, questionType := range database.ExamQuestionTypes {
+		types[questionType] = true
+	}
+	return types
+}()
+
+// bankCandidatesQuery 返回符合规则条件的题库题目查询
+func bankCandidatesQuery(courseID int64, rule examQuestionRule) (string, []interface{}) {
+	query := `SELECT b.id FROM question_bank b WHERE b.course_id = ?`
+	args := []interface{}{courseID}
+	if rule.Type != "" {
+		query += ` AND b.type = ?`
+		args = append(args, rule.Type)
+	}
+	if rule.Difficulty != "" {
+		query += ` AND b.difficulty = ?`
+		args = append(args, rule.Difficulty)
+	}
+	if rule.Tag != "" {
+		query += ` AND EXISTS (SELECT 1 FROM question_bank_tags t WHERE t.question_id = b.id AND t.tag = ?)`
+		args = append(args, rule.Tag)
+	}
+	return query + ` ORDER BY b.id`, args
+}
+
+func loadExamQuestionRules(examID int64) ([]examQuestionRule, error) {
+	rows, err := database.DB.Query(`
+		SELECT id, exam_id, type, tag, difficulty, count, score, order_index, created_at
+		FROM exam_question_rules
+		WHERE exam_id = ?
+		ORDER BY order_index, id
+	`, examID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []examQuestionRule{}
+	for rows.Next() {
+		var rule examQuestionRule
+		if err := rows.Scan(&rule.ID, &rule.ExamID, &rule.Type, &rule.Tag, &rule.Difficulty,
+			&rule.Count, &rule.Score, &rule.OrderIndex, &rule.CreatedAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// examPapersStarted 已有学生拿到试卷或交卷后，抽题规则不能再修改，否则学生之间的试卷不可比
+func examPapersStarted(examID int64) bool {
+	var papers, submissions int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM exam_papers WHERE exam_id = ?`, examID).Scan(&papers)
+	database.DB.QueryRow(`SELECT COUNT(*) FROM exam_submissions WHERE exam_id = ?`, examID).Scan(&submissions)
+	return papers > 0 || submissions > 0
+}
+
+// ensureExamPaper 返回学生试卷中按规则抽取的题目 ID（按出题顺序），首次访问时生成。
+// 每条规则从题库中随机抽题，同一学生的试卷中不会出现重复的题库题目；考试没有抽题规则时返回空。
+// 题库题目在规则创建后被删掉时按剩余的题目抽取，不足的部分记录警告，不影响学生作答
+func ensureExamPaper(examID, courseID, studentID int64) ([]int64, error) {
+	questionIDs, err := loadExamPaper(database.DB.Query, examID, studentID)
+	if err != nil || len(questionIDs) > 0 {
+		return questionIDs, err
+	}
+	rules, err := loadExamQuestionRules(examID)
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 先登记抽卷，事务由此持有写锁：同一学生的并发请求在这里等待，之后读到已生成的试卷，不会各抽一份
+	if _, err := tx.Exec(`
+		INSERT OR IGNORE INTO exam_paper_draws (exam_id, student_id) VALUES (?, ?)
+	`, examID, studentID); err != nil {
+		return nil, err
+	}
+	if questionIDs, err = loadExamPaper(tx.Query, examID, studentID); err != nil || len(questionIDs) > 0 {
+		return questionIDs, err
+	}
+
+	picked := map[int64]bool{}
+	for _, rule := range rules {
+		query, args := bankCandidatesQuery(courseID, rule)
+		rows, err := tx.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		candidates := []int64{}
+		for rows.Next() {
+			var bankQuestionID int64
+			if err := rows.Scan(&bankQuestionID); err == nil && !picked[bankQuestionID] {
+				candidates = append(candidates, bankQuestionID)
+			}
+		}
+		rows.Close()
+		count := rule.Count
+		if len(candidates) < count {
+			utils.GetLogger().Warn("exam question rule has too few bank questions",
+				zap.Int64("examID", examID), zap.Int64("ruleID", rule.ID), zap.Int("count", rule.Count), zap.Int("available", len(candidates)))
+			count = len(candidates)
+		}
+
+		rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		for _, bankQuestionID := range candidates[:count] {
+			picked[bankQuestionID] = true
+			questionID, err := examQuestionForRule(tx, examID, bankQuestionID, rule)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := tx.Exec(`
+				INSERT INTO exam_papers (exam_id, student_id, question_id, order_index) VALUES (?, ?, ?, ?)
+			`, examID, studentID, questionID, len(questionIDs)+1); err != nil {
+				return nil, err
+			}
+			questionIDs = append(questionIDs, questionID)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return questionIDs, nil
+}
+
+// loadExamPaper query 为 database.DB.Query 或事务的 Query
+func loadExamPaper(query func(string, ...interface{}) (*sql.Rows, error), examID, studentID int64) ([]int64, error) {
+	rows, err := query(`
+		SELECT question_id FROM exam_papers WHERE exam_id = ? AND student_id = ? ORDER BY order_index
+	`, examID, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	questionIDs := []int64{}
+	for rows.Next() {
+		var questionID int64
+		if err := rows.Scan(&questionID); err != nil {
+			return nil, err
+		}
+		questionIDs = append(questionIDs, questionID)
+	}
+	return questionIDs, rows.Err()
+}
+
+// examQuestionForRule 同一规则抽到同一道题库题目的学生共用一份考试题目副本，便于按题统计
+func examQuestionForRule(tx *sql.Tx, examID, bankQuestionID int64, rule examQuestionRule) (int64, error) {
+	var questionID int64
+	err := tx.QueryRow(`
+		SELECT id FROM exam_questions WHERE exam_id = ? AND bank_question_id = ? AND rule_id = ?
+	`, examID, bankQuestionID, rule.ID).Scan(&questionID)
+	if err == nil {
+		return questionID, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+	return copyBankQuestionToExam(tx, examID, bankQuestionID, rule.ID, rule.Score, rule.OrderIndex)
+}
+
+// ListExamQuestionRules 获取考试的抽题规则及每条规则当前可抽的题目数
+func ListExamQuestionRules(c *gin.Context) {
+	examID, ok := parseInt64Param(c, c.Param("id"), "考试ID")
+	if !ok || !ensureExamManageable(c, examID, "权限不足") {
+		return
+	}
+	courseID, err := courseIDFromExamID(examID)
+	if err != nil {
+		utils.InternalServerError(c, "服务器错误")
+		return
+	}
+
+	rules, err := loadExamQuestionRules(examID)
+	if err != nil {
+		utils.InternalServerError(c, "查询抽题规则失败")
+		return
+	}
+	items := make([]gin.H, 0, len(rules))
+	for _, rule := range rules {
+		items = append(items, gin.H{
+			"rule":      rule,
+			"available": countBankCandidates(courseID, rule),
+		})
+	}
+
+	utils.Success(c, gin.H{
+		"rules":  items,
+		"locked": examPapersStarted(examID),
+	})
+}
+
+func countBankCandidates(courseID int64, rule examQuestionRule) int {
+	query, args := bankCandidatesQuery(courseID, rule)
+	var count int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM (`+query+`)`, args...).Scan(&count)
+	return count
+}
+
+// CreateExamQuestionRule 为考试添加抽题规则，题库中符合条件的题目须足够抽取
+func CreateExamQuestionRule(c *gin.Context) {
+	examID, ok := parseInt64Param(c, c.Param("id"), "考试ID")
+	if !ok || !ensureExamManageable(c, examID, "权限不足") {
+		return
+	}
+	courseID, err := courseIDFromExamID(examID)
+	if err != nil {
+		utils.InternalServerError(c, "服务器错误")
+		return
+	}
+
+	var req ExamQuestionRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Count <= 0 || req.Score < 0 {
+		utils.BadRequest(c, "请求参数错误")
+		return
+	}
+	difficulty, ok := normalizeQuestionDifficulty(req.Difficulty, true)
+	if !ok {
+		utils.BadRequest(c, "无效的难度")
+		return
+	}
+	questionType := strings.ToUpper(strings.TrimSpace(req.Type))
+	if questionType != "" && !examQuestionTypes[questionType] {
+		utils.BadRequest(c, "无效的题型")
+		return
+	}
+	if examPapersStarted(examID) {
+		utils.BadRequest(c, "已有学生开始作答，不能修改抽题规则")
+		return
+	}
+
+	rule := examQuestionRule{
+		ExamID:     examID,
+		Type:       questionType,
+		Tag:        strings.TrimSpace(req.Tag),
+		Difficulty: difficulty,
+		Count:      req.Count,
+		Score:      req.Score,
+		OrderIndex: req.OrderIndex,
+	}
+	if available := countBankCandidates(courseID, rule); available < rule.Count {
+		utils.BadRequest(c, fmt.Sprintf("题库中符合条件的题目只有 %d 道", available))
+		return
+	}
+
+	result, err := database.DB.Exec(`
+		INSERT INTO exam_question_rules (exam_id, type, tag, difficulty, count, score, order_index)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, examID, rule.Type, rule.Tag, rule.Difficulty, rule.Count, rule.Score, rule.OrderIndex)
+	if err != nil {
+		utils.InternalServerError(c, "添加抽题规则失败")
+		return
+	}
+	ruleID, _ := result.LastInsertId()
+
+	utils.Success(c, gin.H{"id": ruleID})
+}
+
+// DeleteExamQuestionRule 删除抽题规则
+func DeleteExamQuestionRule(c *gin.Context) {
+	examID, ok := parseInt64Param(c, c.Param("id"), "考试ID")
+	if !ok {
+		return
+	}
+	ruleID, ok := parseInt64Param(c, c.Param("rid"), "规则ID")
+	if !ok || !ensureExamManageable(c, examID, "权限不足") {
+		return
+	}
+	if examPapersStarted(examID) {
+		utils.BadRequest(c, "已有学生开始作答，不能修改抽题规则")
+		return
+	}
+
+	result, err := database.DB.Exec(`DELETE FROM exam_question_rules WHERE id = ? AND exam_id = ?`, ruleID, examID)
+	if err != nil {
+		utils.InternalServerError(c, "删除失败")
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		utils.NotFound(c, "抽题规则不存在")
+		return
+	}
+
+	utils.SuccessWithMessage(c, "删除成功", nil)
+}
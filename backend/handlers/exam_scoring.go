@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/online-education-platform/backend/models"
+)
+
+// 客观题评分规则
+const (
+	examScoringAllOrNothing = "all_or_nothing" // 与正确答案完全一致才得分
+	examScoringProportional = "proportional"   // 多选题按 (选对数 - 选错数) / 正确选项数 给分，最低 0 分；填空题按答对的空数给分；编程题按通过的测试用例数给分
+	examScoringPartial      = "partial"        // 有错选不得分，漏选得一半分
+)
+
+var examChoiceSeparators = regexp.MustCompile(`[,，、;；\s]+`)
+
+// normalizeExamScoring 校验客观题和编程题的评分规则：部分得分规则只适用于多选题（按比例得分也适用于填空题和编程题），
+// 答错倒扣分不能为负且不超过题目分值，编程题不倒扣分。返回写入数据库的规则和倒扣分，主观题都为空
+func normalizeExamScoring(req AddQuestionRequest) (string, float64, error) {
+	policy := strings.TrimSpace(req.ScoringPolicy)
+	if !isAutoGradedExamQuestion(req.Type) {
+		if (policy != "" && policy != examScoringAllOrNothing) || req.WrongPenalty != 0 {
+			return "", 0, errors.New("评分规则只适用于客观题")
+		}
+		return "", 0, nil
+	}
+	if req.Type == "CODE" && req.WrongPenalty != 0 {
+		return "", 0, errors.New("编程题不支持答错倒扣分")
+	}
+	if req.WrongPenalty < 0 || req.WrongPenalty > req.Score {
+		return "", 0, errors.New("答错倒扣分须在 0 到题目分值之间")
+	}
+
+	switch policy {
+	case "", examScoringAllOrNothing:
+		policy = examScoringAllOrNothing
+	case examScoringProportional:
+		if req.Type != "MULTIPLE_CHOICE" && req.Type != "FILL_BLANK" && req.Type != "CODE" {
+			return "", 0, errors.New("按比例得分只适用于多选题、填空题和编程题")
+		}
+	case examScoringPartial:
+		if req.Type != "MULTIPLE_CHOICE" {
+			return "", 0, errors.New("漏选得一半分只适用于多选题")
+		}
+	default:
+		return "", 0, errors.New("无效的评分规则")
+	}
+	return policy, req.WrongPenalty, nil
+}
+
+// scoreObjectiveAnswer 按题目的评分规则给客观题判分，两边答案都先经 normalizeStoredExamAnswer 归一化，
+// 选择题比较选项集合，与作答顺序和分隔符无关。未作答得 0 分，答错且设置了倒扣分时得负分
+func scoreObjectiveAnswer(question models.ExamQuestion, studentAnswer string) float64 {
+	if strings.TrimSpace(normalizeStoredExamAnswer(studentAnswer)) == "" {
+		return 0
+	}
+
+	credit := 0.0
+	switch question.Type {
+	case "TRUE_FALSE":
+		if normalizeTrueFalseAnswer(studentAnswer) == normalizeTrueFalseAnswer(question.Answer) {
+			credit = 1
+		}
+	case "SINGLE_CHOICE", "MULTIPLE_CHOICE":
+		var options []string
+		if question.Options != nil {
+			options = decodeExamOptions(*question.Options)
+		}
+		correct := examChoiceSet(question.Answer, options)
+		chosen := examChoiceSet(studentAnswer, options)
+		policy := examScoringAllOrNothing
+		if question.Type == "MULTIPLE_CHOICE" && question.ScoringPolicy != "" {
+			policy = question.ScoringPolicy
+		}
+		credit = choiceCredit(policy, correct, chosen)
+	case "FILL_BLANK":
+		credit = fillBlankCredit(question, studentAnswer)
+		if credit < 1 && question.ScoringPolicy != examScoringProportional {
+			credit = 0
+		}
+	case "NUMERIC":
+		if numericAnswerCorrect(question, studentAnswer) {
+			credit = 1
+		}
+	}
+
+	if credit <= 0 {
+		return -question.WrongPenalty
+	}
+	return math.Round(question.Score*credit*100) / 100
+}
+
+// choiceCredit 返回选择题的得分比例
+func choiceCredit(policy string, correct, chosen map[string]bool) float64 {
+	if len(correct) == 0 {
+		return 0
+	}
+	hits, wrongs := 0, 0
+	for choice := range chosen {
+		if correct[choice] {
+			hits++
+		} else {
+			wrongs++
+		}
+	}
+
+	switch {
+	case hits == len(correct) && wrongs == 0:
+		return 1
+	case policy == examScoringProportional:
+		return math.Max(0, float64(hits-wrongs)/float64(len(correct)))
+	case policy == examScoringPartial && wrongs == 0 && hits > 0:
+		return 0.5
+	}
+	return 0
+}
+
+// examChoiceSet 把选择题答案解析为选项字母集合。答案可以是选项字母（"A,C"、"AC"、"C、A"），
+// 也可以是选项文本或其 JSON 数组（种子数据和 AI 导入的题目按文本存储）；无法对应到选项的部分按原文保留
+func examChoiceSet(raw string, options []string) map[string]bool {
+	text := strings.TrimSpace(normalizeStoredExamAnswer(raw))
+	var tokens []string
+	if err := json.Unmarshal([]byte(text), &tokens); err != nil {
+		tokens = examChoiceSeparators.Split(text, -1)
+	}
+
+	set := map[string]bool{}
+	if indexes, ok := parseChoiceLetters(strings.Join(tokens, ","), len(options)); ok && !matchesOptionText(tokens, options) {
+		for _, index := range indexes {
+			set[choiceLetter(index)] = true
+		}
+		return set
+	}
+	for _, token := range tokens {
+		token = strings.TrimSpace(token)
+		if token == "" {
+			continue
+		}
+		key := "?" + token
+		for i, option := range options {
+			if strings.TrimSpace(option) == token {
+				key = choiceLetter(i)
+				break
+			}
+		}
+		set[key] = true
+	}
+	return set
+}
+
+func choiceLetter(index int) string {
+	return string(rune('A' + index))
+}
+
+func matchesOptionText(tokens, options []string) bool {
+	for _, token := range tokens {
+		for _, option := range options {
+			if strings.TrimSpace(token) != "" && strings.TrimSpace(option) == strings.TrimSpace(token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseChoiceLetters 解析逗号分隔或连写的选项字母（"A,C" 或 "AC"），返回选项下标；
+// 含有超出 count 个选项范围的字符时返回 false
+func parseChoiceLetters(answer string, count int) ([]int, bool) {
+	indexes := []int{}
+	for _, part := range strings.Split(answer, ",") {
+		letters := strings.ToUpper(strings.TrimSpace(part))
+		if letters == "" {
+			continue
+		}
+		for _, letter := range letters {
+			if letter < 'A' || int(letter-'A') >= count {
+				return nil, false
+			}
+			indexes = append(indexes, int(letter-'A'))
+		}
+	}
+	return indexes, len(indexes) > 0
+}
+
+// normalizeTrueFalseAnswer 统一判断题答案的写法：界面提交 true/false，种子数据和导入题目用“正确/错误”
+func normalizeTrueFalseAnswer(raw string) string {
+	text := strings.ToLower(strings.TrimSpace(normalizeStoredExamAnswer(raw)))
+	switch text {
+	case "true", "t", "正确", "对", "是", "√", "yes":
+		return "true"
+	case "false", "f", "错误", "错", "否", "×", "no":
+		return "false"
+	}
+	return text
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+	"github.com/online-education-platform/backend/models"
+)
+
+func TestScoreObjectiveAnswer(t *testing.T) {
+	options := `["数组","链表","栈","队列"]`
+	multi := func(policy string, penalty float64) models.ExamQuestion {
+		return models.ExamQuestion{Type: "MULTIPLE_CHOICE", Options: &options, Answer: "A,C", Score: 4, ScoringPolicy: policy, WrongPenalty: penalty}
+	}
+	cases := []struct {
+		name     string
+		question models.ExamQuestion
+		answer   string
+		want     float64
+	}{
+		{"order and separator do not matter", multi(examScoringAllOrNothing, 0), "CA", 4},
+		{"all or nothing rejects missed choice", multi(examScoringAllOrNothing, 0), "A", 0},
+		{"proportional counts hits", multi(examScoringProportional, 0), "A", 2},
+		{"proportional subtracts wrong choices", multi(examScoringProportional, 0), "A,B,C", 2},
+		{"proportional without net hits is penalised", multi(examScoringProportional, 1), "B,D", -1},
+		{"partial gives half for missed choice", multi(examScoringPartial, 0), "C", 2},
+		{"partial gives zero for wrong choice", multi(examScoringPartial, 0), "A,B", 0},
+		{"negative marking on wrong answer", multi(examScoringAllOrNothing, 1.5), "B", -1.5},
+		{"blank answer is never penalised", multi(examScoringAllOrNothing, 1.5), "", 0},
+		{"option text answer matches letters", models.ExamQuestion{Type: "MULTIPLE_CHOICE", Options: &options, Answer: `["栈","数组"]`, Score: 4}, "A,C", 4},
+		{"stored json string answer", models.ExamQuestion{Type: "SINGLE_CHOICE", Options: &options, Answer: `"链表"`, Score: 2}, "B", 2},
+		{"true false synonyms", models.ExamQuestion{Type: "TRUE_FALSE", Answer: `"正确"`, Score: 2}, "true", 2},
+	}
+	for _, tc := range cases {
+		if got := scoreObjectiveAnswer(tc.question, tc.answer); got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestSubmitExamAppliesScoringPolicies(t *testing.T) {
+	withExamGradingTestDB(t)
+	params := gin.Params{{Key: "id", Value: "1"}}
+
+	invalid := `{"type":"SINGLE_CHOICE","stem":"栈的特点","options":"[\"先进先出\",\"后进先出\"]","answer":"B","score":2,"scoringPolicy":"partial"}`
+	if w := performRAGRequest(AddQuestion, "INSTRUCTOR", 9, params, "/", invalid); w.Code != http.StatusBadRequest {
+		t.Fatalf("partial credit must be limited to multiple choice, got %d", w.Code)
+	}
+	invalid = `{"type":"TRUE_FALSE","stem":"栈是线性表","answer":"true","score":2,"wrongPenalty":3}`
+	if w := performRAGRequest(AddQuestion, "INSTRUCTOR", 9, params, "/", invalid); w.Code != http.StatusBadRequest {
+		t.Fatalf("penalty above the question score must be rejected, got %d", w.Code)
+	}
+
+	questions := []string{
+		`{"type":"MULTIPLE_CHOICE","stem":"哪些是线性结构","options":"[\"栈\",\"树\",\"队列\",\"图\"]","answer":"A,C","score":4,"orderIndex":5,"scoringPolicy":"partial"}`,
+		`{"type":"TRUE_FALSE","stem":"队列先进先出","answer":"true","score":2,"orderIndex":6,"wrongPenalty":1}`,
+	}
+	ids := []int64{}
+	for _, body := range questions {
+		w := performRAGRequest(AddQuestion, "INSTRUCTOR", 9, params, "/", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("add question failed: %d %s", w.Code, w.Body.String())
+		}
+		ids = append(ids, int64(decodeResponseData(t, w.Body.Bytes())["id"].(float64)))
+	}
+
+	body := fmt.Sprintf(`{"answers":[{"questionId":%d,"answer":"C"},{"questionId":%d,"answer":"false"}]}`, ids[0], ids[1])
+	w := performRAGRequest(SubmitExam, "STUDENT", 6, params, "/", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("submit exam failed: %d %s", w.Code, w.Body.String())
+	}
+	if total := decodeResponseData(t, w.Body.Bytes())["totalScore"]; total != float64(1) {
+		t.Fatalf("expected half credit minus the penalty, got %v", total)
+	}
+
+	var penalty float64
+	database.DB.QueryRow(`SELECT score_awarded FROM exam_answers WHERE question_id = ?`, ids[1]).Scan(&penalty)
+	if penalty != -1 {
+		t.Fatalf("wrong true/false answer must be penalised, got %v", penalty)
+	}
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+	"github.com/online-education-platform/backend/models"
+)
+
+// examShuffleEnabled EXAM_SHUFFLE=off 时所有学生使用相同的题目顺序和选项顺序
+func examShuffleEnabled() bool {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("EXAM_SHUFFLE"))) != "off"
+}
+
+// examShuffle 学生个人试卷布局：Questions 为题目显示顺序，Options 记录选择题每个显示位置对应的原选项下标。
+// 布局由随机种子生成后保存，交卷时据此把学生看到的选项字母还原为原始选项再判分。
+// 方法均可在 nil 上调用，表示没有打乱
+type examShuffle struct {
+	Seed      int64           `json:"-"`
+	Questions []int64         `json:"questions"`
+	Options   map[int64][]int `json:"options"`
+}
+
+func loadExamShuffle(examID, studentID int64) (*examShuffle, error) {
+	var seed int64
+	var layout string
+	err := database.DB.QueryRow(`
+		SELECT seed, layout_json FROM exam_shuffles WHERE exam_id = ? AND student_id = ?
+	`, examID, studentID).Scan(&seed, &layout)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	shuffle := &examShuffle{Seed: seed}
+	if err := json.Unmarshal([]byte(layout), shuffle); err != nil {
+		return nil, err
+	}
+	if shuffle.Options == nil {
+		shuffle.Options = map[int64][]int{}
+	}
+	return shuffle, nil
+}
+
+// examShufflesStarted 已有学生生成了试卷布局
+func examShufflesStarted(examID int64) bool {
+	var count int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM exam_shuffles WHERE exam_id = ?`, examID).Scan(&count)
+	return count > 0
+}
+
+// sameExamOptions 题型和选项内容都没有变化
+func sameExamOptions(oldType string, oldOptions sql.NullString, newType string, newOptions *string) bool {
+	if oldType != newType {
+		return false
+	}
+	var before, after []string
+	if oldOptions.Valid {
+		before = decodeExamOptions(oldOptions.String)
+	}
+	if newOptions != nil {
+		after = decodeExamOptions(*newOptions)
+	}
+	if len(before) != len(after) {
+		return false
+	}
+	for i := range before {
+		if before[i] != after[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ensureExamShuffle 返回学生的试卷布局，首次访问时生成。固定题目和按规则抽取的题目各自打乱，
+// 抽取的题目仍排在固定题目之后；布局生成后教师新增的题目会补进布局
+func ensureExamShuffle(examID, studentID int64, fixed, drawn []models.ExamQuestion) (*examShuffle, error) {
+	shuffle, err := loadExamShuffle(examID, studentID)
+	if err != nil {
+		return nil, err
+	}
+	questions := append(append([]models.ExamQuestion{}, fixed...), drawn...)
+
+	if shuffle == nil {
+		shuffle = newExamShuffle(rand.Int64(), fixed, drawn)
+		layout, err := json.Marshal(shuffle)
+		if err != nil {
+			return nil, err
+		}
+		result, err := database.DB.Exec(`
+			INSERT OR IGNORE INTO exam_shuffles (exam_id, student_id, seed, layout_json) VALUES (?, ?, ?, ?)
+		`, examID, studentID, shuffle.Seed, string(layout))
+		if err != nil {
+			return nil, err
+		}
+		// 同一学生的并发请求已经生成了布局，以先写入的为准
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return loadExamShuffle(examID, studentID)
+		}
+		return shuffle, nil
+	}
+
+	if shuffle.extend(questions) {
+		layout, err := json.Marshal(shuffle)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := database.DB.Exec(`
+			UPDATE exam_shuffles SET layout_json = ?, updated_at = ? WHERE exam_id = ? AND student_id = ?
+		`, string(layout), time.Now(), examID, studentID); err != nil {
+			return nil, err
+		}
+	}
+	return shuffle, nil
+}
+
+func newExamShuffle(seed int64, fixed, drawn []models.ExamQuestion) *examShuffle {
+	shuffle := &examShuffle{Seed: seed, Options: map[int64][]int{}}
+	rng := rand.New(rand.NewPCG(uint64(seed), 0))
+	for _, group := range [][]models.ExamQuestion{fixed, drawn} {
+		ids := make([]int64, 0, len(group))
+		for _, question := range group {
+			ids = append(ids, question.ID)
+		}
+		rng.Shuffle(len(ids), func(i, j int) { ids[i], ids[j] = ids[j], ids[i] })
+		shuffle.Questions = append(shuffle.Questions, ids...)
+	}
+	shuffle.extend(append(append([]models.ExamQuestion{}, fixed...), drawn...))
+	return shuffle
+}
+
+// extend 把布局中还没有的题目追加到末尾，并为还没有选项顺序的选择题生成顺序，返回布局是否变化。
+// 已有的选项顺序不再改变（学生已经按它作答）；每道题的选项顺序只由种子和题目 ID 决定
+func (s *examShuffle) extend(questions []models.ExamQuestion) bool {
+	known := make(map[int64]bool, len(s.Questions))
+	for _, questionID := range s.Questions {
+		known[questionID] = true
+	}
+
+	changed := false
+	for _, question := range questions {
+		if !known[question.ID] {
+			s.Questions = append(s.Questions, question.ID)
+			changed = true
+		}
+		if (question.Type != "SINGLE_CHOICE" && question.Type != "MULTIPLE_CHOICE") || question.Options == nil {
+			continue
+		}
+		count := len(decodeExamOptions(*question.Options))
+		if _, ok := s.Options[question.ID]; ok || count < 2 {
+			continue
+		}
+		rng := rand.New(rand.NewPCG(uint64(s.Seed), uint64(question.ID)))
+		s.Options[question.ID] = rng.Perm(count)
+		changed = true
+	}
+	return changed
+}
+
+// position 返回题目在学生试卷中的位置，不在布局中的题目排在最后
+func (s *examShuffle) position(questionID int64) int {
+	if s == nil {
+		return 0
+	}
+	for i, id := range s.Questions {
+		if id == questionID {
+			return i
+		}
+	}
+	return len(s.Questions)
+}
+
+// apply 按学生的布局排列题目并打乱选项
+func (s *examShuffle) apply(questions []models.ExamQuestion) []models.ExamQuestion {
+	if s == nil {
+		return questions
+	}
+	result := make([]models.ExamQuestion, len(questions))
+	copy(result, questions)
+	sort.SliceStable(result, func(i, j int) bool {
+		return s.position(result[i].ID) < s.position(result[j].ID)
+	})
+	for i := range result {
+		if result[i].Options != nil {
+			options := s.displayOptions(result[i].ID, *result[i].Options)
+			result[i].Options = &options
+		}
+	}
+	return result
+}
+
+// sortAnswersByShuffle 把答卷详情按学生试卷中的题目顺序排列
+func sortAnswersByShuffle(answers []gin.H, shuffle *examShuffle) {
+	if shuffle == nil {
+		return
+	}
+	sort.SliceStable(answers, func(i, j int) bool {
+		return shuffle.position(answers[i]["questionId"].(int64)) < shuffle.position(answers[j]["questionId"].(int64))
+	})
+}
+
+// displayOptions 返回学生看到的选项 JSON
+func (s *examShuffle) displayOptions(questionID int64, raw string) string {
+	order := s.optionOrder(questionID)
+	options := decodeExamOptions(raw)
+	if order == nil || len(options) != len(order) {
+		return raw
+	}
+	shuffled := make([]string, len(order))
+	for i, original := range order {
+		shuffled[i] = options[original]
+	}
+	encoded, err := json.Marshal(shuffled)
+	if err != nil {
+		return raw
+	}
+	return string(encoded)
+}
+
+// canonicalAnswer 把学生按打乱后的选项作答的字母还原为原始选项字母
+func (s *examShuffle) canonicalAnswer(questionID int64, answer string) string {
+	order := s.optionOrder(questionID)
+	if order == nil {
+		return answer
+	}
+	return remapChoiceLetters(answer, len(order), func(shown int) int { return order[shown] })
+}
+
+// displayAnswer 把原始选项字母转为学生试卷上的字母
+func (s *examShuffle) displayAnswer(questionID int64, answer string) string {
+	order := s.optionOrder(questionID)
+	if order == nil {
+		return answer
+	}
+	shown := make([]int, len(order))
+	for i, original := range order {
+		shown[original] = i
+	}
+	return remapChoiceLetters(answer, len(order), func(original int) int { return shown[original] })
+}
+
+func (s *examShuffle) optionOrder(questionID int64) []int {
+	if s == nil {
+		return nil
+	}
+	return s.Options[questionID]
+}
+
+// remapChoiceLetters 按 mapping 转换选项字母，结果按字母排序并以逗号分隔；
+// 不是合法选项字母的答案（如按选项文本存储的答案）原样返回
+func remapChoiceLetters(answer string, count int, mapping func(int) int) string {
+	indexes, ok := parseChoiceLetters(answer, count)
+	if !ok {
+		return answer
+	}
+	for i, index := range indexes {
+		indexes[i] = mapping(index)
+	}
+	sort.Ints(indexes)
+
+	letters := make([]string, len(indexes))
+	for i, index := range indexes {
+		letters[i] = choiceLetter(index)
+	}
+	return strings.Join(letters, ",")
+}
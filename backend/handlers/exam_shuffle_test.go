@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+)
+
+// shownLetter 返回选项在学生试卷上的字母
+func shownLetter(t *testing.T, question map[string]any, option string) string {
+	t.Helper()
+	var options []string
+	json.Unmarshal([]byte(question["options"].(string)), &options)
+	for i, text := range options {
+		if text == option {
+			return string(rune('A' + i))
+		}
+	}
+	t.Fatalf("option %q not found in %v", option, question["options"])
+	return ""
+}
+
+func studentExamQuestions(t *testing.T, studentID int64) (map[string]any, []any) {
+	t.Helper()
+	w := performRAGRequest(GetExam, "STUDENT", studentID, gin.Params{{Key: "id", Value: "1"}}, "/", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("get exam failed: %d %s", w.Code, w.Body.String())
+	}
+	data := decodeResponseData(t, w.Body.Bytes())
+	questions, _ := data["questions"].([]any)
+	return data, questions
+}
+
+func TestRemapChoiceLetters(t *testing.T) {
+	shuffle := &examShuffle{Options: map[int64][]int{7: {2, 0, 3, 1}}}
+	// 学生看到的 A、C 分别是原来的 C、D
+	if got := shuffle.canonicalAnswer(7, "C,A"); got != "C,D" {
+		t.Fatalf("expected C,D, got %q", got)
+	}
+	if got := shuffle.displayAnswer(7, "C,D"); got != "A,C" {
+		t.Fatalf("expected A,C, got %q", got)
+	}
+	if got := shuffle.canonicalAnswer(7, "后进先出"); got != "后进先出" {
+		t.Fatalf("text answers must be kept, got %q", got)
+	}
+	if got := (*examShuffle)(nil).canonicalAnswer(7, "B"); got != "B" {
+		t.Fatalf("no shuffle must keep the answer, got %q", got)
+	}
+}
+
+func TestExamShuffleRemapsAnswersPerStudent(t *testing.T) {
+	withQuestionBankTestDB(t)
+	params := gin.Params{{Key: "id", Value: "1"}}
+
+	body := `{"type":"MULTIPLE_CHOICE","stem":"哪些结构支持随机访问或后进先出","options":"[\"数组\",\"链表\",\"栈\",\"队列\"]","answer":"A,C","score":4,"orderIndex":5}`
+	w := performRAGRequest(AddQuestion, "INSTRUCTOR", 9, params, "/", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("add question failed: %d %s", w.Code, w.Body.String())
+	}
+	questionID := decodeResponseData(t, w.Body.Bytes())["id"].(float64)
+
+	data, questions := studentExamQuestions(t, 6)
+	if data["shuffled"] != true || len(questions) != 5 {
+		t.Fatalf("expected a shuffled paper with 5 questions, got %v", data)
+	}
+	_, again := studentExamQuestions(t, 6)
+	for i := range questions {
+		first, second := questions[i].(map[string]any), again[i].(map[string]any)
+		if first["id"] != second["id"] || first["options"] != second["options"] {
+			t.Fatalf("paper layout must be stable across requests, got %v then %v", first, second)
+		}
+	}
+
+	var multi map[string]any
+	order := []float64{}
+	for _, raw := range questions {
+		question := raw.(map[string]any)
+		order = append(order, question["id"].(float64))
+		if question["id"] == questionID {
+			multi = question
+		}
+	}
+	shown := []string{shownLetter(t, multi, "栈"), shownLetter(t, multi, "数组")}
+	body = fmt.Sprintf(`{"answers":[{"questionId":%d,"answer":%q},{"questionId":4,"answer":"函数调用"}]}`, int64(questionID), strings.Join(shown, ","))
+	w = performRAGRequest(SubmitExam, "STUDENT", 6, params, "/", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("submit exam failed: %d %s", w.Code, w.Body.String())
+	}
+	submissionID := int64(decodeResponseData(t, w.Body.Bytes())["submissionId"].(float64))
+
+	var stored string
+	var awarded float64
+	database.DB.QueryRow(`SELECT student_answer, score_awarded FROM exam_answers WHERE question_id = ?`, int64(questionID)).Scan(&stored, &awarded)
+	if stored != "A,C" || awarded != 4 {
+		t.Fatalf("answer must be remapped to the original options before grading, got %q for %v", stored, awarded)
+	}
+
+	w = performRAGRequest(GetExamSubmissionDetail, "INSTRUCTOR", 9, gin.Params{{Key: "id", Value: fmt.Sprint(submissionID)}}, "/", "")
+	detail := decodeResponseData(t, w.Body.Bytes())
+	answers, _ := detail["answers"].([]any)
+	if detail["shuffled"] != true || len(answers) != 2 {
+		t.Fatalf("unexpected submission detail %v", detail)
+	}
+	position := map[float64]int{}
+	for i, id := range order {
+		position[id] = i
+	}
+	first, second := answers[0].(map[string]any), answers[1].(map[string]any)
+	if position[first["questionId"].(float64)] > position[second["questionId"].(float64)] {
+		t.Fatalf("detail must follow the student's question order %v, got %v", order, answers)
+	}
+	for _, raw := range answers {
+		answer := raw.(map[string]any)
+		if answer["questionId"] != questionID {
+			continue
+		}
+		want := []string{shown[0], shown[1]}
+		sort.Strings(want)
+		if answer["options"] != multi["options"] || answer["studentAnswer"] != strings.Join(want, ",") || answer["correctAnswer"] != strings.Join(want, ",") {
+			t.Fatalf("detail must show the student's view, got %v", answer)
+		}
+	}
+
+	t.Setenv("EXAM_SHUFFLE", "off")
+	data, questions = studentExamQuestions(t, 5)
+	if data["shuffled"] != false || questions[len(questions)-1].(map[string]any)["options"] != `["数组","链表","栈","队列"]` {
+		t.Fatalf("shuffling disabled must keep the original layout, got %v", questions)
+	}
+	// 已有布局的学生仍按自己的布局作答，交卷时的还原才对得上
+	_, again = studentExamQuestions(t, 6)
+	for i, raw := range again {
+		if raw.(map[string]any)["id"] != order[i] {
+			t.Fatalf("existing layout must still be applied with shuffling disabled, got %v want order %v", again, order)
+		}
+	}
+}
+
+func TestExamOptionsLockedOnceLayoutsExist(t *testing.T) {
+	withQuestionBankTestDB(t)
+	qparams := gin.Params{{Key: "id", Value: "1"}, {Key: "qid", Value: "1"}}
+	edit := func(options string) int {
+		body := fmt.Sprintf(`{"type":"SINGLE_CHOICE","stem":"栈的存取规则是什么？","options":%q,"answer":"B","score":10,"orderIndex":1}`, options)
+		return performRAGRequest(UpdateQuestion, "INSTRUCTOR", 9, qparams, "/", body).Code
+	}
+	if code := edit(`["先进先出","后进先出","随机存取"]`); code != http.StatusOK {
+		t.Fatalf("options must be editable before any student opens the exam, got %d", code)
+	}
+
+	studentExamQuestions(t, 5)
+	if code := edit(`["先进先出","后进先出"]`); code != http.StatusBadRequest {
+		t.Fatalf("options must be locked once a student has a layout, got %d", code)
+	}
+	if code := edit(`["先进先出","后进先出","随机存取"]`); code != http.StatusOK {
+		t.Fatalf("editing the stem must still be allowed, got %d", code)
+	}
+}
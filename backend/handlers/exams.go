@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"database/sql"
+	"math"
 	"strconv"
 	"time"
 
@@ -12,6 +13,7 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
 )
 
 // CreateExamRequest 创建考试请求
@@ -24,12 +26,23 @@ type CreateExamRequest struct {
 
 // AddQuestionRequest 添加题目请求
 type AddQuestionRequest struct {
-	Type       string  `json:"type" binding:"required"` // SINGLE_CHOICE, MULTIPLE_CHOICE, TRUE_FALSE, SHORT_ANSWER
+	Type       string  `json:"type" binding:"required"` // SINGLE_CHOICE, MULTIPLE_CHOICE, TRUE_FALSE, SHORT_ANSWER, FILL_BLANK, NUMERIC, CODE
 	Stem       string  `json:"stem" binding:"required"`
 	Options    *string `json:"options"` // JSON字符串
-	Answer     string  `json:"answer"`  // JSON字符串（简答题可为空）
+	Answer     string  `json:"answer"`  // JSON字符串（简答题可为空；填空题、数值题和编程题的格式见 normalizeExamAnswerSpec）
 	Score      float64 `json:"score" binding:"required"`
 	OrderIndex int     `json:"orderIndex"`
+	// Rubric 主观题评分细则，JSON 数组：[{"description":"评分点","points":分值}]，分值之和须等于题目分值
+	Rubric          *string `json:"rubric"`
+	ReferenceAnswer *string `json:"referenceAnswer"`
+	// Target 题目写入位置：exam（默认，只加入本场考试）、bank（只加入课程题库）、both（存入题库并加入本场考试）
+	Target     string   `json:"target"`
+	Difficulty string   `json:"difficulty"` // 题库难度：easy / medium / hard，默认 medium
+	Tags       []string `json:"tags"`       // 题库知识点标签
+	// ScoringPolicy 客观题评分规则：all_or_nothing（默认）、proportional、partial，后两者只适用于多选题；
+	// WrongPenalty 答错倒扣的分数，0 表示不倒扣
+	ScoringPolicy string  `json:"scoringPolicy"`
+	WrongPenalty  float64 `json:"wrongPenalty"`
 }
 
 // SubmitExamRequest 提交答卷请求
@@ -206,7 +219,8 @@ func GetExam(c *gin.Context) {
 		return
 	}
 	role, _ := c.Get("role")
-	if _, ok := ensureExamAccessible(c, examID, "没有权限访问该考试"); !ok {
+	courseID, ok := ensureExamAccessible(c, examID, "没有权限访问该考试")
+	if !ok {
 		return
 	}
 
@@ -229,9 +243,22 @@ func GetExam(c *gin.Context) {
 		return
 	}
 
+	// 按规则抽题的考试，学生在考试开始后拿到自己的随机试卷
+	var paper []int64
+	started := role == "STUDENT" && !time.Now().Before(exam.StartTime)
+	if started {
+		paper, err = ensureExamPaper(examID, courseID, getCurrentUserID(c))
+		if err != nil {
+			utils.GetLogger().Error("generate exam paper failed", zap.Int64("examID", examID), zap.Error(err))
+			utils.InternalServerError(c, "生成试卷失败")
+			return
+		}
+	}
+
 	// 获取题目列表
 	rows, err := database.DB.Query(`
-		SELECT id, exam_id, type, stem, options, answer, score, order_index
+		SELECT id, exam_id, type, stem, options, answer, score, order_index, rubric, reference_answer, rule_id,
+		       scoring_policy, wrong_penalty
 		FROM exam_questions
 		WHERE exam_id = ?
 		ORDER BY order_index
@@ -244,30 +271,79 @@ func GetExam(c *gin.Context) {
 	defer rows.Close()
 
 	questions := []models.ExamQuestion{}
+	drawn := map[int64]models.ExamQuestion{}
 	for rows.Next() {
 		var question models.ExamQuestion
+		var ruleID sql.NullInt64
 		err := rows.Scan(
 			&question.ID, &question.ExamID, &question.Type,
 			&question.Stem, &question.Options, &question.Answer,
-			&question.Score, &question.OrderIndex,
+			&question.Score, &question.OrderIndex, &question.Rubric, &question.ReferenceAnswer, &ruleID,
+			&question.ScoringPolicy, &question.WrongPenalty,
 		)
 		if err != nil {
 			continue
 		}
 		question.Answer = normalizeStoredExamAnswer(question.Answer)
+		describeExamAnswerSpec(&question)
 
-		// 如果是学生查看，不返回答案
+		// 如果是学生查看，不返回答案和评分细则
 		if role == "STUDENT" {
 			question.Answer = ""
+			question.Rubric = nil
+			question.ReferenceAnswer = nil
 		}
 
+		// 按规则抽取的题目不属于固定题目，只出现在抽到它的学生试卷中
+		if ruleID.Valid {
+			drawn[question.ID] = question
+			continue
+		}
 		questions = append(questions, question)
 	}
 
-	utils.Success(c, gin.H{
+	// 抽取的题目排在固定题目之后，按学生试卷中的顺序
+	fixedCount := len(questions)
+	for _, questionID := range paper {
+		if question, ok := drawn[questionID]; ok {
+			questions = append(questions, question)
+		}
+	}
+
+	// 每个学生的题目顺序和选项顺序不同，交卷时按保存的布局还原答案。
+	// 已生成的布局始终沿用，EXAM_SHUFFLE=off 只是不再为新学生生成布局
+	shuffled := false
+	if started {
+		var shuffle *examShuffle
+		if examShuffleEnabled() {
+			shuffle, err = ensureExamShuffle(examID, getCurrentUserID(c), questions[:fixedCount], questions[fixedCount:])
+		} else {
+			shuffle, err = loadExamShuffle(examID, getCurrentUserID(c))
+		}
+		if err != nil {
+			utils.GetLogger().Error("generate exam shuffle failed", zap.Int64("examID", examID), zap.Error(err))
+			utils.InternalServerError(c, "生成试卷失败")
+			return
+		}
+		questions = shuffle.apply(questions)
+		shuffled = shuffle != nil
+	}
+
+	result := gin.H{
 		"exam":      exam,
 		"questions": questions,
-	})
+		"shuffled":  shuffled,
+	}
+	if role != "STUDENT" {
+		rules, err := loadExamQuestionRules(examID)
+		if err != nil {
+			utils.InternalServerError(c, "查询抽题规则失败")
+			return
+		}
+		result["rules"] = rules
+	}
+
+	utils.Success(c, result)
 }
 
 // AddQuestion 添加题目
@@ -310,21 +386,78 @@ func AddQuestion(c *gin.Context) {
 		return
 	}
 
-	result, err := database.DB.Exec(`
-		INSERT INTO exam_questions (exam_id, type, stem, options, answer, score, order_index)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, examID, req.Type, req.Stem, req.Options, req.Answer, req.Score, req.OrderIndex)
+	rubric, err := normalizeExamRubric(req.Type, req.Rubric, req.Score)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	scoringPolicy, wrongPenalty, err := normalizeExamScoring(req)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	if req.Answer, err = normalizeExamAnswerSpec(req.Type, req.Answer); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	target, ok := normalizeQuestionTarget(req.Target)
+	if !ok {
+		utils.BadRequest(c, "无效的题目写入位置")
+		return
+	}
+	if target == questionTargetExam {
+		result, err := database.DB.Exec(`
+			INSERT INTO exam_questions (exam_id, type, stem, options, answer, score, order_index, rubric, reference_answer, scoring_policy, wrong_penalty)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, examID, req.Type, req.Stem, req.Options, req.Answer, req.Score, req.OrderIndex, rubric, examReferenceAnswer(req.Type, req.ReferenceAnswer),
+			scoringPolicy, wrongPenalty)
 
+		if err != nil {
+			utils.InternalServerError(c, "添加题目失败")
+			return
+		}
+
+		questionID, _ := result.LastInsertId()
+
+		utils.Success(c, gin.H{
+			"id": questionID,
+		})
+		return
+	}
+
+	// 写入课程题库；target 为 both 时再把题库题目引用到本场考试
+	if _, ok := normalizeQuestionDifficulty(req.Difficulty, false); !ok {
+		utils.BadRequest(c, "无效的难度")
+		return
+	}
+	tx, err := database.DB.Begin()
 	if err != nil {
+		utils.InternalServerError(c, "开启事务失败")
+		return
+	}
+	bankQuestionID, err := insertBankQuestion(tx, courseID, userID.(int64), req, rubric)
+	if err != nil {
+		tx.Rollback()
 		utils.InternalServerError(c, "添加题目失败")
 		return
 	}
+	response := gin.H{"bankQuestionId": bankQuestionID}
+	if target == questionTargetBoth {
+		examIDValue, _ := strconv.ParseInt(examID, 10, 64)
+		questionID, err := copyBankQuestionToExam(tx, examIDValue, bankQuestionID, nil, 0, req.OrderIndex)
+		if err != nil {
+			tx.Rollback()
+			utils.InternalServerError(c, "添加题目失败")
+			return
+		}
+		response["id"] = questionID
+	}
+	if err := tx.Commit(); err != nil {
+		utils.InternalServerError(c, "提交事务失败")
+		return
+	}
 
-	questionID, _ := result.LastInsertId()
-
-	utils.Success(c, gin.H{
-		"id": questionID,
-	})
+	utils.Success(c, response)
 }
 
 // SubmitExam 提交答卷
@@ -435,6 +568,15 @@ func SubmitExam(c *gin.Context) {
 		return
 	}
 
+	// 乱序试卷中学生作答的是打乱后的选项字母，判分前还原为原始选项
+	examIDValue, _ := strconv.ParseInt(examID, 10, 64)
+	shuffle, err := loadExamShuffle(examIDValue, getCurrentUserID(c))
+	if err != nil {
+		utils.GetLogger().Error("load exam shuffle failed", zap.String("examID", examID), zap.Error(err))
+		utils.InternalServerError(c, "提交失败")
+		return
+	}
+
 	// 创建提交记录
 	result, err := database.DB.Exec(`
 		INSERT INTO exam_submissions (exam_id, student_id)
@@ -453,14 +595,20 @@ func SubmitExam(c *gin.Context) {
 	ctx, gradingSpan := tracer.Start(ctx, "business.grading.batch")
 
 	totalScore := 0.0
+	coachingQueued := false
+	gradingQueued := false
+	judgeQueued := false
 	for _, answer := range req.Answers {
 		_, qSpan := tracer.Start(ctx, "business.grading.question")
-		// 获取题目信息，同时验证题目属于当前考试（防止注入其他考试的题目）
+		// 获取题目信息，同时验证题目属于当前考试（防止注入其他考试的题目），按规则抽取的题目须在该学生的试卷中
 		var question models.ExamQuestion
 		err := database.DB.QueryRow(`
-			SELECT id, type, answer, score FROM exam_questions WHERE id = ? AND exam_id = ?
-		`, answer.QuestionID, examID).Scan(
-			&question.ID, &question.Type, &question.Answer, &question.Score,
+			SELECT id, type, options, answer, score, rubric, reference_answer, scoring_policy, wrong_penalty FROM exam_questions
+			WHERE id = ? AND exam_id = ?
+			  AND (rule_id IS NULL OR id IN (SELECT question_id FROM exam_papers WHERE exam_id = ? AND student_id = ?))
+		`, answer.QuestionID, examID, examID, userID).Scan(
+			&question.ID, &question.Type, &question.Options, &question.Answer, &question.Score,
+			&question.Rubric, &question.ReferenceAnswer, &question.ScoringPolicy, &question.WrongPenalty,
 		)
 
 		if err != nil {
@@ -469,6 +617,7 @@ func SubmitExam(c *gin.Context) {
 			continue
 		}
 		question.Answer = normalizeStoredExamAnswer(question.Answer)
+		studentAnswer := shuffle.canonicalAnswer(question.ID, answer.Answer)
 
 		qSpan.SetAttributes(
 			attribute.Int64("question.id", question.ID),
@@ -477,30 +626,56 @@ func SubmitExam(c *gin.Context) {
 
 		// 计算得分
 		scoreAwarded := 0.0
-		if question.Type == "SINGLE_CHOICE" || question.Type == "MULTIPLE_CHOICE" || question.Type == "TRUE_FALSE" {
-			// 客观题自动判分
-			if answer.Answer == question.Answer {
-				scoreAwarded = question.Score
-			}
+		if isObjectiveExamQuestion(question.Type) {
+			// 客观题按题目的评分规则自动判分，可能部分得分或倒扣分
+			scoreAwarded = scoreObjectiveAnswer(question, studentAnswer)
 		}
-		// 主观题暂不判分，等待教师批改
+		// 主观题暂不判分：配置了评分细则或参考答案的交给 AI 给出评分建议，由教师确认；
+		// 编程题先记 0 分，评测 worker 运行测试用例后写入得分
 
 		qSpan.SetAttributes(attribute.Float64("grading.score", scoreAwarded))
 
 		totalScore += scoreAwarded
 
+		// 答错的客观题交给后台 worker 结合课程资料生成讲解
+		var coachingStatus interface{}
+		if needsExamCoaching(question.Type, studentAnswer, scoreAwarded, question.Score) {
+			coachingStatus = examCoachingPending
+			coachingQueued = true
+		}
+		var gradeStatus interface{}
+		if needsExamAIGrading(question.Type, studentAnswer, question.Rubric, examGradingReference(question.ReferenceAnswer, question.Answer)) {
+			gradeStatus = examAIGradePending
+			gradingQueued = true
+		}
+		var judgeStatus interface{}
+		if needsCodeJudging(question.Type, studentAnswer) {
+			judgeStatus = codeJudgePending
+			judgeQueued = true
+		}
+
 		// 保存答案
 		database.DB.Exec(`
-			INSERT INTO exam_answers (submission_id, question_id, student_answer, score_awarded)
-			VALUES (?, ?, ?, ?)
-		`, submissionID, answer.QuestionID, answer.Answer, scoreAwarded)
+			INSERT INTO exam_answers (submission_id, question_id, student_answer, score_awarded, coaching_status, ai_grade_status, judge_status)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, submissionID, answer.QuestionID, studentAnswer, scoreAwarded, coachingStatus, gradeStatus, judgeStatus)
 
 		qSpan.End()
 	}
 
 	gradingSpan.End()
+	if coachingQueued {
+		wakeExamCoachingWorker()
+	}
+	if gradingQueued {
+		wakeExamGradingWorker()
+	}
+	if judgeQueued {
+		wakeCodeJudgeWorker()
+	}
 
-	// 更新总分
+	// 更新总分，倒扣分不会让总分低于 0
+	totalScore = math.Max(totalScore, 0)
 	database.DB.Exec(`
 		UPDATE exam_submissions SET total_score = ? WHERE id = ?
 	`, totalScore, submissionID)
@@ -510,7 +685,11 @@ func SubmitExam(c *gin.Context) {
 
 	// 异步检查难题并向教师推送预警消息（PLAN-03）
 	if examIDInt, err := strconv.ParseInt(examID, 10, 64); err == nil {
-		go checkExamAndWarnTeacher(examIDInt)
+		examWarningJobs.Add(1)
+		go func() {
+			defer examWarningJobs.Done()
+			checkExamAndWarnTeacher(examIDInt)
+		}()
 	}
 
 	utils.SuccessWithMessage(c, "提交成功", gin.H{
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"database/sql"
+	"encoding/json"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -222,10 +224,19 @@ func GetMyExamSubmission(c *gin.Context) {
 		return
 	}
 
+	// 按学生作答时的题目顺序和选项顺序展示
+	examIDValue, _ := strconv.ParseInt(examID, 10, 64)
+	shuffle, err := loadExamShuffle(examIDValue, getCurrentUserID(c))
+	if err != nil {
+		utils.InternalServerError(c, "查询失败")
+		return
+	}
+
 	// 获取答题详情
 	rows, err := database.DB.Query(`
 		SELECT a.question_id, a.student_answer, a.score_awarded,
-		       q.type, q.stem, q.options, q.answer, q.score
+		       q.type, q.stem, q.options, q.answer, q.score,
+		       a.coaching_status, a.coaching, COALESCE(a.judge_status, ''), a.judge_result
 		FROM exam_answers a
 		JOIN exam_questions q ON a.question_id = q.id
 		WHERE a.submission_id = ?
@@ -246,9 +257,13 @@ func GetMyExamSubmission(c *gin.Context) {
 		var qType, stem, answer string
 		var options sql.NullString
 		var score float64
+		var coachingStatus, coachingJSON sql.NullString
+		var judgeStatus string
+		var judgeResult sql.NullString
 
 		rows.Scan(&questionID, &studentAnswer, &scoreAwarded,
-			&qType, &stem, &options, &answer, &score)
+			&qType, &stem, &options, &answer, &score,
+			&coachingStatus, &coachingJSON, &judgeStatus, &judgeResult)
 		answer = normalizeStoredExamAnswer(answer)
 
 		answerItem := gin.H{
@@ -256,24 +271,50 @@ func GetMyExamSubmission(c *gin.Context) {
 			"type":          qType,
 			"stem":          stem,
 			"score":         score,
-			"studentAnswer": studentAnswer,
-			"correctAnswer": answer,
+			"studentAnswer": shuffle.displayAnswer(questionID, studentAnswer),
+			"correctAnswer": shuffle.displayAnswer(questionID, answer),
 		}
 
 		if options.Valid {
-			answerItem["options"] = options.String
+			answerItem["options"] = shuffle.displayOptions(questionID, options.String)
 		}
 		if scoreAwarded.Valid {
 			answerItem["scoreAwarded"] = scoreAwarded.Float64
 		}
+		// 错题讲解：coachingStatus 为 pending/processing 时仍在生成
+		if coachingStatus.Valid {
+			answerItem["coachingStatus"] = coachingStatus.String
+		}
+		if coachingJSON.Valid {
+			var coaching examCoaching
+			if err := json.Unmarshal([]byte(coachingJSON.String), &coaching); err == nil {
+				answerItem["coaching"] = coaching
+			}
+		}
+		// 编程题的评测配置含隐藏测试用例，不返回给学生，评测结果也只保留样例用例的报错
+		if qType == "CODE" {
+			answerItem["correctAnswer"] = ""
+			spec, _ := parseCodeQuestionSpec(answer)
+			if spec != nil {
+				answerItem["code"] = spec.publicInfo()
+			}
+			if judgeStatus != "" {
+				answerItem["judgeStatus"] = judgeStatus
+			}
+			if result := publicCodeJudgeResult(decodeCodeJudgeResult(judgeResult), spec); result != nil {
+				answerItem["judgeResult"] = result
+			}
+		}
 
 		answers = append(answers, answerItem)
 	}
+	sortAnswersByShuffle(answers, shuffle)
 
 	result := gin.H{
 		"submissionId": submissionID,
 		"submittedAt":  submittedAt,
 		"answers":      answers,
+		"shuffled":     shuffle != nil,
 	}
 
 	if totalScore.Valid {
@@ -336,10 +377,18 @@ func GetExamSubmissionDetail(c *gin.Context) {
 		return
 	}
 
+	// 乱序试卷按学生看到的题目顺序、选项顺序和选项字母展示
+	shuffle, err := loadExamShuffle(examID, studentID)
+	if err != nil {
+		utils.InternalServerError(c, "查询失败")
+		return
+	}
+
 	// 获取答题详情
 	rows, err := database.DB.Query(`
-		SELECT a.question_id, a.student_answer, a.score_awarded,
-		       q.type, q.stem, q.options, q.answer, q.score
+		SELECT a.id, a.question_id, a.student_answer, a.score_awarded,
+		       q.type, q.stem, q.options, q.answer, q.score,
+		       COALESCE(a.ai_grade_status, ''), a.ai_grade, COALESCE(a.judge_status, ''), a.judge_result
 		FROM exam_answers a
 		JOIN exam_questions q ON a.question_id = q.id
 		WHERE a.submission_id = ?
@@ -354,35 +403,53 @@ func GetExamSubmissionDetail(c *gin.Context) {
 
 	answers := []gin.H{}
 	for rows.Next() {
-		var questionID int64
+		var answerID, questionID int64
 		var studentAnswer string
 		var scoreAwarded sql.NullFloat64
 		var qType, stem, answer string
 		var options sql.NullString
 		var score float64
+		var aiGradeStatus string
+		var aiGrade sql.NullString
+		var judgeStatus string
+		var judgeResult sql.NullString
 
-		rows.Scan(&questionID, &studentAnswer, &scoreAwarded,
-			&qType, &stem, &options, &answer, &score)
+		rows.Scan(&answerID, &questionID, &studentAnswer, &scoreAwarded,
+			&qType, &stem, &options, &answer, &score, &aiGradeStatus, &aiGrade, &judgeStatus, &judgeResult)
 		answer = normalizeStoredExamAnswer(answer)
 
 		answerItem := gin.H{
+			"answerId":      answerID,
 			"questionId":    questionID,
 			"type":          qType,
 			"stem":          stem,
 			"score":         score,
-			"studentAnswer": studentAnswer,
-			"correctAnswer": answer,
+			"studentAnswer": shuffle.displayAnswer(questionID, studentAnswer),
+			"correctAnswer": shuffle.displayAnswer(questionID, answer),
 		}
 
 		if options.Valid {
-			answerItem["options"] = options.String
+			answerItem["options"] = shuffle.displayOptions(questionID, options.String)
 		}
 		if scoreAwarded.Valid {
 			answerItem["scoreAwarded"] = scoreAwarded.Float64
 		}
+		if aiGradeStatus != "" {
+			answerItem["aiGradeStatus"] = aiGradeStatus
+		}
+		if proposal := decodeExamGradeProposal(aiGrade); proposal != nil {
+			answerItem["aiGrade"] = proposal
+		}
+		if judgeStatus != "" {
+			answerItem["judgeStatus"] = judgeStatus
+		}
+		if result := decodeCodeJudgeResult(judgeResult); result != nil {
+			answerItem["judgeResult"] = result
+		}
 
 		answers = append(answers, answerItem)
 	}
+	sortAnswersByShuffle(answers, shuffle)
 
 	result := gin.H{
 		"id":           submissionID,
@@ -394,6 +461,7 @@ func GetExamSubmissionDetail(c *gin.Context) {
 		"studentEmail": studentEmail,
 		"submittedAt":  submittedAt,
 		"answers":      answers,
+		"shuffled":     shuffle != nil,
 	}
 
 	if totalScore.Valid {
@@ -531,13 +599,15 @@ func UpdateQuestion(c *gin.Context) {
 
 	// 检查权限
 	var examID, courseID, instructorID int64
+	var currentType string
+	var currentOptions sql.NullString
 	err := database.DB.QueryRow(`
-		SELECT q.exam_id, e.course_id, c.instructor_id
+		SELECT q.exam_id, e.course_id, c.instructor_id, q.type, q.options
 		FROM exam_questions q
 		JOIN exams e ON q.exam_id = e.id
 		JOIN courses c ON e.course_id = c.id
 		WHERE q.id = ?
-	`, questionID).Scan(&examID, &courseID, &instructorID)
+	`, questionID).Scan(&examID, &courseID, &instructorID, &currentType, &currentOptions)
 
 	if err == sql.ErrNoRows {
 		utils.NotFound(c, "题目不存在")
@@ -559,11 +629,33 @@ func UpdateQuestion(c *gin.Context) {
 		return
 	}
 
+	rubric, err := normalizeExamRubric(req.Type, req.Rubric, req.Score)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	scoringPolicy, wrongPenalty, err := normalizeExamScoring(req)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	if req.Answer, err = normalizeExamAnswerSpec(req.Type, req.Answer); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	// 学生的选项顺序在拿到试卷时就已固定，考试中改动选项会让学生看到的字母对应到别的选项
+	if examShufflesStarted(examID) && !sameExamOptions(currentType, currentOptions, req.Type, req.Options) {
+		utils.BadRequest(c, "已有学生开始作答，不能修改题型或选项")
+		return
+	}
+
 	_, err = database.DB.Exec(`
 		UPDATE exam_questions 
-		SET type = ?, stem = ?, options = ?, answer = ?, score = ?, order_index = ?
+		SET type = ?, stem = ?, options = ?, answer = ?, score = ?, order_index = ?, rubric = ?, reference_answer = ?,
+		    scoring_policy = ?, wrong_penalty = ?
 		WHERE id = ?
-	`, req.Type, req.Stem, req.Options, req.Answer, req.Score, req.OrderIndex, questionID)
+	`, req.Type, req.Stem, req.Options, req.Answer, req.Score, req.OrderIndex, rubric, examReferenceAnswer(req.Type, req.ReferenceAnswer),
+		scoringPolicy, wrongPenalty, questionID)
 
 	if err != nil {
 		utils.InternalServerError(c, "更新失败")
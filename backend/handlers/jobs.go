@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 后台任务（文档入库、讨论区 AI、考后辅导、主观题评分、编程题评测）共用的失败重试策略
+const (
+	jobBaseBackoff = 15 * time.Second
+	jobMaxBackoff  = 10 * time.Minute
+)
+
+// permanentJobError 表示重试也无法成功的错误（格式不支持、文档为空、缺少配置等），任务直接失败
+type permanentJobError struct {
+	err error
+}
+
+func (e *permanentJobError) Error() string { return e.err.Error() }
+func (e *permanentJobError) Unwrap() error { return e.err }
+
+func newPermanentJobError(format string, args ...interface{}) error {
+	return &permanentJobError{err: fmt.Errorf(format, args...)}
+}
+
+// jobRetryAt 返回失败任务的下次运行时间；永久错误或已用完 maxAttempts 次尝试时返回 false，任务应标记失败
+func jobRetryAt(jobErr error, attempts, maxAttempts int, now time.Time) (time.Time, bool) {
+	var permanent *permanentJobError
+	if errors.As(jobErr, &permanent) || attempts >= maxAttempts {
+		return time.Time{}, false
+	}
+	return now.Add(jobBackoff(attempts)), true
+}
+
+// jobBackoff 返回第 attempt 次失败后的等待时间：15s、30s、60s……，上限 10 分钟
+func jobBackoff(attempt int) time.Duration {
+	delay := jobBaseBackoff
+	for i := 1; i < attempt && delay < jobMaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > jobMaxBackoff {
+		delay = jobMaxBackoff
+	}
+	return delay
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestJobBackoff(t *testing.T) {
+	cases := map[int]time.Duration{1: 15 * time.Second, 2: 30 * time.Second, 3: time.Minute, 10: jobMaxBackoff}
+	for attempt, want := range cases {
+		if got := jobBackoff(attempt); got != want {
+			t.Errorf("jobBackoff(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+}
+
+func TestJobRetryAt(t *testing.T) {
+	now := time.Now()
+	if retryAt, retry := jobRetryAt(errors.New("timeout"), 1, 3, now); !retry || !retryAt.Equal(now.Add(jobBaseBackoff)) {
+		t.Fatalf("transient error must be retried after the base backoff, got %v %v", retryAt, retry)
+	}
+	if _, retry := jobRetryAt(errors.New("timeout"), 3, 3, now); retry {
+		t.Fatal("job must fail once the attempts are used up")
+	}
+	wrapped := fmt.Errorf("ingest: %w", newPermanentJobError("文档内容为空"))
+	if _, retry := jobRetryAt(wrapped, 1, 3, now); retry {
+		t.Fatal("permanent errors must not be retried")
+	}
+}
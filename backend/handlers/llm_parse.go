@@ -18,6 +18,7 @@ const (
 	llmFallbackReasonJSONUnmarshalFailed = "json_unmarshal_failed"
 	llmFallbackReasonValidationFailed    = "validation_failed"
 	llmFallbackReasonRuleParseFailed     = "rule_parse_failed"
+	llmFallbackReasonQuotaExceeded       = "quota_exceeded"
 )
 
 type llmFallbackError struct {
@@ -56,17 +57,16 @@ func llmFallbackReason(err error) string {
 	return ""
 }
 
-func completeWithConfiguredLLM(c *gin.Context, systemPrompt, userPrompt string) (string, error) {
+// completeWithConfiguredLLM 调用配置的模型补全；AI 配额用尽时返回 quota_exceeded，由调用方回退规则解析
+func completeWithConfiguredLLM(c *gin.Context, scope aiUsageScope, systemPrompt, userPrompt string) (string, error) {
 	cfg, err := getRAGConfig(c)
 	if err != nil {
 		return "", newLLMFallbackError(llmFallbackReasonMissingKey, err)
 	}
-	client := &ragpkg.GenClient{
-		APIKey:  cfg.APIKey,
-		BaseURL: cfg.BaseURL,
-		Model:   cfg.LLMModel,
+	if checkAIQuota(scope) != nil {
+		return "", newLLMFallbackError(llmFallbackReasonQuotaExceeded)
 	}
-	raw, err := client.Complete(systemPrompt, userPrompt)
+	raw, err := ragpkg.CompletePrompt(c.Request.Context(), newRAGProvider(scope.meter(cfg)), systemPrompt, userPrompt)
 	if err != nil {
 		return "", mapLLMRequestError(err)
 	}
@@ -137,11 +137,13 @@ func mapLLMRequestError(err error) error {
 	if errors.Is(err, ragpkg.ErrGenerationTimeout) {
 		return newLLMFallbackError(llmFallbackReasonTimeout, err)
 	}
+	if errors.Is(err, ragpkg.ErrMissingAPIKey) {
+		return newLLMFallbackError(llmFallbackReasonMissingKey, err)
+	}
 
 	message := strings.ToLower(err.Error())
 	switch {
-	case strings.Contains(message, "missing openai_api_key"),
-		strings.Contains(message, "缺少 rag api key"):
+	case strings.Contains(message, "缺少 rag api key"):
 		return newLLMFallbackError(llmFallbackReasonMissingKey, err)
 	case strings.Contains(message, "returned status"):
 		return newLLMFallbackError(llmFallbackReasonBadStatus, err)
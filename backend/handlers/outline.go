@@ -93,7 +93,12 @@ func ParseCourseOutline(c *gin.Context) {
 	}
 
 	text := string(content)
-	chapters, llmErr := parseOutlineWithLLM(c, text)
+	courseIDValue, _ := strconv.ParseInt(courseID, 10, 64)
+	usageScope := aiUsageScopeFromContext(c, courseIDValue, aiFeatureOutlineParse)
+	if !enforceAIQuota(c, usageScope) {
+		return
+	}
+	chapters, llmErr := parseOutlineWithLLM(c, usageScope, text)
 	parseMode := "llm"
 	fallbackReason := ""
 	if llmErr != nil {
@@ -125,7 +130,7 @@ func ParseCourseOutline(c *gin.Context) {
 	utils.Success(c, response)
 }
 
-func parseOutlineWithLLM(c *gin.Context, text string) ([]ParsedChapter, error) {
+func parseOutlineWithLLM(c *gin.Context, scope aiUsageScope, text string) ([]ParsedChapter, error) {
 	systemPrompt := `你是在线教育平台 CourseArk 的课程大纲结构化助手。
 请把用户提供的课程大纲解析为严格 JSON。只输出 JSON，不要输出 Markdown、解释或代码块。
 JSON 格式必须为：
@@ -147,7 +152,7 @@ JSON 格式必须为：
 4. orderIndex 从 1 开始连续编号。`
 	userPrompt := "请解析以下课程大纲：\n\n" + text
 
-	raw, err := completeWithConfiguredLLM(c, systemPrompt, userPrompt)
+	raw, err := completeWithConfiguredLLM(c, scope, systemPrompt, userPrompt)
 	if err != nil {
 		return nil, err
 	}
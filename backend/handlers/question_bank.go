@@ -0,0 +1,544 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+	"github.com/online-education-platform/backend/utils"
+)
+
+const (
+	questionTargetExam = "exam"
+	questionTargetBank = "bank"
+	questionTargetBoth = "both"
+
+	questionDifficultyEasy   = "easy"
+	questionDifficultyMedium = "medium"
+	questionDifficultyHard   = "hard"
+)
+
+// sqlExecer 由 *sql.DB 和 *sql.Tx 实现，题库写入既可单独执行也可放在事务中
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// bankQuestion 题库题目
+type bankQuestion struct {
+	ID              int64      `json:"id"`
+	CourseID        int64      `json:"courseId"`
+	Type            string     `json:"type"`
+	Stem            string     `json:"stem"`
+	Options         *string    `json:"options,omitempty"`
+	Answer          string     `json:"answer"`
+	Score           float64    `json:"score"`
+	Rubric          *string    `json:"rubric,omitempty"`
+	ReferenceAnswer *string    `json:"referenceAnswer,omitempty"`
+	Difficulty      string     `json:"difficulty"`
+	Tags            []string   `json:"tags"`
+	UseCount        int        `json:"useCount"`
+	LastUsedAt      *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+// AddBankQuestionsRequest 把题库题目加入考试
+type AddBankQuestionsRequest struct {
+	QuestionIDs []int64 `json:"questionIds" binding:"required"`
+}
+
+func normalizeQuestionTarget(raw string) (string, bool) {
+	switch target := strings.ToLower(strings.TrimSpace(raw)); target {
+	case "":
+		return questionTargetExam, true
+	case questionTargetExam, questionTargetBank, questionTargetBoth:
+		return target, true
+	}
+	return "", false
+}
+
+// normalizeQuestionDifficulty 难度为空时取 medium；allowEmpty 用于抽题规则，空表示不限难度
+func normalizeQuestionDifficulty(raw string, allowEmpty bool) (string, bool) {
+	switch difficulty := strings.ToLower(strings.TrimSpace(raw)); difficulty {
+	case "":
+		if allowEmpty {
+			return "", true
+		}
+		return questionDifficultyMedium, true
+	case questionDifficultyEasy, questionDifficultyMedium, questionDifficultyHard:
+		return difficulty, true
+	}
+	return "", false
+}
+
+// normalizeQuestionTags 去掉空白和重复的标签，保持原有顺序
+func normalizeQuestionTags(tags []string) []string {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// insertBankQuestion 写入题库题目及标签，rubric 须已经过 normalizeExamRubric 校验
+func insertBankQuestion(exec sqlExecer, courseID, userID int64, req AddQuestionRequest, rubric *string) (int64, error) {
+	difficulty, ok := normalizeQuestionDifficulty(req.Difficulty, false)
+	if !ok {
+		return 0, fmt.Errorf("无效的难度: %s", req.Difficulty)
+	}
+	scoringPolicy, wrongPenalty, err := normalizeExamScoring(req)
+	if err != nil {
+		return 0, err
+	}
+	result, err := exec.Exec(`
+		INSERT INTO question_bank (course_id, type, stem, options, answer, score, rubric, reference_answer, difficulty, created_by,
+		                           scoring_policy, wrong_penalty)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, courseID, req.Type, req.Stem, req.Options, req.Answer, req.Score, rubric, examReferenceAnswer(req.Type, req.ReferenceAnswer), difficulty, userID,
+		scoringPolicy, wrongPenalty)
+	if err != nil {
+		return 0, err
+	}
+	questionID, _ := result.LastInsertId()
+	if err := replaceBankQuestionTags(exec, questionID, req.Tags); err != nil {
+		return 0, err
+	}
+	return questionID, nil
+}
+
+func replaceBankQuestionTags(exec sqlExecer, questionID int64, tags []string) error {
+	if _, err := exec.Exec(`DELETE FROM question_bank_tags WHERE question_id = ?`, questionID); err != nil {
+		return err
+	}
+	for _, tag := range normalizeQuestionTags(tags) {
+		if _, err := exec.Exec(`INSERT INTO question_bank_tags (question_id, tag) VALUES (?, ?)`, questionID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyBankQuestionToExam 把题库题目复制为考试题目并记录使用历史。
+// 考试保存的是副本，之后修改题库不会影响已经出过的试卷；score 为 0 时沿用题库分值
+func copyBankQuestionToExam(exec sqlExecer, examID, bankQuestionID int64, ruleID interface{}, score float64, orderIndex int) (int64, error) {
+	result, err := exec.Exec(`
+		INSERT INTO exam_questions (exam_id, type, stem, options, answer, score, order_index, rubric, reference_answer, bank_question_id, rule_id,
+		                            scoring_policy, wrong_penalty)
+		SELECT ?, type, stem, options, answer, CASE WHEN ? > 0 THEN ? ELSE score END, ?, rubric, reference_answer, id, ?,
+		       scoring_policy, MIN(wrong_penalty, CASE WHEN ? > 0 THEN ? ELSE score END)
+		FROM question_bank
+		WHERE id = ?
+	`, examID, score, score, orderIndex, ruleID, score, score, bankQuestionID)
+	if err != nil {
+		return 0, err
+	}
+	questionID, _ := result.LastInsertId()
+	if _, err := exec.Exec(`
+		INSERT INTO question_bank_usage (bank_question_id, exam_id, exam_question_id) VALUES (?, ?, ?)
+	`, bankQuestionID, examID, questionID); err != nil {
+		return 0, err
+	}
+	if _, err := exec.Exec(`
+		UPDATE question_bank SET use_count = use_count + 1, last_used_at = ? WHERE id = ?
+	`, time.Now(), bankQuestionID); err != nil {
+		return 0, err
+	}
+	return questionID, nil
+}
+
+// ListQuestionBank 获取课程题库，可按 type、difficulty、tag 和关键词 keyword 过滤
+func ListQuestionBank(c *gin.Context) {
+	courseID, ok := parseInt64Param(c, c.Param("id"), "课程ID")
+	if !ok || !ensureCourseInstructorOrAdmin(c, courseID, "只有课程教师可以管理题库") {
+		return
+	}
+
+	query := `
+		SELECT b.id, b.course_id, b.type, b.stem, b.options, b.answer, b.score, b.rubric, b.reference_answer,
+		       b.difficulty, b.use_count, b.last_used_at, b.created_at
+		FROM question_bank b
+		WHERE b.course_id = ?`
+	args := []interface{}{courseID}
+	if questionType := strings.TrimSpace(c.Query("type")); questionType != "" {
+		query += ` AND b.type = ?`
+		args = append(args, questionType)
+	}
+	if difficulty := strings.TrimSpace(c.Query("difficulty")); difficulty != "" {
+		query += ` AND b.difficulty = ?`
+		args = append(args, difficulty)
+	}
+	if tag := strings.TrimSpace(c.Query("tag")); tag != "" {
+		query += ` AND EXISTS (SELECT 1 FROM question_bank_tags t WHERE t.question_id = b.id AND t.tag = ?)`
+		args = append(args, tag)
+	}
+	if keyword := strings.TrimSpace(c.Query("keyword")); keyword != "" {
+		query += ` AND b.stem LIKE ?`
+		args = append(args, "%"+keyword+"%")
+	}
+	query += ` ORDER BY b.created_at DESC, b.id DESC`
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		utils.InternalServerError(c, "查询题库失败")
+		return
+	}
+	defer rows.Close()
+
+	questions := []*bankQuestion{}
+	byID := map[int64]*bankQuestion{}
+	for rows.Next() {
+		question := &bankQuestion{Tags: []string{}}
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&question.ID, &question.CourseID, &question.Type, &question.Stem, &question.Options,
+			&question.Answer, &question.Score, &question.Rubric, &question.ReferenceAnswer,
+			&question.Difficulty, &question.UseCount, &lastUsedAt, &question.CreatedAt); err != nil {
+			continue
+		}
+		if lastUsedAt.Valid {
+			question.LastUsedAt = &lastUsedAt.Time
+		}
+		question.Answer = normalizeStoredExamAnswer(question.Answer)
+		questions = append(questions, question)
+		byID[question.ID] = question
+	}
+	rows.Close()
+
+	// 课程的全部标签，同时供前端做标签筛选
+	tagRows, err := database.DB.Query(`
+		SELECT t.question_id, t.tag
+		FROM question_bank_tags t
+		JOIN question_bank b ON b.id = t.question_id
+		WHERE b.course_id = ?
+		ORDER BY t.rowid
+	`, courseID)
+	if err != nil {
+		utils.InternalServerError(c, "查询题库标签失败")
+		return
+	}
+	defer tagRows.Close()
+	allTags := []string{}
+	seenTags := map[string]bool{}
+	for tagRows.Next() {
+		var questionID int64
+		var tag string
+		if err := tagRows.Scan(&questionID, &tag); err != nil {
+			continue
+		}
+		if question, ok := byID[questionID]; ok {
+			question.Tags = append(question.Tags, tag)
+		}
+		if !seenTags[tag] {
+			seenTags[tag] = true
+			allTags = append(allTags, tag)
+		}
+	}
+
+	utils.Success(c, gin.H{
+		"questions": questions,
+		"tags":      allTags,
+	})
+}
+
+// CreateBankQuestion 向课程题库添加题目
+func CreateBankQuestion(c *gin.Context) {
+	courseID, ok := parseInt64Param(c, c.Param("id"), "课程ID")
+	if !ok || !ensureCourseInstructorOrAdmin(c, courseID, "只有课程教师可以管理题库") {
+		return
+	}
+
+	var req AddQuestionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数错误")
+		return
+	}
+	rubric, err := normalizeExamRubric(req.Type, req.Rubric, req.Score)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	if _, ok := normalizeQuestionDifficulty(req.Difficulty, false); !ok {
+		utils.BadRequest(c, "无效的难度")
+		return
+	}
+	if _, _, err := normalizeExamScoring(req); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	if req.Answer, err = normalizeExamAnswerSpec(req.Type, req.Answer); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		utils.InternalServerError(c, "开启事务失败")
+		return
+	}
+	questionID, err := insertBankQuestion(tx, courseID, getCurrentUserID(c), req, rubric)
+	if err != nil {
+		tx.Rollback()
+		utils.InternalServerError(c, "添加题目失败")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		utils.InternalServerError(c, "提交事务失败")
+		return
+	}
+
+	utils.Success(c, gin.H{"id": questionID})
+}
+
+// UpdateBankQuestion 更新题库题目，已经加入考试的副本不受影响
+func UpdateBankQuestion(c *gin.Context) {
+	courseID, ok := parseInt64Param(c, c.Param("id"), "课程ID")
+	if !ok {
+		return
+	}
+	questionID, ok := parseInt64Param(c, c.Param("qid"), "题目ID")
+	if !ok || !ensureCourseInstructorOrAdmin(c, courseID, "只有课程教师可以管理题库") {
+		return
+	}
+
+	var req AddQuestionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数错误")
+		return
+	}
+	rubric, err := normalizeExamRubric(req.Type, req.Rubric, req.Score)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	scoringPolicy, wrongPenalty, err := normalizeExamScoring(req)
+	if err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	if req.Answer, err = normalizeExamAnswerSpec(req.Type, req.Answer); err != nil {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	difficulty, ok := normalizeQuestionDifficulty(req.Difficulty, false)
+	if !ok {
+		utils.BadRequest(c, "无效的难度")
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		utils.InternalServerError(c, "开启事务失败")
+		return
+	}
+	result, err := tx.Exec(`
+		UPDATE question_bank
+		SET type = ?, stem = ?, options = ?, answer = ?, score = ?, rubric = ?, reference_answer = ?, difficulty = ?,
+		    scoring_policy = ?, wrong_penalty = ?, updated_at = ?
+		WHERE id = ? AND course_id = ?
+	`, req.Type, req.Stem, req.Options, req.Answer, req.Score, rubric, examReferenceAnswer(req.Type, req.ReferenceAnswer),
+		difficulty, scoringPolicy, wrongPenalty, time.Now(), questionID, courseID)
+	if err != nil {
+		tx.Rollback()
+		utils.InternalServerError(c, "更新失败")
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		tx.Rollback()
+		utils.NotFound(c, "题目不存在")
+		return
+	}
+	if err := replaceBankQuestionTags(tx, questionID, req.Tags); err != nil {
+		tx.Rollback()
+		utils.InternalServerError(c, "更新标签失败")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		utils.InternalServerError(c, "提交事务失败")
+		return
+	}
+
+	utils.SuccessWithMessage(c, "更新成功", nil)
+}
+
+// DeleteBankQuestion 删除题库题目，已经加入考试的副本保留
+func DeleteBankQuestion(c *gin.Context) {
+	courseID, ok := parseInt64Param(c, c.Param("id"), "课程ID")
+	if !ok {
+		return
+	}
+	questionID, ok := parseInt64Param(c, c.Param("qid"), "题目ID")
+	if !ok || !ensureCourseInstructorOrAdmin(c, courseID, "只有课程教师可以管理题库") {
+		return
+	}
+
+	result, err := database.DB.Exec(`DELETE FROM question_bank WHERE id = ? AND course_id = ?`, questionID, courseID)
+	if err != nil {
+		utils.InternalServerError(c, "删除失败")
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		utils.NotFound(c, "题目不存在")
+		return
+	}
+	database.DB.Exec(`DELETE FROM question_bank_tags WHERE question_id = ?`, questionID)
+
+	utils.SuccessWithMessage(c, "删除成功", nil)
+}
+
+// GetBankQuestionUsage 查看题库题目在哪些考试中出现过
+func GetBankQuestionUsage(c *gin.Context) {
+	courseID, ok := parseInt64Param(c, c.Param("id"), "课程ID")
+	if !ok {
+		return
+	}
+	questionID, ok := parseInt64Param(c, c.Param("qid"), "题目ID")
+	if !ok || !ensureCourseInstructorOrAdmin(c, courseID, "只有课程教师可以管理题库") {
+		return
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT u.exam_id, COALESCE(e.title, ''), u.exam_question_id, u.created_at
+		FROM question_bank_usage u
+		JOIN question_bank b ON b.id = u.bank_question_id
+		LEFT JOIN exams e ON e.id = u.exam_id
+		WHERE u.bank_question_id = ? AND b.course_id = ?
+		ORDER BY u.created_at DESC, u.id DESC
+	`, questionID, courseID)
+	if err != nil {
+		utils.InternalServerError(c, "查询使用记录失败")
+		return
+	}
+	defer rows.Close()
+
+	usage := []gin.H{}
+	for rows.Next() {
+		var examID, examQuestionID int64
+		var examTitle string
+		var createdAt time.Time
+		if err := rows.Scan(&examID, &examTitle, &examQuestionID, &createdAt); err != nil {
+			continue
+		}
+		usage = append(usage, gin.H{
+			"examId":         examID,
+			"examTitle":      examTitle,
+			"examQuestionId": examQuestionID,
+			"usedAt":         createdAt,
+		})
+	}
+
+	utils.Success(c, gin.H{"usage": usage})
+}
+
+// AddBankQuestionsToExam 从课程题库挑选题目加入考试，已经加入过的题目会跳过
+func AddBankQuestionsToExam(c *gin.Context) {
+	examID, ok := parseInt64Param(c, c.Param("id"), "考试ID")
+	if !ok || !ensureExamManageable(c, examID, "权限不足") {
+		return
+	}
+	courseID, err := courseIDFromExamID(examID)
+	if err != nil {
+		utils.InternalServerError(c, "服务器错误")
+		return
+	}
+
+	var req AddBankQuestionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.QuestionIDs) == 0 {
+		utils.BadRequest(c, "请选择题库题目")
+		return
+	}
+
+	var maxOrder int
+	database.DB.QueryRow(`SELECT COALESCE(MAX(order_index), 0) FROM exam_questions WHERE exam_id = ?`, examID).Scan(&maxOrder)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		utils.InternalServerError(c, "开启事务失败")
+		return
+	}
+	added := []int64{}
+	for _, bankQuestionID := range req.QuestionIDs {
+		var inCourse, inExam int
+		tx.QueryRow(`SELECT COUNT(*) FROM question_bank WHERE id = ? AND course_id = ?`, bankQuestionID, courseID).Scan(&inCourse)
+		if inCourse == 0 {
+			tx.Rollback()
+			utils.BadRequest(c, fmt.Sprintf("题目 %d 不在本课程题库中", bankQuestionID))
+			return
+		}
+		tx.QueryRow(`
+			SELECT COUNT(*) FROM exam_questions WHERE exam_id = ? AND bank_question_id = ? AND rule_id IS NULL
+		`, examID, bankQuestionID).Scan(&inExam)
+		if inExam > 0 {
+			continue
+		}
+		questionID, err := copyBankQuestionToExam(tx, examID, bankQuestionID, nil, 0, maxOrder+len(added)+1)
+		if err != nil {
+			tx.Rollback()
+			utils.InternalServerError(c, "添加题目失败")
+			return
+		}
+		added = append(added, questionID)
+	}
+	if err := tx.Commit(); err != nil {
+		utils.InternalServerError(c, "提交事务失败")
+		return
+	}
+
+	utils.Success(c, gin.H{
+		"added":       len(added),
+		"questionIds": added,
+	})
+}
+
+// parsedQuestionRequest 把 AI 解析出的题目转为题库写入请求
+func parsedQuestionRequest(question ParsedQuestion, difficulty string, tags []string) (AddQuestionRequest, error) {
+	options, err := json.Marshal(question.Options)
+	if err != nil {
+		return AddQuestionRequest{}, err
+	}
+	optionsValue := string(options)
+	return AddQuestionRequest{
+		Type:       question.Type,
+		Stem:       question.Stem,
+		Options:    &optionsValue,
+		Answer:     question.Answer,
+		Score:      question.Score,
+		Difficulty: difficulty,
+		Tags:       tags,
+	}, nil
+}
+
+// importParsedQuestionToBank 把一道确认后的解析题目存入考试所属课程的题库，target 为 both 时同时加入考试
+func importParsedQuestionToBank(examID, userID int64, question ParsedQuestion, req ConfirmParseRequest, target string, orderIndex int) error {
+	courseID, err := courseIDFromExamID(examID)
+	if err != nil {
+		return err
+	}
+	bankReq, err := parsedQuestionRequest(question, req.Difficulty, req.Tags)
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	bankQuestionID, err := insertBankQuestion(tx, courseID, userID, bankReq, nil)
+	if err != nil {
+		return err
+	}
+	if target == questionTargetBoth {
+		if _, err := copyBankQuestionToExam(tx, examID, bankQuestionID, nil, 0, orderIndex); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+)
+
+func withQuestionBankTestDB(t *testing.T) {
+	t.Helper()
+	withExamGradingTestDB(t)
+	if _, err := database.DB.Exec(`UPDATE exams SET created_at = ?`, time.Now()); err != nil {
+		t.Fatalf("seed exam: %v", err)
+	}
+}
+
+func addTestBankQuestion(t *testing.T, stem, difficulty, tag string) int64 {
+	t.Helper()
+	body := fmt.Sprintf(`{"type":"SINGLE_CHOICE","stem":%q,"options":"[\"对\",\"错\"]","answer":"A","score":2,"difficulty":%q,"tags":[%q," "]}`, stem, difficulty, tag)
+	w := performRAGRequest(CreateBankQuestion, "INSTRUCTOR", 9, gin.Params{{Key: "id", Value: "1"}}, "/", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create bank question failed: %d %s", w.Code, w.Body.String())
+	}
+	return int64(decodeResponseData(t, w.Body.Bytes())["id"].(float64))
+}
+
+func TestAddQuestionAndConfirmParsedQuestionsTargetBank(t *testing.T) {
+	withQuestionBankTestDB(t)
+	params := gin.Params{{Key: "id", Value: "1"}}
+
+	body := `{"type":"TRUE_FALSE","stem":"栈是线性表","answer":"true","score":2,"target":"both","difficulty":"easy","tags":["栈"]}`
+	w := performRAGRequest(AddQuestion, "INSTRUCTOR", 9, params, "/", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("add question to bank and exam failed: %d %s", w.Code, w.Body.String())
+	}
+	data := decodeResponseData(t, w.Body.Bytes())
+	var bankQuestionID, useCount int64
+	database.DB.QueryRow(`SELECT bank_question_id FROM exam_questions WHERE id = ?`, int64(data["id"].(float64))).Scan(&bankQuestionID)
+	database.DB.QueryRow(`SELECT use_count FROM question_bank WHERE id = ?`, bankQuestionID).Scan(&useCount)
+	if bankQuestionID != int64(data["bankQuestionId"].(float64)) || useCount != 1 {
+		t.Fatalf("exam question must reference the bank question and count as a use, got bank=%d uses=%d", bankQuestionID, useCount)
+	}
+
+	confirm := `{"examId":1,"target":"bank","difficulty":"hard","tags":["队列"],
+		"originalQuestions":[{"type":"SINGLE_CHOICE","stem":"队列的存取规则","options":["先进先出","后进先出"],"answer":"A","score":2}],
+		"confirmedQuestions":[{"type":"SINGLE_CHOICE","stem":"队列的存取规则","options":["先进先出","后进先出"],"answer":"A","score":2}]}`
+	if w := performRAGRequest(ConfirmParsedQuestions, "INSTRUCTOR", 9, params, "/", confirm); w.Code != http.StatusOK {
+		t.Fatalf("confirm parsed questions failed: %d %s", w.Code, w.Body.String())
+	}
+	var examQuestions int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM exam_questions WHERE exam_id = 1`).Scan(&examQuestions)
+	if examQuestions != 5 {
+		t.Fatalf("bank-only import must not add exam questions, got %d", examQuestions)
+	}
+
+	w = performRAGRequest(ListQuestionBank, "INSTRUCTOR", 9, params, "/?tag=队列&difficulty=hard", "")
+	questions, _ := decodeResponseData(t, w.Body.Bytes())["questions"].([]any)
+	if len(questions) != 1 || questions[0].(map[string]any)["stem"] != "队列的存取规则" {
+		t.Fatalf("expected the parsed question in the bank, got %v", questions)
+	}
+	if w := performRAGRequest(ListQuestionBank, "STUDENT", 5, params, "/", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("students must not browse the question bank, got %d", w.Code)
+	}
+}
+
+func TestExamRulesDrawRandomPaperPerStudent(t *testing.T) {
+	withQuestionBankTestDB(t)
+	params := gin.Params{{Key: "id", Value: "1"}}
+	for i := 1; i <= 3; i++ {
+		addTestBankQuestion(t, fmt.Sprintf("栈题 %d", i), "medium", "栈")
+	}
+	addTestBankQuestion(t, "栈难题", "hard", "栈")
+	addTestBankQuestion(t, "队列题", "medium", "队列")
+
+	rule := `{"type":"SINGLE_CHOICE","tag":"栈","difficulty":"medium","count":4}`
+	if w := performRAGRequest(CreateExamQuestionRule, "INSTRUCTOR", 9, params, "/", rule); w.Code != http.StatusBadRequest {
+		t.Fatalf("rule asking for more questions than the bank has must be rejected, got %d", w.Code)
+	}
+	rule = `{"type":"SINGLE_CHOICE","tag":"栈","difficulty":"medium","count":2,"score":5}`
+	if w := performRAGRequest(CreateExamQuestionRule, "INSTRUCTOR", 9, params, "/", rule); w.Code != http.StatusOK {
+		t.Fatalf("create rule failed: %d %s", w.Code, w.Body.String())
+	}
+
+	papers := map[int64][]any{}
+	for _, studentID := range []int64{5, 6} {
+		w := performRAGRequest(GetExam, "STUDENT", studentID, params, "/", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("get exam failed: %d %s", w.Code, w.Body.String())
+		}
+		questions, _ := decodeResponseData(t, w.Body.Bytes())["questions"].([]any)
+		// 4 道固定题 + 2 道抽取题
+		if len(questions) != 6 {
+			t.Fatalf("expected 6 questions for student %d, got %d", studentID, len(questions))
+		}
+		papers[studentID] = questions[4:]
+	}
+	for _, raw := range papers[5] {
+		question := raw.(map[string]any)
+		if question["score"] != float64(5) || question["answer"] != nil {
+			t.Fatalf("drawn question must use the rule score and hide the answer, got %v", question)
+		}
+	}
+
+	// 再次打开考试拿到的是同一份试卷
+	w := performRAGRequest(GetExam, "STUDENT", 5, params, "/", "")
+	again, _ := decodeResponseData(t, w.Body.Bytes())["questions"].([]any)
+	for i, raw := range again[4:] {
+		if raw.(map[string]any)["id"] != papers[5][i].(map[string]any)["id"] {
+			t.Fatalf("paper must be stable across requests, got %v then %v", papers[5], again[4:])
+		}
+	}
+
+	if w := performRAGRequest(CreateExamQuestionRule, "INSTRUCTOR", 9, params, "/", rule); w.Code != http.StatusBadRequest {
+		t.Fatalf("rules must be locked once papers exist, got %d", w.Code)
+	}
+
+	// 教师看到的是固定题目和抽题规则，而不是题目池
+	w = performRAGRequest(GetExam, "INSTRUCTOR", 9, params, "/", "")
+	data := decodeResponseData(t, w.Body.Bytes())
+	if questions, _ := data["questions"].([]any); len(questions) != 4 {
+		t.Fatalf("teacher view must only list fixed questions, got %d", len(questions))
+	}
+	if rules, _ := data["rules"].([]any); len(rules) != 1 {
+		t.Fatalf("teacher view must list the rules, got %v", data["rules"])
+	}
+
+	drawn := papers[5][0].(map[string]any)
+	body := fmt.Sprintf(`{"answers":[{"questionId":%d,"answer":%q}]}`, int64(drawn["id"].(float64)), shownLetter(t, drawn, "对"))
+	if w := performRAGRequest(SubmitExam, "STUDENT", 5, params, "/", body); w.Code != http.StatusOK {
+		t.Fatalf("submit exam failed: %d %s", w.Code, w.Body.String())
+	}
+	var total float64
+	database.DB.QueryRow(`SELECT total_score FROM exam_submissions WHERE student_id = 5`).Scan(&total)
+	if total != 5 {
+		t.Fatalf("drawn question from the student's paper must be graded, got %v", total)
+	}
+
+	var used int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM question_bank WHERE use_count > 0 AND difficulty = 'hard'`).Scan(&used)
+	if used != 0 {
+		t.Fatal("questions outside the rule must never be drawn")
+	}
+}
+
+func TestExamRulesValidateTypeAndTolerateDeletedBankQuestions(t *testing.T) {
+	withQuestionBankTestDB(t)
+	params := gin.Params{{Key: "id", Value: "1"}}
+	first := addTestBankQuestion(t, "栈题 1", "medium", "栈")
+	addTestBankQuestion(t, "栈题 2", "medium", "栈")
+
+	if w := performRAGRequest(CreateExamQuestionRule, "INSTRUCTOR", 9, params, "/", `{"type":"ESSAY","count":1}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("rule with an unknown type must be rejected, got %d", w.Code)
+	}
+	if w := performRAGRequest(CreateExamQuestionRule, "INSTRUCTOR", 9, params, "/", `{"type":"single_choice","tag":"栈","count":2}`); w.Code != http.StatusOK {
+		t.Fatalf("create rule failed: %d %s", w.Code, w.Body.String())
+	}
+
+	// 规则创建后题库题目被删掉，学生照常拿到按剩余题目抽取的试卷
+	if _, err := database.DB.Exec(`DELETE FROM question_bank WHERE id = ?`, first); err != nil {
+		t.Fatal(err)
+	}
+	w := performRAGRequest(GetExam, "STUDENT", 5, params, "/", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("get exam failed: %d %s", w.Code, w.Body.String())
+	}
+	if questions, _ := decodeResponseData(t, w.Body.Bytes())["questions"].([]any); len(questions) != 5 {
+		t.Fatalf("expected the 4 fixed questions and the remaining bank question, got %d", len(questions))
+	}
+}
+
+func TestExamQuestionSchemaAcceptsEveryQuestionType(t *testing.T) {
+	withQuestionBankTestDB(t)
+	for _, questionType := range database.ExamQuestionTypes {
+		if !examQuestionTypes[questionType] {
+			t.Fatalf("%s missing from the handler type set", questionType)
+		}
+		if _, err := database.DB.Exec(
+			`INSERT INTO exam_questions (exam_id, type, stem, answer, score) VALUES (1, ?, '题干', '', 1)`, questionType,
+		); err != nil {
+			t.Fatalf("exam_questions must accept %s: %v", questionType, err)
+		}
+	}
+	if _, err := database.DB.Exec(`INSERT INTO exam_questions (exam_id, type, stem, answer, score) VALUES (1, 'ESSAY', '题干', '', 1)`); err == nil {
+		t.Fatal("unknown question types must be rejected by the schema")
+	}
+}
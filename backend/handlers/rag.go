@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -17,14 +21,12 @@ import (
 )
 
 const (
-	ragMaxChunks               = 200
-	ragChunkSize               = 600
-	ragChunkOverlap            = 80
-	ragTopK                    = 5
-	dashScopeCompatibleBaseURL = "https://dashscope.aliyuncs.com/compatible-mode/v1"
-	dashScopeDefaultLLMModel   = "qwen-plus"
-	dashScopeDefaultEmbedModel = "text-embedding-v4"
-	dashScopeEmbedBatchSize    = 10
+	ragChunkSize          = 600
+	ragChunkOverlap       = 80
+	ragChunkMaxTokens     = 400
+	ragTopK               = 5
+	ragHistoryPairs       = 5
+	ragMaxQueryExpansions = 3
 )
 
 type ragSource struct {
@@ -32,34 +34,84 @@ type ragSource struct {
 	DocumentID int64  `json:"documentId"`
 	Filename   string `json:"filename"`
 	ChunkIndex int    `json:"chunkIndex"`
+	Citation   int    `json:"citation"`
+	Page       int    `json:"page,omitempty"`
+	Slide      int    `json:"slide,omitempty"`
+	Sheet      string `json:"sheet,omitempty"`
+	Section    string `json:"section,omitempty"`
+	Location   string `json:"location,omitempty"`
 	Content    string `json:"content"`
+	// RerankScore 为重排模型给出的相关度（0-1），未重排时省略
+	RerankScore float64 `json:"rerankScore,omitempty"`
+	// Canonical 为 true 表示来源是教师撰写的标准答案
+	Canonical bool `json:"canonical,omitempty"`
+}
+
+// ragKnowledgeLink 后台生成的回答（讨论草稿、错题讲解）所引用的课程资料，Citation 对应回答中的 [n] 标注
+type ragKnowledgeLink struct {
+	Citation   int    `json:"citation"`
+	DocumentID int64  `json:"documentId"`
+	ChunkID    int64  `json:"chunkId"`
+	Filename   string `json:"filename"`
+	Section    string `json:"section,omitempty"`
+	Location   string `json:"location,omitempty"`
+	Canonical  bool   `json:"canonical,omitempty"`
+}
+
+func ragKnowledgeLinks(sources []ragSource) []ragKnowledgeLink {
+	links := make([]ragKnowledgeLink, 0, len(sources))
+	for _, source := range sources {
+		links = append(links, ragKnowledgeLink{
+			Citation:   source.Citation,
+			DocumentID: source.DocumentID,
+			ChunkID:    source.ChunkID,
+			Filename:   source.Filename,
+			Section:    source.Section,
+			Location:   source.Location,
+			Canonical:  source.Canonical,
+		})
+	}
+	return links
 }
 
 type ragQueryHistoryItem struct {
-	ID        int64       `json:"id"`
-	UserID    int64       `json:"user_id"`
-	SessionID string      `json:"session_id"`
-	Question  string      `json:"question"`
-	Answer    string      `json:"answer"`
-	Sources   []ragSource `json:"sources"`
-	CreatedAt string      `json:"created_at"`
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	SessionID string `json:"session_id"`
+	Question  string `json:"question"`
+	// RewrittenQuery 为实际用于检索的问题，仅在与原问题不同时返回
+	RewrittenQuery  string              `json:"rewritten_query,omitempty"`
+	ExpandedQueries []string            `json:"expanded_queries,omitempty"`
+	Answer          string              `json:"answer"`
+	Sources         []ragSource         `json:"sources"`
+	Attribution     *ragpkg.Attribution `json:"attribution,omitempty"`
+	NoEvidence      bool                `json:"no_evidence"`
+	Feedback        *ragQueryFeedback   `json:"feedback,omitempty"`
+	CreatedAt       string              `json:"created_at"`
 }
 
 type storedRAGChunk struct {
 	ragpkg.Chunk
 	ChunkIndex int
 	Filename   string
+	Meta       ragpkg.ChunkMeta
 }
 
-type ragConfig struct {
-	APIKey             string
-	BaseURL            string
-	LLMModel           string
-	EmbeddingModel     string
-	EmbeddingBatchSize int
-	Provider           string
+// ragIndexStore 持久化的课程向量索引，未初始化时检索退化为全表暴力比对
+var ragIndexStore *ragpkg.IndexStore
+
+// InitRAGIndex 在 dir 下初始化课程向量索引存储（通常位于 SQLite 数据库同级目录）
+func InitRAGIndex(dir string) {
+	ragIndexStore = ragpkg.NewIndexStore(dir)
+	// 索引落盘失败不影响检索，下次启动时会按数据库重建
+	ragIndexStore.OnSaveError = func(courseID int64, err error) {
+		utils.GetLogger().Warn("failed to save rag vector index", zap.Int64("courseID", courseID), zap.Error(err))
+	}
 }
 
+// ragConfig 模型提供方配置，所有对话与向量化调用都经由 newProvider 构造的 Provider
+type ragConfig = ragpkg.ProviderConfig
+
 func isCourseInstructorOrAdmin(c *gin.Context, courseID int64) bool {
 	ok, err := canManageCourse(c, courseID)
 	return err == nil && ok
@@ -71,39 +123,96 @@ func isCourseAccessible(c *gin.Context, courseID int64) bool {
 }
 
 func getRAGConfig(c *gin.Context) (ragConfig, error) {
-	cfg := ragConfig{Provider: getRAGProvider(c)}
-	useDashScope := providerIsDashScope(cfg.Provider)
+	return resolveRAGConfig(c.GetHeader("X-RAG-API-Key"), getRAGProvider(c))
+}
 
-	cfg.APIKey = strings.TrimSpace(c.GetHeader("X-RAG-API-Key"))
-	if cfg.APIKey == "" && useDashScope {
-		cfg.APIKey = strings.TrimSpace(os.Getenv("DASHSCOPE_API_KEY"))
-	}
-	if cfg.APIKey == "" {
-		cfg.APIKey = strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
-	}
-	if cfg.APIKey == "" {
-		cfg.APIKey = strings.TrimSpace(os.Getenv("DASHSCOPE_API_KEY"))
-	}
-	if cfg.APIKey == "" {
-		return cfg, fmt.Errorf("缺少 RAG API Key，请在页面中输入个人 Key，或配置 OPENAI_API_KEY / DASHSCOPE_API_KEY")
+// resolveRAGConfig 按个人 Key 与提供方解析模型配置，个人 Key 为空时回退到环境变量；
+// 后台任务没有请求上下文时也通过它取得配置。这是选择模型提供方的唯一入口：
+// dashscope 走百炼原生接口，anthropic 走 Messages API（向量化借用 OpenAI 兼容接口），其余走 OpenAI 兼容接口。
+// LLM_FALLBACKS 配置的备用提供方附在 Fallbacks 中，主提供方失败时依次改用
+func resolveRAGConfig(apiKey, provider string) (ragConfig, error) {
+	cfg, err := resolveProviderConfig(apiKey, provider)
+	if err != nil {
+		return cfg, err
 	}
+	cfg.Fallbacks = resolveRAGFallbacks()
+	return cfg, nil
+}
 
-	cfg.BaseURL = strings.TrimSpace(os.Getenv("OPENAI_BASE_URL"))
-	if useDashScope {
-		cfg.BaseURL = dashScopeCompatibleBaseURL
-	}
-	cfg.LLMModel = strings.TrimSpace(os.Getenv("LLM_MODEL"))
-	if useDashScope {
-		cfg.LLMModel = dashScopeDefaultLLMModel
+// resolveRAGFallbacks 解析 LLM_FALLBACKS，格式为逗号分隔的 provider[:model]，
+// 例如 "dashscope:qwen-turbo,openai:gpt-4o-mini"。备用提供方只使用环境变量中的 Key，缺少 Key 的条目跳过
+func resolveRAGFallbacks() []ragConfig {
+	var fallbacks []ragConfig
+	for _, entry := range strings.Split(os.Getenv("LLM_FALLBACKS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		provider, model, _ := strings.Cut(entry, ":")
+		cfg, err := resolveProviderConfig("", strings.ToLower(strings.TrimSpace(provider)))
+		if err != nil {
+			utils.GetLogger().Warn("skip llm fallback without api key", zap.String("fallback", entry))
+			continue
+		}
+		if model = strings.TrimSpace(model); model != "" {
+			cfg.LLMModel = model
+		}
+		fallbacks = append(fallbacks, cfg)
 	}
-	cfg.EmbeddingModel = strings.TrimSpace(os.Getenv("EMBEDDING_MODEL"))
-	if useDashScope {
-		cfg.EmbeddingModel = dashScopeDefaultEmbedModel
+	return fallbacks
+}
+
+// resolveProviderConfig 解析单个提供方的配置
+func resolveProviderConfig(apiKey, provider string) (ragConfig, error) {
+	cfg := ragConfig{Provider: provider}
+	cfg.APIKey = strings.TrimSpace(apiKey)
+	cfg.EmbeddingBatchSize = getEmbeddingBatchSize()
+
+	switch ragpkg.NormalizeProvider(provider) {
+	case ragpkg.ProviderDashScope:
+		cfg.APIKey = firstNonEmpty(cfg.APIKey, os.Getenv("DASHSCOPE_API_KEY"), os.Getenv("OPENAI_API_KEY"))
+		cfg.BaseURL = strings.TrimSpace(os.Getenv("DASHSCOPE_BASE_URL"))
+		cfg.LLMModel = strings.TrimSpace(os.Getenv("DASHSCOPE_LLM_MODEL"))
+		cfg.EmbeddingModel = strings.TrimSpace(os.Getenv("DASHSCOPE_EMBEDDING_MODEL"))
+		if cfg.APIKey == "" {
+			return cfg, fmt.Errorf("缺少 RAG API Key，请在页面中输入个人 Key，或配置 DASHSCOPE_API_KEY")
+		}
+	case ragpkg.ProviderAnthropic:
+		cfg.APIKey = firstNonEmpty(cfg.APIKey, os.Getenv("ANTHROPIC_API_KEY"))
+		cfg.BaseURL = strings.TrimSpace(os.Getenv("ANTHROPIC_BASE_URL"))
+		cfg.LLMModel = strings.TrimSpace(os.Getenv("ANTHROPIC_MODEL"))
+		cfg.EmbeddingAPIKey = strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
+		cfg.EmbeddingBaseURL = strings.TrimSpace(os.Getenv("OPENAI_BASE_URL"))
+		cfg.EmbeddingModel = strings.TrimSpace(os.Getenv("EMBEDDING_MODEL"))
+		if cfg.APIKey == "" {
+			return cfg, fmt.Errorf("缺少 RAG API Key，请在页面中输入个人 Key，或配置 ANTHROPIC_API_KEY")
+		}
+	default:
+		cfg.APIKey = firstNonEmpty(cfg.APIKey, os.Getenv("OPENAI_API_KEY"), os.Getenv("DASHSCOPE_API_KEY"))
+		cfg.BaseURL = strings.TrimSpace(os.Getenv("OPENAI_BASE_URL"))
+		cfg.LLMModel = strings.TrimSpace(os.Getenv("LLM_MODEL"))
+		cfg.EmbeddingModel = strings.TrimSpace(os.Getenv("EMBEDDING_MODEL"))
+		if cfg.APIKey == "" {
+			return cfg, fmt.Errorf("缺少 RAG API Key，请在页面中输入个人 Key，或配置 OPENAI_API_KEY / DASHSCOPE_API_KEY")
+		}
 	}
-	cfg.EmbeddingBatchSize = getEmbeddingBatchSize(useDashScope)
 	return cfg, nil
 }
 
+// newRAGProvider 按配置构造模型提供方
+func newRAGProvider(cfg ragConfig) ragpkg.Provider {
+	return ragpkg.NewProvider(cfg)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
 func getRAGProvider(c *gin.Context) string {
 	provider := strings.ToLower(strings.TrimSpace(c.GetHeader("X-RAG-Provider")))
 	if provider == "" {
@@ -115,25 +224,14 @@ func getRAGProvider(c *gin.Context) string {
 	return provider
 }
 
-func providerIsDashScope(provider string) bool {
-	switch provider {
-	case "aliyun", "ali", "alibaba", "dashscope", "bailian":
-		return true
-	default:
-		return false
-	}
-}
-
-func getEmbeddingBatchSize(useDashScope bool) int {
+// getEmbeddingBatchSize 读取 EMBEDDING_BATCH_SIZE，未配置时由提供方决定（百炼默认 10 条一批）
+func getEmbeddingBatchSize() int {
 	raw := strings.TrimSpace(os.Getenv("EMBEDDING_BATCH_SIZE"))
 	if raw != "" {
 		if size, err := strconv.Atoi(raw); err == nil && size > 0 {
 			return size
 		}
 	}
-	if useDashScope {
-		return dashScopeEmbedBatchSize
-	}
 	return 0
 }
 
@@ -195,14 +293,18 @@ func loadRecentRAGHistory(courseID, userID int64, sessionID string, limit int) (
 	return history, nil
 }
 
-func fetchCourseChunks(courseID int64) ([]storedRAGChunk, error) {
+// ragChunkModelFilter 只取由指定模型生成向量的分块；未记录模型的历史分块视为兼容
+const ragChunkModelFilter = `(COALESCE(c.embedding_model, '') = '' OR c.embedding_model = ?)`
+
+func fetchCourseChunks(courseID int64, model string) ([]storedRAGChunk, error) {
 	rows, err := database.DB.Query(
 		`SELECT c.id, c.doc_id, COALESCE(c.chunk_index, 0), c.content, c.embedding, d.filename
          FROM rag_chunks c
          JOIN rag_documents d ON d.id = c.doc_id
          WHERE COALESCE(c.course_id, d.course_id) = ? AND c.embedding IS NOT NULL AND c.embedding != ''
+           AND `+ragChunkModelFilter+`
          ORDER BY c.doc_id ASC, COALESCE(c.chunk_index, c.id) ASC`,
-		courseID,
+		courseID, model,
 	)
 	if err != nil {
 		return nil, err
@@ -225,18 +327,128 @@ func fetchCourseChunks(courseID int64) ([]storedRAGChunk, error) {
 	return chunks, nil
 }
 
+// courseChunkVersion 课程中由 model 向量化的有效分块版本，用于判断索引是否过期
+func courseChunkVersion(courseID int64, model string) (ragpkg.IndexVersion, error) {
+	var version ragpkg.IndexVersion
+	err := database.DB.QueryRow(
+		`SELECT COUNT(*), COALESCE(SUM(c.id), 0)
+         FROM rag_chunks c
+         JOIN rag_documents d ON d.id = c.doc_id
+         WHERE COALESCE(c.course_id, d.course_id) = ? AND c.embedding IS NOT NULL AND c.embedding != ''
+           AND `+ragChunkModelFilter,
+		courseID, model,
+	).Scan(&version.Count, &version.IDSum)
+	return version, err
+}
+
+func fetchChunksByIDs(chunkIDs []int64) ([]storedRAGChunk, error) {
+	if len(chunkIDs) == 0 {
+		return nil, nil
+	}
+
+	placeholders := make([]string, 0, len(chunkIDs))
+	args := make([]interface{}, 0, len(chunkIDs))
+	for _, id := range chunkIDs {
+		placeholders = append(placeholders, "?")
+		args = append(args, id)
+	}
+
+	rows, err := database.DB.Query(
+		fmt.Sprintf(
+			`SELECT c.id, c.doc_id, COALESCE(c.chunk_index, 0), c.content, d.filename, COALESCE(c.metadata, '')
+             FROM rag_chunks c
+             JOIN rag_documents d ON d.id = c.doc_id
+             WHERE c.id IN (%s)`,
+			strings.Join(placeholders, ","),
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chunkMap := make(map[int64]storedRAGChunk, len(chunkIDs))
+	for rows.Next() {
+		var item storedRAGChunk
+		var metadata string
+		if err := rows.Scan(&item.ID, &item.DocID, &item.ChunkIndex, &item.Content, &item.Filename, &metadata); err != nil {
+			continue
+		}
+		item.Meta = ragpkg.DecodeChunkMeta(metadata)
+		chunkMap[item.ID] = item
+	}
+
+	chunks := make([]storedRAGChunk, 0, len(chunkIDs))
+	for _, id := range chunkIDs {
+		if chunk, ok := chunkMap[id]; ok {
+			chunks = append(chunks, chunk)
+		}
+	}
+	return chunks, nil
+}
+
+// retrieveRAGChunks 通过课程向量/关键词索引取回与问题最相关的分块，只检索 model 生成的向量
+func retrieveRAGChunks(courseID int64, model string, expected ragpkg.IndexVersion, query ragpkg.RetrievalQuery) ([]storedRAGChunk, error) {
+	loader := func() ([]ragpkg.Chunk, error) {
+		stored, err := fetchCourseChunks(courseID, model)
+		if err != nil {
+			return nil, err
+		}
+		chunks := make([]ragpkg.Chunk, 0, len(stored))
+		for _, chunk := range stored {
+			chunks = append(chunks, chunk.Chunk)
+		}
+		return chunks, nil
+	}
+
+	var results []ragpkg.SearchResult
+	if ragIndexStore != nil {
+		var err error
+		results, err = ragIndexStore.Retrieve(courseID, model, expected, loader, query)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		chunks, err := loader()
+		if err != nil {
+			return nil, err
+		}
+		vector := ragpkg.NewFlatIndex()
+		keyword := ragpkg.NewBM25Index()
+		for _, chunk := range chunks {
+			vector.Add(chunk.ID, chunk.Embedding)
+			keyword.Add(chunk.ID, chunk.Content)
+		}
+		results = ragpkg.Retrieve(vector, keyword, query)
+	}
+
+	ids := make([]int64, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	return fetchChunksByIDs(ids)
+}
+
 func buildRAGSources(chunks []storedRAGChunk) ([]ragSource, []string, []int64) {
 	sources := make([]ragSource, 0, len(chunks))
 	contexts := make([]string, 0, len(chunks))
 	sourceIDs := make([]int64, 0, len(chunks))
 
-	for _, chunk := range chunks {
+	for i, chunk := range chunks {
 		sources = append(sources, ragSource{
 			ChunkID:    chunk.ID,
 			DocumentID: chunk.DocID,
 			Filename:   chunk.Filename,
 			ChunkIndex: chunk.ChunkIndex,
+			Citation:   i + 1,
+			Page:       chunk.Meta.Page,
+			Slide:      chunk.Meta.Slide,
+			Sheet:      chunk.Meta.SheetName,
+			Section:    chunk.Meta.Section,
+			Location:   chunk.Meta.Label(),
 			Content:    chunk.Content,
+			Canonical:  chunk.Meta.Canonical,
 		})
 		contexts = append(contexts, chunk.Content)
 		sourceIDs = append(sourceIDs, chunk.ID)
@@ -272,7 +484,7 @@ func loadSourcesByChunkIDs(chunkIDs []int64) ([]ragSource, error) {
 
 	rows, err := database.DB.Query(
 		fmt.Sprintf(
-			`SELECT c.id, c.doc_id, d.filename, COALESCE(c.chunk_index, 0), c.content
+			`SELECT c.id, c.doc_id, d.filename, COALESCE(c.chunk_index, 0), c.content, COALESCE(c.metadata, '')
              FROM rag_chunks c
              JOIN rag_documents d ON d.id = c.doc_id
              WHERE c.id IN (%s)`,
@@ -288,30 +500,49 @@ func loadSourcesByChunkIDs(chunkIDs []int64) ([]ragSource, error) {
 	sourceMap := make(map[int64]ragSource, len(chunkIDs))
 	for rows.Next() {
 		var source ragSource
-		if err := rows.Scan(&source.ChunkID, &source.DocumentID, &source.Filename, &source.ChunkIndex, &source.Content); err != nil {
+		var metadata string
+		if err := rows.Scan(&source.ChunkID, &source.DocumentID, &source.Filename, &source.ChunkIndex, &source.Content, &metadata); err != nil {
 			continue
 		}
+		meta := ragpkg.DecodeChunkMeta(metadata)
+		source.Page, source.Slide, source.Sheet, source.Section, source.Location = meta.Page, meta.Slide, meta.SheetName, meta.Section, meta.Label()
 		sourceMap[source.ChunkID] = source
 	}
 
 	sources := make([]ragSource, 0, len(chunkIDs))
-	for _, id := range chunkIDs {
+	for i, id := range chunkIDs {
 		if source, ok := sourceMap[id]; ok {
+			// 保存顺序即提示词中的资料编号，已删除的分块不影响其余编号
+			source.Citation = i + 1
 			sources = append(sources, source)
 		}
 	}
 	return sources, nil
 }
 
-func saveRAGQuery(courseID, userID int64, sessionID, question, answer string, sourceIDs []int64) {
-	sourceJSON, _ := json.Marshal(sourceIDs)
-	if _, err := database.DB.Exec(
-		`INSERT INTO rag_queries(course_id, user_id, session_id, question, answer, source_chunks, created_at)
-         VALUES(?,?,?,?,?,?,?)`,
-		courseID, userID, sessionID, question, answer, string(sourceJSON), time.Now(),
-	); err != nil {
+// saveRAGQuery 记录问答历史、改写后的检索问题及逐句来源归属并返回记录 ID，写入失败时返回 0。
+// 兜底回答或模型声明资料不足的回答标记为 no_evidence，进入教师审核队列
+func saveRAGQuery(plan *ragQueryPlan, answer string, attribution ragpkg.Attribution) int64 {
+	noEvidence := plan.Answer != "" || isRAGNoEvidenceAnswer(answer)
+	sourceJSON, _ := json.Marshal(plan.SourceIDs)
+	attributionJSON, _ := json.Marshal(attribution)
+	var expandedJSON interface{}
+	if len(plan.ExpandedQueries) > 0 {
+		raw, _ := json.Marshal(plan.ExpandedQueries)
+		expandedJSON = string(raw)
+	}
+	res, err := database.DB.Exec(
+		`INSERT INTO rag_queries(course_id, user_id, session_id, question, rewritten_query, expanded_queries, answer, source_chunks, attribution, no_evidence, created_at)
+         VALUES(?,?,?,?,?,?,?,?,?,?,?)`,
+		plan.CourseID, plan.UserID, plan.SessionID, plan.Question, plan.RewrittenQuery, expandedJSON,
+		answer, string(sourceJSON), string(attributionJSON), noEvidence, time.Now(),
+	)
+	if err != nil {
 		utils.GetLogger().Warn("failed to persist rag query", zap.Error(err))
+		return 0
 	}
+	id, _ := res.LastInsertId()
+	return id
 }
 
 func parseCourseID(c *gin.Context) (int64, bool) {
@@ -323,6 +554,7 @@ func parseCourseID(c *gin.Context) (int64, bool) {
 	return courseID, true
 }
 
+// UploadRAGDocument 校验并登记文档后立即返回，解析、分块与向量化由后台入库任务完成
 func UploadRAGDocument(c *gin.Context) {
 	courseID, ok := parseCourseID(c)
 	if !ok {
@@ -338,6 +570,9 @@ func UploadRAGDocument(c *gin.Context) {
 		utils.InternalServerError(c, cfgErr.Error())
 		return
 	}
+	if !enforceAIQuota(c, aiUsageScopeFromContext(c, courseID, aiFeatureRAGIngest)) {
+		return
+	}
 
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
@@ -346,81 +581,41 @@ func UploadRAGDocument(c *gin.Context) {
 	}
 	defer file.Close()
 
-	text, err := ragpkg.ExtractText(header.Filename, file)
-	if err != nil {
-		utils.BadRequest(c, "文档解析失败: "+err.Error())
-		return
-	}
-
-	charCount := len([]rune(text))
-	if charCount == 0 {
-		utils.BadRequest(c, "文档内容为空")
+	if !ragpkg.IsSupportedDocument(header.Filename) {
+		utils.BadRequest(c, "文档解析失败: 暂不支持的文档格式: "+strings.ToLower(filepath.Ext(header.Filename)))
 		return
 	}
-
-	chunks := ragpkg.ChunkText(text, ragChunkSize, ragChunkOverlap)
-	if len(chunks) == 0 {
-		utils.BadRequest(c, "文档内容为空")
+	strategy, ok := ragpkg.ParseChunkStrategy(c.PostForm("chunk_strategy"), header.Filename)
+	if !ok {
+		utils.BadRequest(c, "无效的分块策略，可选 fixed 或 structured")
 		return
 	}
-	if len(chunks) > ragMaxChunks {
-		chunks = chunks[:ragMaxChunks]
-	}
 
-	embedClient := &ragpkg.EmbedClient{
-		APIKey:    ragCfg.APIKey,
-		BaseURL:   ragCfg.BaseURL,
-		Model:     ragCfg.EmbeddingModel,
-		BatchSize: ragCfg.EmbeddingBatchSize,
-	}
-	embeddings, err := embedClient.Embed(chunks)
+	payload, err := io.ReadAll(file)
 	if err != nil {
-		utils.GetLogger().Error("rag embedding failed", zap.Error(err))
-		utils.InternalServerError(c, "文档向量化失败: "+err.Error())
+		utils.InternalServerError(c, "读取上传文档失败")
 		return
 	}
-
-	userID := getCurrentUserID(c)
-	tx, err := database.DB.Begin()
-	if err != nil {
-		utils.InternalServerError(c, "创建文档事务失败")
+	if len(payload) == 0 {
+		utils.BadRequest(c, "文档内容为空")
 		return
 	}
-	defer tx.Rollback() //nolint:errcheck
 
-	res, err := tx.Exec(
-		`INSERT INTO rag_documents(course_id, filename, char_count, chunk_count, created_by, created_at)
-         VALUES(?,?,?,?,?,?)`,
-		courseID, header.Filename, charCount, len(chunks), userID, time.Now(),
-	)
+	personalKey := strings.TrimSpace(c.GetHeader("X-RAG-API-Key")) != ""
+	docID, err := enqueueRAGIngest(courseID, getCurrentUserID(c), header.Filename, strategy, ragCfg, personalKey, payload)
 	if err != nil {
+		utils.GetLogger().Error("failed to enqueue rag ingest job", zap.Error(err))
 		utils.InternalServerError(c, "保存文档记录失败")
 		return
 	}
-	docID, _ := res.LastInsertId()
-
-	for i, content := range chunks {
-		embeddingJSON, _ := json.Marshal(embeddings[i])
-		if _, err := tx.Exec(
-			`INSERT INTO rag_chunks(doc_id, course_id, chunk_index, content, embedding, created_at)
-             VALUES(?,?,?,?,?,?)`,
-			docID, courseID, i, content, string(embeddingJSON), time.Now(),
-		); err != nil {
-			utils.InternalServerError(c, "保存文档分块失败")
-			return
-		}
-	}
-
-	if err := tx.Commit(); err != nil {
-		utils.InternalServerError(c, "提交文档失败")
-		return
-	}
+	// 入库完成时会再次失效；这里先清空，避免教师上传新资料后学生仍拿到旧回答
+	invalidateRAGAnswerCache(courseID)
 
-	utils.Success(c, gin.H{
-		"id":          docID,
-		"filename":    header.Filename,
-		"char_count":  charCount,
-		"chunk_count": len(chunks),
+	utils.SuccessWithCode(c, http.StatusAccepted, gin.H{
+		"id":             docID,
+		"filename":       header.Filename,
+		"status":         ragDocQueued,
+		"chunk_strategy": strategy,
 	})
 }
 
@@ -439,6 +634,10 @@ func ListRAGDocuments(c *gin.Context) {
                 d.filename,
                 COALESCE(d.char_count, 0),
                 COALESCE(d.chunk_count, 0),
+                COALESCE(d.chunk_strategy, 'fixed'),
+                COALESCE(d.status, 'ready'),
+                COALESCE(d.error, ''),
+                COALESCE(d.progress, 100),
                 COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', d.created_at), ''),
                 COALESCE(u.username, '')
          FROM rag_documents d
@@ -458,6 +657,10 @@ func ListRAGDocuments(c *gin.Context) {
 		Filename   string `json:"filename"`
 		CharCount  int    `json:"char_count"`
 		ChunkCount int    `json:"chunk_count"`
+		Strategy   string `json:"chunk_strategy"`
+		Status     string `json:"status"`
+		Error      string `json:"error,omitempty"`
+		Progress   int    `json:"progress"`
 		CreatedAt  string `json:"created_at"`
 		CreatedBy  string `json:"created_by"`
 	}
@@ -465,7 +668,7 @@ func ListRAGDocuments(c *gin.Context) {
 	result := make([]item, 0)
 	for rows.Next() {
 		var doc item
-		if err := rows.Scan(&doc.ID, &doc.Filename, &doc.CharCount, &doc.ChunkCount, &doc.CreatedAt, &doc.CreatedBy); err != nil {
+		if err := rows.Scan(&doc.ID, &doc.Filename, &doc.CharCount, &doc.ChunkCount, &doc.Strategy, &doc.Status, &doc.Error, &doc.Progress, &doc.CreatedAt, &doc.CreatedBy); err != nil {
 			continue
 		}
 		result = append(result, doc)
@@ -499,120 +702,467 @@ func DeleteRAGDocument(c *gin.Context) {
 		return
 	}
 
+	chunkIDs := make([]int64, 0)
+	if rows, err := database.DB.Query(`SELECT id FROM rag_chunks WHERE doc_id = ?`, docID); err == nil {
+		for rows.Next() {
+			var id int64
+			if rows.Scan(&id) == nil {
+				chunkIDs = append(chunkIDs, id)
+			}
+		}
+		rows.Close()
+	}
+
+	if _, err := database.DB.Exec(`DELETE FROM rag_ingest_jobs WHERE doc_id = ?`, docID); err != nil {
+		utils.InternalServerError(c, "删除文档入库任务失败")
+		return
+	}
+	if _, err := database.DB.Exec(`DELETE FROM rag_chunks WHERE doc_id = ?`, docID); err != nil {
+		utils.InternalServerError(c, "删除文档分块失败")
+		return
+	}
+	// 删除“教师标准答案”文档时，已解决问答不再指向被删的分块
+	database.DB.Exec( //nolint:errcheck
+		`UPDATE rag_queries SET canonical_chunk_id = NULL WHERE course_id = ? AND canonical_chunk_id IS NOT NULL
+         AND canonical_chunk_id NOT IN (SELECT id FROM rag_chunks WHERE course_id = ?)`,
+		courseID, courseID,
+	)
 	if _, err := database.DB.Exec(`DELETE FROM rag_documents WHERE id = ?`, docID); err != nil {
 		utils.InternalServerError(c, "删除文档失败")
 		return
 	}
 
+	if ragIndexStore != nil {
+		ragIndexStore.Remove(courseID, chunkIDs)
+	}
+	invalidateRAGAnswerCache(courseID)
+
 	utils.Success(c, gin.H{"deleted": true})
 }
 
-func QueryRAGExtended(c *gin.Context) {
+// ragQueryPlan 是检索完成、尚未调用模型时的问答上下文。
+// Answer 非空表示知识库为空或未检索到内容，直接返回该提示而不调用模型；
+// Cached 非空表示命中语义缓存，直接返回缓存的回答与来源。
+type ragQueryPlan struct {
+	CourseID  int64
+	UserID    int64
+	SessionID string
+	Question  string
+	// RewrittenQuery 为结合会话历史改写后用于检索的独立问题，未改写时与 Question 相同
+	RewrittenQuery string
+	// ExpandedQueries 为多查询扩展生成的其他检索说法
+	ExpandedQueries []string
+	Mode            ragpkg.RetrievalMode
+	Config          ragConfig
+	Answer          string
+	Sources         []ragSource
+	Contexts        []string
+	SourceIDs       []int64
+	History         []ragpkg.ChatMessage
+	// QueryVector 为改写后问题的向量，用于语义缓存
+	QueryVector []float32
+	// CacheKBVersion 为查找语义缓存前读到的知识库版本，生成的回答按该版本写入缓存；未查找缓存时为 nil
+	CacheKBVersion *int64
+	Cached         *ragCachedAnswer
+}
+
+// prepareRAGQuery 校验请求并完成检索，失败时已写出错误响应并返回 false
+func prepareRAGQuery(c *gin.Context) (*ragQueryPlan, bool) {
 	courseID, ok := parseCourseID(c)
 	if !ok {
-		return
+		return nil, false
 	}
 	if !isCourseAccessible(c, courseID) {
 		utils.Forbidden(c, "请先选课后再访问课程知识库")
-		return
+		return nil, false
 	}
 
 	var req struct {
-		Question  string `json:"question" binding:"required"`
-		SessionID string `json:"session_id"`
+		Question      string   `json:"question" binding:"required"`
+		SessionID     string   `json:"session_id"`
+		RetrievalMode string   `json:"retrieval_mode"`
+		VectorWeight  *float64 `json:"vector_weight"`
+		KeywordWeight *float64 `json:"keyword_weight"`
+		// Rewrite 是否结合会话历史改写追问，默认开启
+		Rewrite *bool `json:"rewrite"`
+		// ExpandQueries 多查询扩展的改写数量，0 表示不扩展
+		ExpandQueries int `json:"expand_queries"`
+		// Rerank 是否对召回结果重排，默认跟随 RAG_RERANK 配置
+		Rerank *bool `json:"rerank"`
+		// Cache 是否复用语义缓存中的回答，默认跟随 RAG_ANSWER_CACHE 配置
+		Cache *bool `json:"cache"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		utils.BadRequest(c, "请提供 question 字段")
-		return
+		return nil, false
+	}
+	if req.ExpandQueries < 0 || req.ExpandQueries > ragMaxQueryExpansions {
+		utils.BadRequest(c, fmt.Sprintf("expand_queries 取值范围为 0-%d", ragMaxQueryExpansions))
+		return nil, false
 	}
 
 	req.Question = strings.TrimSpace(req.Question)
 	if req.Question == "" {
 		utils.BadRequest(c, "问题不能为空")
-		return
+		return nil, false
+	}
+
+	retrieval := ragpkg.RetrievalQuery{Text: req.Question, K: ragTopK, VectorWeight: 1, KeywordWeight: 1}
+	mode, ok := ragpkg.ParseRetrievalMode(req.RetrievalMode)
+	if !ok {
+		utils.BadRequest(c, "retrieval_mode 仅支持 vector、keyword 或 hybrid")
+		return nil, false
+	}
+	retrieval.Mode = mode
+	if req.VectorWeight != nil {
+		retrieval.VectorWeight = *req.VectorWeight
+	}
+	if req.KeywordWeight != nil {
+		retrieval.KeywordWeight = *req.KeywordWeight
+	}
+	if retrieval.VectorWeight < 0 || retrieval.KeywordWeight < 0 {
+		utils.BadRequest(c, "检索权重不能为负数")
+		return nil, false
 	}
 
 	ragCfg, cfgErr := getRAGConfig(c)
 	if cfgErr != nil {
 		utils.InternalServerError(c, cfgErr.Error())
-		return
+		return nil, false
+	}
+	usageScope := aiUsageScopeFromContext(c, courseID, aiFeatureRAGQuery)
+	if !enforceAIQuota(c, usageScope) {
+		return nil, false
+	}
+	ragCfg = usageScope.meter(ragCfg)
+
+	opts := ragRetrieveOptions{
+		Retrieval:     retrieval,
+		TopK:          ragTopK,
+		Rewrite:       req.Rewrite == nil || *req.Rewrite,
+		ExpandQueries: req.ExpandQueries,
+	}
+	rerank := req.Rerank == nil || *req.Rerank
+	opts.UseCache = ragCacheEnabled() && (req.Cache == nil || *req.Cache) && ragCacheableRetrieval(retrieval, rerank, req.ExpandQueries)
+	if rerank {
+		opts.Reranker = newRAGReranker(ragCfg)
 	}
 
 	userID := getCurrentUserID(c)
-	sessionID := defaultSessionID(courseID, userID, req.SessionID)
+	plan := &ragQueryPlan{
+		CourseID:       courseID,
+		UserID:         userID,
+		SessionID:      defaultSessionID(courseID, userID, req.SessionID),
+		Question:       req.Question,
+		RewrittenQuery: req.Question,
+		Mode:           retrieval.Mode,
+		Config:         ragCfg,
+		Sources:        []ragSource{},
+	}
+
+	var err error
+	plan.History, err = loadRecentRAGHistory(courseID, userID, plan.SessionID, ragHistoryPairs)
+	if err != nil {
+		utils.GetLogger().Warn("failed to load rag history", zap.Error(err))
+	}
+	if err := plan.retrieve(c.Request.Context(), opts); err != nil {
+		utils.InternalServerError(c, err.Error())
+		return nil, false
+	}
+	return plan, true
+}
+
+// ragRetrieveOptions 描述一次检索的参数，问答接口与评测共用
+type ragRetrieveOptions struct {
+	Retrieval ragpkg.RetrievalQuery
+	// TopK 最终交给生成模型的分块数
+	TopK          int
+	Rewrite       bool
+	ExpandQueries int
+	// Reranker 为 nil 时不重排，直接取融合排序的前 TopK 个
+	Reranker ragpkg.Reranker
+	// UseCache 先按问题向量查找语义缓存，命中时跳过查询扩展、检索与重排；仅问答接口开启
+	UseCache bool
+}
+
+// retrieve 完成追问改写、查询扩展、向量化、混合检索与重排，结果写入 plan；ctx 取消时中止模型调用。
+// 知识库为空、没有命中或重排后资料不足时设置 plan.Answer 且返回 nil，命中语义缓存时设置 plan.Cached；
+// 返回的错误信息可直接展示给用户。
+func (p *ragQueryPlan) retrieve(ctx context.Context, opts ragRetrieveOptions) error {
+	retrieval := opts.Retrieval
+	// 启用重排时先多召回一些候选，再由重排模型挑出最相关的 TopK 个
+	retrieval.K = opts.TopK
+	if opts.Reranker != nil && retrieval.K < ragpkg.DefaultRerankCandidates {
+		retrieval.K = ragpkg.DefaultRerankCandidates
+	}
 
-	allChunks, err := fetchCourseChunks(courseID)
+	provider := newRAGProvider(p.Config)
+	chunkVersion, err := courseChunkVersion(p.CourseID, provider.ModelName())
 	if err != nil {
-		utils.InternalServerError(c, "读取课程知识库失败")
-		return
+		utils.GetLogger().Error("count rag chunks failed", zap.Error(err))
+		return fmt.Errorf("读取课程知识库失败")
 	}
-	if len(allChunks) == 0 {
-		utils.Success(c, gin.H{
-			"answer":     "当前课程还没有可用的知识库文档，请先由教师上传课程资料。",
-			"sources":    []ragSource{},
-			"session_id": sessionID,
-		})
-		return
+	if chunkVersion.Count == 0 {
+		p.Answer = "当前课程还没有可用的知识库文档，请先由教师上传课程资料。"
+		return nil
 	}
 
-	embedClient := &ragpkg.EmbedClient{
-		APIKey:    ragCfg.APIKey,
-		BaseURL:   ragCfg.BaseURL,
-		Model:     ragCfg.EmbeddingModel,
-		BatchSize: ragCfg.EmbeddingBatchSize,
+	// 追问（如“那第二点呢？”）单独检索几乎召回不到内容，先结合历史改写为独立问题；
+	// 改写或扩展失败时降级为原问题检索
+	if len(p.History) > 0 && opts.Rewrite {
+		rewritten, err := ragpkg.CondenseQuestion(ctx, provider, p.Question, p.History)
+		if err != nil {
+			utils.GetLogger().Warn("rag query rewrite failed", zap.Error(err))
+		}
+		p.RewrittenQuery = rewritten
 	}
-	queryEmbeddings, err := embedClient.Embed([]string{req.Question})
-	if err != nil || len(queryEmbeddings) == 0 || len(queryEmbeddings[0]) == 0 {
-		if err == nil {
-			err = fmt.Errorf("问题向量为空")
+	// 语义缓存按改写后的独立问题查找，命中时无需再扩展、检索和生成
+	if opts.UseCache && retrieval.Mode != ragpkg.RetrievalKeyword {
+		vectors, err := embedRAGQueries(ctx, provider, []string{p.RewrittenQuery})
+		if err != nil {
+			return err
 		}
-		utils.InternalServerError(c, "问题向量化失败: "+err.Error())
-		return
+		p.QueryVector = vectors[0]
+		if version, err := courseKBVersion(p.CourseID); err != nil {
+			utils.GetLogger().Warn("read rag kb version failed", zap.Error(err))
+		} else {
+			p.CacheKBVersion = &version
+			if cached := lookupRAGAnswerCache(p.CourseID, version, provider.ModelName(), p.QueryVector); cached != nil {
+				p.Cached = cached
+				p.Sources = cached.Sources
+				return nil
+			}
+		}
+	}
+	if opts.ExpandQueries > 0 {
+		expanded, err := ragpkg.ExpandQueries(ctx, provider, p.RewrittenQuery, opts.ExpandQueries)
+		if err != nil {
+			utils.GetLogger().Warn("rag query expansion failed", zap.Error(err))
+		}
+		p.ExpandedQueries = expanded
 	}
 
-	baseChunks := make([]ragpkg.Chunk, 0, len(allChunks))
-	chunkMap := make(map[int64]storedRAGChunk, len(allChunks))
-	for _, chunk := range allChunks {
-		baseChunks = append(baseChunks, chunk.Chunk)
-		chunkMap[chunk.ID] = chunk
+	retrieval.Text = p.RewrittenQuery
+	for _, query := range p.ExpandedQueries {
+		retrieval.Expansions = append(retrieval.Expansions, ragpkg.RetrievalQuery{Text: query})
+	}
+	if retrieval.Mode != ragpkg.RetrievalKeyword {
+		// 查找缓存时已向量化原问题，这里只需向量化扩展查询
+		queries := p.ExpandedQueries
+		if p.QueryVector == nil {
+			queries = append([]string{p.RewrittenQuery}, queries...)
+		}
+		queryEmbeddings, err := embedRAGQueries(ctx, provider, queries)
+		if err != nil {
+			return err
+		}
+		if p.QueryVector == nil {
+			p.QueryVector, queryEmbeddings = queryEmbeddings[0], queryEmbeddings[1:]
+		}
+		retrieval.Vector = p.QueryVector
+		for i := range retrieval.Expansions {
+			retrieval.Expansions[i].Vector = queryEmbeddings[i]
+		}
 	}
 
-	topBaseChunks := ragpkg.TopK(queryEmbeddings[0], baseChunks, ragTopK)
-	if len(topBaseChunks) == 0 {
-		utils.Success(c, gin.H{
-			"answer":     "当前课程资料中没有找到与问题相关的内容，请换个问法或先补充课程资料。",
-			"sources":    []ragSource{},
-			"session_id": sessionID,
-		})
-		return
+	selected, err := retrieveRAGChunks(p.CourseID, provider.ModelName(), chunkVersion, retrieval)
+	if err != nil {
+		utils.GetLogger().Error("retrieve rag chunks failed", zap.Error(err))
+		return fmt.Errorf("检索课程知识库失败")
+	}
+	if len(selected) == 0 {
+		p.Answer = "当前课程资料中没有找到与问题相关的内容，请换个问法或先补充课程资料。"
+		return nil
 	}
 
-	selected := make([]storedRAGChunk, 0, len(topBaseChunks))
-	for _, chunk := range topBaseChunks {
-		if full, ok := chunkMap[chunk.ID]; ok {
-			selected = append(selected, full)
+	var rerankScores map[int64]float64
+	if opts.Reranker != nil {
+		reranked, scores, err := rerankRAGChunks(ctx, opts.Reranker, p.RewrittenQuery, selected, opts.TopK, ragRerankThreshold())
+		switch {
+		case err != nil:
+			// 重排失败时退回融合排序的前 TopK 个，不影响正常回答
+			utils.GetLogger().Warn("rag rerank failed", zap.Error(err))
+		case len(reranked) == 0:
+			p.Answer = ragInsufficientEvidenceAnswer
+			return nil
+		default:
+			selected, rerankScores = reranked, scores
 		}
 	}
-	sources, contexts, sourceIDs := buildRAGSources(selected)
+	selected = prioritizeCanonicalChunks(selected)
+	if len(selected) > opts.TopK {
+		selected = selected[:opts.TopK]
+	}
 
-	history, err := loadRecentRAGHistory(courseID, userID, sessionID, 5)
+	p.Sources, p.Contexts, p.SourceIDs = buildRAGSources(selected)
+	for i := range p.Sources {
+		p.Sources[i].RerankScore = rerankScores[p.Sources[i].ChunkID]
+	}
+	return nil
+}
+
+// embedRAGQueries 向量化检索问题，任一向量为空都视为失败
+func embedRAGQueries(ctx context.Context, provider ragpkg.Provider, queries []string) ([][]float32, error) {
+	if len(queries) == 0 {
+		return nil, nil
+	}
+	queryEmbeddings, err := provider.Embed(ctx, queries)
+	if err == nil && len(queryEmbeddings) != len(queries) {
+		err = fmt.Errorf("问题向量为空")
+	}
+	for i := 0; err == nil && i < len(queryEmbeddings); i++ {
+		if len(queryEmbeddings[i]) == 0 {
+			err = fmt.Errorf("问题向量为空")
+		}
+	}
 	if err != nil {
-		utils.GetLogger().Warn("failed to load rag history", zap.Error(err))
+		return nil, fmt.Errorf("问题向量化失败: %v", err)
 	}
+	return queryEmbeddings, nil
+}
 
-	genClient := &ragpkg.GenClient{APIKey: ragCfg.APIKey, BaseURL: ragCfg.BaseURL, Model: ragCfg.LLMModel}
-	answer, err := genClient.GenerateWithHistory(req.Question, contexts, history)
+func (p *ragQueryPlan) provider() ragpkg.Provider {
+	return newRAGProvider(p.Config)
+}
+
+// attribute 把回答中的 [n] 标注映射到检索分块，并核验每个句子是否有资料依据
+func (p *ragQueryPlan) attribute(answer string) ragpkg.Attribution {
+	sources := make([]ragpkg.GroundingSource, 0, len(p.Sources))
+	for _, source := range p.Sources {
+		sources = append(sources, ragpkg.GroundingSource{ChunkID: source.ChunkID, Content: source.Content})
+	}
+	return ragpkg.AttributeAnswer(answer, sources, ragpkg.DefaultGroundingThreshold)
+}
+
+func QueryRAGExtended(c *gin.Context) {
+	plan, ok := prepareRAGQuery(c)
+	if !ok {
+		return
+	}
+	if plan.Answer != "" {
+		utils.Success(c, gin.H{
+			"answer":      plan.Answer,
+			"sources":     plan.Sources,
+			"session_id":  plan.SessionID,
+			"no_evidence": true,
+			"query_id":    saveRAGQuery(plan, plan.Answer, ragpkg.Attribution{}),
+		})
+		return
+	}
+	if cached := plan.Cached; cached != nil {
+		utils.Success(c, gin.H{
+			"answer":          cached.Answer,
+			"sources":         plan.Sources,
+			"attribution":     cached.Attribution,
+			"session_id":      plan.SessionID,
+			"retrieval_mode":  plan.Mode,
+			"rewritten_query": plan.RewrittenQuery,
+			"no_evidence":     false,
+			"cached":          true,
+			"query_id":        saveRAGQuery(plan, cached.Answer, cached.Attribution),
+		})
+		return
+	}
+
+	answer, err := ragpkg.GenerateAnswer(c.Request.Context(), plan.provider(), plan.Question, plan.Contexts, plan.History)
 	if err != nil {
 		utils.GetLogger().Error("rag generation failed", zap.Error(err))
 		utils.InternalServerError(c, "生成回答失败: "+err.Error())
 		return
 	}
 
-	saveRAGQuery(courseID, userID, sessionID, req.Question, answer, sourceIDs)
+	attribution := plan.attribute(answer)
+	queryID := saveRAGQuery(plan, answer, attribution)
+	storeRAGAnswerCache(plan, answer, attribution)
 	utils.Success(c, gin.H{
-		"answer":     answer,
-		"sources":    sources,
-		"session_id": sessionID,
+		"answer":           answer,
+		"sources":          plan.Sources,
+		"attribution":      attribution,
+		"session_id":       plan.SessionID,
+		"retrieval_mode":   plan.Mode,
+		"rewritten_query":  plan.RewrittenQuery,
+		"expanded_queries": plan.ExpandedQueries,
+		"no_evidence":      isRAGNoEvidenceAnswer(answer),
+		"cached":           false,
+		"query_id":         queryID,
+	})
+}
+
+// QueryRAGStream SSE 流式问答：先发送 sources 事件，再逐段发送 delta 事件，
+// 最后发送带已保存问答 ID 的 done 事件；生成失败时发送 error 事件。客户端断开时中止生成且不保存问答。
+// 命中语义缓存时以一个 delta 事件发送完整回答。
+func QueryRAGStream(c *gin.Context) {
+	plan, ok := prepareRAGQuery(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 禁用 Nginx 缓冲
+
+	send := func(event string, payload interface{}) error {
+		data, _ := json.Marshal(payload)
+		if _, err := fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, data); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	if err := send("sources", gin.H{
+		"sources":          plan.Sources,
+		"session_id":       plan.SessionID,
+		"retrieval_mode":   plan.Mode,
+		"rewritten_query":  plan.RewrittenQuery,
+		"expanded_queries": plan.ExpandedQueries,
+		"cached":           plan.Cached != nil,
+	}); err != nil {
+		return
+	}
+
+	if plan.Answer != "" {
+		queryID := saveRAGQuery(plan, plan.Answer, ragpkg.Attribution{})
+		send("delta", gin.H{"content": plan.Answer})                                         //nolint:errcheck
+		send("done", gin.H{"answer": plan.Answer, "query_id": queryID, "no_evidence": true}) //nolint:errcheck
+		return
+	}
+	if cached := plan.Cached; cached != nil {
+		queryID := saveRAGQuery(plan, cached.Answer, cached.Attribution)
+		send("delta", gin.H{"content": cached.Answer}) //nolint:errcheck
+		send("done", gin.H{                            //nolint:errcheck
+			"answer":      cached.Answer,
+			"attribution": cached.Attribution,
+			"no_evidence": false,
+			"cached":      true,
+			"query_id":    queryID,
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	answer, err := ragpkg.GenerateAnswerStream(ctx, plan.provider(), plan.Question, plan.Contexts, plan.History, func(delta string) error {
+		return send("delta", gin.H{"content": delta})
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			utils.GetLogger().Info("rag stream cancelled by client", zap.Int64("courseID", plan.CourseID))
+			return
+		}
+		utils.GetLogger().Error("rag stream generation failed", zap.Error(err))
+		send("error", gin.H{"message": "生成回答失败: " + err.Error()}) //nolint:errcheck
+		return
+	}
+
+	attribution := plan.attribute(answer)
+	queryID := saveRAGQuery(plan, answer, attribution)
+	storeRAGAnswerCache(plan, answer, attribution)
+	send("done", gin.H{ //nolint:errcheck
+		"answer":      answer,
+		"attribution": attribution,
+		"no_evidence": isRAGNoEvidenceAnswer(answer),
+		"query_id":    queryID,
 	})
 }
 
@@ -631,15 +1181,18 @@ func GetRAGQueryHistory(c *gin.Context) {
 	}
 
 	userID := getCurrentUserID(c)
-	query := `SELECT id, user_id, COALESCE(session_id, ''), question, answer, COALESCE(source_chunks, ''), created_at
-              FROM rag_queries
-              WHERE course_id = ?`
+	query := `SELECT q.id, q.user_id, COALESCE(q.session_id, ''), q.question, COALESCE(q.rewritten_query, ''), COALESCE(q.expanded_queries, ''),
+                     q.answer, COALESCE(q.source_chunks, ''), COALESCE(q.attribution, ''), COALESCE(q.no_evidence, 0), q.created_at,
+                     f.rating, COALESCE(f.comment, '')
+              FROM rag_queries q
+              LEFT JOIN rag_query_feedback f ON f.query_id = q.id AND f.user_id = q.user_id
+              WHERE q.course_id = ?`
 	args := []interface{}{courseID}
 	if !isCourseInstructorOrAdmin(c, courseID) {
-		query += ` AND user_id = ?`
+		query += ` AND q.user_id = ?`
 		args = append(args, userID)
 	}
-	query += ` ORDER BY created_at DESC LIMIT 50`
+	query += ` ORDER BY q.created_at DESC LIMIT 50`
 
 	rows, err := database.DB.Query(query, args...)
 	if err != nil {
@@ -652,12 +1205,29 @@ func GetRAGQueryHistory(c *gin.Context) {
 	for rows.Next() {
 		var item ragQueryHistoryItem
 		var answer sql.NullString
-		var rawSources string
+		var rewritten, rawExpanded, rawSources, rawAttribution, comment string
+		var rating sql.NullInt64
 		var createdAt time.Time
-		if err := rows.Scan(&item.ID, &item.UserID, &item.SessionID, &item.Question, &answer, &rawSources, &createdAt); err != nil {
+		if err := rows.Scan(&item.ID, &item.UserID, &item.SessionID, &item.Question, &rewritten, &rawExpanded,
+			&answer, &rawSources, &rawAttribution, &item.NoEvidence, &createdAt, &rating, &comment); err != nil {
 			continue
 		}
+		if rating.Valid {
+			item.Feedback = &ragQueryFeedback{Rating: int(rating.Int64), Comment: comment}
+		}
 		item.Answer = answer.String
+		if rewritten != item.Question {
+			item.RewrittenQuery = rewritten
+		}
+		if rawExpanded != "" {
+			_ = json.Unmarshal([]byte(rawExpanded), &item.ExpandedQueries)
+		}
+		if rawAttribution != "" {
+			var attribution ragpkg.Attribution
+			if json.Unmarshal([]byte(rawAttribution), &attribution) == nil {
+				item.Attribution = &attribution
+			}
+		}
 		item.CreatedAt = createdAt.Format(time.RFC3339)
 		item.Sources, _ = loadSourcesByChunkIDs(decodeSourceIDs(rawSources))
 		result = append(result, item)
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/online-education-platform/backend/database"
+	ragpkg "github.com/online-education-platform/backend/rag"
+	"github.com/online-education-platform/backend/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultRAGCacheThreshold 问题向量余弦相似度不低于该值才视为同一问题
+	defaultRAGCacheThreshold = 0.95
+	// ragCacheMaxAge 缓存回答的最长保留时间，知识库未变化时也定期重新生成
+	ragCacheMaxAge = 7 * 24 * time.Hour
+	// ragCacheScanLimit 每次查找最多比对的缓存条数（按最近命中排序）
+	ragCacheScanLimit = 500
+)
+
+// ragCachedAnswer 语义缓存命中的回答
+type ragCachedAnswer struct {
+	ID          int64
+	Answer      string
+	Sources     []ragSource
+	Attribution ragpkg.Attribution
+	Similarity  float32
+}
+
+// ragCacheEnabled RAG_ANSWER_CACHE=off 时关闭语义缓存
+func ragCacheEnabled() bool {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("RAG_ANSWER_CACHE"))) != "off"
+}
+
+// ragCacheableRetrieval 缓存键不含检索参数，只有默认检索（混合检索、等权重、开启重排、不扩展查询）
+// 才查找和写入语义缓存，避免不同参数检索出的回答相互命中
+func ragCacheableRetrieval(retrieval ragpkg.RetrievalQuery, rerank bool, expandQueries int) bool {
+	return retrieval.Mode == ragpkg.RetrievalHybrid && retrieval.VectorWeight == 1 && retrieval.KeywordWeight == 1 &&
+		rerank && expandQueries == 0
+}
+
+func ragCacheThreshold() float32 {
+	raw := strings.TrimSpace(os.Getenv("RAG_CACHE_THRESHOLD"))
+	if raw != "" {
+		if threshold, err := strconv.ParseFloat(raw, 64); err == nil && threshold > 0 && threshold <= 1 {
+			return float32(threshold)
+		}
+	}
+	return defaultRAGCacheThreshold
+}
+
+// courseKBVersion 返回课程知识库的当前版本号，从未变更过时为 0
+func courseKBVersion(courseID int64) (int64, error) {
+	var version int64
+	err := database.DB.QueryRow(`SELECT version FROM rag_kb_versions WHERE course_id = ?`, courseID).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return version, err
+}
+
+// invalidateRAGAnswerCache 课程知识库变化后递增版本号并清空该课程的缓存回答；
+// 版本号保证并发生成中的旧回答即使写入也不会再被命中
+func invalidateRAGAnswerCache(courseID int64) {
+	logger := utils.GetLogger()
+	if _, err := database.DB.Exec(
+		`INSERT INTO rag_kb_versions (course_id, version, updated_at) VALUES (?, 1, ?)
+		 ON CONFLICT(course_id) DO UPDATE SET version = version + 1, updated_at = excluded.updated_at`,
+		courseID, time.Now(),
+	); err != nil {
+		logger.Warn("bump rag kb version failed", zap.Int64("courseID", courseID), zap.Error(err))
+	}
+	if _, err := database.DB.Exec(`DELETE FROM rag_answer_cache WHERE course_id = ?`, courseID); err != nil {
+		logger.Warn("clear rag answer cache failed", zap.Int64("courseID", courseID), zap.Error(err))
+	}
+}
+
+// lookupRAGAnswerCache 在指定知识库版本的缓存中找与问题向量最相似的回答，低于阈值时返回 nil。
+// 缓存不可用时只记日志，按未命中处理
+func lookupRAGAnswerCache(courseID, version int64, model string, vector []float32) *ragCachedAnswer {
+	rows, err := database.DB.Query(
+		`SELECT id, embedding, answer, sources, COALESCE(attribution, '')
+		 FROM rag_answer_cache
+		 WHERE course_id = ? AND kb_version = ? AND embedding_model = ? AND created_at >= ?
+		 ORDER BY COALESCE(last_hit_at, created_at) DESC
+		 LIMIT ?`,
+		courseID, version, model, time.Now().Add(-ragCacheMaxAge), ragCacheScanLimit,
+	)
+	if err != nil {
+		utils.GetLogger().Warn("query rag answer cache failed", zap.Error(err))
+		return nil
+	}
+	defer rows.Close()
+
+	threshold := ragCacheThreshold()
+	var best *ragCachedAnswer
+	var bestSources, bestAttribution string
+	for rows.Next() {
+		var id int64
+		var rawEmbedding, answer, rawSources, rawAttribution string
+		if err := rows.Scan(&id, &rawEmbedding, &answer, &rawSources, &rawAttribution); err != nil {
+			continue
+		}
+		var embedding []float32
+		if json.Unmarshal([]byte(rawEmbedding), &embedding) != nil || len(embedding) != len(vector) {
+			continue
+		}
+		similarity := ragpkg.CosineSimilarity(vector, embedding)
+		if similarity < threshold || (best != nil && similarity <= best.Similarity) {
+			continue
+		}
+		best = &ragCachedAnswer{ID: id, Answer: answer, Similarity: similarity}
+		bestSources, bestAttribution = rawSources, rawAttribution
+	}
+	if best == nil {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(bestSources), &best.Sources); err != nil {
+		return nil
+	}
+	if bestAttribution != "" {
+		_ = json.Unmarshal([]byte(bestAttribution), &best.Attribution)
+	}
+	database.DB.Exec( //nolint:errcheck
+		`UPDATE rag_answer_cache SET hit_count = hit_count + 1, last_hit_at = ? WHERE id = ?`,
+		time.Now(), best.ID,
+	)
+	return best
+}
+
+// storeRAGAnswerCache 缓存一次成功生成的回答。只缓存没有会话历史、依据资料作答的回答：
+// 带历史生成的回答可能依赖上文，资料不足的回答在补充资料前也不值得复用。
+// 回答记在检索前读到的知识库版本下，生成期间知识库变化时旧回答不会被新版本命中
+func storeRAGAnswerCache(plan *ragQueryPlan, answer string, attribution ragpkg.Attribution) {
+	if plan.CacheKBVersion == nil || len(plan.QueryVector) == 0 || len(plan.History) > 0 || isRAGNoEvidenceAnswer(answer) {
+		return
+	}
+	embeddingJSON, _ := json.Marshal(plan.QueryVector)
+	sourcesJSON, _ := json.Marshal(plan.Sources)
+	attributionJSON, _ := json.Marshal(attribution)
+	if _, err := database.DB.Exec(
+		`INSERT INTO rag_answer_cache (course_id, kb_version, embedding_model, question, embedding, answer, sources, attribution, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		plan.CourseID, *plan.CacheKBVersion, plan.provider().ModelName(), plan.RewrittenQuery,
+		string(embeddingJSON), answer, string(sourcesJSON), string(attributionJSON), time.Now(),
+	); err != nil {
+		utils.GetLogger().Warn("store rag answer cache failed", zap.Error(err))
+	}
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+	ragpkg "github.com/online-education-platform/backend/rag"
+)
+
+// newCountingRAGModelServer 与 newRAGModelTestServer 相同，但统计对话接口的调用次数
+func newCountingRAGModelServer(t *testing.T, answer string) *int32 {
+	t.Helper()
+	var chatCalls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/chat/completions") {
+			atomic.AddInt32(&chatCalls, 1)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": answer}}},
+			})
+			return
+		}
+		var req struct {
+			Input []string `json:"input"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		data := make([]map[string]any, 0, len(req.Input))
+		for i, text := range req.Input {
+			vector := []float32{0.1, 0.1}
+			if strings.Contains(text, "栈") {
+				vector[0] = 1
+			}
+			if strings.Contains(text, "队列") {
+				vector[1] = 1
+			}
+			data = append(data, map[string]any{"index": i, "embedding": vector})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+	t.Setenv("EMBEDDING_MODEL", "test-embed")
+	t.Setenv("LLM_MODEL", "test-llm")
+	t.Setenv("RAG_PROVIDER", "")
+	t.Setenv("AI_PROVIDER", "")
+	t.Setenv("RAG_RERANK", "off")
+	t.Setenv("RAG_ANSWER_CACHE", "")
+	return &chatCalls
+}
+
+func TestRAGAnswerCacheServesRepeatedQuestionsUntilKnowledgeBaseChanges(t *testing.T) {
+	withRAGFeedbackTestDB(t)
+	chatCalls := newCountingRAGModelServer(t, "栈是一种后进先出的线性表[1]。")
+
+	enqueueTestDocument(t, "stack.md", "栈是一种后进先出的线性表，只允许在栈顶插入和删除。")
+	queueDoc := enqueueTestDocument(t, "queue.md", "队列是一种先进先出的线性表，在队尾插入、队头删除。")
+	for runNextRAGIngestJob() {
+	}
+
+	params := gin.Params{{Key: "id", Value: "1"}}
+	ask := func(session, question string) map[string]any {
+		t.Helper()
+		body := fmt.Sprintf(`{"question":%q,"session_id":%q}`, question, session)
+		w := performRAGRequest(QueryRAGExtended, "ADMIN", 1, params, "/", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("query failed: %d %s", w.Code, w.Body.String())
+		}
+		return decodeResponseData(t, w.Body.Bytes())
+	}
+
+	first := ask("s1", "什么是栈？")
+	if first["cached"] != false || atomic.LoadInt32(chatCalls) != 1 {
+		t.Fatalf("first question must be generated, got cached=%v calls=%d", first["cached"], *chatCalls)
+	}
+
+	// 不同措辞但向量相同的问题直接命中缓存，不再调用生成模型
+	second := ask("s2", "栈是什么")
+	if second["cached"] != true || second["answer"] != first["answer"] || atomic.LoadInt32(chatCalls) != 1 {
+		t.Fatalf("expected cache hit, got cached=%v calls=%d", second["cached"], *chatCalls)
+	}
+	if sources, _ := second["sources"].([]any); len(sources) == 0 {
+		t.Fatal("cache hit must return stored sources")
+	}
+	if second["query_id"] == nil {
+		t.Fatal("cache hit must still be recorded in query history")
+	}
+
+	// 不相似的问题不命中
+	if other := ask("s3", "队列有什么特点？"); other["cached"] != false || atomic.LoadInt32(chatCalls) != 2 {
+		t.Fatalf("dissimilar question must not hit cache, got cached=%v calls=%d", other["cached"], *chatCalls)
+	}
+
+	w := performRAGRequest(DeleteRAGDocument, "ADMIN", 1, gin.Params{{Key: "id", Value: "1"}, {Key: "docId", Value: fmt.Sprint(queueDoc)}}, "/", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete document failed: %d %s", w.Code, w.Body.String())
+	}
+	var cached int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM rag_answer_cache WHERE course_id = 1`).Scan(&cached)
+	if cached != 0 {
+		t.Fatalf("deleting a document must clear the course cache, %d entries left", cached)
+	}
+	if again := ask("s4", "什么是栈？"); again["cached"] != false || atomic.LoadInt32(chatCalls) != 3 {
+		t.Fatalf("expected regeneration after knowledge base change, got cached=%v calls=%d", again["cached"], *chatCalls)
+	}
+}
+
+func TestRAGAnswerCacheKeepsVersionReadBeforeRetrieval(t *testing.T) {
+	withRAGFeedbackTestDB(t)
+	newCountingRAGModelServer(t, "")
+	cfg, err := resolveRAGConfig("", "")
+	if err != nil {
+		t.Fatalf("resolve rag config: %v", err)
+	}
+	version, err := courseKBVersion(1)
+	if err != nil {
+		t.Fatalf("read kb version: %v", err)
+	}
+	vector := []float32{1, 0.1}
+	plan := &ragQueryPlan{CourseID: 1, Config: cfg, RewrittenQuery: "什么是栈？", QueryVector: vector, CacheKBVersion: &version, Sources: []ragSource{}}
+
+	// 生成回答期间教师更新了资料
+	invalidateRAGAnswerCache(1)
+	storeRAGAnswerCache(plan, "栈是一种后进先出的线性表[1]。", ragpkg.Attribution{})
+
+	current, _ := courseKBVersion(1)
+	if current == version {
+		t.Fatal("invalidation must bump the kb version")
+	}
+	if cached := lookupRAGAnswerCache(1, current, plan.provider().ModelName(), vector); cached != nil {
+		t.Fatalf("answer generated from the old knowledge base must not be served, got %q", cached.Answer)
+	}
+
+	// 没有查找过缓存的问答不写入缓存
+	plan.CacheKBVersion = nil
+	storeRAGAnswerCache(plan, "栈是一种后进先出的线性表[1]。", ragpkg.Attribution{})
+	if cached := lookupRAGAnswerCache(1, current, plan.provider().ModelName(), vector); cached != nil {
+		t.Fatal("answers generated without a cache lookup must not be stored")
+	}
+}
+
+func TestRAGAnswerCacheSkippedForNonDefaultRetrieval(t *testing.T) {
+	withRAGFeedbackTestDB(t)
+	chatCalls := newCountingRAGModelServer(t, "栈是一种后进先出的线性表[1]。")
+	enqueueTestDocument(t, "stack.md", "栈是一种后进先出的线性表，只允许在栈顶插入和删除。")
+	for runNextRAGIngestJob() {
+	}
+
+	params := gin.Params{{Key: "id", Value: "1"}}
+	asked := 0
+	ask := func(extra string) map[string]any {
+		t.Helper()
+		// 每次换一个会话，避免会话历史触发问题改写
+		asked++
+		body := fmt.Sprintf(`{"question":"什么是栈？","session_id":"s%d"%s}`, asked, extra)
+		w := performRAGRequest(QueryRAGExtended, "ADMIN", 1, params, "/", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("query failed: %d %s", w.Code, w.Body.String())
+		}
+		return decodeResponseData(t, w.Body.Bytes())
+	}
+
+	// 调整过检索参数的问答既不命中也不写入缓存
+	for i, extra := range []string{`,"retrieval_mode":"vector"`, `,"vector_weight":2`, `,"rerank":false`} {
+		if got := ask(extra); got["cached"] != false || atomic.LoadInt32(chatCalls) != int32(i+1) {
+			t.Fatalf("%s must bypass the cache, got cached=%v calls=%d", extra, got["cached"], *chatCalls)
+		}
+	}
+	var cached int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM rag_answer_cache WHERE course_id = 1`).Scan(&cached)
+	if cached != 0 {
+		t.Fatalf("non-default retrieval must not be cached, got %d entries", cached)
+	}
+
+	ask("")
+	if got := ask(""); got["cached"] != true || atomic.LoadInt32(chatCalls) != 4 {
+		t.Fatalf("default retrieval must use the cache, got cached=%v calls=%d", got["cached"], *chatCalls)
+	}
+}
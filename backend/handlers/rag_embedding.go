@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+	ragpkg "github.com/online-education-platform/backend/rag"
+	"github.com/online-education-platform/backend/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	ragReembedBatchSize = 50
+
+	ragJobRunning     = "running"
+	ragJobCompleted   = "completed"
+	ragJobFailed      = "failed"
+	ragJobInterrupted = "interrupted"
+)
+
+// ragReembedMu 保证同一时间只有一个重新向量化任务在运行
+var (
+	ragReembedMu      sync.Mutex
+	ragReembedRunning bool
+)
+
+// ragEmbeddingCache 基于 rag_embedding_cache 表的向量缓存
+type ragEmbeddingCache struct{}
+
+func (ragEmbeddingCache) Get(model string, hashes []string) (map[string][]float32, error) {
+	result := make(map[string][]float32, len(hashes))
+	if len(hashes) == 0 {
+		return result, nil
+	}
+
+	placeholders := make([]string, 0, len(hashes))
+	args := make([]interface{}, 0, len(hashes)+1)
+	args = append(args, model)
+	for _, hash := range hashes {
+		placeholders = append(placeholders, "?")
+		args = append(args, hash)
+	}
+
+	rows, err := database.DB.Query(
+		fmt.Sprintf(
+			`SELECT content_hash, embedding FROM rag_embedding_cache WHERE model = ? AND content_hash IN (%s)`,
+			strings.Join(placeholders, ","),
+		),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash, raw string
+		if err := rows.Scan(&hash, &raw); err != nil {
+			continue
+		}
+		var vector []float32
+		if err := json.Unmarshal([]byte(raw), &vector); err != nil || len(vector) == 0 {
+			continue
+		}
+		result[hash] = vector
+	}
+	return result, nil
+}
+
+func (ragEmbeddingCache) Put(model string, vectors map[string][]float32) error {
+	for hash, vector := range vectors {
+		raw, _ := json.Marshal(vector)
+		if _, err := database.DB.Exec(
+			`INSERT OR REPLACE INTO rag_embedding_cache(model, content_hash, embedding, dim, created_at)
+             VALUES(?,?,?,?,?)`,
+			model, hash, string(raw), len(vector), time.Now(),
+		); err != nil {
+			utils.GetLogger().Warn("failed to write rag embedding cache", zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
+
+type ragReembedJob struct {
+	ID         int64  `json:"id"`
+	CourseID   *int64 `json:"course_id,omitempty"`
+	Model      string `json:"model"`
+	Status     string `json:"status"`
+	Total      int    `json:"total"`
+	Processed  int    `json:"processed"`
+	CacheHits  int    `json:"cache_hits"`
+	Error      string `json:"error,omitempty"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+	FinishedAt string `json:"finished_at,omitempty"`
+}
+
+const ragReembedJobColumns = `id, course_id, model, status, total, processed, cache_hits, COALESCE(error, ''),
+        COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', created_at), ''),
+        COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', updated_at), ''),
+        COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', finished_at), '')`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRAGReembedJob(row rowScanner) (ragReembedJob, error) {
+	var job ragReembedJob
+	var courseID sql.NullInt64
+	err := row.Scan(&job.ID, &courseID, &job.Model, &job.Status, &job.Total, &job.Processed, &job.CacheHits,
+		&job.Error, &job.CreatedAt, &job.UpdatedAt, &job.FinishedAt)
+	if courseID.Valid {
+		job.CourseID = &courseID.Int64
+	}
+	return job, err
+}
+
+// RecoverRAGJobs 处理进程退出时仍在运行的后台任务：重新向量化任务和评测标记为中断（可重新发起），
+// 文档入库任务重新排队
+func RecoverRAGJobs() {
+	now := time.Now()
+	if _, err := database.DB.Exec(
+		`UPDATE rag_reembed_jobs SET status = ?, updated_at = ?, finished_at = ? WHERE status = ?`,
+		ragJobInterrupted, now, now, ragJobRunning,
+	); err != nil {
+		utils.GetLogger().Warn("failed to recover rag reembed jobs", zap.Error(err))
+	}
+	if _, err := database.DB.Exec(
+		`UPDATE rag_eval_runs SET status = ?, finished_at = ? WHERE status = ?`,
+		ragJobInterrupted, now, ragJobRunning,
+	); err != nil {
+		utils.GetLogger().Warn("failed to recover rag eval runs", zap.Error(err))
+	}
+	if _, err := database.DB.Exec(
+		`UPDATE rag_ingest_jobs SET status = ?, updated_at = ? WHERE status = ?`,
+		ragJobQueued, now, ragJobRunning,
+	); err != nil {
+		utils.GetLogger().Warn("failed to recover rag ingest jobs", zap.Error(err))
+	}
+	if _, err := database.DB.Exec(
+		`UPDATE rag_documents SET status = ? WHERE status = ?`,
+		ragDocQueued, ragDocProcessing,
+	); err != nil {
+		utils.GetLogger().Warn("failed to recover rag document status", zap.Error(err))
+	}
+}
+
+// StartRAGReembedJob 管理员发起后台任务：用当前向量模型重新计算所有（或指定课程）模型不一致的分块
+func StartRAGReembedJob(c *gin.Context) {
+	if role, _ := c.Get("role"); role != "ADMIN" {
+		utils.Forbidden(c, "仅管理员可以重新向量化知识库")
+		return
+	}
+
+	var req struct {
+		CourseID *int64 `json:"course_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		utils.BadRequest(c, "请求参数错误")
+		return
+	}
+
+	ragCfg, err := getRAGConfig(c)
+	if err != nil {
+		utils.InternalServerError(c, err.Error())
+		return
+	}
+	var scopeCourseID int64
+	if req.CourseID != nil {
+		scopeCourseID = *req.CourseID
+	}
+	usageScope := aiUsageScopeFromContext(c, scopeCourseID, aiFeatureRAGReembed)
+	if !enforceAIQuota(c, usageScope) {
+		return
+	}
+	embedder := newRAGProvider(usageScope.meter(ragCfg))
+	model := embedder.ModelName()
+
+	ragReembedMu.Lock()
+	if ragReembedRunning {
+		ragReembedMu.Unlock()
+		utils.Error(c, http.StatusConflict, "已有重新向量化任务正在运行")
+		return
+	}
+	ragReembedRunning = true
+	ragReembedMu.Unlock()
+
+	release := func() {
+		ragReembedMu.Lock()
+		ragReembedRunning = false
+		ragReembedMu.Unlock()
+	}
+
+	where, args := ragReembedFilter(model, req.CourseID)
+	var total int
+	if err := database.DB.QueryRow(`SELECT COUNT(*) FROM rag_chunks WHERE `+where, args...).Scan(&total); err != nil {
+		release()
+		utils.InternalServerError(c, "统计待处理分块失败")
+		return
+	}
+
+	var courseID interface{}
+	if req.CourseID != nil {
+		courseID = *req.CourseID
+	}
+	res, err := database.DB.Exec(
+		`INSERT INTO rag_reembed_jobs(course_id, model, status, total, created_by, created_at, updated_at)
+         VALUES(?,?,?,?,?,?,?)`,
+		courseID, model, ragJobRunning, total, getCurrentUserID(c), time.Now(), time.Now(),
+	)
+	if err != nil {
+		release()
+		utils.InternalServerError(c, "创建重新向量化任务失败")
+		return
+	}
+	jobID, _ := res.LastInsertId()
+
+	go func() {
+		defer release()
+		runRAGReembedJob(jobID, embedder, req.CourseID)
+	}()
+
+	job, err := scanRAGReembedJob(database.DB.QueryRow(`SELECT `+ragReembedJobColumns+` FROM rag_reembed_jobs WHERE id = ?`, jobID))
+	if err != nil {
+		utils.Success(c, gin.H{"id": jobID, "status": ragJobRunning, "model": model, "total": total})
+		return
+	}
+	utils.Success(c, job)
+}
+
+// ragReembedFilter 返回“向量模型与 model 不一致”的分块筛选条件
+func ragReembedFilter(model string, courseID *int64) (string, []interface{}) {
+	where := `embedding IS NOT NULL AND embedding != '' AND COALESCE(embedding_model, '') != ?`
+	args := []interface{}{model}
+	if courseID != nil {
+		where += ` AND course_id = ?`
+		args = append(args, *courseID)
+	}
+	return where, args
+}
+
+func runRAGReembedJob(jobID int64, client ragpkg.Embedder, courseID *int64) {
+	logger := utils.GetLogger()
+	model := client.ModelName()
+	where, args := ragReembedFilter(model, courseID)
+	touched := make(map[int64]bool)
+
+	finish := func(status string, jobErr error) {
+		message := ""
+		if jobErr != nil {
+			message = jobErr.Error()
+			logger.Error("rag reembed job failed", zap.Int64("jobID", jobID), zap.Error(jobErr))
+		}
+		database.DB.Exec( //nolint:errcheck
+			`UPDATE rag_reembed_jobs SET status = ?, error = ?, updated_at = ?, finished_at = ? WHERE id = ?`,
+			status, message, time.Now(), time.Now(), jobID,
+		)
+		if ragIndexStore == nil {
+			return
+		}
+		for id := range touched {
+			if err := ragIndexStore.Invalidate(id); err != nil {
+				logger.Warn("failed to invalidate rag vector index", zap.Int64("courseID", id), zap.Error(err))
+			}
+		}
+	}
+
+	var lastID int64
+	for {
+		batchArgs := append(append([]interface{}{}, args...), lastID, ragReembedBatchSize)
+		rows, err := database.DB.Query(
+			`SELECT id, COALESCE(course_id, 0), content FROM rag_chunks WHERE `+where+` AND id > ? ORDER BY id ASC LIMIT ?`,
+			batchArgs...,
+		)
+		if err != nil {
+			finish(ragJobFailed, err)
+			return
+		}
+
+		type pending struct {
+			id       int64
+			courseID int64
+			content  string
+		}
+		batch := make([]pending, 0, ragReembedBatchSize)
+		for rows.Next() {
+			var item pending
+			if err := rows.Scan(&item.id, &item.courseID, &item.content); err != nil {
+				continue
+			}
+			batch = append(batch, item)
+		}
+		rows.Close()
+		if len(batch) == 0 {
+			finish(ragJobCompleted, nil)
+			return
+		}
+		lastID = batch[len(batch)-1].id
+
+		contents := make([]string, 0, len(batch))
+		for _, item := range batch {
+			contents = append(contents, item.content)
+		}
+		vectors, hits, err := ragpkg.CachedEmbed(context.Background(), client, ragEmbeddingCache{}, contents)
+		if err != nil {
+			finish(ragJobFailed, err)
+			return
+		}
+
+		tx, err := database.DB.Begin()
+		if err != nil {
+			finish(ragJobFailed, err)
+			return
+		}
+		for i, item := range batch {
+			raw, _ := json.Marshal(vectors[i])
+			if _, err := tx.Exec(
+				`UPDATE rag_chunks SET embedding = ?, embedding_model = ?, embedding_dim = ?, content_hash = ? WHERE id = ?`,
+				string(raw), model, len(vectors[i]), ragpkg.ContentHash(item.content), item.id,
+			); err != nil {
+				tx.Rollback() //nolint:errcheck
+				finish(ragJobFailed, err)
+				return
+			}
+			touched[item.courseID] = true
+		}
+		if _, err := tx.Exec(
+			`UPDATE rag_reembed_jobs SET processed = processed + ?, cache_hits = cache_hits + ?, updated_at = ? WHERE id = ?`,
+			len(batch), hits, time.Now(), jobID,
+		); err != nil {
+			tx.Rollback() //nolint:errcheck
+			finish(ragJobFailed, err)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			finish(ragJobFailed, err)
+			return
+		}
+	}
+}
+
+// GetRAGReembedJob 查询重新向量化任务进度
+func GetRAGReembedJob(c *gin.Context) {
+	if role, _ := c.Get("role"); role != "ADMIN" {
+		utils.Forbidden(c, "仅管理员可以查看重新向量化任务")
+		return
+	}
+	jobID, err := strconv.ParseInt(c.Param("jobId"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "无效的任务 ID")
+		return
+	}
+
+	job, err := scanRAGReembedJob(database.DB.QueryRow(`SELECT `+ragReembedJobColumns+` FROM rag_reembed_jobs WHERE id = ?`, jobID))
+	if err == sql.ErrNoRows {
+		utils.NotFound(c, "任务不存在")
+		return
+	}
+	if err != nil {
+		utils.InternalServerError(c, "查询任务失败")
+		return
+	}
+	utils.Success(c, job)
+}
+
+// ListRAGReembedJobs 列出最近的重新向量化任务
+func ListRAGReembedJobs(c *gin.Context) {
+	if role, _ := c.Get("role"); role != "ADMIN" {
+		utils.Forbidden(c, "仅管理员可以查看重新向量化任务")
+		return
+	}
+
+	rows, err := database.DB.Query(`SELECT ` + ragReembedJobColumns + ` FROM rag_reembed_jobs ORDER BY id DESC LIMIT 20`)
+	if err != nil {
+		utils.InternalServerError(c, "查询任务失败")
+		return
+	}
+	defer rows.Close()
+
+	jobs := make([]ragReembedJob, 0)
+	for rows.Next() {
+		job, err := scanRAGReembedJob(rows)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	utils.Success(c, jobs)
+}
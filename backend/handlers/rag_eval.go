@@ -0,0 +1,456 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+	ragpkg "github.com/online-education-platform/backend/rag"
+	"github.com/online-education-platform/backend/utils"
+	"go.uber.org/zap"
+)
+
+// ragEvalMaxK 评测时允许的最大检索深度
+const ragEvalMaxK = 20
+
+type ragEvalCase struct {
+	ID             int64   `json:"id"`
+	CourseID       int64   `json:"course_id"`
+	Question       string  `json:"question"`
+	ExpectedAnswer string  `json:"expected_answer,omitempty"`
+	ExpectedDocIDs []int64 `json:"expected_doc_ids"`
+	CreatedAt      string  `json:"created_at"`
+}
+
+type ragEvalRun struct {
+	ID         int64              `json:"id"`
+	CourseID   int64              `json:"course_id"`
+	Status     string             `json:"status"`
+	K          int                `json:"k"`
+	Total      int                `json:"total"`
+	Processed  int                `json:"processed"`
+	Error      string             `json:"error,omitempty"`
+	Report     *ragpkg.EvalReport `json:"report,omitempty"`
+	CreatedAt  string             `json:"created_at"`
+	FinishedAt string             `json:"finished_at,omitempty"`
+}
+
+const ragEvalRunColumns = `id, course_id, status, k, total, processed, COALESCE(error, ''), COALESCE(report, ''),
+        COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', created_at), ''),
+        COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', finished_at), '')`
+
+func scanRAGEvalRun(row rowScanner, withResults bool) (ragEvalRun, error) {
+	var run ragEvalRun
+	var rawReport string
+	err := row.Scan(&run.ID, &run.CourseID, &run.Status, &run.K, &run.Total, &run.Processed, &run.Error, &rawReport,
+		&run.CreatedAt, &run.FinishedAt)
+	if err == nil && rawReport != "" {
+		var report ragpkg.EvalReport
+		if json.Unmarshal([]byte(rawReport), &report) == nil {
+			// 列表只返回汇总指标，逐题明细在详情接口中返回
+			if !withResults {
+				report.Results = nil
+			}
+			run.Report = &report
+		}
+	}
+	return run, err
+}
+
+func loadRAGEvalCases(courseID int64) ([]ragEvalCase, error) {
+	rows, err := database.DB.Query(
+		`SELECT id, course_id, question, COALESCE(expected_answer, ''), COALESCE(expected_doc_ids, '[]'),
+                COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', created_at), '')
+         FROM rag_eval_cases
+         WHERE course_id = ?
+         ORDER BY id`,
+		courseID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cases := make([]ragEvalCase, 0)
+	for rows.Next() {
+		var item ragEvalCase
+		var rawDocIDs string
+		if err := rows.Scan(&item.ID, &item.CourseID, &item.Question, &item.ExpectedAnswer, &rawDocIDs, &item.CreatedAt); err != nil {
+			return nil, err
+		}
+		item.ExpectedDocIDs = decodeSourceIDs(rawDocIDs)
+		if item.ExpectedDocIDs == nil {
+			item.ExpectedDocIDs = []int64{}
+		}
+		cases = append(cases, item)
+	}
+	return cases, rows.Err()
+}
+
+// ListRAGEvalCases 列出课程的黄金问答集
+func ListRAGEvalCases(c *gin.Context) {
+	courseID, ok := parseCourseID(c)
+	if !ok {
+		return
+	}
+	if !isCourseInstructorOrAdmin(c, courseID) {
+		utils.Forbidden(c, "仅课程教师或管理员可以管理评测集")
+		return
+	}
+
+	cases, err := loadRAGEvalCases(courseID)
+	if err != nil {
+		utils.InternalServerError(c, "查询评测集失败")
+		return
+	}
+	utils.Success(c, cases)
+}
+
+// CreateRAGEvalCase 新增一条黄金问答：问题、参考答案与应被检索到的文档
+func CreateRAGEvalCase(c *gin.Context) {
+	courseID, ok := parseCourseID(c)
+	if !ok {
+		return
+	}
+	if !isCourseInstructorOrAdmin(c, courseID) {
+		utils.Forbidden(c, "仅课程教师或管理员可以管理评测集")
+		return
+	}
+
+	var req struct {
+		Question       string  `json:"question" binding:"required"`
+		ExpectedAnswer string  `json:"expected_answer"`
+		ExpectedDocIDs []int64 `json:"expected_doc_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请提供 question 字段")
+		return
+	}
+	req.Question = strings.TrimSpace(req.Question)
+	if req.Question == "" {
+		utils.BadRequest(c, "问题不能为空")
+		return
+	}
+	req.ExpectedDocIDs = ragpkg.DedupeIDs(req.ExpectedDocIDs)
+	if len(req.ExpectedDocIDs) == 0 {
+		utils.BadRequest(c, "请至少指定一个期望命中的文档")
+		return
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(req.ExpectedDocIDs)), ",")
+	args := []interface{}{courseID}
+	for _, id := range req.ExpectedDocIDs {
+		args = append(args, id)
+	}
+	var matched int
+	if err := database.DB.QueryRow(
+		`SELECT COUNT(*) FROM rag_documents WHERE course_id = ? AND id IN (`+placeholders+`)`, args...,
+	).Scan(&matched); err != nil {
+		utils.InternalServerError(c, "校验文档失败")
+		return
+	}
+	if matched != len(req.ExpectedDocIDs) {
+		utils.BadRequest(c, "expected_doc_ids 中包含不属于该课程的文档")
+		return
+	}
+
+	docIDsJSON, _ := json.Marshal(req.ExpectedDocIDs)
+	res, err := database.DB.Exec(
+		`INSERT INTO rag_eval_cases(course_id, question, expected_answer, expected_doc_ids, created_by, created_at)
+         VALUES(?,?,?,?,?,?)`,
+		courseID, req.Question, strings.TrimSpace(req.ExpectedAnswer), string(docIDsJSON), getCurrentUserID(c), time.Now(),
+	)
+	if err != nil {
+		utils.InternalServerError(c, "保存评测问题失败")
+		return
+	}
+	caseID, _ := res.LastInsertId()
+	utils.Success(c, ragEvalCase{
+		ID:             caseID,
+		CourseID:       courseID,
+		Question:       req.Question,
+		ExpectedAnswer: strings.TrimSpace(req.ExpectedAnswer),
+		ExpectedDocIDs: req.ExpectedDocIDs,
+		CreatedAt:      time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// DeleteRAGEvalCase 删除一条黄金问答
+func DeleteRAGEvalCase(c *gin.Context) {
+	courseID, ok := parseCourseID(c)
+	if !ok {
+		return
+	}
+	if !isCourseInstructorOrAdmin(c, courseID) {
+		utils.Forbidden(c, "仅课程教师或管理员可以管理评测集")
+		return
+	}
+	caseID, err := strconv.ParseInt(c.Param("caseId"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "无效的评测问题 ID")
+		return
+	}
+
+	res, err := database.DB.Exec(`DELETE FROM rag_eval_cases WHERE id = ? AND course_id = ?`, caseID, courseID)
+	if err != nil {
+		utils.InternalServerError(c, "删除评测问题失败")
+		return
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		utils.NotFound(c, "评测问题不存在")
+		return
+	}
+	utils.Success(c, gin.H{"id": caseID})
+}
+
+// StartRAGEvalRun 在后台用当前检索与生成配置重放课程的全部黄金问题
+func StartRAGEvalRun(c *gin.Context) {
+	courseID, ok := parseCourseID(c)
+	if !ok {
+		return
+	}
+	if !isCourseInstructorOrAdmin(c, courseID) {
+		utils.Forbidden(c, "仅课程教师或管理员可以运行评测")
+		return
+	}
+
+	var req struct {
+		K int `json:"k"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		utils.BadRequest(c, "请求参数错误")
+		return
+	}
+	if req.K == 0 {
+		req.K = ragTopK
+	}
+	if req.K < 1 || req.K > ragEvalMaxK {
+		utils.BadRequest(c, fmt.Sprintf("k 取值范围为 1-%d", ragEvalMaxK))
+		return
+	}
+
+	ragCfg, err := getRAGConfig(c)
+	if err != nil {
+		utils.InternalServerError(c, err.Error())
+		return
+	}
+	usageScope := aiUsageScopeFromContext(c, courseID, aiFeatureRAGEval)
+	if !enforceAIQuota(c, usageScope) {
+		return
+	}
+	cases, err := loadRAGEvalCases(courseID)
+	if err != nil {
+		utils.InternalServerError(c, "查询评测集失败")
+		return
+	}
+	if len(cases) == 0 {
+		utils.BadRequest(c, "该课程还没有评测问题，请先添加黄金问答")
+		return
+	}
+
+	var running int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM rag_eval_runs WHERE course_id = ? AND status = ?`, courseID, ragJobRunning).Scan(&running)
+	if running > 0 {
+		utils.Error(c, http.StatusConflict, "该课程已有评测正在运行")
+		return
+	}
+
+	res, err := database.DB.Exec(
+		`INSERT INTO rag_eval_runs(course_id, status, k, total, created_by, created_at) VALUES(?,?,?,?,?,?)`,
+		courseID, ragJobRunning, req.K, len(cases), getCurrentUserID(c), time.Now(),
+	)
+	if err != nil {
+		utils.InternalServerError(c, "创建评测任务失败")
+		return
+	}
+	runID, _ := res.LastInsertId()
+
+	ragCfg = usageScope.meter(ragCfg)
+	go runRAGEvalRun(runID, courseID, ragCfg, cases, req.K)
+
+	run, err := scanRAGEvalRun(database.DB.QueryRow(`SELECT `+ragEvalRunColumns+` FROM rag_eval_runs WHERE id = ?`, runID), false)
+	if err != nil {
+		utils.Success(c, gin.H{"id": runID, "status": ragJobRunning, "k": req.K, "total": len(cases)})
+		return
+	}
+	utils.Success(c, run)
+}
+
+func runRAGEvalRun(runID, courseID int64, cfg ragConfig, cases []ragEvalCase, k int) {
+	defer func() {
+		if r := recover(); r != nil {
+			utils.GetLogger().Error("rag eval run panicked", zap.Any("panic", r))
+			database.DB.Exec(`UPDATE rag_eval_runs SET status = ?, error = ?, finished_at = ? WHERE id = ?`,
+				ragJobFailed, fmt.Sprint(r), time.Now(), runID)
+		}
+	}()
+
+	report := evaluateRAGCases(courseID, cfg, cases, k, func(done int) {
+		database.DB.Exec(`UPDATE rag_eval_runs SET processed = ? WHERE id = ?`, done, runID)
+	})
+	reportJSON, _ := json.Marshal(report)
+	if _, err := database.DB.Exec(
+		`UPDATE rag_eval_runs SET status = ?, processed = ?, report = ?, finished_at = ? WHERE id = ?`,
+		ragJobCompleted, len(cases), string(reportJSON), time.Now(), runID,
+	); err != nil {
+		utils.GetLogger().Error("failed to save rag eval report", zap.Int64("run_id", runID), zap.Error(err))
+	}
+}
+
+// EvaluateRAGCourse 同步评测课程的黄金问答集，供命令行工具调用；
+// provider 为空时按 RAG_PROVIDER / AI_PROVIDER 环境变量选择模型
+func EvaluateRAGCourse(courseID int64, k int, provider string) (ragpkg.EvalReport, error) {
+	if k <= 0 {
+		k = ragTopK
+	}
+	cfg, err := resolveRAGConfig("", strings.ToLower(strings.TrimSpace(provider)))
+	if err != nil {
+		return ragpkg.EvalReport{}, err
+	}
+	cases, err := loadRAGEvalCases(courseID)
+	if err != nil {
+		return ragpkg.EvalReport{}, err
+	}
+	if len(cases) == 0 {
+		return ragpkg.EvalReport{}, fmt.Errorf("课程 %d 没有评测问题", courseID)
+	}
+	cfg = newAIUsageScope(0, "", courseID, aiFeatureRAGEval).meter(cfg)
+	return evaluateRAGCases(courseID, cfg, cases, k, nil), nil
+}
+
+// evaluateRAGCases 逐题走与问答接口相同的检索、重排和生成流程，统计 recall@k、MRR、
+// 回答依据率与耗时。单题失败记入结果，不中断整次评测。
+func evaluateRAGCases(courseID int64, cfg ragConfig, cases []ragEvalCase, k int, onProgress func(done int)) ragpkg.EvalReport {
+	reranker := newRAGReranker(cfg)
+	results := make([]ragpkg.EvalCaseResult, 0, len(cases))
+	for i, evalCase := range cases {
+		results = append(results, evaluateRAGCase(courseID, cfg, evalCase, k, reranker))
+		if onProgress != nil {
+			onProgress(i + 1)
+		}
+	}
+
+	report := ragpkg.SummarizeEval(results, k)
+	report.EmbeddingModel = newRAGProvider(cfg).ModelName()
+	report.LLMModel = cfg.LLMModel
+	return report
+}
+
+func evaluateRAGCase(courseID int64, cfg ragConfig, evalCase ragEvalCase, k int, reranker ragpkg.Reranker) ragpkg.EvalCaseResult {
+	result := ragpkg.EvalCaseResult{
+		CaseID:          evalCase.ID,
+		Question:        evalCase.Question,
+		ExpectedDocIDs:  evalCase.ExpectedDocIDs,
+		RetrievedDocIDs: []int64{},
+	}
+
+	plan := &ragQueryPlan{
+		CourseID:       courseID,
+		Question:       evalCase.Question,
+		RewrittenQuery: evalCase.Question,
+		Mode:           ragpkg.RetrievalHybrid,
+		Config:         cfg,
+		Sources:        []ragSource{},
+	}
+	start := time.Now()
+	err := plan.retrieve(context.Background(), ragRetrieveOptions{
+		Retrieval: ragpkg.RetrievalQuery{Mode: ragpkg.RetrievalHybrid, VectorWeight: 1, KeywordWeight: 1},
+		TopK:      k,
+		Reranker:  reranker,
+	})
+	result.RetrievalLatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	for _, source := range plan.Sources {
+		result.RetrievedDocIDs = append(result.RetrievedDocIDs, source.DocumentID)
+	}
+	result.RetrievedDocIDs = ragpkg.DedupeIDs(result.RetrievedDocIDs)
+	result.Recall = ragpkg.RecallAtK(result.RetrievedDocIDs, evalCase.ExpectedDocIDs, k)
+	result.ReciprocalRank = ragpkg.ReciprocalRank(result.RetrievedDocIDs, evalCase.ExpectedDocIDs)
+
+	// 知识库为空或资料不足时 plan.Answer 已是兜底回答，不调用生成模型，依据率记为 0
+	answer := plan.Answer
+	if answer == "" {
+		answer, err = ragpkg.GenerateAnswer(context.Background(), plan.provider(), plan.Question, plan.Contexts, nil)
+		if err != nil {
+			result.TotalLatencyMs = time.Since(start).Milliseconds()
+			result.Error = "生成回答失败: " + err.Error()
+			return result
+		}
+		result.Faithfulness = ragpkg.Faithfulness(plan.attribute(answer))
+	}
+	result.Answer = answer
+	result.TotalLatencyMs = time.Since(start).Milliseconds()
+	return result
+}
+
+// ListRAGEvalRuns 列出课程最近的评测记录（仅汇总指标）
+func ListRAGEvalRuns(c *gin.Context) {
+	courseID, ok := parseCourseID(c)
+	if !ok {
+		return
+	}
+	if !isCourseInstructorOrAdmin(c, courseID) {
+		utils.Forbidden(c, "仅课程教师或管理员可以查看评测")
+		return
+	}
+
+	rows, err := database.DB.Query(
+		`SELECT `+ragEvalRunColumns+` FROM rag_eval_runs WHERE course_id = ? ORDER BY id DESC LIMIT 20`, courseID,
+	)
+	if err != nil {
+		utils.InternalServerError(c, "查询评测记录失败")
+		return
+	}
+	defer rows.Close()
+
+	runs := make([]ragEvalRun, 0)
+	for rows.Next() {
+		run, err := scanRAGEvalRun(rows, false)
+		if err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	utils.Success(c, runs)
+}
+
+// GetRAGEvalRun 查询评测进度及逐题结果
+func GetRAGEvalRun(c *gin.Context) {
+	courseID, ok := parseCourseID(c)
+	if !ok {
+		return
+	}
+	if !isCourseInstructorOrAdmin(c, courseID) {
+		utils.Forbidden(c, "仅课程教师或管理员可以查看评测")
+		return
+	}
+	runID, err := strconv.ParseInt(c.Param("runId"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "无效的评测 ID")
+		return
+	}
+
+	run, err := scanRAGEvalRun(database.DB.QueryRow(
+		`SELECT `+ragEvalRunColumns+` FROM rag_eval_runs WHERE id = ? AND course_id = ?`, runID, courseID,
+	), true)
+	if err == sql.ErrNoRows {
+		utils.NotFound(c, "评测记录不存在")
+		return
+	}
+	if err != nil {
+		utils.InternalServerError(c, "查询评测记录失败")
+		return
+	}
+	utils.Success(c, run)
+}
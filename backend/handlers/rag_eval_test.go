@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/online-education-platform/backend/database"
+)
+
+// newRAGModelTestServer 同时模拟向量接口与对话接口：按是否提到“栈”/“队列”生成区分度明显的向量，
+// 对话接口固定返回一句带引用的回答
+func newRAGModelTestServer(t *testing.T, answer string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/chat/completions") {
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": answer}}},
+			})
+			return
+		}
+		var req struct {
+			Input []string `json:"input"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		data := make([]map[string]any, 0, len(req.Input))
+		for i, text := range req.Input {
+			vector := []float32{0.1, 0.1}
+			if strings.Contains(text, "栈") {
+				vector[0] = 1
+			}
+			if strings.Contains(text, "队列") {
+				vector[1] = 1
+			}
+			data = append(data, map[string]any{"index": i, "embedding": vector})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+	t.Setenv("EMBEDDING_MODEL", "test-embed")
+	t.Setenv("LLM_MODEL", "test-llm")
+	t.Setenv("RAG_PROVIDER", "")
+	t.Setenv("AI_PROVIDER", "")
+	t.Setenv("RAG_RERANK", "off")
+}
+
+func TestEvaluateRAGCourseReportsRetrievalAndFaithfulness(t *testing.T) {
+	withTestDB(t)
+	newRAGModelTestServer(t, "栈是一种后进先出的线性表[1]。")
+
+	stackDoc := enqueueTestDocument(t, "stack.md", "栈是一种后进先出的线性表，只允许在栈顶插入和删除。")
+	queueDoc := enqueueTestDocument(t, "queue.md", "队列是一种先进先出的线性表，在队尾插入、队头删除。")
+	for runNextRAGIngestJob() {
+	}
+
+	for _, golden := range []struct {
+		question string
+		docID    int64
+	}{
+		{"什么是栈？", stackDoc},
+		// 故意标错期望文档，验证未命中时 recall 与 MRR 为 0
+		{"队列有什么特点？", stackDoc},
+	} {
+		if _, err := database.DB.Exec(
+			`INSERT INTO rag_eval_cases(course_id, question, expected_doc_ids) VALUES(1, ?, ?)`,
+			golden.question, fmt.Sprintf("[%d]", golden.docID),
+		); err != nil {
+			t.Fatalf("insert eval case: %v", err)
+		}
+	}
+
+	report, err := EvaluateRAGCourse(1, 1, "")
+	if err != nil {
+		t.Fatalf("EvaluateRAGCourse: %v", err)
+	}
+	if report.Cases != 2 || report.Failed != 0 || report.K != 1 {
+		t.Fatalf("unexpected report counts: %+v", report)
+	}
+
+	hit, miss := report.Results[0], report.Results[1]
+	if hit.Recall != 1 || hit.ReciprocalRank != 1 || hit.Faithfulness != 1 {
+		t.Fatalf("expected grounded hit for stack question, got %+v", hit)
+	}
+	if miss.Recall != 0 || miss.ReciprocalRank != 0 || len(miss.RetrievedDocIDs) != 1 || miss.RetrievedDocIDs[0] != queueDoc {
+		t.Fatalf("expected queue doc retrieved but not expected, got %+v", miss)
+	}
+	if report.RecallAtK != 0.5 || report.MRR != 0.5 || report.EmbeddingModel != "test-embed" {
+		t.Fatalf("unexpected summary: %+v", report)
+	}
+}
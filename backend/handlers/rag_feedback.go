@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+	ragpkg "github.com/online-education-platform/backend/rag"
+	"github.com/online-education-platform/backend/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	ragReviewResolved  = "resolved"
+	ragReviewDismissed = "dismissed"
+
+	// ragCanonicalStrategy 标记存放教师标准答案的课程文档，每门课程一份
+	ragCanonicalStrategy = "canonical"
+	ragCanonicalFilename = "教师标准答案"
+
+	ragFeedbackMaxComment = 1000
+)
+
+// ragNoEvidenceMarkers 兜底回答与系统提示词要求模型在资料不足时使用的措辞
+var ragNoEvidenceMarkers = []string{"未找到足够依据", "没有找到与问题相关的内容", "还没有可用的知识库文档"}
+
+type ragQueryFeedback struct {
+	Rating  int    `json:"rating"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type ragReviewItem struct {
+	QueryID          int64             `json:"query_id"`
+	UserID           int64             `json:"user_id"`
+	Username         string            `json:"username"`
+	Question         string            `json:"question"`
+	RewrittenQuery   string            `json:"rewritten_query,omitempty"`
+	Answer           string            `json:"answer"`
+	NoEvidence       bool              `json:"no_evidence"`
+	Feedback         *ragQueryFeedback `json:"feedback,omitempty"`
+	ReviewStatus     string            `json:"review_status"`
+	CanonicalChunkID *int64            `json:"canonical_chunk_id,omitempty"`
+	CanonicalAnswer  string            `json:"canonical_answer,omitempty"`
+	CreatedAt        string            `json:"created_at"`
+}
+
+// isRAGNoEvidenceAnswer 判断回答是否声明课程资料不足
+func isRAGNoEvidenceAnswer(answer string) bool {
+	for _, marker := range ragNoEvidenceMarkers {
+		if strings.Contains(answer, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// prioritizeCanonicalChunks 把命中的教师标准答案排到最前，其余分块保持原有顺序
+func prioritizeCanonicalChunks(chunks []storedRAGChunk) []storedRAGChunk {
+	result := make([]storedRAGChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		if chunk.Meta.Canonical {
+			result = append(result, chunk)
+		}
+	}
+	for _, chunk := range chunks {
+		if !chunk.Meta.Canonical {
+			result = append(result, chunk)
+		}
+	}
+	return result
+}
+
+func formatCanonicalContent(question, answer string) string {
+	return fmt.Sprintf("【教师标准答案】\n问题：%s\n答案：%s", question, answer)
+}
+
+func parseRAGQueryID(c *gin.Context) (int64, bool) {
+	queryID, err := strconv.ParseInt(c.Param("queryId"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "无效的问答记录 ID")
+		return 0, false
+	}
+	return queryID, true
+}
+
+// SubmitRAGFeedback 提问者对回答点赞/点踩并可附文字说明，重复提交时覆盖之前的评价
+func SubmitRAGFeedback(c *gin.Context) {
+	courseID, ok := parseCourseID(c)
+	if !ok {
+		return
+	}
+	queryID, ok := parseRAGQueryID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Rating  int    `json:"rating"`
+		Comment string `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请求参数错误")
+		return
+	}
+	if req.Rating != 1 && req.Rating != -1 {
+		utils.BadRequest(c, "rating 只能为 1（有帮助）或 -1（没帮助）")
+		return
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	if len([]rune(req.Comment)) > ragFeedbackMaxComment {
+		utils.BadRequest(c, fmt.Sprintf("反馈内容不能超过 %d 字", ragFeedbackMaxComment))
+		return
+	}
+
+	userID := getCurrentUserID(c)
+	var ownerID int64
+	err := database.DB.QueryRow(`SELECT user_id FROM rag_queries WHERE id = ? AND course_id = ?`, queryID, courseID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		utils.NotFound(c, "问答记录不存在")
+		return
+	}
+	if err != nil {
+		utils.InternalServerError(c, "查询问答记录失败")
+		return
+	}
+	if ownerID != userID {
+		utils.Forbidden(c, "只能评价自己的提问")
+		return
+	}
+
+	now := time.Now()
+	if _, err := database.DB.Exec(
+		`INSERT INTO rag_query_feedback(query_id, course_id, user_id, rating, comment, created_at, updated_at)
+         VALUES(?,?,?,?,?,?,?)
+         ON CONFLICT(query_id, user_id) DO UPDATE SET rating = excluded.rating, comment = excluded.comment, updated_at = excluded.updated_at`,
+		queryID, courseID, userID, req.Rating, req.Comment, now, now,
+	); err != nil {
+		utils.InternalServerError(c, "保存反馈失败")
+		return
+	}
+	utils.Success(c, gin.H{"query_id": queryID, "rating": req.Rating, "comment": req.Comment})
+}
+
+// ListRAGReviewQueue 列出课程中被点踩或资料不足的问答，供教师审核
+// 查询参数 reason=low_rated|no_evidence（默认两者都有），status=open|resolved|dismissed|all（默认 open）
+func ListRAGReviewQueue(c *gin.Context) {
+	courseID, ok := parseCourseID(c)
+	if !ok {
+		return
+	}
+	if !isCourseInstructorOrAdmin(c, courseID) {
+		utils.Forbidden(c, "仅课程教师或管理员可以审核问答")
+		return
+	}
+
+	query := `SELECT q.id, q.user_id, COALESCE(u.username, ''), q.question, COALESCE(q.rewritten_query, ''),
+                     COALESCE(q.answer, ''), COALESCE(q.no_evidence, 0), f.rating, COALESCE(f.comment, ''),
+                     COALESCE(q.review_status, ''), q.canonical_chunk_id, COALESCE(ch.content, ''),
+                     COALESCE(strftime('%Y-%m-%dT%H:%M:%SZ', q.created_at), '')
+              FROM rag_queries q
+              LEFT JOIN users u ON u.id = q.user_id
+              LEFT JOIN rag_query_feedback f ON f.query_id = q.id AND f.user_id = q.user_id
+              LEFT JOIN rag_chunks ch ON ch.id = q.canonical_chunk_id
+              WHERE q.course_id = ?`
+	args := []interface{}{courseID}
+
+	switch c.DefaultQuery("reason", "") {
+	case "low_rated":
+		query += ` AND f.rating < 0`
+	case "no_evidence":
+		query += ` AND q.no_evidence = 1`
+	case "":
+		query += ` AND (f.rating < 0 OR q.no_evidence = 1)`
+	default:
+		utils.BadRequest(c, "reason 仅支持 low_rated 或 no_evidence")
+		return
+	}
+	switch status := c.DefaultQuery("status", "open"); status {
+	case "open":
+		query += ` AND COALESCE(q.review_status, '') = ''`
+	case ragReviewResolved, ragReviewDismissed:
+		query += ` AND q.review_status = ?`
+		args = append(args, status)
+	case "all":
+	default:
+		utils.BadRequest(c, "status 仅支持 open、resolved、dismissed 或 all")
+		return
+	}
+	query += ` ORDER BY q.created_at DESC, q.id DESC LIMIT 100`
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		utils.InternalServerError(c, "查询审核队列失败")
+		return
+	}
+	defer rows.Close()
+
+	items := make([]ragReviewItem, 0)
+	for rows.Next() {
+		var item ragReviewItem
+		var rating, canonicalID sql.NullInt64
+		var comment string
+		if err := rows.Scan(&item.QueryID, &item.UserID, &item.Username, &item.Question, &item.RewrittenQuery,
+			&item.Answer, &item.NoEvidence, &rating, &comment, &item.ReviewStatus, &canonicalID, &item.CanonicalAnswer,
+			&item.CreatedAt); err != nil {
+			continue
+		}
+		if item.RewrittenQuery == item.Question {
+			item.RewrittenQuery = ""
+		}
+		if rating.Valid {
+			item.Feedback = &ragQueryFeedback{Rating: int(rating.Int64), Comment: comment}
+		}
+		if canonicalID.Valid {
+			item.CanonicalChunkID = &canonicalID.Int64
+		}
+		items = append(items, item)
+	}
+	utils.Success(c, items)
+}
+
+// SaveRAGCanonicalAnswer 教师为问答撰写标准答案：向量化后写入课程的“教师标准答案”文档，
+// 之后相似问题检索命中时优先提供给生成模型。再次提交会替换该问答之前的标准答案。
+func SaveRAGCanonicalAnswer(c *gin.Context) {
+	courseID, ok := parseCourseID(c)
+	if !ok {
+		return
+	}
+	if !isCourseInstructorOrAdmin(c, courseID) {
+		utils.Forbidden(c, "仅课程教师或管理员可以撰写标准答案")
+		return
+	}
+	queryID, ok := parseRAGQueryID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Question string `json:"question"`
+		Answer   string `json:"answer" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.BadRequest(c, "请提供 answer 字段")
+		return
+	}
+	req.Answer = strings.TrimSpace(req.Answer)
+	if req.Answer == "" {
+		utils.BadRequest(c, "标准答案不能为空")
+		return
+	}
+
+	var question, rewritten string
+	err := database.DB.QueryRow(
+		`SELECT question, COALESCE(rewritten_query, '') FROM rag_queries WHERE id = ? AND course_id = ?`, queryID, courseID,
+	).Scan(&question, &rewritten)
+	if err == sql.ErrNoRows {
+		utils.NotFound(c, "问答记录不存在")
+		return
+	}
+	if err != nil {
+		utils.InternalServerError(c, "查询问答记录失败")
+		return
+	}
+	// 默认使用改写后的独立问题，追问原文脱离会话后往往缺少上下文
+	if req.Question = strings.TrimSpace(req.Question); req.Question == "" {
+		req.Question = question
+		if rewritten != "" {
+			req.Question = rewritten
+		}
+	}
+
+	ragCfg, err := getRAGConfig(c)
+	if err != nil {
+		utils.InternalServerError(c, err.Error())
+		return
+	}
+	usageScope := aiUsageScopeFromContext(c, courseID, aiFeatureRAGCanonical)
+	if !enforceAIQuota(c, usageScope) {
+		return
+	}
+	ragCfg = usageScope.meter(ragCfg)
+	chunkID, err := saveRAGCanonicalChunk(ragCfg, courseID, getCurrentUserID(c), queryID, req.Question, req.Answer)
+	if err != nil {
+		utils.GetLogger().Error("save rag canonical answer failed", zap.Int64("queryID", queryID), zap.Error(err))
+		utils.InternalServerError(c, "保存标准答案失败: "+err.Error())
+		return
+	}
+	utils.Success(c, gin.H{
+		"query_id":           queryID,
+		"canonical_chunk_id": chunkID,
+		"question":           req.Question,
+		"review_status":      ragReviewResolved,
+	})
+}
+
+func saveRAGCanonicalChunk(cfg ragConfig, courseID, userID, queryID int64, question, answer string) (int64, error) {
+	content := formatCanonicalContent(question, answer)
+	embedder := newRAGProvider(cfg)
+	embedModel := embedder.ModelName()
+	vectors, _, err := ragpkg.CachedEmbed(context.Background(), embedder, ragEmbeddingCache{}, []string{content})
+	if err != nil {
+		return 0, fmt.Errorf("向量化失败: %w", err)
+	}
+	if len(vectors) != 1 || len(vectors[0]) == 0 {
+		return 0, fmt.Errorf("向量化结果为空")
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	now := time.Now()
+	var docID int64
+	err = tx.QueryRow(
+		`SELECT id FROM rag_documents WHERE course_id = ? AND chunk_strategy = ? ORDER BY id LIMIT 1`,
+		courseID, ragCanonicalStrategy,
+	).Scan(&docID)
+	if err == sql.ErrNoRows {
+		res, err := tx.Exec(
+			`INSERT INTO rag_documents(course_id, filename, char_count, chunk_count, chunk_strategy, status, progress, created_by, created_at)
+             VALUES(?,?,0,0,?,?,100,?,?)`,
+			courseID, ragCanonicalFilename, ragCanonicalStrategy, ragDocReady, userID, now,
+		)
+		if err != nil {
+			return 0, err
+		}
+		docID, _ = res.LastInsertId()
+	} else if err != nil {
+		return 0, err
+	}
+
+	var previous sql.NullInt64
+	if err := tx.QueryRow(`SELECT canonical_chunk_id FROM rag_queries WHERE id = ?`, queryID).Scan(&previous); err != nil {
+		return 0, err
+	}
+	if previous.Valid {
+		if _, err := tx.Exec(`DELETE FROM rag_chunks WHERE id = ?`, previous.Int64); err != nil {
+			return 0, err
+		}
+	}
+
+	var nextIndex int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(chunk_index) + 1, 0) FROM rag_chunks WHERE doc_id = ?`, docID).Scan(&nextIndex); err != nil {
+		return 0, err
+	}
+	embeddingJSON, _ := json.Marshal(vectors[0])
+	res, err := tx.Exec(
+		`INSERT INTO rag_chunks(doc_id, course_id, chunk_index, content, embedding, embedding_model, embedding_dim, content_hash, metadata, created_at)
+         VALUES(?,?,?,?,?,?,?,?,?,?)`,
+		docID, courseID, nextIndex, content, string(embeddingJSON), embedModel, len(vectors[0]),
+		ragpkg.ContentHash(content), ragpkg.ChunkMeta{Canonical: true}.Encode(), now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	chunkID, _ := res.LastInsertId()
+
+	if _, err := tx.Exec(
+		`UPDATE rag_documents
+         SET chunk_count = (SELECT COUNT(*) FROM rag_chunks WHERE doc_id = ?),
+             char_count = (SELECT COALESCE(SUM(LENGTH(content)), 0) FROM rag_chunks WHERE doc_id = ?)
+         WHERE id = ?`,
+		docID, docID, docID,
+	); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(
+		`UPDATE rag_queries SET review_status = ?, reviewed_by = ?, reviewed_at = ?, canonical_chunk_id = ? WHERE id = ?`,
+		ragReviewResolved, userID, now, chunkID, queryID,
+	); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if ragIndexStore != nil {
+		if previous.Valid {
+			ragIndexStore.Remove(courseID, []int64{previous.Int64})
+		}
+		chunk := ragpkg.Chunk{ID: chunkID, DocID: docID, Content: content, Embedding: vectors[0]}
+		ragIndexStore.Add(courseID, embedModel, []ragpkg.Chunk{chunk})
+	}
+	// 标准答案优先作为依据，已缓存的旧回答随之失效
+	invalidateRAGAnswerCache(courseID)
+	return chunkID, nil
+}
+
+// DismissRAGReview 教师确认问答无需处理，将其移出审核队列
+func DismissRAGReview(c *gin.Context) {
+	courseID, ok := parseCourseID(c)
+	if !ok {
+		return
+	}
+	if !isCourseInstructorOrAdmin(c, courseID) {
+		utils.Forbidden(c, "仅课程教师或管理员可以审核问答")
+		return
+	}
+	queryID, ok := parseRAGQueryID(c)
+	if !ok {
+		return
+	}
+
+	res, err := database.DB.Exec(
+		`UPDATE rag_queries SET review_status = ?, reviewed_by = ?, reviewed_at = ? WHERE id = ? AND course_id = ?`,
+		ragReviewDismissed, getCurrentUserID(c), time.Now(), queryID, courseID,
+	)
+	if err != nil {
+		utils.InternalServerError(c, "更新审核状态失败")
+		return
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		utils.NotFound(c, "问答记录不存在")
+		return
+	}
+	utils.Success(c, gin.H{"query_id": queryID, "review_status": ragReviewDismissed})
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/online-education-platform/backend/database"
+	ragpkg "github.com/online-education-platform/backend/rag"
+)
+
+func withRAGFeedbackTestDB(t *testing.T) {
+	t.Helper()
+	withTestDB(t)
+	seedTestDB(t,
+		`INSERT INTO courses (id, title, description, instructor_id) VALUES (1, '数据结构', '', 1)`,
+		`INSERT INTO users (id, username, password_hash, role) VALUES (1, 'teacher', 'x', 'INSTRUCTOR'), (2, 'alice', 'x', 'STUDENT'), (3, 'bob', 'x', 'STUDENT')`,
+		`INSERT INTO rag_queries (id, course_id, user_id, question, rewritten_query, answer, no_evidence, created_at)
+         VALUES (1, 1, 2, '那它呢？', '顺序栈如何判满？', '当前课程资料中未找到足够依据来回答这个问题。', 1, '2026-01-01 10:00:00'),
+                (2, 1, 2, '什么是队列？', '什么是队列？', '队列是后进先出的线性表。', 0, '2026-01-01 11:00:00')`,
+	)
+}
+
+func performRAGRequest(handler gin.HandlerFunc, role string, userID int64, params gin.Params, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	method := http.MethodGet
+	if body != "" {
+		method = http.MethodPost
+	}
+	c.Request = httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+	c.Set("role", role)
+	c.Set("userID", userID)
+	handler(c)
+	return w
+}
+
+func TestSubmitRAGFeedbackOnlyByAsker(t *testing.T) {
+	withRAGFeedbackTestDB(t)
+	params := gin.Params{{Key: "id", Value: "1"}, {Key: "queryId", Value: "2"}}
+
+	if w := performRAGRequest(SubmitRAGFeedback, "STUDENT", 3, params, "/", `{"rating":-1}`); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another student, got %d", w.Code)
+	}
+	if w := performRAGRequest(SubmitRAGFeedback, "STUDENT", 2, params, "/", `{"rating":0}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid rating, got %d", w.Code)
+	}
+	for _, body := range []string{`{"rating":1}`, `{"rating":-1,"comment":"队列应该是先进先出"}`} {
+		if w := performRAGRequest(SubmitRAGFeedback, "STUDENT", 2, params, "/", body); w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	var count, rating int
+	var comment string
+	database.DB.QueryRow(`SELECT COUNT(*), MAX(rating), MAX(comment) FROM rag_query_feedback WHERE query_id = 2`).Scan(&count, &rating, &comment)
+	if count != 1 || rating != -1 || comment != "队列应该是先进先出" {
+		t.Fatalf("expected feedback to be upserted, got count=%d rating=%d comment=%q", count, rating, comment)
+	}
+}
+
+func TestRAGReviewQueueAndCanonicalAnswer(t *testing.T) {
+	withRAGFeedbackTestDB(t)
+	newRAGModelTestServer(t, "")
+	database.DB.Exec(`INSERT INTO rag_query_feedback (query_id, course_id, user_id, rating, comment) VALUES (2, 1, 2, -1, '答错了')`)
+
+	courseParams := gin.Params{{Key: "id", Value: "1"}}
+	if w := performRAGRequest(ListRAGReviewQueue, "STUDENT", 2, courseParams, "/", ""); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for student, got %d", w.Code)
+	}
+	if items := decodeReviewQueue(t, "/?status=open"); len(items) != 2 {
+		t.Fatalf("expected 2 open review items, got %d", len(items))
+	}
+	if items := decodeReviewQueue(t, "/?reason=low_rated"); len(items) != 1 || items[0]["query_id"] != float64(2) {
+		t.Fatalf("expected only the low-rated query, got %#v", items)
+	}
+
+	params := gin.Params{{Key: "id", Value: "1"}, {Key: "queryId", Value: "1"}}
+	w := performRAGRequest(SaveRAGCanonicalAnswer, "INSTRUCTOR", 1, params, "/", `{"answer":"顺序栈在栈顶指针等于容量减一时为满。"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if data := decodeResponseData(t, w.Body.Bytes()); data["question"] != "顺序栈如何判满？" {
+		t.Fatalf("expected rewritten question to be used, got %#v", data["question"])
+	}
+
+	items := decodeReviewQueue(t, "/?status=resolved")
+	if len(items) != 1 || items[0]["canonical_answer"] == "" {
+		t.Fatalf("expected resolved item with canonical answer, got %#v", items)
+	}
+	if open := decodeReviewQueue(t, "/"); len(open) != 1 {
+		t.Fatalf("expected 1 open item after resolving, got %d", len(open))
+	}
+
+	// 普通资料与标准答案向量相同，检索时标准答案应排在最前
+	enqueueTestDocument(t, "stack.md", "栈的判满条件与栈顶指针有关。")
+	for runNextRAGIngestJob() {
+	}
+	cfg, _ := resolveRAGConfig("", "")
+	plan := &ragQueryPlan{CourseID: 1, Question: "顺序栈什么时候满？", RewrittenQuery: "顺序栈什么时候满？", Config: cfg}
+	if err := plan.retrieve(context.Background(), ragRetrieveOptions{Retrieval: ragpkg.RetrievalQuery{Mode: ragpkg.RetrievalVector}, TopK: 2}); err != nil {
+		t.Fatalf("retrieve: %v", err)
+	}
+	if len(plan.Sources) != 2 || !plan.Sources[0].Canonical || plan.Sources[0].Location != ragCanonicalFilename {
+		t.Fatalf("expected canonical answer first, got %#v", plan.Sources)
+	}
+}
+
+func decodeReviewQueue(t *testing.T, target string) []map[string]any {
+	t.Helper()
+	w := performRAGRequest(ListRAGReviewQueue, "INSTRUCTOR", 1, gin.Params{{Key: "id", Value: "1"}}, target, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data []map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode review queue: %v", err)
+	}
+	return resp.Data
+}
@@ -0,0 +1,320 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/online-education-platform/backend/database"
+	ragpkg "github.com/online-education-platform/backend/rag"
+	"github.com/online-education-platform/backend/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	ragIngestMaxAttempts  = 4
+	ragIngestPollInterval = 3 * time.Second
+	ragIngestEmbedBatch   = 16
+
+	ragJobQueued = "queued"
+
+	ragDocQueued     = "queued"
+	ragDocProcessing = "processing"
+	ragDocReady      = "ready"
+	ragDocFailed     = "failed"
+)
+
+var (
+	// ragIngestWake 在新任务入队时唤醒后台 worker，避免等待下一次轮询
+	ragIngestWake = make(chan struct{}, 1)
+	// ragIngestKeys 仅在内存中保存上传者的个人 API Key（任务 ID -> Key），不落库；
+	// 任务只记录 personal_key 标记，进程重启后 Key 丢失的任务直接失败，由上传者重新上传
+	ragIngestKeys sync.Map
+	ragIngestOnce sync.Once
+)
+
+type ragIngestJob struct {
+	ID       int64
+	DocID    int64
+	CourseID int64
+	Filename string
+	Strategy ragpkg.ChunkStrategy
+	Provider string
+	// PersonalKey 表示上传时使用了个人 API Key，不能回退到环境变量中的 Key
+	PersonalKey bool
+	Payload     []byte
+	Attempts    int
+	// MaxAttempts 为入队时记录的最大尝试次数
+	MaxAttempts int
+}
+
+// enqueueRAGIngest 登记文档（status=queued）并写入入库任务，返回文档 ID；
+// personalKey 表示 cfg.APIKey 是上传者的个人 Key
+func enqueueRAGIngest(courseID, userID int64, filename string, strategy ragpkg.ChunkStrategy, cfg ragConfig, personalKey bool, payload []byte) (int64, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	now := time.Now()
+	res, err := tx.Exec(
+		`INSERT INTO rag_documents(course_id, filename, char_count, chunk_count, chunk_strategy, status, progress, created_by, created_at)
+         VALUES(?,?,?,?,?,?,?,?,?)`,
+		courseID, filename, 0, 0, string(strategy), ragDocQueued, 0, userID, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	docID, _ := res.LastInsertId()
+
+	res, err = tx.Exec(
+		`INSERT INTO rag_ingest_jobs(doc_id, course_id, filename, chunk_strategy, provider, personal_key, payload, status, attempts, max_attempts, next_run_at, created_at, updated_at)
+         VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		docID, courseID, filename, string(strategy), cfg.Provider, personalKey, payload, ragJobQueued, 0, ragIngestMaxAttempts, now, now, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	jobID, _ := res.LastInsertId()
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	if personalKey {
+		ragIngestKeys.Store(jobID, cfg.APIKey)
+	}
+	select {
+	case ragIngestWake <- struct{}{}:
+	default:
+	}
+	return docID, nil
+}
+
+// StartRAGIngestWorker 启动后台入库 worker（只启动一次），按 next_run_at 顺序逐个处理排队任务
+func StartRAGIngestWorker() {
+	ragIngestOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(ragIngestPollInterval)
+			defer ticker.Stop()
+			for {
+				for runNextRAGIngestJob() {
+				}
+				select {
+				case <-ticker.C:
+				case <-ragIngestWake:
+				}
+			}
+		}()
+	})
+}
+
+// runNextRAGIngestJob 认领并处理一个到期任务，没有可处理的任务时返回 false
+func runNextRAGIngestJob() bool {
+	job, err := claimRAGIngestJob(time.Now())
+	if err != nil {
+		if err != sql.ErrNoRows {
+			utils.GetLogger().Warn("failed to claim rag ingest job", zap.Error(err))
+		}
+		return false
+	}
+
+	if err := processRAGIngestJob(job); err != nil {
+		failRAGIngestJob(job, err, time.Now())
+	}
+	return true
+}
+
+func claimRAGIngestJob(now time.Time) (*ragIngestJob, error) {
+	job := &ragIngestJob{}
+	var strategy string
+	err := database.DB.QueryRow(
+		`SELECT id, doc_id, course_id, filename, COALESCE(chunk_strategy, ''), COALESCE(provider, ''), personal_key, payload, attempts, max_attempts
+         FROM rag_ingest_jobs
+         WHERE status = ? AND next_run_at <= ?
+         ORDER BY next_run_at ASC, id ASC
+         LIMIT 1`,
+		ragJobQueued, now,
+	).Scan(&job.ID, &job.DocID, &job.CourseID, &job.Filename, &strategy, &job.Provider, &job.PersonalKey, &job.Payload, &job.Attempts, &job.MaxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	job.Strategy = ragpkg.ChunkStrategy(strategy)
+
+	res, err := database.DB.Exec(
+		`UPDATE rag_ingest_jobs SET status = ?, attempts = attempts + 1, updated_at = ? WHERE id = ? AND status = ?`,
+		ragJobRunning, now, job.ID, ragJobQueued,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return nil, sql.ErrNoRows
+	}
+	job.Attempts++
+	setRAGDocumentStatus(job.DocID, ragDocProcessing, "", 0)
+	return job, nil
+}
+
+// processRAGIngestJob 解析、分块、向量化并写入分块，成功后文档变为 ready
+func processRAGIngestJob(job *ragIngestJob) error {
+	apiKey := ""
+	if key, ok := ragIngestKeys.Load(job.ID); ok {
+		apiKey, _ = key.(string)
+	} else if job.PersonalKey {
+		return newPermanentJobError("上传时使用的个人 API Key 已失效（服务重启后不再保留），请重新上传文档")
+	}
+	ragCfg, err := resolveRAGConfig(apiKey, job.Provider)
+	if err != nil {
+		return &permanentJobError{err: err}
+	}
+	var uploaderID int64
+	database.DB.QueryRow(`SELECT COALESCE(created_by, 0) FROM rag_documents WHERE id = ?`, job.DocID).Scan(&uploaderID)
+	ragCfg = aiUsageScopeForUser(uploaderID, job.CourseID, aiFeatureRAGIngest).meter(ragCfg)
+
+	var segments []ragpkg.Segment
+	if job.Strategy == ragpkg.ChunkStructured {
+		segments, err = ragpkg.ExtractStructuredSegments(job.Filename, bytes.NewReader(job.Payload))
+	} else {
+		segments, err = ragpkg.ExtractSegments(job.Filename, bytes.NewReader(job.Payload))
+	}
+	if err != nil {
+		return newPermanentJobError("文档解析失败: %v", err)
+	}
+
+	charCount := 0
+	for _, segment := range segments {
+		charCount += len([]rune(segment.Text))
+	}
+	var chunks []ragpkg.TextChunk
+	if job.Strategy == ragpkg.ChunkStructured {
+		chunks = ragpkg.ChunkStructuredSegments(segments, ragChunkMaxTokens)
+	} else {
+		chunks = ragpkg.ChunkSegments(segments, ragChunkSize, ragChunkOverlap)
+	}
+	if charCount == 0 || len(chunks) == 0 {
+		return newPermanentJobError("文档内容为空")
+	}
+
+	embedder := newRAGProvider(ragCfg)
+	embedModel := embedder.ModelName()
+	embeddings := make([][]float32, 0, len(chunks))
+	for start := 0; start < len(chunks); start += ragIngestEmbedBatch {
+		end := start + ragIngestEmbedBatch
+		if end > len(chunks) {
+			end = len(chunks)
+		}
+		contents := make([]string, 0, end-start)
+		for _, chunk := range chunks[start:end] {
+			contents = append(contents, chunk.Content)
+		}
+		vectors, _, err := ragpkg.CachedEmbed(context.Background(), embedder, ragEmbeddingCache{}, contents)
+		if err != nil {
+			return fmt.Errorf("文档向量化失败: %w", err)
+		}
+		embeddings = append(embeddings, vectors...)
+		// 写库前最多报告 99%，ready 时才是 100%
+		setRAGDocumentStatus(job.DocID, ragDocProcessing, "", end*99/len(chunks))
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var exists int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM rag_documents WHERE id = ?`, job.DocID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 0 {
+		// 处理期间文档已被删除，丢弃结果
+		if _, err := tx.Exec(`DELETE FROM rag_ingest_jobs WHERE id = ?`, job.ID); err != nil {
+			return err
+		}
+		ragIngestKeys.Delete(job.ID)
+		return tx.Commit()
+	}
+
+	indexed := make([]ragpkg.Chunk, 0, len(chunks))
+	now := time.Now()
+	for i, chunk := range chunks {
+		embeddingJSON, _ := json.Marshal(embeddings[i])
+		chunkRes, err := tx.Exec(
+			`INSERT INTO rag_chunks(doc_id, course_id, chunk_index, content, embedding, embedding_model, embedding_dim, content_hash, metadata, created_at)
+             VALUES(?,?,?,?,?,?,?,?,?,?)`,
+			job.DocID, job.CourseID, i, chunk.Content, string(embeddingJSON), embedModel, len(embeddings[i]),
+			ragpkg.ContentHash(chunk.Content), chunk.Meta.Encode(), now,
+		)
+		if err != nil {
+			return fmt.Errorf("保存文档分块失败: %w", err)
+		}
+		chunkID, _ := chunkRes.LastInsertId()
+		indexed = append(indexed, ragpkg.Chunk{ID: chunkID, DocID: job.DocID, Content: chunk.Content, Embedding: embeddings[i]})
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE rag_documents SET status = ?, error = NULL, progress = 100, char_count = ?, chunk_count = ? WHERE id = ?`,
+		ragDocReady, charCount, len(chunks), job.DocID,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`UPDATE rag_ingest_jobs SET status = ?, payload = NULL, last_error = NULL, updated_at = ? WHERE id = ?`,
+		ragJobCompleted, now, job.ID,
+	); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	ragIngestKeys.Delete(job.ID)
+
+	if ragIndexStore != nil {
+		ragIndexStore.Add(job.CourseID, embedModel, indexed)
+	}
+	invalidateRAGAnswerCache(job.CourseID)
+	return nil
+}
+
+// failRAGIngestJob 记录失败：可重试的错误按指数退避重新排队，超过次数或永久错误时标记失败
+func failRAGIngestJob(job *ragIngestJob, jobErr error, now time.Time) {
+	logger := utils.GetLogger()
+	retryAt, retry := jobRetryAt(jobErr, job.Attempts, job.MaxAttempts, now)
+	if !retry {
+		logger.Error("rag ingest job failed", zap.Int64("jobID", job.ID), zap.Int("attempts", job.Attempts), zap.Error(jobErr))
+		database.DB.Exec( //nolint:errcheck
+			`UPDATE rag_ingest_jobs SET status = ?, payload = NULL, last_error = ?, updated_at = ? WHERE id = ?`,
+			ragJobFailed, jobErr.Error(), now, job.ID,
+		)
+		setRAGDocumentStatus(job.DocID, ragDocFailed, jobErr.Error(), 0)
+		ragIngestKeys.Delete(job.ID)
+		return
+	}
+
+	logger.Warn("rag ingest job will retry", zap.Int64("jobID", job.ID), zap.Int("attempts", job.Attempts), zap.Time("retryAt", retryAt), zap.Error(jobErr))
+	database.DB.Exec( //nolint:errcheck
+		`UPDATE rag_ingest_jobs SET status = ?, next_run_at = ?, last_error = ?, updated_at = ? WHERE id = ?`,
+		ragJobQueued, retryAt, jobErr.Error(), now, job.ID,
+	)
+	message := fmt.Sprintf("第 %d 次处理失败，将于 %s 重试: %v", job.Attempts, retryAt.Format("15:04:05"), jobErr)
+	setRAGDocumentStatus(job.DocID, ragDocQueued, message, 0)
+}
+
+func setRAGDocumentStatus(docID int64, status, message string, progress int) {
+	var errValue interface{}
+	if message != "" {
+		errValue = message
+	}
+	if _, err := database.DB.Exec(
+		`UPDATE rag_documents SET status = ?, error = ?, progress = ? WHERE id = ?`,
+		status, errValue, progress, docID,
+	); err != nil {
+		utils.GetLogger().Warn("failed to update rag document status", zap.Int64("docID", docID), zap.Error(err))
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/online-education-platform/backend/database"
+	ragpkg "github.com/online-education-platform/backend/rag"
+)
+
+func newEmbeddingTestServer(t *testing.T, status int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		var req struct {
+			Input []string `json:"input"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		data := make([]map[string]any, 0, len(req.Input))
+		for i := range req.Input {
+			data = append(data, map[string]any{"index": i, "embedding": []float32{1, float32(i)}})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("OPENAI_BASE_URL", server.URL)
+	t.Setenv("EMBEDDING_MODEL", "test-embed")
+	t.Setenv("RAG_PROVIDER", "")
+	t.Setenv("AI_PROVIDER", "")
+	return server
+}
+
+func enqueueTestDocument(t *testing.T, filename, content string) int64 {
+	t.Helper()
+	cfg, err := resolveRAGConfig("", "")
+	if err != nil {
+		t.Fatalf("resolveRAGConfig: %v", err)
+	}
+	docID, err := enqueueRAGIngest(1, 1, filename, ragpkg.ChunkStructured, cfg, false, []byte(content))
+	if err != nil {
+		t.Fatalf("enqueueRAGIngest: %v", err)
+	}
+	return docID
+}
+
+func ragDocumentState(t *testing.T, docID int64) (status, message string, chunks int) {
+	t.Helper()
+	var errText sql.NullString
+	if err := database.DB.QueryRow(
+		`SELECT status, error, chunk_count FROM rag_documents WHERE id = ?`, docID,
+	).Scan(&status, &errText, &chunks); err != nil {
+		t.Fatalf("load document: %v", err)
+	}
+	return status, errText.String, chunks
+}
+
+func TestRAGIngestJobMarksDocumentReady(t *testing.T) {
+	withTestDB(t)
+	newEmbeddingTestServer(t, http.StatusOK)
+
+	docID := enqueueTestDocument(t, "stack.md", "# 栈\n\n栈是后进先出的线性表。\n\n## 顺序栈\n\n用数组实现。")
+	if status, _, _ := ragDocumentState(t, docID); status != ragDocQueued {
+		t.Fatalf("expected queued document, got %q", status)
+	}
+
+	if !runNextRAGIngestJob() {
+		t.Fatal("expected a job to run")
+	}
+	status, message, chunks := ragDocumentState(t, docID)
+	if status != ragDocReady || message != "" || chunks != 2 {
+		t.Fatalf("unexpected document state: status=%q error=%q chunks=%d", status, message, chunks)
+	}
+
+	var model string
+	var payloadLen int
+	database.DB.QueryRow(`SELECT embedding_model FROM rag_chunks WHERE doc_id = ? LIMIT 1`, docID).Scan(&model)
+	database.DB.QueryRow(`SELECT COALESCE(LENGTH(payload), 0) FROM rag_ingest_jobs WHERE doc_id = ?`, docID).Scan(&payloadLen)
+	if model != "test-embed" || payloadLen != 0 {
+		t.Fatalf("expected chunks tagged with model and payload cleared, got model=%q payload=%d", model, payloadLen)
+	}
+	if runNextRAGIngestJob() {
+		t.Fatal("expected no remaining jobs")
+	}
+}
+
+func TestRAGIngestJobRetriesWithBackoff(t *testing.T) {
+	withTestDB(t)
+	newEmbeddingTestServer(t, http.StatusServiceUnavailable)
+	// 只验证任务级重试，关闭单次请求内的重试
+	t.Setenv("LLM_MAX_RETRIES", "0")
+
+	docID := enqueueTestDocument(t, "queue.md", "队列是先进先出的线性表。")
+	start := time.Now()
+	if !runNextRAGIngestJob() {
+		t.Fatal("expected a job to run")
+	}
+
+	status, message, _ := ragDocumentState(t, docID)
+	if status != ragDocQueued || !strings.Contains(message, "第 1 次处理失败") {
+		t.Fatalf("expected document re-queued with retry message, got status=%q error=%q", status, message)
+	}
+	if runNextRAGIngestJob() {
+		t.Fatal("retry must wait for backoff")
+	}
+
+	// 把剩余次数耗尽：每次都让任务立即到期
+	for attempt := 2; attempt <= ragIngestMaxAttempts; attempt++ {
+		database.DB.Exec(`UPDATE rag_ingest_jobs SET next_run_at = ?`, start)
+		if !runNextRAGIngestJob() {
+			t.Fatalf("attempt %d: expected job to run", attempt)
+		}
+	}
+	status, message, _ = ragDocumentState(t, docID)
+	if status != ragDocFailed || !strings.Contains(message, "向量化失败") {
+		t.Fatalf("expected failed document, got status=%q error=%q", status, message)
+	}
+}
+
+func TestRAGIngestJobFailsPermanentlyOnEmptyDocument(t *testing.T) {
+	withTestDB(t)
+	newEmbeddingTestServer(t, http.StatusOK)
+
+	docID := enqueueTestDocument(t, "empty.md", "   \n")
+	runNextRAGIngestJob()
+
+	status, message, _ := ragDocumentState(t, docID)
+	if status != ragDocFailed || message != "文档内容为空" {
+		t.Fatalf("expected permanent failure, got status=%q error=%q", status, message)
+	}
+}
+
+func TestRAGIngestJobFailsWhenPersonalKeyLost(t *testing.T) {
+	withTestDB(t)
+	newEmbeddingTestServer(t, http.StatusOK)
+
+	cfg, err := resolveRAGConfig("personal-key", "")
+	if err != nil {
+		t.Fatalf("resolveRAGConfig: %v", err)
+	}
+	docID, err := enqueueRAGIngest(1, 1, "stack.md", ragpkg.ChunkStructured, cfg, true, []byte("栈是后进先出的线性表。"))
+	if err != nil {
+		t.Fatalf("enqueueRAGIngest: %v", err)
+	}
+	// 模拟进程重启：内存中的个人 Key 丢失，环境变量中的 Key 仍在
+	ragIngestKeys.Range(func(key, _ any) bool {
+		ragIngestKeys.Delete(key)
+		return true
+	})
+	runNextRAGIngestJob()
+
+	status, message, chunks := ragDocumentState(t, docID)
+	if status != ragDocFailed || !strings.Contains(message, "请重新上传") || chunks != 0 {
+		t.Fatalf("expected the job to fail instead of using the server key, got status=%q error=%q chunks=%d", status, message, chunks)
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+
+	ragpkg "github.com/online-education-platform/backend/rag"
+)
+
+// ragInsufficientEvidenceAnswer 重排后没有分块达到相关度阈值时直接返回，不再调用生成模型
+const ragInsufficientEvidenceAnswer = "当前课程资料中未找到足够依据来回答这个问题，请换个问法或先补充课程资料。"
+
+// newRAGReranker 根据环境变量组装重排器，RAG_RERANK=off 时返回 nil 表示不重排。
+// 百炼使用 text-rerank 原生接口，配置 RERANK_BASE_URL 时使用 Cohere 兼容的 /rerank 接口；
+// 专用接口不可用或未配置时退回到用对话模型打分。RAG_RERANK=llm 时只用对话模型。
+func newRAGReranker(cfg ragConfig) ragpkg.Reranker {
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("RAG_RERANK")))
+	switch mode {
+	case "off", "false", "0", "none":
+		return nil
+	}
+
+	llm := &ragpkg.LLMReranker{Client: newRAGProvider(cfg)}
+	if mode == "llm" {
+		return llm
+	}
+
+	model := strings.TrimSpace(os.Getenv("RERANK_MODEL"))
+	if baseURL := strings.TrimSpace(os.Getenv("RERANK_BASE_URL")); baseURL != "" {
+		apiKey := strings.TrimSpace(os.Getenv("RERANK_API_KEY"))
+		if apiKey == "" {
+			apiKey = cfg.APIKey
+		}
+		api := &ragpkg.APIReranker{APIKey: apiKey, BaseURL: baseURL, Model: model, Format: ragpkg.RerankCohere}
+		return ragpkg.FallbackReranker{api, llm}
+	}
+	if ragpkg.NormalizeProvider(cfg.Provider) == ragpkg.ProviderDashScope {
+		api := &ragpkg.APIReranker{APIKey: cfg.APIKey, Model: model, Format: ragpkg.RerankDashScope}
+		return ragpkg.FallbackReranker{api, llm}
+	}
+	return llm
+}
+
+// ragRerankThreshold 读取 RAG_RERANK_THRESHOLD（0-1），未配置或非法时使用默认阈值
+func ragRerankThreshold() float64 {
+	raw := strings.TrimSpace(os.Getenv("RAG_RERANK_THRESHOLD"))
+	if raw != "" {
+		if threshold, err := strconv.ParseFloat(raw, 64); err == nil && threshold >= 0 && threshold <= 1 {
+			return threshold
+		}
+	}
+	return ragpkg.DefaultRerankThreshold
+}
+
+// rerankRAGChunks 对召回的分块重排并按阈值过滤，返回保留的分块（按相关度降序）及其得分
+func rerankRAGChunks(ctx context.Context, reranker ragpkg.Reranker, query string, chunks []storedRAGChunk, k int, threshold float64) ([]storedRAGChunk, map[int64]float64, error) {
+	candidates := make([]ragpkg.RerankCandidate, 0, len(chunks))
+	byID := make(map[int64]storedRAGChunk, len(chunks))
+	for _, chunk := range chunks {
+		candidates = append(candidates, ragpkg.RerankCandidate{ID: chunk.ID, Content: chunk.Content})
+		byID[chunk.ID] = chunk
+	}
+
+	results, err := ragpkg.RerankResults(ctx, reranker, query, candidates, k, threshold)
+	if err != nil {
+		return nil, nil, err
+	}
+	kept := make([]storedRAGChunk, 0, len(results))
+	scores := make(map[int64]float64, len(results))
+	for _, result := range results {
+		kept = append(kept, byID[result.ID])
+		scores[result.ID] = result.Score
+	}
+	return kept, scores, nil
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"database/sql"
+	"sync"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/online-education-platform/backend/database"
+)
+
+// testSchema 按真实迁移流程建好的表结构，整个测试包只迁移一次
+var testSchema struct {
+	once       sync.Once
+	statements []string
+	err        error
+}
+
+// loadTestSchema 在临时内存库上执行 database.Migrate，记录迁移后的全部建表、索引语句
+func loadTestSchema() ([]string, error) {
+	testSchema.once.Do(func() {
+		db, err := sql.Open("sqlite3", ":memory:")
+		if err != nil {
+			testSchema.err = err
+			return
+		}
+		defer db.Close()
+		db.SetMaxOpenConns(1)
+
+		originalDB := database.DB
+		database.DB = db
+		err = database.Migrate("../database/schema.sql")
+		database.DB = originalDB
+		if err != nil {
+			testSchema.err = err
+			return
+		}
+
+		// 先建表再建索引、视图和触发器，重建过的表 rowid 顺序可能靠后
+		rows, err := db.Query(`
+			SELECT sql FROM sqlite_master
+			WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%'
+			ORDER BY CASE type WHEN 'table' THEN 0 ELSE 1 END, rowid`)
+		if err != nil {
+			testSchema.err = err
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var stmt string
+			if err := rows.Scan(&stmt); err != nil {
+				testSchema.err = err
+				return
+			}
+			testSchema.statements = append(testSchema.statements, stmt)
+		}
+		testSchema.err = rows.Err()
+	})
+	return testSchema.statements, testSchema.err
+}
+
+// withTestDB 换上一个表结构与线上迁移结果一致的空内存库，测试只需写入自己的数据
+func withTestDB(t *testing.T) {
+	t.Helper()
+	statements, err := loadTestSchema()
+	if err != nil {
+		t.Fatalf("migrate test schema: %v", err)
+	}
+
+	originalDB := database.DB
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open sqlite memory db: %v", err)
+	}
+	// 内存库每个连接相互独立，固定为单连接
+	db.SetMaxOpenConns(1)
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = originalDB
+		_ = db.Close()
+	})
+
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("create test schema: %v", err)
+		}
+	}
+}
+
+// seedTestDB 依次执行测试数据语句
+func seedTestDB(t *testing.T, statements ...string) {
+	t.Helper()
+	for _, stmt := range statements {
+		if _, err := database.DB.Exec(stmt); err != nil {
+			t.Fatalf("seed sqlite memory db: %v\n%s", err, stmt)
+		}
+	}
+}
@@ -1,22 +0,0 @@
-package otel_rag
-
-import (
-	"context"
-	"fmt"
-)
-
-// RagEngine 模拟 RAG 辅导引擎逻辑，补齐论文描述中的“空壳”
-type RagEngine struct {
-	VectorDB interface{} // 预留 FAISS 接口
-}
-
-// GenerateCoachingAnswer 根据学生错误点和知识库生成个性化辅导
-func (e *RagEngine) GenerateCoachingAnswer(ctx context.Context, studentError string) (string, error) {
-	// 1. 模拟 Top-K 检索
-	fmt.Printf("[RAG] 正在根据错误点 [%s] 检索向量知识库...\n", studentError)
-	
-	// 2. 模拟 LLM 注入 Context
-	coachingPrompt := fmt.Sprintf("基于检索到的课件内容，由于你在该题目中出现了 [%s] 错误，建议复习以下章节...", studentError)
-	
-	return coachingPrompt, nil
-}
@@ -0,0 +1,499 @@
+// Package judge 在沙箱中编译并运行学生提交的程序，逐个测试用例比对输出。
+// 每个进程限制 CPU 时间、地址空间、写文件大小和进程数；Linux 上隔离运行时进入独立的挂载、PID、网络等命名空间，
+// 根目录只有只读的工具链和本次评测的工作目录，没有网络，结束时整个命名空间的进程一并结束；
+// 以 root 运行服务时程序降权为 nobody
+package judge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Verdict 评测结果
+type Verdict string
+
+const (
+	Accepted            Verdict = "AC"
+	WrongAnswer         Verdict = "WA"
+	TimeLimitExceeded   Verdict = "TLE"
+	MemoryLimitExceeded Verdict = "MLE"
+	OutputLimitExceeded Verdict = "OLE"
+	RuntimeError        Verdict = "RE"
+	CompileError        Verdict = "CE"
+)
+
+// 隔离方式
+const (
+	IsolationAuto     = "auto"     // 沙箱可用时使用，否则只靠资源限制
+	IsolationRequired = "required" // 无法搭建沙箱时拒绝评测（默认）
+	IsolationOff      = "off"
+)
+
+// 沙箱中的工作目录和 Go 构建缓存的挂载位置
+const (
+	sandboxWorkDir    = "/box"
+	sandboxGoCacheDir = "/gocache"
+)
+
+const (
+	compileTimeout  = 60 * time.Second
+	maxOutputBytes  = 1 << 20
+	maxMessageBytes = 4 << 10
+	fileSizeLimitKB = 16 << 10
+	// 编译产物和 Go 的构建缓存（如标准库 runtime 包）可能远大于运行时的写文件上限
+	compileFileSizeKB = 512 << 10
+	// 允许的进程（线程）数：Go 和 Java 的运行时会起多个线程，编译器还会派生 cc1、as、ld 等
+	runProcessLimit     = 64
+	compileProcessLimit = 256
+	defaultMemoryMB     = 256
+	defaultTimeLimit    = time.Second
+)
+
+// ErrUnsupportedLanguage 不支持的语言
+var ErrUnsupportedLanguage = errors.New("不支持的编程语言")
+
+// TestCase 一组输入和期望输出
+type TestCase struct {
+	Input  string
+	Output string
+}
+
+// Limits 每个测试用例的资源限制
+type Limits struct {
+	Time     time.Duration
+	MemoryMB int
+}
+
+// Submission 学生提交的源代码
+type Submission struct {
+	Language string
+	Source   string
+}
+
+// Options 评测环境配置
+type Options struct {
+	Isolation string
+	// WorkDir 评测临时目录的父目录，为空时使用系统临时目录
+	WorkDir string
+	// ReadOnlyPaths 除系统目录和自动识别的工具链目录外，额外只读挂载进沙箱的路径
+	ReadOnlyPaths []string
+}
+
+// CaseResult 单个测试用例的结果，不包含用例的输入输出，可以展示给学生
+type CaseResult struct {
+	Verdict  Verdict `json:"verdict"`
+	TimeMs   int64   `json:"timeMs"`
+	MemoryKB int64   `json:"memoryKb"`
+	Message  string  `json:"message,omitempty"`
+}
+
+// Result 整份提交的评测结果：Verdict 为第一个未通过用例的结果，全部通过时为 AC
+type Result struct {
+	Verdict       Verdict      `json:"verdict"`
+	Passed        int          `json:"passed"`
+	Total         int          `json:"total"`
+	Cases         []CaseResult `json:"cases"`
+	CompileOutput string       `json:"compileOutput,omitempty"`
+	Isolated      bool         `json:"isolated"`
+}
+
+type language struct {
+	source  string
+	compile []string
+	run     []string
+	// limitAddressSpace Go 和 Java 运行时启动时会预留大量虚拟内存，不能用 RLIMIT_AS 限制，
+	// 改为限制堆大小，实际占用超限时由 watchMemory 结束进程
+	limitAddressSpace bool
+	env               func(limits Limits) []string
+}
+
+var languages = map[string]language{
+	"python": {
+		source:            "main.py",
+		run:               []string{"python3", "-S", "main.py"},
+		limitAddressSpace: true,
+	},
+	"c": {
+		source:            "main.c",
+		compile:           []string{"gcc", "-O2", "-std=c11", "-o", "main", "main.c", "-lm"},
+		run:               []string{"./main"},
+		limitAddressSpace: true,
+	},
+	"cpp": {
+		source:            "main.cpp",
+		compile:           []string{"g++", "-O2", "-std=c++17", "-o", "main", "main.cpp"},
+		run:               []string{"./main"},
+		limitAddressSpace: true,
+	},
+	"go": {
+		source:  "main.go",
+		compile: []string{"go", "build", "-o", "main", "main.go"},
+		run:     []string{"./main"},
+		env: func(limits Limits) []string {
+			return []string{fmt.Sprintf("GOMEMLIMIT=%dMiB", limits.MemoryMB), "GOMAXPROCS=1"}
+		},
+	},
+	"java": {
+		source:  "Main.java",
+		compile: []string{"javac", "-encoding", "UTF-8", "Main.java"},
+		run:     []string{"java", "-XX:+UseSerialGC", "-Xss64m", "Main"},
+		env: func(limits Limits) []string {
+			return []string{fmt.Sprintf("JAVA_TOOL_OPTIONS=-Xmx%dm", limits.MemoryMB)}
+		},
+	},
+}
+
+// Languages 返回支持的语言
+func Languages() []string {
+	names := make([]string, 0, len(languages))
+	for name := range languages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Supported 判断是否支持该语言
+func Supported(name string) bool {
+	_, ok := languages[name]
+	return ok
+}
+
+// Run 编译并逐个运行测试用例。编译失败时所有用例记为 CE；
+// 返回 error 表示评测环境本身的问题（编译器未安装、要求隔离但不可用等），可以稍后重试
+func Run(ctx context.Context, submission Submission, cases []TestCase, limits Limits, opts Options) (*Result, error) {
+	lang, ok := languages[submission.Language]
+	if !ok {
+		return nil, ErrUnsupportedLanguage
+	}
+	if limits.Time <= 0 {
+		limits.Time = defaultTimeLimit
+	}
+	if limits.MemoryMB <= 0 {
+		limits.MemoryMB = defaultMemoryMB
+	}
+
+	box, err := newSandbox(opts, &lang)
+	if err != nil {
+		return nil, err
+	}
+	defer box.cleanup()
+	if err := os.WriteFile(filepath.Join(box.dir, lang.source), []byte(submission.Source), 0o644); err != nil {
+		return nil, err
+	}
+
+	result := &Result{Total: len(cases), Cases: make([]CaseResult, 0, len(cases)), Isolated: box.isolated}
+	if len(lang.compile) > 0 {
+		if _, err := exec.LookPath(lang.compile[0]); err != nil {
+			return nil, fmt.Errorf("评测环境未安装 %s: %w", lang.compile[0], err)
+		}
+		out := box.exec(ctx, lang.compile, box.compileEnv(), "", execLimits{wall: compileTimeout, compile: true})
+		if out.err != nil {
+			return nil, out.err
+		}
+		if out.timedOut || out.exitCode != 0 {
+			result.Verdict = CompileError
+			result.CompileOutput = truncate(string(out.stderr)+string(out.stdout), maxMessageBytes)
+			for range cases {
+				result.Cases = append(result.Cases, CaseResult{Verdict: CompileError})
+			}
+			return result, nil
+		}
+	}
+	if _, err := exec.LookPath(lang.run[0]); err != nil && !strings.HasPrefix(lang.run[0], "./") {
+		return nil, fmt.Errorf("评测环境未安装 %s: %w", lang.run[0], err)
+	}
+
+	env := []string{}
+	if lang.env != nil {
+		env = lang.env(limits)
+	}
+	for _, tc := range cases {
+		caseResult, err := runCase(ctx, box, lang, env, tc, limits)
+		if err != nil {
+			return nil, err
+		}
+		if caseResult.Verdict == Accepted {
+			result.Passed++
+		} else if result.Verdict == "" {
+			result.Verdict = caseResult.Verdict
+		}
+		result.Cases = append(result.Cases, caseResult)
+	}
+	if result.Verdict == "" {
+		result.Verdict = Accepted
+	}
+	return result, nil
+}
+
+func runCase(ctx context.Context, box *sandbox, lang language, env []string, tc TestCase, limits Limits) (CaseResult, error) {
+	lim := execLimits{
+		// RLIMIT_CPU 以秒为单位，多留一秒兜底，超时由实际 CPU 时间判断；墙钟时间留出进程启动和等待 I/O 的余量
+		cpuSeconds: int((limits.Time+time.Second-1)/time.Second) + 1,
+		wall:       2*limits.Time + 500*time.Millisecond,
+		outputMax:  maxOutputBytes,
+		rssKB:      int64(limits.MemoryMB) << 10,
+	}
+	if lang.limitAddressSpace {
+		lim.memoryKB = int64(limits.MemoryMB) << 10
+	}
+	out := box.exec(ctx, lang.run, env, tc.Input, lim)
+	if out.err != nil {
+		return CaseResult{}, out.err
+	}
+
+	res := CaseResult{TimeMs: out.cpuTime.Milliseconds(), MemoryKB: out.maxRSSKB}
+	switch {
+	case out.timedOut || out.cpuTime > limits.Time:
+		res.Verdict = TimeLimitExceeded
+	case res.MemoryKB > int64(limits.MemoryMB)<<10:
+		res.Verdict = MemoryLimitExceeded
+	case out.outputExceeded:
+		res.Verdict = OutputLimitExceeded
+	case out.exitCode != 0:
+		res.Verdict = RuntimeError
+		// 受 RLIMIT_AS 限制的程序内存不足时通常表现为分配失败退出
+		res.Message = truncate(string(out.stderr), maxMessageBytes)
+	case normalizeOutput(string(out.stdout)) != normalizeOutput(tc.Output):
+		res.Verdict = WrongAnswer
+	default:
+		res.Verdict = Accepted
+	}
+	return res, nil
+}
+
+// normalizeOutput 忽略行尾空白和末尾空行
+func normalizeOutput(text string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+// compileEnv Go 的构建缓存在各次评测间共享以加快编译，只在编译时可写地挂载进沙箱
+func (s *sandbox) compileEnv() []string {
+	cache := goCacheDir()
+	if s.isolated {
+		cache = sandboxGoCacheDir
+	}
+	return []string{"GOCACHE=" + cache, "GOPATH=" + filepath.Join(s.workPath(), ".gopath"), "GOTOOLCHAIN=local", "GOPROXY=off", "CGO_ENABLED=0"}
+}
+
+// goCacheDir 缓存目录需要对降权后的进程可写
+func goCacheDir() string {
+	cache := filepath.Join(os.TempDir(), "judge-gocache")
+	if err := os.MkdirAll(cache, 0o777); err == nil {
+		os.Chmod(cache, 0o777) //nolint:errcheck
+	}
+	return cache
+}
+
+func truncate(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	return strings.ToValidUTF8(text[:max], "") + "\n..."
+}
+
+type execLimits struct {
+	// compile 编译阶段：放宽写文件大小和进程数限制，挂载共享的 Go 构建缓存
+	compile    bool
+	cpuSeconds int
+	memoryKB   int64
+	// rssKB 常驻内存上限，运行中超过即结束整个进程组
+	rssKB     int64
+	wall      time.Duration
+	outputMax int
+}
+
+type execResult struct {
+	stdout, stderr []byte
+	exitCode       int
+	timedOut       bool
+	outputExceeded bool
+	cpuTime        time.Duration
+	maxRSSKB       int64
+	err            error
+}
+
+type sandbox struct {
+	base     string
+	dir      string
+	root     string
+	readOnly []string
+	isolated bool
+	asNobody bool
+}
+
+func newSandbox(opts Options, lang *language) (*sandbox, error) {
+	isolated := false
+	switch opts.Isolation {
+	case IsolationOff:
+	case IsolationAuto:
+		isolated = sandboxAvailable(opts) == nil
+	default:
+		if err := sandboxAvailable(opts); err != nil {
+			return nil, fmt.Errorf("评测要求沙箱隔离，但当前环境无法搭建沙箱: %w", err)
+		}
+		isolated = true
+	}
+	return createSandbox(opts, lang, isolated)
+}
+
+// createSandbox 创建本次评测的临时目录：box 为程序的工作目录，root 为隔离时新根目录的挂载点
+func createSandbox(opts Options, lang *language, isolated bool) (*sandbox, error) {
+	base, err := os.MkdirTemp(opts.WorkDir, "judge-")
+	if err != nil {
+		return nil, err
+	}
+	box := &sandbox{
+		base:     base,
+		dir:      filepath.Join(base, "box"),
+		root:     filepath.Join(base, "root"),
+		isolated: isolated,
+		asNobody: os.Geteuid() == 0,
+	}
+	if isolated {
+		box.readOnly = sandboxReadOnlyPaths(lang, opts.ReadOnlyPaths)
+	}
+	mode := os.FileMode(0o755)
+	if box.asNobody {
+		// 降权后的程序需要穿过临时目录并在工作目录中写编译产物
+		mode = 0o777
+		err = os.Chmod(base, 0o711)
+	}
+	if err == nil {
+		err = os.Mkdir(box.dir, mode)
+	}
+	if err == nil {
+		err = os.Chmod(box.dir, mode)
+	}
+	if err == nil && isolated {
+		err = os.Mkdir(box.root, 0o755)
+	}
+	if err != nil {
+		os.RemoveAll(base)
+		return nil, err
+	}
+	return box, nil
+}
+
+func (s *sandbox) cleanup() {
+	os.RemoveAll(s.base)
+}
+
+// workPath 程序看到的工作目录
+func (s *sandbox) workPath() string {
+	if s.isolated {
+		return sandboxWorkDir
+	}
+	return s.dir
+}
+
+// sandboxCmd 平台相关的启动方式。report 为初始化进程报告失败原因的管道读端，没有初始化进程的平台为 nil
+type sandboxCmd struct {
+	cmd    *exec.Cmd
+	report *os.File
+}
+
+// ready 在 Start 之后调用：关闭父进程持有的写端，等初始化进程 exec 目标程序（读到 EOF）或报告搭建沙箱失败
+func (c *sandboxCmd) ready() error {
+	for _, file := range c.cmd.ExtraFiles {
+		file.Close()
+	}
+	if c.report == nil {
+		return nil
+	}
+	defer c.report.Close()
+	msg, _ := io.ReadAll(c.report)
+	if len(msg) > 0 {
+		return errors.New(string(msg))
+	}
+	return nil
+}
+
+// exec 在沙箱中运行程序，资源统计是目标程序本身的
+func (s *sandbox) exec(parent context.Context, args []string, env []string, stdin string, lim execLimits) execResult {
+	ctx, cancel := context.WithTimeout(parent, lim.wall)
+	defer cancel()
+	if lim.outputMax <= 0 {
+		lim.outputMax = maxOutputBytes
+	}
+	work := s.workPath()
+	env = append([]string{"PATH=" + os.Getenv("PATH"), "HOME=" + work, "TMPDIR=" + work, "LANG=C.UTF-8"}, env...)
+	sc, err := s.command(ctx, args, env, lim)
+	if err != nil {
+		return execResult{err: fmt.Errorf("启动评测进程失败: %w", err)}
+	}
+	// 输出超限后立即结束程序
+	stdout := &limitedBuffer{max: lim.outputMax, onExceed: cancel}
+	stderr := &limitedBuffer{max: maxMessageBytes}
+	cmd := sc.cmd
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Start(); err != nil {
+		sc.ready() //nolint:errcheck
+		return execResult{err: fmt.Errorf("启动评测进程失败: %w", err)}
+	}
+	if err := sc.ready(); err != nil {
+		cmd.Wait() //nolint:errcheck
+		return execResult{err: fmt.Errorf("搭建评测沙箱失败: %w", err)}
+	}
+	stopWatch := watchMemory(cmd.Process.Pid, lim.rssKB, func() { killProcessGroup(cmd) }) //nolint:errcheck
+	err = cmd.Wait()
+	res := execResult{stdout: stdout.Bytes(), stderr: stderr.Bytes(), outputExceeded: stdout.exceeded, maxRSSKB: stopWatch()}
+	if cmd.ProcessState != nil {
+		res.exitCode = cmd.ProcessState.ExitCode()
+		res.cpuTime = cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+	}
+	// 评测任务本身超时或被取消不是程序的问题，返回 error 让任务重试，只有本次运行的时限到了才算超时
+	if err := parent.Err(); err != nil {
+		res.err = fmt.Errorf("评测被中断: %w", err)
+		return res
+	}
+	res.timedOut = ctx.Err() == context.DeadlineExceeded
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) && !res.timedOut && !errors.Is(err, exec.ErrWaitDelay) {
+		res.err = fmt.Errorf("启动评测进程失败: %w", err)
+	}
+	return res
+}
+
+// limitedBuffer 超过上限的输出直接丢弃，避免程序无限输出占满内存。
+// 不内嵌 bytes.Buffer，否则 io.Copy 会走 ReadFrom 绕过长度检查
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	max      int
+	exceeded bool
+	onExceed func()
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.max - b.buf.Len(); len(p) > remaining {
+		if !b.exceeded && b.onExceed != nil {
+			b.onExceed()
+		}
+		b.exceeded = true
+		if remaining > 0 {
+			b.buf.Write(p[:remaining])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
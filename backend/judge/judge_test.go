@@ -0,0 +1,190 @@
+package judge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func requireTool(t *testing.T, name string) {
+	t.Helper()
+	if _, err := exec.LookPath(name); err != nil {
+		t.Skipf("%s not installed", name)
+	}
+}
+
+func requireSandbox(t *testing.T) {
+	t.Helper()
+	if err := sandboxAvailable(Options{}); err != nil {
+		t.Skipf("sandbox not available: %v", err)
+	}
+}
+
+func TestRunPythonVerdicts(t *testing.T) {
+	requireTool(t, "python3")
+	cases := []TestCase{{Input: "1 2\n", Output: "3\n"}, {Input: "5 7", Output: "12"}}
+	limits := Limits{Time: 500 * time.Millisecond, MemoryMB: 128}
+
+	tests := []struct {
+		name   string
+		source string
+		want   []Verdict
+	}{
+		{"accepted with trailing whitespace", "a, b = map(int, input().split())\nprint(a + b, ' ')\n", []Verdict{Accepted, Accepted}},
+		{"wrong answer", "a, b = map(int, input().split())\nprint(a - b if a == 1 else a + b)\n", []Verdict{WrongAnswer, Accepted}},
+		{"runtime error", "raise SystemExit(3)\n", []Verdict{RuntimeError, RuntimeError}},
+		{"time limit", "while True:\n    pass\n", []Verdict{TimeLimitExceeded, TimeLimitExceeded}},
+		{"output limit", "while True:\n    print('x' * 1000)\n", []Verdict{OutputLimitExceeded, OutputLimitExceeded}},
+	}
+	for _, tc := range tests {
+		result, err := Run(context.Background(), Submission{Language: "python", Source: tc.source}, cases, limits, Options{Isolation: IsolationAuto})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		for i, want := range tc.want {
+			if result.Cases[i].Verdict != want {
+				t.Errorf("%s: case %d expected %s, got %+v", tc.name, i+1, want, result.Cases[i])
+			}
+		}
+		if tc.want[0] == Accepted && (result.Verdict != Accepted || result.Passed != 2) {
+			t.Errorf("%s: unexpected summary %+v", tc.name, result)
+		}
+	}
+}
+
+func TestRunReturnsErrorWhenJobContextEnds(t *testing.T) {
+	requireTool(t, "python3")
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	result, err := Run(ctx, Submission{Language: "python", Source: "while True:\n    pass\n"}, []TestCase{{Output: "1"}}, Limits{Time: 2 * time.Second}, Options{Isolation: IsolationAuto})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("the job deadline must not be judged as a time limit, got %+v (%v)", result, err)
+	}
+}
+
+func TestRunBlocksNetworkWhenIsolated(t *testing.T) {
+	requireTool(t, "python3")
+	requireSandbox(t)
+	source := "import socket\ns = socket.create_connection(('1.1.1.1', 53), timeout=1)\nprint('connected')\n"
+	result, err := Run(context.Background(), Submission{Language: "python", Source: source}, []TestCase{{Output: "connected"}}, Limits{Time: 2 * time.Second}, Options{Isolation: IsolationRequired})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Isolated || result.Cases[0].Verdict != RuntimeError {
+		t.Fatalf("network access must fail inside the sandbox, got %+v", result)
+	}
+}
+
+func TestRunHidesHostFilesWhenIsolated(t *testing.T) {
+	requireTool(t, "python3")
+	requireSandbox(t)
+	dir := t.TempDir()
+	os.Chmod(dir, 0o755) //nolint:errcheck
+	secret := filepath.Join(dir, "education.db")
+	if err := os.WriteFile(secret, []byte("answers"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	source := fmt.Sprintf("for path in [%q, '/proc/%d/environ']:\n    try:\n        open(path).read()\n        print('read', path)\n    except OSError:\n        print('blocked')\n", secret, os.Getpid())
+	result, err := Run(context.Background(), Submission{Language: "python", Source: source}, []TestCase{{Output: "blocked\nblocked\n"}}, Limits{Time: 2 * time.Second}, Options{Isolation: IsolationRequired})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Verdict != Accepted {
+		t.Fatalf("host files must not be readable inside the sandbox, got %+v", result)
+	}
+}
+
+func TestRunKillsEscapedProcessesWhenIsolated(t *testing.T) {
+	requireTool(t, "python3")
+	requireSandbox(t)
+	// sleep 的参数带上测试进程号，避免匹配到其他进程
+	marker := fmt.Sprintf("31.%d", os.Getpid())
+	source := "import os\nif os.fork() == 0:\n    os.setsid()\n    if os.fork() == 0:\n        os.execvp('sleep', ['sleep', '" + marker + "'])\n    os._exit(0)\nos.wait()\nprint('ok')\n"
+	result, err := Run(context.Background(), Submission{Language: "python", Source: source}, []TestCase{{Output: "ok"}}, Limits{Time: 2 * time.Second}, Options{Isolation: IsolationRequired})
+	if err != nil || result.Verdict != Accepted {
+		t.Fatalf("expected accepted, got %+v (%v)", result, err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		matches, _ := filepath.Glob("/proc/[0-9]*/cmdline")
+		alive := ""
+		for _, path := range matches {
+			if cmdline, err := os.ReadFile(path); err == nil && string(cmdline) == "sleep\x00"+marker+"\x00" {
+				alive = path
+			}
+		}
+		if alive == "" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("process started by the submission is still running after the run: %s", alive)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestRunLimitsProcessesWhenIsolated(t *testing.T) {
+	requireTool(t, "python3")
+	requireSandbox(t)
+	source := "import os, time\nn = 0\ntry:\n    for i in range(1000):\n        if os.fork() == 0:\n            time.sleep(5)\n            os._exit(0)\n        n += 1\nexcept OSError:\n    print('limited', n < 1000)\n"
+	result, err := Run(context.Background(), Submission{Language: "python", Source: source}, []TestCase{{Output: "limited True"}}, Limits{Time: 2 * time.Second}, Options{Isolation: IsolationRequired})
+	if err != nil || result.Verdict != Accepted {
+		t.Fatalf("expected the fork bomb to hit the process limit, got %+v (%v)", result, err)
+	}
+}
+
+func TestRunCompiledLanguages(t *testing.T) {
+	requireTool(t, "gcc")
+	cases := []TestCase{{Input: "4\n", Output: "16\n"}}
+	limits := Limits{Time: time.Second, MemoryMB: 64}
+
+	result, err := Run(context.Background(), Submission{Language: "c", Source: "#include <stdio.h>\nint main(){int n;scanf(\"%d\",&n);printf(\"%d\\n\",n*n);return 0;}\n"}, cases, limits, Options{Isolation: IsolationAuto})
+	if err != nil || result.Verdict != Accepted {
+		t.Fatalf("expected accepted, got %+v (%v)", result, err)
+	}
+
+	result, err = Run(context.Background(), Submission{Language: "c", Source: "int main( { return 0; }"}, cases, limits, Options{Isolation: IsolationAuto})
+	if err != nil || result.Verdict != CompileError || result.CompileOutput == "" || result.Cases[0].Verdict != CompileError {
+		t.Fatalf("expected compile error, got %+v (%v)", result, err)
+	}
+
+	// 超过地址空间限制的分配失败，程序以非零状态退出
+	hog := "#include <stdlib.h>\n#include <string.h>\nint main(){char*p=malloc(256<<20);if(!p)return 1;memset(p,1,256<<20);return p[100];}\n"
+	result, err = Run(context.Background(), Submission{Language: "c", Source: hog}, cases, limits, Options{Isolation: IsolationAuto})
+	if err != nil || (result.Verdict != RuntimeError && result.Verdict != MemoryLimitExceeded) {
+		t.Fatalf("expected the allocation to be refused, got %+v (%v)", result, err)
+	}
+
+	if _, err := exec.LookPath("go"); err == nil {
+		source := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tvar n int\n\tfmt.Scan(&n)\n\tfmt.Println(n * n)\n}\n"
+		result, err = Run(context.Background(), Submission{Language: "go", Source: source}, cases, Limits{Time: time.Second, MemoryMB: 64}, Options{Isolation: IsolationAuto})
+		if err != nil || result.Verdict != Accepted {
+			t.Fatalf("expected go submission to be accepted, got %+v (%v)", result, err)
+		}
+
+		// GOMEMLIMIT 只是回收目标，持续占用超过上限的程序必须被结束
+		hog := "package main\n\nimport (\n\t\"fmt\"\n\t\"time\"\n)\n\nfunc main() {\n\tvar keep [][]byte\n\tfor i := 0; i < 64; i++ {\n\t\tchunk := make([]byte, 8<<20)\n\t\tfor j := range chunk {\n\t\t\tchunk[j] = 1\n\t\t}\n\t\tkeep = append(keep, chunk)\n\t}\n\ttime.Sleep(time.Second)\n\tfmt.Println(len(keep))\n}\n"
+		result, err = Run(context.Background(), Submission{Language: "go", Source: hog}, cases, Limits{Time: 2 * time.Second, MemoryMB: 64}, Options{Isolation: IsolationAuto})
+		if err != nil || result.Verdict != MemoryLimitExceeded || result.Cases[0].MemoryKB > 2*64<<10 {
+			t.Fatalf("expected the go program to be stopped at the memory limit, got %+v (%v)", result, err)
+		}
+	}
+
+	if _, err := Run(context.Background(), Submission{Language: "brainfuck", Source: "+"}, cases, limits, Options{Isolation: IsolationAuto}); err != ErrUnsupportedLanguage {
+		t.Fatalf("expected unsupported language, got %v", err)
+	}
+}
+
+func TestNormalizeOutput(t *testing.T) {
+	if normalizeOutput("1 \r\n2\t\n\n") != normalizeOutput("1\n2") {
+		t.Fatal("trailing whitespace and blank lines must be ignored")
+	}
+	if normalizeOutput("1 2") == normalizeOutput("12") {
+		t.Fatal("inner whitespace must be kept")
+	}
+}
@@ -0,0 +1,500 @@
+//go:build linux
+
+package judge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// nobody 的 uid/gid，服务以 root 运行时评测进程降权到该用户
+	nobodyID             = 65534
+	memorySampleInterval = 5 * time.Millisecond
+	// sandboxInitArg 评测进程先以该 argv[0] 重新执行服务自身（见 init），由它在新的命名空间中
+	// 搭建根文件系统、设置资源限制并降权，最后 exec 目标程序
+	sandboxInitArg = "judge-sandbox-init"
+	// sandboxReportFD 初始化失败时写入原因的管道，成功 exec 后随 close-on-exec 关闭
+	sandboxReportFD  = 3
+	sandboxTmpSizeKB = 16 << 10
+)
+
+// defaultReadOnlyPaths 只读挂载进沙箱的系统目录和文件，不存在的跳过，符号链接（如合并 /usr 后的 /bin）原样重建。
+// 不挂载 /etc、/home、/root、数据目录等，学生程序看不到数据库、上传文件和服务的环境变量
+var defaultReadOnlyPaths = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32",
+	"/etc/alternatives", "/etc/ld.so.cache", "/etc/ld.so.conf", "/etc/ld.so.conf.d",
+	"/etc/ld-musl-*.path", "/etc/java-*",
+}
+
+var sandboxDevices = []string{"null", "zero", "random", "urandom"}
+
+var (
+	sandboxOnce sync.Once
+	sandboxErr  error
+)
+
+// sandboxSpec 传给初始化进程的配置，Root 为空表示不隔离（CODE_JUDGE_ISOLATION=off），只设置资源限制和降权
+type sandboxSpec struct {
+	Args     []string        `json:"args"`
+	Env      []string        `json:"env"`
+	Root     string          `json:"root,omitempty"`
+	Work     string          `json:"work"`
+	ReadOnly []string        `json:"readOnly,omitempty"`
+	GoCache  string          `json:"goCache,omitempty"`
+	UID      int             `json:"uid"`
+	Limits   []sandboxRlimit `json:"limits"`
+}
+
+type sandboxRlimit struct {
+	Resource int    `json:"resource"`
+	Value    uint64 `json:"value"`
+}
+
+func init() {
+	if len(os.Args) == 2 && os.Args[0] == sandboxInitArg {
+		sandboxInit(os.Args[1])
+	}
+}
+
+// command 以初始化进程启动目标程序。隔离时进程处于新的挂载、PID、网络、IPC 和 UTS 命名空间：
+// 只能看到只读的工具链目录和工作目录，看不到宿主进程；新网络命名空间中只有未启用的回环网卡；
+// 初始化进程 exec 后目标程序就是命名空间中的 1 号进程，它退出或被杀时内核结束命名空间中的所有进程
+func (s *sandbox) command(ctx context.Context, args, env []string, lim execLimits) (*sandboxCmd, error) {
+	spec := sandboxSpec{Args: args, Env: env, Work: s.dir, UID: -1, Limits: sandboxRlimits(lim)}
+	if s.isolated {
+		spec.Root = s.root
+		spec.ReadOnly = s.readOnly
+		if lim.compile {
+			spec.GoCache = goCacheDir()
+		}
+	}
+	if s.asNobody {
+		spec.UID = nobodyID
+	}
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	report, reportWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, "/proc/self/exe")
+	cmd.Args = []string{sandboxInitArg, string(raw)}
+	// 初始化进程不继承服务的环境变量（其中有 API Key、JWT 密钥等）
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH")}
+	cmd.Dir = s.dir
+	cmd.ExtraFiles = []*os.File{reportWriter}
+	cmd.SysProcAttr = sysProcAttr(s.isolated)
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	return &sandboxCmd{cmd: cmd, report: report}, nil
+}
+
+func sandboxRlimits(lim execLimits) []sandboxRlimit {
+	fileSizeKB, processes := fileSizeLimitKB, runProcessLimit
+	if lim.compile {
+		fileSizeKB, processes = compileFileSizeKB, compileProcessLimit
+	}
+	limits := []sandboxRlimit{
+		{Resource: unix.RLIMIT_FSIZE, Value: uint64(fileSizeKB) << 10},
+		{Resource: unix.RLIMIT_NPROC, Value: uint64(processes)},
+		{Resource: unix.RLIMIT_CORE, Value: 0},
+	}
+	if lim.cpuSeconds > 0 {
+		limits = append(limits, sandboxRlimit{Resource: unix.RLIMIT_CPU, Value: uint64(lim.cpuSeconds)})
+	}
+	if lim.memoryKB > 0 {
+		limits = append(limits, sandboxRlimit{Resource: unix.RLIMIT_AS, Value: uint64(lim.memoryKB) << 10})
+	}
+	return limits
+}
+
+// sysProcAttr 初始化进程单独成组以便超时后整组结束。非 root 运行时借助用户命名空间创建其他命名空间，
+// 映射为自己的 uid/gid；该身份在 exec 后会丢失能力，用 ambient 能力把 CAP_SYS_ADMIN 留给初始化进程挂载文件系统，
+// 它在 exec 目标程序前清空
+func sysProcAttr(isolated bool) *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGKILL}
+	if !isolated {
+		return attr
+	}
+	attr.Cloneflags = syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+	if os.Geteuid() != 0 {
+		attr.Cloneflags |= syscall.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+		attr.GidMappingsEnableSetgroups = false
+		attr.AmbientCaps = []uintptr{unix.CAP_SYS_ADMIN}
+	}
+	return attr
+}
+
+// sandboxReadOnlyPaths 沙箱中只读可见的路径：系统目录、语言工具链所在目录（如 /root/.pyenv、/opt/go）和额外配置的路径
+func sandboxReadOnlyPaths(lang *language, extra []string) []string {
+	paths := []string{}
+	add := func(path string) {
+		path = filepath.Clean(path)
+		if !filepath.IsAbs(path) || sandboxCovers(paths, path) {
+			return
+		}
+		if _, err := os.Lstat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	for _, pattern := range defaultReadOnlyPaths {
+		matches, _ := filepath.Glob(pattern)
+		for _, path := range matches {
+			add(path)
+		}
+	}
+	if lang != nil {
+		for _, tool := range []string{firstArg(lang.compile), lang.run[0]} {
+			if tool == "" || strings.HasPrefix(tool, "./") {
+				continue
+			}
+			path, err := exec.LookPath(tool)
+			if err != nil {
+				continue
+			}
+			for _, candidate := range []string{path, evalSymlinks(path)} {
+				if candidate != "" && !sandboxCovers(paths, candidate) {
+					// 工具链的可执行文件通常在 <root>/bin 下，挂载整个 <root>
+					add(filepath.Dir(filepath.Dir(candidate)))
+				}
+			}
+		}
+	}
+	for _, path := range extra {
+		add(strings.TrimSpace(path))
+	}
+	return paths
+}
+
+func sandboxCovers(paths []string, path string) bool {
+	for _, mounted := range paths {
+		if path == mounted || strings.HasPrefix(path, mounted+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func firstArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
+
+func evalSymlinks(path string) string {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return ""
+	}
+	return resolved
+}
+
+// sandboxAvailable 试运行一次 true 判断当前环境能否搭建沙箱（容器中没有 CAP_SYS_ADMIN 时通常不行），结果缓存
+func sandboxAvailable(opts Options) error {
+	sandboxOnce.Do(func() {
+		box, err := createSandbox(Options{WorkDir: opts.WorkDir}, nil, true)
+		if err != nil {
+			sandboxErr = err
+			return
+		}
+		defer box.cleanup()
+		out := box.exec(context.Background(), []string{"true"}, nil, "", execLimits{wall: 10 * time.Second})
+		switch {
+		case out.err != nil:
+			sandboxErr = out.err
+		case out.exitCode != 0:
+			sandboxErr = fmt.Errorf("试运行退出码 %d: %s", out.exitCode, strings.TrimSpace(string(out.stderr)))
+		}
+	})
+	return sandboxErr
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// sandboxInit 初始化进程：任何一步失败都把原因写入报告管道并退出，不会在未隔离的情况下运行学生程序
+func sandboxInit(raw string) {
+	// prctl 设置的 no_new_privs 和 ambient 能力是线程级的，exec 必须在同一线程上进行
+	runtime.LockOSThread()
+	syscall.CloseOnExec(sandboxReportFD)
+	report := os.NewFile(sandboxReportFD, "report")
+	fail := func(step string, err error) {
+		fmt.Fprintf(report, "%s: %v", step, err)
+		os.Exit(127)
+	}
+
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(raw), &spec); err != nil || len(spec.Args) == 0 {
+		fail("解析沙箱配置", err)
+	}
+	dir := spec.Work
+	if spec.Root != "" {
+		if err := enterSandboxRoot(&spec); err != nil {
+			fail("搭建沙箱根目录", err)
+		}
+		dir = sandboxWorkDir
+	}
+	if err := os.Chdir(dir); err != nil {
+		fail("进入工作目录", err)
+	}
+	for _, kv := range spec.Env {
+		if value, ok := strings.CutPrefix(kv, "PATH="); ok {
+			os.Setenv("PATH", value)
+		}
+	}
+	path, err := exec.LookPath(spec.Args[0])
+	if err != nil && !errors.Is(err, exec.ErrDot) {
+		fail("查找程序", err)
+	}
+
+	if spec.UID >= 0 {
+		if err := syscall.Setgroups(nil); err != nil {
+			fail("清除附加组", err)
+		}
+		if err := syscall.Setgid(spec.UID); err != nil {
+			fail("切换用户组", err)
+		}
+		if err := syscall.Setuid(spec.UID); err != nil {
+			fail("切换用户", err)
+		}
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		fail("设置 no_new_privs", err)
+	}
+	// 老内核不支持 ambient 能力时返回 EINVAL，此时也不会有需要清除的能力
+	unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0) //nolint:errcheck
+	// 切换用户会清除父进程退出信号，重新设置
+	if err := unix.Prctl(unix.PR_SET_PDEATHSIG, uintptr(syscall.SIGKILL), 0, 0, 0); err != nil {
+		fail("设置父进程退出信号", err)
+	}
+	for _, limit := range spec.Limits {
+		if err := unix.Setrlimit(limit.Resource, &unix.Rlimit{Cur: limit.Value, Max: limit.Value}); err != nil {
+			fail("设置资源限制", err)
+		}
+	}
+	fail("启动程序", syscall.Exec(path, spec.Args, spec.Env))
+}
+
+// enterSandboxRoot 在 Root 上挂载 tmpfs 作为新的根目录，只读绑定工具链、可写绑定工作目录，
+// 挂载新的 /proc 和 /tmp 以及几个必需的设备后 pivot_root 进去并卸载原来的根目录
+func enterSandboxRoot(spec *sandboxSpec) error {
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("mount --make-rprivate /: %w", err)
+	}
+	root := spec.Root
+	if err := unix.Mount("tmpfs", root, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755,size=1m"); err != nil {
+		return fmt.Errorf("mount tmpfs %s: %w", root, err)
+	}
+	for _, path := range spec.ReadOnly {
+		if err := bindMount(path, filepath.Join(root, path), true); err != nil {
+			return err
+		}
+	}
+	if err := bindMount(spec.Work, filepath.Join(root, sandboxWorkDir), false); err != nil {
+		return err
+	}
+	if spec.GoCache != "" {
+		if err := bindMount(spec.GoCache, filepath.Join(root, sandboxGoCacheDir), false); err != nil {
+			return err
+		}
+	}
+
+	dev := filepath.Join(root, "dev")
+	if err := os.MkdirAll(dev, 0o755); err != nil {
+		return err
+	}
+	for _, name := range sandboxDevices {
+		target := filepath.Join(dev, name)
+		if err := touch(target); err != nil {
+			return err
+		}
+		if err := unix.Mount("/dev/"+name, target, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("bind /dev/%s: %w", name, err)
+		}
+	}
+	for name, target := range map[string]string{"fd": "/proc/self/fd", "stdin": "/proc/self/fd/0", "stdout": "/proc/self/fd/1", "stderr": "/proc/self/fd/2"} {
+		if err := os.Symlink(target, filepath.Join(dev, name)); err != nil {
+			return err
+		}
+	}
+
+	// 新的 /proc 属于沙箱的 PID 命名空间，看不到服务进程及其环境变量
+	proc := filepath.Join(root, "proc")
+	if err := os.MkdirAll(proc, 0o755); err != nil {
+		return err
+	}
+	if err := unix.Mount("proc", proc, "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount proc: %w", err)
+	}
+	tmp := filepath.Join(root, "tmp")
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return err
+	}
+	if err := unix.Mount("tmpfs", tmp, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, fmt.Sprintf("mode=1777,size=%dk", sandboxTmpSizeKB)); err != nil {
+		return fmt.Errorf("mount tmpfs /tmp: %w", err)
+	}
+	if err := unix.Mount("", root, "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("remount / read-only: %w", err)
+	}
+
+	if err := os.Chdir(root); err != nil {
+		return err
+	}
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot_root: %w", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("umount old root: %w", err)
+	}
+	return os.Chdir("/")
+}
+
+// bindMount 把宿主路径绑定到沙箱中同样的位置，符号链接原样重建
+func bindMount(source, target string, readOnly bool) error {
+	info, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(source)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		return os.Symlink(link, target)
+	}
+	if info.IsDir() {
+		err = os.MkdirAll(target, 0o755)
+	} else {
+		err = touch(target)
+	}
+	if err != nil {
+		return err
+	}
+	if err := unix.Mount(source, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind %s: %w", source, err)
+	}
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_NOSUID | unix.MS_NODEV)
+	if readOnly {
+		flags |= unix.MS_RDONLY
+	}
+	locked, err := lockedMountFlags(target)
+	if err != nil {
+		return err
+	}
+	if err := unix.Mount("", target, "", flags|locked, ""); err != nil {
+		return fmt.Errorf("remount %s: %w", source, err)
+	}
+	return nil
+}
+
+// lockedMountFlags 重新挂载绑定点时必须保留源挂载点的 ro/noexec/atime 等标志，否则在用户命名空间中会被拒绝
+func lockedMountFlags(path string) (uintptr, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	mapping := []struct{ st, ms int64 }{
+		{unix.ST_RDONLY, unix.MS_RDONLY},
+		{unix.ST_NOSUID, unix.MS_NOSUID},
+		{unix.ST_NODEV, unix.MS_NODEV},
+		{unix.ST_NOEXEC, unix.MS_NOEXEC},
+		{unix.ST_NOATIME, unix.MS_NOATIME},
+		{unix.ST_NODIRATIME, unix.MS_NODIRATIME},
+		{unix.ST_RELATIME, unix.MS_RELATIME},
+	}
+	var flags uintptr
+	for _, m := range mapping {
+		if st.Flags&m.st != 0 {
+			flags |= uintptr(m.ms)
+		}
+	}
+	return flags, nil
+}
+
+func touch(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// watchMemory 定期读取 /proc/<pid>/status 中的 VmHWM（exec 之后重新计数的内存峰值），返回的函数停止采样并给出峰值 KB。
+// 不用 wait4 返回的 ru_maxrss：子进程由服务进程 fork 而来，exec 时会把服务进程的内存占用计入峰值。
+// 采样有间隔，运行极短的程序可能统计偏低，地址空间仍由 RLIMIT_AS 兜底。
+// limitKB 大于 0 时峰值一旦超过就调用 kill，不等程序自己退出；Go 和 Java 的内存上限靠它强制执行
+func watchMemory(pid int, limitKB int64, kill func()) func() int64 {
+	path := fmt.Sprintf("/proc/%d/status", pid)
+	var peak atomic.Int64
+	killed := false
+	sample := func() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if value, ok := strings.CutPrefix(line, "VmHWM:"); ok {
+				kb, _ := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+				if kb > peak.Load() {
+					peak.Store(kb)
+				}
+				if limitKB > 0 && kb > limitKB && !killed {
+					killed = true
+					kill()
+				}
+				return
+			}
+		}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(memorySampleInterval)
+		defer ticker.Stop()
+		for {
+			sample()
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() int64 {
+		close(done)
+		<-stopped
+		return peak.Load()
+	}
+}
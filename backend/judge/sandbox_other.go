@@ -0,0 +1,54 @@
+//go:build !linux
+
+package judge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+// 非 Linux 平台没有命名空间隔离，也不降权，只依靠 ulimit 和超时限制资源
+func (s *sandbox) command(ctx context.Context, args, env []string, lim execLimits) (*sandboxCmd, error) {
+	fileSizeKB, processes := fileSizeLimitKB, runProcessLimit
+	if lim.compile {
+		fileSizeKB, processes = compileFileSizeKB, compileProcessLimit
+	}
+	// POSIX 规定 ulimit -f 以 512 字节为单位；ulimit -u 限制的是该用户的进程总数
+	script := fmt.Sprintf("ulimit -c 0; ulimit -f %d; ulimit -u %d", fileSizeKB*2, processes)
+	if lim.cpuSeconds > 0 {
+		script += fmt.Sprintf("; ulimit -t %d", lim.cpuSeconds)
+	}
+	if lim.memoryKB > 0 {
+		script += fmt.Sprintf("; ulimit -v %d", lim.memoryKB)
+	}
+	script += `; exec "$@"`
+	cmd := exec.CommandContext(ctx, "/bin/sh", append([]string{"-c", script, "judge"}, args...)...)
+	cmd.Env = env
+	cmd.Dir = s.dir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return killProcessGroup(cmd) }
+	return &sandboxCmd{cmd: cmd}, nil
+}
+
+func sandboxAvailable(opts Options) error {
+	return errors.New("当前平台不支持评测沙箱")
+}
+
+func sandboxReadOnlyPaths(lang *language, extra []string) []string {
+	return nil
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// watchMemory 非 Linux 平台不统计内存，内存超限只靠 ulimit -v，Go 和 Java 不受限制
+func watchMemory(pid int, limitKB int64, kill func()) func() int64 {
+	return func() int64 { return 0 }
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log"
+	"path/filepath"
 
 	"github.com/gin-gonic/gin"
 	"github.com/online-education-platform/backend/config"
@@ -78,6 +79,15 @@ func main() {
 	// 初始化文件存储后端（PLAN-04）
 	utils.InitStorage()
 
+	// 初始化 RAG 课程向量索引（与数据库文件同目录持久化）
+	handlers.InitRAGIndex(filepath.Join(filepath.Dir(cfg.DBPath), "rag_index"))
+	handlers.RecoverRAGJobs()
+	handlers.StartRAGIngestWorker()
+	handlers.StartDiscussionAIWorker()
+	handlers.StartExamCoachingWorker()
+	handlers.StartExamGradingWorker()
+	handlers.StartCodeJudgeWorker()
+
 	// 设置Gin模式
 	gin.SetMode(gin.ReleaseMode)
 
@@ -164,12 +174,29 @@ func main() {
 				authenticated.POST("/:id/chapters/:cid/sections", handlers.CreateSection)
 				authenticated.PUT("/:id/chapters/:cid/sections/:sid", handlers.UpdateSection)
 				authenticated.DELETE("/:id/chapters/:cid/sections/:sid", handlers.DeleteSection)
+				// 课程题库路由
+				authenticated.GET("/:id/question-bank", handlers.ListQuestionBank)
+				authenticated.POST("/:id/question-bank", handlers.CreateBankQuestion)
+				authenticated.PUT("/:id/question-bank/:qid", handlers.UpdateBankQuestion)
+				authenticated.DELETE("/:id/question-bank/:qid", handlers.DeleteBankQuestion)
+				authenticated.GET("/:id/question-bank/:qid/usage", handlers.GetBankQuestionUsage)
 				// RAG 知识库路由
 				authenticated.POST("/:id/rag/documents", handlers.UploadRAGDocument)
 				authenticated.GET("/:id/rag/documents", handlers.ListRAGDocuments)
 				authenticated.DELETE("/:id/rag/documents/:docId", handlers.DeleteRAGDocument)
 				authenticated.POST("/:id/rag/query", handlers.QueryRAGExtended) // 切换到增强版 RAG
+				authenticated.POST("/:id/rag/query/stream", handlers.QueryRAGStream)
 				authenticated.GET("/:id/rag/queries", handlers.GetRAGQueryHistory)
+				authenticated.POST("/:id/rag/queries/:queryId/feedback", handlers.SubmitRAGFeedback)
+				authenticated.GET("/:id/rag/review", handlers.ListRAGReviewQueue)
+				authenticated.POST("/:id/rag/review/:queryId/canonical", handlers.SaveRAGCanonicalAnswer)
+				authenticated.POST("/:id/rag/review/:queryId/dismiss", handlers.DismissRAGReview)
+				authenticated.GET("/:id/rag/eval/cases", handlers.ListRAGEvalCases)
+				authenticated.POST("/:id/rag/eval/cases", handlers.CreateRAGEvalCase)
+				authenticated.DELETE("/:id/rag/eval/cases/:caseId", handlers.DeleteRAGEvalCase)
+				authenticated.POST("/:id/rag/eval/runs", handlers.StartRAGEvalRun)
+				authenticated.GET("/:id/rag/eval/runs", handlers.ListRAGEvalRuns)
+				authenticated.GET("/:id/rag/eval/runs/:runId", handlers.GetRAGEvalRun)
 			}
 		}
 
@@ -192,6 +219,7 @@ func main() {
 			assignments.PUT("/:id", handlers.UpdateAssignment)
 			assignments.DELETE("/:id", handlers.DeleteAssignment)
 			assignments.POST("/:id/submit", handlers.SubmitAssignment)
+			assignments.POST("/:id/judge/requeue", handlers.RequeueAssignmentJudging)
 			assignments.GET("/submissions", handlers.GetSubmissions)
 			assignments.GET("/submissions/:id", handlers.GetSubmissionDetail)
 			assignments.PUT("/submissions/:id/grade", handlers.GradeSubmission)
@@ -212,6 +240,10 @@ func main() {
 			exams.POST("/:id/questions", handlers.AddQuestion)
 			exams.PUT("/:id/questions/:qid", handlers.UpdateQuestion)
 			exams.DELETE("/:id/questions/:qid", handlers.DeleteQuestion)
+			exams.POST("/:id/questions/from-bank", handlers.AddBankQuestionsToExam)
+			exams.GET("/:id/rules", handlers.ListExamQuestionRules)
+			exams.POST("/:id/rules", handlers.CreateExamQuestionRule)
+			exams.DELETE("/:id/rules/:rid", handlers.DeleteExamQuestionRule)
 			exams.POST("/:id/submit", handlers.SubmitExam)
 			exams.POST("/:id/draft", handlers.SaveDraft)    // 新增：保存草稿
 			exams.GET("/:id/draft", handlers.GetDraft)      // 新增：获取草稿
@@ -224,6 +256,11 @@ func main() {
 			exams.POST("/:id/questions/confirm", handlers.ConfirmParsedQuestions)
 			// PLAN-03: 题目分析
 			exams.GET("/:id/question-analytics", handlers.GetExamQuestionAnalytics)
+			exams.GET("/:id/grading", handlers.ListExamGrading)
+			exams.POST("/:id/grading/review", handlers.ReviewExamGrading)
+			exams.POST("/:id/grading/requeue", handlers.RequeueExamGrading)
+			exams.POST("/:id/judge/requeue", handlers.RequeueExamJudging)
+			exams.GET("/:id/grading/audit", handlers.ListExamGradingAudit)
 		}
 
 		// 消息路由
@@ -264,7 +301,6 @@ func main() {
 		// 讨论路由
 		discussions := v1.Group("/discussions")
 		discussions.Use(middleware.AuthMiddleware())
-		discussions.Use(middleware.AIInterceptor())
 		{
 			discussions.POST("", socialRateLimiter, handlers.CreateDiscussion)            // 创建讨论
 			discussions.GET("", handlers.GetDiscussions)                              // 获取讨论列表
@@ -292,11 +328,25 @@ func main() {
 		// PLAN-03: 课程学习热力图
 		v1.GET("/courses/:id/learning-heatmap", middleware.AuthMiddleware(), handlers.GetCourseLearningHeatmap)
 
+		// RAG 知识库运维路由（管理员）
+		ragAdmin := v1.Group("/admin/rag")
+		ragAdmin.Use(middleware.AuthMiddleware())
+		{
+			ragAdmin.POST("/reembed", handlers.StartRAGReembedJob)
+			ragAdmin.GET("/reembed", handlers.ListRAGReembedJobs)
+			ragAdmin.GET("/reembed/:jobId", handlers.GetRAGReembedJob)
+		}
+
 		// PLAN-05: AI 修改记录
 		ai := v1.Group("/ai")
 		ai.Use(middleware.AuthMiddleware())
 		{
 			ai.GET("/corrections", handlers.GetAICorrections)
+			// AI 用量报表与每日配额（仅管理员）
+			ai.GET("/usage", handlers.GetAIUsageReport)
+			ai.GET("/quotas", handlers.ListAIQuotas)
+			ai.PUT("/quotas", handlers.SaveAIQuota)
+			ai.DELETE("/quotas/:quotaId", handlers.DeleteAIQuota)
 		}
 	}
 
@@ -83,6 +83,9 @@ type Assignment struct {
 	Attachments *string    `json:"attachments,omitempty"`
 	Deadline    *time.Time `json:"deadline,omitempty"`
 	CreatedAt   time.Time  `json:"createdAt"`
+	// JudgeConfig 自动评测配置（JSON，含隐藏测试用例），只返回给教师；Code 为对学生公开的部分
+	JudgeConfig *string           `json:"judgeConfig,omitempty"`
+	Code        *CodeQuestionInfo `json:"code,omitempty"`
 }
 
 type Submission struct {
@@ -115,6 +118,33 @@ type Question struct {
 	Answer     string  `json:"answer,omitempty"`
 	Score      float64 `json:"score"`
 	OrderIndex int     `json:"orderIndex"`
+	// Rubric 主观题评分细则（JSON 数组），ReferenceAnswer 主观题参考答案，均不对学生返回
+	Rubric          *string `json:"rubric,omitempty"`
+	ReferenceAnswer *string `json:"referenceAnswer,omitempty"`
+	// ScoringPolicy 客观题评分规则，WrongPenalty 答错倒扣的分数，对学生公开
+	ScoringPolicy string  `json:"scoringPolicy,omitempty"`
+	WrongPenalty  float64 `json:"wrongPenalty,omitempty"`
+	// BlankCount 填空题的空数，Unit 数值题的标准单位，由答案推出，学生作答时需要
+	BlankCount int    `json:"blankCount,omitempty"`
+	Unit       string `json:"unit,omitempty"`
+	// Code 编程题的语言、资源限制和样例，不含隐藏测试用例
+	Code *CodeQuestionInfo `json:"code,omitempty"`
+}
+
+// CodeQuestionInfo 编程题（或自动评测的作业）对学生公开的信息
+type CodeQuestionInfo struct {
+	Languages     []string     `json:"languages"`
+	TimeLimitMs   int          `json:"timeLimitMs"`
+	MemoryLimitMB int          `json:"memoryLimitMb"`
+	Samples       []CodeSample `json:"samples"`
+	// TestCount 测试用例总数，包括样例
+	TestCount int `json:"testCount"`
+}
+
+// CodeSample 样例输入输出
+type CodeSample struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
 }
 
 type ExamSubmission struct {
@@ -0,0 +1,261 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAnthropicBaseURL = "https://api.anthropic.com/v1"
+	defaultAnthropicModel   = "claude-sonnet-4-5"
+	anthropicAPIVersion     = "2023-06-01"
+)
+
+// AnthropicProvider 通过 Anthropic Messages API 对话。Anthropic 没有向量接口，
+// 向量化交给 Embedder（通常是 OpenAI 兼容的 EmbedClient），未配置时返回 ErrEmbeddingUnsupported
+type AnthropicProvider struct {
+	APIKey     string
+	BaseURL    string
+	Model      string
+	HTTPClient *http.Client
+	Embedder   Embedder
+	// OnUsage 每次对话结束后回报用量，可为空；向量化用量由 Embedder 自行回报
+	OnUsage UsageFunc
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	System    string             `json:"system,omitempty"`
+	Messages  []anthropicMessage `json:"messages"`
+	MaxTokens int                `json:"max_tokens"`
+	Stream    bool               `json:"stream,omitempty"`
+}
+
+type anthropicError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Usage anthropicUsage  `json:"usage"`
+	Error *anthropicError `json:"error,omitempty"`
+}
+
+type anthropicStreamEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	// Message 仅出现在 message_start 中，携带输入 token 数
+	Message struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	// Usage 仅出现在 message_delta 中，携带累计输出 token 数
+	Usage anthropicUsage  `json:"usage"`
+	Error *anthropicError `json:"error,omitempty"`
+}
+
+func (p *AnthropicProvider) Name() string { return ProviderAnthropic }
+
+func (p *AnthropicProvider) Chat(ctx context.Context, messages []ChatMessage) (string, error) {
+	start := time.Now()
+	var counts tokenCounts
+	answer, err := p.chat(ctx, messages, &counts)
+	p.OnUsage.reportChat(ProviderAnthropic, p.modelName(), start, messages, answer, counts, err)
+	return answer, err
+}
+
+func (p *AnthropicProvider) ChatStream(ctx context.Context, messages []ChatMessage, onDelta func(string) error) (string, error) {
+	start := time.Now()
+	var counts tokenCounts
+	answer, err := p.chatStream(ctx, messages, onDelta, &counts)
+	p.OnUsage.reportChat(ProviderAnthropic, p.modelName(), start, messages, answer, counts, err)
+	return answer, err
+}
+
+func (p *AnthropicProvider) chat(ctx context.Context, messages []ChatMessage, counts *tokenCounts) (string, error) {
+	req, err := p.newRequest(ctx, messages, false)
+	if err != nil {
+		return "", err
+	}
+	resp, err := callUpstream(generationHTTPClient(p.HTTPClient), req, ProviderAnthropic)
+	if err != nil {
+		return "", wrapGenerationRequestError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	raw, _ := io.ReadAll(resp.Body)
+	var res anthropicResponse
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return "", fmt.Errorf("generation API response parse failed: %w", err)
+	}
+	if res.Error != nil {
+		return "", fmt.Errorf("generation API error: %s", res.Error.Message)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("generation API returned status %d", resp.StatusCode)
+	}
+	counts.prompt, counts.completion = res.Usage.InputTokens, res.Usage.OutputTokens
+
+	var text strings.Builder
+	for _, block := range res.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if strings.TrimSpace(text.String()) == "" {
+		return "", fmt.Errorf("generation API returned empty response")
+	}
+	return strings.TrimSpace(text.String()), nil
+}
+
+func (p *AnthropicProvider) chatStream(ctx context.Context, messages []ChatMessage, onDelta func(string) error, counts *tokenCounts) (string, error) {
+	req, err := p.newRequest(ctx, messages, true)
+	if err != nil {
+		return "", err
+	}
+	resp, err := callUpstream(streamingHTTPClient(p.HTTPClient), req, ProviderAnthropic)
+	if err != nil {
+		return "", wrapGenerationRequestError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var res anthropicResponse
+		if json.Unmarshal(raw, &res) == nil && res.Error != nil {
+			return "", fmt.Errorf("generation API error: %s", res.Error.Message)
+		}
+		return "", fmt.Errorf("generation API returned status %d", resp.StatusCode)
+	}
+
+	var answer strings.Builder
+	err = scanSSE(ctx, resp.Body, func(payload string) (bool, error) {
+		var event anthropicStreamEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			return false, fmt.Errorf("generation API stream parse failed: %w", err)
+		}
+		switch event.Type {
+		case "error":
+			message := "unknown error"
+			if event.Error != nil {
+				message = event.Error.Message
+			}
+			return false, fmt.Errorf("generation API error: %s", message)
+		case "message_start":
+			counts.prompt = event.Message.Usage.InputTokens
+		case "message_delta":
+			counts.completion = event.Usage.OutputTokens
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" {
+				return false, emitDelta(&answer, event.Delta.Text, onDelta)
+			}
+		case "message_stop":
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return streamedText(&answer)
+}
+
+func (p *AnthropicProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if p.Embedder == nil {
+		return nil, ErrEmbeddingUnsupported
+	}
+	return p.Embedder.Embed(ctx, texts)
+}
+
+func (p *AnthropicProvider) ModelName() string {
+	if p.Embedder == nil {
+		return ""
+	}
+	return p.Embedder.ModelName()
+}
+
+func (p *AnthropicProvider) modelName() string {
+	if model := strings.TrimSpace(p.Model); model != "" {
+		return model
+	}
+	return defaultAnthropicModel
+}
+
+func (p *AnthropicProvider) newRequest(ctx context.Context, messages []ChatMessage, stream bool) (*http.Request, error) {
+	if strings.TrimSpace(p.APIKey) == "" {
+		return nil, fmt.Errorf("%w: ANTHROPIC_API_KEY", ErrMissingAPIKey)
+	}
+
+	base := strings.TrimRight(strings.TrimSpace(p.BaseURL), "/")
+	if base == "" {
+		base = defaultAnthropicBaseURL
+	}
+	system, converted := toAnthropicMessages(messages)
+	body, err := json.Marshal(anthropicRequest{
+		Model:     p.modelName(),
+		System:    system,
+		Messages:  converted,
+		MaxTokens: defaultGenMaxTokens,
+		Stream:    stream,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/messages", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", p.APIKey)
+	req.Header.Set("anthropic-version", anthropicAPIVersion)
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	return req, nil
+}
+
+// toAnthropicMessages 把 system 消息提取为顶层 system 字段，并合并相邻的同角色消息，
+// 满足 Messages API 要求 user / assistant 交替出现的约束
+func toAnthropicMessages(messages []ChatMessage) (string, []anthropicMessage) {
+	var system []string
+	converted := make([]anthropicMessage, 0, len(messages))
+	for _, message := range messages {
+		if message.Role == "system" {
+			system = append(system, message.Content)
+			continue
+		}
+		role := "user"
+		if message.Role == "assistant" {
+			role = "assistant"
+		}
+		if n := len(converted); n > 0 && converted[n-1].Role == role {
+			converted[n-1].Content += "\n\n" + message.Content
+			continue
+		}
+		converted = append(converted, anthropicMessage{Role: role, Content: message.Content})
+	}
+	return strings.Join(system, "\n\n"), converted
+}
@@ -0,0 +1,181 @@
+package rag
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultBM25K1 = 1.2
+	defaultBM25B  = 0.75
+)
+
+// BM25Index 是内存中的关键词倒排统计，配合 Tokenize 对中英文混排文本打分
+type BM25Index struct {
+	K1 float64
+	B  float64
+
+	Terms    map[int64]map[string]int
+	Lengths  map[int64]int
+	DocFreq  map[string]int
+	TotalLen int
+}
+
+func NewBM25Index() *BM25Index {
+	return &BM25Index{
+		K1:      defaultBM25K1,
+		B:       defaultBM25B,
+		Terms:   make(map[int64]map[string]int),
+		Lengths: make(map[int64]int),
+		DocFreq: make(map[string]int),
+	}
+}
+
+func (b *BM25Index) Len() int {
+	return len(b.Terms)
+}
+
+func (b *BM25Index) Add(id int64, text string) {
+	if _, ok := b.Terms[id]; ok {
+		b.Remove(id)
+	}
+	tokens := Tokenize(text)
+	tf := make(map[string]int, len(tokens))
+	for _, token := range tokens {
+		tf[token]++
+	}
+	for term := range tf {
+		b.DocFreq[term]++
+	}
+	b.Terms[id] = tf
+	b.Lengths[id] = len(tokens)
+	b.TotalLen += len(tokens)
+}
+
+func (b *BM25Index) Remove(id int64) {
+	tf, ok := b.Terms[id]
+	if !ok {
+		return
+	}
+	for term := range tf {
+		b.DocFreq[term]--
+		if b.DocFreq[term] <= 0 {
+			delete(b.DocFreq, term)
+		}
+	}
+	b.TotalLen -= b.Lengths[id]
+	delete(b.Terms, id)
+	delete(b.Lengths, id)
+}
+
+// Search 返回 BM25 得分最高的前 k 个文档，得分为 0 的文档不返回
+func (b *BM25Index) Search(query string, k int) []SearchResult {
+	if k <= 0 || len(b.Terms) == 0 {
+		return nil
+	}
+	queryTerms := make(map[string]struct{})
+	for _, token := range Tokenize(query) {
+		queryTerms[token] = struct{}{}
+	}
+	if len(queryTerms) == 0 {
+		return nil
+	}
+
+	n := float64(len(b.Terms))
+	avgLen := float64(b.TotalLen) / n
+	if avgLen == 0 {
+		avgLen = 1
+	}
+
+	results := make([]SearchResult, 0)
+	for id, tf := range b.Terms {
+		docLen := float64(b.Lengths[id])
+		var score float64
+		for term := range queryTerms {
+			freq := float64(tf[term])
+			if freq == 0 {
+				continue
+			}
+			df := float64(b.DocFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			score += idf * freq * (b.K1 + 1) / (freq + b.K1*(1-b.B+b.B*docLen/avgLen))
+		}
+		if score > 0 {
+			results = append(results, SearchResult{ID: id, Score: float32(score)})
+		}
+	}
+	sortSearchResults(results)
+	if k < len(results) {
+		results = results[:k]
+	}
+	return results
+}
+
+// Save 以 gob 格式写出关键词索引
+func (b *BM25Index) Save(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(b)
+}
+
+// LoadBM25Index 读取 Save 写出的关键词索引
+func LoadBM25Index(r io.Reader) (*BM25Index, error) {
+	index := NewBM25Index()
+	if err := gob.NewDecoder(r).Decode(index); err != nil {
+		return nil, fmt.Errorf("读取关键词索引失败: %w", err)
+	}
+	if index.Terms == nil {
+		index.Terms = make(map[int64]map[string]int)
+	}
+	if index.Lengths == nil {
+		index.Lengths = make(map[int64]int)
+	}
+	if index.DocFreq == nil {
+		index.DocFreq = make(map[string]int)
+	}
+	return index, nil
+}
+
+// Tokenize 把文本切成检索词：拉丁字母与数字按连续串切分并转小写，
+// 中日韩文字同时输出单字与相邻双字，保证课程代码、公式名和中文专有名词都能精确命中。
+func Tokenize(text string) []string {
+	tokens := make([]string, 0)
+	var word strings.Builder
+	var prevCJK rune
+
+	flushWord := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flushWord()
+			tokens = append(tokens, string(r))
+			if prevCJK != 0 {
+				tokens = append(tokens, string([]rune{prevCJK, r}))
+			}
+			prevCJK = r
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			word.WriteRune(unicode.ToLower(r))
+		default:
+			flushWord()
+		}
+		prevCJK = 0
+	}
+	flushWord()
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
@@ -0,0 +1,53 @@
+package rag
+
+import "testing"
+
+func TestTokenizeMixedChineseAndLatin(t *testing.T) {
+	got := Tokenize("CS101 傅里叶变换")
+	want := []string{"cs101", "傅", "里", "傅里", "叶", "里叶", "变", "叶变", "换", "变换"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestBM25IndexMatchesExactTerms(t *testing.T) {
+	index := NewBM25Index()
+	index.Add(1, "本章介绍拉普拉斯变换的定义与性质")
+	index.Add(2, "傅里叶变换把时域信号映射到频域")
+	index.Add(3, "课程代码 EE2010 的考核方式")
+
+	if results := index.Search("傅里叶", 3); len(results) == 0 || results[0].ID != 2 {
+		t.Fatalf("expected doc 2 first for 傅里叶, got %#v", results)
+	}
+	if results := index.Search("ee2010", 3); len(results) != 1 || results[0].ID != 3 {
+		t.Fatalf("expected only doc 3 for course code, got %#v", results)
+	}
+
+	index.Remove(2)
+	if results := index.Search("傅里叶", 3); len(results) != 0 {
+		t.Fatalf("expected no results after removal, got %#v", results)
+	}
+}
+
+func TestReciprocalRankFusionPrefersItemsRankedByBothLists(t *testing.T) {
+	vector := []SearchResult{{ID: 1}, {ID: 2}, {ID: 3}}
+	keyword := []SearchResult{{ID: 3}, {ID: 4}, {ID: 2}}
+
+	fused := ReciprocalRankFusion([][]SearchResult{vector, keyword}, []float64{1, 1}, 2)
+	if len(fused) != 2 {
+		t.Fatalf("expected 2 fused results, got %d", len(fused))
+	}
+	if fused[0].ID != 3 && fused[0].ID != 2 {
+		t.Fatalf("expected an item present in both lists first, got %#v", fused)
+	}
+
+	keywordOnly := ReciprocalRankFusion([][]SearchResult{vector, keyword}, []float64{0, 1}, 1)
+	if keywordOnly[0].ID != 3 {
+		t.Fatalf("expected keyword-weighted fusion to rank 3 first, got %#v", keywordOnly)
+	}
+}
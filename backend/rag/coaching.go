@@ -0,0 +1,94 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const coachingSystemPrompt = `你是课程助教，负责针对学生答错的客观题进行简短讲解。
+只依据提供的课程资料，说明学生所选答案错在哪里、正确答案为什么正确，关键结论后用 [n] 标注资料编号。
+讲解不超过 200 字，不要编造资料中没有的内容，资料不足以解释时如实说明。
+最后单独一行以“复习：”开头，列出学生最应复习的资料编号，例如：复习：[1][3]`
+
+// coachingReviewPrefix 回答中“建议复习”行的前缀
+const coachingReviewPrefix = "复习"
+
+// CoachingQuestion 学生答错的一道客观题，答案均为可读文本（多选用顿号连接）
+type CoachingQuestion struct {
+	Stem          string
+	Options       []string
+	StudentAnswer string
+	CorrectAnswer string
+}
+
+// Coaching 错题讲解
+type Coaching struct {
+	Explanation string
+	// ReviewCitations 建议复习的资料编号，从 1 开始，对应 contexts 的顺序
+	ReviewCitations []int
+}
+
+// CoachingQuery 返回用于检索课程资料的查询：题干加上学生的错误选项，
+// 这样既能召回题目考查的知识点，也能召回与错误理解相关的内容
+func CoachingQuery(question CoachingQuestion) string {
+	return strings.TrimSpace(question.Stem + "\n" + question.StudentAnswer)
+}
+
+// GenerateCoaching 根据检索到的课程资料生成错题讲解和复习清单。
+// 模型没有给出“复习：”行时，以讲解中引用过的资料作为复习清单。
+func GenerateCoaching(ctx context.Context, model ChatModel, question CoachingQuestion, contexts []string) (Coaching, error) {
+	raw, err := CompletePrompt(ctx, model, coachingSystemPrompt, buildCoachingPrompt(question, contexts))
+	if err != nil {
+		return Coaching{}, err
+	}
+	coaching := parseCoaching(raw, len(contexts))
+	if coaching.Explanation == "" {
+		return Coaching{}, fmt.Errorf("coaching response is empty")
+	}
+	return coaching, nil
+}
+
+func buildCoachingPrompt(question CoachingQuestion, contexts []string) string {
+	var builder strings.Builder
+	builder.WriteString("[课程资料]\n")
+	for i, context := range contexts {
+		builder.WriteString(fmt.Sprintf("[%d] %s\n\n", i+1, context))
+	}
+	builder.WriteString("[题目]\n")
+	builder.WriteString(strings.TrimSpace(question.Stem))
+	builder.WriteString("\n")
+	for i, option := range question.Options {
+		builder.WriteString(fmt.Sprintf("%c. %s\n", 'A'+i, option))
+	}
+	builder.WriteString(fmt.Sprintf("\n[学生答案]\n%s\n\n[正确答案]\n%s", question.StudentAnswer, question.CorrectAnswer))
+	return builder.String()
+}
+
+// parseCoaching 拆分讲解正文与“复习：”行，编号超出 [1, n] 的引用被忽略
+func parseCoaching(raw string, n int) Coaching {
+	var explanation []string
+	var reviewLine string
+	for _, line := range strings.Split(strings.TrimSpace(raw), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, coachingReviewPrefix) && citationPattern.MatchString(trimmed) {
+			reviewLine = trimmed
+			continue
+		}
+		explanation = append(explanation, line)
+	}
+
+	coaching := Coaching{Explanation: strings.TrimSpace(strings.Join(explanation, "\n"))}
+	if reviewLine == "" {
+		reviewLine = coaching.Explanation
+	}
+	seen := map[int]bool{}
+	for _, citation := range parseCitations(reviewLine) {
+		if citation < 1 || citation > n || seen[citation] {
+			continue
+		}
+		seen[citation] = true
+		coaching.ReviewCitations = append(coaching.ReviewCitations, citation)
+	}
+	return coaching
+}
@@ -0,0 +1,43 @@
+package rag
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGenerateCoachingSplitsExplanationAndReviewList(t *testing.T) {
+	var prompt string
+	client := newChatTestServer(t, "你选的“先进先出”是队列的特点[2]，栈是后进先出[1]。\n复习：[1][3][9]", &prompt)
+	question := CoachingQuestion{
+		Stem:          "栈的存取规则是？",
+		Options:       []string{"先进先出", "后进先出"},
+		StudentAnswer: "先进先出",
+		CorrectAnswer: "后进先出",
+	}
+
+	coaching, err := GenerateCoaching(context.Background(), client, question, []string{"栈：后进先出", "队列：先进先出", "顺序栈"})
+	if err != nil {
+		t.Fatalf("GenerateCoaching: %v", err)
+	}
+	if coaching.Explanation != "你选的“先进先出”是队列的特点[2]，栈是后进先出[1]。" {
+		t.Fatalf("unexpected explanation %q", coaching.Explanation)
+	}
+	// 超出资料数量的编号被忽略
+	if !reflect.DeepEqual(coaching.ReviewCitations, []int{1, 3}) {
+		t.Fatalf("unexpected review citations %v", coaching.ReviewCitations)
+	}
+	for _, want := range []string{"栈的存取规则是？", "B. 后进先出", "[学生答案]\n先进先出", "[3] 顺序栈"} {
+		if !strings.Contains(prompt, want) {
+			t.Fatalf("prompt should contain %q, got %q", want, prompt)
+		}
+	}
+}
+
+func TestParseCoachingFallsBackToCitedSources(t *testing.T) {
+	coaching := parseCoaching("栈只允许在栈顶操作[2,1]。", 2)
+	if !reflect.DeepEqual(coaching.ReviewCitations, []int{2, 1}) {
+		t.Fatalf("expected citations from explanation, got %v", coaching.ReviewCitations)
+	}
+}
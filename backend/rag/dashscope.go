@@ -0,0 +1,299 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDashScopeBaseURL    = "https://dashscope.aliyuncs.com/api/v1"
+	defaultDashScopeModel      = "qwen-plus"
+	defaultDashScopeEmbedModel = "text-embedding-v4"
+	// dashScopeEmbedBatchSize 百炼文本向量接口单次最多 10 条
+	dashScopeEmbedBatchSize = 10
+)
+
+// DashScopeProvider 通过阿里云百炼（DashScope）原生接口对话与向量化
+type DashScopeProvider struct {
+	APIKey         string
+	BaseURL        string
+	Model          string
+	EmbeddingModel string
+	BatchSize      int
+	HTTPClient     *http.Client
+	// OnUsage 每次对话或每批向量化结束后回报用量，可为空
+	OnUsage UsageFunc
+}
+
+type dashScopeGenerationRequest struct {
+	Model string `json:"model"`
+	Input struct {
+		Messages []ChatMessage `json:"messages"`
+	} `json:"input"`
+	Parameters struct {
+		ResultFormat      string `json:"result_format"`
+		MaxTokens         int    `json:"max_tokens,omitempty"`
+		IncrementalOutput bool   `json:"incremental_output,omitempty"`
+	} `json:"parameters"`
+}
+
+type dashScopeGenerationResponse struct {
+	Output struct {
+		Choices []struct {
+			Message ChatMessage `json:"message"`
+		} `json:"choices"`
+	} `json:"output"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type dashScopeEmbeddingRequest struct {
+	Model string `json:"model"`
+	Input struct {
+		Texts []string `json:"texts"`
+	} `json:"input"`
+}
+
+type dashScopeEmbeddingResponse struct {
+	Output struct {
+		Embeddings []struct {
+			TextIndex int       `json:"text_index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"embeddings"`
+	} `json:"output"`
+	Usage struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (p *DashScopeProvider) Name() string { return ProviderDashScope }
+
+func (p *DashScopeProvider) Chat(ctx context.Context, messages []ChatMessage) (string, error) {
+	start := time.Now()
+	var counts tokenCounts
+	answer, err := p.chat(ctx, messages, &counts)
+	p.OnUsage.reportChat(ProviderDashScope, p.modelName(), start, messages, answer, counts, err)
+	return answer, err
+}
+
+func (p *DashScopeProvider) ChatStream(ctx context.Context, messages []ChatMessage, onDelta func(string) error) (string, error) {
+	start := time.Now()
+	var counts tokenCounts
+	answer, err := p.chatStream(ctx, messages, onDelta, &counts)
+	p.OnUsage.reportChat(ProviderDashScope, p.modelName(), start, messages, answer, counts, err)
+	return answer, err
+}
+
+func (p *DashScopeProvider) chat(ctx context.Context, messages []ChatMessage, counts *tokenCounts) (string, error) {
+	req, err := p.newGenerationRequest(ctx, messages, false)
+	if err != nil {
+		return "", err
+	}
+	resp, err := callUpstream(generationHTTPClient(p.HTTPClient), req, ProviderDashScope)
+	if err != nil {
+		return "", wrapGenerationRequestError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	raw, _ := io.ReadAll(resp.Body)
+	var res dashScopeGenerationResponse
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return "", fmt.Errorf("generation API response parse failed: %w", err)
+	}
+	if res.Code != "" {
+		return "", fmt.Errorf("generation API error: %s", res.Message)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return "", fmt.Errorf("generation API returned status %d", resp.StatusCode)
+	}
+	counts.prompt, counts.completion = res.Usage.InputTokens, res.Usage.OutputTokens
+	if len(res.Output.Choices) == 0 {
+		return "", fmt.Errorf("generation API returned empty choices")
+	}
+	return strings.TrimSpace(res.Output.Choices[0].Message.Content), nil
+}
+
+func (p *DashScopeProvider) chatStream(ctx context.Context, messages []ChatMessage, onDelta func(string) error, counts *tokenCounts) (string, error) {
+	req, err := p.newGenerationRequest(ctx, messages, true)
+	if err != nil {
+		return "", err
+	}
+	resp, err := callUpstream(streamingHTTPClient(p.HTTPClient), req, ProviderDashScope)
+	if err != nil {
+		return "", wrapGenerationRequestError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var res dashScopeGenerationResponse
+		if json.Unmarshal(raw, &res) == nil && res.Code != "" {
+			return "", fmt.Errorf("generation API error: %s", res.Message)
+		}
+		return "", fmt.Errorf("generation API returned status %d", resp.StatusCode)
+	}
+
+	// 开启 incremental_output 后每个事件只携带新增内容
+	var answer strings.Builder
+	err = scanSSE(ctx, resp.Body, func(payload string) (bool, error) {
+		var chunk dashScopeGenerationResponse
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			return false, fmt.Errorf("generation API stream parse failed: %w", err)
+		}
+		if chunk.Code != "" {
+			return false, fmt.Errorf("generation API error: %s", chunk.Message)
+		}
+		// 每个事件携带截至当前的累计用量
+		counts.prompt, counts.completion = chunk.Usage.InputTokens, chunk.Usage.OutputTokens
+		for _, choice := range chunk.Output.Choices {
+			if err := emitDelta(&answer, choice.Message.Content, onDelta); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return streamedText(&answer)
+}
+
+func (p *DashScopeProvider) ModelName() string {
+	if model := strings.TrimSpace(p.EmbeddingModel); model != "" {
+		return model
+	}
+	return defaultDashScopeEmbedModel
+}
+
+func (p *DashScopeProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	if strings.TrimSpace(p.APIKey) == "" {
+		return nil, fmt.Errorf("%w: DASHSCOPE_API_KEY", ErrMissingAPIKey)
+	}
+	batchSize := p.BatchSize
+	if batchSize <= 0 || batchSize > dashScopeEmbedBatchSize {
+		batchSize = dashScopeEmbedBatchSize
+	}
+
+	result := make([][]float32, len(texts))
+	for start := 0; start < len(texts); start += batchSize {
+		end := start + batchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		embeddings, err := p.embedBatch(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		copy(result[start:end], embeddings)
+	}
+	return result, nil
+}
+
+func (p *DashScopeProvider) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	start := time.Now()
+	promptTokens := 0
+	vectors, err := p.requestEmbeddings(ctx, texts, &promptTokens)
+	p.OnUsage.reportEmbedding(ProviderDashScope, p.ModelName(), start, texts, promptTokens, err)
+	return vectors, err
+}
+
+func (p *DashScopeProvider) requestEmbeddings(ctx context.Context, texts []string, promptTokens *int) ([][]float32, error) {
+	var payload dashScopeEmbeddingRequest
+	payload.Model = p.ModelName()
+	payload.Input.Texts = texts
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL()+"/services/embeddings/text-embedding/text-embedding", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+
+	resp, err := callUpstream(embeddingHTTPClient(p.HTTPClient), req, ProviderDashScope)
+	if err != nil {
+		return nil, wrapEmbeddingRequestError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	raw, _ := io.ReadAll(resp.Body)
+	var res dashScopeEmbeddingResponse
+	if err := json.Unmarshal(raw, &res); err != nil {
+		return nil, fmt.Errorf("embedding API response parse failed: %w", err)
+	}
+	if res.Code != "" {
+		return nil, fmt.Errorf("embedding API error: %s", res.Message)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("embedding API returned status %d", resp.StatusCode)
+	}
+	*promptTokens = res.Usage.TotalTokens
+
+	result := make([][]float32, len(texts))
+	for _, item := range res.Output.Embeddings {
+		if item.TextIndex >= 0 && item.TextIndex < len(result) {
+			result[item.TextIndex] = item.Embedding
+		}
+	}
+	return result, nil
+}
+
+func (p *DashScopeProvider) newGenerationRequest(ctx context.Context, messages []ChatMessage, stream bool) (*http.Request, error) {
+	if strings.TrimSpace(p.APIKey) == "" {
+		return nil, fmt.Errorf("%w: DASHSCOPE_API_KEY", ErrMissingAPIKey)
+	}
+	var payload dashScopeGenerationRequest
+	payload.Model = p.modelName()
+	payload.Input.Messages = messages
+	payload.Parameters.ResultFormat = "message"
+	payload.Parameters.MaxTokens = defaultGenMaxTokens
+	payload.Parameters.IncrementalOutput = stream
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL()+"/services/aigc/text-generation/generation", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+		req.Header.Set("X-DashScope-SSE", "enable")
+	}
+	return req, nil
+}
+
+func (p *DashScopeProvider) modelName() string {
+	if model := strings.TrimSpace(p.Model); model != "" {
+		return model
+	}
+	return defaultDashScopeModel
+}
+
+func (p *DashScopeProvider) baseURL() string {
+	if base := strings.TrimRight(strings.TrimSpace(p.BaseURL), "/"); base != "" {
+		return base
+	}
+	return defaultDashScopeBaseURL
+}
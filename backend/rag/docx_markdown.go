@@ -0,0 +1,251 @@
+package rag
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var docxHeadingStyleName = regexp.MustCompile(`^(?i)(heading|标题)\s*(\d)$`)
+
+// extractDOCXMarkdown 把 docx 正文渲染为 Markdown：标题样式转为 #，编号段落转为列表项，表格转为管道表
+func extractDOCXMarkdown(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("读取 docx 压缩结构失败: %w", err)
+	}
+
+	var document *zip.File
+	headingLevels := map[string]int{}
+	for _, file := range zr.File {
+		switch file.Name {
+		case "word/document.xml":
+			document = file
+		case "word/styles.xml":
+			if levels, err := readDOCXHeadingStyles(file); err == nil {
+				headingLevels = levels
+			}
+		}
+	}
+	if document == nil {
+		return "", fmt.Errorf("docx 中未找到正文内容")
+	}
+
+	rc, err := document.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	text, err := renderDOCXMarkdown(rc, headingLevels)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(text), nil
+}
+
+// readDOCXHeadingStyles 读取 styles.xml，返回样式 ID 到标题级别的映射。
+// 中文版 Word 的标题样式 ID 常为 "1"、"2"，因此以样式名和大纲级别判断而非样式 ID。
+func readDOCXHeadingStyles(file *zip.File) (map[string]int, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var styles struct {
+		Items []struct {
+			ID   string `xml:"styleId,attr"`
+			Name struct {
+				Val string `xml:"val,attr"`
+			} `xml:"name"`
+			Outline *struct {
+				Val string `xml:"val,attr"`
+			} `xml:"pPr>outlineLvl"`
+		} `xml:"style"`
+	}
+	if err := xml.NewDecoder(rc).Decode(&styles); err != nil {
+		return nil, err
+	}
+
+	levels := make(map[string]int)
+	for _, style := range styles.Items {
+		name := strings.TrimSpace(style.Name.Val)
+		switch {
+		case strings.EqualFold(name, "title"):
+			levels[style.ID] = 1
+		case docxHeadingStyleName.MatchString(name):
+			level, _ := strconv.Atoi(docxHeadingStyleName.FindStringSubmatch(name)[2])
+			levels[style.ID] = level
+		case style.Outline != nil:
+			if level, err := strconv.Atoi(style.Outline.Val); err == nil && level < 9 {
+				levels[style.ID] = level + 1
+			}
+		}
+	}
+	return levels, nil
+}
+
+func renderDOCXMarkdown(r io.Reader, headingLevels map[string]int) (string, error) {
+	decoder := xml.NewDecoder(r)
+	var builder strings.Builder
+	var paragraph strings.Builder
+
+	style := ""
+	outline := -1
+	listLevel := -1
+	tableDepth := 0
+	var rows [][]string
+	var cells []string
+	var cell []string
+
+	writeBlock := func(text string) {
+		if builder.Len() > 0 {
+			builder.WriteString("\n\n")
+		}
+		builder.WriteString(text)
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("解析 docx XML 失败: %w", err)
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			switch elem.Name.Local {
+			case "tbl":
+				tableDepth++
+				if tableDepth == 1 {
+					rows = nil
+				}
+			case "tr":
+				if tableDepth == 1 {
+					cells = nil
+				}
+			case "tc":
+				if tableDepth == 1 {
+					cell = nil
+				}
+			case "p":
+				paragraph.Reset()
+				style, outline, listLevel = "", -1, -1
+			case "pStyle":
+				style = xmlAttr(elem, "val")
+			case "outlineLvl":
+				if level, err := strconv.Atoi(xmlAttr(elem, "val")); err == nil {
+					outline = level
+				}
+			case "numPr":
+				if listLevel < 0 {
+					listLevel = 0
+				}
+			case "ilvl":
+				if level, err := strconv.Atoi(xmlAttr(elem, "val")); err == nil {
+					listLevel = level
+				}
+			case "t":
+				var content string
+				if err := decoder.DecodeElement(&content, &elem); err != nil {
+					return "", err
+				}
+				paragraph.WriteString(content)
+			case "tab":
+				paragraph.WriteString("\t")
+			case "br":
+				paragraph.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch elem.Name.Local {
+			case "p":
+				text := strings.TrimSpace(paragraph.String())
+				if text == "" {
+					continue
+				}
+				if tableDepth > 0 {
+					cell = append(cell, strings.Join(strings.Fields(text), " "))
+					continue
+				}
+				level := headingLevels[style]
+				if level == 0 && outline >= 0 && outline < 9 {
+					level = outline + 1
+				}
+				switch {
+				case level > 0:
+					if level > 6 {
+						level = 6
+					}
+					writeBlock(strings.Repeat("#", level) + " " + strings.ReplaceAll(text, "\n", " "))
+				case listLevel >= 0:
+					item := strings.Repeat("  ", listLevel) + "- " + strings.ReplaceAll(text, "\n", " ")
+					// 连续列表项之间只用单个换行，保持为同一个列表
+					if builder.Len() > 0 && strings.HasPrefix(strings.TrimLeft(lastLine(builder.String()), " "), "- ") {
+						builder.WriteString("\n" + item)
+					} else {
+						writeBlock(item)
+					}
+				default:
+					writeBlock(text)
+				}
+			case "tc":
+				if tableDepth == 1 {
+					cells = append(cells, strings.ReplaceAll(strings.Join(cell, " "), "|", "\\|"))
+				}
+			case "tr":
+				if tableDepth == 1 && len(cells) > 0 {
+					rows = append(rows, cells)
+				}
+			case "tbl":
+				tableDepth--
+				if tableDepth == 0 && len(rows) > 0 {
+					writeBlock(renderMarkdownTable(rows))
+				}
+			}
+		}
+	}
+	return builder.String(), nil
+}
+
+func renderMarkdownTable(rows [][]string) string {
+	lines := make([]string, 0, len(rows)+1)
+	for i, row := range rows {
+		lines = append(lines, "| "+strings.Join(row, " | ")+" |")
+		if i == 0 {
+			sep := make([]string, len(row))
+			for j := range sep {
+				sep[j] = "---"
+			}
+			lines = append(lines, "| "+strings.Join(sep, " | ")+" |")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func xmlAttr(elem xml.StartElement, local string) string {
+	for _, attr := range elem.Attr {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+func lastLine(text string) string {
+	if idx := strings.LastIndexByte(text, '\n'); idx >= 0 {
+		return text[idx+1:]
+	}
+	return text
+}
@@ -0,0 +1,82 @@
+package rag
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// EmbeddingCache 按 (向量模型, 内容哈希) 缓存向量，避免重复内容重复调用向量接口
+type EmbeddingCache interface {
+	// Get 返回已缓存的向量，键为内容哈希；未命中的哈希不出现在结果中
+	Get(model string, hashes []string) (map[string][]float32, error)
+	// Put 写入向量，键为内容哈希
+	Put(model string, vectors map[string][]float32) error
+}
+
+// ContentHash 返回文本内容的 SHA-256 十六进制摘要，作为向量缓存键
+func ContentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// CachedEmbed 先查缓存，仅对未命中的去重文本调用 client.Embed 并写回缓存。
+// 返回与 texts 一一对应的向量以及命中缓存的文本数；cache 为 nil 时直接调用 client.Embed。
+func CachedEmbed(ctx context.Context, client Embedder, cache EmbeddingCache, texts []string) ([][]float32, int, error) {
+	if cache == nil || len(texts) == 0 {
+		vectors, err := client.Embed(ctx, texts)
+		return vectors, 0, err
+	}
+
+	model := client.ModelName()
+	hashes := make([]string, len(texts))
+	for i, text := range texts {
+		hashes[i] = ContentHash(text)
+	}
+
+	cached, err := cache.Get(model, hashes)
+	if err != nil {
+		// 缓存不可用时退化为全部重新计算
+		cached = nil
+	}
+
+	missing := make([]string, 0)
+	missingHashes := make([]string, 0)
+	queued := make(map[string]bool)
+	for i, hash := range hashes {
+		if _, ok := cached[hash]; ok || queued[hash] {
+			continue
+		}
+		queued[hash] = true
+		missing = append(missing, texts[i])
+		missingHashes = append(missingHashes, hash)
+	}
+
+	fresh := make(map[string][]float32, len(missing))
+	if len(missing) > 0 {
+		vectors, err := client.Embed(ctx, missing)
+		if err != nil {
+			return nil, 0, err
+		}
+		for i, vector := range vectors {
+			if len(vector) == 0 {
+				return nil, 0, fmt.Errorf("embedding API returned empty vector for input %d", i)
+			}
+			fresh[missingHashes[i]] = vector
+		}
+		cache.Put(model, fresh) //nolint:errcheck
+	}
+
+	result := make([][]float32, len(texts))
+	hits := 0
+	for i, hash := range hashes {
+		if vector, ok := cached[hash]; ok {
+			result[i] = vector
+			hits++
+			continue
+		}
+		result[i] = fresh[hash]
+	}
+	return result, hits, nil
+}
@@ -0,0 +1,75 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+type mapEmbeddingCache map[string][]float32
+
+func (m mapEmbeddingCache) Get(model string, hashes []string) (map[string][]float32, error) {
+	result := make(map[string][]float32)
+	for _, hash := range hashes {
+		if vector, ok := m[model+"/"+hash]; ok {
+			result[hash] = vector
+		}
+	}
+	return result, nil
+}
+
+func (m mapEmbeddingCache) Put(model string, vectors map[string][]float32) error {
+	for hash, vector := range vectors {
+		m[model+"/"+hash] = vector
+	}
+	return nil
+}
+
+func TestCachedEmbedSkipsDuplicateWork(t *testing.T) {
+	var inputs int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req embedRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		atomic.AddInt32(&inputs, int32(len(req.Input)))
+
+		var res embedResponse
+		for i, text := range req.Input {
+			res.Data = append(res.Data, struct {
+				Embedding []float32 `json:"embedding"`
+				Index     int       `json:"index"`
+			}{Embedding: []float32{float32(len([]rune(text))), 1}, Index: i})
+		}
+		json.NewEncoder(w).Encode(res)
+	}))
+	defer server.Close()
+
+	cache := mapEmbeddingCache{}
+	client := &EmbedClient{APIKey: "test-key", BaseURL: server.URL, Model: "model-a"}
+
+	vectors, hits, err := CachedEmbed(context.Background(), client, cache, []string{"栈", "队列", "栈"})
+	if err != nil {
+		t.Fatalf("CachedEmbed: %v", err)
+	}
+	if hits != 0 || inputs != 2 {
+		t.Fatalf("expected 2 embedded inputs and no hits, got inputs=%d hits=%d", inputs, hits)
+	}
+	if vectors[0][0] != 1 || vectors[1][0] != 2 || vectors[2][0] != 1 {
+		t.Fatalf("vectors not aligned with inputs: %v", vectors)
+	}
+
+	_, hits, err = CachedEmbed(context.Background(), client, cache, []string{"队列", "二叉树"})
+	if err != nil {
+		t.Fatalf("CachedEmbed: %v", err)
+	}
+	if hits != 1 || inputs != 3 {
+		t.Fatalf("expected 1 cache hit and 1 new input, got inputs=%d hits=%d", inputs, hits)
+	}
+
+	client.Model = "model-b"
+	if _, hits, _ = CachedEmbed(context.Background(), client, cache, []string{"栈"}); hits != 0 {
+		t.Fatalf("cache must be keyed by model, got %d hits", hits)
+	}
+}
@@ -2,21 +2,28 @@ package rag
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 )
 
 const defaultEmbedBaseURL = "https://openrouter.ai/api/v1"
 const defaultEmbedModel = "openai/text-embedding-3-small"
+const defaultEmbedTimeout = 60 * time.Second
 
 type EmbedClient struct {
 	APIKey    string
 	BaseURL   string
 	Model     string
 	BatchSize int
+	// HTTPClient 为空时使用带 EMBEDDING_TIMEOUT_SECONDS 超时的客户端
+	HTTPClient *http.Client
+	// OnUsage 每批请求结束后回报用量，可为空
+	OnUsage UsageFunc
 }
 
 type embedRequest struct {
@@ -29,27 +36,35 @@ type embedResponse struct {
 		Embedding []float32 `json:"embedding"`
 		Index     int       `json:"index"`
 	} `json:"data"`
+	Usage *struct {
+		PromptTokens int `json:"prompt_tokens"`
+	} `json:"usage,omitempty"`
 	Error *struct {
 		Message string `json:"message"`
 	} `json:"error,omitempty"`
 }
 
-func (c *EmbedClient) Embed(texts []string) ([][]float32, error) {
+// ModelName 返回实际请求使用的向量模型名，未配置时为默认模型
+func (c *EmbedClient) ModelName() string {
+	if model := strings.TrimSpace(c.Model); model != "" {
+		return model
+	}
+	return defaultEmbedModel
+}
+
+func (c *EmbedClient) Embed(ctx context.Context, texts []string) ([][]float32, error) {
 	if len(texts) == 0 {
 		return nil, nil
 	}
 	if strings.TrimSpace(c.APIKey) == "" {
-		return nil, fmt.Errorf("missing OPENAI_API_KEY")
+		return nil, fmt.Errorf("%w: OPENAI_API_KEY", ErrMissingAPIKey)
 	}
 
 	base := strings.TrimRight(strings.TrimSpace(c.BaseURL), "/")
 	if base == "" {
 		base = defaultEmbedBaseURL
 	}
-	model := strings.TrimSpace(c.Model)
-	if model == "" {
-		model = defaultEmbedModel
-	}
+	model := c.ModelName()
 	batchSize := c.BatchSize
 	if batchSize <= 0 || batchSize > len(texts) {
 		batchSize = len(texts)
@@ -61,7 +76,7 @@ func (c *EmbedClient) Embed(texts []string) ([][]float32, error) {
 		if end > len(texts) {
 			end = len(texts)
 		}
-		embeddings, err := c.embedBatch(base, model, texts[start:end])
+		embeddings, err := c.embedBatch(ctx, base, model, texts[start:end])
 		if err != nil {
 			return nil, err
 		}
@@ -70,13 +85,21 @@ func (c *EmbedClient) Embed(texts []string) ([][]float32, error) {
 	return result, nil
 }
 
-func (c *EmbedClient) embedBatch(base, model string, texts []string) ([][]float32, error) {
+func (c *EmbedClient) embedBatch(ctx context.Context, base, model string, texts []string) ([][]float32, error) {
+	start := time.Now()
+	promptTokens := 0
+	vectors, err := c.requestBatch(ctx, base, model, texts, &promptTokens)
+	c.OnUsage.reportEmbedding(ProviderOpenAI, model, start, texts, promptTokens, err)
+	return vectors, err
+}
+
+func (c *EmbedClient) requestBatch(ctx context.Context, base, model string, texts []string, promptTokens *int) ([][]float32, error) {
 	body, err := json.Marshal(embedRequest{Input: texts, Model: model})
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, base+"/embeddings", bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/embeddings", bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
@@ -85,9 +108,9 @@ func (c *EmbedClient) embedBatch(base, model string, texts []string) ([][]float3
 	req.Header.Set("HTTP-Referer", "https://github.com/betasecond/psychic-broccoli")
 	req.Header.Set("X-Title", "CourseArk")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := callUpstream(embeddingHTTPClient(c.HTTPClient), req, ProviderOpenAI)
 	if err != nil {
-		return nil, fmt.Errorf("embedding API request failed: %w", err)
+		return nil, wrapEmbeddingRequestError(ctx, err)
 	}
 	defer resp.Body.Close()
 
@@ -102,6 +125,9 @@ func (c *EmbedClient) embedBatch(base, model string, texts []string) ([][]float3
 	if resp.StatusCode >= http.StatusBadRequest {
 		return nil, fmt.Errorf("embedding API returned status %d", resp.StatusCode)
 	}
+	if res.Usage != nil {
+		*promptTokens = res.Usage.PromptTokens
+	}
 
 	result := make([][]float32, len(texts))
 	for _, item := range res.Data {
@@ -111,3 +137,18 @@ func (c *EmbedClient) embedBatch(base, model string, texts []string) ([][]float3
 	}
 	return result, nil
 }
+
+func embeddingHTTPClient(custom *http.Client) *http.Client {
+	if custom != nil {
+		return custom
+	}
+	return &http.Client{Timeout: timeoutFromEnv(defaultEmbedTimeout, "EMBEDDING_TIMEOUT_SECONDS")}
+}
+
+// wrapEmbeddingRequestError 调用方取消时返回 ctx 的错误，便于上层区分
+func wrapEmbeddingRequestError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("embedding API request failed: %w", err)
+}
@@ -0,0 +1,132 @@
+package rag
+
+import (
+	"math"
+	"sort"
+)
+
+// EvalCaseResult 为单个黄金问题的评测结果
+type EvalCaseResult struct {
+	CaseID          int64   `json:"case_id"`
+	Question        string  `json:"question"`
+	ExpectedDocIDs  []int64 `json:"expected_doc_ids"`
+	RetrievedDocIDs []int64 `json:"retrieved_doc_ids"`
+	Answer          string  `json:"answer,omitempty"`
+	// Recall 期望文档在前 K 个检索结果中出现的比例
+	Recall float64 `json:"recall"`
+	// ReciprocalRank 第一个命中期望文档的排名倒数，未命中为 0
+	ReciprocalRank float64 `json:"reciprocal_rank"`
+	// Faithfulness 回答中有资料依据的句子占比
+	Faithfulness       float64 `json:"faithfulness"`
+	RetrievalLatencyMs int64   `json:"retrieval_latency_ms"`
+	TotalLatencyMs     int64   `json:"total_latency_ms"`
+	Error              string  `json:"error,omitempty"`
+}
+
+// EvalReport 汇总一次评测，出错的问题不计入各项均值
+type EvalReport struct {
+	K              int              `json:"k"`
+	Cases          int              `json:"cases"`
+	Failed         int              `json:"failed"`
+	RecallAtK      float64          `json:"recall_at_k"`
+	MRR            float64          `json:"mrr"`
+	Faithfulness   float64          `json:"faithfulness"`
+	AvgLatencyMs   float64          `json:"avg_latency_ms"`
+	P95LatencyMs   int64            `json:"p95_latency_ms"`
+	AvgRetrievalMs float64          `json:"avg_retrieval_ms"`
+	EmbeddingModel string           `json:"embedding_model,omitempty"`
+	LLMModel       string           `json:"llm_model,omitempty"`
+	Results        []EvalCaseResult `json:"results"`
+}
+
+// RecallAtK 计算期望文档在前 k 个检索结果（按文档去重）中出现的比例
+func RecallAtK(retrieved, expected []int64, k int) float64 {
+	if len(expected) == 0 {
+		return 0
+	}
+	top := DedupeIDs(retrieved)
+	if k > 0 && len(top) > k {
+		top = top[:k]
+	}
+	found := make(map[int64]bool, len(top))
+	for _, id := range top {
+		found[id] = true
+	}
+	hits := 0
+	for _, id := range DedupeIDs(expected) {
+		if found[id] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(DedupeIDs(expected)))
+}
+
+// ReciprocalRank 返回第一个期望文档在去重后检索结果中排名的倒数
+func ReciprocalRank(retrieved, expected []int64) float64 {
+	want := make(map[int64]bool, len(expected))
+	for _, id := range expected {
+		want[id] = true
+	}
+	for i, id := range DedupeIDs(retrieved) {
+		if want[id] {
+			return 1 / float64(i+1)
+		}
+	}
+	return 0
+}
+
+// Faithfulness 根据逐句归属计算有依据句子的占比；没有句子时返回 0
+func Faithfulness(attribution Attribution) float64 {
+	if len(attribution.Sentences) == 0 {
+		return 0
+	}
+	supported := len(attribution.Sentences) - attribution.UnsupportedCount
+	return float64(supported) / float64(len(attribution.Sentences))
+}
+
+// DedupeIDs 保持首次出现顺序去重
+func DedupeIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	result := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// SummarizeEval 汇总各问题结果生成评测报告
+func SummarizeEval(results []EvalCaseResult, k int) EvalReport {
+	report := EvalReport{K: k, Cases: len(results), Results: results}
+	latencies := make([]int64, 0, len(results))
+	var recall, rr, faithfulness, total, retrieval float64
+	for _, result := range results {
+		if result.Error != "" {
+			report.Failed++
+			continue
+		}
+		recall += result.Recall
+		rr += result.ReciprocalRank
+		faithfulness += result.Faithfulness
+		total += float64(result.TotalLatencyMs)
+		retrieval += float64(result.RetrievalLatencyMs)
+		latencies = append(latencies, result.TotalLatencyMs)
+	}
+
+	n := float64(len(latencies))
+	if n == 0 {
+		return report
+	}
+	report.RecallAtK = recall / n
+	report.MRR = rr / n
+	report.Faithfulness = faithfulness / n
+	report.AvgLatencyMs = total / n
+	report.AvgRetrievalMs = retrieval / n
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	index := int(math.Ceil(0.95*n)) - 1
+	report.P95LatencyMs = latencies[index]
+	return report
+}
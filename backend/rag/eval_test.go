@@ -0,0 +1,50 @@
+package rag
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRetrievalMetrics(t *testing.T) {
+	retrieved := []int64{3, 3, 1, 2}
+	if got := RecallAtK(retrieved, []int64{1, 2}, 2); got != 0.5 {
+		t.Fatalf("RecallAtK@2 = %v, want 0.5", got)
+	}
+	if got := RecallAtK(retrieved, []int64{1, 2}, 3); got != 1 {
+		t.Fatalf("RecallAtK@3 = %v, want 1", got)
+	}
+	if got := ReciprocalRank(retrieved, []int64{1}); got != 0.5 {
+		t.Fatalf("ReciprocalRank = %v, want 0.5", got)
+	}
+	if got := ReciprocalRank(retrieved, []int64{9}); got != 0 {
+		t.Fatalf("ReciprocalRank without hit = %v, want 0", got)
+	}
+}
+
+func TestFaithfulness(t *testing.T) {
+	attribution := Attribution{Sentences: make([]SentenceAttribution, 4), UnsupportedCount: 1}
+	if got := Faithfulness(attribution); got != 0.75 {
+		t.Fatalf("Faithfulness = %v, want 0.75", got)
+	}
+	if got := Faithfulness(Attribution{}); got != 0 {
+		t.Fatalf("Faithfulness of empty answer = %v, want 0", got)
+	}
+}
+
+func TestSummarizeEvalSkipsFailedCases(t *testing.T) {
+	results := []EvalCaseResult{
+		{Recall: 1, ReciprocalRank: 1, Faithfulness: 1, TotalLatencyMs: 100, RetrievalLatencyMs: 10},
+		{Recall: 0, ReciprocalRank: 0, Faithfulness: 0.5, TotalLatencyMs: 300, RetrievalLatencyMs: 30},
+		{Error: "生成回答失败", TotalLatencyMs: 9000},
+	}
+	report := SummarizeEval(results, 5)
+	if report.Cases != 3 || report.Failed != 1 {
+		t.Fatalf("unexpected counts: %+v", report)
+	}
+	if report.RecallAtK != 0.5 || report.MRR != 0.5 || math.Abs(report.Faithfulness-0.75) > 1e-9 {
+		t.Fatalf("unexpected averages: %+v", report)
+	}
+	if report.AvgLatencyMs != 200 || report.P95LatencyMs != 300 || report.AvgRetrievalMs != 20 {
+		t.Fatalf("unexpected latency: %+v", report)
+	}
+}
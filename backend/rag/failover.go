@@ -0,0 +1,92 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// FailoverProvider 按顺序尝试多个提供方：前一个失败（含重试用尽、熔断打开）时改用下一个。
+// 流式回答已向调用方输出内容后不再切换，避免拼接两个模型的回答；
+// 向量化只在向量模型与首个提供方相同的提供方之间切换，不同模型的向量不能混用
+type FailoverProvider struct {
+	Providers []Provider
+}
+
+func (p *FailoverProvider) Name() string {
+	if len(p.Providers) == 0 {
+		return ""
+	}
+	return p.Providers[0].Name()
+}
+
+func (p *FailoverProvider) Chat(ctx context.Context, messages []ChatMessage) (string, error) {
+	var errs []error
+	for _, provider := range p.Providers {
+		answer, err := provider.Chat(ctx, messages)
+		if err == nil {
+			return answer, nil
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+	}
+	return "", failoverError(errs)
+}
+
+func (p *FailoverProvider) ChatStream(ctx context.Context, messages []ChatMessage, onDelta func(string) error) (string, error) {
+	var errs []error
+	for _, provider := range p.Providers {
+		emitted := false
+		answer, err := provider.ChatStream(ctx, messages, func(delta string) error {
+			emitted = true
+			return onDelta(delta)
+		})
+		if err == nil {
+			return answer, nil
+		}
+		if emitted || ctx.Err() != nil {
+			return "", err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+	}
+	return "", failoverError(errs)
+}
+
+func (p *FailoverProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	model := p.ModelName()
+	var errs []error
+	for _, provider := range p.Providers {
+		if provider.ModelName() != model {
+			continue
+		}
+		vectors, err := provider.Embed(ctx, texts)
+		if err == nil {
+			return vectors, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+	}
+	return nil, failoverError(errs)
+}
+
+func (p *FailoverProvider) ModelName() string {
+	if len(p.Providers) == 0 {
+		return ""
+	}
+	return p.Providers[0].ModelName()
+}
+
+// failoverError 合并各提供方的错误，只有一个时原样返回以保留原有错误信息
+func failoverError(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return errors.New("no provider configured")
+	case 1:
+		return errors.Unwrap(errs[0])
+	}
+	return fmt.Errorf("all providers failed: %w", errors.Join(errs...))
+}
@@ -0,0 +1,110 @@
+package rag
+
+import "strings"
+
+// RetrievalMode 检索模式
+type RetrievalMode string
+
+const (
+	RetrievalVector  RetrievalMode = "vector"
+	RetrievalKeyword RetrievalMode = "keyword"
+	RetrievalHybrid  RetrievalMode = "hybrid"
+)
+
+// defaultRRFK 是倒数排名融合的平滑常数，取自 Cormack 等人的原始论文
+const defaultRRFK = 60
+
+// ParseRetrievalMode 解析请求中的检索模式，未知或为空时使用混合检索
+func ParseRetrievalMode(raw string) (RetrievalMode, bool) {
+	switch RetrievalMode(strings.ToLower(strings.TrimSpace(raw))) {
+	case "", RetrievalHybrid:
+		return RetrievalHybrid, true
+	case RetrievalVector:
+		return RetrievalVector, true
+	case RetrievalKeyword:
+		return RetrievalKeyword, true
+	default:
+		return RetrievalHybrid, false
+	}
+}
+
+// RetrievalQuery 描述一次检索：向量与关键词两路各自召回后按权重做 RRF 融合
+type RetrievalQuery struct {
+	Text          string
+	Vector        []float32
+	Mode          RetrievalMode
+	VectorWeight  float64
+	KeywordWeight float64
+	K             int
+	// Expansions 为多查询扩展得到的其他说法（Text 与 Vector），
+	// 沿用主查询的模式与权重分别检索后与主查询结果一起做 RRF 融合
+	Expansions []RetrievalQuery
+}
+
+// Retrieve 按 q.Mode 在向量索引和关键词索引上检索并融合排序
+func Retrieve(vector VectorIndex, keyword *BM25Index, q RetrievalQuery) []SearchResult {
+	if q.K <= 0 {
+		return nil
+	}
+	depth := q.K * 4
+	if depth < 20 {
+		depth = 20
+	}
+
+	if len(q.Expansions) > 0 {
+		lists := make([][]SearchResult, 0, len(q.Expansions)+1)
+		for _, variant := range append([]RetrievalQuery{q}, q.Expansions...) {
+			single := q
+			single.Text, single.Vector, single.K, single.Expansions = variant.Text, variant.Vector, depth, nil
+			lists = append(lists, Retrieve(vector, keyword, single))
+		}
+		return ReciprocalRankFusion(lists, nil, q.K)
+	}
+
+	switch q.Mode {
+	case RetrievalVector:
+		return vector.Search(q.Vector, q.K)
+	case RetrievalKeyword:
+		return keyword.Search(q.Text, q.K)
+	}
+
+	vectorWeight, keywordWeight := q.VectorWeight, q.KeywordWeight
+	if vectorWeight <= 0 && keywordWeight <= 0 {
+		vectorWeight, keywordWeight = 1, 1
+	}
+	lists := make([][]SearchResult, 0, 2)
+	weights := make([]float64, 0, 2)
+	if vectorWeight > 0 && len(q.Vector) > 0 {
+		lists = append(lists, vector.Search(q.Vector, depth))
+		weights = append(weights, vectorWeight)
+	}
+	if keywordWeight > 0 {
+		lists = append(lists, keyword.Search(q.Text, depth))
+		weights = append(weights, keywordWeight)
+	}
+	return ReciprocalRankFusion(lists, weights, q.K)
+}
+
+// ReciprocalRankFusion 合并多路排序结果：score(d) = Σ w_i / (rrfK + rank_i(d))
+func ReciprocalRankFusion(lists [][]SearchResult, weights []float64, k int) []SearchResult {
+	scores := make(map[int64]float64)
+	for i, list := range lists {
+		weight := 1.0
+		if i < len(weights) {
+			weight = weights[i]
+		}
+		for rank, result := range list {
+			scores[result.ID] += weight / float64(defaultRRFK+rank+1)
+		}
+	}
+
+	fused := make([]SearchResult, 0, len(scores))
+	for id, score := range scores {
+		fused = append(fused, SearchResult{ID: id, Score: float32(score)})
+	}
+	sortSearchResults(fused)
+	if k > 0 && k < len(fused) {
+		fused = fused[:k]
+	}
+	return fused
+}
@@ -1,7 +1,9 @@
 package rag
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -21,10 +23,14 @@ const defaultGenTimeout = 45 * time.Second
 
 var ErrGenerationTimeout = errors.New("generation timeout")
 
+// ErrMissingAPIKey 未配置所选提供方的 API Key
+var ErrMissingAPIKey = errors.New("missing API key")
+
 const systemPrompt = `你是在线教育平台中的课程学习助手。
 请严格只依据提供的课程资料片段回答问题，不要编造资料中没有的信息。
 如果当前资料不足以支持回答，请明确回复：“当前课程资料中未找到足够依据来回答这个问题。”
 回答风格要简洁、清晰，适合教学和复习场景。
+每个依据课程资料的句子都要在句末用资料编号标注来源，例如“栈是后进先出的线性表[1]。”，同时依据多条资料时写作 [1][3]；只能使用上文给出的编号，不要编造。
 不要输出“好的”“根据资料”等寒暄或过程说明，直接给出答案正文。
 当用户要求整理、改写、生成 Markdown、生成大纲或清单时，输出可直接使用的 Markdown 成品：使用清晰标题、列表或表格，不要用代码块包裹，不要只复述原文。`
 
@@ -38,44 +44,90 @@ type GenClient struct {
 	BaseURL    string
 	Model      string
 	HTTPClient *http.Client
+	// OnUsage 每次调用结束后回报用量，可为空
+	OnUsage UsageFunc
 }
 
 type chatRequest struct {
 	Model     string        `json:"model"`
 	Messages  []ChatMessage `json:"messages"`
 	MaxTokens int           `json:"max_tokens,omitempty"`
+	Stream    bool          `json:"stream,omitempty"`
 }
 
 type chatResponse struct {
 	Choices []struct {
 		Message ChatMessage `json:"message"`
 	} `json:"choices"`
+	Usage *openAIUsage `json:"usage,omitempty"`
 	Error *struct {
 		Message string `json:"message"`
 	} `json:"error,omitempty"`
 }
 
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// Chat 以 OpenAI 兼容的 /chat/completions 接口完成一次对话
+func (c *GenClient) Chat(ctx context.Context, messages []ChatMessage) (string, error) {
+	start := time.Now()
+	var counts tokenCounts
+	answer, err := c.generate(ctx, messages, &counts)
+	c.OnUsage.reportChat(ProviderOpenAI, c.modelName(), start, messages, answer, counts, err)
+	return answer, err
+}
+
+// ChatStream 以 stream: true 请求 /chat/completions，收到每段增量时调用 onDelta
+func (c *GenClient) ChatStream(ctx context.Context, messages []ChatMessage, onDelta func(string) error) (string, error) {
+	start := time.Now()
+	answer, err := c.stream(ctx, messages, onDelta)
+	c.OnUsage.reportChat(ProviderOpenAI, c.modelName(), start, messages, answer, tokenCounts{}, err)
+	return answer, err
+}
+
 func (c *GenClient) GenerateWithHistory(question string, contexts []string, history []ChatMessage) (string, error) {
-	messages := []ChatMessage{{Role: "system", Content: systemPrompt}}
-	messages = append(messages, history...)
-	messages = append(messages, ChatMessage{Role: "user", Content: buildUserPrompt(question, contexts)})
-	return c.generate(messages)
+	return GenerateAnswer(context.Background(), c, question, contexts, history)
+}
+
+// GenerateStream 与 GenerateWithHistory 相同，但以 stream: true 请求并在收到每段增量时调用 onDelta。
+// ctx 取消（例如客户端断开）时中止上游请求；onDelta 返回错误时同样中止。返回完整回答。
+func (c *GenClient) GenerateStream(ctx context.Context, question string, contexts []string, history []ChatMessage, onDelta func(string) error) (string, error) {
+	return GenerateAnswerStream(ctx, c, question, contexts, history, onDelta)
 }
 
 func (c *GenClient) Generate(question string, contexts []string) (string, error) {
-	messages := []ChatMessage{
-		{Role: "system", Content: systemPrompt},
-		{Role: "user", Content: buildUserPrompt(question, contexts)},
-	}
-	return c.generate(messages)
+	return GenerateAnswer(context.Background(), c, question, contexts, nil)
 }
 
 func (c *GenClient) Complete(system, user string) (string, error) {
-	messages := []ChatMessage{
+	return CompletePrompt(context.Background(), c, system, user)
+}
+
+// GenerateAnswer 依据课程资料片段与会话历史生成回答
+func GenerateAnswer(ctx context.Context, model ChatModel, question string, contexts []string, history []ChatMessage) (string, error) {
+	return model.Chat(ctx, answerMessages(question, contexts, history))
+}
+
+// GenerateAnswerStream 与 GenerateAnswer 相同，但以流式请求并在收到每段增量时调用 onDelta。
+// ctx 取消（例如客户端断开）时中止上游请求；onDelta 返回错误时同样中止。返回完整回答。
+func GenerateAnswerStream(ctx context.Context, model ChatModel, question string, contexts []string, history []ChatMessage, onDelta func(string) error) (string, error) {
+	return model.ChatStream(ctx, answerMessages(question, contexts, history), onDelta)
+}
+
+// CompletePrompt 以单轮 system + user 消息请求对话模型
+func CompletePrompt(ctx context.Context, model ChatModel, system, user string) (string, error) {
+	return model.Chat(ctx, []ChatMessage{
 		{Role: "system", Content: system},
 		{Role: "user", Content: user},
-	}
-	return c.generate(messages)
+	})
+}
+
+func answerMessages(question string, contexts []string, history []ChatMessage) []ChatMessage {
+	messages := []ChatMessage{{Role: "system", Content: systemPrompt}}
+	messages = append(messages, history...)
+	return append(messages, ChatMessage{Role: "user", Content: buildUserPrompt(question, contexts)})
 }
 
 func buildUserPrompt(question string, contexts []string) string {
@@ -89,44 +141,55 @@ func buildUserPrompt(question string, contexts []string) string {
 	return builder.String()
 }
 
-func (c *GenClient) generate(messages []ChatMessage) (string, error) {
+func (c *GenClient) newChatRequest(ctx context.Context, messages []ChatMessage, stream bool) (*http.Request, error) {
 	if strings.TrimSpace(c.APIKey) == "" {
-		return "", fmt.Errorf("missing OPENAI_API_KEY")
+		return nil, fmt.Errorf("%w: OPENAI_API_KEY", ErrMissingAPIKey)
 	}
 
 	base := strings.TrimRight(strings.TrimSpace(c.BaseURL), "/")
 	if base == "" {
 		base = defaultGenBaseURL
 	}
-	model := strings.TrimSpace(c.Model)
-	if model == "" {
-		model = defaultGenModel
-	}
-
 	body, err := json.Marshal(chatRequest{
-		Model:     model,
+		Model:     c.modelName(),
 		Messages:  messages,
 		MaxTokens: defaultGenMaxTokens,
+		Stream:    stream,
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	req, err := http.NewRequest(http.MethodPost, base+"/chat/completions", bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/chat/completions", bytes.NewReader(body))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.APIKey)
 	req.Header.Set("HTTP-Referer", "https://github.com/betasecond/psychic-broccoli")
 	req.Header.Set("X-Title", "CourseArk")
+	if stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	return req, nil
+}
 
-	resp, err := c.httpClient().Do(req)
+func (c *GenClient) modelName() string {
+	if model := strings.TrimSpace(c.Model); model != "" {
+		return model
+	}
+	return defaultGenModel
+}
+
+func (c *GenClient) generate(ctx context.Context, messages []ChatMessage, counts *tokenCounts) (string, error) {
+	req, err := c.newChatRequest(ctx, messages, false)
 	if err != nil {
-		if isTimeoutError(err) {
-			return "", fmt.Errorf("%w: generation API request failed", ErrGenerationTimeout)
-		}
-		return "", fmt.Errorf("generation API request failed: %w", err)
+		return "", err
+	}
+
+	resp, err := callUpstream(c.httpClient(), req, ProviderOpenAI)
+	if err != nil {
+		return "", wrapGenerationRequestError(ctx, err)
 	}
 	defer resp.Body.Close()
 
@@ -141,6 +204,9 @@ func (c *GenClient) generate(messages []ChatMessage) (string, error) {
 	if resp.StatusCode >= http.StatusBadRequest {
 		return "", fmt.Errorf("generation API returned status %d", resp.StatusCode)
 	}
+	if res.Usage != nil {
+		counts.prompt, counts.completion = res.Usage.PromptTokens, res.Usage.CompletionTokens
+	}
 	if len(res.Choices) == 0 {
 		return "", fmt.Errorf("generation API returned empty choices")
 	}
@@ -148,6 +214,121 @@ func (c *GenClient) generate(messages []ChatMessage) (string, error) {
 	return strings.TrimSpace(res.Choices[0].Message.Content), nil
 }
 
+type chatStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func (c *GenClient) stream(ctx context.Context, messages []ChatMessage, onDelta func(string) error) (string, error) {
+	req, err := c.newChatRequest(ctx, messages, true)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := callUpstream(c.streamHTTPClient(), req, ProviderOpenAI)
+	if err != nil {
+		return "", wrapGenerationRequestError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var res chatResponse
+		if json.Unmarshal(raw, &res) == nil && res.Error != nil {
+			return "", fmt.Errorf("generation API error: %s", res.Error.Message)
+		}
+		return "", fmt.Errorf("generation API returned status %d", resp.StatusCode)
+	}
+
+	var answer strings.Builder
+	err = scanSSE(ctx, resp.Body, func(payload string) (bool, error) {
+		if payload == "[DONE]" {
+			return true, nil
+		}
+		var chunk chatStreamChunk
+		if err := json.Unmarshal([]byte(payload), &chunk); err != nil {
+			return false, fmt.Errorf("generation API stream parse failed: %w", err)
+		}
+		if chunk.Error != nil {
+			return false, fmt.Errorf("generation API error: %s", chunk.Error.Message)
+		}
+		for _, choice := range chunk.Choices {
+			if err := emitDelta(&answer, choice.Delta.Content, onDelta); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return streamedText(&answer)
+}
+
+// scanSSE 逐条读取 SSE 事件的 data 字段并交给 handle，handle 返回 true 时提前结束。
+// 读取中断时按 ctx 取消、超时与其他错误分别返回。
+func scanSSE(ctx context.Context, body io.Reader, handle func(payload string) (bool, error)) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			// 空行分隔事件，"event:" 行与 ": keep-alive" 等注释行直接忽略
+			continue
+		}
+		done, err := handle(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if isTimeoutError(err) {
+			return fmt.Errorf("%w: generation API stream interrupted", ErrGenerationTimeout)
+		}
+		return fmt.Errorf("generation API stream interrupted: %w", err)
+	}
+	return nil
+}
+
+func emitDelta(answer *strings.Builder, delta string, onDelta func(string) error) error {
+	if delta == "" {
+		return nil
+	}
+	answer.WriteString(delta)
+	return onDelta(delta)
+}
+
+func streamedText(answer *strings.Builder) (string, error) {
+	text := strings.TrimSpace(answer.String())
+	if text == "" {
+		return "", fmt.Errorf("generation API returned empty response")
+	}
+	return text, nil
+}
+
+// wrapGenerationRequestError 区分调用方取消、超时与其他请求错误
+func wrapGenerationRequestError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if isTimeoutError(err) {
+		return fmt.Errorf("%w: generation API request failed", ErrGenerationTimeout)
+	}
+	return fmt.Errorf("generation API request failed: %w", err)
+}
+
 func isTimeoutError(err error) bool {
 	var netErr net.Error
 	if errors.As(err, &netErr) && netErr.Timeout() {
@@ -160,14 +341,38 @@ func isTimeoutError(err error) bool {
 }
 
 func (c *GenClient) httpClient() *http.Client {
-	if c.HTTPClient != nil {
-		return c.HTTPClient
+	return generationHTTPClient(c.HTTPClient)
+}
+
+func (c *GenClient) streamHTTPClient() *http.Client {
+	return streamingHTTPClient(c.HTTPClient)
+}
+
+func generationHTTPClient(custom *http.Client) *http.Client {
+	if custom != nil {
+		return custom
 	}
 	return &http.Client{Timeout: generationTimeout()}
 }
 
+// streamingHTTPClient 流式请求不设整体超时（回答可能持续数十秒），只限制等待响应头的时间，
+// 生命周期由调用方的 ctx 控制
+func streamingHTTPClient(custom *http.Client) *http.Client {
+	if custom != nil {
+		return custom
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = generationTimeout()
+	return &http.Client{Transport: transport}
+}
+
 func generationTimeout() time.Duration {
-	for _, key := range []string{"LLM_TIMEOUT_SECONDS", "RAG_GENERATION_TIMEOUT_SECONDS"} {
+	return timeoutFromEnv(defaultGenTimeout, "LLM_TIMEOUT_SECONDS", "RAG_GENERATION_TIMEOUT_SECONDS")
+}
+
+// timeoutFromEnv 依次读取以秒为单位的环境变量，都未配置时返回 fallback
+func timeoutFromEnv(fallback time.Duration, keys ...string) time.Duration {
+	for _, key := range keys {
 		raw := strings.TrimSpace(os.Getenv(key))
 		if raw == "" {
 			continue
@@ -177,5 +382,5 @@ func generationTimeout() time.Duration {
 			return time.Duration(seconds) * time.Second
 		}
 	}
-	return defaultGenTimeout
+	return fallback
 }
@@ -1,9 +1,12 @@
 package rag
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -30,3 +33,69 @@ func TestGenClientCompleteReturnsTimeoutError(t *testing.T) {
 		t.Fatalf("expected ErrGenerationTimeout, got %v", err)
 	}
 }
+
+func TestGenClientGenerateStreamEmitsDeltas(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range []string{"栈是", "后进先出", "的线性表。"} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", delta)
+		}
+		fmt.Fprint(w, ": keep-alive\n\ndata: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client := &GenClient{APIKey: "test-key", BaseURL: server.URL, Model: "test-model"}
+	var deltas []string
+	answer, err := client.GenerateStream(context.Background(), "什么是栈", []string{"栈"}, nil, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GenerateStream: %v", err)
+	}
+	if answer != "栈是后进先出的线性表。" {
+		t.Fatalf("unexpected answer: %q", answer)
+	}
+	if len(deltas) != 3 {
+		t.Fatalf("expected 3 deltas, got %q", deltas)
+	}
+}
+
+func TestGenClientGenerateStreamStopsOnCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"第一段\"}}]}\n\n")
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &GenClient{APIKey: "test-key", BaseURL: server.URL, Model: "test-model"}
+	_, err := client.GenerateStream(ctx, "问题", nil, nil, func(delta string) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestGenClientGenerateStreamReportsAPIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":{"message":"invalid api key"}}`)
+	}))
+	defer server.Close()
+
+	client := &GenClient{APIKey: "test-key", BaseURL: server.URL, Model: "test-model"}
+	_, err := client.GenerateStream(context.Background(), "问题", nil, nil, func(string) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "invalid api key") {
+		t.Fatalf("expected API error, got %v", err)
+	}
+}
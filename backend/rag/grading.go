@@ -0,0 +1,138 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const gradingSystemPrompt = `你是严谨的阅卷老师，负责给学生的主观题作答评分。
+严格依据评分细则和参考答案评分，不要因为作答篇幅长短加分或扣分，作答中与题目无关的内容不得分。
+只输出一个 JSON 对象，不要输出其他内容，格式如下：
+{"criteria":[{"index":1,"score":2,"comment":"该评分点的判断"}],"score":2,"rationale":"总体评分理由，不超过 150 字","confidence":0.8}
+criteria 按评分细则逐条给分，index 为评分点编号，score 不得超过该评分点分值；没有评分细则时 criteria 为空数组。
+confidence 为 0 到 1 之间的数，表示你对评分的把握，作答含糊或与参考答案表述差异较大时应降低。`
+
+// RubricCriterion 评分细则中的一个评分点
+type RubricCriterion struct {
+	Description string  `json:"description"`
+	Points      float64 `json:"points"`
+}
+
+// GradingQuestion 待评分的一道主观题，Rubric 与 ReferenceAnswer 至少提供一项
+type GradingQuestion struct {
+	Stem            string
+	ReferenceAnswer string
+	Rubric          []RubricCriterion
+	MaxScore        float64
+	StudentAnswer   string
+}
+
+// CriterionScore 单个评分点的得分，Index 从 1 开始，对应 Rubric 的顺序
+type CriterionScore struct {
+	Index   int     `json:"index"`
+	Score   float64 `json:"score"`
+	Comment string  `json:"comment,omitempty"`
+}
+
+// GradeProposal 模型给出的评分建议，需教师确认后才计入成绩
+type GradeProposal struct {
+	Score      float64          `json:"score"`
+	Rationale  string           `json:"rationale"`
+	Confidence float64          `json:"confidence"`
+	Criteria   []CriterionScore `json:"criteria,omitempty"`
+}
+
+// GradeAnswer 按评分细则和参考答案为学生作答给出评分建议。
+// 有评分细则时总分取各评分点得分之和，不采信模型自行计算的总分。
+func GradeAnswer(ctx context.Context, model ChatModel, question GradingQuestion) (GradeProposal, error) {
+	raw, err := CompletePrompt(ctx, model, gradingSystemPrompt, buildGradingPrompt(question))
+	if err != nil {
+		return GradeProposal{}, err
+	}
+	return parseGradeProposal(raw, question)
+}
+
+func buildGradingPrompt(question GradingQuestion) string {
+	var builder strings.Builder
+	builder.WriteString("[题目]\n")
+	builder.WriteString(strings.TrimSpace(question.Stem))
+	builder.WriteString(fmt.Sprintf("\n\n[满分]\n%s\n", formatPoints(question.MaxScore)))
+	if len(question.Rubric) > 0 {
+		builder.WriteString("\n[评分细则]\n")
+		for i, criterion := range question.Rubric {
+			builder.WriteString(fmt.Sprintf("%d. %s（%s 分）\n", i+1, strings.TrimSpace(criterion.Description), formatPoints(criterion.Points)))
+		}
+	}
+	if reference := strings.TrimSpace(question.ReferenceAnswer); reference != "" {
+		builder.WriteString("\n[参考答案]\n")
+		builder.WriteString(reference)
+		builder.WriteString("\n")
+	}
+	builder.WriteString("\n[学生答案]\n")
+	builder.WriteString(strings.TrimSpace(question.StudentAnswer))
+	return builder.String()
+}
+
+// parseGradeProposal 解析模型输出的 JSON，并把各项分数限制在评分点分值和满分以内
+func parseGradeProposal(raw string, question GradingQuestion) (GradeProposal, error) {
+	text := strings.TrimSpace(raw)
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end <= start {
+		return GradeProposal{}, fmt.Errorf("grading response is not a JSON object")
+	}
+	var proposal GradeProposal
+	if err := json.Unmarshal([]byte(text[start:end+1]), &proposal); err != nil {
+		return GradeProposal{}, fmt.Errorf("grading response parse failed: %w", err)
+	}
+
+	if len(question.Rubric) > 0 {
+		scored := make(map[int]CriterionScore, len(proposal.Criteria))
+		for _, item := range proposal.Criteria {
+			if item.Index < 1 || item.Index > len(question.Rubric) {
+				continue
+			}
+			if _, ok := scored[item.Index]; !ok {
+				scored[item.Index] = item
+			}
+		}
+		criteria := make([]CriterionScore, 0, len(question.Rubric))
+		total := 0.0
+		for i, criterion := range question.Rubric {
+			item := scored[i+1]
+			item.Index = i + 1
+			item.Score = roundScore(clampScore(item.Score, criterion.Points))
+			total += item.Score
+			criteria = append(criteria, item)
+		}
+		proposal.Criteria = criteria
+		proposal.Score = total
+	} else {
+		proposal.Criteria = nil
+	}
+
+	proposal.Score = roundScore(clampScore(proposal.Score, question.MaxScore))
+	proposal.Confidence = math.Round(clampScore(proposal.Confidence, 1)*100) / 100
+	proposal.Rationale = strings.TrimSpace(proposal.Rationale)
+	return proposal, nil
+}
+
+func clampScore(value, max float64) float64 {
+	if math.IsNaN(value) || value < 0 {
+		return 0
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+func roundScore(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+func formatPoints(points float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.2f", points), "0"), ".")
+}
@@ -0,0 +1,52 @@
+package rag
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestGradeAnswerSumsRubricCriteria(t *testing.T) {
+	var prompt string
+	client := newChatTestServer(t, "```json\n"+`{"criteria":[{"index":1,"score":5,"comment":"说明了后进先出"},{"index":2,"score":1,"comment":"只提到一个应用"},{"index":7,"score":3}],"score":10,"rationale":"要点基本齐全","confidence":1.4}`+"\n```", &prompt)
+	question := GradingQuestion{
+		Stem:            "简述栈的特点和应用",
+		ReferenceAnswer: "后进先出；函数调用、表达式求值",
+		Rubric: []RubricCriterion{
+			{Description: "说明后进先出", Points: 4},
+			{Description: "列举两个应用", Points: 4},
+		},
+		MaxScore:      8,
+		StudentAnswer: "栈是后进先出的，可用于函数调用",
+	}
+
+	proposal, err := GradeAnswer(context.Background(), client, question)
+	if err != nil {
+		t.Fatalf("GradeAnswer: %v", err)
+	}
+	// 评分点得分不超过分值，越界的评分点被忽略，总分取各评分点之和
+	if proposal.Score != 5 || len(proposal.Criteria) != 2 || proposal.Criteria[0].Score != 4 {
+		t.Fatalf("unexpected proposal %+v", proposal)
+	}
+	if proposal.Confidence != 1 || proposal.Rationale != "要点基本齐全" {
+		t.Fatalf("unexpected confidence or rationale %+v", proposal)
+	}
+	for _, want := range []string{"1. 说明后进先出（4 分）", "[参考答案]\n后进先出", "[满分]\n8"} {
+		if !strings.Contains(prompt, want) {
+			t.Fatalf("prompt should contain %q, got %q", want, prompt)
+		}
+	}
+}
+
+func TestParseGradeProposalWithoutRubricClampsToMaxScore(t *testing.T) {
+	proposal, err := parseGradeProposal(`评分如下：{"score":12.345,"rationale":" 完整 ","confidence":0.756}`, GradingQuestion{MaxScore: 10})
+	if err != nil {
+		t.Fatalf("parseGradeProposal: %v", err)
+	}
+	if proposal.Score != 10 || proposal.Confidence != 0.76 || proposal.Rationale != "完整" || proposal.Criteria != nil {
+		t.Fatalf("unexpected proposal %+v", proposal)
+	}
+	if _, err := parseGradeProposal("无法评分", GradingQuestion{MaxScore: 10}); err == nil {
+		t.Fatal("expected an error for a response without JSON")
+	}
+}
@@ -0,0 +1,191 @@
+package rag
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultGroundingThreshold 句子词元在某个分块中出现的比例达到该值即视为有依据
+const DefaultGroundingThreshold = 0.5
+
+var (
+	citationPattern      = regexp.MustCompile(`\[(\d+(?:\s*[,，、]\s*\d+)*)\]`)
+	citationSplitPattern = regexp.MustCompile(`\s*[,，、]\s*`)
+	markdownPrefix       = regexp.MustCompile(`^\s*(#{1,6}\s+|[-*+]\s+|\d+[.)]\s+|>\s*)`)
+)
+
+// GroundingSource 是参与核验的检索分块；在提示词中的编号为其下标 + 1
+type GroundingSource struct {
+	ChunkID int64
+	Content string
+}
+
+// SentenceAttribution 是回答中单个句子的来源归属
+type SentenceAttribution struct {
+	Sentence string `json:"sentence"`
+	// Citations 为句中 [n] 标注对应的分块 ID
+	Citations []int64 `json:"citations,omitempty"`
+	// InvalidCitations 为超出资料编号范围的标注
+	InvalidCitations []int `json:"invalid_citations,omitempty"`
+	// SupportChunkID 为与句子重合度最高的分块
+	SupportChunkID int64   `json:"support_chunk_id,omitempty"`
+	Score          float64 `json:"score"`
+	Supported      bool    `json:"supported"`
+}
+
+// Attribution 是整段回答的逐句归属结果
+type Attribution struct {
+	Sentences        []SentenceAttribution `json:"sentences"`
+	UnsupportedCount int                   `json:"unsupported_count"`
+}
+
+// AttributeAnswer 把回答切分为句子，解析 [n] 引用并逐句核验是否能在任一检索分块中找到依据。
+// 核验基于 Tokenize 词元的覆盖率：句子词元在分块中出现的比例不低于 threshold 视为有依据。
+func AttributeAnswer(answer string, sources []GroundingSource, threshold float64) Attribution {
+	if threshold <= 0 {
+		threshold = DefaultGroundingThreshold
+	}
+
+	sourceTerms := make([]map[string]bool, len(sources))
+	for i, source := range sources {
+		terms := make(map[string]bool)
+		for _, token := range Tokenize(source.Content) {
+			terms[token] = true
+		}
+		sourceTerms[i] = terms
+	}
+
+	result := Attribution{Sentences: make([]SentenceAttribution, 0)}
+	for _, sentence := range SplitSentences(answer) {
+		item := SentenceAttribution{Sentence: sentence}
+		seen := make(map[int64]bool)
+		for _, n := range parseCitations(sentence) {
+			if n < 1 || n > len(sources) {
+				item.InvalidCitations = append(item.InvalidCitations, n)
+				continue
+			}
+			id := sources[n-1].ChunkID
+			if !seen[id] {
+				seen[id] = true
+				item.Citations = append(item.Citations, id)
+			}
+		}
+
+		tokens := uniqueTokens(markdownPrefix.ReplaceAllString(citationPattern.ReplaceAllString(sentence, ""), ""))
+		if len(tokens) == 0 {
+			// 纯符号或仅含引用标记的片段不参与核验
+			continue
+		}
+		for i, terms := range sourceTerms {
+			hit := 0
+			for _, token := range tokens {
+				if terms[token] {
+					hit++
+				}
+			}
+			score := float64(hit) / float64(len(tokens))
+			if score > item.Score {
+				item.Score = score
+				item.SupportChunkID = sources[i].ChunkID
+			}
+		}
+		item.Supported = item.Score >= threshold
+		if !item.Supported {
+			result.UnsupportedCount++
+		}
+		result.Sentences = append(result.Sentences, item)
+	}
+	return result
+}
+
+// SplitSentences 按中英文句末标点和换行切分文本；紧跟在句末标点之后的 [n] 标注归入前一句
+func SplitSentences(text string) []string {
+	runes := []rune(strings.ReplaceAll(text, "\r\n", "\n"))
+	sentences := make([]string, 0)
+	start := 0
+
+	emit := func(end int) {
+		if sentence := strings.TrimSpace(string(runes[start:end])); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		start = end
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\n' {
+			emit(i + 1)
+			continue
+		}
+		if !isSentenceEnd(runes, i) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && strings.ContainsRune("。！？!?.;；”\"）)", runes[end]) {
+			end++
+		}
+		for {
+			rest := string(runes[end:])
+			loc := citationPattern.FindStringIndex(rest)
+			if loc == nil || loc[0] != 0 {
+				break
+			}
+			end += utf8.RuneCountInString(rest[:loc[1]])
+		}
+		emit(end)
+		i = end - 1
+	}
+	emit(len(runes))
+	return sentences
+}
+
+func isSentenceEnd(runes []rune, i int) bool {
+	switch runes[i] {
+	case '。', '！', '？', '!', '?', '；':
+		return true
+	case '.':
+		// 小数点与有序列表序号（行首的 "1."）中的句点不视为句末
+		j := i - 1
+		for j >= 0 && runes[j] >= '0' && runes[j] <= '9' {
+			j--
+		}
+		if j < i-1 && (j < 0 || runes[j] == '\n' || strings.TrimSpace(string(runes[lineStart(runes, j):j+1])) == "") {
+			return false
+		}
+		return i+1 == len(runes) || runes[i+1] == ' ' || runes[i+1] == '\n' || runes[i+1] == '['
+	}
+	return false
+}
+
+func lineStart(runes []rune, i int) int {
+	for i > 0 && runes[i-1] != '\n' {
+		i--
+	}
+	return i
+}
+
+func parseCitations(sentence string) []int {
+	numbers := make([]int, 0)
+	for _, match := range citationPattern.FindAllStringSubmatch(sentence, -1) {
+		for _, part := range citationSplitPattern.Split(match[1], -1) {
+			if n, err := strconv.Atoi(part); err == nil {
+				numbers = append(numbers, n)
+			}
+		}
+	}
+	return numbers
+}
+
+func uniqueTokens(text string) []string {
+	seen := make(map[string]bool)
+	tokens := make([]string, 0)
+	for _, token := range Tokenize(text) {
+		if !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
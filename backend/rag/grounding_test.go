@@ -0,0 +1,49 @@
+package rag
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSentences(t *testing.T) {
+	text := "栈是后进先出的线性表[1]。队列先进先出。[2]\n1. 入栈 push 的复杂度为 O(1).\nPI 约等于 3.14. Done!"
+	want := []string{
+		"栈是后进先出的线性表[1]。",
+		"队列先进先出。[2]",
+		"1. 入栈 push 的复杂度为 O(1).",
+		"PI 约等于 3.14.",
+		"Done!",
+	}
+	if got := SplitSentences(text); !reflect.DeepEqual(got, want) {
+		t.Fatalf("SplitSentences:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestAttributeAnswer(t *testing.T) {
+	sources := []GroundingSource{
+		{ChunkID: 11, Content: "栈是一种后进先出的线性表，只允许在栈顶进行插入和删除。"},
+		{ChunkID: 22, Content: "队列是一种先进先出的线性表，在队尾插入、队头删除。"},
+	}
+	answer := "栈是后进先出的线性表[1]。队列在队尾插入[2][2]。红黑树通过旋转保持平衡[5]。"
+
+	result := AttributeAnswer(answer, sources, 0)
+	if len(result.Sentences) != 3 {
+		t.Fatalf("expected 3 sentences, got %+v", result.Sentences)
+	}
+
+	first := result.Sentences[0]
+	if !first.Supported || first.SupportChunkID != 11 || !reflect.DeepEqual(first.Citations, []int64{11}) {
+		t.Fatalf("unexpected first attribution: %+v", first)
+	}
+	second := result.Sentences[1]
+	if !second.Supported || second.SupportChunkID != 22 || !reflect.DeepEqual(second.Citations, []int64{22}) {
+		t.Fatalf("unexpected second attribution: %+v", second)
+	}
+	third := result.Sentences[2]
+	if third.Supported || !reflect.DeepEqual(third.InvalidCitations, []int{5}) || len(third.Citations) != 0 {
+		t.Fatalf("unexpected third attribution: %+v", third)
+	}
+	if result.UnsupportedCount != 1 {
+		t.Fatalf("expected 1 unsupported sentence, got %d", result.UnsupportedCount)
+	}
+}
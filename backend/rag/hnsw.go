@@ -0,0 +1,384 @@
+package rag
+
+import (
+	"container/heap"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	defaultHNSWM              = 16
+	defaultHNSWEfConstruction = 200
+	defaultHNSWEfSearch       = 64
+	hnswCompactMinDeleted     = 64
+)
+
+// HNSWIndex 是基于分层可导航小世界图 (HNSW) 的近似最近邻索引。
+// 向量在写入时单位化，相似度即余弦值；删除采用墓碑标记，墓碑过多时整体重建。
+type HNSWIndex struct {
+	M              int
+	EfConstruction int
+	EfSearch       int
+
+	nodes    []*hnswNode
+	byID     map[int64]int32
+	entry    int32
+	maxLevel int
+	deleted  int
+	rng      *rand.Rand
+}
+
+type hnswNode struct {
+	ID      int64
+	Vector  []float32
+	Links   [][]int32
+	Deleted bool
+}
+
+// hnswSnapshot 是索引持久化时的 gob 结构
+type hnswSnapshot struct {
+	M              int
+	EfConstruction int
+	EfSearch       int
+	Entry          int32
+	MaxLevel       int
+	Nodes          []hnswNode
+}
+
+// NewHNSWIndex 使用默认参数创建空索引
+func NewHNSWIndex() *HNSWIndex {
+	return &HNSWIndex{
+		M:              defaultHNSWM,
+		EfConstruction: defaultHNSWEfConstruction,
+		EfSearch:       defaultHNSWEfSearch,
+		byID:           make(map[int64]int32),
+		entry:          -1,
+		rng:            rand.New(rand.NewSource(42)),
+	}
+}
+
+func (h *HNSWIndex) Len() int {
+	return len(h.byID)
+}
+
+func (h *HNSWIndex) Add(id int64, vector []float32) {
+	if len(vector) == 0 {
+		return
+	}
+	if _, ok := h.byID[id]; ok {
+		h.Remove(id)
+	}
+
+	level := h.randomLevel()
+	node := &hnswNode{
+		ID:     id,
+		Vector: normalizeVector(vector),
+		Links:  make([][]int32, level+1),
+	}
+	idx := int32(len(h.nodes))
+	h.nodes = append(h.nodes, node)
+	h.byID[id] = idx
+
+	if h.entry < 0 {
+		h.entry = idx
+		h.maxLevel = level
+		return
+	}
+
+	ep := h.entry
+	for l := h.maxLevel; l > level; l-- {
+		ep = h.greedyClosest(node.Vector, ep, l)
+	}
+
+	top := level
+	if top > h.maxLevel {
+		top = h.maxLevel
+	}
+	for l := top; l >= 0; l-- {
+		candidates := h.searchLayer(node.Vector, ep, h.EfConstruction, l)
+		neighbors := candidates
+		if len(neighbors) > h.M {
+			neighbors = neighbors[:h.M]
+		}
+		node.Links[l] = make([]int32, 0, len(neighbors))
+		for _, n := range neighbors {
+			node.Links[l] = append(node.Links[l], n.idx)
+			h.connect(n.idx, idx, l)
+		}
+		if len(candidates) > 0 {
+			ep = candidates[0].idx
+		}
+	}
+
+	if level > h.maxLevel {
+		h.entry = idx
+		h.maxLevel = level
+	}
+}
+
+func (h *HNSWIndex) Remove(id int64) {
+	idx, ok := h.byID[id]
+	if !ok {
+		return
+	}
+	delete(h.byID, id)
+	h.nodes[idx].Deleted = true
+	h.deleted++
+
+	if len(h.byID) == 0 {
+		h.reset()
+		return
+	}
+	if h.deleted >= hnswCompactMinDeleted && h.deleted > len(h.byID) {
+		h.rebuild()
+	}
+}
+
+func (h *HNSWIndex) Search(query []float32, k int) []SearchResult {
+	if k <= 0 || h.entry < 0 || len(h.byID) == 0 {
+		return nil
+	}
+	q := normalizeVector(query)
+
+	ep := h.entry
+	for l := h.maxLevel; l > 0; l-- {
+		ep = h.greedyClosest(q, ep, l)
+	}
+
+	ef := h.EfSearch
+	if ef < k {
+		ef = k
+	}
+	if h.deleted > 0 {
+		extra := h.deleted
+		if extra > ef {
+			extra = ef
+		}
+		ef += extra
+	}
+
+	candidates := h.searchLayer(q, ep, ef, 0)
+	results := make([]SearchResult, 0, k)
+	for _, cand := range candidates {
+		node := h.nodes[cand.idx]
+		if node.Deleted {
+			continue
+		}
+		results = append(results, SearchResult{ID: node.ID, Score: cand.score})
+		if len(results) == k {
+			break
+		}
+	}
+	return results
+}
+
+// Save 以 gob 格式写出索引
+func (h *HNSWIndex) Save(w io.Writer) error {
+	snapshot := hnswSnapshot{
+		M:              h.M,
+		EfConstruction: h.EfConstruction,
+		EfSearch:       h.EfSearch,
+		Entry:          h.entry,
+		MaxLevel:       h.maxLevel,
+		Nodes:          make([]hnswNode, len(h.nodes)),
+	}
+	for i, node := range h.nodes {
+		snapshot.Nodes[i] = *node
+	}
+	return gob.NewEncoder(w).Encode(snapshot)
+}
+
+// LoadHNSWIndex 读取 Save 写出的索引
+func LoadHNSWIndex(r io.Reader) (*HNSWIndex, error) {
+	var snapshot hnswSnapshot
+	if err := gob.NewDecoder(r).Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("读取向量索引失败: %w", err)
+	}
+
+	h := NewHNSWIndex()
+	if snapshot.M > 0 {
+		h.M = snapshot.M
+	}
+	if snapshot.EfConstruction > 0 {
+		h.EfConstruction = snapshot.EfConstruction
+	}
+	if snapshot.EfSearch > 0 {
+		h.EfSearch = snapshot.EfSearch
+	}
+	h.entry = snapshot.Entry
+	h.maxLevel = snapshot.MaxLevel
+	if int(h.entry) >= len(snapshot.Nodes) {
+		return nil, fmt.Errorf("向量索引入口点越界")
+	}
+	h.nodes = make([]*hnswNode, len(snapshot.Nodes))
+	for i := range snapshot.Nodes {
+		node := snapshot.Nodes[i]
+		for _, links := range node.Links {
+			for _, link := range links {
+				if link < 0 || int(link) >= len(snapshot.Nodes) {
+					return nil, fmt.Errorf("向量索引邻接表损坏")
+				}
+			}
+		}
+		h.nodes[i] = &node
+		if node.Deleted {
+			h.deleted++
+			continue
+		}
+		h.byID[node.ID] = int32(i)
+	}
+	return h, nil
+}
+
+func (h *HNSWIndex) randomLevel() int {
+	mult := 1 / math.Log(float64(h.M))
+	return int(math.Floor(-math.Log(1-h.rng.Float64()) * mult))
+}
+
+func (h *HNSWIndex) maxConnections(level int) int {
+	if level == 0 {
+		return h.M * 2
+	}
+	return h.M
+}
+
+// connect 在 from 的第 level 层加入到 to 的边，超出上限时按相似度裁剪
+func (h *HNSWIndex) connect(from, to int32, level int) {
+	node := h.nodes[from]
+	if level >= len(node.Links) {
+		return
+	}
+	node.Links[level] = append(node.Links[level], to)
+	limit := h.maxConnections(level)
+	if len(node.Links[level]) <= limit {
+		return
+	}
+
+	scored := make([]hnswCandidate, 0, len(node.Links[level]))
+	for _, link := range node.Links[level] {
+		scored = append(scored, hnswCandidate{idx: link, score: dotProduct(node.Vector, h.nodes[link].Vector)})
+	}
+	sortCandidates(scored)
+	node.Links[level] = node.Links[level][:0]
+	for _, cand := range scored[:limit] {
+		node.Links[level] = append(node.Links[level], cand.idx)
+	}
+}
+
+func (h *HNSWIndex) greedyClosest(q []float32, ep int32, level int) int32 {
+	best := ep
+	bestScore := dotProduct(q, h.nodes[ep].Vector)
+	for changed := true; changed; {
+		changed = false
+		node := h.nodes[best]
+		if level >= len(node.Links) {
+			break
+		}
+		for _, link := range node.Links[level] {
+			if score := dotProduct(q, h.nodes[link].Vector); score > bestScore {
+				best, bestScore = link, score
+				changed = true
+			}
+		}
+	}
+	return best
+}
+
+// searchLayer 在单层图上做 beam search，返回按相似度降序的至多 ef 个候选
+func (h *HNSWIndex) searchLayer(q []float32, ep int32, ef, level int) []hnswCandidate {
+	visited := map[int32]struct{}{ep: {}}
+	start := hnswCandidate{idx: ep, score: dotProduct(q, h.nodes[ep].Vector)}
+
+	candidates := &candidateMaxHeap{start}
+	results := &candidateMinHeap{start}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() >= ef && current.score < (*results)[0].score {
+			break
+		}
+		node := h.nodes[current.idx]
+		if level >= len(node.Links) {
+			continue
+		}
+		for _, link := range node.Links[level] {
+			if _, seen := visited[link]; seen {
+				continue
+			}
+			visited[link] = struct{}{}
+			score := dotProduct(q, h.nodes[link].Vector)
+			if results.Len() < ef || score > (*results)[0].score {
+				heap.Push(candidates, hnswCandidate{idx: link, score: score})
+				heap.Push(results, hnswCandidate{idx: link, score: score})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	out := make([]hnswCandidate, results.Len())
+	copy(out, *results)
+	sortCandidates(out)
+	return out
+}
+
+func (h *HNSWIndex) reset() {
+	h.nodes = nil
+	h.byID = make(map[int64]int32)
+	h.entry = -1
+	h.maxLevel = 0
+	h.deleted = 0
+}
+
+func (h *HNSWIndex) rebuild() {
+	live := make([]*hnswNode, 0, len(h.byID))
+	for _, node := range h.nodes {
+		if !node.Deleted {
+			live = append(live, node)
+		}
+	}
+	h.reset()
+	for _, node := range live {
+		h.Add(node.ID, node.Vector)
+	}
+}
+
+type hnswCandidate struct {
+	idx   int32
+	score float32
+}
+
+func sortCandidates(c []hnswCandidate) {
+	sort.Slice(c, func(i, j int) bool { return c[i].score > c[j].score })
+}
+
+type candidateMaxHeap []hnswCandidate
+
+func (h candidateMaxHeap) Len() int            { return len(h) }
+func (h candidateMaxHeap) Less(i, j int) bool  { return h[i].score > h[j].score }
+func (h candidateMaxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *candidateMaxHeap) Push(x interface{}) { *h = append(*h, x.(hnswCandidate)) }
+func (h *candidateMaxHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+type candidateMinHeap []hnswCandidate
+
+func (h candidateMinHeap) Len() int            { return len(h) }
+func (h candidateMinHeap) Less(i, j int) bool  { return h[i].score < h[j].score }
+func (h candidateMinHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *candidateMinHeap) Push(x interface{}) { *h = append(*h, x.(hnswCandidate)) }
+func (h *candidateMinHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
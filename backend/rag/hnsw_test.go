@@ -0,0 +1,84 @@
+package rag
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func randomVectors(n, dim int, seed int64) [][]float32 {
+	rng := rand.New(rand.NewSource(seed))
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		v := make([]float32, dim)
+		for j := range v {
+			v[j] = float32(rng.NormFloat64())
+		}
+		vectors[i] = v
+	}
+	return vectors
+}
+
+func TestHNSWIndexRecallAgainstFlatIndex(t *testing.T) {
+	vectors := randomVectors(1000, 32, 1)
+	hnsw := NewHNSWIndex()
+	flat := NewFlatIndex()
+	for i, v := range vectors {
+		hnsw.Add(int64(i+1), v)
+		flat.Add(int64(i+1), v)
+	}
+
+	queries := randomVectors(50, 32, 2)
+	hits, total := 0, 0
+	for _, q := range queries {
+		want := map[int64]bool{}
+		for _, r := range flat.Search(q, 10) {
+			want[r.ID] = true
+		}
+		for _, r := range hnsw.Search(q, 10) {
+			if want[r.ID] {
+				hits++
+			}
+		}
+		total += 10
+	}
+	if recall := float64(hits) / float64(total); recall < 0.9 {
+		t.Fatalf("expected recall@10 >= 0.9, got %.2f", recall)
+	}
+}
+
+func TestHNSWIndexRemoveAndPersist(t *testing.T) {
+	vectors := randomVectors(200, 16, 3)
+	index := NewHNSWIndex()
+	for i, v := range vectors {
+		index.Add(int64(i+1), v)
+	}
+	for id := int64(1); id <= 150; id++ {
+		index.Remove(id)
+	}
+	if index.Len() != 50 {
+		t.Fatalf("expected 50 live vectors, got %d", index.Len())
+	}
+
+	var buf bytes.Buffer
+	if err := index.Save(&buf); err != nil {
+		t.Fatalf("save index: %v", err)
+	}
+	loaded, err := LoadHNSWIndex(&buf)
+	if err != nil {
+		t.Fatalf("load index: %v", err)
+	}
+	if loaded.Len() != 50 {
+		t.Fatalf("expected 50 vectors after reload, got %d", loaded.Len())
+	}
+
+	results := loaded.Search(vectors[180], 5)
+	if len(results) == 0 || results[0].ID != 181 {
+		t.Fatalf("expected exact match 181 first, got %#v", results)
+	}
+	for _, r := range results {
+		if r.ID <= 150 {
+			t.Fatalf("removed vector %d returned from search", r.ID)
+		}
+	}
+}
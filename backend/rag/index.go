@@ -0,0 +1,98 @@
+package rag
+
+import (
+	"math"
+	"sort"
+)
+
+// SearchResult 表示向量索引的一条检索结果
+type SearchResult struct {
+	ID    int64
+	Score float32
+}
+
+// VectorIndex 是可插拔的向量索引接口，TopK 与课程知识库检索都通过它完成
+type VectorIndex interface {
+	// Add 写入或覆盖一个向量
+	Add(id int64, vector []float32)
+	// Remove 删除一个向量，不存在时忽略
+	Remove(id int64)
+	// Search 返回与 query 最相似的前 k 个结果，按相似度降序
+	Search(query []float32, k int) []SearchResult
+	// Len 返回当前有效向量数
+	Len() int
+}
+
+// FlatIndex 暴力余弦检索，适合小规模数据或作为 ANN 索引的对照基准
+type FlatIndex struct {
+	vectors map[int64][]float32
+}
+
+func NewFlatIndex() *FlatIndex {
+	return &FlatIndex{vectors: make(map[int64][]float32)}
+}
+
+func (f *FlatIndex) Add(id int64, vector []float32) {
+	if len(vector) == 0 {
+		return
+	}
+	f.vectors[id] = vector
+}
+
+func (f *FlatIndex) Remove(id int64) {
+	delete(f.vectors, id)
+}
+
+func (f *FlatIndex) Len() int {
+	return len(f.vectors)
+}
+
+func (f *FlatIndex) Search(query []float32, k int) []SearchResult {
+	results := make([]SearchResult, 0, len(f.vectors))
+	for id, vector := range f.vectors {
+		results = append(results, SearchResult{ID: id, Score: CosineSimilarity(query, vector)})
+	}
+	sortSearchResults(results)
+	if k < len(results) {
+		results = results[:k]
+	}
+	return results
+}
+
+func sortSearchResults(results []SearchResult) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score == results[j].Score {
+			return results[i].ID < results[j].ID
+		}
+		return results[i].Score > results[j].Score
+	})
+}
+
+// normalizeVector 返回单位化后的向量副本，零向量原样返回
+func normalizeVector(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	out := make([]float32, len(v))
+	if norm == 0 {
+		copy(out, v)
+		return out
+	}
+	scale := 1 / math.Sqrt(norm)
+	for i, x := range v {
+		out[i] = float32(float64(x) * scale)
+	}
+	return out
+}
+
+func dotProduct(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return float32(dot)
+}
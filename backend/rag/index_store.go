@@ -0,0 +1,314 @@
+package rag
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChunkLoader 从数据库读取某课程全部已向量化的分块，用于首次构建或重建索引
+type ChunkLoader func() ([]Chunk, error)
+
+// IndexVersion 课程有效分块的数量与 ID 之和。分块 ID 自增且不复用，删掉一块再加一块时数量不变但 ID 之和会变，
+// 与数据库不一致即说明索引过期
+type IndexVersion struct {
+	Count int
+	IDSum int64
+}
+
+// DefaultIndexSaveDelay 增量更新后延迟落盘的时间，期间的多次写入合并为一次
+const DefaultIndexSaveDelay = 2 * time.Second
+
+// IndexStore 按课程维护 HNSW 向量索引与 BM25 关键词索引：
+// 内存中缓存，磁盘上持久化为 Dir/course_<id>.hnsw、Dir/course_<id>.bm25，
+// 以及记录向量模型的 Dir/course_<id>.model。
+// 每个课程单独加锁，加载和重建只阻塞同一课程；Add/Remove 后延迟 SaveDelay 合并落盘，
+// 磁盘上的索引落后于数据库时按版本不一致重建，不会用错
+type IndexStore struct {
+	Dir string
+	// SaveDelay 为 0 时每次写入后立即在后台落盘
+	SaveDelay time.Duration
+	// OnSaveError 延迟落盘失败时回调，便于调用方记录日志；落盘失败不影响内存中的索引
+	OnSaveError func(courseID int64, err error)
+
+	mu      sync.Mutex
+	courses map[int64]*courseEntry
+}
+
+// courseEntry 课程索引及其锁：检索持读锁，写入、加载和重建持写锁
+type courseEntry struct {
+	mu     sync.RWMutex
+	index  *courseIndex
+	dirty  bool
+	saving *time.Timer
+}
+
+type courseIndex struct {
+	model   string
+	vector  *HNSWIndex
+	keyword *BM25Index
+	idSum   int64
+}
+
+func NewIndexStore(dir string) *IndexStore {
+	return &IndexStore{Dir: dir, SaveDelay: DefaultIndexSaveDelay, courses: make(map[int64]*courseEntry)}
+}
+
+// Retrieve 在课程索引中检索。model 为当前向量模型，expected 为数据库中该课程与模型匹配的有效分块版本，
+// 与索引不一致时（首次使用、切换模型、进程外修改、文件损坏）通过 loader 全量重建。
+func (s *IndexStore) Retrieve(courseID int64, model string, expected IndexVersion, loader ChunkLoader, q RetrievalQuery) ([]SearchResult, error) {
+	entry := s.entry(courseID)
+	entry.mu.RLock()
+	if entry.index != nil && entry.index.matches(model, expected) {
+		defer entry.mu.RUnlock()
+		return Retrieve(entry.index.vector, entry.index.keyword, q), nil
+	}
+	entry.mu.RUnlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	// 等锁期间其他请求可能已经加载或重建过
+	index := s.loadLocked(courseID, entry)
+	if !index.matches(model, expected) {
+		chunks, err := loader()
+		if err != nil {
+			return nil, err
+		}
+		index = newCourseIndex(model)
+		for _, chunk := range chunks {
+			index.add(chunk)
+		}
+		entry.index = index
+		s.markDirtyLocked(courseID, entry)
+	}
+	return Retrieve(index.vector, index.keyword, q), nil
+}
+
+// Add 增量写入由 model 生成向量的课程分块，稍后落盘。已有索引属于其他模型时先清空，
+// 下次检索会因版本不一致而按数据库重建。
+func (s *IndexStore) Add(courseID int64, model string, chunks []Chunk) {
+	entry := s.entry(courseID)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	index := s.loadLocked(courseID, entry)
+	if index.model != model {
+		index = newCourseIndex(model)
+		entry.index = index
+	}
+	for _, chunk := range chunks {
+		index.add(chunk)
+	}
+	s.markDirtyLocked(courseID, entry)
+}
+
+// Remove 从课程索引中删除分块，稍后落盘
+func (s *IndexStore) Remove(courseID int64, chunkIDs []int64) {
+	entry := s.entry(courseID)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	index := s.loadLocked(courseID, entry)
+	for _, id := range chunkIDs {
+		index.remove(id)
+	}
+	s.markDirtyLocked(courseID, entry)
+}
+
+// Invalidate 丢弃课程索引（内存与磁盘），下次检索时全量重建
+func (s *IndexStore) Invalidate(courseID int64) error {
+	entry := s.entry(courseID)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	entry.index = nil
+	entry.dirty = false
+	if entry.saving != nil {
+		entry.saving.Stop()
+		entry.saving = nil
+	}
+	for _, ext := range []string{"hnsw", "bm25", "model"} {
+		if err := os.Remove(s.path(courseID, ext)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("删除课程索引失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// Flush 立即写出所有待落盘的课程索引，用于退出前或测试
+func (s *IndexStore) Flush() error {
+	s.mu.Lock()
+	ids := make([]int64, 0, len(s.courses))
+	for courseID := range s.courses {
+		ids = append(ids, courseID)
+	}
+	s.mu.Unlock()
+
+	var firstErr error
+	for _, courseID := range ids {
+		if err := s.flush(courseID); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// entry 返回课程的索引项，全局锁只保护课程表本身
+func (s *IndexStore) entry(courseID int64) *courseEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.courses[courseID]
+	if !ok {
+		entry = &courseEntry{}
+		s.courses[courseID] = entry
+	}
+	return entry
+}
+
+func (s *IndexStore) path(courseID int64, ext string) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("course_%d.%s", courseID, ext))
+}
+
+// loadLocked 在持有课程写锁时返回内存中的索引，首次访问从磁盘读取
+func (s *IndexStore) loadLocked(courseID int64, entry *courseEntry) *courseIndex {
+	if entry.index != nil {
+		return entry.index
+	}
+
+	index := newCourseIndex("")
+	if raw, err := os.ReadFile(s.path(courseID, "model")); err == nil {
+		index.model = strings.TrimSpace(string(raw))
+	}
+	if f, err := os.Open(s.path(courseID, "hnsw")); err == nil {
+		if loaded, err := LoadHNSWIndex(f); err == nil {
+			index.vector = loaded
+		}
+		f.Close()
+	}
+	if f, err := os.Open(s.path(courseID, "bm25")); err == nil {
+		if loaded, err := LoadBM25Index(f); err == nil {
+			index.keyword = loaded
+		}
+		f.Close()
+	}
+	for id := range index.vector.byID {
+		index.idSum += id
+	}
+	entry.index = index
+	return index
+}
+
+// markDirtyLocked 标记课程索引待落盘，SaveDelay 内的多次写入只落盘一次
+func (s *IndexStore) markDirtyLocked(courseID int64, entry *courseEntry) {
+	entry.dirty = true
+	if entry.saving != nil {
+		return
+	}
+	delay := s.SaveDelay
+	if delay < 0 {
+		delay = 0
+	}
+	entry.saving = time.AfterFunc(delay, func() {
+		if err := s.flush(courseID); err != nil && s.OnSaveError != nil {
+			s.OnSaveError(courseID, err)
+		}
+	})
+}
+
+// flush 写出课程索引。落盘期间只持读锁，检索不受影响；失败时保留待落盘标记，下次写入或 Flush 时重试
+func (s *IndexStore) flush(courseID int64) error {
+	entry := s.entry(courseID)
+	entry.mu.Lock()
+	if entry.saving != nil {
+		entry.saving.Stop()
+		entry.saving = nil
+	}
+	index, dirty := entry.index, entry.dirty
+	entry.dirty = false
+	entry.mu.Unlock()
+	if !dirty || index == nil {
+		return nil
+	}
+
+	entry.mu.RLock()
+	var err error
+	// 落盘前被重建或丢弃时由新的索引负责落盘
+	if entry.index == index {
+		err = s.save(courseID, index)
+	}
+	entry.mu.RUnlock()
+	if err != nil {
+		entry.mu.Lock()
+		if entry.index == index {
+			entry.dirty = true
+		}
+		entry.mu.Unlock()
+	}
+	return err
+}
+
+func (s *IndexStore) save(courseID int64, index *courseIndex) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return fmt.Errorf("创建向量索引目录失败: %w", err)
+	}
+	if err := writeFileAtomic(s.path(courseID, "hnsw"), index.vector.Save); err != nil {
+		return fmt.Errorf("写入向量索引失败: %w", err)
+	}
+	if err := writeFileAtomic(s.path(courseID, "bm25"), index.keyword.Save); err != nil {
+		return fmt.Errorf("写入关键词索引失败: %w", err)
+	}
+	writeModel := func(w io.Writer) error {
+		_, err := io.WriteString(w, index.model)
+		return err
+	}
+	if err := writeFileAtomic(s.path(courseID, "model"), writeModel); err != nil {
+		return fmt.Errorf("写入索引模型信息失败: %w", err)
+	}
+	return nil
+}
+
+func newCourseIndex(model string) *courseIndex {
+	return &courseIndex{model: model, vector: NewHNSWIndex(), keyword: NewBM25Index()}
+}
+
+func (c *courseIndex) add(chunk Chunk) {
+	if _, ok := c.vector.byID[chunk.ID]; !ok && len(chunk.Embedding) > 0 {
+		c.idSum += chunk.ID
+	}
+	c.vector.Add(chunk.ID, chunk.Embedding)
+	c.keyword.Add(chunk.ID, chunk.Content)
+}
+
+func (c *courseIndex) remove(id int64) {
+	if _, ok := c.vector.byID[id]; ok {
+		c.idSum -= id
+	}
+	c.vector.Remove(id)
+	c.keyword.Remove(id)
+}
+
+func (c *courseIndex) matches(model string, expected IndexVersion) bool {
+	return c.model == model && c.vector.Len() == expected.Count && c.keyword.Len() == expected.Count && c.idSum == expected.IDSum
+}
+
+// writeFileAtomic 先写临时文件再原子替换，避免进程中断留下半截索引
+func writeFileAtomic(target string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(target), filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
@@ -0,0 +1,109 @@
+package rag
+
+import (
+	"testing"
+	"time"
+)
+
+func testChunks(ids ...int64) []Chunk {
+	vectors := randomVectors(len(ids), 8, ids[0])
+	chunks := make([]Chunk, len(ids))
+	for i, id := range ids {
+		chunks[i] = Chunk{ID: id, Content: "栈 队列", Embedding: vectors[i]}
+	}
+	return chunks
+}
+
+func versionOf(chunks []Chunk) IndexVersion {
+	version := IndexVersion{Count: len(chunks)}
+	for _, chunk := range chunks {
+		version.IDSum += chunk.ID
+	}
+	return version
+}
+
+func TestIndexStoreRebuildsWhenChunkSetChangesWithSameCount(t *testing.T) {
+	store := NewIndexStore(t.TempDir())
+	q := RetrievalQuery{Text: "栈", Mode: RetrievalKeyword, K: 5}
+
+	db := testChunks(1, 2, 3)
+	loads := 0
+	loader := func() ([]Chunk, error) {
+		loads++
+		return db, nil
+	}
+	if _, err := store.Retrieve(1, "m", versionOf(db), loader, q); err != nil || loads != 1 {
+		t.Fatalf("first retrieval must build the index, loads=%d err=%v", loads, err)
+	}
+	if _, err := store.Retrieve(1, "m", versionOf(db), loader, q); err != nil || loads != 1 {
+		t.Fatalf("unchanged chunks must reuse the index, loads=%d err=%v", loads, err)
+	}
+
+	// 进程外删掉一块又加了一块：数量不变，ID 之和变了
+	db = append(testChunks(1, 2), testChunks(4)...)
+	results, err := store.Retrieve(1, "m", versionOf(db), loader, q)
+	if err != nil || loads != 2 {
+		t.Fatalf("changed chunk set must trigger a rebuild, loads=%d err=%v", loads, err)
+	}
+	for _, result := range results {
+		if result.ID == 3 {
+			t.Fatalf("deleted chunk must not be returned, got %+v", results)
+		}
+	}
+}
+
+func TestIndexStoreRebuildDoesNotBlockOtherCourses(t *testing.T) {
+	store := NewIndexStore(t.TempDir())
+	q := RetrievalQuery{Text: "栈", Mode: RetrievalKeyword, K: 5}
+	slow := testChunks(1, 2)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		store.Retrieve(1, "m", versionOf(slow), func() ([]Chunk, error) {
+			close(started)
+			<-release
+			return slow, nil
+		}, q)
+	}()
+	<-started
+
+	fast := testChunks(10)
+	finished := make(chan struct{})
+	go func() {
+		store.Retrieve(2, "m", versionOf(fast), func() ([]Chunk, error) { return fast, nil }, q)
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+		t.Fatal("retrieval for another course must not wait for a rebuild")
+	}
+	close(release)
+	<-done
+}
+
+func TestIndexStoreBatchesWritesAndReloadsFromDisk(t *testing.T) {
+	dir := t.TempDir()
+	store := NewIndexStore(dir)
+	store.SaveDelay = time.Hour
+	chunks := testChunks(1, 2, 3)
+	for _, chunk := range chunks {
+		store.Add(7, "m", []Chunk{chunk})
+	}
+	store.Remove(7, []int64{2})
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewIndexStore(dir)
+	remaining := []Chunk{chunks[0], chunks[2]}
+	loader := func() ([]Chunk, error) {
+		t.Fatal("index saved on disk must be reused")
+		return nil, nil
+	}
+	if _, err := reopened.Retrieve(7, "m", versionOf(remaining), loader, RetrievalQuery{Text: "栈", Mode: RetrievalKeyword, K: 5}); err != nil {
+		t.Fatal(err)
+	}
+}
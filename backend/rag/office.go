@@ -0,0 +1,271 @@
+package rag
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const xlsxCellSeparator = " | "
+
+// ---------- PPTX ----------
+
+type pptxRelationship struct {
+	ID     string `xml:"Id,attr"`
+	Type   string `xml:"Type,attr"`
+	Target string `xml:"Target,attr"`
+}
+
+type pptxRelationships struct {
+	Items []pptxRelationship `xml:"Relationship"`
+}
+
+type pptxPresentation struct {
+	Slides []struct {
+		RID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sldIdLst>sldId"`
+}
+
+var pptxSlideName = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+
+// extractPPTXSegments 按放映顺序抽取每页幻灯片的正文与讲者备注，每页作为一段并记录页序号
+func extractPPTXSegments(r io.Reader) ([]Segment, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("读取 pptx 压缩结构失败: %w", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, file := range zr.File {
+		files[file.Name] = file
+	}
+
+	slidePaths := pptxSlideOrder(files)
+	if len(slidePaths) == 0 {
+		return nil, fmt.Errorf("pptx 中未找到幻灯片")
+	}
+
+	segments := make([]Segment, 0, len(slidePaths))
+	for i, slidePath := range slidePaths {
+		body, err := readZipDrawingText(files[slidePath])
+		if err != nil {
+			return nil, err
+		}
+
+		var notes string
+		rels := readZipRelationships(files, slidePath)
+		for _, rel := range rels {
+			if strings.HasSuffix(rel.Type, "/notesSlide") {
+				notes, err = readZipDrawingText(files[resolveZipTarget(slidePath, rel.Target)])
+				if err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+
+		text := body
+		if notes != "" {
+			if text != "" {
+				text += "\n\n"
+			}
+			text += "讲者备注：\n" + notes
+		}
+		if text == "" {
+			continue
+		}
+		segments = append(segments, Segment{Text: text, Meta: ChunkMeta{Slide: i + 1}})
+	}
+	return segments, nil
+}
+
+// pptxSlideOrder 依据 presentation.xml 的 sldIdLst 确定放映顺序，缺失时按文件编号排序
+func pptxSlideOrder(files map[string]*zip.File) []string {
+	const presentationPath = "ppt/presentation.xml"
+	ordered := make([]string, 0)
+
+	if file, ok := files[presentationPath]; ok {
+		var presentation pptxPresentation
+		if err := decodeZipXML(file, &presentation); err == nil {
+			targets := make(map[string]string)
+			for _, rel := range readZipRelationships(files, presentationPath) {
+				targets[rel.ID] = resolveZipTarget(presentationPath, rel.Target)
+			}
+			for _, slide := range presentation.Slides {
+				if target, ok := targets[slide.RID]; ok && files[target] != nil {
+					ordered = append(ordered, target)
+				}
+			}
+		}
+	}
+	if len(ordered) > 0 {
+		return ordered
+	}
+
+	type numbered struct {
+		path string
+		num  int
+	}
+	slides := make([]numbered, 0)
+	for name := range files {
+		if m := pptxSlideName.FindStringSubmatch(name); m != nil {
+			num, _ := strconv.Atoi(m[1])
+			slides = append(slides, numbered{path: name, num: num})
+		}
+	}
+	sort.Slice(slides, func(i, j int) bool { return slides[i].num < slides[j].num })
+	for _, slide := range slides {
+		ordered = append(ordered, slide.path)
+	}
+	return ordered
+}
+
+func readZipRelationships(files map[string]*zip.File, partPath string) []pptxRelationship {
+	relsPath := path.Join(path.Dir(partPath), "_rels", path.Base(partPath)+".rels")
+	file, ok := files[relsPath]
+	if !ok {
+		return nil
+	}
+	var rels pptxRelationships
+	if err := decodeZipXML(file, &rels); err != nil {
+		return nil
+	}
+	return rels.Items
+}
+
+func resolveZipTarget(partPath, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+	return path.Join(path.Dir(partPath), target)
+}
+
+func decodeZipXML(file *zip.File, v interface{}) error {
+	rc, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+func readZipDrawingText(file *zip.File) (string, error) {
+	if file == nil {
+		return "", nil
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return extractDrawingMLText(rc)
+}
+
+// extractDrawingMLText 抽取幻灯片 XML 中的段落文字，跳过页码、日期等字段占位符
+func extractDrawingMLText(r io.Reader) (string, error) {
+	decoder := xml.NewDecoder(r)
+	var builder strings.Builder
+	var current strings.Builder
+	fieldDepth := 0
+
+	flushParagraph := func() {
+		text := strings.TrimSpace(current.String())
+		current.Reset()
+		if text == "" {
+			return
+		}
+		if builder.Len() > 0 {
+			builder.WriteString("\n")
+		}
+		builder.WriteString(text)
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			flushParagraph()
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("解析 pptx XML 失败: %w", err)
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			switch elem.Name.Local {
+			case "fld":
+				fieldDepth++
+			case "t":
+				var content string
+				if err := decoder.DecodeElement(&content, &elem); err != nil {
+					return "", err
+				}
+				if fieldDepth == 0 {
+					current.WriteString(content)
+				}
+			case "br":
+				current.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch elem.Name.Local {
+			case "fld":
+				fieldDepth--
+			case "p":
+				flushParagraph()
+			}
+		}
+	}
+
+	return builder.String(), nil
+}
+
+// ---------- XLSX ----------
+
+// extractXLSXSegments 逐个工作表抽取单元格文本，每行以 " | " 连接单元格，每个工作表作为一段
+func extractXLSXSegments(r io.Reader) ([]Segment, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("读取 xlsx 失败: %w", err)
+	}
+	defer f.Close()
+
+	segments := make([]Segment, 0)
+	for i, sheet := range f.GetSheetList() {
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			return nil, fmt.Errorf("读取工作表 %s 失败: %w", sheet, err)
+		}
+
+		lines := make([]string, 0, len(rows))
+		for _, row := range rows {
+			cells := make([]string, 0, len(row))
+			for _, cell := range row {
+				cells = append(cells, strings.TrimSpace(cell))
+			}
+			line := strings.TrimRight(strings.Join(cells, xlsxCellSeparator), " |")
+			if strings.Trim(line, " |") != "" {
+				lines = append(lines, line)
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		segments = append(segments, Segment{
+			Text: "工作表：" + sheet + "\n" + strings.Join(lines, "\n"),
+			Meta: ChunkMeta{Sheet: i + 1, SheetName: sheet},
+		})
+	}
+	return segments, nil
+}
@@ -0,0 +1,96 @@
+package rag
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func buildTestPPTX(t *testing.T) []byte {
+	t.Helper()
+	parts := map[string]string{
+		"ppt/presentation.xml": `<p:presentation xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<p:sldIdLst><p:sldId id="256" r:id="rId3"/><p:sldId id="257" r:id="rId2"/></p:sldIdLst></p:presentation>`,
+		"ppt/_rels/presentation.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide" Target="slides/slide1.xml"/>
+<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide" Target="slides/slide2.xml"/>
+</Relationships>`,
+		"ppt/slides/slide1.xml": `<p:sld xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main">
+<p:cSld><p:spTree><p:sp><p:txBody><a:p><a:r><a:t>二叉树遍历</a:t></a:r></a:p></p:txBody></p:sp></p:spTree></p:cSld></p:sld>`,
+		"ppt/slides/slide2.xml": `<p:sld xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main">
+<p:cSld><p:spTree><p:sp><p:txBody><a:p><a:r><a:t>课程导论</a:t></a:r></a:p><a:p><a:r><a:t>数据结构</a:t></a:r></a:p></p:txBody></p:sp></p:spTree></p:cSld></p:sld>`,
+		"ppt/slides/_rels/slide1.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/notesSlide" Target="../notesSlides/notesSlide7.xml"/>
+</Relationships>`,
+		"ppt/notesSlides/notesSlide7.xml": `<p:notes xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main">
+<p:cSld><p:spTree><p:sp><p:txBody><a:p><a:r><a:t>先讲前序遍历</a:t></a:r></a:p></p:txBody></p:sp>
+<p:sp><p:txBody><a:p><a:fld type="slidenum"><a:t>2</a:t></a:fld></a:p></p:txBody></p:sp></p:spTree></p:cSld></p:notes>`,
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractSegmentsPPTX(t *testing.T) {
+	segments, err := ExtractSegments("lecture.pptx", bytes.NewReader(buildTestPPTX(t)))
+	if err != nil {
+		t.Fatalf("ExtractSegments: %v", err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("expected 2 slides, got %+v", segments)
+	}
+	if segments[0].Meta.Slide != 1 || segments[0].Text != "课程导论\n数据结构" {
+		t.Fatalf("slides should follow presentation order, got %+v", segments[0])
+	}
+	if segments[1].Meta.Slide != 2 || segments[1].Text != "二叉树遍历\n\n讲者备注：\n先讲前序遍历" {
+		t.Fatalf("unexpected slide 2 segment: %+v", segments[1])
+	}
+	if segments[1].Meta.Label() != "slide 2" {
+		t.Fatalf("unexpected label: %q", segments[1].Meta.Label())
+	}
+}
+
+func TestExtractSegmentsXLSX(t *testing.T) {
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "成绩")
+	f.SetSheetRow("成绩", "A1", &[]interface{}{"学号", "姓名", "总评"})
+	f.SetSheetRow("成绩", "A2", &[]interface{}{"2024001", "张三", 92})
+	f.NewSheet("空表")
+	f.NewSheet("说明")
+	f.SetCellValue("说明", "B3", "满分 100 分")
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatalf("write xlsx: %v", err)
+	}
+
+	segments, err := ExtractSegments("grades.xlsx", &buf)
+	if err != nil {
+		t.Fatalf("ExtractSegments: %v", err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("expected empty sheet to be skipped, got %+v", segments)
+	}
+	if segments[0].Text != "工作表：成绩\n学号 | 姓名 | 总评\n2024001 | 张三 | 92" {
+		t.Fatalf("unexpected sheet text: %q", segments[0].Text)
+	}
+	if segments[0].Meta.Label() != "sheet 1 (成绩)" {
+		t.Fatalf("unexpected label: %q", segments[0].Meta.Label())
+	}
+	if segments[1].Meta.Sheet != 3 || segments[1].Text != "工作表：说明\n | 满分 100 分" {
+		t.Fatalf("unexpected sheet 3 segment: %+v", segments[1])
+	}
+}
@@ -11,21 +11,54 @@ import (
 )
 
 func ExtractText(filename string, r io.Reader) (string, error) {
+    segments, err := ExtractSegments(filename, r)
+    if err != nil {
+        return "", err
+    }
+    parts := make([]string, 0, len(segments))
+    for _, segment := range segments {
+        parts = append(parts, segment.Text)
+    }
+    return strings.Join(parts, "\n\n"), nil
+}
+
+// IsSupportedDocument 判断 ExtractSegments 是否支持该文件格式
+func IsSupportedDocument(filename string) bool {
+    switch strings.ToLower(filepath.Ext(filename)) {
+    case ".txt", ".md", ".docx", ".pdf", ".pptx", ".xlsx":
+        return true
+    }
+    return false
+}
+
+// ExtractSegments 抽取文档文本并保留位置信息；PDF 按页、PPTX 按幻灯片、XLSX 按工作表返回，其余格式整篇作为一段
+func ExtractSegments(filename string, r io.Reader) ([]Segment, error) {
     ext := strings.ToLower(filepath.Ext(filename))
+    var text string
+    var err error
     switch ext {
     case ".txt", ".md":
-        data, err := io.ReadAll(r)
-        if err != nil {
-            return "", err
-        }
-        return strings.TrimSpace(string(data)), nil
+        var data []byte
+        data, err = io.ReadAll(r)
+        text = strings.TrimSpace(string(data))
     case ".docx":
-        return extractDOCXText(r)
+        text, err = extractDOCXText(r)
     case ".pdf":
-        return "", fmt.Errorf("暂不支持 PDF 自动解析，请优先上传 txt、md 或 docx 文档")
+        return extractPDFSegments(r)
+    case ".pptx":
+        return extractPPTXSegments(r)
+    case ".xlsx":
+        return extractXLSXSegments(r)
     default:
-        return "", fmt.Errorf("暂不支持的文档格式: %s", ext)
+        return nil, fmt.Errorf("暂不支持的文档格式: %s", ext)
+    }
+    if err != nil {
+        return nil, err
+    }
+    if text == "" {
+        return nil, nil
     }
+    return []Segment{{Text: text}}, nil
 }
 
 func extractDOCXText(r io.Reader) (string, error) {
@@ -0,0 +1,1469 @@
+package rag
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// PDF 文本抽取：解析 xref 表 / xref 流与对象流，解码 Flate 等常见过滤器，
+// 遍历页面树并解释内容流中的文本操作符，借助 ToUnicode CMap 还原包括中文在内的字符。
+// 只做文本层抽取，不处理扫描件 OCR 与加密文档。
+
+const (
+	pdfMaxStreamSize = 64 << 20
+	pdfMaxDepth      = 32
+	pdfMaxFormDepth  = 5
+)
+
+type pdfName string
+
+type pdfKeyword string
+
+type pdfRef struct {
+	num int
+	gen int
+}
+
+type pdfDict map[string]interface{}
+
+type pdfStream struct {
+	dict pdfDict
+	raw  []byte
+}
+
+type pdfXrefEntry struct {
+	kind   int // 1: 文件偏移，2: 位于对象流中
+	offset int64
+	stream int
+	index  int
+}
+
+type pdfDocument struct {
+	data    []byte
+	xref    map[int]pdfXrefEntry
+	trailer pdfDict
+	cache   map[int]interface{}
+	objStms map[int]map[int]interface{}
+	fonts   map[interface{}]*pdfFont
+}
+
+// ExtractPDFPages 按页抽取 PDF 文本，返回的切片下标加一即页码；无文字的页面为空串
+func ExtractPDFPages(data []byte) ([]string, error) {
+	doc, err := openPDF(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, encrypted := doc.trailer["Encrypt"]; encrypted {
+		return nil, fmt.Errorf("暂不支持加密的 PDF 文档")
+	}
+
+	pages, err := doc.pages()
+	if err != nil {
+		return nil, err
+	}
+
+	texts := make([]string, 0, len(pages))
+	for _, page := range pages {
+		texts = append(texts, strings.TrimSpace(doc.pageText(page)))
+	}
+	return texts, nil
+}
+
+func extractPDFSegments(r io.Reader) ([]Segment, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := ExtractPDFPages(data)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]Segment, 0, len(pages))
+	for i, text := range pages {
+		if text == "" {
+			continue
+		}
+		segments = append(segments, Segment{Text: text, Meta: ChunkMeta{Page: i + 1}})
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("PDF 中未提取到文字，可能是扫描件或图片型文档")
+	}
+	return segments, nil
+}
+
+// ---------- 文档结构 ----------
+
+func openPDF(data []byte) (*pdfDocument, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF")) {
+		return nil, fmt.Errorf("不是有效的 PDF 文件")
+	}
+
+	doc := &pdfDocument{
+		data:    data,
+		xref:    make(map[int]pdfXrefEntry),
+		cache:   make(map[int]interface{}),
+		objStms: make(map[int]map[int]interface{}),
+		fonts:   make(map[interface{}]*pdfFont),
+	}
+
+	if err := doc.readXref(); err != nil || doc.trailer == nil || doc.trailer["Root"] == nil {
+		doc.xref = make(map[int]pdfXrefEntry)
+		doc.cache = make(map[int]interface{})
+		doc.trailer = nil
+		if err := doc.reconstructXref(); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func (d *pdfDocument) readXref() error {
+	tail := d.data
+	if len(tail) > 2048 {
+		tail = tail[len(tail)-2048:]
+	}
+	idx := bytes.LastIndex(tail, []byte("startxref"))
+	if idx < 0 {
+		return fmt.Errorf("未找到 startxref")
+	}
+	lex := &pdfLexer{data: tail, pos: idx + len("startxref")}
+	offset, ok := lex.readToken().(int64)
+	if !ok {
+		return fmt.Errorf("startxref 偏移无效")
+	}
+
+	visited := make(map[int64]bool)
+	for offset > 0 && !visited[offset] {
+		visited[offset] = true
+		trailer, err := d.readXrefSection(offset)
+		if err != nil {
+			return err
+		}
+		if d.trailer == nil {
+			d.trailer = trailer
+		}
+		if stm, ok := trailer["XRefStm"].(int64); ok && !visited[stm] {
+			visited[stm] = true
+			if _, err := d.readXrefSection(stm); err != nil {
+				return err
+			}
+		}
+		prev, ok := trailer["Prev"].(int64)
+		if !ok {
+			break
+		}
+		offset = prev
+	}
+	return nil
+}
+
+// readXrefSection 读取一节 xref（表或流），已存在的条目以较新的为准不被覆盖
+func (d *pdfDocument) readXrefSection(offset int64) (pdfDict, error) {
+	if offset < 0 || offset >= int64(len(d.data)) {
+		return nil, fmt.Errorf("xref 偏移越界")
+	}
+	lex := &pdfLexer{data: d.data, pos: int(offset)}
+	lex.skipSpace()
+	if bytes.HasPrefix(d.data[lex.pos:], []byte("xref")) {
+		lex.pos += len("xref")
+		return d.readXrefTable(lex)
+	}
+
+	_, obj, err := d.parseIndirectAt(int(offset))
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := obj.(*pdfStream)
+	if !ok || stream.dict["Type"] != pdfName("XRef") {
+		return nil, fmt.Errorf("xref 流格式无效")
+	}
+	return stream.dict, d.readXrefStream(stream)
+}
+
+func (d *pdfDocument) readXrefTable(lex *pdfLexer) (pdfDict, error) {
+	for {
+		tok := lex.readToken()
+		if kw, ok := tok.(pdfKeyword); ok && kw == "trailer" {
+			trailer, ok := lex.readObject(0).(pdfDict)
+			if !ok {
+				return nil, fmt.Errorf("trailer 格式无效")
+			}
+			return trailer, nil
+		}
+		start, ok1 := tok.(int64)
+		count, ok2 := lex.readToken().(int64)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("xref 表格式无效")
+		}
+		for i := int64(0); i < count; i++ {
+			off, ok1 := lex.readToken().(int64)
+			_, ok2 := lex.readToken().(int64)
+			kind, ok3 := lex.readToken().(pdfKeyword)
+			if !ok1 || !ok2 || !ok3 {
+				return nil, fmt.Errorf("xref 条目格式无效")
+			}
+			num := int(start + i)
+			if _, exists := d.xref[num]; exists || kind != "n" {
+				continue
+			}
+			d.xref[num] = pdfXrefEntry{kind: 1, offset: off}
+		}
+	}
+}
+
+func (d *pdfDocument) readXrefStream(stream *pdfStream) error {
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return err
+	}
+	widthsRaw, _ := stream.dict["W"].([]interface{})
+	if len(widthsRaw) != 3 {
+		return fmt.Errorf("xref 流缺少 W")
+	}
+	widths := make([]int, 3)
+	rowLen := 0
+	for i, w := range widthsRaw {
+		v, _ := w.(int64)
+		widths[i] = int(v)
+		rowLen += int(v)
+	}
+	if rowLen == 0 {
+		return fmt.Errorf("xref 流 W 无效")
+	}
+
+	size, _ := stream.dict["Size"].(int64)
+	index := []int64{0, size}
+	if raw, ok := stream.dict["Index"].([]interface{}); ok && len(raw)%2 == 0 {
+		index = index[:0]
+		for _, v := range raw {
+			n, _ := v.(int64)
+			index = append(index, n)
+		}
+	}
+
+	readField := func(row []byte, field int) int64 {
+		start := 0
+		for i := 0; i < field; i++ {
+			start += widths[i]
+		}
+		var v int64
+		for _, b := range row[start : start+widths[field]] {
+			v = v<<8 | int64(b)
+		}
+		return v
+	}
+
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		for n := int64(0); n < index[i+1]; n++ {
+			if pos+rowLen > len(data) {
+				return nil
+			}
+			row := data[pos : pos+rowLen]
+			pos += rowLen
+			kind := int64(1)
+			if widths[0] > 0 {
+				kind = readField(row, 0)
+			}
+			num := int(index[i] + n)
+			if _, exists := d.xref[num]; exists {
+				continue
+			}
+			switch kind {
+			case 1:
+				d.xref[num] = pdfXrefEntry{kind: 1, offset: readField(row, 1)}
+			case 2:
+				d.xref[num] = pdfXrefEntry{kind: 2, stream: int(readField(row, 1)), index: int(readField(row, 2))}
+			}
+		}
+	}
+	return nil
+}
+
+var pdfObjHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// reconstructXref 在 xref 损坏时扫描全文重建对象表
+func (d *pdfDocument) reconstructXref() error {
+	for _, m := range pdfObjHeader.FindAllSubmatchIndex(d.data, -1) {
+		if m[0] > 0 && !isPDFDelimiterOrSpace(d.data[m[0]-1]) {
+			continue
+		}
+		num, _ := strconv.Atoi(string(d.data[m[2]:m[3]]))
+		d.xref[num] = pdfXrefEntry{kind: 1, offset: int64(m[0])}
+	}
+	if len(d.xref) == 0 {
+		return fmt.Errorf("无法解析 PDF 对象表")
+	}
+
+	if idx := bytes.LastIndex(d.data, []byte("trailer")); idx >= 0 {
+		lex := &pdfLexer{data: d.data, pos: idx + len("trailer")}
+		if trailer, ok := lex.readObject(0).(pdfDict); ok && trailer["Root"] != nil {
+			d.trailer = trailer
+			return nil
+		}
+	}
+
+	nums := make([]int, 0, len(d.xref))
+	for num := range d.xref {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		if dict, ok := d.object(num).(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+			d.trailer = pdfDict{"Root": pdfRef{num: num}}
+			return nil
+		}
+		if stream, ok := d.object(num).(*pdfStream); ok && stream.dict["Type"] == pdfName("XRef") && stream.dict["Root"] != nil {
+			d.trailer = stream.dict
+			return nil
+		}
+	}
+	return fmt.Errorf("未找到 PDF 文档目录")
+}
+
+func (d *pdfDocument) parseIndirectAt(offset int) (int, interface{}, error) {
+	lex := &pdfLexer{data: d.data, pos: offset}
+	num, ok1 := lex.readToken().(int64)
+	_, ok2 := lex.readToken().(int64)
+	kw, ok3 := lex.readToken().(pdfKeyword)
+	if !ok1 || !ok2 || !ok3 || kw != "obj" {
+		return 0, nil, fmt.Errorf("对象头格式无效")
+	}
+	obj := lex.readObject(0)
+	dict, isDict := obj.(pdfDict)
+	if !isDict {
+		return int(num), obj, nil
+	}
+
+	save := lex.pos
+	if kw, ok := lex.readToken().(pdfKeyword); !ok || kw != "stream" {
+		lex.pos = save
+		return int(num), obj, nil
+	}
+	if lex.pos < len(d.data) && d.data[lex.pos] == '\r' {
+		lex.pos++
+	}
+	if lex.pos < len(d.data) && d.data[lex.pos] == '\n' {
+		lex.pos++
+	}
+	start := lex.pos
+
+	length := -1
+	switch v := dict["Length"].(type) {
+	case int64:
+		length = int(v)
+	case pdfRef:
+		if n, ok := d.resolve(v).(int64); ok {
+			length = int(n)
+		}
+	}
+	end := start + length
+	if length < 0 || end > len(d.data) || !bytes.Contains(d.data[end:min(end+32, len(d.data))], []byte("endstream")) {
+		rel := bytes.Index(d.data[start:], []byte("endstream"))
+		if rel < 0 {
+			return int(num), nil, fmt.Errorf("stream 缺少 endstream")
+		}
+		end = start + rel
+		for end > start && (d.data[end-1] == '\n' || d.data[end-1] == '\r') {
+			end--
+		}
+	}
+	return int(num), &pdfStream{dict: dict, raw: d.data[start:end]}, nil
+}
+
+func (d *pdfDocument) object(num int) interface{} {
+	if obj, ok := d.cache[num]; ok {
+		return obj
+	}
+	d.cache[num] = nil // 防止循环引用
+
+	entry, ok := d.xref[num]
+	if !ok {
+		return nil
+	}
+	var obj interface{}
+	switch entry.kind {
+	case 1:
+		if entry.offset >= 0 && entry.offset < int64(len(d.data)) {
+			_, obj, _ = d.parseIndirectAt(int(entry.offset))
+		}
+	case 2:
+		obj = d.objectFromStream(entry.stream, num)
+	}
+	d.cache[num] = obj
+	return obj
+}
+
+func (d *pdfDocument) objectFromStream(streamNum, num int) interface{} {
+	objects, ok := d.objStms[streamNum]
+	if !ok {
+		objects = make(map[int]interface{})
+		d.objStms[streamNum] = objects
+
+		stream, ok := d.object(streamNum).(*pdfStream)
+		if !ok {
+			return nil
+		}
+		data, err := d.decodeStream(stream)
+		if err != nil {
+			return nil
+		}
+		n, _ := stream.dict["N"].(int64)
+		first, _ := stream.dict["First"].(int64)
+		header := &pdfLexer{data: data}
+		for i := int64(0); i < n; i++ {
+			objNum, ok1 := header.readToken().(int64)
+			offset, ok2 := header.readToken().(int64)
+			if !ok1 || !ok2 || int(first+offset) >= len(data) {
+				break
+			}
+			body := &pdfLexer{data: data, pos: int(first + offset)}
+			objects[int(objNum)] = body.readObject(0)
+		}
+	}
+	return objects[num]
+}
+
+func (d *pdfDocument) resolve(v interface{}) interface{} {
+	for i := 0; i < pdfMaxDepth; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = d.object(ref.num)
+	}
+	return nil
+}
+
+func (d *pdfDocument) dict(v interface{}) pdfDict {
+	switch obj := d.resolve(v).(type) {
+	case pdfDict:
+		return obj
+	case *pdfStream:
+		return obj.dict
+	}
+	return nil
+}
+
+// ---------- 过滤器 ----------
+
+func (d *pdfDocument) decodeStream(stream *pdfStream) ([]byte, error) {
+	data := stream.raw
+	filters := make([]pdfName, 0)
+	switch f := d.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = append(filters, f)
+	case []interface{}:
+		for _, item := range f {
+			if name, ok := d.resolve(item).(pdfName); ok {
+				filters = append(filters, name)
+			}
+		}
+	}
+	params := make([]pdfDict, len(filters))
+	switch p := d.resolve(stream.dict["DecodeParms"]).(type) {
+	case pdfDict:
+		if len(params) > 0 {
+			params[0] = p
+		}
+	case []interface{}:
+		for i, item := range p {
+			if i < len(params) {
+				params[i] = d.dict(item)
+			}
+		}
+	}
+
+	for i, filter := range filters {
+		var err error
+		switch filter {
+		case "FlateDecode", "Fl":
+			data, err = inflatePDF(data)
+			if err == nil {
+				data, err = applyPNGPredictor(data, params[i])
+			}
+		case "ASCIIHexDecode", "AHx":
+			data, err = decodeASCIIHex(data)
+		case "ASCII85Decode", "A85":
+			data, err = decodeASCII85(data)
+		default:
+			return nil, fmt.Errorf("不支持的 PDF 过滤器 %s", filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// inflatePDF 解压 Flate 数据；流被截断时尽量返回已解出的部分
+func inflatePDF(data []byte) ([]byte, error) {
+	var reader io.ReadCloser
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err == nil {
+		reader = zr
+	} else {
+		reader = flate.NewReader(bytes.NewReader(data))
+	}
+	defer reader.Close()
+
+	out, err := io.ReadAll(io.LimitReader(reader, pdfMaxStreamSize))
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("Flate 解压失败: %w", err)
+	}
+	return out, nil
+}
+
+func applyPNGPredictor(data []byte, params pdfDict) ([]byte, error) {
+	if params == nil {
+		return data, nil
+	}
+	predictor, _ := params["Predictor"].(int64)
+	if predictor < 10 {
+		return data, nil
+	}
+	columns := int64(1)
+	if v, ok := params["Columns"].(int64); ok && v > 0 {
+		columns = v
+	}
+	colors := int64(1)
+	if v, ok := params["Colors"].(int64); ok && v > 0 {
+		colors = v
+	}
+	bpc := int64(8)
+	if v, ok := params["BitsPerComponent"].(int64); ok && v > 0 {
+		bpc = v
+	}
+	bpp := int((colors*bpc + 7) / 8)
+	rowLen := int((columns*colors*bpc + 7) / 8)
+
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for pos := 0; pos+rowLen+1 <= len(data); pos += rowLen + 1 {
+		kind := data[pos]
+		row := append([]byte(nil), data[pos+1:pos+1+rowLen]...)
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up := prev[i]
+			switch kind {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p-int(a)), absInt(p-int(b)), absInt(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	default:
+		return c
+	}
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func decodeASCIIHex(data []byte) ([]byte, error) {
+	clean := make([]byte, 0, len(data))
+	for _, b := range data {
+		if b == '>' {
+			break
+		}
+		if isPDFSpace(b) {
+			continue
+		}
+		clean = append(clean, b)
+	}
+	if len(clean)%2 == 1 {
+		clean = append(clean, '0')
+	}
+	out := make([]byte, hex.DecodedLen(len(clean)))
+	_, err := hex.Decode(out, clean)
+	return out, err
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if idx := bytes.Index(data, []byte("~>")); idx >= 0 {
+		data = data[:idx]
+	}
+	out := make([]byte, len(data))
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
+
+// ---------- 页面与内容流 ----------
+
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+func (d *pdfDocument) pages() ([]pdfPage, error) {
+	root := d.dict(d.trailer["Root"])
+	if root == nil {
+		return nil, fmt.Errorf("PDF 缺少文档目录")
+	}
+	pages := make([]pdfPage, 0)
+	visited := make(map[interface{}]bool)
+
+	var walk func(node interface{}, inherited pdfDict, depth int)
+	walk = func(node interface{}, inherited pdfDict, depth int) {
+		if depth > pdfMaxDepth {
+			return
+		}
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref] {
+				return
+			}
+			visited[ref] = true
+		}
+		dict := d.dict(node)
+		if dict == nil {
+			return
+		}
+		resources := inherited
+		if res := d.dict(dict["Resources"]); res != nil {
+			resources = res
+		}
+		kids, hasKids := d.resolve(dict["Kids"]).([]interface{})
+		if dict["Type"] == pdfName("Pages") || (hasKids && dict["Type"] != pdfName("Page")) {
+			for _, kid := range kids {
+				walk(kid, resources, depth+1)
+			}
+			return
+		}
+		pages = append(pages, pdfPage{dict: dict, resources: resources})
+	}
+	walk(root["Pages"], nil, 0)
+
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("PDF 中没有页面")
+	}
+	return pages, nil
+}
+
+func (d *pdfDocument) pageText(page pdfPage) string {
+	var content []byte
+	switch v := d.resolve(page.dict["Contents"]).(type) {
+	case *pdfStream:
+		content, _ = d.decodeStream(v)
+	case []interface{}:
+		for _, item := range v {
+			if stream, ok := d.resolve(item).(*pdfStream); ok {
+				if data, err := d.decodeStream(stream); err == nil {
+					content = append(content, data...)
+					content = append(content, '\n')
+				}
+			}
+		}
+	}
+	w := &pdfTextWriter{}
+	d.runContent(content, page.resources, w, 0)
+	return w.String()
+}
+
+type pdfTextWriter struct {
+	builder        strings.Builder
+	lastY          float64
+	hasY           bool
+	pendingNewline bool
+	pendingSpace   bool
+	lastRune       rune
+}
+
+func (w *pdfTextWriter) write(text string, y float64) {
+	if text == "" {
+		return
+	}
+	if w.builder.Len() > 0 {
+		if w.pendingNewline || (w.hasY && math.Abs(y-w.lastY) > 1) {
+			if w.lastRune != '\n' {
+				w.builder.WriteByte('\n')
+				w.lastRune = '\n'
+			}
+		} else if w.pendingSpace && w.lastRune != ' ' && w.lastRune != '\n' {
+			first := []rune(text)[0]
+			if !isCJK(first) && !isCJK(w.lastRune) && first != ' ' {
+				w.builder.WriteByte(' ')
+				w.lastRune = ' '
+			}
+		}
+	}
+	w.builder.WriteString(text)
+	runes := []rune(text)
+	w.lastRune = runes[len(runes)-1]
+	w.lastY, w.hasY = y, true
+	w.pendingNewline, w.pendingSpace = false, false
+}
+
+func (w *pdfTextWriter) String() string {
+	lines := strings.Split(w.builder.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (d *pdfDocument) runContent(content []byte, resources pdfDict, w *pdfTextWriter, depth int) {
+	if depth > pdfMaxFormDepth {
+		return
+	}
+	lex := &pdfLexer{data: content}
+	operands := make([]interface{}, 0, 8)
+	var font *pdfFont
+	var lineY, leading float64
+
+	fontResources := d.dict(resources["Font"])
+	xobjects := d.dict(resources["XObject"])
+
+	for {
+		tok := lex.readObject(0)
+		if tok == nil && lex.pos >= len(lex.data) {
+			return
+		}
+		op, isOp := tok.(pdfKeyword)
+		if !isOp {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch op {
+		case "BT":
+			lineY = 0
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[0].(pdfName); ok && fontResources != nil {
+					font = d.font(fontResources[string(name)])
+				}
+			}
+		case "TL":
+			if len(operands) >= 1 {
+				leading = pdfNumber(operands[0])
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				tx, ty := pdfNumber(operands[0]), pdfNumber(operands[1])
+				lineY += ty
+				if op == "TD" {
+					leading = -ty
+				}
+				if ty == 0 && tx > 0 {
+					w.pendingSpace = true
+				}
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				lineY = pdfNumber(operands[5])
+			}
+		case "T*":
+			lineY -= leading
+			w.pendingNewline = true
+		case "Tj":
+			if len(operands) >= 1 {
+				w.write(d.decodeText(font, operands[0]), lineY)
+			}
+		case "'", "\"":
+			lineY -= leading
+			w.pendingNewline = true
+			if len(operands) >= 1 {
+				w.write(d.decodeText(font, operands[len(operands)-1]), lineY)
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				if items, ok := operands[0].([]interface{}); ok {
+					for _, item := range items {
+						if _, isStr := item.([]byte); isStr {
+							w.write(d.decodeText(font, item), lineY)
+							continue
+						}
+						if pdfNumber(item) < -250 {
+							w.pendingSpace = true
+						}
+					}
+				}
+			}
+		case "Do":
+			if len(operands) >= 1 && xobjects != nil {
+				if name, ok := operands[0].(pdfName); ok {
+					if form, ok := d.resolve(xobjects[string(name)]).(*pdfStream); ok && form.dict["Subtype"] == pdfName("Form") {
+						formResources := d.dict(form.dict["Resources"])
+						if formResources == nil {
+							formResources = resources
+						}
+						if data, err := d.decodeStream(form); err == nil {
+							d.runContent(data, formResources, w, depth+1)
+						}
+					}
+				}
+			}
+		case "ID":
+			lex.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+func pdfNumber(v interface{}) float64 {
+	switch n := v.(type) {
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+// ---------- 字体与编码 ----------
+
+type pdfFont struct {
+	composite bool
+	utf16     bool
+	cmap      *pdfCMap
+	simple    [256]rune
+}
+
+func (d *pdfDocument) font(ref interface{}) *pdfFont {
+	key := ref
+	if _, isRef := ref.(pdfRef); !isRef {
+		key = fmt.Sprintf("%p", d.dict(ref))
+	}
+	if f, ok := d.fonts[key]; ok {
+		return f
+	}
+
+	dict := d.dict(ref)
+	f := &pdfFont{}
+	d.fonts[key] = f
+	if dict == nil {
+		return f
+	}
+
+	if dict["Subtype"] == pdfName("Type0") {
+		f.composite = true
+		if enc, ok := d.resolve(dict["Encoding"]).(pdfName); ok {
+			name := string(enc)
+			f.utf16 = strings.Contains(name, "UCS2") || strings.Contains(name, "UTF16")
+		}
+	} else {
+		f.simple = d.simpleEncoding(dict)
+	}
+
+	if stream, ok := d.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.decodeStream(stream); err == nil {
+			f.cmap = parseCMap(data)
+		}
+	}
+	return f
+}
+
+func (d *pdfDocument) simpleEncoding(font pdfDict) [256]rune {
+	var table [256]rune
+	base := "StandardEncoding"
+	var differences []interface{}
+
+	switch enc := d.resolve(font["Encoding"]).(type) {
+	case pdfName:
+		base = string(enc)
+	case pdfDict:
+		if b, ok := d.resolve(enc["BaseEncoding"]).(pdfName); ok {
+			base = string(b)
+		}
+		differences, _ = d.resolve(enc["Differences"]).([]interface{})
+	}
+
+	for i := 0x20; i < 0x7f; i++ {
+		table[i] = rune(i)
+	}
+	switch base {
+	case "WinAnsiEncoding":
+		for i := 0xa0; i <= 0xff; i++ {
+			table[i] = rune(i)
+		}
+		for code, r := range winAnsiHigh {
+			table[code] = r
+		}
+	case "MacRomanEncoding":
+		for code, r := range macRomanHigh {
+			table[code] = r
+		}
+	default:
+		table['\''] = '’'
+		table['`'] = '‘'
+	}
+
+	code := 0
+	for _, item := range differences {
+		switch v := item.(type) {
+		case int64:
+			code = int(v)
+		case pdfName:
+			if code >= 0 && code < 256 {
+				if r, ok := glyphNameToRune(string(v)); ok {
+					table[code] = r
+				}
+			}
+			code++
+		}
+	}
+	return table
+}
+
+// decodeText 把字符串操作数按当前字体解码为 Unicode 文本
+func (d *pdfDocument) decodeText(font *pdfFont, operand interface{}) string {
+	raw, ok := operand.([]byte)
+	if !ok || len(raw) == 0 {
+		return ""
+	}
+	if font == nil {
+		font = &pdfFont{}
+		for i := 0x20; i < 0x7f; i++ {
+			font.simple[i] = rune(i)
+		}
+	}
+
+	var builder strings.Builder
+	if font.cmap != nil {
+		defaultWidth := 1
+		if font.composite {
+			defaultWidth = 2
+		}
+		for i := 0; i < len(raw); {
+			text, width := font.cmap.lookup(raw[i:], defaultWidth)
+			if text == "" && !font.composite && int(raw[i]) < len(font.simple) && font.simple[raw[i]] != 0 {
+				text = string(font.simple[raw[i]])
+			}
+			builder.WriteString(text)
+			i += width
+		}
+		return builder.String()
+	}
+
+	if font.composite {
+		if font.utf16 {
+			return decodeUTF16BE(raw)
+		}
+		// Identity 编码且缺少 ToUnicode 时无法还原字符
+		return ""
+	}
+
+	for _, b := range raw {
+		if r := font.simple[b]; r != 0 {
+			builder.WriteRune(r)
+		}
+	}
+	return builder.String()
+}
+
+func decodeUTF16BE(raw []byte) string {
+	units := make([]uint16, 0, len(raw)/2)
+	for i := 0; i+1 < len(raw); i += 2 {
+		units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+type pdfCMapRange struct {
+	lo, hi uint32
+	width  int
+	base   []rune
+	values []string
+}
+
+type pdfCMap struct {
+	codespaces []pdfCodespace
+	chars      map[uint64]string
+	ranges     []pdfCMapRange
+}
+
+type pdfCodespace struct {
+	lo, hi uint32
+	width  int
+}
+
+// parseCMap 解析 ToUnicode CMap 中的 codespacerange、bfchar 与 bfrange
+func parseCMap(data []byte) *pdfCMap {
+	cmap := &pdfCMap{chars: make(map[uint64]string)}
+	lex := &pdfLexer{data: data}
+	operands := make([]interface{}, 0, 16)
+
+	for {
+		tok := lex.readObject(0)
+		if tok == nil && lex.pos >= len(lex.data) {
+			break
+		}
+		kw, isKw := tok.(pdfKeyword)
+		if !isKw {
+			operands = append(operands, tok)
+			continue
+		}
+		switch kw {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].([]byte)
+				hi, ok2 := operands[i+1].([]byte)
+				if ok1 && ok2 && len(lo) > 0 && len(lo) <= 4 {
+					cmap.codespaces = append(cmap.codespaces, pdfCodespace{lo: bytesToCode(lo), hi: bytesToCode(hi), width: len(lo)})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok := operands[i].([]byte)
+				if !ok || len(src) == 0 || len(src) > 4 {
+					continue
+				}
+				cmap.chars[cmapKey(bytesToCode(src), len(src))] = cmapTarget(operands[i+1])
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].([]byte)
+				hi, ok2 := operands[i+1].([]byte)
+				if !ok1 || !ok2 || len(lo) == 0 || len(lo) > 4 {
+					continue
+				}
+				r := pdfCMapRange{lo: bytesToCode(lo), hi: bytesToCode(hi), width: len(lo)}
+				switch dst := operands[i+2].(type) {
+				case []byte:
+					r.base = []rune(decodeUTF16BE(dst))
+				case []interface{}:
+					for _, item := range dst {
+						r.values = append(r.values, cmapTarget(item))
+					}
+				}
+				cmap.ranges = append(cmap.ranges, r)
+			}
+		}
+		if strings.HasPrefix(string(kw), "end") || strings.HasPrefix(string(kw), "begin") {
+			operands = operands[:0]
+		}
+	}
+	return cmap
+}
+
+func cmapTarget(v interface{}) string {
+	switch t := v.(type) {
+	case []byte:
+		return decodeUTF16BE(t)
+	case pdfName:
+		if r, ok := glyphNameToRune(string(t)); ok {
+			return string(r)
+		}
+	}
+	return ""
+}
+
+func cmapKey(code uint32, width int) uint64 {
+	return uint64(width)<<32 | uint64(code)
+}
+
+func bytesToCode(b []byte) uint32 {
+	var v uint32
+	for _, x := range b {
+		v = v<<8 | uint32(x)
+	}
+	return v
+}
+
+// lookup 从 raw 开头按码空间宽度匹配一个字符码，返回映射文本与消耗的字节数
+func (m *pdfCMap) lookup(raw []byte, defaultWidth int) (string, int) {
+	widths := make([]int, 0, 4)
+	for _, cs := range m.codespaces {
+		if cs.width > len(raw) {
+			continue
+		}
+		code := bytesToCode(raw[:cs.width])
+		if code >= cs.lo && code <= cs.hi {
+			widths = append(widths, cs.width)
+		}
+	}
+	if len(widths) == 0 {
+		widths = append(widths, defaultWidth)
+	}
+
+	for _, width := range widths {
+		if width > len(raw) {
+			width = len(raw)
+		}
+		code := bytesToCode(raw[:width])
+		if text, ok := m.chars[cmapKey(code, width)]; ok {
+			return text, width
+		}
+		for _, r := range m.ranges {
+			if r.width != width || code < r.lo || code > r.hi {
+				continue
+			}
+			offset := int(code - r.lo)
+			if r.values != nil {
+				if offset < len(r.values) {
+					return r.values[offset], width
+				}
+				continue
+			}
+			if len(r.base) == 0 {
+				continue
+			}
+			out := append([]rune(nil), r.base...)
+			out[len(out)-1] += rune(offset)
+			return string(out), width
+		}
+	}
+
+	width := widths[0]
+	if width > len(raw) {
+		width = len(raw)
+	}
+	return "", width
+}
+
+var winAnsiHigh = map[int]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+	0x88: 'ˆ', 0x89: '‰', 0x8a: 'Š', 0x8b: '‹', 0x8c: 'Œ', 0x8e: 'Ž',
+	0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—',
+	0x98: '˜', 0x99: '™', 0x9a: 'š', 0x9b: '›', 0x9c: 'œ', 0x9e: 'ž', 0x9f: 'Ÿ',
+}
+
+var macRomanHigh = map[int]rune{
+	0xa5: '•', 0xd0: '–', 0xd1: '—', 0xd2: '“', 0xd3: '”', 0xd4: '‘', 0xd5: '’', 0xc9: '…',
+}
+
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$',
+	"percent": '%', "ampersand": '&', "quotesingle": '\'', "parenleft": '(', "parenright": ')',
+	"asterisk": '*', "plus": '+', "comma": ',', "hyphen": '-', "period": '.', "slash": '/',
+	"zero": '0', "one": '1', "two": '2', "three": '3', "four": '4', "five": '5', "six": '6',
+	"seven": '7', "eight": '8', "nine": '9', "colon": ':', "semicolon": ';', "less": '<',
+	"equal": '=', "greater": '>', "question": '?', "at": '@', "bracketleft": '[',
+	"backslash": '\\', "bracketright": ']', "asciicircum": '^', "underscore": '_', "grave": '`',
+	"braceleft": '{', "bar": '|', "braceright": '}', "asciitilde": '~', "bullet": '•',
+	"endash": '–', "emdash": '—', "quoteleft": '‘', "quoteright": '’', "quotedblleft": '“',
+	"quotedblright": '”', "ellipsis": '…', "fi": 'ﬁ', "fl": 'ﬂ', "minus": '−', "degree": '°',
+	"multiply": '×', "divide": '÷', "plusminus": '±', "copyright": '©', "registered": '®',
+	"trademark": '™', "section": '§', "paragraph": '¶', "dagger": '†', "daggerdbl": '‡',
+	"nbspace": ' ', "periodcentered": '·', "alpha": 'α', "beta": 'β', "gamma": 'γ',
+	"delta": 'δ', "epsilon": 'ε', "lambda": 'λ', "mu": 'μ', "pi": 'π', "sigma": 'σ',
+	"theta": 'θ', "omega": 'ω', "Delta": 'Δ', "Sigma": 'Σ', "Omega": 'Ω',
+}
+
+func glyphNameToRune(name string) (rune, bool) {
+	if idx := strings.IndexByte(name, '.'); idx > 0 {
+		name = name[:idx]
+	}
+	if r, ok := glyphNames[name]; ok {
+		return r, true
+	}
+	if len(name) == 1 && unicode.IsLetter(rune(name[0])) {
+		return rune(name[0]), true
+	}
+	if strings.HasPrefix(name, "uni") && len(name) >= 7 {
+		if v, err := strconv.ParseUint(name[3:7], 16, 32); err == nil {
+			return rune(v), true
+		}
+	}
+	if strings.HasPrefix(name, "u") && len(name) >= 5 && len(name) <= 7 {
+		if v, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+			return rune(v), true
+		}
+	}
+	return 0, false
+}
+
+// ---------- 词法分析 ----------
+
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(b byte) bool {
+	switch b {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isPDFDelimiter(b byte) bool {
+	switch b {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func isPDFDelimiterOrSpace(b byte) bool {
+	return isPDFSpace(b) || isPDFDelimiter(b)
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		if isPDFSpace(b) {
+			l.pos++
+			continue
+		}
+		if b == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// readToken 读取一个基本词法单元：数字、名字、字符串、关键字或 [ ] << >> 分隔符
+func (l *pdfLexer) readToken() interface{} {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil
+	}
+	b := l.data[l.pos]
+	switch {
+	case b == '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.data) && !isPDFDelimiterOrSpace(l.data[l.pos]) {
+			l.pos++
+		}
+		return pdfName(decodeNameEscapes(l.data[start:l.pos]))
+	case b == '(':
+		return l.readLiteralString()
+	case b == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<")
+		}
+		return l.readHexString()
+	case b == '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return pdfKeyword(">>")
+		}
+		l.pos++
+		return pdfKeyword(">")
+	case b == '[' || b == ']' || b == '{' || b == '}' || b == ')':
+		l.pos++
+		return pdfKeyword(string(b))
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFDelimiterOrSpace(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if word == "" {
+		l.pos++
+		return pdfKeyword(string(b))
+	}
+	if n, err := strconv.ParseInt(word, 10, 64); err == nil {
+		return n
+	}
+	if (word[0] >= '0' && word[0] <= '9') || word[0] == '-' || word[0] == '+' || word[0] == '.' {
+		if f, err := strconv.ParseFloat(word, 64); err == nil {
+			return f
+		}
+	}
+	return pdfKeyword(word)
+}
+
+// readObject 读取一个完整对象；数组、字典与间接引用 "n g R" 会被组装
+func (l *pdfLexer) readObject(depth int) interface{} {
+	tok := l.readToken()
+	if depth > pdfMaxDepth {
+		return tok
+	}
+	switch t := tok.(type) {
+	case pdfKeyword:
+		switch t {
+		case "[":
+			arr := make([]interface{}, 0)
+			for {
+				save := l.pos
+				next := l.readToken()
+				if next == nil {
+					return arr
+				}
+				if kw, ok := next.(pdfKeyword); ok && kw == "]" {
+					return arr
+				}
+				l.pos = save
+				arr = append(arr, l.readObject(depth+1))
+			}
+		case "<<":
+			dict := make(pdfDict)
+			for {
+				key := l.readToken()
+				if key == nil {
+					return dict
+				}
+				if kw, ok := key.(pdfKeyword); ok && kw == ">>" {
+					return dict
+				}
+				name, ok := key.(pdfName)
+				if !ok {
+					continue
+				}
+				dict[string(name)] = l.readObject(depth + 1)
+			}
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return t
+	case int64:
+		save := l.pos
+		gen, ok := l.readToken().(int64)
+		if ok {
+			if kw, ok := l.readToken().(pdfKeyword); ok && kw == "R" {
+				return pdfRef{num: int(t), gen: int(gen)}
+			}
+		}
+		l.pos = save
+		return t
+	}
+	return tok
+}
+
+func (l *pdfLexer) readLiteralString() []byte {
+	l.pos++ // (
+	out := make([]byte, 0, 32)
+	depth := 1
+	for l.pos < len(l.data) {
+		b := l.data[l.pos]
+		l.pos++
+		switch b {
+		case '(':
+			depth++
+			out = append(out, b)
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+			out = append(out, b)
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+		default:
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func (l *pdfLexer) readHexString() []byte {
+	l.pos++ // <
+	end := bytes.IndexByte(l.data[l.pos:], '>')
+	if end < 0 {
+		end = len(l.data) - l.pos
+	}
+	raw := l.data[l.pos : l.pos+end]
+	l.pos += end + 1
+	out, _ := decodeASCIIHex(raw)
+	return out
+}
+
+// skipInlineImage 跳过 ID 与 EI 之间的内联图像二进制数据
+func (l *pdfLexer) skipInlineImage() {
+	if l.pos < len(l.data) && isPDFSpace(l.data[l.pos]) {
+		l.pos++
+	}
+	for i := l.pos; i+1 < len(l.data); i++ {
+		if l.data[i] == 'E' && l.data[i+1] == 'I' &&
+			(i == 0 || isPDFSpace(l.data[i-1])) &&
+			(i+2 >= len(l.data) || isPDFDelimiterOrSpace(l.data[i+2])) {
+			l.pos = i + 2
+			return
+		}
+	}
+	l.pos = len(l.data)
+}
+
+func decodeNameEscapes(raw []byte) string {
+	if bytes.IndexByte(raw, '#') < 0 {
+		return string(raw)
+	}
+	out := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if v, err := strconv.ParseUint(string(raw[i+1:i+3]), 16, 8); err == nil {
+				out = append(out, byte(v))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, raw[i])
+	}
+	return string(out)
+}
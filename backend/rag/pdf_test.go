@@ -0,0 +1,119 @@
+package rag
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildTestPDF 按对象顺序拼出 PDF 并生成正确偏移的 xref 表；objects[i] 为第 i+1 号对象的主体
+func buildTestPDF(objects []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, body := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func flateStream(content string) string {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte(content))
+	zw.Close()
+	return fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", buf.Len(), buf.String())
+}
+
+func plainStream(content string) string {
+	return fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content)
+}
+
+func testPDFObjects() []string {
+	cmap := `/CIDInit /ProcSet findresource begin
+begincmap
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0001> <6570>
+<0002> <636E>
+endbfchar
+1 beginbfrange
+<0003> <0004> <5E93>
+endbfrange
+endcmap`
+	// bfrange 把 0003、0004 依次映射到 U+5E93（库）、U+5E94（应）
+	return []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 7 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents [8 0 R 9 0 R] >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type0 /BaseFont /SimSun /Encoding /Identity-H /ToUnicode 10 0 R >>",
+		flateStream("BT /F1 12 Tf 72 720 Td (Binary search) Tj 0 -14 Td [(runs in O) 120 (\\(log n\\))] TJ ET"),
+		flateStream("BT /F2 12 Tf 72 720 Td <00010002> Tj ET"),
+		plainStream("BT /F2 12 Tf 1 0 0 1 72 700 Tm <00030004> Tj /F1 12 Tf ( intro) Tj ET"),
+		flateStream(cmap),
+	}
+}
+
+func TestExtractPDFPages(t *testing.T) {
+	pages, err := ExtractPDFPages(buildTestPDF(testPDFObjects()))
+	if err != nil {
+		t.Fatalf("ExtractPDFPages: %v", err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("expected 2 pages, got %d", len(pages))
+	}
+	if pages[0] != "Binary search\nruns in O(log n)" {
+		t.Fatalf("unexpected page 1 text: %q", pages[0])
+	}
+	if pages[1] != "数据\n库应 intro" {
+		t.Fatalf("unexpected page 2 text: %q", pages[1])
+	}
+}
+
+func TestExtractPDFRebuildsBrokenXref(t *testing.T) {
+	data := buildTestPDF(testPDFObjects())
+	idx := bytes.LastIndex(data, []byte("startxref"))
+	data = append(data[:idx:idx], []byte("startxref\n999999\n%%EOF\n")...)
+
+	pages, err := ExtractPDFPages(data)
+	if err != nil {
+		t.Fatalf("ExtractPDFPages: %v", err)
+	}
+	if len(pages) != 2 || !strings.Contains(pages[1], "数据") {
+		t.Fatalf("unexpected pages after xref rebuild: %q", pages)
+	}
+}
+
+func TestExtractSegmentsKeepsPDFPageNumbers(t *testing.T) {
+	objects := testPDFObjects()
+	objects[6] = flateStream("")
+
+	segments, err := ExtractSegments("lecture.pdf", bytes.NewReader(buildTestPDF(objects)))
+	if err != nil {
+		t.Fatalf("ExtractSegments: %v", err)
+	}
+	if len(segments) != 1 || segments[0].Meta.Page != 2 {
+		t.Fatalf("expected only page 2 to carry text, got %+v", segments)
+	}
+
+	chunks := ChunkSegments(segments, 600, 80)
+	if len(chunks) != 1 || chunks[0].Meta.Label() != "p. 2" {
+		t.Fatalf("unexpected chunks: %+v", chunks)
+	}
+	if meta := DecodeChunkMeta(chunks[0].Meta.Encode()); meta.Page != 2 {
+		t.Fatalf("chunk meta round trip failed: %+v", meta)
+	}
+}
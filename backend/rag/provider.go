@@ -0,0 +1,146 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// 支持的模型提供方，别名由 NormalizeProvider 归一
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderDashScope = "dashscope"
+)
+
+// ErrEmbeddingUnsupported 提供方没有向量接口且未配置替代的向量模型
+var ErrEmbeddingUnsupported = errors.New("embedding is not supported by this provider")
+
+// ChatModel 对话模型：一次性补全与流式补全
+type ChatModel interface {
+	Chat(ctx context.Context, messages []ChatMessage) (string, error)
+	// ChatStream 在收到每段增量时调用 onDelta 并返回完整回答；
+	// ctx 取消或 onDelta 返回错误时中止上游请求
+	ChatStream(ctx context.Context, messages []ChatMessage, onDelta func(string) error) (string, error)
+}
+
+// Embedder 文本向量化，ModelName 用于按模型区分已入库的向量与缓存
+type Embedder interface {
+	// Embed 的 ctx 取消时中止上游请求
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	ModelName() string
+}
+
+// Provider 大模型提供方，同时提供对话与向量化能力
+type Provider interface {
+	ChatModel
+	Embedder
+	Name() string
+}
+
+// ProviderConfig 构造 Provider 所需的配置，字段为空时使用各提供方的默认值
+type ProviderConfig struct {
+	Provider           string
+	APIKey             string
+	BaseURL            string
+	LLMModel           string
+	EmbeddingModel     string
+	EmbeddingBatchSize int
+	// EmbeddingAPIKey / EmbeddingBaseURL 用于没有向量接口的提供方（Anthropic），
+	// 向量化改走 OpenAI 兼容接口；为空时该提供方不支持向量化
+	EmbeddingAPIKey  string
+	EmbeddingBaseURL string
+	// OnUsage 接收该 Provider 每次对话与向量化调用的用量，可为空
+	OnUsage UsageFunc
+	// Fallbacks 主提供方失败时按顺序改用的备用配置，OnUsage 为空时沿用主配置的
+	Fallbacks []ProviderConfig
+}
+
+// NormalizeProvider 把配置中的提供方名称（含别名）归一为 ProviderOpenAI / ProviderAnthropic / ProviderDashScope，
+// 未识别的名称（openrouter 等）都按 OpenAI 兼容接口处理
+func NormalizeProvider(name string) string {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "aliyun", "ali", "alibaba", "dashscope", "bailian":
+		return ProviderDashScope
+	case "anthropic", "claude":
+		return ProviderAnthropic
+	default:
+		return ProviderOpenAI
+	}
+}
+
+// NewProvider 按 cfg.Provider 选择实现，配置了 Fallbacks 时返回按顺序切换的 FailoverProvider
+func NewProvider(cfg ProviderConfig) Provider {
+	if len(cfg.Fallbacks) == 0 {
+		return newProvider(cfg)
+	}
+	providers := []Provider{newProvider(cfg)}
+	for _, fallback := range cfg.Fallbacks {
+		if fallback.OnUsage == nil {
+			fallback.OnUsage = cfg.OnUsage
+		}
+		providers = append(providers, newProvider(fallback))
+	}
+	return &FailoverProvider{Providers: providers}
+}
+
+func newProvider(cfg ProviderConfig) Provider {
+	switch NormalizeProvider(cfg.Provider) {
+	case ProviderDashScope:
+		return &DashScopeProvider{
+			APIKey:         cfg.APIKey,
+			BaseURL:        cfg.BaseURL,
+			Model:          cfg.LLMModel,
+			EmbeddingModel: cfg.EmbeddingModel,
+			BatchSize:      cfg.EmbeddingBatchSize,
+			OnUsage:        cfg.OnUsage,
+		}
+	case ProviderAnthropic:
+		provider := &AnthropicProvider{APIKey: cfg.APIKey, BaseURL: cfg.BaseURL, Model: cfg.LLMModel, OnUsage: cfg.OnUsage}
+		if strings.TrimSpace(cfg.EmbeddingAPIKey) != "" {
+			provider.Embedder = &EmbedClient{
+				APIKey:    cfg.EmbeddingAPIKey,
+				BaseURL:   cfg.EmbeddingBaseURL,
+				Model:     cfg.EmbeddingModel,
+				BatchSize: cfg.EmbeddingBatchSize,
+				OnUsage:   cfg.OnUsage,
+			}
+		}
+		return provider
+	default:
+		return &OpenAIProvider{
+			Generator: &GenClient{APIKey: cfg.APIKey, BaseURL: cfg.BaseURL, Model: cfg.LLMModel, OnUsage: cfg.OnUsage},
+			Embedder: &EmbedClient{
+				APIKey:    cfg.APIKey,
+				BaseURL:   cfg.BaseURL,
+				Model:     cfg.EmbeddingModel,
+				BatchSize: cfg.EmbeddingBatchSize,
+				OnUsage:   cfg.OnUsage,
+			},
+		}
+	}
+}
+
+// OpenAIProvider OpenAI 兼容接口（OpenAI、OpenRouter 等）的 /chat/completions 与 /embeddings
+type OpenAIProvider struct {
+	Generator *GenClient
+	Embedder  *EmbedClient
+}
+
+func (p *OpenAIProvider) Name() string { return ProviderOpenAI }
+
+func (p *OpenAIProvider) Chat(ctx context.Context, messages []ChatMessage) (string, error) {
+	return p.Generator.Chat(ctx, messages)
+}
+
+func (p *OpenAIProvider) ChatStream(ctx context.Context, messages []ChatMessage, onDelta func(string) error) (string, error) {
+	return p.Generator.ChatStream(ctx, messages, onDelta)
+}
+
+func (p *OpenAIProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return p.Embedder.Embed(ctx, texts)
+}
+
+func (p *OpenAIProvider) ModelName() string {
+	return p.Embedder.ModelName()
+}
@@ -0,0 +1,131 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewProviderSelectsImplementation(t *testing.T) {
+	cases := map[string]string{
+		"":           ProviderOpenAI,
+		"openrouter": ProviderOpenAI,
+		"bailian":    ProviderDashScope,
+		"Anthropic":  ProviderAnthropic,
+	}
+	for name, want := range cases {
+		if got := NewProvider(ProviderConfig{Provider: name}).Name(); got != want {
+			t.Fatalf("NewProvider(%q).Name() = %q, want %q", name, got, want)
+		}
+	}
+
+	anthropic := NewProvider(ProviderConfig{Provider: "anthropic", APIKey: "key"})
+	if _, err := anthropic.Embed(context.Background(), []string{"栈"}); !errors.Is(err, ErrEmbeddingUnsupported) {
+		t.Fatalf("expected ErrEmbeddingUnsupported without embedding key, got %v", err)
+	}
+	anthropic = NewProvider(ProviderConfig{Provider: "anthropic", APIKey: "key", EmbeddingAPIKey: "openai", EmbeddingModel: "embed-small"})
+	if anthropic.ModelName() != "embed-small" {
+		t.Fatalf("expected anthropic to borrow the OpenAI embedder, got %q", anthropic.ModelName())
+	}
+}
+
+func TestAnthropicProviderChatAndStream(t *testing.T) {
+	var captured anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" || r.Header.Get("x-api-key") != "test-key" || r.Header.Get("anthropic-version") == "" {
+			t.Errorf("unexpected request: %s %v", r.URL.Path, r.Header)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&captured)
+		if captured.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "event: message_start\ndata: {\"type\":\"message_start\"}\n\n")
+			for _, delta := range []string{"栈是", "后进先出的。"} {
+				fmt.Fprintf(w, "event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":%q}}\n\n", delta)
+			}
+			fmt.Fprint(w, "event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n")
+			return
+		}
+		fmt.Fprint(w, `{"content":[{"type":"text","text":"栈是后进先出的。"}]}`)
+	}))
+	defer server.Close()
+
+	provider := &AnthropicProvider{APIKey: "test-key", BaseURL: server.URL, Model: "test-model"}
+	history := []ChatMessage{
+		{Role: "system", Content: "只依据资料回答"},
+		{Role: "user", Content: "什么是栈？"},
+		{Role: "user", Content: "简短回答"},
+	}
+	answer, err := provider.Chat(context.Background(), history)
+	if err != nil || answer != "栈是后进先出的。" {
+		t.Fatalf("Chat = %q, %v", answer, err)
+	}
+	if captured.System != "只依据资料回答" || len(captured.Messages) != 1 || captured.Messages[0].Content != "什么是栈？\n\n简短回答" {
+		t.Fatalf("expected system prompt lifted and user turns merged, got %+v", captured)
+	}
+
+	var deltas []string
+	answer, err = provider.ChatStream(context.Background(), history, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil || answer != "栈是后进先出的。" || len(deltas) != 2 {
+		t.Fatalf("ChatStream = %q (%q), %v", answer, deltas, err)
+	}
+}
+
+func TestDashScopeProviderChatStreamAndEmbed(t *testing.T) {
+	var embedCalls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/services/aigc/text-generation/generation":
+			if r.Header.Get("X-DashScope-SSE") == "enable" {
+				fmt.Fprint(w, "id:1\nevent:result\n:HTTP_STATUS/200\ndata:{\"output\":{\"choices\":[{\"message\":{\"role\":\"assistant\",\"content\":\"队列\"}}]}}\n\n")
+				fmt.Fprint(w, "id:2\nevent:result\n:HTTP_STATUS/200\ndata:{\"output\":{\"choices\":[{\"message\":{\"role\":\"assistant\",\"content\":\"先进先出。\"}}]}}\n\n")
+				return
+			}
+			fmt.Fprint(w, `{"output":{"choices":[{"message":{"role":"assistant","content":"队列先进先出。"}}]}}`)
+		case "/services/embeddings/text-embedding/text-embedding":
+			embedCalls++
+			var req dashScopeEmbeddingRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			embeddings := make([]map[string]any, 0, len(req.Input.Texts))
+			for i := len(req.Input.Texts) - 1; i >= 0; i-- {
+				embeddings = append(embeddings, map[string]any{"text_index": i, "embedding": []float32{float32(i), 1}})
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"output": map[string]any{"embeddings": embeddings}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"code":"NotFound","message":"unknown path"}`)
+		}
+	}))
+	defer server.Close()
+
+	provider := &DashScopeProvider{APIKey: "test-key", BaseURL: server.URL}
+	messages := []ChatMessage{{Role: "user", Content: "什么是队列？"}}
+	if answer, err := provider.Chat(context.Background(), messages); err != nil || answer != "队列先进先出。" {
+		t.Fatalf("Chat = %q, %v", answer, err)
+	}
+	answer, err := provider.ChatStream(context.Background(), messages, func(string) error { return nil })
+	if err != nil || answer != "队列先进先出。" {
+		t.Fatalf("ChatStream = %q, %v", answer, err)
+	}
+
+	texts := make([]string, 12)
+	for i := range texts {
+		texts[i] = fmt.Sprintf("片段%d", i)
+	}
+	vectors, err := provider.Embed(context.Background(), texts)
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if embedCalls != 2 || len(vectors) != 12 || vectors[11][0] != 1 || vectors[3][0] != 3 {
+		t.Fatalf("expected 2 batches mapped by text_index, got calls=%d vectors=%v", embedCalls, vectors)
+	}
+	if provider.ModelName() != defaultDashScopeEmbedModel {
+		t.Fatalf("unexpected default embedding model %q", provider.ModelName())
+	}
+}
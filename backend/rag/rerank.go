@@ -0,0 +1,288 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RerankFormat 区分重排接口的请求/响应格式
+type RerankFormat string
+
+const (
+	// RerankCohere Cohere 兼容格式：POST {base}/rerank，Jina、SiliconFlow、vLLM 等均兼容
+	RerankCohere RerankFormat = "cohere"
+	// RerankDashScope 阿里云百炼 text-rerank 原生格式
+	RerankDashScope RerankFormat = "dashscope"
+)
+
+const (
+	// DefaultRerankCandidates 重排前的召回数量
+	DefaultRerankCandidates = 30
+	// DefaultRerankThreshold 重排后保留分块的最低相关度（0-1）
+	DefaultRerankThreshold = 0.3
+
+	dashScopeRerankURL   = "https://dashscope.aliyuncs.com/api/v1/services/rerank/text-rerank/text-rerank"
+	defaultDashScopeRank = "gte-rerank-v2"
+	defaultCohereRank    = "rerank-multilingual-v3.0"
+	// llmRerankPassageRunes LLM 评分时每个分块截取的最大字数，控制提示词长度
+	llmRerankPassageRunes = 500
+)
+
+// Reranker 对候选文本按与查询的相关度打分，返回与 documents 一一对应的 0-1 分数
+type Reranker interface {
+	// Rerank 的 ctx 取消时中止上游请求
+	Rerank(ctx context.Context, query string, documents []string) ([]float64, error)
+}
+
+// RerankCandidate 为待重排的检索分块
+type RerankCandidate struct {
+	ID      int64
+	Content string
+}
+
+// RerankResult 为重排后保留的分块及其相关度
+type RerankResult struct {
+	ID    int64
+	Score float64
+}
+
+// RerankResults 为候选打分，丢弃低于 threshold 的分块，并按相关度降序返回至多 k 个。
+// 全部低于阈值时返回空切片，调用方据此判定资料不足。
+func RerankResults(ctx context.Context, reranker Reranker, query string, candidates []RerankCandidate, k int, threshold float64) ([]RerankResult, error) {
+	if len(candidates) == 0 || k <= 0 {
+		return []RerankResult{}, nil
+	}
+	documents := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		documents = append(documents, candidate.Content)
+	}
+	scores, err := reranker.Rerank(ctx, query, documents)
+	if err != nil {
+		return nil, err
+	}
+	if len(scores) != len(candidates) {
+		return nil, fmt.Errorf("rerank returned %d scores for %d documents", len(scores), len(candidates))
+	}
+
+	results := make([]RerankResult, 0, len(candidates))
+	for i, candidate := range candidates {
+		if scores[i] >= threshold {
+			results = append(results, RerankResult{ID: candidate.ID, Score: scores[i]})
+		}
+	}
+	// 稳定排序：同分时保留召回阶段的先后顺序
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// APIReranker 调用专用重排模型接口
+type APIReranker struct {
+	APIKey     string
+	BaseURL    string
+	Model      string
+	Format     RerankFormat
+	HTTPClient *http.Client
+}
+
+type rerankItem struct {
+	Index          int     `json:"index"`
+	RelevanceScore float64 `json:"relevance_score"`
+}
+
+type cohereRerankResponse struct {
+	Results []rerankItem `json:"results"`
+	Message string       `json:"message,omitempty"`
+	Error   interface{}  `json:"error,omitempty"`
+}
+
+type dashScopeRerankResponse struct {
+	Output struct {
+		Results []rerankItem `json:"results"`
+	} `json:"output"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (r *APIReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	if len(documents) == 0 {
+		return nil, nil
+	}
+	if strings.TrimSpace(r.APIKey) == "" {
+		return nil, fmt.Errorf("missing rerank API key")
+	}
+
+	var (
+		url  string
+		body interface{}
+	)
+	switch r.Format {
+	case RerankDashScope:
+		url = strings.TrimSpace(r.BaseURL)
+		if url == "" {
+			url = dashScopeRerankURL
+		}
+		body = map[string]interface{}{
+			"model": r.modelName(defaultDashScopeRank),
+			"input": map[string]interface{}{"query": query, "documents": documents},
+			"parameters": map[string]interface{}{
+				"top_n":            len(documents),
+				"return_documents": false,
+			},
+		}
+	default:
+		base := strings.TrimRight(strings.TrimSpace(r.BaseURL), "/")
+		if base == "" {
+			return nil, fmt.Errorf("missing rerank base URL")
+		}
+		url = base + "/rerank"
+		body = map[string]interface{}{
+			"model":            r.modelName(defaultCohereRank),
+			"query":            query,
+			"documents":        documents,
+			"top_n":            len(documents),
+			"return_documents": false,
+		}
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+r.APIKey)
+
+	client := r.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: generationTimeout()}
+	}
+	resp, err := callUpstream(client, req, "rerank:"+string(r.Format))
+	if err != nil {
+		return nil, fmt.Errorf("rerank API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+
+	var items []rerankItem
+	if r.Format == RerankDashScope {
+		var res dashScopeRerankResponse
+		if err := json.Unmarshal(raw, &res); err != nil {
+			return nil, fmt.Errorf("rerank API response parse failed: %w", err)
+		}
+		if res.Code != "" {
+			return nil, fmt.Errorf("rerank API error: %s %s", res.Code, res.Message)
+		}
+		items = res.Output.Results
+	} else {
+		var res cohereRerankResponse
+		if err := json.Unmarshal(raw, &res); err != nil {
+			return nil, fmt.Errorf("rerank API response parse failed: %w", err)
+		}
+		if res.Error != nil {
+			return nil, fmt.Errorf("rerank API error: %v", res.Error)
+		}
+		items = res.Results
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("rerank API returned status %d", resp.StatusCode)
+	}
+
+	// 结果按相关度排序，需按 index 回填；接口未返回的条目视为不相关
+	scores := make([]float64, len(documents))
+	for _, item := range items {
+		if item.Index >= 0 && item.Index < len(scores) {
+			scores[item.Index] = item.RelevanceScore
+		}
+	}
+	return scores, nil
+}
+
+func (r *APIReranker) modelName(fallback string) string {
+	if model := strings.TrimSpace(r.Model); model != "" {
+		return model
+	}
+	return fallback
+}
+
+const llmRerankSystemPrompt = `你负责评估课程资料片段与学生问题的相关度。
+对每个片段打 0-10 分：10 表示能直接回答问题，5 表示部分相关，0 表示无关。
+每行输出一个结果，格式为“编号: 分数”，例如“3: 7”。不要输出其他内容。`
+
+var llmRerankLinePattern = regexp.MustCompile(`\[?(\d+)\]?\s*[:：]\s*(\d+(?:\.\d+)?)`)
+
+// LLMReranker 在没有专用重排模型时，让对话模型为每个片段打分
+type LLMReranker struct {
+	Client ChatModel
+}
+
+func (r *LLMReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	if len(documents) == 0 {
+		return nil, nil
+	}
+	var builder strings.Builder
+	builder.WriteString("[学生问题]\n")
+	builder.WriteString(query)
+	builder.WriteString("\n\n[课程资料片段]\n")
+	for i, document := range documents {
+		builder.WriteString(fmt.Sprintf("[%d] %s\n\n", i+1, truncateRunes(strings.TrimSpace(document), llmRerankPassageRunes)))
+	}
+
+	raw, err := CompletePrompt(ctx, r.Client, llmRerankSystemPrompt, builder.String())
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make([]float64, len(documents))
+	parsed := 0
+	for _, match := range llmRerankLinePattern.FindAllStringSubmatch(raw, -1) {
+		index, err := strconv.Atoi(match[1])
+		if err != nil || index < 1 || index > len(documents) {
+			continue
+		}
+		score, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			continue
+		}
+		if score > 10 {
+			score = 10
+		}
+		scores[index-1] = score / 10
+		parsed++
+	}
+	if parsed == 0 {
+		return nil, fmt.Errorf("rerank response contains no scores")
+	}
+	return scores, nil
+}
+
+// FallbackReranker 依次尝试各个重排器，前一个失败时使用下一个
+type FallbackReranker []Reranker
+
+func (f FallbackReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	var lastErr error
+	for _, reranker := range f {
+		scores, err := reranker.Rerank(ctx, query, documents)
+		if err == nil {
+			return scores, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no reranker configured")
+	}
+	return nil, lastErr
+}
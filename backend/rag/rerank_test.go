@@ -0,0 +1,99 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type staticReranker struct {
+	scores []float64
+	err    error
+}
+
+func (s staticReranker) Rerank(_ context.Context, query string, documents []string) ([]float64, error) {
+	return s.scores, s.err
+}
+
+func TestRerankResultsFiltersAndOrders(t *testing.T) {
+	candidates := []RerankCandidate{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}}
+	results, err := RerankResults(context.Background(), staticReranker{scores: []float64{0.2, 0.9, 0.5, 0.9}}, "栈", candidates, 2, 0.3)
+	if err != nil {
+		t.Fatalf("RerankResults: %v", err)
+	}
+	want := []RerankResult{{ID: 2, Score: 0.9}, {ID: 4, Score: 0.9}}
+	if !reflect.DeepEqual(results, want) {
+		t.Fatalf("RerankResults:\n got %+v\nwant %+v", results, want)
+	}
+
+	none, err := RerankResults(context.Background(), staticReranker{scores: []float64{0.1, 0.2, 0.1, 0}}, "栈", candidates, 2, 0.3)
+	if err != nil || none == nil || len(none) != 0 {
+		t.Fatalf("expected empty result below threshold, got %+v err=%v", none, err)
+	}
+}
+
+func TestFallbackRerankerUsesNextOnError(t *testing.T) {
+	reranker := FallbackReranker{
+		staticReranker{err: errors.New("unavailable")},
+		staticReranker{scores: []float64{0.7}},
+	}
+	scores, err := reranker.Rerank(context.Background(), "栈", []string{"栈是后进先出的线性表"})
+	if err != nil || !reflect.DeepEqual(scores, []float64{0.7}) {
+		t.Fatalf("expected fallback scores, got %v err=%v", scores, err)
+	}
+}
+
+func TestAPIRerankerFormats(t *testing.T) {
+	var lastPath string
+	var lastBody map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastPath = r.URL.Path
+		_ = json.NewDecoder(r.Body).Decode(&lastBody)
+		results := []map[string]any{{"index": 1, "relevance_score": 0.8}, {"index": 0, "relevance_score": 0.1}}
+		if _, ok := lastBody["input"]; ok {
+			_ = json.NewEncoder(w).Encode(map[string]any{"output": map[string]any{"results": results}})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"results": results})
+	}))
+	defer server.Close()
+
+	documents := []string{"队列", "栈"}
+	cohere := &APIReranker{APIKey: "test-key", BaseURL: server.URL + "/v1", Format: RerankCohere}
+	scores, err := cohere.Rerank(context.Background(), "什么是栈", documents)
+	if err != nil || !reflect.DeepEqual(scores, []float64{0.1, 0.8}) {
+		t.Fatalf("cohere rerank: scores=%v err=%v", scores, err)
+	}
+	if lastPath != "/v1/rerank" || lastBody["query"] != "什么是栈" {
+		t.Fatalf("unexpected cohere request: path=%q body=%v", lastPath, lastBody)
+	}
+
+	dashScope := &APIReranker{APIKey: "test-key", BaseURL: server.URL + "/text-rerank", Format: RerankDashScope}
+	scores, err = dashScope.Rerank(context.Background(), "什么是栈", documents)
+	if err != nil || !reflect.DeepEqual(scores, []float64{0.1, 0.8}) {
+		t.Fatalf("dashscope rerank: scores=%v err=%v", scores, err)
+	}
+	if lastPath != "/text-rerank" || lastBody["model"] != defaultDashScopeRank {
+		t.Fatalf("unexpected dashscope request: path=%q body=%v", lastPath, lastBody)
+	}
+}
+
+func TestLLMRerankerParsesScores(t *testing.T) {
+	client := newChatTestServer(t, "1: 2\n[2]：9\n7: 10\n3: 15", nil)
+	scores, err := (&LLMReranker{Client: client}).Rerank(context.Background(), "什么是栈", []string{"队列", "栈", "树"})
+	if err != nil {
+		t.Fatalf("LLMReranker: %v", err)
+	}
+	if !reflect.DeepEqual(scores, []float64{0.2, 0.9, 1}) {
+		t.Fatalf("unexpected scores: %v", scores)
+	}
+
+	empty := newChatTestServer(t, "无法判断", nil)
+	if _, err := (&LLMReranker{Client: empty}).Rerank(context.Background(), "什么是栈", []string{"栈"}); err == nil {
+		t.Fatal("expected error when no scores parsed")
+	}
+}
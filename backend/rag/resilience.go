@@ -0,0 +1,208 @@
+package rag
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultMaxRetries = 2
+
+// 重试与熔断参数，测试中可调小
+var (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 8 * time.Second
+	// maxRetryAfter 上游要求等待超过该时长时不再重试，直接返回错误交给备用提供方
+	maxRetryAfter = 30 * time.Second
+
+	breakerFailureThreshold = 5
+	breakerCooldown         = 30 * time.Second
+)
+
+// ErrCircuitOpen 该提供方近期连续失败，熔断期内不再发起请求
+var ErrCircuitOpen = errors.New("upstream circuit breaker is open")
+
+// callUpstream 发送模型接口请求：熔断打开时直接返回 ErrCircuitOpen；429、5xx 与连接错误按指数退避加抖动重试，
+// 并遵循 Retry-After。请求超时不重试，req 的 ctx 取消时立即返回。
+// 重试用尽后返回最后一次响应，状态码可能仍 >= 400，由调用方解析错误信息。
+func callUpstream(client *http.Client, req *http.Request, provider string) (*http.Response, error) {
+	ctx := req.Context()
+	breaker := breakerFor(provider, req.URL.Host)
+	if !breaker.allow() {
+		return nil, fmt.Errorf("%w: %s", ErrCircuitOpen, provider)
+	}
+
+	retries := maxRetries()
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				breaker.release()
+				return nil, err
+			}
+			attemptReq = req.Clone(ctx)
+			attemptReq.Body = body
+		}
+
+		resp, err := client.Do(attemptReq)
+		if ctx.Err() != nil {
+			// 调用方取消不计入熔断统计
+			if resp != nil {
+				resp.Body.Close()
+			}
+			breaker.release()
+			return nil, ctx.Err()
+		}
+		if err == nil && !isRetryableStatus(resp.StatusCode) {
+			breaker.success()
+			return resp, nil
+		}
+
+		delay, ok := retryDelay(attempt, resp)
+		if attempt >= retries || !ok || (err != nil && isTimeoutError(err)) {
+			breaker.failure()
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			breaker.release()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// isRetryableStatus 限流与服务端临时故障可以重试，501 等表示接口不支持，不重试
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryDelay 计算第 attempt 次失败（从 0 开始）后的等待时间：响应带 Retry-After 时按其等待，
+// 否则为 retryBaseDelay 的指数退避并在后半区间随机抖动。上游要求等待过久时返回 false
+func retryDelay(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return delay, delay <= maxRetryAfter
+		}
+	}
+	backoff := retryMaxDelay
+	if attempt < 16 {
+		if shifted := retryBaseDelay << attempt; shifted < backoff {
+			backoff = shifted
+		}
+	}
+	half := backoff / 2
+	if half <= 0 {
+		return backoff, true
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1)), true
+}
+
+// parseRetryAfter 解析秒数或 HTTP 日期两种格式的 Retry-After
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			seconds = 0
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if delay := at.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// maxRetries 读取 LLM_MAX_RETRIES（失败后的重试次数，0 表示不重试）
+func maxRetries() int {
+	raw := strings.TrimSpace(os.Getenv("LLM_MAX_RETRIES"))
+	if raw != "" {
+		if retries, err := strconv.Atoi(raw); err == nil && retries >= 0 {
+			return retries
+		}
+	}
+	return defaultMaxRetries
+}
+
+// circuitBreaker 按提供方与主机统计连续失败：达到阈值后熔断 breakerCooldown，
+// 冷却结束后只放行一个探测请求，成功则恢复，失败则重新熔断
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+var breakers sync.Map
+
+func breakerFor(provider, host string) *circuitBreaker {
+	key := provider + "|" + host
+	if breaker, ok := breakers.Load(key); ok {
+		return breaker.(*circuitBreaker)
+	}
+	breaker, _ := breakers.LoadOrStore(key, &circuitBreaker{})
+	return breaker.(*circuitBreaker)
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < breakerFailureThreshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.failures >= breakerFailureThreshold {
+		b.openUntil = time.Now().Add(breakerCooldown)
+	}
+}
+
+// release 请求被调用方取消，既不算成功也不算失败，只释放探测名额
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
@@ -0,0 +1,230 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func withFastRetries(t *testing.T) {
+	t.Helper()
+	base, max, cooldown := retryBaseDelay, retryMaxDelay, breakerCooldown
+	retryBaseDelay, retryMaxDelay, breakerCooldown = time.Millisecond, 4*time.Millisecond, 20*time.Millisecond
+	t.Cleanup(func() {
+		retryBaseDelay, retryMaxDelay, breakerCooldown = base, max, cooldown
+	})
+}
+
+func writeChatAnswer(w http.ResponseWriter, answer string) {
+	fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%q}}]}`, answer)
+}
+
+func TestGenClientRetriesRateLimitAndServerErrors(t *testing.T) {
+	withFastRetries(t)
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			writeChatAnswer(w, "栈是后进先出的线性表。")
+		}
+	}))
+	defer server.Close()
+
+	client := &GenClient{APIKey: "test-key", BaseURL: server.URL, Model: "test-model"}
+	answer, err := client.Chat(context.Background(), []ChatMessage{{Role: "user", Content: "什么是栈"}})
+	if err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if answer != "栈是后进先出的线性表。" || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("unexpected answer %q after %d calls", answer, calls)
+	}
+}
+
+func TestGenClientDoesNotRetryClientErrorsOrLongRetryAfter(t *testing.T) {
+	withFastRetries(t)
+	for _, tc := range []struct {
+		name       string
+		status     int
+		retryAfter string
+	}{
+		{"bad request", http.StatusBadRequest, ""},
+		{"retry after too long", http.StatusTooManyRequests, "3600"},
+	} {
+		var calls int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			if tc.retryAfter != "" {
+				w.Header().Set("Retry-After", tc.retryAfter)
+			}
+			w.WriteHeader(tc.status)
+			fmt.Fprint(w, `{"error":{"message":"rejected"}}`)
+		}))
+
+		client := &GenClient{APIKey: "test-key", BaseURL: server.URL}
+		if _, err := client.Chat(context.Background(), []ChatMessage{{Role: "user", Content: "hi"}}); err == nil {
+			t.Fatalf("%s: expected error", tc.name)
+		}
+		if got := atomic.LoadInt32(&calls); got != 1 {
+			t.Fatalf("%s: expected a single attempt, got %d", tc.name, got)
+		}
+		server.Close()
+	}
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	withFastRetries(t)
+	t.Setenv("LLM_MAX_RETRIES", "0")
+	var calls, healthy int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeChatAnswer(w, "ok")
+	}))
+	defer server.Close()
+
+	client := &GenClient{APIKey: "test-key", BaseURL: server.URL}
+	messages := []ChatMessage{{Role: "user", Content: "hi"}}
+	for i := 0; i < breakerFailureThreshold; i++ {
+		if _, err := client.Chat(context.Background(), messages); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("attempt %d: expected upstream failure, got %v", i, err)
+		}
+	}
+	if _, err := client.Chat(context.Background(), messages); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != int32(breakerFailureThreshold) {
+		t.Fatalf("open circuit must not reach upstream, got %d calls", got)
+	}
+
+	// 冷却结束后放行探测请求，成功即恢复
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(2 * breakerCooldown)
+	if _, err := client.Chat(context.Background(), messages); err != nil {
+		t.Fatalf("expected probe to succeed, got %v", err)
+	}
+	if _, err := client.Chat(context.Background(), messages); err != nil {
+		t.Fatalf("expected closed circuit, got %v", err)
+	}
+}
+
+func TestFailoverProviderUsesFallbackModel(t *testing.T) {
+	withFastRetries(t)
+	t.Setenv("LLM_MAX_RETRIES", "0")
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer primary.Close()
+	var fallbackModel string
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		fallbackModel = req.Model
+		if req.Stream {
+			fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"备用回答\"}}]}\n\ndata: [DONE]\n\n")
+			return
+		}
+		writeChatAnswer(w, "备用回答")
+	}))
+	defer fallback.Close()
+
+	var usages []Usage
+	provider := NewProvider(ProviderConfig{
+		APIKey:   "primary-key",
+		BaseURL:  primary.URL,
+		LLMModel: "primary-model",
+		OnUsage:  func(usage Usage) { usages = append(usages, usage) },
+		Fallbacks: []ProviderConfig{
+			{APIKey: "fallback-key", BaseURL: fallback.URL, LLMModel: "fallback-model"},
+		},
+	})
+	answer, err := provider.Chat(context.Background(), []ChatMessage{{Role: "user", Content: "hi"}})
+	if err != nil || answer != "备用回答" || fallbackModel != "fallback-model" {
+		t.Fatalf("expected fallback answer, got %q (%v), model %q", answer, err, fallbackModel)
+	}
+	if len(usages) != 2 || usages[0].Err == nil || usages[1].Model != "fallback-model" {
+		t.Fatalf("expected usage for both attempts, got %+v", usages)
+	}
+
+	answer, err = provider.ChatStream(context.Background(), []ChatMessage{{Role: "user", Content: "hi"}}, func(string) error { return nil })
+	if err != nil || answer != "备用回答" {
+		t.Fatalf("expected fallback stream answer, got %q (%v)", answer, err)
+	}
+}
+
+func TestFailoverProviderKeepsPartialStream(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"栈是\"}}]}\n\ndata: {\"error\":{\"message\":\"overloaded\"}}\n\n")
+	}))
+	defer primary.Close()
+	var fallbackCalls int32
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fallbackCalls, 1)
+	}))
+	defer fallback.Close()
+
+	provider := NewProvider(ProviderConfig{
+		APIKey:    "key",
+		BaseURL:   primary.URL,
+		Fallbacks: []ProviderConfig{{APIKey: "key", BaseURL: fallback.URL}},
+	})
+	_, err := provider.ChatStream(context.Background(), []ChatMessage{{Role: "user", Content: "hi"}}, func(string) error { return nil })
+	if err == nil {
+		t.Fatal("expected stream error")
+	}
+	if atomic.LoadInt32(&fallbackCalls) != 0 {
+		t.Fatal("must not fail over after deltas were emitted")
+	}
+}
+
+func TestEmbedClientAbortsOnContextCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	client := &EmbedClient{APIKey: "test-key", BaseURL: server.URL}
+	start := time.Now()
+	if _, err := client.Embed(ctx, []string{"栈"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("cancel should abort the upstream call promptly")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	if delay, ok := parseRetryAfter("3", now); !ok || delay != 3*time.Second {
+		t.Fatalf("seconds: got %v %v", delay, ok)
+	}
+	if delay, ok := parseRetryAfter(now.Add(5*time.Second).Format(http.TimeFormat), now); !ok || delay != 5*time.Second {
+		t.Fatalf("http date: got %v %v", delay, ok)
+	}
+	if _, ok := parseRetryAfter("soon", now); ok {
+		t.Fatal("invalid value should be ignored")
+	}
+}
@@ -1,9 +1,6 @@
 package rag
 
-import (
-	"math"
-	"sort"
-)
+import "math"
 
 // Chunk 表示一个已向量化的文本块
 type Chunk struct {
@@ -33,29 +30,26 @@ func CosineSimilarity(a, b []float32) float32 {
 
 // TopK 从 chunks 中找出与 query 最相似的前 k 个，按相似度降序返回
 func TopK(query []float32, chunks []Chunk, k int) []Chunk {
-	type scored struct {
-		chunk Chunk
-		score float32
-	}
-	scored_chunks := make([]scored, 0, len(chunks))
+	index := NewFlatIndex()
+	byID := make(map[int64]Chunk, len(chunks))
 	for _, c := range chunks {
 		if len(c.Embedding) == 0 {
 			continue
 		}
-		scored_chunks = append(scored_chunks, scored{
-			chunk: c,
-			score: CosineSimilarity(query, c.Embedding),
-		})
-	}
-	sort.Slice(scored_chunks, func(i, j int) bool {
-		return scored_chunks[i].score > scored_chunks[j].score
-	})
-	if k > len(scored_chunks) {
-		k = len(scored_chunks)
+		index.Add(c.ID, c.Embedding)
+		byID[c.ID] = c
 	}
-	result := make([]Chunk, k)
-	for i := range result {
-		result[i] = scored_chunks[i].chunk
+	return TopKFromIndex(index, query, byID, k)
+}
+
+// TopKFromIndex 通过任意 VectorIndex 检索，并按结果顺序取回对应分块
+func TopKFromIndex(index VectorIndex, query []float32, chunks map[int64]Chunk, k int) []Chunk {
+	results := index.Search(query, k)
+	out := make([]Chunk, 0, len(results))
+	for _, r := range results {
+		if c, ok := chunks[r.ID]; ok {
+			out = append(out, c)
+		}
 	}
-	return result
+	return out
 }
@@ -0,0 +1,98 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const condenseSystemPrompt = `你负责把课程问答中的追问改写为可以独立检索的完整问题。
+结合对话历史补全追问中省略的主语、指代（如“它”“第二点”“那这个呢”）和上下文。
+如果问题本身已经完整，原样输出。
+只输出改写后的一个问题，不要回答问题，不要解释，不要加引号或编号。`
+
+const expandSystemPrompt = `你负责为课程知识库检索生成同义改写的查询。
+针对给定问题，从不同角度（同义词、专业术语、更具体或更概括的说法）写出 %d 个不同的检索问题。
+每行一个，不要编号，不要解释，不要重复原问题。`
+
+// condenseHistoryTurns 改写时最多参考的历史消息数（问答各算一条）
+const condenseHistoryTurns = 6
+
+var listMarkerPattern = regexp.MustCompile(`^\s*(?:[-*•]|\d+[.)、．])\s*`)
+
+// CondenseQuestion 结合会话历史把追问改写为独立问题；没有历史时原样返回。
+// 模型返回空内容时退回原问题，请求失败时返回错误由调用方决定是否降级。
+func CondenseQuestion(ctx context.Context, client ChatModel, question string, history []ChatMessage) (string, error) {
+	question = strings.TrimSpace(question)
+	if len(history) == 0 {
+		return question, nil
+	}
+	if len(history) > condenseHistoryTurns {
+		history = history[len(history)-condenseHistoryTurns:]
+	}
+
+	var builder strings.Builder
+	builder.WriteString("[对话历史]\n")
+	for _, message := range history {
+		role := "学生"
+		if message.Role == "assistant" {
+			role = "助手"
+		}
+		builder.WriteString(fmt.Sprintf("%s：%s\n", role, truncateRunes(strings.TrimSpace(message.Content), 400)))
+	}
+	builder.WriteString("\n[追问]\n")
+	builder.WriteString(question)
+
+	raw, err := CompletePrompt(ctx, client, condenseSystemPrompt, builder.String())
+	if err != nil {
+		return question, err
+	}
+	for _, line := range strings.Split(raw, "\n") {
+		if rewritten := cleanQueryLine(line); rewritten != "" {
+			return rewritten, nil
+		}
+	}
+	return question, nil
+}
+
+// ExpandQueries 为问题生成至多 n 个不同说法的检索查询，结果已去重且不含原问题
+func ExpandQueries(ctx context.Context, client ChatModel, question string, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	raw, err := CompletePrompt(ctx, client, fmt.Sprintf(expandSystemPrompt, n), question)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{strings.TrimSpace(question): true}
+	queries := make([]string, 0, n)
+	for _, line := range strings.Split(raw, "\n") {
+		query := cleanQueryLine(line)
+		if query == "" || seen[query] {
+			continue
+		}
+		seen[query] = true
+		queries = append(queries, query)
+		if len(queries) == n {
+			break
+		}
+	}
+	return queries, nil
+}
+
+func cleanQueryLine(line string) string {
+	line = listMarkerPattern.ReplaceAllString(strings.TrimSpace(line), "")
+	line = strings.TrimPrefix(line, "改写后：")
+	line = strings.TrimPrefix(line, "问题：")
+	return strings.Trim(strings.TrimSpace(line), "\"'“”「」")
+}
+
+func truncateRunes(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "…"
+}
@@ -0,0 +1,89 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newChatTestServer 返回固定回复的对话接口，并记录最后一次请求的用户消息
+func newChatTestServer(t *testing.T, reply string, lastUser *string) *GenClient {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req chatRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if lastUser != nil && len(req.Messages) > 0 {
+			*lastUser = req.Messages[len(req.Messages)-1].Content
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": reply}}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return &GenClient{APIKey: "test-key", BaseURL: server.URL, Model: "test-model"}
+}
+
+func TestCondenseQuestionUsesHistory(t *testing.T) {
+	var prompt string
+	client := newChatTestServer(t, "改写后：“顺序栈的第二种实现方式是什么？”\n", &prompt)
+	history := []ChatMessage{
+		{Role: "user", Content: "顺序栈有哪些实现方式？"},
+		{Role: "assistant", Content: "1. 静态数组 2. 动态扩容数组"},
+	}
+
+	got, err := CondenseQuestion(context.Background(), client, "那第二点呢？", history)
+	if err != nil {
+		t.Fatalf("CondenseQuestion: %v", err)
+	}
+	if got != "顺序栈的第二种实现方式是什么？" {
+		t.Fatalf("unexpected rewritten question: %q", got)
+	}
+	if !strings.Contains(prompt, "顺序栈有哪些实现方式？") || !strings.Contains(prompt, "那第二点呢？") {
+		t.Fatalf("prompt should include history and follow-up, got %q", prompt)
+	}
+}
+
+func TestCondenseQuestionWithoutHistorySkipsModel(t *testing.T) {
+	client := &GenClient{APIKey: "test-key", BaseURL: "http://127.0.0.1:0", Model: "test-model"}
+	got, err := CondenseQuestion(context.Background(), client, "  什么是栈？ ", nil)
+	if err != nil || got != "什么是栈？" {
+		t.Fatalf("expected question unchanged without history, got %q err=%v", got, err)
+	}
+}
+
+func TestExpandQueriesDeduplicatesAndLimits(t *testing.T) {
+	client := newChatTestServer(t, "1. 栈的定义\n- 什么是栈\n什么是栈？\n2. 栈的定义\n后进先出结构\n堆栈是什么", nil)
+	got, err := ExpandQueries(context.Background(), client, "什么是栈？", 3)
+	if err != nil {
+		t.Fatalf("ExpandQueries: %v", err)
+	}
+	want := []string{"栈的定义", "什么是栈", "后进先出结构"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ExpandQueries:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestRetrieveFusesExpandedQueries(t *testing.T) {
+	keyword := NewBM25Index()
+	keyword.Add(1, "栈是后进先出的线性表")
+	keyword.Add(2, "递归调用层数过深的问题")
+
+	q := RetrievalQuery{Text: "后进先出", Mode: RetrievalKeyword, K: 5}
+	if results := Retrieve(NewFlatIndex(), keyword, q); len(results) != 1 || results[0].ID != 1 {
+		t.Fatalf("expected only doc 1 without expansion, got %#v", results)
+	}
+
+	q.Expansions = []RetrievalQuery{{Text: "递归过深"}}
+	results := Retrieve(NewFlatIndex(), keyword, q)
+	ids := map[int64]bool{}
+	for _, result := range results {
+		ids[result.ID] = true
+	}
+	if len(results) != 2 || !ids[1] || !ids[2] {
+		t.Fatalf("expected expansion to recall both docs, got %#v", results)
+	}
+}
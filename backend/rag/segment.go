@@ -0,0 +1,80 @@
+package rag
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ChunkMeta 记录分块在原文档中的位置（PDF 页码、幻灯片序号或工作表），用于引用来源时标注出处
+type ChunkMeta struct {
+	Page      int    `json:"page,omitempty"`
+	Slide     int    `json:"slide,omitempty"`
+	Sheet     int    `json:"sheet,omitempty"`
+	SheetName string `json:"sheet_name,omitempty"`
+	// Section 为结构化分块时分块所在的标题路径，例如 "第二章 栈 > 2.1 顺序栈"
+	Section string `json:"section,omitempty"`
+	// Canonical 标记教师针对问答审核撰写的标准答案，检索命中时优先提供给生成模型
+	Canonical bool `json:"canonical,omitempty"`
+}
+
+// Label 返回面向用户的位置描述，例如 "p. 12"、"slide 3"、"sheet 2 (成绩)"；无位置信息时为空
+func (m ChunkMeta) Label() string {
+	switch {
+	case m.Canonical:
+		return "教师标准答案"
+	case m.Page > 0:
+		return fmt.Sprintf("p. %d", m.Page)
+	case m.Slide > 0:
+		return fmt.Sprintf("slide %d", m.Slide)
+	case m.Sheet > 0 && m.SheetName != "":
+		return fmt.Sprintf("sheet %d (%s)", m.Sheet, m.SheetName)
+	case m.Sheet > 0:
+		return fmt.Sprintf("sheet %d", m.Sheet)
+	}
+	return ""
+}
+
+// Encode 序列化为 rag_chunks.metadata 列的取值，无位置信息时为空串
+func (m ChunkMeta) Encode() string {
+	if m == (ChunkMeta{}) {
+		return ""
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// DecodeChunkMeta 解析 rag_chunks.metadata 列，格式不正确时返回零值
+func DecodeChunkMeta(raw string) ChunkMeta {
+	var meta ChunkMeta
+	if strings.TrimSpace(raw) != "" {
+		_ = json.Unmarshal([]byte(raw), &meta)
+	}
+	return meta
+}
+
+// Segment 是抽取出的一段带位置信息的文本（如 PDF 的一页、一张幻灯片或一个工作表）
+type Segment struct {
+	Text string
+	Meta ChunkMeta
+}
+
+// TextChunk 是切分后的分块文本及其位置信息
+type TextChunk struct {
+	Content string
+	Meta    ChunkMeta
+}
+
+// ChunkSegments 按段切分，分块不跨越段边界，以保证每个分块能对应到确定的位置
+func ChunkSegments(segments []Segment, size, overlap int) []TextChunk {
+	chunks := make([]TextChunk, 0)
+	for _, segment := range segments {
+		for _, content := range ChunkText(segment.Text, size, overlap) {
+			chunks = append(chunks, TextChunk{Content: content, Meta: segment.Meta})
+		}
+	}
+	return chunks
+}
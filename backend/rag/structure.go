@@ -0,0 +1,376 @@
+package rag
+
+import (
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ChunkStrategy 文档分块策略
+type ChunkStrategy string
+
+const (
+	// ChunkFixed 按字符数定长切分（ChunkText），适合无结构的纯文本
+	ChunkFixed ChunkStrategy = "fixed"
+	// ChunkStructured 按标题、列表、表格、代码块等结构切分并限制 token 数
+	ChunkStructured ChunkStrategy = "structured"
+)
+
+// ParseChunkStrategy 解析上传时指定的分块策略；为空时 Markdown 与 DOCX 使用结构化分块，其余使用定长分块
+func ParseChunkStrategy(raw, filename string) (ChunkStrategy, bool) {
+	switch ChunkStrategy(strings.ToLower(strings.TrimSpace(raw))) {
+	case "":
+		switch strings.ToLower(filepath.Ext(filename)) {
+		case ".md", ".docx":
+			return ChunkStructured, true
+		}
+		return ChunkFixed, true
+	case ChunkFixed:
+		return ChunkFixed, true
+	case ChunkStructured:
+		return ChunkStructured, true
+	default:
+		return ChunkFixed, false
+	}
+}
+
+// ExtractStructuredSegments 与 ExtractSegments 相同，但 DOCX 会把标题、列表和表格渲染为 Markdown 以保留结构
+func ExtractStructuredSegments(filename string, r io.Reader) ([]Segment, error) {
+	if strings.ToLower(filepath.Ext(filename)) == ".docx" {
+		text, err := extractDOCXMarkdown(r)
+		if err != nil {
+			return nil, err
+		}
+		if text == "" {
+			return nil, nil
+		}
+		return []Segment{{Text: text}}, nil
+	}
+	return ExtractSegments(filename, r)
+}
+
+// BlockKind 结构块类型
+type BlockKind int
+
+const (
+	BlockParagraph BlockKind = iota
+	BlockHeading
+	BlockList
+	BlockTable
+	BlockCode
+)
+
+// Block 是 Markdown 中的一个结构块。Units 为块内可独立拆分的最小单位：
+// 列表为各列表项，表格为各数据行（表头在 Header 中），代码块为各行，段落为整段。
+type Block struct {
+	Kind   BlockKind
+	Level  int
+	Text   string
+	Header []string
+	Units  []string
+	Fence  string
+}
+
+var (
+	mdHeadingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdListPattern    = regexp.MustCompile(`^\s*([-*+]|\d+[.)])\s+`)
+	mdFencePattern   = regexp.MustCompile("^\\s*(```+|~~~+)")
+	mdTableSeparator = regexp.MustCompile(`^\s*\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)*\|?\s*$`)
+)
+
+const mdSentenceEndings = "。！？.!?；;"
+
+// ParseMarkdownBlocks 把 Markdown 文本解析为结构块序列
+func ParseMarkdownBlocks(text string) []Block {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	blocks := make([]Block, 0)
+	var paragraph []string
+
+	flushParagraph := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		body := strings.TrimSpace(strings.Join(paragraph, "\n"))
+		if body != "" {
+			blocks = append(blocks, Block{Kind: BlockParagraph, Text: body, Units: []string{body}})
+		}
+		paragraph = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if m := mdFencePattern.FindStringSubmatch(line); m != nil {
+			flushParagraph()
+			fence := m[1]
+			code := []string{}
+			opening := trimmed
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), fence) {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			blocks = append(blocks, Block{Kind: BlockCode, Fence: opening, Units: code})
+			continue
+		}
+
+		if m := mdHeadingPattern.FindStringSubmatch(trimmed); m != nil {
+			flushParagraph()
+			blocks = append(blocks, Block{Kind: BlockHeading, Level: len(m[1]), Text: m[2]})
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "|") {
+			flushParagraph()
+			rows := []string{}
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				rows = append(rows, strings.TrimSpace(lines[i]))
+			}
+			i--
+			block := Block{Kind: BlockTable}
+			if len(rows) >= 2 && mdTableSeparator.MatchString(rows[1]) {
+				block.Header = rows[:2]
+				rows = rows[2:]
+			}
+			block.Units = rows
+			blocks = append(blocks, block)
+			continue
+		}
+
+		if mdListPattern.MatchString(line) {
+			flushParagraph()
+			items := []string{}
+			for ; i < len(lines); i++ {
+				current := lines[i]
+				if strings.TrimSpace(current) == "" {
+					// 空行后紧跟列表项或缩进内容时视为同一列表
+					if i+1 < len(lines) && (mdListPattern.MatchString(lines[i+1]) || strings.HasPrefix(lines[i+1], "  ")) {
+						continue
+					}
+					break
+				}
+				if mdListPattern.MatchString(current) {
+					items = append(items, strings.TrimRight(current, " \t"))
+					continue
+				}
+				if strings.HasPrefix(current, " ") || strings.HasPrefix(current, "\t") {
+					items[len(items)-1] += "\n" + strings.TrimRight(current, " \t")
+					continue
+				}
+				break
+			}
+			i--
+			blocks = append(blocks, Block{Kind: BlockList, Units: items})
+			continue
+		}
+
+		if trimmed == "" {
+			flushParagraph()
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+	flushParagraph()
+	return blocks
+}
+
+// EstimateTokens 粗略估计文本的 token 数：中日韩字符每字计 1，
+// 连续的字母数字按每 4 个字符计 1，其余非空白符号各计 1
+func EstimateTokens(text string) int {
+	tokens := 0
+	wordLen := 0
+	flush := func() {
+		if wordLen > 0 {
+			tokens += (wordLen + 3) / 4
+			wordLen = 0
+		}
+	}
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			flush()
+			tokens++
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			wordLen++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+// ChunkStructuredSegments 对每段做结构化切分，分块内容以标题路径开头，Meta.Section 记录标题路径
+func ChunkStructuredSegments(segments []Segment, maxTokens int) []TextChunk {
+	chunks := make([]TextChunk, 0)
+	for _, segment := range segments {
+		for _, chunk := range ChunkBlocks(ParseMarkdownBlocks(segment.Text), maxTokens) {
+			meta := segment.Meta
+			meta.Section = chunk.Meta.Section
+			chunks = append(chunks, TextChunk{Content: chunk.Content, Meta: meta})
+		}
+	}
+	return chunks
+}
+
+// ChunkBlocks 按结构块装箱：遇到标题即结束当前分块，块能放下时整体放入，
+// 放不下时在列表项、表格行（重复表头）或代码行边界拆分，单个单位仍超限时才按长度硬切。
+func ChunkBlocks(blocks []Block, maxTokens int) []TextChunk {
+	if maxTokens <= 0 {
+		maxTokens = 400
+	}
+
+	chunks := make([]TextChunk, 0)
+	headings := make([]string, 0)
+	section := ""
+	var parts []string
+	used := 0
+
+	budget := func() int {
+		b := maxTokens - EstimateTokens(section)
+		if b < maxTokens/2 {
+			b = maxTokens / 2
+		}
+		return b
+	}
+	flush := func() {
+		body := strings.TrimSpace(strings.Join(parts, "\n\n"))
+		parts, used = nil, 0
+		if body == "" {
+			return
+		}
+		content := body
+		if section != "" {
+			content = section + "\n\n" + body
+		}
+		chunks = append(chunks, TextChunk{Content: content, Meta: ChunkMeta{Section: section}})
+	}
+	add := func(text string) {
+		tokens := EstimateTokens(text)
+		if used > 0 && used+tokens > budget() {
+			flush()
+		}
+		parts = append(parts, text)
+		used += tokens
+	}
+
+	for _, block := range blocks {
+		if block.Kind == BlockHeading {
+			flush()
+			level := block.Level
+			if level > len(headings)+1 {
+				level = len(headings) + 1
+			}
+			headings = append(headings[:level-1], block.Text)
+			section = strings.Join(headings, " > ")
+			continue
+		}
+
+		rendered := renderBlock(block, block.Units)
+		if EstimateTokens(rendered) <= budget() {
+			add(rendered)
+			continue
+		}
+
+		// 整块超限：先结束当前分块，再按单位装箱
+		flush()
+		limit := budget() - EstimateTokens(renderBlock(block, nil))
+		if limit < 1 {
+			limit = 1
+		}
+		var group []string
+		groupTokens := 0
+		for _, unit := range splitOversizedUnits(block, limit) {
+			tokens := EstimateTokens(unit)
+			if len(group) > 0 && groupTokens+tokens > limit {
+				add(renderBlock(block, group))
+				flush()
+				group, groupTokens = nil, 0
+			}
+			group = append(group, unit)
+			groupTokens += tokens
+		}
+		if len(group) > 0 {
+			add(renderBlock(block, group))
+		}
+	}
+	flush()
+	return chunks
+}
+
+// renderBlock 把块的部分单位渲染回 Markdown，表格带上表头，代码块带上围栏
+func renderBlock(block Block, units []string) string {
+	switch block.Kind {
+	case BlockTable:
+		rows := append(append([]string{}, block.Header...), units...)
+		return strings.Join(rows, "\n")
+	case BlockCode:
+		closing := strings.TrimLeft(block.Fence, " \t")
+		closing = closing[:len(closing)-len(strings.TrimLeft(closing, "`~"))]
+		return block.Fence + "\n" + strings.Join(units, "\n") + "\n" + closing
+	case BlockList:
+		return strings.Join(units, "\n")
+	default:
+		return strings.Join(units, "\n\n")
+	}
+}
+
+// splitOversizedUnits 把超过 limit 的单个单位按句子或长度拆开
+func splitOversizedUnits(block Block, limit int) []string {
+	out := make([]string, 0, len(block.Units))
+	for _, unit := range block.Units {
+		if EstimateTokens(unit) <= limit {
+			out = append(out, unit)
+			continue
+		}
+		out = append(out, splitByTokens(unit, limit)...)
+	}
+	return out
+}
+
+// splitByTokens 在不超过 limit 的前提下尽量于句末切分文本；逐字累加的估计与 EstimateTokens 口径一致但偏保守
+func splitByTokens(text string, limit int) []string {
+	runes := []rune(text)
+	pieces := make([]string, 0)
+	start := 0
+	for start < len(runes) {
+		end := start
+		lastBreak := -1
+		cost := 0.0
+		for end < len(runes) {
+			r := runes[end]
+			switch {
+			case unicode.IsSpace(r):
+			case unicode.IsLetter(r) && !isCJK(r), unicode.IsDigit(r):
+				cost += 0.25
+			default:
+				cost++
+			}
+			if cost > float64(limit) {
+				break
+			}
+			end++
+			if strings.ContainsRune(mdSentenceEndings, r) || r == '\n' {
+				lastBreak = end
+			}
+		}
+		if end < len(runes) && lastBreak > start {
+			end = lastBreak
+		}
+		if end == start {
+			end = start + 1
+		}
+		if piece := strings.TrimSpace(string(runes[start:end])); piece != "" {
+			pieces = append(pieces, piece)
+		}
+		start = end
+	}
+	return pieces
+}
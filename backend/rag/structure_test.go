@@ -0,0 +1,139 @@
+package rag
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseChunkStrategy(t *testing.T) {
+	cases := []struct {
+		raw, filename string
+		want          ChunkStrategy
+		ok            bool
+	}{
+		{"", "notes.md", ChunkStructured, true},
+		{"", "notes.docx", ChunkStructured, true},
+		{"", "notes.pdf", ChunkFixed, true},
+		{"Fixed", "notes.md", ChunkFixed, true},
+		{"structured", "notes.txt", ChunkStructured, true},
+		{"semantic", "notes.md", ChunkFixed, false},
+	}
+	for _, tc := range cases {
+		got, ok := ParseChunkStrategy(tc.raw, tc.filename)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("ParseChunkStrategy(%q, %q) = %q, %v; want %q, %v", tc.raw, tc.filename, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestParseMarkdownBlocks(t *testing.T) {
+	text := "# 第二章 栈\n\n栈是后进先出的线性表。\n\n- 入栈\n- 出栈\n  返回栈顶元素\n\n| 操作 | 复杂度 |\n| --- | --- |\n| push | O(1) |\n\n```go\nfunc push() {}\n```"
+	blocks := ParseMarkdownBlocks(text)
+
+	kinds := []BlockKind{BlockHeading, BlockParagraph, BlockList, BlockTable, BlockCode}
+	if len(blocks) != len(kinds) {
+		t.Fatalf("expected %d blocks, got %d: %+v", len(kinds), len(blocks), blocks)
+	}
+	for i, kind := range kinds {
+		if blocks[i].Kind != kind {
+			t.Fatalf("block %d: expected kind %d, got %d", i, kind, blocks[i].Kind)
+		}
+	}
+	if blocks[0].Level != 1 || blocks[0].Text != "第二章 栈" {
+		t.Fatalf("unexpected heading: %+v", blocks[0])
+	}
+	if len(blocks[2].Units) != 2 || !strings.Contains(blocks[2].Units[1], "返回栈顶元素") {
+		t.Fatalf("list continuation should stay with its item: %q", blocks[2].Units)
+	}
+	if len(blocks[3].Header) != 2 || len(blocks[3].Units) != 1 {
+		t.Fatalf("unexpected table split: header=%q rows=%q", blocks[3].Header, blocks[3].Units)
+	}
+	if len(blocks[4].Units) != 1 || blocks[4].Fence != "```go" {
+		t.Fatalf("unexpected code block: %+v", blocks[4])
+	}
+}
+
+func TestChunkBlocksKeepsHeadingPath(t *testing.T) {
+	text := "# 第二章 栈\n\n## 2.1 顺序栈\n\n顺序栈用数组实现。\n\n## 2.2 链栈\n\n链栈用链表实现。"
+	chunks := ChunkBlocks(ParseMarkdownBlocks(text), 400)
+	if len(chunks) != 2 {
+		t.Fatalf("expected one chunk per section, got %d: %+v", len(chunks), chunks)
+	}
+	if chunks[0].Meta.Section != "第二章 栈 > 2.1 顺序栈" {
+		t.Fatalf("unexpected section: %q", chunks[0].Meta.Section)
+	}
+	if !strings.HasPrefix(chunks[1].Content, "第二章 栈 > 2.2 链栈\n\n链栈") {
+		t.Fatalf("chunk content should start with its heading path: %q", chunks[1].Content)
+	}
+}
+
+func TestChunkBlocksSplitsTableByRows(t *testing.T) {
+	var builder strings.Builder
+	builder.WriteString("## 成绩表\n\n| 学号 | 姓名 | 说明 |\n| --- | --- | --- |\n")
+	for i := 0; i < 40; i++ {
+		builder.WriteString("| 2024001 | 张三 | 本学期平时成绩良好，期末考试发挥稳定 |\n")
+	}
+	chunks := ChunkBlocks(ParseMarkdownBlocks(builder.String()), 120)
+	if len(chunks) < 2 {
+		t.Fatalf("expected table to be split, got %d chunks", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if EstimateTokens(chunk.Content) > 120 {
+			t.Fatalf("chunk %d exceeds token budget: %d", i, EstimateTokens(chunk.Content))
+		}
+		lines := strings.Split(chunk.Content, "\n")
+		if lines[2] != "| 学号 | 姓名 | 说明 |" {
+			t.Fatalf("chunk %d should repeat the table header, got %q", i, lines[2])
+		}
+		for _, line := range lines[2:] {
+			if !strings.HasPrefix(line, "|") || !strings.HasSuffix(line, "|") {
+				t.Fatalf("chunk %d split a table row: %q", i, line)
+			}
+		}
+	}
+}
+
+func TestExtractStructuredSegmentsDOCX(t *testing.T) {
+	parts := map[string]string{
+		"word/styles.xml": `<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:style w:styleId="1"><w:name w:val="heading 1"/></w:style></w:styles>`,
+		"word/document.xml": `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:pPr><w:pStyle w:val="1"/></w:pPr><w:r><w:t>排序算法</w:t></w:r></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/></w:numPr></w:pPr><w:r><w:t>冒泡排序</w:t></w:r></w:p>
+<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/></w:numPr></w:pPr><w:r><w:t>快速排序</w:t></w:r></w:p>
+<w:tbl><w:tr><w:tc><w:p><w:r><w:t>算法</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>平均</w:t></w:r></w:p></w:tc></w:tr>
+<w:tr><w:tc><w:p><w:r><w:t>快排</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>O(n log n)</w:t></w:r></w:p></w:tc></w:tr></w:tbl>
+</w:body></w:document>`,
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+
+	segments, err := ExtractStructuredSegments("sorting.docx", bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("ExtractStructuredSegments: %v", err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("expected 1 segment, got %d", len(segments))
+	}
+	want := "# 排序算法\n\n- 冒泡排序\n- 快速排序\n\n| 算法 | 平均 |\n| --- | --- |\n| 快排 | O(n log n) |"
+	if segments[0].Text != want {
+		t.Fatalf("unexpected markdown:\n%s", segments[0].Text)
+	}
+
+	chunks := ChunkStructuredSegments(segments, 400)
+	if len(chunks) != 1 || chunks[0].Meta.Section != "排序算法" {
+		t.Fatalf("unexpected chunks: %+v", chunks)
+	}
+}
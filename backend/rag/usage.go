@@ -0,0 +1,96 @@
+package rag
+
+import "time"
+
+// 模型调用类型
+const (
+	UsageChat      = "chat"
+	UsageEmbedding = "embedding"
+)
+
+// Usage 一次模型调用的计量信息。上游没有返回用量（如 OpenAI 兼容接口的流式回答）时
+// 按 EstimateTokens 估算并将 Estimated 置为 true
+type Usage struct {
+	Provider         string
+	Operation        string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Latency          time.Duration
+	Estimated        bool
+	Err              error
+}
+
+// UsageFunc 接收每次模型调用结束后的计量信息，调用失败时同样回报（Err 非空）
+type UsageFunc func(Usage)
+
+func (f UsageFunc) report(usage Usage, start time.Time) {
+	if f == nil {
+		return
+	}
+	usage.Latency = time.Since(start)
+	f(usage)
+}
+
+// estimateChatUsage 按消息与回答的字符数估算对话用量
+func estimateChatUsage(messages []ChatMessage, answer string) (int, int) {
+	prompt := 0
+	for _, message := range messages {
+		prompt += EstimateTokens(message.Content)
+	}
+	return prompt, EstimateTokens(answer)
+}
+
+// estimateEmbeddingUsage 按输入文本估算向量化用量
+func estimateEmbeddingUsage(texts []string) int {
+	total := 0
+	for _, text := range texts {
+		total += EstimateTokens(text)
+	}
+	return total
+}
+
+// tokenCounts 上游返回的用量，零值表示上游没有返回
+type tokenCounts struct {
+	prompt     int
+	completion int
+}
+
+// reportChat 回报一次对话调用，上游没有返回用量时按消息与回答估算
+func (f UsageFunc) reportChat(provider, model string, start time.Time, messages []ChatMessage, answer string, counts tokenCounts, err error) {
+	if f == nil {
+		return
+	}
+	usage := Usage{
+		Provider:         provider,
+		Operation:        UsageChat,
+		Model:            model,
+		PromptTokens:     counts.prompt,
+		CompletionTokens: counts.completion,
+		Err:              err,
+	}
+	if counts.prompt == 0 && counts.completion == 0 {
+		usage.PromptTokens, usage.CompletionTokens = estimateChatUsage(messages, answer)
+		usage.Estimated = true
+	}
+	f.report(usage, start)
+}
+
+// reportEmbedding 回报一次向量化调用，上游没有返回用量时按输入文本估算
+func (f UsageFunc) reportEmbedding(provider, model string, start time.Time, texts []string, promptTokens int, err error) {
+	if f == nil {
+		return
+	}
+	usage := Usage{
+		Provider:     provider,
+		Operation:    UsageEmbedding,
+		Model:        model,
+		PromptTokens: promptTokens,
+		Err:          err,
+	}
+	if promptTokens == 0 {
+		usage.PromptTokens = estimateEmbeddingUsage(texts)
+		usage.Estimated = true
+	}
+	f.report(usage, start)
+}
@@ -0,0 +1,83 @@
+import React from 'react'
+import { Button, Checkbox, Form, Input, InputNumber, Select, Space, Typography } from 'antd'
+import { DeleteOutlined, PlusOutlined } from '@ant-design/icons'
+import { CODE_LANGUAGE_LABELS } from '@/utils/examAnswer'
+
+const { Text } = Typography
+const { TextArea } = Input
+
+// 编程题评测配置的表单项（语言、时间/内存限制、测试用例），需放在 Form 内使用，
+// 字段名与 codeSpecFormValues / buildCodeSpec 对应
+const CodeJudgeConfigFields: React.FC = () => (
+  <>
+    <Space align="start" style={{ display: 'flex' }} wrap>
+      <Form.Item name="code_languages" label="允许的语言" extra="不选表示评测机支持的语言都可以">
+        <Select mode="multiple" allowClear placeholder="不限" style={{ minWidth: '240px' }}>
+          {Object.entries(CODE_LANGUAGE_LABELS).map(([value, label]) => (
+            <Select.Option key={value} value={value}>
+              {label}
+            </Select.Option>
+          ))}
+        </Select>
+      </Form.Item>
+      <Form.Item name="code_time_limit" label="时间限制" rules={[{ required: true, message: '请输入时间限制' }]}>
+        <InputNumber min={100} max={10000} step={100} style={{ width: '150px' }} addonAfter="ms" />
+      </Form.Item>
+      <Form.Item name="code_memory_limit" label="内存限制" rules={[{ required: true, message: '请输入内存限制' }]}>
+        <InputNumber min={16} max={1024} step={16} style={{ width: '150px' }} addonAfter="MB" />
+      </Form.Item>
+    </Space>
+    <Form.List
+      name="code_cases"
+      rules={[
+        {
+          validator: async (_, cases) => {
+            if (!cases || cases.length === 0) throw new Error('请至少添加一个测试用例');
+          },
+        },
+      ]}
+    >
+      {(fields, { add, remove }, { errors }) => (
+        <div style={{ marginBottom: '16px' }}>
+          <Text strong>测试用例</Text>
+          <Text type="secondary" style={{ marginLeft: '8px' }}>
+            程序从标准输入读取，输出与期望输出比对（忽略行尾空格和末尾空行）；勾选为样例的用例展示给学生，其余为隐藏用例
+          </Text>
+          {fields.map((field, index) => (
+            <Space key={field.key} align="start" style={{ display: 'flex', marginTop: '8px' }}>
+              <Text type="secondary" style={{ lineHeight: '32px' }}>
+                #{index + 1}
+              </Text>
+              <Form.Item name={[field.name, 'input']} style={{ marginBottom: 0 }}>
+                <TextArea rows={2} placeholder="输入" style={{ width: '260px', fontFamily: 'monospace' }} />
+              </Form.Item>
+              <Form.Item
+                name={[field.name, 'output']}
+                style={{ marginBottom: 0 }}
+                rules={[{ required: true, whitespace: true, message: '请输入期望输出' }]}
+              >
+                <TextArea rows={2} placeholder="期望输出" style={{ width: '260px', fontFamily: 'monospace' }} />
+              </Form.Item>
+              <Form.Item name={[field.name, 'sample']} valuePropName="checked" style={{ marginBottom: 0 }}>
+                <Checkbox>样例</Checkbox>
+              </Form.Item>
+              <Button danger size="small" icon={<DeleteOutlined />} onClick={() => remove(field.name)} />
+            </Space>
+          ))}
+          <Button
+            type="dashed"
+            icon={<PlusOutlined />}
+            style={{ marginTop: '8px' }}
+            onClick={() => add({ input: '', output: '', sample: false })}
+            disabled={fields.length >= 50}
+          >
+            添加测试用例
+          </Button>
+          <Form.ErrorList errors={errors} />
+        </div>
+      )}
+    </Form.List>
+  </>
+)
+
+export default CodeJudgeConfigFields
@@ -0,0 +1,74 @@
+import React from 'react'
+import { Space, Table, Tag, Typography } from 'antd'
+import type { CodeJudgeResult, CodeJudgeStatus } from '@/services/examService'
+import { CODE_JUDGE_STATUS_LABELS, CODE_VERDICT_LABELS } from '@/utils/examAnswer'
+
+const { Text } = Typography
+
+interface CodeJudgeResultViewProps {
+  status?: CodeJudgeStatus
+  result?: CodeJudgeResult
+}
+
+const verdictTag = (verdict: string) => {
+  const meta = CODE_VERDICT_LABELS[verdict]
+  return <Tag color={meta?.color}>{meta?.text || verdict}</Tag>
+}
+
+// 编程题 / 自动评测作业的评测状态与逐个测试用例的结果，考试与作业页面共用
+const CodeJudgeResultView: React.FC<CodeJudgeResultViewProps> = ({ status, result }) => {
+  if (!status && !result) return null
+
+  return (
+    <Space direction="vertical" style={{ width: '100%' }}>
+      <Space wrap>
+        {status && (
+          <Tag color={status === 'done' ? 'blue' : status === 'failed' ? 'red' : 'default'}>
+            {CODE_JUDGE_STATUS_LABELS[status] || status}
+          </Tag>
+        )}
+        {result && (
+          <>
+            {verdictTag(result.verdict)}
+            <Text type="secondary">通过 {result.passed} / {result.total} 个测试用例</Text>
+            {!result.isolated && <Tag color="orange">未启用沙箱隔离</Tag>}
+          </>
+        )}
+      </Space>
+      {result?.compileOutput && (
+        <pre style={{ margin: 0, padding: '8px', background: '#fff1f0', whiteSpace: 'pre-wrap', fontSize: '12px' }}>
+          {result.compileOutput}
+        </pre>
+      )}
+      {result && result.cases.length > 0 && (
+        <Table
+          size="small"
+          pagination={false}
+          rowKey={(_, index) => String(index)}
+          dataSource={result.cases}
+          columns={[
+            { title: '用例', key: 'index', width: 70, render: (_: any, __: any, index: number) => `#${index + 1}` },
+            { title: '结果', dataIndex: 'verdict', key: 'verdict', width: 110, render: verdictTag },
+            { title: '耗时', dataIndex: 'timeMs', key: 'timeMs', width: 90, render: (ms: number) => `${ms} ms` },
+            {
+              title: '内存',
+              dataIndex: 'memoryKb',
+              key: 'memoryKb',
+              width: 100,
+              render: (kb: number) => (kb > 0 ? `${(kb / 1024).toFixed(1)} MB` : '—'),
+            },
+            {
+              title: '信息',
+              dataIndex: 'message',
+              key: 'message',
+              render: (msg?: string) =>
+                msg ? <Text type="secondary" style={{ whiteSpace: 'pre-wrap', fontSize: '12px' }}>{msg}</Text> : null,
+            },
+          ]}
+        />
+      )}
+    </Space>
+  )
+}
+
+export default CodeJudgeResultView
@@ -8,6 +8,7 @@ const { Text } = Typography
 const providerOptions: Array<{ label: string; value: RagProvider }> = [
   { label: '阿里 DashScope', value: 'dashscope' },
   { label: 'OpenRouter', value: 'openrouter' },
+  { label: 'Anthropic', value: 'anthropic' },
 ]
 
 const RagApiKeyControl: React.FC = () => {
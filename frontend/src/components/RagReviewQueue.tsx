@@ -0,0 +1,206 @@
+import React, { useEffect, useState } from 'react'
+import {
+  Button,
+  Card,
+  Empty,
+  Input,
+  List,
+  Modal,
+  Segmented,
+  Space,
+  Tag,
+  Typography,
+  message,
+} from 'antd'
+import { AuditOutlined, DislikeOutlined } from '@ant-design/icons'
+import ragService, { type RagReviewItem } from '@/services/ragService'
+
+const { Text, Paragraph } = Typography
+const { TextArea } = Input
+
+type ReviewReason = 'all' | 'low_rated' | 'no_evidence'
+
+interface RagReviewQueueProps {
+  courseId: number
+}
+
+// 教师审核学生点踩或“未找到足够依据”的问答，并撰写标准答案供后续检索优先使用
+const RagReviewQueue: React.FC<RagReviewQueueProps> = ({ courseId }) => {
+  const [items, setItems] = useState<RagReviewItem[]>([])
+  const [loading, setLoading] = useState(false)
+  const [reason, setReason] = useState<ReviewReason>('all')
+  const [editing, setEditing] = useState<RagReviewItem | null>(null)
+  const [question, setQuestion] = useState('')
+  const [answer, setAnswer] = useState('')
+  const [saving, setSaving] = useState(false)
+
+  const load = async () => {
+    setLoading(true)
+    try {
+      const data = await ragService.listReviewQueue(courseId, {
+        reason: reason === 'all' ? undefined : reason,
+      })
+      setItems(Array.isArray(data) ? data : [])
+    } catch {
+      // 忽略权限错误
+    } finally {
+      setLoading(false)
+    }
+  }
+
+  useEffect(() => {
+    if (courseId) load()
+  }, [courseId, reason])
+
+  const openEditor = (item: RagReviewItem) => {
+    setEditing(item)
+    setQuestion(item.rewritten_query || item.question)
+    setAnswer('')
+  }
+
+  const handleSave = async () => {
+    if (!editing || !answer.trim()) {
+      message.warning('请填写标准答案')
+      return
+    }
+    setSaving(true)
+    try {
+      await ragService.saveCanonicalAnswer(
+        courseId,
+        editing.query_id,
+        answer.trim(),
+        question.trim()
+      )
+      message.success('标准答案已加入知识库')
+      setEditing(null)
+      await load()
+    } catch (e: any) {
+      message.error(e?.message || '保存失败')
+    } finally {
+      setSaving(false)
+    }
+  }
+
+  const handleDismiss = async (item: RagReviewItem) => {
+    try {
+      await ragService.dismissReview(courseId, item.query_id)
+      setItems(prev => prev.filter(i => i.query_id !== item.query_id))
+    } catch (e: any) {
+      message.error(e?.message || '操作失败')
+    }
+  }
+
+  return (
+    <Card
+      style={{ marginTop: 16 }}
+      title={
+        <Space>
+          <AuditOutlined />
+          <span>问答审核</span>
+        </Space>
+      }
+      extra={
+        <Segmented
+          size="small"
+          value={reason}
+          onChange={v => setReason(v as ReviewReason)}
+          options={[
+            { label: '全部', value: 'all' },
+            { label: '学生点踩', value: 'low_rated' },
+            { label: '资料不足', value: 'no_evidence' },
+          ]}
+        />
+      }
+    >
+      {items.length === 0 && !loading ? (
+        <Empty description="暂无待审核问答" />
+      ) : (
+        <List
+          loading={loading}
+          dataSource={items}
+          renderItem={item => (
+            <List.Item
+              actions={[
+                <Button
+                  key="answer"
+                  type="link"
+                  size="small"
+                  onClick={() => openEditor(item)}
+                >
+                  写标准答案
+                </Button>,
+                <Button
+                  key="dismiss"
+                  type="link"
+                  size="small"
+                  onClick={() => handleDismiss(item)}
+                >
+                  忽略
+                </Button>,
+              ]}
+            >
+              <List.Item.Meta
+                title={
+                  <Space wrap>
+                    <Text strong>{item.question}</Text>
+                    {item.no_evidence && <Tag color="orange">资料不足</Tag>}
+                    {item.feedback?.rating === -1 && (
+                      <Tag color="red" icon={<DislikeOutlined />}>
+                        点踩
+                      </Tag>
+                    )}
+                  </Space>
+                }
+                description={
+                  <>
+                    <Text type="secondary" style={{ fontSize: 12 }}>
+                      {item.username} · {item.created_at?.slice(0, 10)}
+                    </Text>
+                    <Paragraph
+                      ellipsis={{ rows: 2, expandable: true }}
+                      style={{ margin: '4px 0 0' }}
+                    >
+                      {item.answer}
+                    </Paragraph>
+                    {item.feedback?.comment && (
+                      <Text type="danger" style={{ fontSize: 12 }}>
+                        学生反馈：{item.feedback.comment}
+                      </Text>
+                    )}
+                  </>
+                }
+              />
+            </List.Item>
+          )}
+        />
+      )}
+
+      <Modal
+        title="撰写标准答案"
+        open={!!editing}
+        onOk={handleSave}
+        onCancel={() => setEditing(null)}
+        confirmLoading={saving}
+        okText="保存并加入知识库"
+        cancelText="取消"
+      >
+        <Text type="secondary" style={{ fontSize: 12 }}>
+          问题（检索时按此匹配相似提问）
+        </Text>
+        <Input
+          value={question}
+          onChange={e => setQuestion(e.target.value)}
+          style={{ marginBottom: 12 }}
+        />
+        <TextArea
+          value={answer}
+          onChange={e => setAnswer(e.target.value)}
+          autoSize={{ minRows: 4, maxRows: 10 }}
+          placeholder="填写面向学生的标准答案"
+        />
+      </Modal>
+    </Card>
+  )
+}
+
+export default RagReviewQueue
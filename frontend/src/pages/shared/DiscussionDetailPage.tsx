@@ -184,17 +184,24 @@ const DiscussionDetailPage: React.FC<Props> = ({ backTo }) => {
             <Text>{discussion?.content}</Text>
           </div>
 
-          {(discussion as any)?.aiDraft && (
+          {discussion?.aiDraft ? (
             <div style={{ marginTop: 16 }}>
-              <Tooltip title={`AI Confidence: ${(discussion as any).confidenceScore * 100}%`}>
+              <Tooltip title={`AI 置信度：${Math.round((discussion.confidenceScore ?? 0) * 100)}%`}>
                 <Alert
-                  message={<span><RobotOutlined style={{ marginRight: 8 }} />AI 智能摘要</span>}
+                  message={<span><RobotOutlined style={{ marginRight: 8 }} />AI 助教参考回答</span>}
                   description={
                     <div>
-                      <Text italic>{(discussion as any).aiDraft}</Text>
-                      {(discussion as any).linkedKnowledge && (
+                      <Text italic style={{ whiteSpace: 'pre-wrap' }}>{discussion.aiDraft}</Text>
+                      {!!discussion.linkedKnowledge?.length && (
                         <div style={{ marginTop: 8 }}>
-                          <Button type="link" size="small" href={(discussion as any).linkedKnowledge} target="_blank">关联知识点</Button>
+                          <Text type="secondary">关联知识点：</Text>
+                          <Space size={[4, 4]} wrap>
+                            {discussion.linkedKnowledge.map(link => (
+                              <Tag key={link.chunkId} color={link.canonical ? 'gold' : 'blue'}>
+                                [{link.citation}] {link.filename}{link.location ? ` · ${link.location}` : ''}
+                              </Tag>
+                            ))}
+                          </Space>
                         </div>
                       )}
                     </div>
@@ -204,6 +211,10 @@ const DiscussionDetailPage: React.FC<Props> = ({ backTo }) => {
                 />
               </Tooltip>
             </div>
+          ) : (discussion?.aiStatus === 'pending' || discussion?.aiStatus === 'processing') && (
+            <div style={{ marginTop: 16 }}>
+              <Text type="secondary"><RobotOutlined style={{ marginRight: 8 }} />AI 助教正在根据课程资料生成参考回答…</Text>
+            </div>
           )}
         </Card>
 
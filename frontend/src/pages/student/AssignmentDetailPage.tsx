@@ -1,7 +1,7 @@
 import React, { useEffect, useState } from 'react';
 import {
   Card, Row, Col, Button, Typography, Space, Form, Input,
-  message, Spin, Tag, Divider, Upload, Alert,
+  message, Spin, Tag, Divider, Upload, Alert, Select,
 } from 'antd';
 import type { UploadFile, UploadProps } from 'antd';
 import {
@@ -27,6 +27,8 @@ import {
 } from '../../store/slices/assignmentSlice';
 import { uploadFile } from '../../services/fileService';
 import { assignmentService, type AssignmentSubmission } from '../../services/assignmentService';
+import CodeJudgeResultView from '../../components/CodeJudgeResultView';
+import { CODE_LANGUAGE_LABELS } from '../../utils/examAnswer';
 
 const { Title, Text, Paragraph } = Typography;
 const { TextArea } = Input;
@@ -57,7 +59,15 @@ const AssignmentDetailPage: React.FC = () => {
         studentId: currentUser.userId,
       });
       const list = result as unknown as AssignmentSubmission[];
-      setMySubmission(list.length > 0 ? list[0] : null);
+      let submission = list.length > 0 ? list[0] : null;
+      // 列表不含评测结果，自动评测的作业需要从提交详情中获取
+      if (submission) {
+        try {
+          const detail = await assignmentService.getSubmissionDetail(submission.id) as unknown as AssignmentSubmission;
+          submission = { ...submission, ...detail };
+        } catch { /* ignore */ }
+      }
+      setMySubmission(submission);
     } catch {
       // 未提交时后端可能返回空数组，忽略错误
     } finally {
@@ -89,6 +99,7 @@ const AssignmentDetailPage: React.FC = () => {
         data: {
           content: values.content,
           attachments: attachmentURLs.length > 0 ? JSON.stringify(attachmentURLs) : undefined,
+          language: assignment?.code ? values.language : undefined,
         },
       })).unwrap();
 
@@ -232,6 +243,24 @@ const AssignmentDetailPage: React.FC = () => {
                 </>
               )}
 
+              {/* ── 自动评测结果 ── */}
+              {isSubmitted && mySubmission?.judgeStatus && (
+                <>
+                  <Divider style={{ margin: '8px 0' }} />
+                  <div>
+                    <Space style={{ display: 'flex', justifyContent: 'space-between' }}>
+                      <Title level={4} style={{ margin: 0 }}>
+                        评测结果{mySubmission.language ? `（${CODE_LANGUAGE_LABELS[mySubmission.language] || mySubmission.language}）` : ''}
+                      </Title>
+                      <Button size="small" onClick={fetchMySubmission}>刷新</Button>
+                    </Space>
+                    <div style={{ marginTop: 12 }}>
+                      <CodeJudgeResultView status={mySubmission.judgeStatus} result={mySubmission.judgeResult} />
+                    </div>
+                  </div>
+                </>
+              )}
+
               {/* ── 批改结果 ── */}
               {isGraded && (
                 <>
@@ -291,14 +320,60 @@ const AssignmentDetailPage: React.FC = () => {
                   <Divider style={{ margin: '8px 0' }} />
                   <div>
                     <Title level={4}>提交作业</Title>
-                    <Form form={form} layout="vertical" onFinish={handleSubmit}>
-                      <Form.Item
-                        label="作业内容"
-                        name="content"
-                        rules={[{ required: true, message: '请输入作业内容' }]}
-                      >
-                        <TextArea rows={8} placeholder="请输入您的作业答案..." showCount maxLength={5000} />
-                      </Form.Item>
+                    <Form
+                      form={form}
+                      layout="vertical"
+                      onFinish={handleSubmit}
+                      initialValues={{ language: assignment.code?.languages[0] }}
+                    >
+                      {assignment.code ? (
+                        <>
+                          <Text type="secondary" style={{ display: 'block', marginBottom: 12 }}>
+                            本作业开启了自动评测：时间限制 {assignment.code.timeLimitMs} ms，内存限制 {assignment.code.memoryLimitMb} MB；
+                            程序从标准输入读取数据，向标准输出打印结果，提交后使用 {assignment.code.testCount} 个测试用例评测
+                          </Text>
+                          {assignment.code.samples.map((sample, idx) => (
+                            <Row gutter={12} key={idx} style={{ marginBottom: 12 }}>
+                              <Col span={12}>
+                                <Text type="secondary">样例输入 {idx + 1}</Text>
+                                <pre style={{ background: '#f5f5f5', padding: '8px', margin: 0 }}>{sample.input}</pre>
+                              </Col>
+                              <Col span={12}>
+                                <Text type="secondary">样例输出 {idx + 1}</Text>
+                                <pre style={{ background: '#f5f5f5', padding: '8px', margin: 0 }}>{sample.output}</pre>
+                              </Col>
+                            </Row>
+                          ))}
+                          <Form.Item
+                            label="编程语言"
+                            name="language"
+                            rules={[{ required: true, message: '请选择编程语言' }]}
+                          >
+                            <Select style={{ width: '200px' }} placeholder="选择编程语言">
+                              {assignment.code.languages.map((name) => (
+                                <Select.Option key={name} value={name}>
+                                  {CODE_LANGUAGE_LABELS[name] || name}
+                                </Select.Option>
+                              ))}
+                            </Select>
+                          </Form.Item>
+                          <Form.Item
+                            label="源代码"
+                            name="content"
+                            rules={[{ required: true, message: '请输入源代码' }]}
+                          >
+                            <TextArea rows={14} spellCheck={false} style={{ fontFamily: 'monospace' }} placeholder="在此编写程序..." showCount maxLength={65536} />
+                          </Form.Item>
+                        </>
+                      ) : (
+                        <Form.Item
+                          label="作业内容"
+                          name="content"
+                          rules={[{ required: true, message: '请输入作业内容' }]}
+                        >
+                          <TextArea rows={8} placeholder="请输入您的作业答案..." showCount maxLength={5000} />
+                        </Form.Item>
+                      )}
 
                       <Form.Item
                         label="附件上传（可选，最多5个文件）"
@@ -17,6 +17,7 @@ import {
   Divider,
   Empty,
   Tooltip,
+  Modal,
 } from 'antd'
 import {
   BookOutlined,
@@ -32,6 +33,8 @@ import {
   HistoryOutlined,
   DatabaseOutlined,
   CloudDownloadOutlined,
+  LikeOutlined,
+  DislikeOutlined,
 } from '@ant-design/icons'
 import { useParams, useNavigate } from 'react-router-dom'
 import { MarkdownRenderer } from '../../components'
@@ -57,6 +60,8 @@ interface QAItem {
   answer: string
   sources: RagSource[]
   loading?: boolean
+  queryId?: number
+  rating?: 1 | -1
 }
 
 const CourseDetailPage: React.FC = () => {
@@ -78,6 +83,8 @@ const CourseDetailPage: React.FC = () => {
   const [materialsLoading, setMaterialsLoading] = useState(false)
 
   const [qaList, setQaList] = useState<QAItem[]>([])
+  const [feedbackTarget, setFeedbackTarget] = useState<number | null>(null)
+  const [feedbackComment, setFeedbackComment] = useState('')
   const [question, setQuestion] = useState('')
   const [asking, setAsking] = useState(false)
   const [history, setHistory] = useState<RagQueryHistory[]>([])
@@ -179,6 +186,8 @@ const CourseDetailPage: React.FC = () => {
         question: item.question,
         answer: item.answer,
         sources: item.sources || [],
+        queryId: item.id,
+        rating: item.feedback?.rating,
       },
     ])
     setHistoryVisible(false)
@@ -204,6 +213,7 @@ const CourseDetailPage: React.FC = () => {
           answer: result.answer,
           sources: result.sources || [],
           loading: false,
+          queryId: result.query_id || undefined,
         },
       ])
     } catch (error: any) {
@@ -221,6 +231,31 @@ const CourseDetailPage: React.FC = () => {
     }
   }
 
+  const submitFeedback = async (
+    idx: number,
+    rating: 1 | -1,
+    comment?: string
+  ) => {
+    const item = qaList[idx]
+    if (!item?.queryId) return
+    try {
+      await ragService.submitFeedback(courseId, item.queryId, rating, comment)
+      setQaList(prev =>
+        prev.map((qa, i) => (i === idx ? { ...qa, rating } : qa))
+      )
+      if (rating === -1) message.success('感谢反馈，老师会复核这条回答')
+    } catch (error: any) {
+      message.error(error?.message || '提交反馈失败')
+    }
+  }
+
+  const handleDislikeSubmit = async () => {
+    if (feedbackTarget === null) return
+    await submitFeedback(feedbackTarget, -1, feedbackComment.trim())
+    setFeedbackTarget(null)
+    setFeedbackComment('')
+  }
+
   const handleCompleteChapter = async (chapterId: number) => {
     setSubmitting(chapterId)
     try {
@@ -379,6 +414,29 @@ const CourseDetailPage: React.FC = () => {
                     ))}
                   </div>
                 )}
+
+                {!item.loading && item.queryId && (
+                  <Space size={4} style={{ marginTop: 4 }}>
+                    <Button
+                      type="text"
+                      size="small"
+                      icon={<LikeOutlined />}
+                      style={{
+                        color: item.rating === 1 ? '#1890ff' : undefined,
+                      }}
+                      onClick={() => submitFeedback(idx, 1)}
+                    />
+                    <Button
+                      type="text"
+                      size="small"
+                      icon={<DislikeOutlined />}
+                      style={{
+                        color: item.rating === -1 ? '#ff4d4f' : undefined,
+                      }}
+                      onClick={() => setFeedbackTarget(idx)}
+                    />
+                  </Space>
+                )}
               </div>
             </div>
           </div>
@@ -475,6 +533,26 @@ const CourseDetailPage: React.FC = () => {
           )}
         </div>
       </div>
+
+      <Modal
+        title="这条回答有什么问题？"
+        open={feedbackTarget !== null}
+        onOk={handleDislikeSubmit}
+        onCancel={() => {
+          setFeedbackTarget(null)
+          setFeedbackComment('')
+        }}
+        okText="提交"
+        cancelText="取消"
+      >
+        <TextArea
+          value={feedbackComment}
+          onChange={e => setFeedbackComment(e.target.value)}
+          maxLength={1000}
+          autoSize={{ minRows: 3, maxRows: 6 }}
+          placeholder="可选：说明回答哪里不对或缺少什么内容"
+        />
+      </Modal>
     </div>
   )
 
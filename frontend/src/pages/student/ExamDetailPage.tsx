@@ -12,6 +12,8 @@ import {
 import { useNavigate, useParams } from 'react-router-dom';
 import { useAppDispatch, useAppSelector, selectCurrentExam, selectMyExamSubmission, selectExamLoading } from '../../store';
 import { fetchExam, fetchMySubmission, clearCurrentExam, clearMySubmission } from '../../store/slices/examSlice';
+import CodeJudgeResultView from '../../components/CodeJudgeResultView';
+import { CODE_LANGUAGE_LABELS, parseCodeSubmission } from '../../utils/examAnswer';
 
 const { Title, Text, Paragraph } = Typography;
 
@@ -89,6 +91,9 @@ const ExamDetailPage: React.FC = () => {
           'MULTIPLE_CHOICE': '多选题',
           'TRUE_FALSE': '判断题',
           'SHORT_ANSWER': '简答题',
+          'FILL_BLANK': '填空题',
+          'NUMERIC': '数值题',
+          'CODE': '编程题',
         };
         return typeMap[type] || type;
       },
@@ -251,14 +256,61 @@ const ExamDetailPage: React.FC = () => {
                                     <Paragraph>{record.options}</Paragraph>
                                   </div>
                                 )}
-                                <div style={{ marginBottom: '12px' }}>
-                                  <Text strong>您的答案：</Text>
-                                  <Paragraph style={{ color: '#1890ff' }}>{record.studentAnswer}</Paragraph>
-                                </div>
-                                <div>
-                                  <Text strong>正确答案：</Text>
-                                  <Paragraph style={{ color: '#52c41a' }}>{record.correctAnswer}</Paragraph>
-                                </div>
+                                {record.type === 'CODE' ? (
+                                  <>
+                                    <div style={{ marginBottom: '12px' }}>
+                                      <Text strong>您的代码：</Text>
+                                      {(() => {
+                                        const code = parseCodeSubmission(record.studentAnswer);
+                                        return (
+                                          <>
+                                            {code.language && <Tag style={{ marginLeft: '8px' }}>{CODE_LANGUAGE_LABELS[code.language] || code.language}</Tag>}
+                                            <pre style={{ marginTop: '8px', padding: '8px', background: '#fff', whiteSpace: 'pre-wrap' }}>
+                                              {code.source || '（未作答）'}
+                                            </pre>
+                                          </>
+                                        );
+                                      })()}
+                                    </div>
+                                    <div>
+                                      <Text strong>评测结果：</Text>
+                                      <div style={{ marginTop: '8px' }}>
+                                        <CodeJudgeResultView status={record.judgeStatus} result={record.judgeResult} />
+                                      </div>
+                                    </div>
+                                  </>
+                                ) : (
+                                  <>
+                                    <div style={{ marginBottom: '12px' }}>
+                                      <Text strong>您的答案：</Text>
+                                      <Paragraph style={{ color: '#1890ff' }}>{record.studentAnswer}</Paragraph>
+                                    </div>
+                                    <div>
+                                      <Text strong>正确答案：</Text>
+                                      <Paragraph style={{ color: '#52c41a' }}>{record.correctAnswer}</Paragraph>
+                                    </div>
+                                  </>
+                                )}
+                                {record.coaching ? (
+                                  <div style={{ marginTop: '12px' }}>
+                                    <Text strong>错题讲解：</Text>
+                                    <Paragraph style={{ whiteSpace: 'pre-wrap' }}>{record.coaching.explanation}</Paragraph>
+                                    {record.coaching.review.length > 0 && (
+                                      <Space size={[4, 4]} wrap>
+                                        <Text type="secondary">建议复习：</Text>
+                                        {record.coaching.review.map(item => (
+                                          <Tag key={item.chunkId} color="blue">
+                                            {item.filename}{item.section ? ` · ${item.section}` : item.location ? ` · ${item.location}` : ''}
+                                          </Tag>
+                                        ))}
+                                      </Space>
+                                    )}
+                                  </div>
+                                ) : (record.coachingStatus === 'pending' || record.coachingStatus === 'processing') && (
+                                  <div style={{ marginTop: '12px' }}>
+                                    <Text type="secondary">错题讲解生成中，请稍后刷新查看</Text>
+                                  </div>
+                                )}
                               </div>
                             ),
                           }}
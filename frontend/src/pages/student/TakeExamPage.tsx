@@ -1,5 +1,5 @@
 import React, { useEffect, useState, useRef } from 'react';
-import { Card, Row, Col, Button, Typography, Space, Radio, Checkbox, Input, message, Spin, Modal, Statistic } from 'antd';
+import { Card, Row, Col, Button, Typography, Space, Radio, Checkbox, Input, Select, message, Spin, Modal, Statistic } from 'antd';
 import { 
   ClockCircleOutlined,
   CheckCircleOutlined,
@@ -12,6 +12,7 @@ import axios from 'axios';
 import { useAppDispatch, useAppSelector, selectCurrentExam, selectExamQuestions, selectExamLoading } from '../../store';
 import { fetchExam, submitExam, clearCurrentExam } from '../../store/slices/examSlice';
 import { trace } from '@opentelemetry/api';
+import { CODE_LANGUAGE_LABELS, parseCodeSubmission, parseStudentBlanks } from '../../utils/examAnswer';
 
 const { Title, Text } = Typography;
 const { TextArea } = Input;
@@ -179,6 +180,21 @@ const TakeExamPage: React.FC = () => {
             <Text type="secondary" style={{ marginLeft: '12px' }}>
               ({question.score}分)
             </Text>
+            {question.scoringPolicy === 'partial' && (
+              <Text type="secondary" style={{ marginLeft: '8px' }}>漏选得一半分，错选不得分</Text>
+            )}
+            {question.scoringPolicy === 'proportional' && (
+              <Text type="secondary" style={{ marginLeft: '8px' }}>
+                {question.type === 'FILL_BLANK'
+                  ? '按答对的空数得分'
+                  : question.type === 'CODE'
+                    ? '按通过的测试用例数得分'
+                    : '按选对比例得分，错选抵扣'}
+              </Text>
+            )}
+            {question.wrongPenalty > 0 && (
+              <Text type="warning" style={{ marginLeft: '8px' }}>答错扣 {question.wrongPenalty} 分</Text>
+            )}
           </div>
 
           {question.type === 'SINGLE_CHOICE' && (
@@ -223,6 +239,84 @@ const TakeExamPage: React.FC = () => {
             </Radio.Group>
           )}
 
+          {question.type === 'FILL_BLANK' && (
+            <Space direction="vertical" style={{ width: '100%' }}>
+              {Array.from({ length: question.blankCount || 1 }).map((_, idx) => {
+                const blanks = parseStudentBlanks(answers[question.id]);
+                return (
+                  <Input
+                    key={idx}
+                    addonBefore={`第 ${idx + 1} 空`}
+                    value={blanks[idx] || ''}
+                    onChange={(e) => {
+                      const next = Array.from({ length: question.blankCount || 1 }, (_, i) => blanks[i] || '');
+                      next[idx] = e.target.value;
+                      handleAnswerChange(question.id, JSON.stringify(next));
+                    }}
+                  />
+                );
+              })}
+            </Space>
+          )}
+
+          {question.type === 'NUMERIC' && (
+            <Input
+              style={{ maxWidth: '320px' }}
+              placeholder={question.unit ? `请输入数值，默认单位 ${question.unit}` : '请输入数值'}
+              addonAfter={question.unit || undefined}
+              value={answers[question.id] || ''}
+              onChange={(e) => handleAnswerChange(question.id, e.target.value)}
+            />
+          )}
+
+          {question.type === 'CODE' && (() => {
+            const submission = parseCodeSubmission(answers[question.id]);
+            const languages: string[] = question.code?.languages || [];
+            const language = submission.language || languages[0] || '';
+            return (
+              <Space direction="vertical" style={{ width: '100%' }}>
+                {question.code && (
+                  <Text type="secondary">
+                    时间限制 {question.code.timeLimitMs} ms，内存限制 {question.code.memoryLimitMb} MB；
+                    程序从标准输入读取数据，向标准输出打印结果，交卷后使用 {question.code.testCount} 个测试用例评测
+                  </Text>
+                )}
+                {question.code?.samples?.map((sample: { input: string; output: string }, idx: number) => (
+                  <Row gutter={12} key={idx}>
+                    <Col span={12}>
+                      <Text type="secondary">样例输入 {idx + 1}</Text>
+                      <pre style={{ background: '#f5f5f5', padding: '8px', margin: 0 }}>{sample.input}</pre>
+                    </Col>
+                    <Col span={12}>
+                      <Text type="secondary">样例输出 {idx + 1}</Text>
+                      <pre style={{ background: '#f5f5f5', padding: '8px', margin: 0 }}>{sample.output}</pre>
+                    </Col>
+                  </Row>
+                ))}
+                <Select
+                  style={{ width: '200px' }}
+                  value={language || undefined}
+                  placeholder="选择编程语言"
+                  onChange={(value) => handleAnswerChange(question.id, JSON.stringify({ language: value, source: submission.source }))}
+                >
+                  {languages.map((name) => (
+                    <Select.Option key={name} value={name}>
+                      {CODE_LANGUAGE_LABELS[name] || name}
+                    </Select.Option>
+                  ))}
+                </Select>
+                <TextArea
+                  rows={12}
+                  spellCheck={false}
+                  style={{ fontFamily: 'monospace' }}
+                  placeholder="在此编写程序..."
+                  value={submission.source}
+                  onChange={(e) => handleAnswerChange(question.id, JSON.stringify({ language, source: e.target.value }))}
+                />
+              </Space>
+            );
+          })()}
+
           {question.type === 'SHORT_ANSWER' && (
             <TextArea
               rows={4}
@@ -1,13 +1,15 @@
 import React, { useEffect, useState } from 'react';
 import { useNavigate } from 'react-router-dom';
-import { Card, Row, Col, Button, Typography, Space, Form, Input, Select, DatePicker, message, Upload } from 'antd';
+import { Card, Row, Col, Button, Typography, Space, Form, Input, Select, DatePicker, message, Upload, Switch } from 'antd';
 import type { UploadFile, UploadProps } from 'antd';
-import { FileTextOutlined, CalendarOutlined, UploadOutlined } from '@ant-design/icons';
+import { FileTextOutlined, CalendarOutlined, UploadOutlined, CodeOutlined } from '@ant-design/icons';
 import dayjs from 'dayjs';
 import { uploadFile, deleteFile } from '../../../services/fileService';
 import { courseService, type Course } from '../../../services/courseService';
 import { assignmentService } from '../../../services/assignmentService';
 import { useAppSelector } from '../../../store';
+import CodeJudgeConfigFields from '../../../components/CodeJudgeConfigFields';
+import { buildCodeSpec } from '../../../utils/examAnswer';
 
 const { Title, Text } = Typography;
 const { Option } = Select;
@@ -23,6 +25,7 @@ const CreateAssignmentPage: React.FC = () => {
   const [coursesLoading, setCoursesLoading] = useState(true);
 
   const currentUser = useAppSelector((state: any) => state.auth.user);
+  const judgeEnabled = Form.useWatch('judge_enabled', form);
 
   useEffect(() => {
     fetchMyCourses();
@@ -57,6 +60,7 @@ const CreateAssignmentPage: React.FC = () => {
         content: values.content || undefined,
         deadline,
         attachments: attachmentURLs.length > 0 ? attachmentURLs : undefined,
+        judgeConfig: values.judge_enabled ? buildCodeSpec(values) : undefined,
       };
 
       await assignmentService.createAssignment(submitData);
@@ -145,6 +149,12 @@ const CreateAssignmentPage: React.FC = () => {
               onFinishFailed={onFinishFailed}
               autoComplete="off"
               layout="vertical"
+              initialValues={{
+                judge_enabled: false,
+                code_time_limit: 1000,
+                code_memory_limit: 256,
+                code_cases: [{ input: '', output: '', sample: true }],
+              }}
             >
               <Form.Item
                 name="courseId"
@@ -211,6 +221,17 @@ const CreateAssignmentPage: React.FC = () => {
                 </Upload>
               </Form.Item>
 
+              <Form.Item
+                name="judge_enabled"
+                label="自动评测"
+                valuePropName="checked"
+                extra="开启后学生可选择语言提交代码，由评测机运行测试用例；评测结果供批改参考，不会自动给出作业成绩"
+              >
+                <Switch />
+              </Form.Item>
+
+              {judgeEnabled && <CodeJudgeConfigFields />}
+
               <Form.Item>
                 <Space>
                   <Button
@@ -250,6 +271,16 @@ const CreateAssignmentPage: React.FC = () => {
                   可选，超过截止日期后学生无法提交
                 </Text>
               </div>
+
+              <div>
+                <div style={{ display: 'flex', alignItems: 'center', marginBottom: '8px' }}>
+                  <CodeOutlined style={{ color: '#eb2f96', marginRight: '8px' }} />
+                  <Text strong>自动评测</Text>
+                </div>
+                <Text type="secondary" style={{ fontSize: '12px' }}>
+                  可选，编程作业可配置测试用例，勾选为样例的用例会展示给学生
+                </Text>
+              </div>
             </Space>
           </Card>
         </Col>
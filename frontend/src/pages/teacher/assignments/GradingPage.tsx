@@ -11,6 +11,8 @@ import { useSearchParams } from 'react-router-dom';
 import { assignmentService, type AssignmentSubmission } from '../../../services/assignmentService';
 import { courseService, type Course } from '../../../services/courseService';
 import { useAppSelector } from '../../../store';
+import CodeJudgeResultView from '../../../components/CodeJudgeResultView';
+import { CODE_LANGUAGE_LABELS } from '../../../utils/examAnswer';
 
 const { TextArea } = Input;
 const { Text, Title } = Typography;
@@ -41,6 +43,9 @@ const GradingPage: React.FC = () => {
     open: false, submission: null,
   });
   const [grading, setGrading] = useState(false);
+  // 开启自动评测的作业：抽屉打开时加载提交详情中的评测结果
+  const [judgeDetail, setJudgeDetail] = useState<AssignmentSubmission | null>(null);
+  const [rejudging, setRejudging] = useState(false);
   const [form] = Form.useForm();
 
   // ── Load instructor's assignments ──────────────────────────────────────────
@@ -112,8 +117,17 @@ const GradingPage: React.FC = () => {
     loadStatistics(id);
   };
 
+  const loadJudgeDetail = async (submissionId: number) => {
+    try {
+      const res = await assignmentService.getSubmissionDetail(submissionId) as any;
+      setJudgeDetail(res?.judgeStatus ? res : null);
+    } catch { /* ignore */ }
+  };
+
   const openDrawer = (sub: AssignmentSubmission) => {
     setDrawer({ open: true, submission: sub });
+    setJudgeDetail(null);
+    loadJudgeDetail(sub.id);
     form.setFieldsValue({
       grade: sub.grade ?? undefined,
       feedback: sub.feedback ?? '',
@@ -122,9 +136,24 @@ const GradingPage: React.FC = () => {
 
   const closeDrawer = () => {
     setDrawer({ open: false, submission: null });
+    setJudgeDetail(null);
     form.resetFields();
   };
 
+  const handleRejudge = async () => {
+    if (!selectedId) return;
+    setRejudging(true);
+    try {
+      const res = await assignmentService.requeueAssignmentJudging(selectedId) as any;
+      message.success(`已重新加入评测队列（${res?.queued ?? 0} 份提交）`);
+      if (drawer.submission) loadJudgeDetail(drawer.submission.id);
+    } catch (e: any) {
+      message.error(e?.message || '重新评测失败');
+    } finally {
+      setRejudging(false);
+    }
+  };
+
   const handleGrade = async (values: { grade: number; feedback?: string }) => {
     if (!drawer.submission) return;
     setGrading(true);
@@ -377,6 +406,23 @@ const GradingPage: React.FC = () => {
               </div>
             )}
 
+            {/* Code Judge */}
+            {judgeDetail && (
+              <div>
+                <Space style={{ display: 'flex', justifyContent: 'space-between' }}>
+                  <Text strong>
+                    自动评测{judgeDetail.language ? `（${CODE_LANGUAGE_LABELS[judgeDetail.language] || judgeDetail.language}）` : ''}
+                  </Text>
+                  <Button size="small" loading={rejudging} onClick={handleRejudge}>
+                    重新评测全部提交
+                  </Button>
+                </Space>
+                <div style={{ marginTop: 8 }}>
+                  <CodeJudgeResultView status={judgeDetail.judgeStatus} result={judgeDetail.judgeResult} />
+                </div>
+              </div>
+            )}
+
             {/* Attachments */}
             {(() => {
               let urls: string[] = [];
@@ -17,6 +17,7 @@ import {
   Upload,
   Table,
   Popconfirm,
+  Tooltip,
 } from 'antd'
 import {
   ArrowLeftOutlined,
@@ -37,6 +38,7 @@ import {
 } from '@ant-design/icons'
 import { useParams, useNavigate } from 'react-router-dom'
 import RagApiKeyControl from '@/components/RagApiKeyControl'
+import RagReviewQueue from '@/components/RagReviewQueue'
 import { courseService, type CourseSection } from '@/services/courseService'
 import ragService, { type RagDocument } from '@/services/ragService'
 import { resolveFileUrl } from '@/utils/fileUrl'
@@ -108,11 +110,21 @@ const TeacherCourseViewPage: React.FC = () => {
     if (courseId) loadRagDocs()
   }, [courseId])
 
+  // 有文档仍在后台入库时轮询进度
+  const ragIngesting = ragDocs.some(
+    d => d.status === 'queued' || d.status === 'processing'
+  )
+  useEffect(() => {
+    if (!courseId || !ragIngesting) return
+    const timer = window.setInterval(loadRagDocs, 3000)
+    return () => window.clearInterval(timer)
+  }, [courseId, ragIngesting])
+
   const handleRagUpload = async (file: File) => {
     setRagUploading(true)
     try {
       await ragService.uploadDocument(courseId, file)
-      message.success(`已上传 ${file.name}，正在向量化...`)
+      message.success(`已上传 ${file.name}，正在后台解析并向量化...`)
       await loadRagDocs()
     } catch (e: any) {
       message.error(e?.message || '上传失败')
@@ -379,7 +391,7 @@ const TeacherCourseViewPage: React.FC = () => {
             }
             extra={
               <Upload
-                accept=".txt,.md,.docx"
+                accept=".txt,.md,.docx,.pdf,.pptx,.xlsx"
                 showUploadList={false}
                 beforeUpload={handleRagUpload}
               >
@@ -426,6 +438,36 @@ const TeacherCourseViewPage: React.FC = () => {
                     width: 70,
                     align: 'center' as const,
                   },
+                  {
+                    title: '状态',
+                    dataIndex: 'status',
+                    width: 90,
+                    align: 'center' as const,
+                    render: (_: any, record: RagDocument) => {
+                      switch (record.status) {
+                        case 'queued':
+                          return (
+                            <Tooltip title={record.error}>
+                              <Tag>排队中</Tag>
+                            </Tooltip>
+                          )
+                        case 'processing':
+                          return (
+                            <Tag color="processing">
+                              {record.progress ?? 0}%
+                            </Tag>
+                          )
+                        case 'failed':
+                          return (
+                            <Tooltip title={record.error}>
+                              <Tag color="error">失败</Tag>
+                            </Tooltip>
+                          )
+                        default:
+                          return <Tag color="success">就绪</Tag>
+                      }
+                    },
+                  },
                   {
                     title: '上传时间',
                     dataIndex: 'created_at',
@@ -456,6 +498,8 @@ const TeacherCourseViewPage: React.FC = () => {
               />
             )}
           </Card>
+
+          <RagReviewQueue courseId={courseId} />
         </Col>
 
         {/* ── 右栏：统计 + 快捷操作 ── */}
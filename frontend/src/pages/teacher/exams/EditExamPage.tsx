@@ -24,6 +24,7 @@ import {
 import {
   ArrowLeftOutlined,
   CheckCircleOutlined,
+  DatabaseOutlined,
   DeleteOutlined,
   EditOutlined,
   PlusOutlined,
@@ -33,10 +34,15 @@ import {
 } from '@ant-design/icons';
 import { useNavigate, useParams } from 'react-router-dom';
 import RagApiKeyControl from '@/components/RagApiKeyControl';
+import CodeJudgeConfigFields from '@/components/CodeJudgeConfigFields';
 import {
   examService,
+  type BankQuestion,
   type ConfirmParsedQuestionsRequest,
+  type ExamQuestionRule,
+  type ExamScoringPolicy,
   type ParsedExamQuestion,
+  type QuestionDifficulty,
 } from '@/services/examService';
 import {
   buildConfirmParsedQuestionsPayload,
@@ -48,6 +54,14 @@ import {
   type ParsedQuestionUI,
   validateParsedQuestionForConfirm,
 } from './parsedQuestionHelpers';
+import {
+  buildCodeSpec,
+  codeSpecFormValues,
+  formatBlankText,
+  formatExamAnswer,
+  parseBlankText,
+  parseNumericAnswer,
+} from '@/utils/examAnswer';
 
 const { Title, Text } = Typography;
 const { TextArea } = Input;
@@ -56,13 +70,22 @@ type QType =
   | 'SINGLE_CHOICE'
   | 'MULTIPLE_CHOICE'
   | 'TRUE_FALSE'
-  | 'SHORT_ANSWER';
+  | 'SHORT_ANSWER'
+  | 'FILL_BLANK'
+  | 'NUMERIC'
+  | 'CODE';
+
+// AI 解析不生成测试用例，解析结果不能改为编程题
+type ParsedQType = Exclude<QType, 'CODE'>;
 
 const TYPE_LABELS: Record<QType, string> = {
   SINGLE_CHOICE: '单选题',
   MULTIPLE_CHOICE: '多选题',
   TRUE_FALSE: '判断题',
   SHORT_ANSWER: '简答题',
+  FILL_BLANK: '填空题',
+  NUMERIC: '数值题',
+  CODE: '编程题',
 };
 
 const TYPE_COLORS: Record<QType, string> = {
@@ -70,10 +93,31 @@ const TYPE_COLORS: Record<QType, string> = {
   MULTIPLE_CHOICE: 'purple',
   TRUE_FALSE: 'cyan',
   SHORT_ANSWER: 'orange',
+  FILL_BLANK: 'gold',
+  NUMERIC: 'geekblue',
+  CODE: 'magenta',
 };
 
 const OPTION_LETTERS = ['A', 'B', 'C', 'D', 'E', 'F'];
 
+const SCORING_POLICY_LABELS: Record<ExamScoringPolicy, string> = {
+  all_or_nothing: '全部选对才得分',
+  proportional: '按比例得分（多选题错选抵扣，填空题按答对空数，编程题按通过用例数）',
+  partial: '漏选得一半分，错选不得分',
+};
+
+const DIFFICULTY_LABELS: Record<QuestionDifficulty, string> = {
+  easy: '简单',
+  medium: '中等',
+  hard: '困难',
+};
+
+const DIFFICULTY_COLORS: Record<QuestionDifficulty, string> = {
+  easy: 'green',
+  medium: 'gold',
+  hard: 'red',
+};
+
 interface Question {
   id: number;
   type: QType;
@@ -82,8 +126,35 @@ interface Question {
   answer: string;
   score: number;
   orderIndex: number;
+  rubric?: string;
+  scoringPolicy?: ExamScoringPolicy;
+  wrongPenalty?: number;
 }
 
+// 评分细则在表单中每行一个评分点，格式为“评分点描述 | 分值”，提交时转为 JSON 数组
+const formatRubricText = (rubric?: string) => {
+  if (!rubric) return '';
+  try {
+    const criteria: { description: string; points: number }[] = JSON.parse(rubric);
+    return criteria.map((item) => `${item.description} | ${item.points}`).join('\n');
+  } catch {
+    return '';
+  }
+};
+
+const parseRubricText = (text?: string) =>
+  (text || '')
+    .split('\n')
+    .map((line) => line.trim())
+    .filter(Boolean)
+    .map((line) => {
+      const separator = line.lastIndexOf('|');
+      return {
+        description: (separator >= 0 ? line.slice(0, separator) : line).trim(),
+        points: separator >= 0 ? Number(line.slice(separator + 1).trim()) : NaN,
+      };
+    });
+
 const EditExamPage: React.FC = () => {
   const { id } = useParams<{ id: string }>();
   const navigate = useNavigate();
@@ -113,6 +184,20 @@ const EditExamPage: React.FC = () => {
   );
   const [fallbackReason, setFallbackReason] = useState<string | undefined>();
 
+  const [rules, setRules] = useState<{ rule: ExamQuestionRule; available: number }[]>([]);
+  const [rulesLocked, setRulesLocked] = useState(false);
+  const [ruleModalOpen, setRuleModalOpen] = useState(false);
+  const [ruleSaving, setRuleSaving] = useState(false);
+  const [ruleForm] = Form.useForm();
+
+  const [bankModalOpen, setBankModalOpen] = useState(false);
+  const [bankLoading, setBankLoading] = useState(false);
+  const [bankQuestions, setBankQuestions] = useState<BankQuestion[]>([]);
+  const [bankTags, setBankTags] = useState<string[]>([]);
+  const [bankFilters, setBankFilters] = useState<{ tag?: string; difficulty?: QuestionDifficulty }>({});
+  const [selectedBankIds, setSelectedBankIds] = useState<number[]>([]);
+  const [bankAdding, setBankAdding] = useState(false);
+
   useEffect(() => {
     if (!id) return;
     loadExam(Number(id));
@@ -124,6 +209,7 @@ const EditExamPage: React.FC = () => {
       const res = (await examService.getExam(examId)) as any;
       setExam(res?.exam);
       setQuestions(res?.questions || []);
+      loadRules(examId);
     } catch {
       message.error('加载考试信息失败');
     } finally {
@@ -131,6 +217,95 @@ const EditExamPage: React.FC = () => {
     }
   };
 
+  const loadRules = async (examId: number) => {
+    try {
+      const res = await examService.getExamRules(examId);
+      setRules(res?.rules || []);
+      setRulesLocked(!!res?.locked);
+    } catch {
+      setRules([]);
+    }
+  };
+
+  const loadBank = async (filters = bankFilters) => {
+    if (!exam?.courseId) return;
+    setBankLoading(true);
+    try {
+      const res = await examService.listQuestionBank(exam.courseId, filters);
+      setBankQuestions(res?.questions || []);
+      setBankTags(res?.tags || []);
+    } catch {
+      message.error('加载题库失败');
+    } finally {
+      setBankLoading(false);
+    }
+  };
+
+  const openBankModal = () => {
+    setSelectedBankIds([]);
+    setBankModalOpen(true);
+    loadBank();
+  };
+
+  const handleBankFilterChange = (next: { tag?: string; difficulty?: QuestionDifficulty }) => {
+    setBankFilters(next);
+    loadBank(next);
+  };
+
+  const handleAddFromBank = async () => {
+    if (selectedBankIds.length === 0) {
+      message.warning('请先选择题目');
+      return;
+    }
+    setBankAdding(true);
+    try {
+      const res = await examService.addBankQuestionsToExam(Number(id), selectedBankIds);
+      message.success(`已从题库加入 ${res?.added ?? selectedBankIds.length} 道题目`);
+      setBankModalOpen(false);
+      loadExam(Number(id));
+    } catch (error: any) {
+      message.error(error?.response?.data?.message || '从题库加入题目失败');
+    } finally {
+      setBankAdding(false);
+    }
+  };
+
+  const openRuleModal = () => {
+    ruleForm.resetFields();
+    ruleForm.setFieldsValue({ count: 1, score: 0 });
+    setRuleModalOpen(true);
+    if (bankTags.length === 0) loadBank({});
+  };
+
+  const handleCreateRule = async () => {
+    try {
+      const values = await ruleForm.validateFields();
+      setRuleSaving(true);
+      await examService.createExamRule(Number(id), {
+        ...values,
+        orderIndex: questions.length + rules.length,
+      });
+      message.success('抽题规则已添加');
+      setRuleModalOpen(false);
+      loadRules(Number(id));
+    } catch (error: any) {
+      if (error?.errorFields) return;
+      message.error(error?.response?.data?.message || '添加抽题规则失败');
+    } finally {
+      setRuleSaving(false);
+    }
+  };
+
+  const handleDeleteRule = async (ruleId: number) => {
+    try {
+      await examService.deleteExamRule(Number(id), ruleId);
+      message.success('抽题规则已删除');
+      loadRules(Number(id));
+    } catch (error: any) {
+      message.error(error?.response?.data?.message || '删除抽题规则失败');
+    }
+  };
+
   const resetAiState = () => {
     setParsedQuestions([]);
     setOriginalQuestions([]);
@@ -144,7 +319,17 @@ const EditExamPage: React.FC = () => {
     setQuestionType('SINGLE_CHOICE');
     setOptionCount(4);
     form.resetFields();
-    form.setFieldsValue({ type: 'SINGLE_CHOICE', score: 5 });
+    form.setFieldsValue({
+      type: 'SINGLE_CHOICE',
+      score: 5,
+      scoring_policy: 'all_or_nothing',
+      wrong_penalty: 0,
+      numeric_tolerance_mode: 'absolute',
+      code_time_limit: 1000,
+      code_memory_limit: 256,
+      target: 'exam',
+      difficulty: 'medium',
+    });
     setModalOpen(true);
   };
 
@@ -166,6 +351,8 @@ const EditExamPage: React.FC = () => {
       type: question.type,
       stem: question.stem,
       score: question.score,
+      scoring_policy: question.scoringPolicy || 'all_or_nothing',
+      wrong_penalty: question.wrongPenalty || 0,
     };
 
     if (question.type === 'SINGLE_CHOICE' || question.type === 'MULTIPLE_CHOICE') {
@@ -179,8 +366,24 @@ const EditExamPage: React.FC = () => {
       }
     } else if (question.type === 'TRUE_FALSE') {
       values.answer_tf = question.answer;
+    } else if (question.type === 'FILL_BLANK') {
+      values.answer_blanks = formatBlankText(question.answer);
+    } else if (question.type === 'NUMERIC') {
+      const spec = parseNumericAnswer(question.answer);
+      values.numeric_value = spec?.value;
+      values.numeric_tolerance = spec?.relativeTolerance
+        ? spec.relativeTolerance * 100
+        : spec?.tolerance || 0;
+      values.numeric_tolerance_mode = spec?.relativeTolerance ? 'relative' : 'absolute';
+      values.numeric_unit = spec?.unit;
+      values.numeric_units = Object.entries(spec?.units || {})
+        .map(([unit, factor]) => `${unit} = ${factor}`)
+        .join('\n');
+    } else if (question.type === 'CODE') {
+      Object.assign(values, codeSpecFormValues(question.answer));
     } else {
       values.answer_text = question.answer;
+      values.rubric_text = formatRubricText(question.rubric);
     }
 
     form.setFieldsValue(values);
@@ -191,6 +394,7 @@ const EditExamPage: React.FC = () => {
     const type: QType = values.type;
     let options: string | undefined;
     let answer = '';
+    let rubric: string | undefined;
 
     if (type === 'SINGLE_CHOICE' || type === 'MULTIPLE_CHOICE') {
       const nextOptions: string[] = [];
@@ -204,8 +408,30 @@ const EditExamPage: React.FC = () => {
           : (values.answer_multi || []).join(',');
     } else if (type === 'TRUE_FALSE') {
       answer = values.answer_tf;
+    } else if (type === 'FILL_BLANK') {
+      answer = JSON.stringify(parseBlankText(values.answer_blanks));
+    } else if (type === 'NUMERIC') {
+      // 换算单位每行一个，格式：单位 = 换算到标准单位的倍数
+      const units: Record<string, number> = {};
+      (values.numeric_units || '').split('\n').forEach((line: string) => {
+        const [unit, factor] = line.split('=').map((item) => item.trim());
+        if (unit && Number(factor) > 0) units[unit] = Number(factor);
+      });
+      const tolerance = values.numeric_tolerance || 0;
+      answer = JSON.stringify({
+        value: values.numeric_value,
+        ...(values.numeric_tolerance_mode === 'relative'
+          ? { relativeTolerance: tolerance / 100 }
+          : { tolerance }),
+        unit: values.numeric_unit || undefined,
+        units: Object.keys(units).length > 0 ? units : undefined,
+      });
+    } else if (type === 'CODE') {
+      answer = buildCodeSpec(values);
     } else {
       answer = values.answer_text || '';
+      const criteria = parseRubricText(values.rubric_text);
+      rubric = criteria.length > 0 ? JSON.stringify(criteria) : '';
     }
 
     return {
@@ -213,8 +439,17 @@ const EditExamPage: React.FC = () => {
       stem: values.stem,
       options,
       answer,
+      rubric,
       score: values.score,
+      scoringPolicy:
+        type === 'MULTIPLE_CHOICE' || type === 'FILL_BLANK' || type === 'CODE'
+          ? values.scoring_policy
+          : undefined,
+      wrongPenalty: type === 'SHORT_ANSWER' || type === 'CODE' ? 0 : values.wrong_penalty || 0,
       orderIndex: editingQuestion ? editingQuestion.orderIndex : questions.length,
+      ...(editingQuestion
+        ? {}
+        : { target: values.target, difficulty: values.difficulty, tags: values.tags }),
     };
   };
 
@@ -253,6 +488,16 @@ const EditExamPage: React.FC = () => {
     }
   };
 
+  // 修改测试用例后，已评测的作答需要重新评测才会按新用例计分
+  const handleRejudge = async (questionId: number) => {
+    try {
+      const { queued } = await examService.requeueExamJudging(Number(id), questionId);
+      message.success(queued > 0 ? `已重新提交 ${queued} 份作答评测` : '没有需要重新评测的作答');
+    } catch {
+      message.error('重新评测失败');
+    }
+  };
+
   const openAiModal = () => {
     resetAiState();
     setAiModalOpen(true);
@@ -364,7 +609,7 @@ const EditExamPage: React.FC = () => {
     }));
   };
 
-  const handleParsedTypeChange = (index: number, nextType: QType) => {
+  const handleParsedTypeChange = (index: number, nextType: ParsedQType) => {
     updateParsedQuestion(index, question =>
       changeParsedQuestionType(question, nextType)
     );
@@ -486,17 +731,19 @@ const EditExamPage: React.FC = () => {
         <Space direction="vertical" style={{ width: '100%' }} size={12}>
           <div>
             <Text type="secondary">题型</Text>
-            <Select<QType>
+            <Select<ParsedQType>
               value={question.type}
               onChange={value => handleParsedTypeChange(index, value)}
               style={{ width: 160, marginTop: 4 }}
               disabled={batchSaving}
             >
-              {(Object.keys(TYPE_LABELS) as QType[]).map(type => (
-                <Select.Option key={type} value={type}>
-                  {TYPE_LABELS[type]}
-                </Select.Option>
-              ))}
+              {(Object.keys(TYPE_LABELS) as QType[])
+                .filter((type): type is ParsedQType => type !== 'CODE')
+                .map(type => (
+                  <Select.Option key={type} value={type}>
+                    {TYPE_LABELS[type]}
+                  </Select.Option>
+                ))}
             </Select>
           </div>
 
@@ -606,7 +853,9 @@ const EditExamPage: React.FC = () => {
             </Radio.Group>
           )}
 
-          {question.type === 'SHORT_ANSWER' && (
+          {(question.type === 'SHORT_ANSWER' ||
+            question.type === 'FILL_BLANK' ||
+            question.type === 'NUMERIC') && (
             <TextArea
               rows={3}
               value={question.answer}
@@ -684,10 +933,22 @@ const EditExamPage: React.FC = () => {
       key: 'action',
       width: 130,
       render: (record: Question) => (
-        <Space size="small">
+        <Space size="small" wrap>
           <Button size="small" icon={<EditOutlined />} onClick={() => openEdit(record)}>
             编辑
           </Button>
+          {record.type === 'CODE' && (
+            <Popconfirm
+              title="按当前测试用例重新评测该题的所有作答？"
+              onConfirm={() => handleRejudge(record.id)}
+              okText="重新评测"
+              cancelText="取消"
+            >
+              <Button size="small" icon={<ReloadOutlined />}>
+                重评
+              </Button>
+            </Popconfirm>
+          )}
           <Popconfirm
             title="确定删除该题目？"
             onConfirm={() => handleDelete(record.id)}
@@ -753,6 +1014,9 @@ const EditExamPage: React.FC = () => {
               AI 解析导入
             </Button>
           </Tooltip>
+          <Button icon={<DatabaseOutlined />} onClick={openBankModal}>
+            从题库选题
+          </Button>
           <Button type="primary" icon={<PlusOutlined />} onClick={openAdd}>
             手动添加
           </Button>
@@ -769,6 +1033,83 @@ const EditExamPage: React.FC = () => {
         />
       </Card>
 
+      <Card
+        title="随机抽题规则"
+        style={{ marginTop: '16px' }}
+        extra={
+          <Tooltip title={rulesLocked ? '已有学生开始作答，不能修改抽题规则' : undefined}>
+            <Button icon={<PlusOutlined />} onClick={openRuleModal} disabled={rulesLocked}>
+              添加规则
+            </Button>
+          </Tooltip>
+        }
+      >
+        <Text type="secondary">
+          每位学生开考时按规则从课程题库中随机抽题，抽到的题目排在固定题目之后。
+        </Text>
+        <Table
+          style={{ marginTop: '12px' }}
+          dataSource={rules}
+          rowKey={(item) => item.rule.id}
+          pagination={false}
+          size="small"
+          locale={{ emptyText: '暂无抽题规则，所有学生使用相同的固定题目' }}
+          columns={[
+            {
+              title: '题型',
+              key: 'type',
+              render: (_: unknown, item) =>
+                item.rule.type ? TYPE_LABELS[item.rule.type as QType] || item.rule.type : '不限',
+            },
+            {
+              title: '知识点',
+              key: 'tag',
+              render: (_: unknown, item) => (item.rule.tag ? <Tag>{item.rule.tag}</Tag> : '不限'),
+            },
+            {
+              title: '难度',
+              key: 'difficulty',
+              render: (_: unknown, item) =>
+                item.rule.difficulty ? DIFFICULTY_LABELS[item.rule.difficulty] : '不限',
+            },
+            {
+              title: '抽题数',
+              key: 'count',
+              render: (_: unknown, item) => (
+                <Text type={item.available < item.rule.count ? 'danger' : undefined}>
+                  {item.rule.count} / 可抽 {item.available}
+                </Text>
+              ),
+            },
+            {
+              title: '每题分值',
+              key: 'score',
+              render: (_: unknown, item) =>
+                item.rule.score > 0 ? `${item.rule.score} 分` : '沿用题库',
+            },
+            {
+              title: '操作',
+              key: 'action',
+              width: 90,
+              render: (_: unknown, item) => (
+                <Popconfirm
+                  title="确定删除该规则？"
+                  onConfirm={() => handleDeleteRule(item.rule.id)}
+                  okText="删除"
+                  cancelText="取消"
+                  okButtonProps={{ danger: true }}
+                  disabled={rulesLocked}
+                >
+                  <Button danger size="small" icon={<DeleteOutlined />} disabled={rulesLocked}>
+                    删除
+                  </Button>
+                </Popconfirm>
+              ),
+            },
+          ]}
+        />
+      </Card>
+
       <Modal
         title={editingQuestion ? '编辑题目' : '添加题目'}
         open={modalOpen}
@@ -790,7 +1131,21 @@ const EditExamPage: React.FC = () => {
                   'answer_multi',
                   'answer_tf',
                   'answer_text',
+                  'answer_blanks',
+                  'numeric_value',
+                  'numeric_tolerance',
+                  'numeric_unit',
+                  'numeric_units',
+                  'code_languages',
+                  'code_cases',
                 ]);
+                form.setFieldsValue({
+                  numeric_tolerance_mode: 'absolute',
+                  scoring_policy: 'all_or_nothing',
+                  code_time_limit: 1000,
+                  code_memory_limit: 256,
+                  ...(value === 'CODE' ? { code_cases: [{ input: '', output: '', sample: true }] } : {}),
+                });
               }}
             >
               {(Object.keys(TYPE_LABELS) as QType[]).map(type => (
@@ -895,13 +1250,103 @@ const EditExamPage: React.FC = () => {
             </Form.Item>
           )}
 
+          {questionType === 'FILL_BLANK' && (
+            <Form.Item
+              name="answer_blanks"
+              label="各空答案"
+              extra="题干中用 ____ 表示空，每行对应一个空；同一空的多个可接受答案用 | 分隔，以 re: 开头的按正则匹配整个答案。判分忽略大小写、全半角和空白"
+              rules={[
+                {
+                  validator(_, value) {
+                    return parseBlankText(value).length > 0
+                      ? Promise.resolve()
+                      : Promise.reject(new Error('请至少填写一个空的答案'));
+                  },
+                },
+              ]}
+            >
+              <TextArea rows={3} placeholder={'后进先出 | LIFO\nre:^o\\(1\\)$'} />
+            </Form.Item>
+          )}
+
+          {questionType === 'NUMERIC' && (
+            <>
+              <Space align="start" style={{ display: 'flex' }} wrap>
+                <Form.Item
+                  name="numeric_value"
+                  label="正确数值"
+                  rules={[{ required: true, message: '请输入正确数值' }]}
+                >
+                  <InputNumber style={{ width: '160px' }} />
+                </Form.Item>
+                <Form.Item name="numeric_tolerance" label="允许误差">
+                  <InputNumber
+                    min={0}
+                    style={{ width: '200px' }}
+                    addonAfter={
+                      <Form.Item name="numeric_tolerance_mode" noStyle>
+                        <Select style={{ width: '80px' }}>
+                          <Select.Option value="absolute">绝对</Select.Option>
+                          <Select.Option value="relative">%</Select.Option>
+                        </Select>
+                      </Form.Item>
+                    }
+                  />
+                </Form.Item>
+                <Form.Item name="numeric_unit" label="标准单位">
+                  <Input placeholder="如 m/s^2，可不填" style={{ width: '160px' }} />
+                </Form.Item>
+              </Space>
+              <Form.Item
+                name="numeric_units"
+                label="其他可接受单位"
+                extra="可选，每行一个，格式：单位 = 换算到标准单位的倍数；学生不写单位时按标准单位判分"
+              >
+                <TextArea rows={2} placeholder="cm/s^2 = 0.01" />
+              </Form.Item>
+            </>
+          )}
+
+          {questionType === 'CODE' && (
+            <>
+              <CodeJudgeConfigFields />
+            </>
+          )}
+
           {questionType === 'SHORT_ANSWER' && (
             <Form.Item
               name="answer_text"
               label="参考答案"
               rules={[{ required: true, message: '请输入参考答案' }]}
             >
-              <TextArea rows={3} placeholder="输入该题参考答案（用于教师批改时参考）" />
+              <TextArea rows={3} placeholder="输入该题参考答案（用于教师批改和 AI 评分时参考）" />
+            </Form.Item>
+          )}
+
+          {questionType === 'SHORT_ANSWER' && (
+            <Form.Item
+              name="rubric_text"
+              label="评分细则"
+              dependencies={['score']}
+              extra="可选，每行一个评分点，格式：评分点描述 | 分值，分值之和须等于题目分值"
+              rules={[
+                ({ getFieldValue }) => ({
+                  validator(_, value) {
+                    const criteria = parseRubricText(value);
+                    if (criteria.length === 0) return Promise.resolve();
+                    if (criteria.some((item) => !item.description || !(item.points > 0))) {
+                      return Promise.reject(new Error('每个评分点都需要描述和正数分值'));
+                    }
+                    const total = criteria.reduce((sum, item) => sum + item.points, 0);
+                    if (Math.abs(total - (getFieldValue('score') || 0)) > 1e-6) {
+                      return Promise.reject(new Error(`评分点分值之和为 ${total}，须等于题目分值`));
+                    }
+                    return Promise.resolve();
+                  },
+                }),
+              ]}
+            >
+              <TextArea rows={3} placeholder={'说明后进先出的特点 | 4\n列举两个应用场景 | 6'} />
             </Form.Item>
           )}
 
@@ -912,6 +1357,204 @@ const EditExamPage: React.FC = () => {
           >
             <InputNumber min={1} max={100} style={{ width: '120px' }} addonAfter="分" />
           </Form.Item>
+
+          {questionType !== 'SHORT_ANSWER' && (
+            <Space align="start" style={{ display: 'flex' }}>
+              {(questionType === 'MULTIPLE_CHOICE' ||
+                questionType === 'FILL_BLANK' ||
+                questionType === 'CODE') && (
+                <Form.Item name="scoring_policy" label="评分规则" style={{ minWidth: '260px' }}>
+                  <Select>
+                    {(Object.keys(SCORING_POLICY_LABELS) as ExamScoringPolicy[])
+                      .filter((policy) => questionType === 'MULTIPLE_CHOICE' || policy !== 'partial')
+                      .map((policy) => (
+                        <Select.Option key={policy} value={policy}>
+                          {SCORING_POLICY_LABELS[policy]}
+                        </Select.Option>
+                      ))}
+                  </Select>
+                </Form.Item>
+              )}
+              {questionType !== 'CODE' && (
+                <Form.Item
+                  name="wrong_penalty"
+                  label="答错倒扣"
+                  dependencies={['score']}
+                  extra="0 表示不倒扣，未作答不扣分"
+                  rules={[
+                    ({ getFieldValue }) => ({
+                      validator(_, value) {
+                        if (!value || value <= (getFieldValue('score') || 0)) return Promise.resolve();
+                        return Promise.reject(new Error('倒扣分不能超过题目分值'));
+                      },
+                    }),
+                  ]}
+                >
+                  <InputNumber min={0} max={100} step={0.5} style={{ width: '120px' }} addonAfter="分" />
+                </Form.Item>
+              )}
+            </Space>
+          )}
+
+          {!editingQuestion && (
+            <>
+              <Divider style={{ margin: '8px 0 16px' }} />
+              <Form.Item name="target" label="保存位置">
+                <Radio.Group>
+                  <Radio value="exam">仅本考试</Radio>
+                  <Radio value="both">本考试并存入题库</Radio>
+                  <Radio value="bank">仅存入题库</Radio>
+                </Radio.Group>
+              </Form.Item>
+              <Form.Item noStyle dependencies={['target']}>
+                {({ getFieldValue }) =>
+                  getFieldValue('target') !== 'exam' && (
+                    <Space align="start" style={{ display: 'flex' }}>
+                      <Form.Item name="difficulty" label="难度">
+                        <Select style={{ width: '120px' }}>
+                          {(Object.keys(DIFFICULTY_LABELS) as QuestionDifficulty[]).map((level) => (
+                            <Select.Option key={level} value={level}>
+                              {DIFFICULTY_LABELS[level]}
+                            </Select.Option>
+                          ))}
+                        </Select>
+                      </Form.Item>
+                      <Form.Item name="tags" label="知识点标签" style={{ minWidth: '320px' }}>
+                        <Select mode="tags" placeholder="输入后回车添加，如：栈、递归" />
+                      </Form.Item>
+                    </Space>
+                  )
+                }
+              </Form.Item>
+            </>
+          )}
+        </Form>
+      </Modal>
+
+      <Modal
+        title="从题库选题"
+        open={bankModalOpen}
+        onOk={handleAddFromBank}
+        onCancel={() => setBankModalOpen(false)}
+        okText={`加入考试（${selectedBankIds.length}）`}
+        cancelText="取消"
+        confirmLoading={bankAdding}
+        width={860}
+        destroyOnClose
+      >
+        <Space style={{ marginBottom: '12px' }}>
+          <Select
+            allowClear
+            placeholder="知识点"
+            style={{ width: '160px' }}
+            value={bankFilters.tag}
+            onChange={(tag) => handleBankFilterChange({ ...bankFilters, tag })}
+          >
+            {bankTags.map((tag) => (
+              <Select.Option key={tag} value={tag}>
+                {tag}
+              </Select.Option>
+            ))}
+          </Select>
+          <Select
+            allowClear
+            placeholder="难度"
+            style={{ width: '120px' }}
+            value={bankFilters.difficulty}
+            onChange={(difficulty) => handleBankFilterChange({ ...bankFilters, difficulty })}
+          >
+            {(Object.keys(DIFFICULTY_LABELS) as QuestionDifficulty[]).map((level) => (
+              <Select.Option key={level} value={level}>
+                {DIFFICULTY_LABELS[level]}
+              </Select.Option>
+            ))}
+          </Select>
+        </Space>
+        <Table
+          dataSource={bankQuestions}
+          rowKey="id"
+          size="small"
+          loading={bankLoading}
+          pagination={{ pageSize: 8 }}
+          rowSelection={{
+            selectedRowKeys: selectedBankIds,
+            onChange: (keys) => setSelectedBankIds(keys as number[]),
+          }}
+          locale={{ emptyText: '题库中暂无符合条件的题目' }}
+          columns={[
+            {
+              title: '题型',
+              dataIndex: 'type',
+              width: 80,
+              render: (type: QType) => <Tag color={TYPE_COLORS[type]}>{TYPE_LABELS[type]}</Tag>,
+            },
+            { title: '题干', dataIndex: 'stem', ellipsis: true },
+            {
+              title: '难度',
+              dataIndex: 'difficulty',
+              width: 70,
+              render: (level: QuestionDifficulty) => (
+                <Tag color={DIFFICULTY_COLORS[level]}>{DIFFICULTY_LABELS[level]}</Tag>
+              ),
+            },
+            {
+              title: '知识点',
+              dataIndex: 'tags',
+              width: 160,
+              render: (tags: string[]) => tags.map((tag) => <Tag key={tag}>{tag}</Tag>),
+            },
+            { title: '分值', dataIndex: 'score', width: 60 },
+            { title: '已用', dataIndex: 'useCount', width: 60, render: (count: number) => `${count} 次` },
+          ]}
+        />
+      </Modal>
+
+      <Modal
+        title="添加抽题规则"
+        open={ruleModalOpen}
+        onOk={handleCreateRule}
+        onCancel={() => setRuleModalOpen(false)}
+        okText="添加"
+        cancelText="取消"
+        confirmLoading={ruleSaving}
+        destroyOnClose
+      >
+        <Form form={ruleForm} layout="vertical" style={{ marginTop: '16px' }}>
+          <Form.Item name="type" label="题型">
+            <Select allowClear placeholder="不限">
+              {(Object.keys(TYPE_LABELS) as QType[]).map((type) => (
+                <Select.Option key={type} value={type}>
+                  {TYPE_LABELS[type]}
+                </Select.Option>
+              ))}
+            </Select>
+          </Form.Item>
+          <Form.Item name="tag" label="知识点">
+            <Select allowClear showSearch placeholder="不限">
+              {bankTags.map((tag) => (
+                <Select.Option key={tag} value={tag}>
+                  {tag}
+                </Select.Option>
+              ))}
+            </Select>
+          </Form.Item>
+          <Form.Item name="difficulty" label="难度">
+            <Select allowClear placeholder="不限">
+              {(Object.keys(DIFFICULTY_LABELS) as QuestionDifficulty[]).map((level) => (
+                <Select.Option key={level} value={level}>
+                  {DIFFICULTY_LABELS[level]}
+                </Select.Option>
+              ))}
+            </Select>
+          </Form.Item>
+          <Space>
+            <Form.Item name="count" label="抽题数" rules={[{ required: true, message: '请输入抽题数' }]}>
+              <InputNumber min={1} max={100} />
+            </Form.Item>
+            <Form.Item name="score" label="每题分值" extra="0 表示沿用题库分值">
+              <InputNumber min={0} max={100} addonAfter="分" />
+            </Form.Item>
+          </Space>
         </Form>
       </Modal>
 
@@ -1116,6 +1759,14 @@ const EditExamPage: React.FC = () => {
                         </div>
                       )}
 
+                      {!question._editing &&
+                        (question.type === 'FILL_BLANK' || question.type === 'NUMERIC') && (
+                          <div style={{ marginTop: '6px', paddingLeft: '24px' }}>
+                            <Text type="secondary">答案：</Text>
+                            <Text>{formatExamAnswer(question.type, question.answer) || '（未识别）'}</Text>
+                          </div>
+                        )}
+
                       {question._editing && renderParsedQuestionEditor(question, index)}
 
                       {question._error && (
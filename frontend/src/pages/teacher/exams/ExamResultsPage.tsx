@@ -5,7 +5,7 @@ import {
 } from 'antd';
 import {
   BarChartOutlined, UserOutlined, CheckCircleOutlined,
-  TrophyOutlined, ArrowLeftOutlined,
+  TrophyOutlined, ArrowLeftOutlined, RobotOutlined,
 } from '@ant-design/icons';
 import { useNavigate, useSearchParams } from 'react-router-dom';
 import { examService, type ExamSubmission, type ExamStatistics } from '../../../services/examService';
@@ -31,6 +31,7 @@ const ExamResultsPage: React.FC = () => {
   const [statistics, setStatistics] = useState<ExamStatistics | null>(null);
   const [examsLoading, setExamsLoading] = useState(false);
   const [resultsLoading, setResultsLoading] = useState(false);
+  const [accepting, setAccepting] = useState(false);
 
   useEffect(() => {
     if (!currentUser?.userId) return;
@@ -88,6 +89,20 @@ const ExamResultsPage: React.FC = () => {
     }
   };
 
+  // 批量采纳高置信度的 AI 评分，其余仍需在答卷详情中逐题确认
+  const acceptConfidentGrades = async (examId: number) => {
+    setAccepting(true);
+    try {
+      const res = await examService.reviewExamGrading(examId, { acceptAll: true, minConfidence: 0.8 });
+      message.success(`已采纳 ${res.accepted} 条 AI 评分`);
+      loadResults(examId);
+    } catch (error: any) {
+      message.error(error?.message || '采纳 AI 评分失败');
+    } finally {
+      setAccepting(false);
+    }
+  };
+
   const columns = [
     {
       title: '学生姓名',
@@ -184,6 +199,15 @@ const ExamResultsPage: React.FC = () => {
               </Select.Option>
             ))}
           </Select>
+          {selectedExamId && (
+            <Button
+              icon={<RobotOutlined />}
+              loading={accepting}
+              onClick={() => acceptConfidentGrades(selectedExamId)}
+            >
+              采纳置信度 ≥ 80% 的 AI 评分
+            </Button>
+          )}
         </Space>
       </Card>
 
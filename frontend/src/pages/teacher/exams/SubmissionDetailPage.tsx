@@ -1,14 +1,24 @@
 import React, { useState, useEffect } from 'react';
 import {
-  Card, Button, Typography, Space, Tag, Descriptions, Divider, message,
+  Card, Button, Typography, Space, Tag, Descriptions, Divider, InputNumber, message,
 } from 'antd';
-import { ArrowLeftOutlined, CheckCircleOutlined, CloseCircleOutlined } from '@ant-design/icons';
+import { ArrowLeftOutlined, CheckCircleOutlined, CloseCircleOutlined, RobotOutlined } from '@ant-design/icons';
 import { useNavigate, useParams } from 'react-router-dom';
-import { examService } from '../../../services/examService';
+import {
+  examService,
+  type CodeJudgeResult,
+  type CodeJudgeStatus,
+  type ExamAIGradeStatus,
+  type ExamGradeDecision,
+  type ExamGradeProposal,
+} from '../../../services/examService';
+import { CODE_LANGUAGE_LABELS, formatExamAnswer, parseCodeSubmission } from '../../../utils/examAnswer';
+import CodeJudgeResultView from '../../../components/CodeJudgeResultView';
 
-const { Title, Text } = Typography;
+const { Title, Text, Paragraph } = Typography;
 
 interface AnswerItem {
+  answerId?: number;
   questionId: number;
   type: string;
   stem: string;
@@ -17,6 +27,10 @@ interface AnswerItem {
   correctAnswer: string;
   options?: string;
   scoreAwarded?: number;
+  aiGradeStatus?: ExamAIGradeStatus;
+  aiGrade?: ExamGradeProposal;
+  judgeStatus?: CodeJudgeStatus;
+  judgeResult?: CodeJudgeResult;
 }
 
 interface SubmissionDetail {
@@ -28,6 +42,8 @@ interface SubmissionDetail {
   studentEmail: string;
   submittedAt: string;
   totalScore?: number;
+  // 乱序试卷：题目顺序、选项和答案字母均按该学生作答时看到的显示
+  shuffled?: boolean;
   answers: AnswerItem[];
 }
 
@@ -36,6 +52,18 @@ const typeLabel: Record<string, string> = {
   MULTIPLE_CHOICE: '多选题',
   TRUE_FALSE: '判断题',
   SHORT_ANSWER: '简答题',
+  FILL_BLANK: '填空题',
+  NUMERIC: '数值题',
+  CODE: '编程题',
+};
+
+const aiGradeStatusMeta: Partial<Record<ExamAIGradeStatus, { color: string; label: string }>> = {
+  pending: { color: 'default', label: 'AI 评分中' },
+  processing: { color: 'default', label: 'AI 评分中' },
+  proposed: { color: 'purple', label: '待确认' },
+  accepted: { color: 'green', label: '已采纳 AI 评分' },
+  overridden: { color: 'blue', label: '教师已改分' },
+  failed: { color: 'red', label: 'AI 评分失败' },
 };
 
 const SubmissionDetailPage: React.FC = () => {
@@ -43,6 +71,9 @@ const SubmissionDetailPage: React.FC = () => {
   const navigate = useNavigate();
   const [loading, setLoading] = useState(false);
   const [detail, setDetail] = useState<SubmissionDetail | null>(null);
+  const [overrides, setOverrides] = useState<Record<number, number | null>>({});
+  const [reviewing, setReviewing] = useState(false);
+  const [rejudging, setRejudging] = useState<number | null>(null);
 
   useEffect(() => {
     if (!id) return;
@@ -61,14 +92,144 @@ const SubmissionDetailPage: React.FC = () => {
     }
   };
 
+  const reviewGrading = async (decisions: ExamGradeDecision[]) => {
+    if (!detail || decisions.length === 0) return;
+    setReviewing(true);
+    try {
+      const res = await examService.reviewExamGrading(detail.examId, { decisions });
+      message.success(`已采纳 ${res.accepted} 题，改分 ${res.overridden} 题`);
+      setOverrides({});
+      loadDetail(detail.id);
+    } catch (error: any) {
+      message.error(error?.message || '保存评分失败');
+    } finally {
+      setReviewing(false);
+    }
+  };
+
+  const rejudge = async (questionId: number) => {
+    if (!detail) return;
+    setRejudging(questionId);
+    try {
+      const res = await examService.requeueExamJudging(detail.examId, questionId);
+      message.success(`已重新加入评测队列（${res.queued} 份作答）`);
+      loadDetail(detail.id);
+    } catch (error: any) {
+      message.error(error?.message || '重新评测失败');
+    } finally {
+      setRejudging(null);
+    }
+  };
+
+  const renderCode = (item: AnswerItem) => {
+    const submission = parseCodeSubmission(item.studentAnswer);
+    return (
+      <>
+        <div>
+          <Text type="secondary">
+            学生代码{submission.language ? `（${CODE_LANGUAGE_LABELS[submission.language] || submission.language}）` : ''}：
+          </Text>
+          {submission.source ? (
+            <pre style={{ margin: '4px 0 0', padding: '8px', background: '#fafafa', whiteSpace: 'pre-wrap' }}>
+              {submission.source}
+            </pre>
+          ) : (
+            <Text>（未作答）</Text>
+          )}
+        </div>
+        <div>
+          <Text type="secondary">评测配置：</Text>
+          <Text>{formatExamAnswer(item.type, item.correctAnswer)}</Text>
+        </div>
+        <CodeJudgeResultView status={item.judgeStatus} result={item.judgeResult} />
+        {item.judgeStatus && (
+          <Button
+            size="small"
+            loading={rejudging === item.questionId}
+            onClick={() => rejudge(item.questionId)}
+          >
+            重新评测本题
+          </Button>
+        )}
+      </>
+    );
+  };
+
+  const renderGrading = (item: AnswerItem) => {
+    if (item.answerId == null) return null;
+    const answerId = item.answerId;
+    const statusMeta = item.aiGradeStatus ? aiGradeStatusMeta[item.aiGradeStatus] : undefined;
+    const override = overrides[answerId];
+
+    return (
+      <div style={{ background: '#f9f0ff', padding: '8px 12px', borderRadius: '4px' }}>
+        {item.aiGrade && (
+          <>
+            <Space wrap>
+              <Tag color="purple" icon={<RobotOutlined />}>AI 建议 {item.aiGrade.score} 分</Tag>
+              <Tag>置信度 {Math.round(item.aiGrade.confidence * 100)}%</Tag>
+              {statusMeta && <Tag color={statusMeta.color}>{statusMeta.label}</Tag>}
+            </Space>
+            {item.aiGrade.rationale && (
+              <Paragraph style={{ margin: '8px 0 4px' }}>{item.aiGrade.rationale}</Paragraph>
+            )}
+            {item.aiGrade.criteria?.map((criterion) => (
+              <div key={criterion.index}>
+                <Text type="secondary">
+                  评分点 {criterion.index}：{criterion.score} 分{criterion.comment ? `，${criterion.comment}` : ''}
+                </Text>
+              </div>
+            ))}
+          </>
+        )}
+        {!item.aiGrade && statusMeta && <Tag color={statusMeta.color}>{statusMeta.label}</Tag>}
+        <Space style={{ marginTop: '8px' }}>
+          {item.aiGradeStatus === 'proposed' && (
+            <Button
+              size="small"
+              type="primary"
+              loading={reviewing}
+              onClick={() => reviewGrading([{ answerId, action: 'accept' }])}
+            >
+              采纳
+            </Button>
+          )}
+          <InputNumber
+            size="small"
+            min={0}
+            max={item.score}
+            value={override ?? undefined}
+            placeholder="分数"
+            onChange={(value) => setOverrides((prev) => ({ ...prev, [answerId]: value }))}
+          />
+          <Button
+            size="small"
+            loading={reviewing}
+            disabled={override == null}
+            onClick={() => reviewGrading([{ answerId, action: 'override', score: override ?? undefined }])}
+          >
+            改分
+          </Button>
+        </Space>
+      </div>
+    );
+  };
+
   const renderAnswer = (item: AnswerItem, index: number) => {
-    const isObjective = item.type !== 'SHORT_ANSWER';
-    const isCorrect = isObjective && item.studentAnswer === item.correctAnswer;
+    const isCode = item.type === 'CODE';
+    const isObjective = item.type !== 'SHORT_ANSWER' && !isCode;
+    // 客观题按得分判断对错：多选题可能部分得分，答错倒扣时得分为负
+    const awarded = item.scoreAwarded ?? 0;
+    const verdict = awarded >= item.score ? 'correct' : awarded > 0 ? 'partial' : 'wrong';
+    const verdictColor = { correct: '#52c41a', partial: '#faad14', wrong: '#ff4d4f' }[verdict];
 
     let displayStudent = item.studentAnswer || '（未作答）';
     let displayCorrect = item.correctAnswer;
 
-    if (item.options) {
+    if (item.type === 'FILL_BLANK' || item.type === 'NUMERIC') {
+      if (item.studentAnswer) displayStudent = formatExamAnswer(item.type, item.studentAnswer, true);
+      displayCorrect = formatExamAnswer(item.type, item.correctAnswer);
+    } else if (item.options) {
       try {
         const opts: string[] = JSON.parse(item.options);
         const fmt = (ans: string) =>
@@ -93,7 +254,7 @@ const SubmissionDetailPage: React.FC = () => {
         style={{
           marginBottom: '16px',
           borderLeft: isObjective
-            ? `4px solid ${isCorrect ? '#52c41a' : '#ff4d4f'}`
+            ? `4px solid ${verdictColor}`
             : '4px solid #1890ff',
         }}
       >
@@ -103,10 +264,12 @@ const SubmissionDetailPage: React.FC = () => {
               {index + 1}. [{typeLabel[item.type] || item.type}] {item.stem}
             </Text>
             <Space>
-              {isObjective && (
-                isCorrect
-                  ? <Tag color="green" icon={<CheckCircleOutlined />}>正确</Tag>
-                  : <Tag color="red" icon={<CloseCircleOutlined />}>错误</Tag>
+              {isObjective && verdict === 'correct' && (
+                <Tag color="green" icon={<CheckCircleOutlined />}>正确</Tag>
+              )}
+              {isObjective && verdict === 'partial' && <Tag color="orange">部分正确</Tag>}
+              {isObjective && verdict === 'wrong' && (
+                <Tag color="red" icon={<CloseCircleOutlined />}>错误</Tag>
               )}
               <Tag color="blue">
                 {item.scoreAwarded != null ? item.scoreAwarded : '—'} / {item.score} 分
@@ -114,14 +277,16 @@ const SubmissionDetailPage: React.FC = () => {
             </Space>
           </div>
 
-          <div>
-            <Text type="secondary">学生答案：</Text>
-            <Text
-              style={{ color: isObjective ? (isCorrect ? '#52c41a' : '#ff4d4f') : undefined }}
-            >
-              {displayStudent}
-            </Text>
-          </div>
+          {!isCode && (
+            <div>
+              <Text type="secondary">学生答案：</Text>
+              <Text
+                style={{ color: isObjective ? verdictColor : undefined }}
+              >
+                {displayStudent}
+              </Text>
+            </div>
+          )}
 
           {isObjective && (
             <div>
@@ -129,6 +294,10 @@ const SubmissionDetailPage: React.FC = () => {
               <Text style={{ color: '#52c41a' }}>{displayCorrect}</Text>
             </div>
           )}
+
+          {isCode && renderCode(item)}
+
+          {item.type === 'SHORT_ANSWER' && renderGrading(item)}
         </Space>
       </Card>
     );
@@ -152,6 +321,9 @@ const SubmissionDetailPage: React.FC = () => {
   }
 
   const passed = detail.totalScore != null && detail.totalScore >= 60;
+  const proposed = detail.answers.filter(
+    (item) => item.answerId != null && item.aiGradeStatus === 'proposed',
+  );
 
   return (
     <div style={{ padding: '24px' }}>
@@ -184,6 +356,25 @@ const SubmissionDetailPage: React.FC = () => {
       </Card>
 
       <Divider>答题情况（共 {detail.answers.length} 题）</Divider>
+      {detail.shuffled && (
+        <Text type="secondary" style={{ display: 'block', marginBottom: '12px' }}>
+          该学生的试卷题目和选项顺序经过打乱，以下按学生作答时看到的顺序和选项字母显示。
+        </Text>
+      )}
+
+      {proposed.length > 0 && (
+        <div style={{ marginBottom: '16px', textAlign: 'right' }}>
+          <Button
+            icon={<RobotOutlined />}
+            loading={reviewing}
+            onClick={() =>
+              reviewGrading(proposed.map((item) => ({ answerId: item.answerId!, action: 'accept' })))
+            }
+          >
+            采纳全部 AI 评分（{proposed.length} 题）
+          </Button>
+        </div>
+      )}
 
       {detail.answers.map((item, index) => renderAnswer(item, index))}
     </div>
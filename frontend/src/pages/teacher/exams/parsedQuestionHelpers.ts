@@ -114,6 +114,13 @@ export function validateParsedQuestionForConfirm(
     return '请输入参考答案'
   }
 
+  if (
+    (question.type === 'FILL_BLANK' || question.type === 'NUMERIC') &&
+    !question.answer.trim()
+  ) {
+    return '请输入答案'
+  }
+
   return null
 }
 
@@ -178,7 +185,11 @@ export function changeParsedQuestionType(
     return nextQuestion
   }
 
-  if (nextType === 'SHORT_ANSWER') {
+  if (
+    nextType === 'SHORT_ANSWER' ||
+    nextType === 'FILL_BLANK' ||
+    nextType === 'NUMERIC'
+  ) {
     nextQuestion.options = []
     return nextQuestion
   }
@@ -232,6 +243,8 @@ function normalizeQuestionType(
     case 'MULTIPLE_CHOICE':
     case 'TRUE_FALSE':
     case 'SHORT_ANSWER':
+    case 'FILL_BLANK':
+    case 'NUMERIC':
       return type
     default:
       return 'SINGLE_CHOICE'
@@ -1,4 +1,5 @@
 import api from './api'
+import type { CodeJudgeResult, CodeJudgeStatus, CodeQuestionInfo } from './examService'
 
 // 类型定义
 export interface Assignment {
@@ -16,6 +17,10 @@ export interface Assignment {
   feedback?: string
   submissionId?: number
   submittedAt?: string
+  // 自动评测配置（JSON 字符串，格式同编程题答案），仅教师可见
+  judgeConfig?: string
+  // 自动评测的语言、资源限制与样例，开启评测时返回
+  code?: CodeQuestionInfo
 }
 
 export interface AssignmentSubmission {
@@ -31,6 +36,9 @@ export interface AssignmentSubmission {
   courseTitle?: string
   studentName?: string
   studentEmail?: string
+  language?: string
+  judgeStatus?: CodeJudgeStatus
+  judgeResult?: CodeJudgeResult
 }
 
 export interface AssignmentStatistics {
@@ -48,6 +56,7 @@ export interface CreateAssignmentRequest {
   title: string
   content?: string
   deadline?: string
+  judgeConfig?: string
 }
 
 export interface UpdateAssignmentRequest {
@@ -55,11 +64,14 @@ export interface UpdateAssignmentRequest {
   title: string
   content?: string
   deadline?: string
+  judgeConfig?: string
 }
 
 export interface SubmitAssignmentRequest {
   content?: string
   attachments?: string
+  // 开启自动评测的作业：指定语言时 content 作为源代码提交评测
+  language?: string
 }
 
 export interface GradeAssignmentRequest {
@@ -141,6 +153,11 @@ export const assignmentService = {
     return api.put(`/assignments/submissions/${id}/grade`, data)
   },
 
+  // 重新评测作业的全部代码提交
+  async requeueAssignmentJudging(id: number): Promise<{ queued: number }> {
+    return api.post(`/assignments/${id}/judge/requeue`)
+  },
+
   // 获取作业统计
   async getAssignmentStatistics(id: number): Promise<StatisticsResponse> {
     return api.get(`/assignments/${id}/statistics`)
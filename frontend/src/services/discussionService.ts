@@ -36,8 +36,22 @@ export interface DiscussionReply {
   isFavorited: boolean
 }
 
+export interface DiscussionKnowledgeLink {
+  citation: number
+  documentId: number
+  chunkId: number
+  filename: string
+  location?: string
+  canonical?: boolean
+}
+
 export interface DiscussionDetail extends Discussion {
   replies: DiscussionReply[]
+  // AI 助教根据课程知识库生成的回答草稿，生成完成前只有 aiStatus
+  aiStatus?: 'pending' | 'processing' | 'completed' | 'skipped' | 'failed'
+  aiDraft?: string
+  confidenceScore?: number
+  linkedKnowledge?: DiscussionKnowledgeLink[]
 }
 
 export interface CreateDiscussionRequest {
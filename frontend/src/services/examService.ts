@@ -20,12 +20,50 @@ export interface Exam {
 export interface ExamQuestion {
   id: number
   examId: number
-  type: 'SINGLE_CHOICE' | 'MULTIPLE_CHOICE' | 'TRUE_FALSE' | 'SHORT_ANSWER'
+  type: 'SINGLE_CHOICE' | 'MULTIPLE_CHOICE' | 'TRUE_FALSE' | 'SHORT_ANSWER' | 'FILL_BLANK' | 'NUMERIC' | 'CODE'
   stem: string
   options?: string
   answer: string
   score: number
   orderIndex: number
+  // 主观题评分细则（JSON 数组）与参考答案，学生端不返回
+  rubric?: string
+  referenceAnswer?: string
+  // 客观题评分规则与答错倒扣分，对学生公开
+  scoringPolicy?: ExamScoringPolicy
+  wrongPenalty?: number
+  // 填空题的空数与数值题的标准单位，学生作答时使用
+  blankCount?: number
+  unit?: string
+  // 编程题的语言、资源限制与样例（不含隐藏测试用例）
+  code?: CodeQuestionInfo
+}
+
+export interface CodeSample {
+  input: string
+  output: string
+}
+
+export interface CodeQuestionInfo {
+  languages: string[]
+  timeLimitMs: number
+  memoryLimitMb: number
+  samples: CodeSample[]
+  testCount: number
+}
+
+export type CodeJudgeVerdict = 'AC' | 'WA' | 'TLE' | 'MLE' | 'OLE' | 'RE' | 'CE'
+
+export type CodeJudgeStatus = 'pending' | 'processing' | 'done' | 'failed'
+
+// 编程题评测结果，verdict 为第一个未通过用例的结论；学生端只返回样例用例的报错信息
+export interface CodeJudgeResult {
+  verdict: CodeJudgeVerdict
+  passed: number
+  total: number
+  cases: { verdict: CodeJudgeVerdict; timeMs: number; memoryKb: number; message?: string }[]
+  compileOutput?: string
+  isolated: boolean
 }
 
 export interface ExamSubmission {
@@ -38,10 +76,13 @@ export interface ExamSubmission {
   courseTitle?: string
   studentName?: string
   studentEmail?: string
+  // 乱序试卷按学生作答时看到的题目顺序和选项字母返回
+  shuffled?: boolean
   answers?: ExamAnswer[]
 }
 
 export interface ExamAnswer {
+  answerId?: number
   questionId: number
   type: string
   stem: string
@@ -50,6 +91,88 @@ export interface ExamAnswer {
   correctAnswer: string
   options?: string
   scoreAwarded?: number
+  // 答错客观题的 AI 讲解，生成完成前只有 coachingStatus
+  coachingStatus?: 'pending' | 'processing' | 'completed' | 'skipped' | 'failed'
+  coaching?: ExamCoaching
+  // 主观题的 AI 评分建议，教师确认前不计入 scoreAwarded
+  aiGradeStatus?: ExamAIGradeStatus
+  aiGrade?: ExamGradeProposal
+  // 编程题的评测状态与结果，评测完成后写入 scoreAwarded
+  judgeStatus?: CodeJudgeStatus
+  judgeResult?: CodeJudgeResult
+  code?: CodeQuestionInfo
+}
+
+export type ExamAIGradeStatus =
+  | 'pending'
+  | 'processing'
+  | 'proposed'
+  | 'accepted'
+  | 'overridden'
+  | 'skipped'
+  | 'failed'
+
+export interface ExamGradeProposal {
+  score: number
+  rationale: string
+  confidence: number
+  criteria?: { index: number; score: number; comment?: string }[]
+}
+
+export interface ExamGradingItem {
+  answerId: number
+  submissionId: number
+  studentId: number
+  studentName: string
+  questionId: number
+  stem: string
+  score: number
+  studentAnswer: string
+  scoreAwarded?: number
+  aiGradeStatus: ExamAIGradeStatus | ''
+  aiGrade?: ExamGradeProposal
+  aiGradeError?: string
+  gradedBy?: number
+  gradedAt?: string
+}
+
+export interface ExamGradeDecision {
+  answerId: number
+  action: 'accept' | 'override'
+  score?: number
+  note?: string
+}
+
+export interface ReviewExamGradingRequest {
+  decisions?: ExamGradeDecision[]
+  // 采纳所有置信度不低于 minConfidence 的待确认建议
+  acceptAll?: boolean
+  minConfidence?: number
+}
+
+export interface ExamGradingAuditItem {
+  id: number
+  answerId: number
+  userId: number
+  username: string
+  action: 'accept' | 'override'
+  previousScore?: number
+  aiScore?: number
+  finalScore: number
+  note: string
+  createdAt: string
+}
+
+export interface ExamCoaching {
+  explanation: string
+  review: {
+    citation: number
+    documentId: number
+    chunkId: number
+    filename: string
+    section?: string
+    location?: string
+  }[]
 }
 
 export interface ExamStatistics {
@@ -65,7 +188,7 @@ export interface ExamStatistics {
 }
 
 export interface ParsedExamQuestion {
-  type: 'SINGLE_CHOICE' | 'MULTIPLE_CHOICE' | 'TRUE_FALSE' | 'SHORT_ANSWER'
+  type: 'SINGLE_CHOICE' | 'MULTIPLE_CHOICE' | 'TRUE_FALSE' | 'SHORT_ANSWER' | 'FILL_BLANK' | 'NUMERIC'
   stem: string
   options: string[]
   answer: string
@@ -85,6 +208,9 @@ export interface ConfirmParsedQuestionsRequest {
   examId: number
   originalQuestions: ParsedExamQuestion[]
   confirmedQuestions: ParsedExamQuestion[]
+  target?: QuestionTarget
+  difficulty?: QuestionDifficulty
+  tags?: string[]
 }
 
 export interface ConfirmParsedQuestionsResponse {
@@ -107,12 +233,81 @@ export interface UpdateExamRequest {
 }
 
 export interface AddQuestionRequest {
-  type: 'SINGLE_CHOICE' | 'MULTIPLE_CHOICE' | 'TRUE_FALSE' | 'SHORT_ANSWER'
+  type: 'SINGLE_CHOICE' | 'MULTIPLE_CHOICE' | 'TRUE_FALSE' | 'SHORT_ANSWER' | 'FILL_BLANK' | 'NUMERIC' | 'CODE'
   stem: string
   options?: string
   answer: string
   score: number
   orderIndex: number
+  rubric?: string
+  referenceAnswer?: string
+  scoringPolicy?: ExamScoringPolicy
+  wrongPenalty?: number
+  // exam（默认）只加入本考试，bank 只存入课程题库，both 两者都写
+  target?: QuestionTarget
+  difficulty?: QuestionDifficulty
+  tags?: string[]
+}
+
+export type QuestionTarget = 'exam' | 'bank' | 'both'
+
+// 客观题评分规则：all_or_nothing 完全正确才得分；proportional 按（选对数 - 选错数）/ 正确选项数给分；
+// partial 有错选不得分、漏选得一半分。后两者只适用于多选题
+export type ExamScoringPolicy = 'all_or_nothing' | 'proportional' | 'partial'
+
+export type QuestionDifficulty = 'easy' | 'medium' | 'hard'
+
+export interface BankQuestion {
+  id: number
+  courseId: number
+  type: ExamQuestion['type']
+  stem: string
+  options?: string
+  answer: string
+  score: number
+  rubric?: string
+  referenceAnswer?: string
+  difficulty: QuestionDifficulty
+  tags: string[]
+  useCount: number
+  lastUsedAt?: string
+  createdAt: string
+}
+
+export interface BankQuestionFilters {
+  type?: string
+  difficulty?: QuestionDifficulty
+  tag?: string
+  keyword?: string
+}
+
+export interface BankQuestionUsage {
+  examId: number
+  examTitle: string
+  examQuestionId: number
+  usedAt: string
+}
+
+// 抽题规则：按题型、知识点标签和难度从题库随机抽题，条件留空表示不限，score 为 0 时沿用题库分值
+export interface ExamQuestionRule {
+  id: number
+  examId: number
+  type: string
+  tag: string
+  difficulty: QuestionDifficulty | ''
+  count: number
+  score: number
+  orderIndex: number
+  createdAt: string
+}
+
+export interface CreateExamQuestionRuleRequest {
+  type?: string
+  tag?: string
+  difficulty?: QuestionDifficulty
+  count: number
+  score?: number
+  orderIndex?: number
 }
 
 export interface SubmitExamRequest {
@@ -134,6 +329,8 @@ export interface ExamDetailResponse {
   data: {
     exam: Exam
     questions: ExamQuestion[]
+    // 学生拿到的是打乱了题目和选项顺序的个人试卷
+    shuffled?: boolean
   }
 }
 
@@ -194,6 +391,51 @@ export const examService = {
     return api.delete(`/exams/${examId}/questions/${questionId}`)
   },
 
+  // 从课程题库选题加入考试（教师）
+  async addBankQuestionsToExam(examId: number, questionIds: number[]): Promise<{ added: number; questionIds: number[] }> {
+    return api.post(`/exams/${examId}/questions/from-bank`, { questionIds })
+  },
+
+  // 获取抽题规则及每条规则当前可抽的题目数（教师），locked 表示已有学生开始作答
+  async getExamRules(examId: number): Promise<{ rules: { rule: ExamQuestionRule; available: number }[]; locked: boolean }> {
+    return api.get(`/exams/${examId}/rules`)
+  },
+
+  // 添加抽题规则（教师）
+  async createExamRule(examId: number, data: CreateExamQuestionRuleRequest): Promise<{ id: number }> {
+    return api.post(`/exams/${examId}/rules`, data)
+  },
+
+  // 删除抽题规则（教师）
+  async deleteExamRule(examId: number, ruleId: number): Promise<{ success: boolean; message: string }> {
+    return api.delete(`/exams/${examId}/rules/${ruleId}`)
+  },
+
+  // 获取课程题库（教师），tags 为题库中出现过的全部知识点标签
+  async listQuestionBank(courseId: number, filters?: BankQuestionFilters): Promise<{ questions: BankQuestion[]; tags: string[] }> {
+    return api.get(`/courses/${courseId}/question-bank`, { params: filters })
+  },
+
+  // 向课程题库添加题目（教师）
+  async createBankQuestion(courseId: number, data: AddQuestionRequest): Promise<{ id: number }> {
+    return api.post(`/courses/${courseId}/question-bank`, data)
+  },
+
+  // 更新题库题目，已加入考试的副本不受影响（教师）
+  async updateBankQuestion(courseId: number, questionId: number, data: AddQuestionRequest): Promise<{ success: boolean; message: string }> {
+    return api.put(`/courses/${courseId}/question-bank/${questionId}`, data)
+  },
+
+  // 删除题库题目（教师）
+  async deleteBankQuestion(courseId: number, questionId: number): Promise<{ success: boolean; message: string }> {
+    return api.delete(`/courses/${courseId}/question-bank/${questionId}`)
+  },
+
+  // 题库题目的使用记录（教师）
+  async getBankQuestionUsage(courseId: number, questionId: number): Promise<{ usage: BankQuestionUsage[] }> {
+    return api.get(`/courses/${courseId}/question-bank/${questionId}/usage`)
+  },
+
   // 提交答卷
   async submitExam(id: number, data: SubmitExamRequest): Promise<{ success: boolean; message: string; data: { submissionId: number; totalScore: number } }> {
     return api.post(`/exams/${id}/submit`, data)
@@ -214,6 +456,31 @@ export const examService = {
     return api.get(`/exams/submissions/${id}`)
   },
 
+  // 主观题批改列表及 AI 评分建议（教师），status=proposed 只看待确认的
+  async getExamGrading(id: number, status?: ExamAIGradeStatus): Promise<{ items: ExamGradingItem[] }> {
+    return api.get(`/exams/${id}/grading`, { params: status ? { status } : undefined })
+  },
+
+  // 批量采纳或改动 AI 评分（教师）
+  async reviewExamGrading(id: number, data: ReviewExamGradingRequest): Promise<{ accepted: number; overridden: number }> {
+    return api.post(`/exams/${id}/grading/review`, data)
+  },
+
+  // 修改评分细则后为未确认的作答重新生成评分建议（教师）
+  async requeueExamGrading(id: number): Promise<{ queued: number }> {
+    return api.post(`/exams/${id}/grading/requeue`)
+  },
+
+  // 修改测试用例后重新评测编程题作答（教师），可只重评一道题
+  async requeueExamJudging(id: number, questionId?: number): Promise<{ queued: number }> {
+    return api.post(`/exams/${id}/judge/requeue`, undefined, { params: questionId ? { questionId } : undefined })
+  },
+
+  // 批改记录（教师）
+  async getExamGradingAudit(id: number): Promise<{ items: ExamGradingAuditItem[] }> {
+    return api.get(`/exams/${id}/grading/audit`)
+  },
+
   // 获取考试统计
   async getExamStatistics(id: number): Promise<StatisticsResponse> {
     return api.get(`/exams/${id}/statistics`)
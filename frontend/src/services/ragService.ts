@@ -1,10 +1,18 @@
 import api from './api'
 
+export type RagChunkStrategy = 'fixed' | 'structured'
+
+export type RagDocumentStatus = 'queued' | 'processing' | 'ready' | 'failed'
+
 export interface RagDocument {
   id: number
   filename: string
   char_count: number
   chunk_count: number
+  chunk_strategy?: RagChunkStrategy
+  status?: RagDocumentStatus
+  error?: string
+  progress?: number
   created_at?: string
   created_by?: string
 }
@@ -14,13 +22,36 @@ export interface RagSource {
   documentId: number
   filename: string
   chunkIndex: number
+  citation?: number
+  location?: string
   content: string
+  rerankScore?: number
+  canonical?: boolean
+}
+
+export interface RagSentenceAttribution {
+  sentence: string
+  citations?: number[]
+  invalid_citations?: number[]
+  support_chunk_id?: number
+  score: number
+  supported: boolean
+}
+
+export interface RagAttribution {
+  sentences: RagSentenceAttribution[]
+  unsupported_count: number
 }
 
 export interface RagQueryResult {
   answer: string
   sources: RagSource[]
+  attribution?: RagAttribution
   session_id?: string
+  rewritten_query?: string
+  expanded_queries?: string[]
+  no_evidence?: boolean
+  query_id?: number
 }
 
 export interface RagQueryHistory {
@@ -28,12 +59,88 @@ export interface RagQueryHistory {
   user_id: number
   session_id?: string
   question: string
+  rewritten_query?: string
+  expanded_queries?: string[]
   answer: string
   sources: RagSource[]
+  attribution?: RagAttribution
+  no_evidence?: boolean
+  feedback?: RagQueryFeedback
   created_at: string
 }
 
-export type RagProvider = 'dashscope' | 'openrouter'
+export interface RagQueryFeedback {
+  rating: 1 | -1
+  comment?: string
+}
+
+export interface RagReviewItem {
+  query_id: number
+  user_id: number
+  username: string
+  question: string
+  rewritten_query?: string
+  answer: string
+  no_evidence: boolean
+  feedback?: RagQueryFeedback
+  review_status: '' | 'resolved' | 'dismissed'
+  canonical_chunk_id?: number
+  canonical_answer?: string
+  created_at: string
+}
+
+export interface RagEvalCase {
+  id: number
+  course_id: number
+  question: string
+  expected_answer?: string
+  expected_doc_ids: number[]
+  created_at: string
+}
+
+export interface RagEvalCaseResult {
+  case_id: number
+  question: string
+  expected_doc_ids: number[]
+  retrieved_doc_ids: number[]
+  answer?: string
+  recall: number
+  reciprocal_rank: number
+  faithfulness: number
+  retrieval_latency_ms: number
+  total_latency_ms: number
+  error?: string
+}
+
+export interface RagEvalReport {
+  k: number
+  cases: number
+  failed: number
+  recall_at_k: number
+  mrr: number
+  faithfulness: number
+  avg_latency_ms: number
+  p95_latency_ms: number
+  avg_retrieval_ms: number
+  embedding_model?: string
+  llm_model?: string
+  results?: RagEvalCaseResult[]
+}
+
+export interface RagEvalRun {
+  id: number
+  course_id: number
+  status: 'running' | 'completed' | 'failed' | 'interrupted'
+  k: number
+  total: number
+  processed: number
+  error?: string
+  report?: RagEvalReport
+  created_at: string
+  finished_at?: string
+}
+
+export type RagProvider = 'dashscope' | 'openrouter' | 'anthropic'
 
 const RAG_API_KEY_STORAGE = 'courseark.rag.apiKey'
 const RAG_PROVIDER_STORAGE = 'courseark.rag.provider'
@@ -51,7 +158,10 @@ export const ragCredentialStore = {
     ) as RagProvider | null
     return {
       apiKey: window.sessionStorage.getItem(RAG_API_KEY_STORAGE) || '',
-      provider: provider === 'openrouter' ? 'openrouter' : 'dashscope',
+      provider:
+        provider === 'openrouter' || provider === 'anthropic'
+          ? provider
+          : 'dashscope',
     }
   },
 
@@ -78,9 +188,16 @@ export const ragCredentialHeaders = () => {
 }
 
 const ragService = {
-  uploadDocument(courseId: number, file: File): Promise<RagDocument> {
+  uploadDocument(
+    courseId: number,
+    file: File,
+    chunkStrategy?: RagChunkStrategy
+  ): Promise<RagDocument> {
     const form = new FormData()
     form.append('file', file)
+    if (chunkStrategy) {
+      form.append('chunk_strategy', chunkStrategy)
+    }
     return api.post(`/courses/${courseId}/rag/documents`, form, {
       timeout: 60000,
       headers: {
@@ -101,13 +218,16 @@ const ragService = {
   query(
     courseId: number,
     question: string,
-    sessionId?: string
+    sessionId?: string,
+    options?: { rewrite?: boolean; expandQueries?: number }
   ): Promise<RagQueryResult> {
     return api.post(
       `/courses/${courseId}/rag/query`,
       {
         question,
         session_id: sessionId,
+        rewrite: options?.rewrite,
+        expand_queries: options?.expandQueries,
       },
       {
         timeout: 60000,
@@ -119,6 +239,72 @@ const ragService = {
   getHistory(courseId: number): Promise<RagQueryHistory[]> {
     return api.get(`/courses/${courseId}/rag/queries`)
   },
+
+  submitFeedback(
+    courseId: number,
+    queryId: number,
+    rating: 1 | -1,
+    comment?: string
+  ): Promise<RagQueryFeedback> {
+    return api.post(`/courses/${courseId}/rag/queries/${queryId}/feedback`, {
+      rating,
+      comment,
+    })
+  },
+
+  listReviewQueue(
+    courseId: number,
+    params?: {
+      reason?: 'low_rated' | 'no_evidence'
+      status?: 'open' | 'resolved' | 'dismissed' | 'all'
+    }
+  ): Promise<RagReviewItem[]> {
+    return api.get(`/courses/${courseId}/rag/review`, { params })
+  },
+
+  saveCanonicalAnswer(
+    courseId: number,
+    queryId: number,
+    answer: string,
+    question?: string
+  ): Promise<{ query_id: number; canonical_chunk_id: number }> {
+    return api.post(
+      `/courses/${courseId}/rag/review/${queryId}/canonical`,
+      { answer, question },
+      { headers: ragCredentialHeaders() }
+    )
+  },
+
+  dismissReview(courseId: number, queryId: number): Promise<void> {
+    return api.post(`/courses/${courseId}/rag/review/${queryId}/dismiss`)
+  },
+
+  listEvalCases(courseId: number): Promise<RagEvalCase[]> {
+    return api.get(`/courses/${courseId}/rag/eval/cases`)
+  },
+
+  createEvalCase(
+    courseId: number,
+    data: { question: string; expected_answer?: string; expected_doc_ids: number[] }
+  ): Promise<RagEvalCase> {
+    return api.post(`/courses/${courseId}/rag/eval/cases`, data)
+  },
+
+  deleteEvalCase(courseId: number, caseId: number): Promise<void> {
+    return api.delete(`/courses/${courseId}/rag/eval/cases/${caseId}`)
+  },
+
+  startEvalRun(courseId: number, k?: number): Promise<RagEvalRun> {
+    return api.post(`/courses/${courseId}/rag/eval/runs`, { k }, { headers: ragCredentialHeaders() })
+  },
+
+  listEvalRuns(courseId: number): Promise<RagEvalRun[]> {
+    return api.get(`/courses/${courseId}/rag/eval/runs`)
+  },
+
+  getEvalRun(courseId: number, runId: number): Promise<RagEvalRun> {
+    return api.get(`/courses/${courseId}/rag/eval/runs/${runId}`)
+  },
 }
 
 export default ragService
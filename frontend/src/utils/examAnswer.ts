@@ -0,0 +1,171 @@
+// 填空题答案存为 JSON 数组，每个元素是一个空的可接受答案列表，如 [["栈","stack"],["后进先出"]]；
+// 数值题答案存为 {"value":9.8,"tolerance":0.1,"unit":"m/s^2"}。以下函数在编辑表单和答卷中互相转换
+
+export interface NumericAnswerSpec {
+  value: number
+  tolerance?: number
+  relativeTolerance?: number
+  unit?: string
+  units?: Record<string, number>
+}
+
+export const parseBlankAnswer = (answer?: string): string[][] => {
+  if (!answer) return []
+  try {
+    const parsed = JSON.parse(answer)
+    if (Array.isArray(parsed)) {
+      return parsed.map(blank => (Array.isArray(blank) ? blank : [blank]).map(item => String(item)))
+    }
+  } catch {
+    // 非 JSON 时按文本写法解析
+  }
+  return answer.split(/[;；]/).map(blank => blank.split('|').map(item => item.trim()))
+}
+
+// 编辑表单中每行一个空，同一空的多个可接受答案用 | 分隔
+export const formatBlankText = (answer?: string) =>
+  parseBlankAnswer(answer)
+    .map(blank => blank.join(' | '))
+    .join('\n')
+
+export const parseBlankText = (text?: string): string[][] =>
+  (text || '')
+    .split('\n')
+    .map(line => line.split('|').map(item => item.trim()).filter(Boolean))
+    .filter(blank => blank.length > 0)
+
+export const parseNumericAnswer = (answer?: string): NumericAnswerSpec | null => {
+  if (!answer) return null
+  try {
+    const parsed = JSON.parse(answer)
+    return typeof parsed?.value === 'number' ? parsed : null
+  } catch {
+    return null
+  }
+}
+
+// 学生的填空题答案为每空一项的 JSON 数组
+export const parseStudentBlanks = (answer?: string): string[] => {
+  if (!answer) return []
+  try {
+    const parsed = JSON.parse(answer)
+    if (Array.isArray(parsed)) return parsed.map(item => String(item ?? ''))
+  } catch {
+    // 只有一个空时可以是纯文本
+  }
+  return [answer]
+}
+
+// formatExamAnswer 把填空题、数值题和编程题的答案转为便于阅读的文本，其他题型原样返回
+export const formatExamAnswer = (type: string, answer?: string, isStudentAnswer = false): string => {
+  if (!answer) return ''
+  if (type === 'FILL_BLANK') {
+    if (isStudentAnswer) return parseStudentBlanks(answer).join('；')
+    return parseBlankAnswer(answer)
+      .map(blank => blank.join(' / '))
+      .join('；')
+  }
+  if (type === 'CODE') {
+    if (isStudentAnswer) return parseCodeSubmission(answer).source
+    const spec = parseCodeSpec(answer)
+    if (!spec) return answer
+    return `${spec.testCases.length} 个测试用例，时间限制 ${spec.timeLimitMs} ms，内存限制 ${spec.memoryLimitMb} MB`
+  }
+  if (type === 'NUMERIC' && !isStudentAnswer) {
+    const spec = parseNumericAnswer(answer)
+    if (!spec) return answer
+    let text = String(spec.value)
+    if (spec.tolerance) text += ` ± ${spec.tolerance}`
+    if (spec.relativeTolerance) text += `（相对误差 ${spec.relativeTolerance * 100}%）`
+    if (spec.unit) text += ` ${spec.unit}`
+    return text
+  }
+  return answer
+}
+
+// 编程题答案为评测配置 {"languages":["python"],"timeLimitMs":1000,"memoryLimitMb":256,"testCases":[...]}，
+// 学生作答为 {"language":"python","source":"..."}；开启自动评测的作业使用同样的评测配置
+export interface CodeTestCase {
+  input: string
+  output: string
+  sample?: boolean
+}
+
+export interface CodeQuestionSpec {
+  languages?: string[]
+  timeLimitMs: number
+  memoryLimitMb: number
+  testCases: CodeTestCase[]
+}
+
+export const CODE_LANGUAGE_LABELS: Record<string, string> = {
+  python: 'Python 3',
+  c: 'C (C11)',
+  cpp: 'C++ (C++17)',
+  go: 'Go',
+  java: 'Java（类名 Main）',
+}
+
+export const CODE_VERDICT_LABELS: Record<string, { text: string; color: string }> = {
+  AC: { text: '通过', color: 'success' },
+  WA: { text: '答案错误', color: 'error' },
+  TLE: { text: '超时', color: 'warning' },
+  MLE: { text: '内存超限', color: 'warning' },
+  OLE: { text: '输出超限', color: 'warning' },
+  RE: { text: '运行错误', color: 'error' },
+  CE: { text: '编译错误', color: 'default' },
+}
+
+export const CODE_JUDGE_STATUS_LABELS: Record<string, string> = {
+  pending: '等待评测',
+  processing: '评测中',
+  done: '已评测',
+  failed: '评测失败',
+}
+
+export const parseCodeSpec = (answer?: string): CodeQuestionSpec | null => {
+  if (!answer) return null
+  try {
+    const parsed = JSON.parse(answer)
+    return Array.isArray(parsed?.testCases) ? parsed : null
+  } catch {
+    return null
+  }
+}
+
+export const parseCodeSubmission = (answer?: string): { language: string; source: string } => {
+  if (!answer) return { language: '', source: '' }
+  try {
+    const parsed = JSON.parse(answer)
+    if (parsed && typeof parsed === 'object') {
+      return { language: String(parsed.language || ''), source: String(parsed.source || '') }
+    }
+  } catch {
+    // 非 JSON 时视为源代码
+  }
+  return { language: '', source: answer }
+}
+
+// 编程题表单字段（code_languages / code_time_limit / code_memory_limit / code_cases）与评测配置互转，
+// 试卷编辑与作业自动评测共用
+export const codeSpecFormValues = (answer?: string) => {
+  const spec = parseCodeSpec(answer)
+  return {
+    code_languages: spec?.languages || [],
+    code_time_limit: spec?.timeLimitMs || 1000,
+    code_memory_limit: spec?.memoryLimitMb || 256,
+    code_cases: spec?.testCases || [],
+  }
+}
+
+export const buildCodeSpec = (values: any): string =>
+  JSON.stringify({
+    languages: values.code_languages || [],
+    timeLimitMs: values.code_time_limit,
+    memoryLimitMb: values.code_memory_limit,
+    testCases: (values.code_cases || []).map((testCase: CodeTestCase) => ({
+      input: testCase.input || '',
+      output: testCase.output || '',
+      sample: Boolean(testCase.sample),
+    })),
+  })